@@ -0,0 +1,624 @@
+package blame
+
+import (
+	"cmp"
+	"errors"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/tsoud/GoTGit.git/diff"
+	"github.com/tsoud/GoTGit.git/gitobj"
+)
+
+// Minimum number of alphanumeric characters in a block of lines for it to be
+// recognized as moved (`-M`) or copied (`-C`), as in Git.
+const (
+	DefaultMoveScore = 20
+	DefaultCopyScore = 40
+)
+
+var ErrNoSuchPath = errors.New("no such path")
+
+type Options struct {
+	// IgnoreWhitespace compares lines ignoring all whitespace, as with `-w`.
+	IgnoreWhitespace bool
+	// DetectMoves finds lines moved within the file. DetectCopies also finds
+	// lines moved or copied from other files: at level 1 from files changed by
+	// the same commit, at level 2 also from any file of the parent when the
+	// file was created, and at level 3 from any file of any parent.
+	DetectMoves  bool
+	DetectCopies int
+	MoveScore    int
+	CopyScore    int
+	// IgnoreRevs are commits whose changes are attributed to the lines they
+	// replaced, as with `--ignore-rev`.
+	IgnoreRevs map[string]bool
+	// Ranges limits blame to [start, end) ranges of 0-based line numbers.
+	Ranges [][2]int
+	// Found, if set, is called with each entry as soon as it is attributed.
+	Found func(*Entry)
+}
+
+// Origin is the version of a file in one commit that lines are attributed to.
+type Origin struct {
+	Commit *gitobj.Commit
+	Path   string
+	Blob   string
+	// Previous is the version of the file in the first parent that differs.
+	Previous *Origin
+	loaded   bool
+	lines    []string
+	keys     []string
+}
+
+// Entry attributes a run of lines of the blamed file to an origin. Line
+// numbers are 0-based.
+type Entry struct {
+	Origin    *Origin
+	FinalLine int
+	OrigLine  int
+	NumLines  int
+}
+
+type Result struct {
+	// Lines are the lines of the blamed file, each with its newline.
+	Lines   []string
+	Entries []*Entry
+}
+
+type scoreboard struct {
+	opts      *Options
+	moveScore int
+	copyScore int
+	commits   map[string]*gitobj.Commit
+	origins   map[string]*Origin
+	pending   map[*Origin][]*Entry
+	queue     []*Origin
+	entries   []*Entry
+}
+
+func File(commit *gitobj.Commit, filePath string, contents []byte, opts *Options) (*Result, error) {
+	// Attribute each line of `filePath` in `commit` to the commit that last
+	// changed it, following the file back through renames. If `contents` is not
+	// nil it replaces the file in `commit`, so uncommitted changes can be blamed
+	// on a made-up commit whose parent is HEAD. Commits without a tree only
+	// follow the file by name.
+	board := &scoreboard{
+		opts:      opts,
+		moveScore: opts.MoveScore,
+		copyScore: opts.CopyScore,
+		commits:   map[string]*gitobj.Commit{commit.Hash: commit},
+		origins:   make(map[string]*Origin),
+		pending:   make(map[*Origin][]*Entry),
+	}
+	if board.moveScore == 0 {
+		board.moveScore = DefaultMoveScore
+	}
+	if board.copyScore == 0 {
+		board.copyScore = DefaultCopyScore
+	}
+	var final *Origin
+	if contents != nil {
+		blobObj, err := gitobj.HashObject("blob", contents)
+		if err != nil {
+			return nil, err
+		}
+		final = &Origin{Commit: commit, Path: filePath, Blob: blobObj.Hash}
+		final.setContent(contents, opts)
+	} else {
+		var err error
+		if final, err = board.origin(commit, filePath); err != nil {
+			return nil, err
+		}
+		if final == nil {
+			return nil, ErrNoSuchPath
+		}
+		if err := board.load(final); err != nil {
+			return nil, err
+		}
+	}
+
+	ranges := opts.Ranges
+	if len(ranges) == 0 {
+		ranges = [][2]int{{0, len(final.lines)}}
+	}
+	for _, lineRange := range ranges {
+		start, end := max(lineRange[0], 0), min(lineRange[1], len(final.lines))
+		if start < end {
+			board.assign(&Entry{Origin: final, FinalLine: start, OrigLine: start, NumLines: end - start})
+		}
+	}
+
+	for len(board.queue) > 0 {
+		suspect := board.next()
+		entries := board.pending[suspect]
+		delete(board.pending, suspect)
+		remaining, err := board.passBlame(suspect, entries)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range remaining {
+			board.entries = append(board.entries, entry)
+			if opts.Found != nil {
+				opts.Found(entry)
+			}
+		}
+	}
+
+	// Join runs of lines that were split on the way but came from the same place.
+	slices.SortFunc(board.entries, func(a, b *Entry) int { return cmp.Compare(a.FinalLine, b.FinalLine) })
+	var entries []*Entry
+	for _, entry := range board.entries {
+		if n := len(entries); n > 0 {
+			last := entries[n-1]
+			if last.Origin == entry.Origin && last.FinalLine+last.NumLines == entry.FinalLine &&
+				last.OrigLine+last.NumLines == entry.OrigLine {
+				last.NumLines += entry.NumLines
+				continue
+			}
+		}
+		joined := *entry
+		entries = append(entries, &joined)
+	}
+	return &Result{Lines: final.lines, Entries: entries}, nil
+}
+
+func (origin *Origin) setContent(content []byte, opts *Options) {
+	origin.loaded = true
+	origin.lines = diff.SplitLines(content)
+	origin.keys = origin.lines
+	if opts.IgnoreWhitespace {
+		origin.keys = make([]string, len(origin.lines))
+		for i, line := range origin.lines {
+			origin.keys[i] = strings.Join(strings.Fields(line), "")
+		}
+	}
+}
+
+func lookup(treeHash, filePath string) (*gitobj.TreeEntry, error) {
+	// Find the entry at `filePath` by walking down from the tree `treeHash`.
+	parts := strings.Split(filePath, "/")
+	for i, part := range parts {
+		entries, err := gitobj.ReadTree(treeHash)
+		if err != nil {
+			return nil, err
+		}
+		found := slices.IndexFunc(entries, func(entry gitobj.TreeEntry) bool { return entry.Name == part })
+		if found == -1 {
+			return nil, nil
+		}
+		if i == len(parts)-1 {
+			return &entries[found], nil
+		}
+		if gitobj.ModeType(entries[found].Mode) != "tree" {
+			return nil, nil
+		}
+		treeHash = entries[found].Hash
+	}
+	return nil, nil
+}
+
+func ReadFile(commit *gitobj.Commit, filePath string) ([]byte, error) {
+	// Read the contents of `filePath` in `commit`.
+	entry, err := lookup(commit.Tree, filePath)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil || gitobj.ModeType(entry.Mode) != "blob" {
+		return nil, ErrNoSuchPath
+	}
+	obj, err := gitobj.ReadGitObj(entry.Hash)
+	if err != nil {
+		return nil, err
+	}
+	return obj.Content, nil
+}
+
+func (board *scoreboard) commit(hash string) (*gitobj.Commit, error) {
+	if commit, ok := board.commits[hash]; ok {
+		return commit, nil
+	}
+	commit, err := gitobj.ReadCommit(hash)
+	if err != nil {
+		return nil, err
+	}
+	board.commits[hash] = commit
+	return commit, nil
+}
+
+func (board *scoreboard) origin(commit *gitobj.Commit, filePath string) (*Origin, error) {
+	// Return the version of `filePath` in `commit`, or nil if there is no such
+	// file. Origins are shared so lines reaching a commit along several paths
+	// end up on the same one.
+	key := commit.Hash + ":" + filePath
+	if origin, ok := board.origins[key]; ok {
+		return origin, nil
+	}
+	entry, err := lookup(commit.Tree, filePath)
+	if err != nil {
+		return nil, err
+	}
+	var origin *Origin
+	if entry != nil && gitobj.ModeType(entry.Mode) == "blob" {
+		origin = &Origin{Commit: commit, Path: filePath, Blob: entry.Hash}
+	}
+	board.origins[key] = origin
+	return origin, nil
+}
+
+func (board *scoreboard) load(origin *Origin) error {
+	if origin.loaded {
+		return nil
+	}
+	obj, err := gitobj.ReadGitObj(origin.Blob)
+	if err != nil {
+		return err
+	}
+	origin.setContent(obj.Content, board.opts)
+	return nil
+}
+
+func (board *scoreboard) assign(entry *Entry) {
+	if _, queued := board.pending[entry.Origin]; !queued {
+		board.queue = append(board.queue, entry.Origin)
+	}
+	board.pending[entry.Origin] = append(board.pending[entry.Origin], entry)
+}
+
+func (board *scoreboard) next() *Origin {
+	// Take the most recently committed suspect, so that a commit is only looked
+	// at once all the lines its descendants pass on have reached it.
+	newest := 0
+	for i, origin := range board.queue {
+		if origin.Commit.Committer.When.After(board.queue[newest].Commit.Committer.When) {
+			newest = i
+		}
+	}
+	origin := board.queue[newest]
+	board.queue = slices.Delete(board.queue, newest, newest+1)
+	return origin
+}
+
+func (board *scoreboard) parentOrigin(suspect *Origin, parent *gitobj.Commit) (*Origin, error) {
+	// Find the file in `parent`, under the same name or the one it was renamed from.
+	if origin, err := board.origin(parent, suspect.Path); origin != nil || err != nil {
+		return origin, err
+	}
+	if suspect.Commit.Tree == "" {
+		return nil, nil
+	}
+	changes, err := diff.TreeDiff(parent.Tree, suspect.Commit.Tree,
+		&diff.Options{Recursive: true, DetectRenames: true})
+	if err != nil {
+		return nil, err
+	}
+	for _, change := range changes {
+		if change.Status == diff.Renamed && change.NewPath == suspect.Path {
+			return board.origin(parent, change.OldPath)
+		}
+	}
+	return nil, nil
+}
+
+func (board *scoreboard) passBlame(suspect *Origin, entries []*Entry) ([]*Entry, error) {
+	// Pass the lines the suspect shares with its parents on to them, returning
+	// the lines that were introduced by the suspect itself.
+	if err := board.load(suspect); err != nil {
+		return nil, err
+	}
+	var parents []*gitobj.Commit
+	var origins []*Origin
+	for _, parentHash := range suspect.Commit.Parents {
+		parent, err := board.commit(parentHash)
+		if err != nil {
+			return nil, err
+		}
+		parents = append(parents, parent)
+		origin, err := board.parentOrigin(suspect, parent)
+		if err != nil {
+			return nil, err
+		}
+		if origin == nil {
+			continue
+		}
+		if origin.Blob == suspect.Blob {
+			for _, entry := range entries {
+				entry.Origin = origin
+				board.assign(entry)
+			}
+			return nil, nil
+		}
+		if suspect.Previous == nil {
+			suspect.Previous = origin
+		}
+		origins = append(origins, origin)
+	}
+
+	for _, origin := range origins {
+		if err := board.load(origin); err != nil {
+			return nil, err
+		}
+		entries = board.transfer(entries, origin, lineMapping(suspect, origin, false))
+	}
+	if board.opts.IgnoreRevs[suspect.Commit.Hash] && len(origins) > 0 {
+		entries = board.transfer(entries, origins[0], lineMapping(suspect, origins[0], true))
+	}
+
+	if board.opts.DetectMoves || board.opts.DetectCopies > 0 {
+		for _, origin := range origins {
+			mapping := blockMapping(suspect, entries, origin, board.moveScore)
+			entries = board.transfer(entries, origin, mapping)
+		}
+	}
+	if board.opts.DetectCopies > 0 {
+		for _, parent := range parents {
+			var err error
+			if entries, err = board.findCopies(suspect, entries, parent, origins); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return entries, nil
+}
+
+func (board *scoreboard) findCopies(suspect *Origin, entries []*Entry, parent *gitobj.Commit,
+	origins []*Origin) ([]*Entry, error) {
+	// Look for the remaining lines in other files of `parent`: those changed by
+	// the suspect's commit, or any file at the higher copy detection levels.
+	if len(entries) == 0 {
+		return entries, nil
+	}
+	sameFile := ""
+	if i := slices.IndexFunc(origins, func(origin *Origin) bool { return origin.Commit == parent }); i != -1 {
+		sameFile = origins[i].Path
+	}
+
+	var paths []string
+	harder := board.opts.DetectCopies >= 3 || board.opts.DetectCopies == 2 && sameFile != suspect.Path
+	switch {
+	case harder:
+		files, err := gitobj.ReadTreeRecursive(parent.Tree)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			paths = append(paths, file.Name)
+		}
+	case suspect.Commit.Tree != "":
+		changes, err := diff.TreeDiff(parent.Tree, suspect.Commit.Tree, &diff.Options{Recursive: true})
+		if err != nil {
+			return nil, err
+		}
+		for _, change := range changes {
+			if change.Status != diff.Added {
+				paths = append(paths, change.OldPath)
+			}
+		}
+	}
+
+	var candidates []*Origin
+	for _, filePath := range paths {
+		if filePath == sameFile || filePath == suspect.Path {
+			continue
+		}
+		origin, err := board.origin(parent, filePath)
+		if err != nil {
+			return nil, err
+		}
+		if origin == nil {
+			continue
+		}
+		if err := board.load(origin); err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, origin)
+	}
+
+	// Each entry goes to the file with the most matching content, the last one
+	// on ties as in Git. Parts left over may match another file on a later round.
+	for progress := true; progress && len(entries) > 0; {
+		progress = false
+		var remaining []*Entry
+		for _, entry := range entries {
+			var best *Origin
+			var bestMapping []int
+			bestScore := 0
+			for _, origin := range candidates {
+				mapping := blockMapping(suspect, []*Entry{entry}, origin, board.copyScore)
+				if matched := mappedScore(suspect, mapping); matched > 0 && matched >= bestScore {
+					best, bestMapping, bestScore = origin, mapping, matched
+				}
+			}
+			if best == nil {
+				remaining = append(remaining, entry)
+				continue
+			}
+			progress = true
+			remaining = append(remaining, board.transfer([]*Entry{entry}, best, bestMapping)...)
+		}
+		entries = remaining
+	}
+	return entries, nil
+}
+
+func mappedScore(suspect *Origin, mapping []int) int {
+	count := 0
+	for line, target := range mapping {
+		if target != -1 {
+			count += score(suspect.lines[line : line+1])
+		}
+	}
+	return count
+}
+
+func lineMapping(suspect, parent *Origin, guess bool) []int {
+	// Map each line of the suspect to the same line in its parent's version, or
+	// -1. With `guess`, changed lines are also mapped to similar lines of the
+	// parent, which is how changes of ignored commits are seen through: lines
+	// replacing others are matched among those, while added lines may match
+	// anywhere in the parent.
+	mapping := make([]int, len(suspect.lines))
+	for i := range mapping {
+		mapping[i] = -1
+	}
+	allLines := make([]int, len(parent.lines))
+	for i := range allLines {
+		allLines[i] = i
+	}
+	var deleted, inserted []int
+	flush := func() {
+		if guess && len(deleted) > 0 {
+			fuzzyMatch(mapping, suspect, parent, inserted, deleted)
+		} else if guess {
+			fuzzyMatch(mapping, suspect, parent, inserted, allLines)
+		}
+		deleted, inserted = nil, nil
+	}
+	for _, edit := range diff.Lines(parent.keys, suspect.keys) {
+		switch edit.Op {
+		case diff.Equal:
+			flush()
+			mapping[edit.NewLine] = edit.OldLine
+		case diff.Delete:
+			deleted = append(deleted, edit.OldLine)
+		case diff.Insert:
+			inserted = append(inserted, edit.NewLine)
+		}
+	}
+	flush()
+	return mapping
+}
+
+func fuzzyMatch(mapping []int, suspect, parent *Origin, targets, candidates []int) {
+	// Map suspect lines to similar parent lines, keeping their order. The most
+	// similar pair is matched first, then the lines on either side of it. A line
+	// whose best candidates are equally similar is left alone.
+	bestTarget, bestCandidate, bestScore := -1, -1, 0
+	for i, target := range targets {
+		top, second, at := 0, 0, -1
+		for j, candidate := range candidates {
+			similar := similarity(parent.lines[candidate], suspect.lines[target])
+			if similar > top {
+				top, second, at = similar, top, j
+			} else if similar > second {
+				second = similar
+			}
+		}
+		if top > second && top > bestScore {
+			bestTarget, bestCandidate, bestScore = i, at, top
+		}
+	}
+	if bestTarget == -1 {
+		return
+	}
+	mapping[targets[bestTarget]] = candidates[bestCandidate]
+	fuzzyMatch(mapping, suspect, parent, targets[:bestTarget], candidates[:bestCandidate])
+	fuzzyMatch(mapping, suspect, parent, targets[bestTarget+1:], candidates[bestCandidate+1:])
+}
+
+func similarity(a, b string) int {
+	// Count the pairs of adjacent characters two lines have in common, or 0 if
+	// that is less than half of their pairs.
+	pairs := make(map[string]int)
+	for i := 0; i+1 < len(a); i++ {
+		pairs[a[i:i+2]]++
+	}
+	count := 0
+	for i := 0; i+1 < len(b); i++ {
+		if pairs[b[i:i+2]] > 0 {
+			pairs[b[i:i+2]]--
+			count++
+		}
+	}
+	if 4*count < max(len(a)-1, 0)+max(len(b)-1, 0) {
+		return 0
+	}
+	return count
+}
+
+func blockMapping(suspect *Origin, entries []*Entry, source *Origin, minScore int) []int {
+	// Map blocks of the lines in `entries` to the same lines anywhere in
+	// `source`, for lines that were moved or copied. Blocks with fewer than
+	// `minScore` alphanumeric characters are too common to tell.
+	mapping := make([]int, len(suspect.lines))
+	for i := range mapping {
+		mapping[i] = -1
+	}
+	var match func(start, end int)
+	match = func(start, end int) {
+		// Take the longest block found in the source, then look on either side of it.
+		length, suspectStart, sourceStart := longestCommon(suspect.keys[start:end], source.keys)
+		if length == 0 || score(suspect.lines[start+suspectStart:start+suspectStart+length]) < minScore {
+			return
+		}
+		for i := 0; i < length; i++ {
+			mapping[start+suspectStart+i] = sourceStart + i
+		}
+		match(start, start+suspectStart)
+		match(start+suspectStart+length, end)
+	}
+	for _, entry := range entries {
+		match(entry.OrigLine, entry.OrigLine+entry.NumLines)
+	}
+	return mapping
+}
+
+func longestCommon(a, b []string) (length, aStart, bStart int) {
+	// Find the longest run of lines appearing in both `a` and `b`.
+	prev, row := make([]int, len(b)+1), make([]int, len(b)+1)
+	for i := range a {
+		for j := range b {
+			row[j+1] = 0
+			if a[i] == b[j] {
+				row[j+1] = prev[j] + 1
+				if row[j+1] > length {
+					length, aStart, bStart = row[j+1], i+1-row[j+1], j+1-row[j+1]
+				}
+			}
+		}
+		prev, row = row, prev
+	}
+	return length, aStart, bStart
+}
+
+func score(lines []string) int {
+	count := 0
+	for _, line := range lines {
+		for _, ch := range line {
+			if unicode.IsLetter(ch) || unicode.IsDigit(ch) {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+func (board *scoreboard) transfer(entries []*Entry, target *Origin, mapping []int) []*Entry {
+	// Pass the runs of lines that `mapping` places in `target` on to it,
+	// returning the lines that stay with their current origin.
+	var remaining []*Entry
+	for _, entry := range entries {
+		for start := 0; start < entry.NumLines; {
+			line := entry.OrigLine + start
+			mapped := mapping[line] != -1
+			end := start + 1
+			for ; end < entry.NumLines; end++ {
+				next := mapping[entry.OrigLine+end]
+				if (next != -1) != mapped || mapped && next != mapping[entry.OrigLine+end-1]+1 {
+					break
+				}
+			}
+			part := &Entry{Origin: entry.Origin, FinalLine: entry.FinalLine + start, OrigLine: line,
+				NumLines: end - start}
+			if mapped {
+				part.Origin, part.OrigLine = target, mapping[line]
+				board.assign(part)
+			} else {
+				remaining = append(remaining, part)
+			}
+			start = end
+		}
+	}
+	return remaining
+}
@@ -0,0 +1,122 @@
+package blame
+
+import (
+	"testing"
+
+	"github.com/tsoud/GoTGit.git/gitobj"
+	"github.com/tsoud/GoTGit.git/internal/testutil"
+)
+
+func writeTestCommit(t *testing.T, files map[string]string, parents ...string) *gitobj.Commit {
+	// Store the files as a tree and commit it.
+	t.Helper()
+	commit, err := gitobj.ReadCommit(testutil.WriteCommit(t, testutil.WriteTree(t, files), "test", parents...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return commit
+}
+
+func lineCommits(result *Result) []string {
+	// List the commit each line is attributed to.
+	commits := make([]string, len(result.Lines))
+	for _, entry := range result.Entries {
+		for i := 0; i < entry.NumLines; i++ {
+			commits[entry.FinalLine+i] = entry.Origin.Commit.Hash
+		}
+	}
+	return commits
+}
+
+func checkLineCommits(t *testing.T, result *Result, want ...string) {
+	t.Helper()
+	got := lineCommits(result)
+	if len(got) != len(want) {
+		t.Fatalf("got %d lines, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("line %d: got commit %s, want %s", i+1, got[i], want[i])
+		}
+	}
+}
+
+func TestFile(t *testing.T) {
+	testutil.ChdirTemp(t)
+	base := writeTestCommit(t, map[string]string{"f": "one\ntwo\nthree\n"})
+	edit := writeTestCommit(t, map[string]string{"f": "one\nTWO\nthree\n"}, base.Hash)
+	rename := writeTestCommit(t, map[string]string{"g": "one\nTWO\nthree\nfour\n"}, edit.Hash)
+
+	result, err := File(rename, "g", nil, &Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkLineCommits(t, result, base.Hash, edit.Hash, base.Hash, rename.Hash)
+	if path := result.Entries[0].Origin.Path; path != "f" {
+		t.Errorf("got path %s for the first line, want f", path)
+	}
+	if previous := result.Entries[1].Origin.Previous; previous == nil || previous.Commit.Hash != base.Hash {
+		t.Errorf("got previous %v for the edited line, want the base commit", previous)
+	}
+
+	result, err = File(rename, "g", nil, &Options{Ranges: [][2]int{{1, 2}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Entries) != 1 || result.Entries[0].FinalLine != 1 || result.Entries[0].NumLines != 1 {
+		t.Errorf("got entries %+v for the range, want only line 2", result.Entries)
+	}
+
+	if _, err := File(rename, "missing", nil, &Options{}); err != ErrNoSuchPath {
+		t.Errorf("got error %v for a missing file, want ErrNoSuchPath", err)
+	}
+}
+
+func TestFileContents(t *testing.T) {
+	testutil.ChdirTemp(t)
+	base := writeTestCommit(t, map[string]string{"f": "one\ntwo\n"})
+	uncommitted := &gitobj.Commit{Hash: "0000000000000000000000000000000000000000", Parents: []string{base.Hash}}
+
+	result, err := File(uncommitted, "f", []byte("one\nchanged\n"), &Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkLineCommits(t, result, base.Hash, uncommitted.Hash)
+}
+
+func TestFileOptions(t *testing.T) {
+	testutil.ChdirTemp(t)
+	block := "first moved line of text\nsecond moved line of text\n"
+	base := writeTestCommit(t, map[string]string{"f": block + "a\nb\n", "other": "copied content line here\n" +
+		"with a second line of it\n"})
+	reformat := writeTestCommit(t, map[string]string{"f": "  " + block[:25] + "  " + block[25:] + "a\nb\n",
+		"other": "copied content line here\nwith a second line of it\n"}, base.Hash)
+	move := writeTestCommit(t, map[string]string{"f": "a\nb\n  " + block[:25] + "  " + block[25:] +
+		"copied content line here\nwith a second line of it\n", "other": "changed\n"}, reformat.Hash)
+
+	tests := []struct {
+		name string
+		opts Options
+		want []string
+	}{
+		{"plain", Options{}, []string{base.Hash, base.Hash, move.Hash, move.Hash, move.Hash, move.Hash}},
+		{"moves", Options{DetectMoves: true},
+			[]string{base.Hash, base.Hash, reformat.Hash, reformat.Hash, move.Hash, move.Hash}},
+		{"moves_whitespace", Options{DetectMoves: true, IgnoreWhitespace: true},
+			[]string{base.Hash, base.Hash, base.Hash, base.Hash, move.Hash, move.Hash}},
+		{"copies", Options{DetectCopies: 1},
+			[]string{base.Hash, base.Hash, reformat.Hash, reformat.Hash, base.Hash, base.Hash}},
+		{"ignore_revs", Options{DetectMoves: true, IgnoreRevs: map[string]bool{reformat.Hash: true}},
+			[]string{base.Hash, base.Hash, base.Hash, base.Hash, move.Hash, move.Hash}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := File(move, "f", nil, &test.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkLineCommits(t, result, test.want...)
+		})
+	}
+}
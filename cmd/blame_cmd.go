@@ -0,0 +1,454 @@
+package cmd
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/tsoud/GoTGit.git/blame"
+	"github.com/tsoud/GoTGit.git/diff"
+	"github.com/tsoud/GoTGit.git/gitobj"
+	"github.com/tsoud/GoTGit.git/index"
+	"github.com/tsoud/GoTGit.git/refs"
+)
+
+const BlameUsageMsg = "usage: blame [-L <range>] [-w] [-M[<num>]] [-C[<num>]] [--ignore-rev <rev>]\n" +
+	"             [--ignore-revs-file <file>] [-p | --line-porcelain | --incremental] [<rev>] [--] <file>\n"
+
+const AnnotateUsageMsg = "usage: annotate [-L <range>] [-w] [-M[<num>]] [-C[<num>]] [--ignore-rev <rev>]\n" +
+	"                [--ignore-revs-file <file>] [<rev>] [--] <file>\n"
+
+const blameDateFormat = "2006-01-02 15:04:05 -0700"
+
+type BlameOptions struct {
+	annotate        bool
+	lineRanges      stringList
+	ignoreSpace     bool
+	detectMoves     optionalValue
+	detectCopies    countedValue
+	porcelain       bool
+	linePorcelain   bool
+	incremental     bool
+	ignoreRevs      stringList
+	ignoreRevsFiles stringList
+}
+
+func SetupBlameCmd(command string) (*flag.FlagSet, *BlameOptions) {
+	blameCmd := flag.NewFlagSet(command, flag.ExitOnError)
+	opts := &BlameOptions{annotate: command == "annotate"}
+
+	blameCmd.Var(&opts.lineRanges, "L", "Only blame the lines in `<start>,<end>`, where each may be a line "+
+		"number or /regex/ and <end> may also be +<count> or -<count>. May be given several times.")
+	blameCmd.BoolVar(&opts.ignoreSpace, "w", false, "Ignore whitespace when comparing versions of lines.")
+	blameCmd.Var(&opts.detectMoves, "M", "Detect lines moved within the file, optionally with the "+
+		"minimum number of alphanumeric characters in a moved block (default 20).")
+	blameCmd.Var(&opts.detectCopies, "C", "Also detect lines moved or copied from other files changed "+
+		"in the same commit. Given twice, also look in every file of the commit creating the file; "+
+		"given three times, in every file of every commit.")
+	blameCmd.Var(&opts.ignoreRevs, "ignore-rev", "Pass the changes of <rev> on to the lines they "+
+		"replaced. May be given several times.")
+	blameCmd.Var(&opts.ignoreRevsFiles, "ignore-revs-file", "Ignore the revisions listed in <file>, "+
+		"one per line.")
+	if !opts.annotate {
+		blameCmd.BoolVar(&opts.porcelain, "p", false, "Show the output in a format meant for machines.")
+		blameCmd.BoolVar(&opts.porcelain, "porcelain", false, "Same as `-p`.")
+		blameCmd.BoolVar(&opts.linePorcelain, "line-porcelain", false, "Like --porcelain, but repeat "+
+			"the commit information for every line.")
+		blameCmd.BoolVar(&opts.incremental, "incremental", false, "Show each result as soon as it is "+
+			"found, in a format meant for machines.")
+	}
+
+	return blameCmd, opts
+}
+
+func BlameCmdHandler(args, paths []string, hasSeparator bool, opts *BlameOptions) error {
+	// Show the commit that last changed each line of a file. Without a revision
+	// the working tree version is blamed, with uncommitted lines attributed to
+	// a pseudo-commit.
+	usage := BlameUsageMsg
+	if opts.annotate {
+		usage = AnnotateUsageMsg
+	}
+	rev, file := "", ""
+	switch {
+	case hasSeparator && len(paths) == 1 && len(args) <= 1:
+		file = paths[0]
+		if len(args) == 1 {
+			rev = args[0]
+		}
+	case !hasSeparator && len(args) == 1:
+		file = args[0]
+	case !hasSeparator && len(args) == 2:
+		rev, file = args[0], args[1]
+	default:
+		return fmt.Errorf("%s", usage)
+	}
+	file = filepath.ToSlash(filepath.Clean(prefixPath(file)))
+	formats := 0
+	for _, set := range []bool{opts.porcelain, opts.linePorcelain, opts.incremental} {
+		if set {
+			formats++
+		}
+	}
+	if formats > 1 {
+		return fmt.Errorf("--porcelain, --line-porcelain and --incremental cannot be used together")
+	}
+
+	commit, contents, err := blameTarget(rev, file)
+	if err != nil {
+		return err
+	}
+	blameOpts, err := blameOptions(opts)
+	if err != nil {
+		return err
+	}
+	if blameOpts.Ranges, err = parseLineRanges(opts.lineRanges, diff.SplitLines(contents), file); err != nil {
+		return err
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	shown := make(map[string]bool)
+	if opts.incremental {
+		blameOpts.Found = func(entry *blame.Entry) {
+			fmt.Fprintf(out, "%s %d %d %d\n", entry.Origin.Commit.Hash, entry.OrigLine+1, entry.FinalLine+1,
+				entry.NumLines)
+			writeBlameDetails(out, entry.Origin, shown, false)
+			writeBlameFilename(out, entry.Origin)
+		}
+	}
+	result, err := blame.File(commit, file, contents, blameOpts)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case opts.incremental:
+	case opts.porcelain || opts.linePorcelain:
+		writeBlamePorcelain(out, result, opts.linePorcelain)
+	default:
+		writeBlame(out, result, file, opts.annotate)
+	}
+	return nil
+}
+
+func blameTarget(rev, file string) (*gitobj.Commit, []byte, error) {
+	// Find the commit and contents to blame: the file in `rev`, or the working
+	// tree file on top of HEAD when no revision is given.
+	if rev != "" {
+		hash, err := refs.ResolveCommit(rev)
+		if err != nil {
+			return nil, nil, fmt.Errorf("bad revision '%s'", rev)
+		}
+		commit, err := gitobj.ReadCommit(hash)
+		if err != nil {
+			return nil, nil, err
+		}
+		contents, err := blame.ReadFile(commit, file)
+		if err == blame.ErrNoSuchPath {
+			return nil, nil, fmt.Errorf("no such path %s in %s", file, rev)
+		}
+		return commit, contents, err
+	}
+
+	head, err := refs.Resolve(refs.HEAD)
+	if err != nil {
+		return nil, nil, fmt.Errorf("no such ref: HEAD")
+	}
+	headCommit, err := gitobj.ReadCommit(head)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := blame.ReadFile(headCommit, file); err != nil {
+		idx, idxErr := index.Read()
+		if err != blame.ErrNoSuchPath || idxErr != nil || idx.Find(file, 0) == nil {
+			return nil, nil, fmt.Errorf("no such path '%s' in HEAD", file)
+		}
+	}
+	contents, err := os.ReadFile(file)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Cannot lstat '%s': %w", file, err)
+	}
+	sig := gitobj.Signature{Name: "Not Committed Yet", Email: "not.committed.yet", When: time.Now()}
+	return &gitobj.Commit{
+		Hash:      strings.Repeat("0", len(head)),
+		Parents:   []string{head},
+		Author:    sig,
+		Committer: sig,
+		Message:   fmt.Sprintf("Version of %s from %s\n", file, file),
+	}, contents, nil
+}
+
+func blameOptions(opts *BlameOptions) (*blame.Options, error) {
+	blameOpts := &blame.Options{
+		IgnoreWhitespace: opts.ignoreSpace,
+		DetectMoves:      opts.detectMoves.set,
+		DetectCopies:     min(opts.detectCopies.count, 3),
+		IgnoreRevs:       make(map[string]bool),
+	}
+	for _, score := range []struct {
+		value  string
+		target *int
+	}{{opts.detectMoves.value, &blameOpts.MoveScore}, {opts.detectCopies.value, &blameOpts.CopyScore}} {
+		if score.value == "" {
+			continue
+		}
+		num, err := strconv.Atoi(score.value)
+		if err != nil || num < 0 {
+			return nil, fmt.Errorf("invalid score '%s'", score.value)
+		}
+		*score.target = num
+	}
+
+	revs := opts.ignoreRevs
+	for _, revsFile := range opts.ignoreRevsFiles {
+		contents, err := os.ReadFile(revsFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not open object name list: %s", revsFile)
+		}
+		for _, line := range strings.Split(string(contents), "\n") {
+			line, _, _ = strings.Cut(line, "#")
+			if line = strings.TrimSpace(line); line != "" {
+				revs = append(revs, line)
+			}
+		}
+	}
+	for _, rev := range revs {
+		hash, err := refs.ResolveCommit(rev)
+		if err != nil {
+			return nil, fmt.Errorf("invalid object name: %s", rev)
+		}
+		blameOpts.IgnoreRevs[hash] = true
+	}
+	return blameOpts, nil
+}
+
+func splitLineRange(spec string) (string, string, bool) {
+	// Split a `-L` argument at the comma after its start, which may be a regex
+	// containing commas.
+	start := 0
+	if strings.HasPrefix(spec, "/") || strings.HasPrefix(spec, "^/") {
+		start = strings.IndexByte(spec, '/') + 1
+		for start < len(spec) && spec[start] != '/' {
+			if spec[start] == '\\' {
+				start++
+			}
+			start++
+		}
+		start = min(start+1, len(spec))
+	}
+	if comma := strings.IndexByte(spec[start:], ','); comma != -1 {
+		return spec[:start+comma], spec[start+comma+1:], true
+	}
+	return spec, "", false
+}
+
+func findLine(pattern string, lines []string, from int) (int, error) {
+	// Find the first line at or after `from` matching a /regex/ pattern.
+	re, err := regexp.Compile(strings.TrimSuffix(strings.TrimPrefix(pattern, "/"), "/"))
+	if err != nil {
+		return 0, err
+	}
+	for i := from; i < len(lines); i++ {
+		if re.MatchString(lines[i]) {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("no match")
+}
+
+func parseLineRanges(specs []string, lines []string, file string) ([][2]int, error) {
+	// Turn `-L` arguments into 0-based [start, end) line ranges. A /regex/ start
+	// is searched for after the previous range, or from the top with ^/regex/.
+	var ranges [][2]int
+	searchFrom := 0
+	for _, spec := range specs {
+		startSpec, endSpec, _ := splitLineRange(spec)
+		invalid := fmt.Errorf("invalid -L argument '%s'", spec)
+
+		start := 0
+		switch {
+		case startSpec == "":
+		case strings.HasPrefix(startSpec, "/") || strings.HasPrefix(startSpec, "^/"):
+			from := searchFrom
+			if strings.HasPrefix(startSpec, "^") {
+				startSpec, from = startSpec[1:], 0
+			}
+			line, err := findLine(startSpec, lines, from)
+			if err != nil {
+				return nil, fmt.Errorf("-L parameter '%s' starting at line %d: %w", startSpec, from+1, err)
+			}
+			start = line
+		default:
+			num, err := strconv.Atoi(startSpec)
+			if err != nil || num < 1 {
+				return nil, invalid
+			}
+			start = num - 1
+		}
+		if start >= len(lines) {
+			return nil, fmt.Errorf("file %s has only %d line%s", file, len(lines),
+				map[bool]string{true: "", false: "s"}[len(lines) == 1])
+		}
+
+		end := len(lines)
+		switch {
+		case endSpec == "":
+		case strings.HasPrefix(endSpec, "/"):
+			line, err := findLine(endSpec, lines, start+1)
+			if err != nil {
+				return nil, fmt.Errorf("-L parameter '%s' starting at line %d: %w", endSpec, start+2, err)
+			}
+			end = line + 1
+		case strings.HasPrefix(endSpec, "+") || strings.HasPrefix(endSpec, "-"):
+			num, err := strconv.Atoi(endSpec[1:])
+			if err != nil || num < 1 {
+				return nil, invalid
+			}
+			if endSpec[0] == '+' {
+				end = start + num
+			} else {
+				start, end = max(start-num+1, 0), start+1
+			}
+		default:
+			num, err := strconv.Atoi(endSpec)
+			if err != nil || num < 1 {
+				return nil, invalid
+			}
+			if end = num; end <= start {
+				start, end = end-1, start+1
+			}
+		}
+		end = min(end, len(lines))
+		ranges = append(ranges, [2]int{start, end})
+		searchFrom = end
+	}
+	return ranges, nil
+}
+
+func blameHash(commit *gitobj.Commit, full bool) string {
+	// Abbreviate a hash for display, marking root commits with `^` as Git marks
+	// the boundary of the history it looked at.
+	length := 8
+	if full {
+		length = len(commit.Hash)
+	}
+	if len(commit.Parents) == 0 {
+		return "^" + commit.Hash[:length-1]
+	}
+	return commit.Hash[:length]
+}
+
+func withNewline(line string) string {
+	if strings.HasSuffix(line, "\n") {
+		return line
+	}
+	return line + "\n"
+}
+
+func writeBlame(out *bufio.Writer, result *blame.Result, file string, annotate bool) {
+	// Print each line with its commit, author and date, in `blame` format or in
+	// the tab-separated format of `annotate`.
+	showName := false
+	nameWidth, authorWidth, lastLine := 0, 0, 0
+	for _, entry := range result.Entries {
+		showName = showName || entry.Origin.Path != file
+		nameWidth = max(nameWidth, len(entry.Origin.Path))
+		authorWidth = max(authorWidth, utf8.RuneCountInString(entry.Origin.Commit.Author.Name))
+		lastLine = max(lastLine, entry.FinalLine+entry.NumLines)
+	}
+	// Line numbers are as wide as the last one shown, so -L ranges are
+	// padded for the lines they show rather than for the whole file.
+	numWidth := len(strconv.Itoa(lastLine))
+
+	for _, entry := range result.Entries {
+		origin := entry.Origin
+		hash := blameHash(origin.Commit, false)
+		author := origin.Commit.Author
+		date := author.When.Format(blameDateFormat)
+		for i := 0; i < entry.NumLines; i++ {
+			lineNum := entry.FinalLine + i + 1
+			line := withNewline(result.Lines[entry.FinalLine+i])
+			if annotate {
+				fmt.Fprintf(out, "%s\t(%10s\t%10s\t%d)%s", hash, author.Name, date, lineNum, line)
+				continue
+			}
+			out.WriteString(hash)
+			if showName {
+				fmt.Fprintf(out, " %-*s", nameWidth, origin.Path)
+			}
+			fmt.Fprintf(out, " (%s%*s %s %*d) %s", author.Name,
+				authorWidth-utf8.RuneCountInString(author.Name), "", date, numWidth, lineNum, line)
+		}
+	}
+}
+
+func writeBlameDetails(out *bufio.Writer, origin *blame.Origin, shown map[string]bool, repeat bool) bool {
+	// Print the commit information of the porcelain formats, once per commit
+	// unless `repeat` is set. Report whether anything was printed.
+	commit := origin.Commit
+	if shown[commit.Hash] && !repeat {
+		return false
+	}
+	shown[commit.Hash] = true
+	for _, person := range []struct {
+		role string
+		sig  gitobj.Signature
+	}{{"author", commit.Author}, {"committer", commit.Committer}} {
+		fmt.Fprintf(out, "%s %s\n%s-mail <%s>\n%s-time %d\n%s-tz %s\n", person.role, person.sig.Name,
+			person.role, person.sig.Email, person.role, person.sig.When.Unix(), person.role,
+			person.sig.When.Format("-0700"))
+	}
+	fmt.Fprintf(out, "summary %s\n", commit.Subject())
+	if len(commit.Parents) == 0 {
+		out.WriteString("boundary\n")
+	}
+	return true
+}
+
+func writeBlameFilename(out *bufio.Writer, origin *blame.Origin) {
+	if origin.Previous != nil {
+		fmt.Fprintf(out, "previous %s %s\n", origin.Previous.Commit.Hash, origin.Previous.Path)
+	}
+	fmt.Fprintf(out, "filename %s\n", origin.Path)
+}
+
+func writeBlamePorcelain(out *bufio.Writer, result *blame.Result, repeat bool) {
+	// Print the porcelain format: a header line for each line of the file,
+	// followed by the commit information the first time a commit shows up (or
+	// every time with `repeat`) and the line itself after a tab.
+	paths := make(map[string]map[string]bool)
+	for _, entry := range result.Entries {
+		hash := entry.Origin.Commit.Hash
+		if paths[hash] == nil {
+			paths[hash] = make(map[string]bool)
+		}
+		paths[hash][entry.Origin.Path] = true
+	}
+
+	shown := make(map[string]bool)
+	for _, entry := range result.Entries {
+		origin := entry.Origin
+		hash := origin.Commit.Hash
+		for i := 0; i < entry.NumLines; i++ {
+			if i == 0 {
+				fmt.Fprintf(out, "%s %d %d %d\n", hash, entry.OrigLine+1, entry.FinalLine+1, entry.NumLines)
+			} else {
+				fmt.Fprintf(out, "%s %d %d\n", hash, entry.OrigLine+i+1, entry.FinalLine+i+1)
+			}
+			if i == 0 || repeat {
+				if writeBlameDetails(out, origin, shown, repeat) || len(paths[hash]) > 1 {
+					writeBlameFilename(out, origin)
+				}
+			}
+			fmt.Fprintf(out, "\t%s", withNewline(result.Lines[entry.FinalLine+i]))
+		}
+	}
+}
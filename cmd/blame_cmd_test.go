@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tsoud/GoTGit.git/blame"
+	"github.com/tsoud/GoTGit.git/gitobj"
+)
+
+func TestWriteBlameWidths(t *testing.T) {
+	when := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	commit := &gitobj.Commit{
+		Hash:    strings.Repeat("ab", 20),
+		Parents: []string{strings.Repeat("cd", 20)},
+		Author:  gitobj.Signature{Name: "Al", When: when},
+	}
+	other := &gitobj.Commit{
+		Hash:    strings.Repeat("ef", 20),
+		Parents: []string{strings.Repeat("cd", 20)},
+		Author:  gitobj.Signature{Name: "Bea Longname", When: when},
+	}
+	var lines []string
+	for i := 1; i <= 12; i++ {
+		lines = append(lines, fmt.Sprintf("line %d\n", i))
+	}
+
+	tests := []struct {
+		name    string
+		entries []*blame.Entry
+		want    string
+	}{
+		{
+			// The file has 12 lines, but the ones shown all have one digit.
+			name: "range below ten",
+			entries: []*blame.Entry{
+				{Origin: &blame.Origin{Commit: commit, Path: "f"}, FinalLine: 6, NumLines: 3},
+			},
+			want: "abababab (Al 2024-01-02 03:04:05 +0000 7) line 7\n" +
+				"abababab (Al 2024-01-02 03:04:05 +0000 8) line 8\n" +
+				"abababab (Al 2024-01-02 03:04:05 +0000 9) line 9\n",
+		},
+		{
+			name: "range across ten",
+			entries: []*blame.Entry{
+				{Origin: &blame.Origin{Commit: commit, Path: "f"}, FinalLine: 8, NumLines: 1},
+				{Origin: &blame.Origin{Commit: other, Path: "f"}, FinalLine: 9, NumLines: 1},
+			},
+			want: "abababab (Al           2024-01-02 03:04:05 +0000  9) line 9\n" +
+				"efefefef (Bea Longname 2024-01-02 03:04:05 +0000 10) line 10\n",
+		},
+		{
+			name: "lines from another file",
+			entries: []*blame.Entry{
+				{Origin: &blame.Origin{Commit: commit, Path: "f"}, FinalLine: 0, NumLines: 1},
+				{Origin: &blame.Origin{Commit: commit, Path: "old/f"}, FinalLine: 1, NumLines: 1},
+			},
+			want: "abababab f     (Al 2024-01-02 03:04:05 +0000 1) line 1\n" +
+				"abababab old/f (Al 2024-01-02 03:04:05 +0000 2) line 2\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var got strings.Builder
+			out := bufio.NewWriter(&got)
+			writeBlame(out, &blame.Result{Lines: lines, Entries: test.entries}, "f", false)
+			out.Flush()
+			if got.String() != test.want {
+				t.Errorf("Wanted\n%s\ngot\n%s", test.want, got.String())
+			}
+		})
+	}
+}
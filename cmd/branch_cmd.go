@@ -0,0 +1,604 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/tsoud/GoTGit.git/config"
+	"github.com/tsoud/GoTGit.git/gitobj"
+	"github.com/tsoud/GoTGit.git/refs"
+)
+
+const BranchUsageMsg = "usage: branch [-v | -vv] [-a | -r] [--merged[=<commit>]] [--no-merged[=<commit>]]\n" +
+	"              [--contains[=<commit>]] [-l] [<pattern>...]\n" +
+	"   or: branch [-f] <branch-name> [<start-point>]\n" +
+	"   or: branch (-m | -M) [<old-branch>] <new-branch>\n" +
+	"   or: branch (-d | -D) <branch-name>...\n" +
+	"   or: branch (-u <upstream> | --set-upstream-to=<upstream>) [<branch-name>]\n" +
+	"   or: branch --unset-upstream [<branch-name>]\n" +
+	"   or: branch --show-current\n"
+
+type BranchOptions struct {
+	verbose       counter
+	all           bool
+	remotes       bool
+	list          bool
+	merged        optionalValue
+	noMerged      optionalValue
+	contains      optionalValue
+	delete        bool
+	forceDelete   bool
+	move          bool
+	forceMove     bool
+	force         bool
+	setUpstream   string
+	unsetUpstream bool
+	showCurrent   bool
+	quiet         bool
+}
+
+func SetupBranchCmd() (*flag.FlagSet, *BranchOptions) {
+	branchCmd := flag.NewFlagSet("branch", flag.ExitOnError)
+	opts := &BranchOptions{}
+
+	branchCmd.Var(&opts.verbose, "v", "Show the hash and subject of each branch's tip "+
+		"(twice to also show its upstream).")
+	branchCmd.Var(&opts.verbose, "verbose", "Same as `-v`.")
+	branchCmd.Var(doubleCounter{&opts.verbose}, "vv", "Same as `-v -v`.")
+	branchCmd.BoolVar(&opts.all, "a", false, "List both local and remote-tracking branches.")
+	branchCmd.BoolVar(&opts.all, "all", false, "Same as `-a`.")
+	branchCmd.BoolVar(&opts.remotes, "r", false, "List only remote-tracking branches.")
+	branchCmd.BoolVar(&opts.remotes, "remotes", false, "Same as `-r`.")
+	branchCmd.BoolVar(&opts.list, "l", false, "List branches, optionally only those matching <pattern>.")
+	branchCmd.BoolVar(&opts.list, "list", false, "Same as `-l`.")
+	branchCmd.Var(&opts.merged, "merged", "Only list branches whose tips are reachable from <commit> (default HEAD).")
+	branchCmd.Var(&opts.noMerged, "no-merged",
+		"Only list branches whose tips are not reachable from <commit> (default HEAD).")
+	branchCmd.Var(&opts.contains, "contains", "Only list branches which contain <commit> (default HEAD).")
+	branchCmd.BoolVar(&opts.delete, "d", false, "Delete a branch. It must be fully merged.")
+	branchCmd.BoolVar(&opts.delete, "delete", false, "Same as `-d`.")
+	branchCmd.BoolVar(&opts.forceDelete, "D", false, "Delete a branch even if it is not fully merged.")
+	branchCmd.BoolVar(&opts.move, "m", false, "Rename a branch and its reflog.")
+	branchCmd.BoolVar(&opts.move, "move", false, "Same as `-m`.")
+	branchCmd.BoolVar(&opts.forceMove, "M", false, "Rename a branch even if the new name already exists.")
+	branchCmd.BoolVar(&opts.force, "f", false, "Reset <branch-name> to <start-point> even if it exists.")
+	branchCmd.BoolVar(&opts.force, "force", false, "Same as `-f`.")
+	branchCmd.StringVar(&opts.setUpstream, "u", "", "Set up <branch-name> to track <upstream>.")
+	branchCmd.StringVar(&opts.setUpstream, "set-upstream-to", "", "Same as `-u`.")
+	branchCmd.BoolVar(&opts.unsetUpstream, "unset-upstream", false, "Remove the upstream of <branch-name>.")
+	branchCmd.BoolVar(&opts.showCurrent, "show-current", false, "Print the name of the current branch.")
+	branchCmd.BoolVar(&opts.quiet, "q", false, "Suppress non-error messages.")
+	branchCmd.BoolVar(&opts.quiet, "quiet", false, "Same as `-q`.")
+
+	return branchCmd, opts
+}
+
+func BranchCmdHandler(args []string, opts *BranchOptions) error {
+	switch {
+	case opts.showCurrent:
+		current, err := refs.CurrentBranch()
+		if err != nil {
+			return err
+		}
+		if current != "" {
+			fmt.Println(refs.ShortName(current))
+		}
+		return nil
+	case opts.delete || opts.forceDelete:
+		if len(args) == 0 {
+			return fmt.Errorf("branch name required")
+		}
+		return deleteBranches(args, opts)
+	case opts.move || opts.forceMove:
+		return renameBranch(args, opts.forceMove)
+	case opts.setUpstream != "":
+		return setUpstream(opts.setUpstream, args, opts.quiet)
+	case opts.unsetUpstream:
+		return unsetUpstream(args)
+	case len(args) == 0 || opts.list || opts.verbose > 0 || opts.all || opts.remotes ||
+		opts.merged.set || opts.noMerged.set || opts.contains.set:
+		return listBranches(args, opts)
+	case len(args) <= 2:
+		return createBranch(args, opts.force, opts.quiet)
+	default:
+		return fmt.Errorf("too many arguments\n%s", BranchUsageMsg)
+	}
+}
+
+func currentBranchName() (string, error) {
+	// Return the short name of the current branch, or an error if HEAD is detached.
+	current, err := refs.CurrentBranch()
+	if err != nil {
+		return "", err
+	}
+	if current == "" {
+		return "", fmt.Errorf("HEAD is detached; specify a branch name")
+	}
+	return refs.ShortName(current), nil
+}
+
+func createBranch(args []string, force, quiet bool) error {
+	name, startPoint := args[0], "HEAD"
+	if len(args) > 1 {
+		startPoint = args[1]
+	}
+	if err := refs.ValidateName("refs/heads/" + name); err != nil {
+		return fmt.Errorf("'%s' is not a valid branch name", name)
+	}
+
+	fullName := "refs/heads/" + name
+	exists := refs.Exists(fullName)
+	if exists && !force {
+		return fmt.Errorf("a branch named '%s' already exists", name)
+	}
+	if current, _ := refs.CurrentBranch(); exists && current == fullName {
+		return fmt.Errorf("cannot force update the current branch '%s'", name)
+	}
+
+	commitHash, err := refs.ResolveCommit(startPoint)
+	if err != nil {
+		return fmt.Errorf("not a valid object name: '%s'", startPoint)
+	}
+
+	message := "branch: Created from " + startPoint
+	if exists {
+		message = "branch: Reset to " + startPoint
+	}
+	if err := refs.Update(fullName, commitHash, message); err != nil {
+		return err
+	}
+
+	if upstream, ok := refs.Expand(startPoint); ok && strings.HasPrefix(upstream, "refs/remotes/") {
+		return trackUpstream(name, upstream, quiet)
+	}
+	return nil
+}
+
+func deleteBranches(names []string, opts *BranchOptions) error {
+	current, err := refs.CurrentBranch()
+	if err != nil {
+		return err
+	}
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+
+	var failed []string
+	for _, name := range names {
+		fullName := "refs/heads/" + name
+		if opts.remotes {
+			fullName = "refs/remotes/" + name
+		}
+
+		hash, err := refs.Resolve(fullName)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: branch '%s' not found\n", name)
+			failed = append(failed, name)
+			continue
+		}
+		if fullName == current {
+			fmt.Fprintf(os.Stderr, "error: cannot delete branch '%s' checked out at '%s'\n", name, workDir())
+			failed = append(failed, name)
+			continue
+		}
+
+		if !opts.forceDelete && !opts.remotes {
+			merged, err := isBranchMerged(cfg, name, hash)
+			if err != nil {
+				return err
+			}
+			if !merged {
+				fmt.Fprintf(os.Stderr, "error: the branch '%s' is not fully merged\n"+
+					"hint: If you are sure you want to delete it, run 'gotgit branch -D %s'\n", name, name)
+				failed = append(failed, name)
+				continue
+			}
+		}
+
+		if err := refs.Delete(fullName); err != nil {
+			return err
+		}
+		if !opts.remotes {
+			if err := cfg.RemoveSection("branch." + name); err != nil {
+				return err
+			}
+		}
+		if !opts.quiet {
+			kind := "branch"
+			if opts.remotes {
+				kind = "remote-tracking branch"
+			}
+			fmt.Printf("Deleted %s %s (was %s).\n", kind, name, hash[:7])
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("could not delete: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+func workDir() string {
+	wd, _ := os.Getwd()
+	return wd
+}
+
+func isBranchMerged(cfg *config.Config, name, hash string) (bool, error) {
+	// A branch can be safely deleted once it is merged into its upstream or, when
+	// it has none, into HEAD.
+	target := "HEAD"
+	if upstream := upstreamRef(cfg, name); upstream != "" && refs.Exists(upstream) {
+		target = upstream
+	}
+	targetHash, err := refs.ResolveCommit(target)
+	if err != nil {
+		// Nothing is checked out yet, so nothing could have been merged.
+		return false, nil
+	}
+	return gitobj.IsAncestor(hash, targetHash)
+}
+
+func renameBranch(args []string, force bool) error {
+	var oldName, newName string
+	switch len(args) {
+	case 1:
+		current, err := currentBranchName()
+		if err != nil {
+			return err
+		}
+		oldName, newName = current, args[0]
+	case 2:
+		oldName, newName = args[0], args[1]
+	default:
+		return fmt.Errorf("branch name required\n%s", BranchUsageMsg)
+	}
+
+	oldRef, newRef := "refs/heads/"+oldName, "refs/heads/"+newName
+	if err := refs.ValidateName(newRef); err != nil {
+		return fmt.Errorf("'%s' is not a valid branch name", newName)
+	}
+	current, err := refs.CurrentBranch()
+	if err != nil {
+		return err
+	}
+
+	if !refs.Exists(oldRef) {
+		if current != oldRef {
+			return fmt.Errorf("no branch named '%s'", oldName)
+		}
+		// Renaming an unborn branch only moves HEAD.
+		return refs.SetSymbolic(refs.HEAD, newRef, "")
+	}
+	if refs.Exists(newRef) && oldRef != newRef {
+		if !force {
+			return fmt.Errorf("a branch named '%s' already exists", newName)
+		}
+		if current == newRef {
+			return fmt.Errorf("cannot force update the current branch '%s'", newName)
+		}
+		if err := refs.Delete(newRef); err != nil {
+			return err
+		}
+	}
+
+	message := fmt.Sprintf("Branch: renamed %s to %s", oldRef, newRef)
+	if err := refs.Rename(oldRef, newRef, message); err != nil {
+		return err
+	}
+	if current == oldRef {
+		if err := refs.SetSymbolic(refs.HEAD, newRef, message); err != nil {
+			return err
+		}
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	return cfg.RenameSection("branch."+oldName, "branch."+newName)
+}
+
+func upstreamRef(cfg *config.Config, branch string) string {
+	// Return the full name of the ref a branch tracks, or "" if it has no upstream.
+	remote, hasRemote := cfg.Get("branch." + branch + ".remote")
+	mergeRef, hasMerge := cfg.Get("branch." + branch + ".merge")
+	if !hasRemote || !hasMerge {
+		return ""
+	}
+	if remote == "." {
+		return mergeRef
+	}
+	return path.Join("refs/remotes", remote, strings.TrimPrefix(mergeRef, "refs/heads/"))
+}
+
+func trackUpstream(branch, upstream string, quiet bool) error {
+	// Record `upstream` (a full ref name) as the upstream of `branch` in the config.
+	remote, mergeRef := ".", upstream
+	if tracking, found := strings.CutPrefix(upstream, "refs/remotes/"); found {
+		var name string
+		remote, name, _ = strings.Cut(tracking, "/")
+		mergeRef = "refs/heads/" + name
+	} else if !strings.HasPrefix(upstream, "refs/heads/") {
+		return fmt.Errorf("cannot set up tracking information; starting point '%s' is not a branch",
+			refs.ShortName(upstream))
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	if err := cfg.Set("branch."+branch+".remote", remote); err != nil {
+		return err
+	}
+	if err := cfg.Set("branch."+branch+".merge", mergeRef); err != nil {
+		return err
+	}
+
+	if !quiet {
+		fmt.Printf("branch '%s' set up to track '%s'.\n", branch, refs.ShortName(upstream))
+	}
+	return nil
+}
+
+func setUpstream(upstream string, args []string, quiet bool) error {
+	branch := ""
+	switch len(args) {
+	case 0:
+		current, err := currentBranchName()
+		if err != nil {
+			return err
+		}
+		branch = current
+	case 1:
+		branch = args[0]
+	default:
+		return fmt.Errorf("too many arguments to set new upstream")
+	}
+	if !refs.Exists("refs/heads/" + branch) {
+		return fmt.Errorf("branch '%s' does not exist", branch)
+	}
+
+	fullName, ok := refs.Expand(upstream)
+	if !ok {
+		return fmt.Errorf("the requested upstream branch '%s' does not exist", upstream)
+	}
+	return trackUpstream(branch, fullName, quiet)
+}
+
+func unsetUpstream(args []string) error {
+	branch := ""
+	if len(args) > 0 {
+		branch = args[0]
+	} else {
+		current, err := currentBranchName()
+		if err != nil {
+			return err
+		}
+		branch = current
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	if _, ok := cfg.Get("branch." + branch + ".merge"); !ok {
+		return fmt.Errorf("branch '%s' has no upstream information", branch)
+	}
+	if err := cfg.Unset("branch." + branch + ".remote"); err != nil {
+		return err
+	}
+	return cfg.Unset("branch." + branch + ".merge")
+}
+
+func filterCommit(flagValue optionalValue) (map[string]bool, error) {
+	// Resolve the commit given to `--merged`, `--no-merged` or `--contains` and
+	// collect its ancestors.
+	rev := flagValue.value
+	if rev == "" {
+		rev = "HEAD"
+	}
+	hash, err := refs.ResolveCommit(rev)
+	if err != nil {
+		return nil, fmt.Errorf("malformed object name %s", rev)
+	}
+	return gitobj.Ancestors(hash)
+}
+
+func trackingInfo(cfg *config.Config, branch, hash string, verbose counter) (string, error) {
+	// Describe how a branch relates to its upstream, e.g. "[origin/main: ahead 2]".
+	upstream := upstreamRef(cfg, branch)
+	if upstream == "" {
+		return "", nil
+	}
+	name := refs.ShortName(upstream)
+	upstreamHash, err := refs.Resolve(upstream)
+	if err != nil {
+		if verbose > 1 {
+			return fmt.Sprintf("[%s: gone] ", name), nil
+		}
+		return "[gone] ", nil
+	}
+
+	ours, err := gitobj.Ancestors(hash)
+	if err != nil {
+		return "", err
+	}
+	theirs, err := gitobj.Ancestors(upstreamHash)
+	if err != nil {
+		return "", err
+	}
+	ahead, behind := 0, 0
+	for commit := range ours {
+		if !theirs[commit] {
+			ahead++
+		}
+	}
+	for commit := range theirs {
+		if !ours[commit] {
+			behind++
+		}
+	}
+
+	var counts []string
+	if ahead > 0 {
+		counts = append(counts, fmt.Sprintf("ahead %d", ahead))
+	}
+	if behind > 0 {
+		counts = append(counts, fmt.Sprintf("behind %d", behind))
+	}
+	switch {
+	case verbose > 1 && len(counts) > 0:
+		return fmt.Sprintf("[%s: %s] ", name, strings.Join(counts, ", ")), nil
+	case verbose > 1:
+		return fmt.Sprintf("[%s] ", name), nil
+	case len(counts) > 0:
+		return fmt.Sprintf("[%s] ", strings.Join(counts, ", ")), nil
+	}
+	return "", nil
+}
+
+func matchesPatterns(name string, patterns []string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+type branchLine struct {
+	name    string
+	display string
+	hash    string
+	current bool
+	local   bool
+}
+
+func listBranches(patterns []string, opts *BranchOptions) error {
+	current, err := refs.CurrentBranch()
+	if err != nil {
+		return err
+	}
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+
+	var lines []branchLine
+	if current == "" && !opts.remotes {
+		if headHash, err := refs.Resolve(refs.HEAD); err == nil {
+			lines = append(lines, branchLine{
+				display: fmt.Sprintf("(HEAD detached at %s)", headHash[:7]), hash: headHash, current: true,
+			})
+		}
+	}
+
+	var prefixes []string
+	if !opts.remotes {
+		prefixes = append(prefixes, "refs/heads/")
+	}
+	if opts.all || opts.remotes {
+		prefixes = append(prefixes, "refs/remotes/")
+	}
+	for _, prefix := range prefixes {
+		branches, err := refs.List(prefix)
+		if err != nil {
+			return err
+		}
+		for _, branch := range branches {
+			name := refs.ShortName(branch.Name)
+			if !matchesPatterns(name, patterns) || strings.HasSuffix(branch.Name, "/HEAD") {
+				continue
+			}
+			display := name
+			if prefix == "refs/remotes/" && opts.all {
+				display = "remotes/" + name
+			}
+			lines = append(lines, branchLine{
+				name: name, display: display, hash: branch.Hash,
+				current: branch.Name == current, local: prefix == "refs/heads/",
+			})
+		}
+	}
+
+	var merged, notMerged, containing map[string]bool
+	if opts.merged.set {
+		if merged, err = filterCommit(opts.merged); err != nil {
+			return err
+		}
+	}
+	if opts.noMerged.set {
+		if notMerged, err = filterCommit(opts.noMerged); err != nil {
+			return err
+		}
+	}
+	if opts.contains.set {
+		rev := opts.contains.value
+		if rev == "" {
+			rev = "HEAD"
+		}
+		containsHash, err := refs.ResolveCommit(rev)
+		if err != nil {
+			return fmt.Errorf("malformed object name %s", rev)
+		}
+		containing = map[string]bool{containsHash: true}
+	}
+
+	width := 0
+	var shown []branchLine
+	for _, line := range lines {
+		if merged != nil && !merged[line.hash] {
+			continue
+		}
+		if notMerged != nil && notMerged[line.hash] {
+			continue
+		}
+		if containing != nil {
+			var containsHash string
+			for hash := range containing {
+				containsHash = hash
+			}
+			contains, err := gitobj.IsAncestor(containsHash, line.hash)
+			if err != nil {
+				return err
+			}
+			if !contains {
+				continue
+			}
+		}
+		shown = append(shown, line)
+		width = max(width, len(line.display))
+	}
+
+	for _, line := range shown {
+		marker := "  "
+		if line.current {
+			marker = "* "
+		}
+		if opts.verbose == 0 {
+			fmt.Printf("%s%s\n", marker, line.display)
+			continue
+		}
+
+		commit, err := gitobj.ReadCommit(line.hash)
+		if err != nil {
+			return err
+		}
+		tracking := ""
+		if line.local {
+			if tracking, err = trackingInfo(cfg, line.name, line.hash, opts.verbose); err != nil {
+				return err
+			}
+		}
+		fmt.Printf("%s%-*s %s %s%s\n", marker, width, line.display, line.hash[:7], tracking, commit.Subject())
+	}
+
+	return nil
+}
@@ -3,74 +3,101 @@ package cmd
 import (
 	"flag"
 	"fmt"
-	"log"
+	"io"
 	"os"
 
 	"github.com/tsoud/GoTGit.git/gitobj"
+	"github.com/tsoud/GoTGit.git/refs"
 )
 
-const CatFileUsageMsg = "usage: cat-file (-p | -t | -s) <object>\n"
+const CatFileUsageMsg = "usage: cat-file [--json] (-p | -t | -s) <object>\n"
 
-func SetupCatFileCmd() *flag.FlagSet {
+type CatFileOptions struct {
+	pprint  bool
+	getType bool
+	getSize bool
+	json    bool
+}
+
+func SetupCatFileCmd() (*flag.FlagSet, *CatFileOptions) {
 	catFileCmd := flag.NewFlagSet("cat-file", flag.ExitOnError)
+	opts := &CatFileOptions{}
 
-	var pprint bool
-	catFileCmd.BoolVar(&pprint, "p", false, "Pretty-print the contents of <object>.")
-	var getType bool
-	catFileCmd.BoolVar(&getType, "t", false, "Show object type identified by <object>.")
-	var getSize bool
-	catFileCmd.BoolVar(&getSize, "s", false, "Show the object size identified by <object>.")
+	catFileCmd.BoolVar(&opts.pprint, "p", false, "Pretty-print the contents of <object>.")
+	catFileCmd.BoolVar(&opts.getType, "t", false, "Show object type identified by <object>.")
+	catFileCmd.BoolVar(&opts.getSize, "s", false, "Show the object size identified by <object>.")
+	catFileCmd.BoolVar(&opts.json, "json", false, "Print the result as a JSON object. With `-p`, "+
+		"include the parsed contents of <object>.")
 
-	return catFileCmd
+	return catFileCmd, opts
 }
 
-func validateCatFileFlags(fs *flag.FlagSet) error {
-	if fs.NFlag() == 0 {
-		return fmt.Errorf("missing required flag: `-p`, `-s`, or `-t`.\n%s", CatFileUsageMsg)
+func (opts *CatFileOptions) outType() (string, error) {
+	// Return the one output mode that was asked for: "s", "t" or "p".
+	var modes []string
+	for mode, set := range map[string]bool{"s": opts.getSize, "t": opts.getType, "p": opts.pprint} {
+		if set {
+			modes = append(modes, mode)
+		}
 	}
-	if fs.NFlag() > 1 {
-		return fmt.Errorf(
+	if len(modes) == 0 {
+		return "", fmt.Errorf("missing required flag: `-p`, `-s`, or `-t`.\n%s", CatFileUsageMsg)
+	}
+	if len(modes) > 1 {
+		return "", fmt.Errorf(
 			"`cat-file` takes only one flag: `-p`, `-s`, or `-t`.\n%s", CatFileUsageMsg)
 	}
-
-	return nil
+	return modes[0], nil
 }
 
-func catFileOption(fs *flag.FlagSet) string {
-	// Return a valid option for formatting output from the `cat-file` command.
-	for _, flag := range []string{"s", "t", "p"} {
-		if fs.Lookup(flag).Value.String() == "true" {
-			return flag
-		}
+func catFileJSON(out io.Writer, objInfo *gitobj.GitObject, outType string) error {
+	switch outType {
+	case "t":
+		return writeJSON(out, map[string]any{"hash": objInfo.Hash, "type": objInfo.Type})
+	case "s":
+		return writeJSON(out, map[string]any{"hash": objInfo.Hash, "size": objInfo.Size})
 	}
-
-	return ""
+	fields, err := objectJSON(objInfo)
+	if err != nil {
+		return err
+	}
+	return writeJSON(out, fields)
 }
 
-func catFile(objHash, outType string) {
+func catFile(out io.Writer, object, outType string, asJSON bool) error {
+	objHash, err := refs.ResolveRevision(object)
+	if err != nil {
+		return err
+	}
 	objInfo, err := gitobj.ReadGitObj(objHash)
 	if err != nil {
-		log.Fatalf("error reading object %s: %s", objHash, err)
+		return err
+	}
+
+	if asJSON {
+		return catFileJSON(out, objInfo, outType)
 	}
 
 	switch outType {
 	case "t":
-		fmt.Printf("%s\n", objInfo.Type)
+		fmt.Fprintf(out, "%s\n", objInfo.Type)
 	case "s":
-		fmt.Printf("%d\n", objInfo.Size)
+		fmt.Fprintf(out, "%d\n", objInfo.Size)
 	case "p":
-		if err := gitobj.PrintBlob(objInfo); err != nil {
-			log.Fatal(err)
+		// Trees are binary, so list their entries instead. `show` renders
+		// commits, tags and trees in a more readable form.
+		if objInfo.Type == "tree" {
+			return gitobj.PrintTree(out, objInfo, "default")
 		}
+		return gitobj.PrintBlob(out, objInfo)
 	}
+	return nil
 }
 
-func CatFileCmdHandler(objHash string, fs *flag.FlagSet) {
-	fs.Parse(os.Args[2:])
-	if err := validateCatFileFlags(fs); err != nil {
-		log.Fatal(err)
+func CatFileCmdHandler(object string, opts *CatFileOptions) error {
+	outType, err := opts.outType()
+	if err != nil {
+		return err
 	}
-
-	outType := catFileOption(fs)
-	catFile(objHash, outType)
+	return catFile(os.Stdout, object, outType, opts.json)
 }
@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/tsoud/GoTGit.git/internal/testutil"
+)
+
+func TestCatFile(t *testing.T) {
+	testutil.InitRepo(t)
+	blob := testutil.WriteObject(t, "blob", "hello\n")
+	binary := testutil.WriteObject(t, "blob", "\xff\x00\x01")
+	tree := testutil.WriteTree(t, map[string]string{"hello.txt": "hello\n"})
+	commitBody := "tree " + tree + "\n" +
+		"author A U Thor <author@example.com> 1700000000 +0100\n" +
+		"committer C O Mitter <committer@example.com> 1700000060 +0000\n\nfirst\n"
+	commit := testutil.WriteObject(t, "commit", commitBody)
+	tagBody := "object " + commit + "\ntype commit\ntag v1\n" +
+		"tagger T Agger <tagger@example.com> 1700000120 -0230\n\nrelease\n"
+	tag := testutil.WriteObject(t, "tag", tagBody)
+
+	tests := []struct {
+		args []string
+		want string
+		err  string
+	}{
+		{args: []string{"-t", blob}, want: "blob\n"},
+		{args: []string{"-s", blob}, want: "6\n"},
+		{args: []string{"-p", blob}, want: "hello\n"},
+		{args: []string{"-p", tree}, want: "100644 blob " + blob + "\thello.txt\n"},
+		{args: []string{"-t", tree + ":hello.txt"}, want: "blob\n"},
+		{args: []string{blob}, err: "missing required flag"},
+		{args: []string{"-t", "-s", blob}, err: "`cat-file` takes only one flag"},
+
+		// JSON output.
+		{args: []string{"--json", "-t", blob}, want: `{"hash":"` + blob + `","type":"blob"}` + "\n"},
+		{args: []string{"--json", "-s", tree}, want: `{"hash":"` + tree + `","size":` + "37" + `}` + "\n"},
+		{args: []string{"--json", "-p", blob},
+			want: `{"content":"hello\n","hash":"` + blob + `","size":6,"type":"blob"}` + "\n"},
+		{args: []string{"--json", "-p", binary},
+			want: `{"content_base64":"/wAB","hash":"` + binary + `","size":3,"type":"blob"}` + "\n"},
+		{args: []string{"--json", "-p", tree},
+			want: `{"entries":[{"mode":"100644","type":"blob","hash":"` + blob + `","name":"hello.txt"}],` +
+				`"hash":"` + tree + `","size":37,"type":"tree"}` + "\n"},
+		{args: []string{"--json", "-p", commit},
+			want: `{"author":{"name":"A U Thor","email":"author@example.com","date":"2023-11-14T23:13:20+01:00"},` +
+				`"committer":{"name":"C O Mitter","email":"committer@example.com","date":"2023-11-14T22:14:20Z"},` +
+				`"hash":"` + commit + `","message":"first\n","parents":[],` +
+				`"size":` + strconv.Itoa(len(commitBody)) + `,"tree":"` + tree + `","type":"commit"}` + "\n"},
+		{args: []string{"--json", "-p", tag},
+			want: `{"hash":"` + tag + `","message":"release\n","object":"` + commit + `","object_type":"commit",` +
+				`"size":` + strconv.Itoa(len(tagBody)) + `,"tag":"v1",` +
+				`"tagger":{"name":"T Agger","email":"tagger@example.com",` +
+				`"date":"2023-11-14T19:45:20-02:30"},"type":"tag"}` + "\n"},
+	}
+	for _, test := range tests {
+		t.Run(strings.Join(test.args, " "), func(t *testing.T) {
+			fs, opts := SetupCatFileCmd()
+			parsed, err := parseFlags(fs, test.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var out strings.Builder
+			outType, err := opts.outType()
+			if err == nil {
+				err = catFile(&out, parsed.args[0], outType, opts.json)
+			}
+			if test.err != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), test.err) {
+					t.Errorf("Wanted the error %q, got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != test.want {
+				t.Errorf("Wanted\n%s\ngot\n%s", test.want, out.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,350 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/tsoud/GoTGit.git/gitobj"
+	"github.com/tsoud/GoTGit.git/hooks"
+	"github.com/tsoud/GoTGit.git/index"
+	"github.com/tsoud/GoTGit.git/merge"
+	"github.com/tsoud/GoTGit.git/refs"
+	"github.com/tsoud/GoTGit.git/worktree"
+)
+
+const CheckoutUsageMsg = "usage: checkout [<options>] <branch>\n" +
+	"   or: checkout [<options>] [--detach] <commit>\n" +
+	"   or: checkout [<options>] (-b|-B|--orphan) <new-branch> [<start-point>]\n" +
+	"   or: checkout [<options>] [<tree-ish>] [--] <pathspec>...\n"
+
+type CheckoutOptions struct {
+	newBranch   string
+	resetBranch string
+	detach      bool
+	force       bool
+	merge       bool
+	orphan      string
+	ours        bool
+	theirs      bool
+	quiet       bool
+}
+
+func SetupCheckoutCmd() (*flag.FlagSet, *CheckoutOptions) {
+	checkoutCmd := flag.NewFlagSet("checkout", flag.ExitOnError)
+	opts := &CheckoutOptions{}
+
+	checkoutCmd.StringVar(&opts.newBranch, "b", "", "Create a new branch <new-branch> and check it out.")
+	checkoutCmd.StringVar(&opts.resetBranch, "B", "", "Like `-b`, but reset <new-branch> if it already exists.")
+	checkoutCmd.BoolVar(&opts.detach, "detach", false, "Check out a commit with a detached HEAD.")
+	checkoutCmd.BoolVar(&opts.force, "f", false, "Throw away local changes and ignore unmerged entries.")
+	checkoutCmd.BoolVar(&opts.force, "force", false, "Same as `-f`.")
+	checkoutCmd.BoolVar(&opts.merge, "m", false, "Carry local changes over with a three-way merge, "+
+		"or recreate the conflicts of unmerged paths.")
+	checkoutCmd.BoolVar(&opts.merge, "merge", false, "Same as `-m`.")
+	checkoutCmd.StringVar(&opts.orphan, "orphan", "",
+		"Create a new unborn branch, keeping the index and working tree.")
+	checkoutCmd.BoolVar(&opts.ours, "ours", false, "Check out stage #2 (ours) of unmerged paths.")
+	checkoutCmd.BoolVar(&opts.theirs, "theirs", false, "Check out stage #3 (theirs) of unmerged paths.")
+	checkoutCmd.BoolVar(&opts.quiet, "q", false, "Suppress feedback messages.")
+	checkoutCmd.BoolVar(&opts.quiet, "quiet", false, "Same as `-q`.")
+
+	return checkoutCmd, opts
+}
+
+func CheckoutCmdHandler(args, pathspecs []string, hasSeparator bool, opts *CheckoutOptions) error {
+	// Without `--`, the first argument is a revision if it resolves to one and
+	// the remaining arguments are paths.
+	if !hasSeparator && len(args) > 0 && opts.newBranch == "" && opts.resetBranch == "" && opts.orphan == "" {
+		if _, err := refs.ResolveRevision(args[0]); err != nil && args[0] != "-" {
+			args, pathspecs = nil, args
+		} else if len(args) > 1 {
+			args, pathspecs = args[:1], args[1:]
+		}
+	}
+	pathspecs = prefixPaths(pathspecs)
+	if len(pathspecs) > 0 || hasSeparator {
+		if opts.newBranch != "" || opts.resetBranch != "" || opts.orphan != "" || opts.detach {
+			return fmt.Errorf("cannot update paths and switch to a branch at the same time")
+		}
+		if len(args) > 1 {
+			return fmt.Errorf("only one <tree-ish> may be given\n%s", CheckoutUsageMsg)
+		}
+		if len(pathspecs) == 0 {
+			return fmt.Errorf("you must specify path(s) to restore")
+		}
+		var err error
+		if len(args) == 1 {
+			err = checkoutPathsFromTree(args[0], pathspecs, opts)
+		} else {
+			err = checkoutPathsFromIndex(pathspecs, opts)
+		}
+		if err != nil {
+			return err
+		}
+		// The post-checkout hook also runs after checking out files, with HEAD
+		// unchanged.
+		head := mustResolveHead()
+		hooks.PostCheckout(head, head, false)
+		return nil
+	}
+	if opts.ours || opts.theirs {
+		return fmt.Errorf("'--ours/--theirs' cannot be used with switching branches")
+	}
+
+	var req *switchRequest
+	var err error
+	switch {
+	case opts.orphan != "":
+		if len(args) > 1 {
+			return fmt.Errorf("too many arguments\n%s", CheckoutUsageMsg)
+		}
+		fullName := "refs/heads/" + opts.orphan
+		if err := refs.ValidateName(fullName); err != nil {
+			return fmt.Errorf("'%s' is not a valid branch name", opts.orphan)
+		}
+		if refs.Exists(fullName) {
+			return fmt.Errorf("a branch named '%s' already exists", opts.orphan)
+		}
+		req = &switchRequest{target: opts.orphan, branch: fullName, create: true, orphan: true, keepTree: true}
+		if len(args) == 1 {
+			// The start point only seeds the index and working tree.
+			commitHash, err := refs.ResolveCommit(args[0])
+			if err != nil {
+				return fmt.Errorf("invalid reference: %s", args[0])
+			}
+			req.commit, req.keepTree = commitHash, false
+		}
+
+	case opts.newBranch != "" || opts.resetBranch != "":
+		if len(args) > 1 {
+			return fmt.Errorf("too many arguments\n%s", CheckoutUsageMsg)
+		}
+		name, reset := opts.newBranch, false
+		if opts.resetBranch != "" {
+			name, reset = opts.resetBranch, true
+		}
+		startPoint := ""
+		if len(args) == 1 {
+			startPoint = args[0]
+		}
+		if req, err = newBranchRequest(name, startPoint, reset); err != nil {
+			return err
+		}
+
+	default:
+		if len(args) > 1 {
+			return fmt.Errorf("too many arguments\n%s", CheckoutUsageMsg)
+		}
+		target := "HEAD"
+		if len(args) == 1 {
+			target = args[0]
+		}
+		if !opts.detach && target != "HEAD" {
+			if req, err = branchRequest(target, true); err != nil {
+				return err
+			}
+		}
+		if req == nil {
+			if target == "-" {
+				target = "@{-1}"
+			}
+			commitHash, err := refs.ResolveCommit(target)
+			if err != nil {
+				return fmt.Errorf("invalid reference: %s", target)
+			}
+			if len(args) == 0 && !opts.detach {
+				// `checkout` with nothing to switch to only reports local changes.
+				idx, err := index.Read()
+				if err != nil {
+					return err
+				}
+				return printLocalChanges(idx, commitHash)
+			}
+			req = &switchRequest{target: target, commit: commitHash, detachAdvice: !opts.detach}
+		}
+	}
+
+	req.force, req.merge, req.quiet = opts.force, opts.merge, opts.quiet
+	return switchHead(req)
+}
+
+func reportUpdatedPaths(count int, source string, quiet bool) {
+	if quiet {
+		return
+	}
+	noun := "paths"
+	if count == 1 {
+		noun = "path"
+	}
+	fmt.Fprintf(os.Stderr, "Updated %d %s from %s\n", count, noun, source)
+}
+
+func checkoutPathsFromTree(treeish string, pathspecs []string, opts *CheckoutOptions) error {
+	// Copy the matching files of `treeish` into both the index and the working tree.
+	if opts.ours || opts.theirs {
+		return fmt.Errorf("cannot use --ours or --theirs with a <tree-ish>")
+	}
+	hash, err := refs.ResolveRevision(treeish)
+	if err != nil {
+		return fmt.Errorf("invalid reference: %s", treeish)
+	}
+	treeHash, err := refs.Peel(hash, "tree")
+	if err != nil {
+		return err
+	}
+	files, err := gitobj.ReadTreeRecursive(treeHash)
+	if err != nil {
+		return err
+	}
+
+	idx, err := index.Read()
+	if err != nil {
+		return err
+	}
+	matched := make(map[string]bool)
+	var selected []gitobj.TreeEntry
+	for _, file := range files {
+		if !worktree.MatchPathspec(file.Name, pathspecs) {
+			continue
+		}
+		for _, spec := range pathspecs {
+			if worktree.MatchPathspec(file.Name, []string{spec}) {
+				matched[spec] = true
+			}
+		}
+		selected = append(selected, file)
+	}
+	if err := checkPathspecsMatched(pathspecs, matched); err != nil {
+		return err
+	}
+
+	for _, file := range selected {
+		if err := worktree.WriteFile(file.Name, file.Hash, file.Mode); err != nil {
+			return err
+		}
+		entry, err := worktree.NewEntry(file.Name, file.Hash, file.Mode)
+		if err != nil {
+			return err
+		}
+		idx.Add(entry)
+	}
+	if err := idx.Write(); err != nil {
+		return err
+	}
+
+	reportUpdatedPaths(len(selected), hash[:7], opts.quiet)
+	return nil
+}
+
+func checkPathspecsMatched(pathspecs []string, matched map[string]bool) error {
+	for _, spec := range pathspecs {
+		if !matched[spec] {
+			return fmt.Errorf("pathspec '%s' did not match any file(s) known to gotgit", spec)
+		}
+	}
+	return nil
+}
+
+func checkoutPathsFromIndex(pathspecs []string, opts *CheckoutOptions) error {
+	// Restore the matching working tree files from the index. Unmerged paths need
+	// `--ours`, `--theirs` or `-m` to pick what to write.
+	idx, err := index.Read()
+	if err != nil {
+		return err
+	}
+
+	matched := make(map[string]bool)
+	var paths []string
+	for _, entry := range idx.Entries {
+		if !worktree.MatchPathspec(entry.Path, pathspecs) {
+			continue
+		}
+		for _, spec := range pathspecs {
+			if worktree.MatchPathspec(entry.Path, []string{spec}) {
+				matched[spec] = true
+			}
+		}
+		if len(paths) == 0 || paths[len(paths)-1] != entry.Path {
+			paths = append(paths, entry.Path)
+		}
+	}
+	if err := checkPathspecsMatched(pathspecs, matched); err != nil {
+		return err
+	}
+
+	count := 0
+	for _, path := range paths {
+		if entry := idx.Find(path, 0); entry != nil {
+			if err := worktree.WriteFile(path, entry.Hash, entry.ModeString()); err != nil {
+				return err
+			}
+			if updated, err := worktree.NewEntry(path, entry.Hash, entry.ModeString()); err == nil {
+				idx.Add(updated)
+			}
+			count++
+			continue
+		}
+
+		switch {
+		case opts.ours || opts.theirs:
+			stage := 2
+			if opts.theirs {
+				stage = 3
+			}
+			entry := idx.Find(path, stage)
+			if entry == nil {
+				return fmt.Errorf("path '%s' does not have %s version", path, map[int]string{2: "our", 3: "their"}[stage])
+			}
+			if err := worktree.WriteFile(path, entry.Hash, entry.ModeString()); err != nil {
+				return err
+			}
+		case opts.merge:
+			if err := recreateConflict(idx, path); err != nil {
+				return err
+			}
+		case opts.force:
+			fmt.Fprintf(os.Stderr, "warning: path '%s' is unmerged\n", path)
+			continue
+		default:
+			return fmt.Errorf("path '%s' is unmerged", path)
+		}
+		count++
+	}
+	if err := idx.Write(); err != nil {
+		return err
+	}
+
+	reportUpdatedPaths(count, "the index", opts.quiet)
+	return nil
+}
+
+func recreateConflict(idx *index.Index, path string) error {
+	// Write the conflicted merge of an unmerged path's stages back to the working tree.
+	var contents [4][]byte
+	mode := "100644"
+	for _, entry := range idx.Stages(path) {
+		obj, err := gitobj.ReadGitObj(entry.Hash)
+		if err != nil {
+			return err
+		}
+		contents[entry.Stage] = obj.Content
+		if entry.Stage == 2 {
+			mode = entry.ModeString()
+		}
+	}
+	if contents[2] == nil || contents[3] == nil {
+		return fmt.Errorf("path '%s' does not have all necessary versions", path)
+	}
+
+	merged, _ := merge.MergeContent(contents[1], contents[2], contents[3],
+		&merge.ContentOptions{OursLabel: "ours", TheirsLabel: "theirs"})
+	permissions := os.FileMode(0644)
+	if mode == "100755" {
+		permissions = 0755
+	}
+	if err := os.WriteFile(path, merged, permissions); err != nil {
+		return fmt.Errorf("could not write %s: %w", path, err)
+	}
+	return nil
+}
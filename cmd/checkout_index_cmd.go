@@ -0,0 +1,232 @@
+package cmd
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/tsoud/GoTGit.git/gitobj"
+	"github.com/tsoud/GoTGit.git/index"
+	"github.com/tsoud/GoTGit.git/worktree"
+)
+
+const CheckoutIndexUsageMsg = "usage: checkout-index [-u] [-q] [-a] [-f] [--prefix=<string>]\n" +
+	"                      [--stage=<number>|all] [--temp] [--] [<file>...]\n"
+
+type CheckoutIndexOptions struct {
+	all         bool
+	force       bool
+	quiet       bool
+	updateStat  bool
+	prefix      string
+	temp        bool
+	stage       string
+	stageNumber int
+}
+
+func SetupCheckoutIndexCmd() (*flag.FlagSet, *CheckoutIndexOptions) {
+	checkoutIndexCmd := flag.NewFlagSet("checkout-index", flag.ExitOnError)
+	opts := &CheckoutIndexOptions{}
+
+	checkoutIndexCmd.BoolVar(&opts.all, "a", false, "Check out all files in the index.")
+	checkoutIndexCmd.BoolVar(&opts.all, "all", false, "Same as `-a`.")
+	checkoutIndexCmd.BoolVar(&opts.force, "f", false, "Overwrite existing files.")
+	checkoutIndexCmd.BoolVar(&opts.force, "force", false, "Same as `-f`.")
+	checkoutIndexCmd.BoolVar(&opts.quiet, "q", false, "Be quiet if files exist or are not in the index.")
+	checkoutIndexCmd.BoolVar(&opts.quiet, "quiet", false, "Same as `-q`.")
+	checkoutIndexCmd.BoolVar(&opts.updateStat, "u", false, "Update stat information for the "+
+		"checked out entries in the index file.")
+	checkoutIndexCmd.BoolVar(&opts.updateStat, "index", false, "Same as `-u`.")
+	checkoutIndexCmd.StringVar(&opts.prefix, "prefix", "", "Prepend <string> to the paths of "+
+		"the files written (a directory needs a trailing slash).")
+	checkoutIndexCmd.BoolVar(&opts.temp, "temp", false, "Write the files to temporary files and "+
+		"print their names instead of writing them to their paths.")
+	checkoutIndexCmd.StringVar(&opts.stage, "stage", "", "Check out entries from stage 1, 2 or 3 "+
+		"of unmerged paths, or `all` stages (requires --temp).")
+
+	return checkoutIndexCmd, opts
+}
+
+func validateCheckoutIndexOptions(files []string, opts *CheckoutIndexOptions) error {
+	switch opts.stage {
+	case "", "0":
+	case "1", "2", "3":
+		opts.stageNumber = int(opts.stage[0] - '0')
+	case "all":
+		if !opts.temp {
+			return fmt.Errorf("--stage=all requires --temp")
+		}
+		opts.stageNumber = -1
+	default:
+		return fmt.Errorf("stage should be between 1 and 3 or all")
+	}
+
+	if opts.all && len(files) > 0 {
+		return fmt.Errorf("cannot combine -a with paths\n%s", CheckoutIndexUsageMsg)
+	}
+	if opts.temp && opts.updateStat {
+		return fmt.Errorf("-u cannot be used with --temp")
+	}
+	return nil
+}
+
+func writeTempFile(hash, mode string) (string, error) {
+	// Write a blob to a new temporary file in the current directory. Symbolic links
+	// are written as regular files holding their target.
+	blobObj, err := gitobj.ReadGitObj(hash)
+	if err != nil {
+		return "", err
+	}
+	tempFile, err := os.CreateTemp(".", ".merge_file_")
+	if err != nil {
+		return "", fmt.Errorf("unable to create temporary file: %w", err)
+	}
+	defer tempFile.Close()
+
+	if _, err := tempFile.Write(blobObj.Content); err != nil {
+		return "", fmt.Errorf("unable to write temporary file: %w", err)
+	}
+	perm := os.FileMode(0644)
+	if mode == "100755" {
+		perm = 0755
+	}
+	if err := tempFile.Chmod(perm); err != nil {
+		return "", err
+	}
+	return strings.TrimPrefix(tempFile.Name(), "./"), nil
+}
+
+var errFileExists = errors.New("file already exists")
+
+func checkoutIndexEntry(entry *index.Entry, opts *CheckoutIndexOptions) (bool, error) {
+	// Write one index entry to the working tree, reporting whether it was written.
+	target := opts.prefix + entry.Path
+	if worktree.Exists(target) && !opts.force {
+		if opts.prefix == "" && entry.Stage == 0 {
+			if modified, err := worktree.IsModified(entry); err == nil && !modified {
+				return false, nil
+			}
+		}
+		if !opts.quiet {
+			fmt.Fprintf(os.Stderr, "%s already exists, no checkout\n", target)
+		}
+		return false, errFileExists
+	}
+
+	if err := worktree.WriteFile(target, entry.Hash, entry.ModeString()); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func CheckoutIndexCmdHandler(files []string, opts *CheckoutIndexOptions) error {
+	if err := validateCheckoutIndexOptions(files, opts); err != nil {
+		return err
+	}
+	idx, err := index.Read()
+	if err != nil {
+		return err
+	}
+
+	wanted := func(entry *index.Entry) bool {
+		return opts.stageNumber == -1 && entry.Stage > 0 || entry.Stage == opts.stageNumber
+	}
+
+	var failed bool
+	var selected [][]*index.Entry
+	if opts.all {
+		var entries []*index.Entry
+		for _, entry := range idx.Entries {
+			if !wanted(entry) {
+				continue
+			}
+			if len(entries) > 0 && entries[0].Path != entry.Path {
+				selected = append(selected, entries)
+				entries = nil
+			}
+			entries = append(entries, entry)
+		}
+		if len(entries) > 0 {
+			selected = append(selected, entries)
+		}
+	}
+	for _, file := range files {
+		stages := idx.Stages(file)
+		var entries []*index.Entry
+		for _, entry := range stages {
+			if wanted(entry) {
+				entries = append(entries, entry)
+			}
+		}
+		switch {
+		case len(stages) == 0:
+			if !opts.quiet {
+				fmt.Fprintf(os.Stderr, "%s is not in the cache\n", file)
+			}
+			failed = true
+		case len(entries) == 0 && opts.stageNumber == 0:
+			if !opts.quiet {
+				fmt.Fprintf(os.Stderr, "path '%s' is unmerged\n", file)
+			}
+			failed = true
+		case len(entries) == 0:
+			if !opts.quiet {
+				fmt.Fprintf(os.Stderr, "%s does not exist at stage %s\n", file, opts.stage)
+			}
+			failed = true
+		default:
+			selected = append(selected, entries)
+		}
+	}
+
+	updated := false
+	for _, entries := range selected {
+		if opts.temp {
+			names := []string{".", ".", "."}
+			for _, entry := range entries {
+				name, err := writeTempFile(entry.Hash, entry.ModeString())
+				if err != nil {
+					return err
+				}
+				if opts.stageNumber != -1 {
+					names = []string{name}
+					break
+				}
+				names[entry.Stage-1] = name
+			}
+			fmt.Printf("%s\t%s\n", strings.Join(names, " "), entries[0].Path)
+			continue
+		}
+
+		for _, entry := range entries {
+			written, err := checkoutIndexEntry(entry, opts)
+			if err == errFileExists {
+				failed = true
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if written && opts.updateStat && opts.prefix == "" && entry.Stage == 0 {
+				refreshed, err := worktree.NewEntry(entry.Path, entry.Hash, entry.ModeString())
+				if err != nil {
+					return err
+				}
+				*entry = *refreshed
+				updated = true
+			}
+		}
+	}
+
+	if updated {
+		if err := idx.Write(); err != nil {
+			return err
+		}
+	}
+	if failed {
+		return fmt.Errorf("some files could not be checked out")
+	}
+	return nil
+}
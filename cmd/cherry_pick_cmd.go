@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+)
+
+const CherryPickUsageMsg = "usage: cherry-pick [-n] [-e] [-x] [--ff] [--allow-empty] [--keep-redundant-commits]\n" +
+	"                   [-m <parent>] [-X <option>] <commit>...\n" +
+	"   or: cherry-pick (--continue | --skip | --abort | --quit)\n"
+
+type CherryPickOptions struct {
+	noCommit      bool
+	edit          bool
+	recordOrigin  bool
+	ff            bool
+	allowEmpty    bool
+	keepRedundant bool
+	mainline      int
+	strategyOpts  stringList
+	cont          bool
+	skip          bool
+	abort         bool
+	quit          bool
+}
+
+func SetupCherryPickCmd() (*flag.FlagSet, *CherryPickOptions) {
+	cherryPickCmd := flag.NewFlagSet("cherry-pick", flag.ExitOnError)
+	opts := &CherryPickOptions{}
+
+	cherryPickCmd.BoolVar(&opts.noCommit, "n", false, "Apply the changes to the index and working tree "+
+		"without committing them.")
+	cherryPickCmd.BoolVar(&opts.noCommit, "no-commit", false, "Same as `-n`.")
+	cherryPickCmd.BoolVar(&opts.edit, "e", false, "Edit the commit message before committing.")
+	cherryPickCmd.BoolVar(&opts.edit, "edit", false, "Same as `-e`.")
+	cherryPickCmd.BoolVar(&opts.recordOrigin, "x", false, "Append \"(cherry picked from commit ...)\" "+
+		"to the commit message.")
+	cherryPickCmd.BoolVar(&opts.ff, "ff", false, "Fast-forward when the picked commit's parent is HEAD.")
+	cherryPickCmd.BoolVar(&opts.allowEmpty, "allow-empty", false, "Keep commits that make no changes "+
+		"instead of stopping at them.")
+	cherryPickCmd.BoolVar(&opts.keepRedundant, "keep-redundant-commits", false, "Keep commits whose "+
+		"changes are already in HEAD as empty commits. Implies `--allow-empty`.")
+	cherryPickCmd.IntVar(&opts.mainline, "m", 0, "Pick a merge commit relative to its <parent> "+
+		"(starting from 1).")
+	cherryPickCmd.IntVar(&opts.mainline, "mainline", 0, "Same as `-m`.")
+	cherryPickCmd.Var(&opts.strategyOpts, "X", "Pass an option to the merge strategy (see `merge -X`).")
+	cherryPickCmd.Var(&opts.strategyOpts, "strategy-option", "Same as `-X`.")
+	cherryPickCmd.BoolVar(&opts.cont, "continue", false, "Resume after resolving conflicts.")
+	cherryPickCmd.BoolVar(&opts.skip, "skip", false, "Skip the commit that stopped the operation.")
+	cherryPickCmd.BoolVar(&opts.abort, "abort", false, "Cancel the operation and return to the "+
+		"state before it.")
+	cherryPickCmd.BoolVar(&opts.quit, "quit", false, "Forget about the operation in progress, "+
+		"keeping the commits made so far.")
+
+	return cherryPickCmd, opts
+}
+
+func sequencerControl(args []string, cont, skip, abort, quit bool, usage string) (bool, bool, error) {
+	// Handle --continue, --skip, --abort and --quit, shared by cherry-pick and
+	// revert. Returns whether one was given, then the command's results.
+	actions := 0
+	for _, set := range []bool{cont, skip, abort, quit} {
+		if set {
+			actions++
+		}
+	}
+	switch {
+	case actions == 0:
+		return false, false, nil
+	case actions > 1:
+		return true, false, fmt.Errorf("--continue, --skip, --abort and --quit cannot be used together")
+	case len(args) > 0:
+		return true, false, fmt.Errorf("--continue, --skip, --abort and --quit expect no arguments\n%s", usage)
+	case cont:
+		ok, err := continueSequencer()
+		return true, ok, err
+	case skip:
+		ok, err := skipSequencer()
+		return true, ok, err
+	case abort:
+		return true, true, abortSequencer()
+	}
+	return true, true, quitSequencer()
+}
+
+func CherryPickCmdHandler(args []string, opts *CherryPickOptions) (bool, error) {
+	// Apply the changes introduced by existing commits on top of HEAD. The
+	// boolean result is false when a commit did not apply cleanly.
+	if handled, ok, err := sequencerControl(args, opts.cont, opts.skip, opts.abort, opts.quit,
+		CherryPickUsageMsg); handled {
+		return ok, err
+	}
+	switch {
+	case len(args) == 0:
+		return false, fmt.Errorf("no commits given\n%s", CherryPickUsageMsg)
+	case opts.mainline < 0:
+		return false, fmt.Errorf("mainline must be a positive parent number")
+	case opts.ff && (opts.noCommit || opts.edit || opts.recordOrigin):
+		return false, fmt.Errorf("--ff cannot be used with --no-commit, --edit or -x")
+	}
+	return sequencerCmdHandler("pick", args, &sequencerOptions{
+		noCommit:      opts.noCommit,
+		edit:          opts.edit,
+		recordOrigin:  opts.recordOrigin,
+		allowFF:       opts.ff,
+		allowEmpty:    opts.allowEmpty || opts.keepRedundant,
+		keepRedundant: opts.keepRedundant,
+		mainline:      opts.mainline,
+		strategyOpts:  opts.strategyOpts,
+	})
+}
@@ -0,0 +1,368 @@
+package cmd
+
+import "flag"
+
+// commands are the built-in commands, in the order `help` lists them. They are
+// registered in init because `help` itself looks them up.
+var commands []*Command
+
+func exitStatus(ok bool, err error) (int, error) {
+	// Turn the result of a handler that reports success into an exit status.
+	if err == nil && !ok {
+		return 1, nil
+	}
+	return 0, err
+}
+
+func init() {
+	commands = []*Command{
+		{
+			Name: "__complete", Summary: "Complete ref names, paths in trees and object ids",
+			Usage: CompleteUsageMsg, Hidden: true, MinArgs: 1, MaxArgs: 2,
+			Setup: func(string) (*flag.FlagSet, runFunc) {
+				return flag.NewFlagSet("__complete", flag.ExitOnError), func(args commandArgs) (int, error) {
+					words := append(args.all(), "")
+					return 0, CompleteCmdHandler(words[0], words[1])
+				}
+			},
+		},
+		{
+			Name: "annotate", Summary: "Annotate file lines with commit information", Usage: AnnotateUsageMsg,
+			MaxArgs: anyArgs,
+			Setup: func(string) (*flag.FlagSet, runFunc) {
+				fs, opts := SetupBlameCmd("annotate")
+				return fs, func(args commandArgs) (int, error) {
+					return 0, BlameCmdHandler(args.args, args.paths, args.separator, opts)
+				}
+			},
+		},
+		{
+			Name: "blame", Summary: "Show what revision and author last modified each line of a file",
+			Usage: BlameUsageMsg, MaxArgs: anyArgs,
+			Setup: func(string) (*flag.FlagSet, runFunc) {
+				fs, opts := SetupBlameCmd("blame")
+				return fs, func(args commandArgs) (int, error) {
+					return 0, BlameCmdHandler(args.args, args.paths, args.separator, opts)
+				}
+			},
+		},
+		{
+			Name: "branch", Summary: "List, create, or delete branches", Usage: BranchUsageMsg, MaxArgs: anyArgs,
+			Setup: func(string) (*flag.FlagSet, runFunc) {
+				fs, opts := SetupBranchCmd()
+				return fs, func(args commandArgs) (int, error) {
+					return 0, BranchCmdHandler(args.all(), opts)
+				}
+			},
+		},
+		{
+			Name: "cat-file", Summary: "Provide contents or details of repository objects", Usage: CatFileUsageMsg,
+			MinArgs: 1, MaxArgs: 1,
+			Setup: func(string) (*flag.FlagSet, runFunc) {
+				fs, opts := SetupCatFileCmd()
+				return fs, func(args commandArgs) (int, error) {
+					return 0, CatFileCmdHandler(args.all()[0], opts)
+				}
+			},
+		},
+		{
+			Name: "checkout", Summary: "Switch branches or restore working tree files", Usage: CheckoutUsageMsg,
+			MaxArgs: anyArgs,
+			Setup: func(string) (*flag.FlagSet, runFunc) {
+				fs, opts := SetupCheckoutCmd()
+				return fs, func(args commandArgs) (int, error) {
+					return 0, CheckoutCmdHandler(args.args, args.paths, args.separator, opts)
+				}
+			},
+		},
+		{
+			Name: "checkout-index", Summary: "Copy files from the index to the working tree",
+			Usage: CheckoutIndexUsageMsg, MaxArgs: anyArgs,
+			Setup: func(string) (*flag.FlagSet, runFunc) {
+				fs, opts := SetupCheckoutIndexCmd()
+				return fs, func(args commandArgs) (int, error) {
+					return 0, CheckoutIndexCmdHandler(prefixPaths(args.all()), opts)
+				}
+			},
+		},
+		{
+			Name: "cherry-pick", Summary: "Apply the changes introduced by some existing commits",
+			Usage: CherryPickUsageMsg, MaxArgs: anyArgs,
+			Setup: func(string) (*flag.FlagSet, runFunc) {
+				fs, opts := SetupCherryPickCmd()
+				return fs, func(args commandArgs) (int, error) {
+					return exitStatus(CherryPickCmdHandler(args.all(), opts))
+				}
+			},
+		},
+		{
+			Name: "completion", Summary: "Generate a shell completion script", Usage: CompletionUsageMsg,
+			MinArgs: 1, MaxArgs: 1, NoWorkTree: true,
+			Setup: func(string) (*flag.FlagSet, runFunc) {
+				return flag.NewFlagSet("completion", flag.ExitOnError), func(args commandArgs) (int, error) {
+					return 0, CompletionCmdHandler(args.all()[0])
+				}
+			},
+		},
+		{
+			Name: "config", Summary: "Get and set repository or global options", Usage: ConfigUsageMsg,
+			MaxArgs: anyArgs,
+			Setup: func(string) (*flag.FlagSet, runFunc) {
+				fs, opts := SetupConfigCmd()
+				return fs, func(args commandArgs) (int, error) {
+					return ConfigCmdHandler(args.all(), opts)
+				}
+			},
+		},
+		{
+			Name: "count-objects", Summary: "Count unpacked number of objects and their disk consumption",
+			Usage: CountObjectsUsageMsg,
+			Setup: func(string) (*flag.FlagSet, runFunc) {
+				fs, opts := SetupCountObjectsCmd()
+				return fs, func(commandArgs) (int, error) {
+					return 0, CountObjectsCmdHandler(opts)
+				}
+			},
+		},
+		{
+			Name: "diff-tree", Summary: "Compare the content and mode of blobs found via two tree objects",
+			Usage: DiffTreeUsageMsg, MinArgs: 2, MaxArgs: 2,
+			Setup: func(string) (*flag.FlagSet, runFunc) {
+				fs, opts := SetupDiffTreeCmd()
+				return fs, func(args commandArgs) (int, error) {
+					trees := args.all()
+					return 0, DiffTreeCmdHandler(trees[0], trees[1], opts)
+				}
+			},
+		},
+		{
+			Name: "fsck", Summary: "Verify the connectivity and validity of the objects in the database",
+			Usage: FsckUsageMsg, MaxArgs: anyArgs,
+			Setup: func(string) (*flag.FlagSet, runFunc) {
+				fs, opts := SetupFsckCmd()
+				return fs, func(args commandArgs) (int, error) {
+					return FsckCmdHandler(args.all(), opts)
+				}
+			},
+		},
+		{
+			Name: "gc", Summary: "Cleanup unnecessary files and optimize the local repository", Usage: GcUsageMsg,
+			Setup: func(string) (*flag.FlagSet, runFunc) {
+				fs, opts := SetupGcCmd()
+				return fs, func(commandArgs) (int, error) {
+					return 0, GcCmdHandler(opts)
+				}
+			},
+		},
+		{
+			Name: "hash-object", Summary: "Compute object ID and optionally create an object from a file",
+			Usage: HashObjectUsageMsg, MinArgs: 1, MaxArgs: anyArgs,
+			Setup: func(string) (*flag.FlagSet, runFunc) {
+				fs, opts := SetupHashObjectCmd()
+				return fs, func(args commandArgs) (int, error) {
+					return 0, HashObjectCmdHandler(prefixPaths(args.all()), opts)
+				}
+			},
+		},
+		{
+			Name: "help", Summary: "Display help information about gotgit", Usage: HelpUsageMsg, MaxArgs: anyArgs,
+			NoWorkTree: true,
+			Setup: func(string) (*flag.FlagSet, runFunc) {
+				return flag.NewFlagSet("help", flag.ExitOnError), func(args commandArgs) (int, error) {
+					return HelpCmdHandler(args.all())
+				}
+			},
+		},
+		{
+			Name: "index-pack", Summary: "Build pack index file for an existing packed archive",
+			Usage: IndexPackUsageMsg, MaxArgs: anyArgs,
+			Setup: func(string) (*flag.FlagSet, runFunc) {
+				fs, opts := SetupIndexPackCmd()
+				return fs, func(args commandArgs) (int, error) {
+					return 0, IndexPackCmdHandler(prefixPaths(args.all()), opts)
+				}
+			},
+		},
+		{
+			Name: "init", Summary: "Create an empty repository or reinitialize an existing one", Usage: InitUsageMsg,
+			MaxArgs: anyArgs, NoWorkTree: true,
+			Setup: func(string) (*flag.FlagSet, runFunc) {
+				fs, opts := SetupInitCommand()
+				return fs, func(args commandArgs) (int, error) {
+					return 0, InitCmdHandler(args.all(), opts)
+				}
+			},
+		},
+		{
+			Name: "ls-tree", Summary: "List the contents of a tree object", Usage: LSTreeUsageMsg, MaxArgs: anyArgs,
+			Setup: func(string) (*flag.FlagSet, runFunc) {
+				fs, opts := SetupLSTreeCmd()
+				return fs, func(args commandArgs) (int, error) {
+					return 0, LSTreeCmdHandler(args.all(), opts)
+				}
+			},
+		},
+		{
+			Name: "merge", Summary: "Join two development histories together", Usage: MergeUsageMsg,
+			MaxArgs: anyArgs,
+			Setup: func(string) (*flag.FlagSet, runFunc) {
+				fs, opts := SetupMergeCmd()
+				return fs, func(args commandArgs) (int, error) {
+					return exitStatus(MergeCmdHandler(args.all(), opts))
+				}
+			},
+		},
+		{
+			Name: "merge-base", Summary: "Find as good common ancestors as possible for a merge",
+			Usage: MergeBaseUsageMsg, MaxArgs: anyArgs,
+			Setup: func(string) (*flag.FlagSet, runFunc) {
+				fs, opts := SetupMergeBaseCmd()
+				return fs, func(args commandArgs) (int, error) {
+					return exitStatus(MergeBaseCmdHandler(args.all(), opts))
+				}
+			},
+		},
+		{
+			Name: "merge-tree", Summary: "Perform merge without touching index or working tree",
+			Usage: MergeTreeUsageMsg, MaxArgs: anyArgs,
+			Setup: func(string) (*flag.FlagSet, runFunc) {
+				fs, opts := SetupMergeTreeCmd()
+				return fs, func(args commandArgs) (int, error) {
+					return exitStatus(MergeTreeCmdHandler(args.all(), opts))
+				}
+			},
+		},
+		{
+			Name: "pack-refs", Summary: "Pack heads and tags for efficient repository access",
+			Usage: PackRefsUsageMsg,
+			Setup: func(string) (*flag.FlagSet, runFunc) {
+				fs, opts := SetupPackRefsCmd()
+				return fs, func(commandArgs) (int, error) {
+					return 0, PackRefsCmdHandler(opts)
+				}
+			},
+		},
+		{
+			Name: "prune", Summary: "Prune all unreachable objects from the object database", Usage: PruneUsageMsg,
+			Setup: func(string) (*flag.FlagSet, runFunc) {
+				fs, opts := SetupPruneCmd()
+				return fs, func(commandArgs) (int, error) {
+					return 0, PruneCmdHandler(opts)
+				}
+			},
+		},
+		{
+			Name: "read-tree", Summary: "Read tree information into the index", Usage: ReadTreeUsageMsg,
+			MaxArgs: anyArgs,
+			Setup: func(string) (*flag.FlagSet, runFunc) {
+				fs, opts := SetupReadTreeCmd()
+				return fs, func(args commandArgs) (int, error) {
+					return 0, ReadTreeCmdHandler(args.all(), opts)
+				}
+			},
+		},
+		{
+			Name: "rebase", Summary: "Reapply commits on top of another base tip", Usage: RebaseUsageMsg,
+			MaxArgs: anyArgs,
+			Setup: func(string) (*flag.FlagSet, runFunc) {
+				fs, opts := SetupRebaseCmd()
+				return fs, func(args commandArgs) (int, error) {
+					return exitStatus(RebaseCmdHandler(args.all(), opts))
+				}
+			},
+		},
+		{
+			Name: "repack", Summary: "Pack unpacked objects in a repository", Usage: RepackUsageMsg,
+			Setup: func(string) (*flag.FlagSet, runFunc) {
+				fs, opts := SetupRepackCmd()
+				return fs, func(commandArgs) (int, error) {
+					return 0, RepackCmdHandler(opts)
+				}
+			},
+		},
+		{
+			Name: "reset", Summary: "Reset current HEAD to the specified state", Usage: ResetUsageMsg,
+			MaxArgs: anyArgs,
+			Setup: func(string) (*flag.FlagSet, runFunc) {
+				fs, opts := SetupResetCmd()
+				return fs, func(args commandArgs) (int, error) {
+					return 0, ResetCmdHandler(args.args, args.paths, args.separator, opts)
+				}
+			},
+		},
+		{
+			Name: "restore", Summary: "Restore working tree files", Usage: RestoreUsageMsg, MaxArgs: anyArgs,
+			Setup: func(string) (*flag.FlagSet, runFunc) {
+				fs, opts := SetupRestoreCmd()
+				return fs, func(args commandArgs) (int, error) {
+					return 0, RestoreCmdHandler(prefixPaths(args.all()), opts)
+				}
+			},
+		},
+		{
+			Name: "revert", Summary: "Revert some existing commits", Usage: RevertUsageMsg, MaxArgs: anyArgs,
+			Setup: func(string) (*flag.FlagSet, runFunc) {
+				fs, opts := SetupRevertCmd()
+				return fs, func(args commandArgs) (int, error) {
+					return exitStatus(RevertCmdHandler(args.all(), opts))
+				}
+			},
+		},
+		{
+			Name: "show", Summary: "Show various types of objects", Usage: ShowUsageMsg, MaxArgs: anyArgs,
+			Setup: func(string) (*flag.FlagSet, runFunc) {
+				fs, opts := SetupShowCmd()
+				return fs, func(args commandArgs) (int, error) {
+					return 0, ShowCmdHandler(args.all(), opts)
+				}
+			},
+		},
+		{
+			Name: "stash", Summary: "Stash the changes in a dirty working directory away", Usage: StashUsageMsg,
+			MaxArgs: anyArgs, Subcommands: stashSubcommands,
+			Setup: func(subcommand string) (*flag.FlagSet, runFunc) {
+				fs, opts := SetupStashCmd(subcommand)
+				return fs, func(args commandArgs) (int, error) {
+					return exitStatus(StashCmdHandler(subcommand, args.args, args.paths, opts))
+				}
+			},
+		},
+		{
+			Name: "switch", Summary: "Switch branches", Usage: SwitchUsageMsg, MaxArgs: anyArgs,
+			Setup: func(string) (*flag.FlagSet, runFunc) {
+				fs, opts := SetupSwitchCmd()
+				return fs, func(args commandArgs) (int, error) {
+					return 0, SwitchCmdHandler(args.all(), opts)
+				}
+			},
+		},
+		{
+			Name: "unpack-objects", Summary: "Unpack objects from a packed archive", Usage: UnpackObjectsUsageMsg,
+			Setup: func(string) (*flag.FlagSet, runFunc) {
+				fs, opts := SetupUnpackObjectsCmd()
+				return fs, func(commandArgs) (int, error) {
+					return 0, UnpackObjectsCmdHandler(opts)
+				}
+			},
+		},
+		{
+			Name: "verify-pack", Summary: "Validate packed archive files", Usage: VerifyPackUsageMsg,
+			MaxArgs: anyArgs,
+			Setup: func(string) (*flag.FlagSet, runFunc) {
+				fs, opts := SetupVerifyPackCmd()
+				return fs, func(args commandArgs) (int, error) {
+					return exitStatus(VerifyPackCmdHandler(prefixPaths(args.all()), opts))
+				}
+			},
+		},
+		{
+			Name: "write-tree", Summary: "Create a tree object from the working directory", Usage: WriteTreeUsageMsg,
+			Setup: func(string) (*flag.FlagSet, runFunc) {
+				fs, opts := SetupWriteTreeCmd()
+				return fs, func(commandArgs) (int, error) {
+					return 0, WriteTreeCmdHandler(opts)
+				}
+			},
+		},
+	}
+}
@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/tsoud/GoTGit.git/completion"
+)
+
+const CompletionUsageMsg = "usage: completion (bash | zsh | fish)\n"
+
+var CompleteUsageMsg = "usage: __complete (" + strings.Join(completion.Kinds, " | ") + ") [--] [<word>]\n"
+
+func completionFlags(fs *flag.FlagSet) []completion.Flag {
+	// Describe the options of a command the way `-h` lists them.
+	var flags []completion.Flag
+	for _, entry := range helpFlags(fs) {
+		flags = append(flags, completion.Flag{
+			Names: entry.options(), Description: entry.usage, TakesValue: takesValue(entry.flag),
+		})
+	}
+	return flags
+}
+
+func completionSpec() *completion.Spec {
+	// Describe the commands that aren't hidden, with the options of each
+	// subcommand set up separately.
+	spec := &completion.Spec{Program: "gotgit", Options: globalFlags}
+	var names []string
+	for _, command := range commands {
+		if !command.Hidden {
+			names = append(names, command.Name)
+		}
+	}
+	for _, command := range commands {
+		if command.Hidden {
+			continue
+		}
+		entry := completion.Command{Name: command.Name, Description: command.Summary}
+		switch command.Name {
+		case "help":
+			entry.Words = names
+		case "completion":
+			entry.Words = completion.Shells
+		}
+		if len(command.Subcommands) == 0 {
+			fs, _ := command.Setup("")
+			entry.Flags = completionFlags(fs)
+		}
+		for _, subcommand := range command.Subcommands {
+			fs, _ := command.Setup(subcommand)
+			entry.Subcommands = append(entry.Subcommands, completion.Command{
+				Name: subcommand, Flags: completionFlags(fs),
+			})
+		}
+		spec.Commands = append(spec.Commands, entry)
+	}
+	return spec
+}
+
+func CompletionCmdHandler(shell string) error {
+	// Print the script that sets up completion of gotgit's commands in `shell`.
+	return completionSpec().Write(os.Stdout, shell)
+}
+
+func CompleteCmdHandler(kind, word string) error {
+	// Print the completions of `word`, one per line, for the completion
+	// scripts to offer.
+	candidates, err := completion.Candidates(kind, word)
+	if err != nil {
+		return err
+	}
+	for _, candidate := range candidates {
+		fmt.Println(candidate)
+	}
+	return nil
+}
@@ -0,0 +1,491 @@
+package cmd
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+
+	"github.com/tsoud/GoTGit.git/config"
+)
+
+const ConfigUsageMsg = "usage: config [<file-option>] [--type=<type>] [--show-origin] [--show-scope] <name> [<value> [<value-pattern>]]\n" +
+	"       config [<file-option>] [--type=<type>] --add <name> <value>\n" +
+	"       config [<file-option>] [--type=<type>] --replace-all <name> <value> [<value-pattern>]\n" +
+	"       config [<file-option>] [--type=<type>] [--show-origin] [--show-scope] --get <name> [<value-pattern>]\n" +
+	"       config [<file-option>] [--type=<type>] [--show-origin] [--show-scope] --get-all <name> [<value-pattern>]\n" +
+	"       config [<file-option>] [--type=<type>] [--show-origin] [--show-scope] [--name-only] --get-regexp <name-regex> [<value-pattern>]\n" +
+	"       config [<file-option>] --unset <name> [<value-pattern>]\n" +
+	"       config [<file-option>] --unset-all <name> [<value-pattern>]\n" +
+	"       config [<file-option>] --rename-section <old-name> <new-name>\n" +
+	"       config [<file-option>] --remove-section <name>\n" +
+	"       config [<file-option>] [--show-origin] [--show-scope] [--name-only] -l | --list\n" +
+	"where <file-option> is one of --system, --global, --local, --worktree or --file <file>\n"
+
+// Exit statuses of `git config`, besides the usual 128 after a fatal error.
+const (
+	configInvalidKey    = 1
+	configNotFound      = 5
+	configInvalidRegexp = 6
+	configUsage         = 129
+)
+
+type ConfigOptions struct {
+	system        bool
+	global        bool
+	local         bool
+	worktree      bool
+	file          string
+	get           bool
+	getAll        bool
+	getRegexp     bool
+	add           bool
+	replaceAll    bool
+	unset         bool
+	unsetAll      bool
+	renameSection bool
+	removeSection bool
+	list          bool
+	valueType     string
+	boolType      bool
+	intType       bool
+	pathType      bool
+	fixedValue    bool
+	nameOnly      bool
+	showOrigin    bool
+	showScope     bool
+	defaultValue  optionalValue
+}
+
+func SetupConfigCmd() (*flag.FlagSet, *ConfigOptions) {
+	configCmd := flag.NewFlagSet("config", flag.ExitOnError)
+	opts := &ConfigOptions{}
+
+	configCmd.BoolVar(&opts.system, "system", false, "Use the system-wide config file.")
+	configCmd.BoolVar(&opts.global, "global", false, "Use the user's config file.")
+	configCmd.BoolVar(&opts.local, "local", false, "Use the repository's config file.")
+	configCmd.BoolVar(&opts.worktree, "worktree", false, "Use the worktree's config file "+
+		"(the repository's unless `extensions.worktreeConfig` is set).")
+	configCmd.StringVar(&opts.file, "file", "", "Use the given config `file`.")
+	configCmd.StringVar(&opts.file, "f", "", "Short for `--file`.")
+	configCmd.BoolVar(&opts.get, "get", false, "Show the value of a key: name [value-pattern].")
+	configCmd.BoolVar(&opts.getAll, "get-all", false, "Show every value of a key: name [value-pattern].")
+	configCmd.BoolVar(&opts.getRegexp, "get-regexp", false, "Show the keys matching a regexp and their "+
+		"values: name-regex [value-pattern].")
+	configCmd.BoolVar(&opts.add, "add", false, "Add a value to a key without replacing any: name value.")
+	configCmd.BoolVar(&opts.replaceAll, "replace-all", false, "Replace every matching value of a key: "+
+		"name value [value-pattern].")
+	configCmd.BoolVar(&opts.unset, "unset", false, "Remove a key: name [value-pattern].")
+	configCmd.BoolVar(&opts.unsetAll, "unset-all", false, "Remove every matching value of a key: "+
+		"name [value-pattern].")
+	configCmd.BoolVar(&opts.renameSection, "rename-section", false, "Rename a section: old-name new-name.")
+	configCmd.BoolVar(&opts.removeSection, "remove-section", false, "Remove a section: name.")
+	configCmd.BoolVar(&opts.list, "list", false, "List every key and value.")
+	configCmd.BoolVar(&opts.list, "l", false, "Short for `--list`.")
+	configCmd.StringVar(&opts.valueType, "type", "", "Check and show values as the given `type`: "+
+		"bool, int or path.")
+	configCmd.BoolVar(&opts.boolType, "bool", false, "Same as `--type=bool`.")
+	configCmd.BoolVar(&opts.intType, "int", false, "Same as `--type=int`.")
+	configCmd.BoolVar(&opts.pathType, "path", false, "Same as `--type=path`.")
+	configCmd.BoolVar(&opts.fixedValue, "fixed-value", false, "Compare values to value-pattern as plain "+
+		"strings rather than regexps.")
+	configCmd.BoolVar(&opts.nameOnly, "name-only", false, "Show only the names of keys.")
+	configCmd.BoolVar(&opts.showOrigin, "show-origin", false, "Show the file each value is set in.")
+	configCmd.BoolVar(&opts.showScope, "show-scope", false, "Show the scope each value is set in.")
+	configCmd.Var(&opts.defaultValue, "default", "With `--get`, the value to show if the key is missing.")
+
+	return configCmd, opts
+}
+
+func configUsageError(msg string) int {
+	fmt.Fprintf(os.Stderr, "error: %s\n%s", msg, ConfigUsageMsg)
+	return configUsage
+}
+
+func configFatal(format string, args ...any) int {
+	fmt.Fprintf(os.Stderr, "fatal: "+format+"\n", args...)
+	return fatalExitCode
+}
+
+func configError(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, "error: "+format+"\n", args...)
+}
+
+func (opts *ConfigOptions) scope() (config.Scope, int) {
+	// Return the scope of the file option given, or 0 if none was.
+	var scope config.Scope
+	count := 0
+	for _, option := range []struct {
+		set   bool
+		scope config.Scope
+	}{
+		{opts.system, config.ScopeSystem},
+		{opts.global, config.ScopeGlobal},
+		{opts.local, config.ScopeLocal},
+		{opts.worktree, config.ScopeWorktree},
+		{opts.file != "", config.ScopeCommand},
+	} {
+		if option.set {
+			scope = option.scope
+			count++
+		}
+	}
+	return scope, count
+}
+
+func (opts *ConfigOptions) loadConfig(writing bool) (*config.Config, error) {
+	// Read the config named by the file option, or every scope when reading
+	// without one. Changes go to the repository's config by default.
+	switch scope, _ := opts.scope(); {
+	case opts.file != "":
+		return config.LoadFile(prefixPath(opts.file))
+	case scope != 0:
+		return config.LoadScope(scope)
+	case writing:
+		return config.LoadScope(config.ScopeLocal)
+	default:
+		return config.Load()
+	}
+}
+
+func (opts *ConfigOptions) typeName() (string, int) {
+	// Return the type values are given as, or fail if several were given.
+	var types []string
+	if opts.valueType != "" {
+		types = append(types, opts.valueType)
+	}
+	for _, option := range []struct {
+		set  bool
+		name string
+	}{{opts.boolType, "bool"}, {opts.intType, "int"}, {opts.pathType, "path"}} {
+		if option.set {
+			types = append(types, option.name)
+		}
+	}
+	switch {
+	case len(types) > 1:
+		return "", configUsageError("only one type at a time")
+	case len(types) == 0:
+		return "", 0
+	}
+	switch types[0] {
+	case "bool", "int", "path":
+		return types[0], 0
+	}
+	return "", configFatal("unrecognized --type argument, %s", types[0])
+}
+
+func formatTypedValue(e config.Entry, typeName string) (string, error) {
+	// Show a value as its type: booleans as "true" or "false", integers with
+	// their unit applied and paths with "~" expanded.
+	where := ""
+	if e.File != "" {
+		where = " in file " + e.File
+	}
+	switch typeName {
+	case "bool":
+		if e.NoValue {
+			return "true", nil
+		}
+		value, err := config.ParseBool(e.Value)
+		if err != nil {
+			return "", fmt.Errorf("bad boolean config value '%s' for '%s'", e.Value, e.Key)
+		}
+		return strconv.FormatBool(value), nil
+	case "int":
+		value, err := config.ParseInt(e.Value)
+		if err != nil {
+			return "", fmt.Errorf("bad numeric config value '%s' for '%s'%s: %w", e.Value, e.Key, where, err)
+		}
+		return strconv.FormatInt(value, 10), nil
+	case "path":
+		if e.NoValue {
+			return "", fmt.Errorf("missing value for '%s'", e.Key)
+		}
+		return config.ExpandPath(e.Value)
+	}
+	return e.Value, nil
+}
+
+func valueMatcher(pattern string, fixed bool) (func(string) bool, error) {
+	// Build the matcher for a value-pattern, which matches values that don't
+	// match the rest of it if it starts with "!".
+	negate := false
+	if len(pattern) > 0 && pattern[0] == '!' && !fixed {
+		negate, pattern = true, pattern[1:]
+	}
+	if fixed {
+		return func(value string) bool { return value == pattern }, nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return func(value string) bool { return re.MatchString(value) != negate }, nil
+}
+
+func ConfigCmdHandler(args []string, opts *ConfigOptions) (int, error) {
+	// Query or change the config, returning the exit status `git config`
+	// would: 1 for a missing value or invalid key, 5 when unsetting a missing
+	// key or changing several values at once and 6 for an invalid regexp.
+	if _, count := opts.scope(); count > 1 {
+		return configUsageError("only one config file at a time"), nil
+	}
+	typeName, status := opts.typeName()
+	if status != 0 {
+		return status, nil
+	}
+
+	actions := 0
+	for _, set := range []bool{opts.get, opts.getAll, opts.getRegexp, opts.add, opts.replaceAll,
+		opts.unset, opts.unsetAll, opts.renameSection, opts.removeSection, opts.list} {
+		if set {
+			actions++
+		}
+	}
+	switch {
+	case actions > 1:
+		return configUsageError("only one action at a time"), nil
+	case actions == 0 && len(args) == 1:
+		opts.get = true
+	case actions == 0 && len(args) > 1:
+		return configSet(args, opts, typeName)
+	case actions == 0:
+		fmt.Fprint(os.Stderr, ConfigUsageMsg)
+		return configUsage, nil
+	}
+
+	switch {
+	case opts.list:
+		if len(args) != 0 {
+			return configUsageError("wrong number of arguments, should be 0"), nil
+		}
+		return configList(opts)
+	case opts.get, opts.getAll, opts.getRegexp:
+		if len(args) < 1 || len(args) > 2 {
+			return configUsageError("wrong number of arguments, should be from 1 to 2"), nil
+		}
+		return configGet(args, opts, typeName)
+	case opts.add, opts.replaceAll:
+		return configSet(args, opts, typeName)
+	case opts.unset, opts.unsetAll:
+		if len(args) < 1 || len(args) > 2 {
+			return configUsageError("wrong number of arguments, should be from 1 to 2"), nil
+		}
+		return configUnset(args, opts)
+	default:
+		return configSection(args, opts)
+	}
+}
+
+func printEntry(e config.Entry, opts *ConfigOptions, format func(config.Entry) string) {
+	if opts.showScope {
+		fmt.Printf("%s\t", e.Scope)
+	}
+	if opts.showOrigin {
+		fmt.Printf("%s\t", e.Origin())
+	}
+	fmt.Println(format(e))
+}
+
+func configList(opts *ConfigOptions) (int, error) {
+	// List every entry as "key=value", or just "key" if it has no value.
+	cfg, err := opts.loadConfig(false)
+	if err != nil {
+		return 0, err
+	}
+	if opts.file != "" || opts.global || opts.system {
+		if _, err := os.Stat(cfg.Path); err != nil {
+			return configFatal("unable to read config file '%s': No such file or directory", cfg.Path), nil
+		}
+	}
+	for _, e := range cfg.Entries() {
+		printEntry(e, opts, func(e config.Entry) string {
+			if e.NoValue || opts.nameOnly {
+				return e.Key
+			}
+			return e.Key + "=" + e.Value
+		})
+	}
+	return 0, nil
+}
+
+func configGet(args []string, opts *ConfigOptions, typeName string) (int, error) {
+	// Show the last value of a key with `--get`, every value with `--get-all`,
+	// or every key matching a regexp and its values with `--get-regexp`.
+	var matchKey func(string) bool
+	if opts.getRegexp {
+		re, err := regexp.Compile(args[0])
+		if err != nil {
+			configError("invalid key pattern: %s", args[0])
+			return configInvalidRegexp, nil
+		}
+		matchKey = re.MatchString
+	} else {
+		key, err := config.CanonicalKey(args[0])
+		if err != nil {
+			configError("%s", err)
+			return configInvalidKey, nil
+		}
+		matchKey = func(k string) bool { return k == key }
+	}
+	matchValue := func(string) bool { return true }
+	if len(args) > 1 {
+		var err error
+		if matchValue, err = valueMatcher(args[1], opts.fixedValue); err != nil {
+			configError("invalid pattern: %s", args[1])
+			return configInvalidRegexp, nil
+		}
+	}
+
+	cfg, err := opts.loadConfig(false)
+	if err != nil {
+		return 0, err
+	}
+	var matches []config.Entry
+	for _, e := range cfg.Entries() {
+		if matchKey(e.Key) && matchValue(e.Value) {
+			matches = append(matches, e)
+		}
+	}
+	if len(matches) == 0 {
+		if !opts.defaultValue.set || !opts.get {
+			return configInvalidKey, nil
+		}
+		matches = []config.Entry{{Key: args[0], Value: opts.defaultValue.value, Scope: config.ScopeCommand}}
+	}
+	if opts.get {
+		matches = matches[len(matches)-1:]
+	}
+
+	for _, e := range matches {
+		value, err := formatTypedValue(e, typeName)
+		if err != nil {
+			return configFatal("%s", err), nil
+		}
+		printEntry(e, opts, func(e config.Entry) string {
+			switch {
+			case !opts.getRegexp:
+				return value
+			case opts.nameOnly || e.NoValue && typeName == "":
+				return e.Key
+			}
+			return e.Key + " " + value
+		})
+	}
+	return 0, nil
+}
+
+func configSet(args []string, opts *ConfigOptions, typeName string) (int, error) {
+	// Set a key, replacing the values matching value-pattern with
+	// `--replace-all`, or add another value with `--add`.
+	switch {
+	case opts.add && len(args) != 2:
+		return configUsageError("wrong number of arguments, should be 2"), nil
+	case len(args) < 2 || len(args) > 3:
+		return configUsageError("wrong number of arguments, should be from 2 to 3"), nil
+	}
+	key, value := args[0], args[1]
+	canonical, err := config.CanonicalKey(key)
+	if err != nil {
+		configError("%s", err)
+		return configInvalidKey, nil
+	}
+	if typeName == "bool" || typeName == "int" {
+		if value, err = formatTypedValue(config.Entry{Key: canonical, Value: value}, typeName); err != nil {
+			return configFatal("%s", err), nil
+		}
+	}
+	var match func(string) bool
+	if len(args) > 2 {
+		if match, err = valueMatcher(args[2], opts.fixedValue); err != nil {
+			configError("invalid pattern: %s", args[2])
+			return configInvalidRegexp, nil
+		}
+	}
+
+	cfg, err := opts.loadConfig(true)
+	if err != nil {
+		return 0, err
+	}
+	if opts.add {
+		return 0, cfg.Add(key, value)
+	}
+	var multiple *config.MultipleValuesError
+	if err := cfg.Replace(key, value, match, opts.replaceAll); errors.As(err, &multiple) {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", err)
+		configError("cannot overwrite multiple values with a single value\n"+
+			"       Use a regexp, --add or --replace-all to change %s.", canonical)
+		return configNotFound, nil
+	} else if err != nil {
+		return 0, err
+	}
+	return 0, nil
+}
+
+func configUnset(args []string, opts *ConfigOptions) (int, error) {
+	// Remove a key, or with `--unset-all` every value of it matching
+	// value-pattern.
+	if _, err := config.CanonicalKey(args[0]); err != nil {
+		configError("%s", err)
+		return configInvalidKey, nil
+	}
+	var match func(string) bool
+	if len(args) > 1 {
+		var err error
+		if match, err = valueMatcher(args[1], opts.fixedValue); err != nil {
+			configError("invalid pattern: %s", args[1])
+			return configInvalidRegexp, nil
+		}
+	}
+
+	cfg, err := opts.loadConfig(true)
+	if err != nil {
+		return 0, err
+	}
+	var multiple *config.MultipleValuesError
+	switch err := cfg.UnsetMatching(args[0], match, opts.unsetAll); {
+	case errors.Is(err, config.ErrKeyNotFound):
+		return configNotFound, nil
+	case errors.As(err, &multiple):
+		fmt.Fprintf(os.Stderr, "warning: %s\n", err)
+		return configNotFound, nil
+	case err != nil:
+		return 0, err
+	}
+	return 0, nil
+}
+
+func configSection(args []string, opts *ConfigOptions) (int, error) {
+	// Rename a section with `--rename-section` or remove it with
+	// `--remove-section`.
+	want := 1
+	if opts.renameSection {
+		want = 2
+	}
+	if len(args) != want {
+		return configUsageError(fmt.Sprintf("wrong number of arguments, should be %d", want)), nil
+	}
+	if opts.renameSection && !config.ValidSection(args[1]) {
+		configError("invalid section name: %s", args[1])
+		return configInvalidKey, nil
+	}
+
+	cfg, err := opts.loadConfig(true)
+	if err != nil {
+		return 0, err
+	}
+	found, err := cfg.HasSection(args[0])
+	if err != nil {
+		return 0, err
+	}
+	if !found {
+		return configFatal("no such section: %s", args[0]), nil
+	}
+	if opts.renameSection {
+		return 0, cfg.RenameSection(args[0], args[1])
+	}
+	return 0, cfg.RemoveSection(args[0])
+}
@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/tsoud/GoTGit.git/gc"
+)
+
+const CountObjectsUsageMsg = "usage: count-objects [-v] [-H]\n"
+
+type CountObjectsOptions struct {
+	verbose       bool
+	humanReadable bool
+}
+
+func SetupCountObjectsCmd() (*flag.FlagSet, *CountObjectsOptions) {
+	countObjectsCmd := flag.NewFlagSet("count-objects", flag.ExitOnError)
+	opts := &CountObjectsOptions{}
+
+	countObjectsCmd.BoolVar(&opts.verbose, "v", false, "Also report packed objects, objects that "+
+		"are both loose and packed, and garbage files.")
+	countObjectsCmd.BoolVar(&opts.humanReadable, "H", false, "Show sizes in human-readable units.")
+
+	return countObjectsCmd, opts
+}
+
+func CountObjectsCmdHandler(opts *CountObjectsOptions) error {
+	// Report how many objects there are and the space they take up. Garbage
+	// files are only looked into with `-v`.
+	var warnGarbage func(file, reason string)
+	if opts.verbose {
+		warnGarbage = func(file, reason string) {
+			fmt.Fprintf(os.Stderr, "warning: %s: %s\n", reason, file)
+		}
+	}
+	counts, err := gc.CountObjects(warnGarbage)
+	if err != nil {
+		return err
+	}
+	size := func(bytes int64) string {
+		if opts.humanReadable {
+			return humanBytes(bytes)
+		}
+		return fmt.Sprint(bytes / 1024)
+	}
+
+	if !opts.verbose {
+		if opts.humanReadable {
+			fmt.Printf("%d objects, %s\n", counts.Count, humanBytes(counts.Size))
+		} else {
+			fmt.Printf("%d objects, %d kilobytes\n", counts.Count, counts.Size/1024)
+		}
+		return nil
+	}
+	fmt.Printf("count: %d\n", counts.Count)
+	fmt.Printf("size: %s\n", size(counts.Size))
+	fmt.Printf("in-pack: %d\n", counts.InPack)
+	fmt.Printf("packs: %d\n", counts.Packs)
+	fmt.Printf("size-pack: %s\n", size(counts.SizePack))
+	fmt.Printf("prune-packable: %d\n", counts.PrunePackable)
+	fmt.Printf("garbage: %d\n", counts.Garbage)
+	fmt.Printf("size-garbage: %s\n", size(counts.SizeGarbage))
+	return nil
+}
+
+func humanBytes(bytes int64) string {
+	// Format a size the way Git does, with two decimals in KiB, MiB or GiB.
+	switch {
+	case bytes > 1<<30:
+		return fmt.Sprintf("%d.%02d GiB", bytes>>30, (bytes&(1<<30-1))/10737419)
+	case bytes > 1<<20:
+		x := bytes + 5243
+		return fmt.Sprintf("%d.%02d MiB", x>>20, ((x&(1<<20-1))*100)>>20)
+	case bytes > 1<<10:
+		x := bytes + 5
+		return fmt.Sprintf("%d.%02d KiB", x>>10, ((x&(1<<10-1))*100)>>10)
+	case bytes == 1:
+		return "1 byte"
+	default:
+		return fmt.Sprintf("%d bytes", bytes)
+	}
+}
@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/tsoud/GoTGit.git/diff"
+	"github.com/tsoud/GoTGit.git/refs"
+)
+
+const DiffTreeUsageMsg = "usage: diff-tree [-r] [-M[<n>]] [-C[<n>]] [--find-copies-harder] [-l<num>]\n" +
+	"                 [--name-only | --name-status | --stat] <tree-ish> <tree-ish>\n"
+
+type DiffTreeOptions struct {
+	recursive        bool
+	findRenames      optionalValue
+	findCopies       optionalValue
+	findCopiesHarder bool
+	renameLimit      int
+	nameOnly         bool
+	nameStatus       bool
+	stat             bool
+}
+
+func SetupDiffTreeCmd() (*flag.FlagSet, *DiffTreeOptions) {
+	diffTreeCmd := flag.NewFlagSet("diff-tree", flag.ExitOnError)
+	opts := &DiffTreeOptions{}
+
+	diffTreeCmd.BoolVar(&opts.recursive, "r", false, "Recurse into sub-trees.")
+	diffTreeCmd.Var(&opts.findRenames, "M",
+		"Detect renames, optionally with a minimum similarity index (default 50%).")
+	diffTreeCmd.Var(&opts.findRenames, "find-renames", "Same as `-M`.")
+	diffTreeCmd.Var(&opts.findCopies, "C",
+		"Detect copies as well as renames, optionally with a minimum similarity index.")
+	diffTreeCmd.Var(&opts.findCopies, "find-copies", "Same as `-C`.")
+	diffTreeCmd.BoolVar(&opts.findCopiesHarder, "find-copies-harder", false,
+		"Also consider unmodified files as sources of copies.")
+	diffTreeCmd.IntVar(&opts.renameLimit, "l", diff.DefaultRenameLimit,
+		"Skip inexact rename and copy detection when the number of candidates exceeds this limit.")
+	diffTreeCmd.BoolVar(&opts.nameOnly, "name-only", false, "Show only the names of changed files.")
+	diffTreeCmd.BoolVar(&opts.nameStatus, "name-status", false,
+		"Show only the names and status of changed files.")
+	diffTreeCmd.BoolVar(&opts.stat, "stat", false, "Show a diffstat of the changes.")
+
+	return diffTreeCmd, opts
+}
+
+func (opts *DiffTreeOptions) diffOptions() *diff.Options {
+	diffOpts := &diff.Options{
+		Recursive:        opts.recursive || opts.stat,
+		DetectRenames:    opts.findRenames.set || opts.findCopies.set || opts.findCopiesHarder,
+		DetectCopies:     opts.findCopies.set || opts.findCopiesHarder,
+		FindCopiesHarder: opts.findCopiesHarder,
+		RenameLimit:      opts.renameLimit,
+		Warnings:         os.Stderr,
+	}
+	for _, score := range []string{opts.findRenames.value, opts.findCopies.value} {
+		if score != "" {
+			diffOpts.RenameScore = diff.ParseScore(score)
+		}
+	}
+	return diffOpts
+}
+
+func DiffTreeCmdHandler(oldTreeish, newTreeish string, opts *DiffTreeOptions) error {
+	oldTree, err := refs.ResolveTree(oldTreeish)
+	if err != nil {
+		return err
+	}
+	newTree, err := refs.ResolveTree(newTreeish)
+	if err != nil {
+		return err
+	}
+
+	changes, err := diff.TreeDiff(oldTree, newTree, opts.diffOptions())
+	if err != nil {
+		return fmt.Errorf("error comparing trees: %w", err)
+	}
+
+	if opts.stat {
+		stats, err := diff.Stat(changes)
+		if err != nil {
+			return err
+		}
+		if len(stats) > 0 {
+			return diff.WriteStat(os.Stdout, stats)
+		}
+		return nil
+	}
+
+	quote := pathQuoter()
+	for _, change := range changes {
+		switch {
+		case opts.nameOnly:
+			fmt.Println(quote(change.Path()))
+		case opts.nameStatus && (change.Status == diff.Renamed || change.Status == diff.Copied):
+			fmt.Printf("%s\t%s\t%s\n", change.StatusString(), quote(change.OldPath), quote(change.NewPath))
+		case opts.nameStatus:
+			fmt.Printf("%s\t%s\n", change.StatusString(), quote(change.Path()))
+		default:
+			fmt.Println(change.Raw(quote))
+		}
+	}
+
+	return nil
+}
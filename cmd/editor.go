@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/tsoud/GoTGit.git/config"
+	"github.com/tsoud/GoTGit.git/hooks"
+)
+
+func editorCommand(sequence bool) string {
+	// Pick the editor the way Git does: GIT_SEQUENCE_EDITOR and `sequence.editor`
+	// for todo lists, then GIT_EDITOR, `core.editor`, VISUAL and EDITOR.
+	configValue := func(key string) string { return "" }
+	if cfg, err := config.Load(); err == nil {
+		configValue = func(key string) string {
+			value, _ := cfg.Get(key)
+			return value
+		}
+	}
+
+	var editors []string
+	if sequence {
+		editors = append(editors, os.Getenv("GIT_SEQUENCE_EDITOR"), configValue("sequence.editor"))
+	}
+	editors = append(editors, os.Getenv("GIT_EDITOR"), configValue("core.editor"),
+		os.Getenv("VISUAL"), os.Getenv("EDITOR"))
+	for _, editor := range editors {
+		if editor != "" {
+			return editor
+		}
+	}
+	return "vi"
+}
+
+func launchEditor(file string, sequence bool) error {
+	// Let the user edit `file`, running the editor through the shell so that it
+	// may include arguments.
+	editor := editorCommand(sequence)
+	if editor == ":" {
+		return nil
+	}
+	editorCmd := exec.Command("sh", "-c", editor+` "$@"`, editor, file)
+	editorCmd.Stdin, editorCmd.Stdout, editorCmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := editorCmd.Run(); err != nil {
+		return fmt.Errorf("there was a problem with the editor '%s'", editor)
+	}
+	return nil
+}
+
+func cleanupMessage(message string) string {
+	// Strip comment lines and trailing whitespace, collapse runs of blank lines and
+	// make sure the message ends with a single newline (or is empty).
+	var lines []string
+	blank := false
+	for _, line := range strings.Split(message, "\n") {
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimRight(line, " \t\r")
+		if line == "" {
+			blank = len(lines) > 0
+			continue
+		}
+		if blank {
+			lines = append(lines, "")
+			blank = false
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+func editMessage(file, message string) (string, error) {
+	// Write `message` to `file`, open it in the editor and return the cleaned up
+	// result. An empty message is an error.
+	if err := os.WriteFile(file, []byte(message), 0644); err != nil {
+		return "", err
+	}
+	if err := launchEditor(file, false); err != nil {
+		return "", err
+	}
+	edited, err := os.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	if cleaned := cleanupMessage(string(edited)); cleaned != "" {
+		return cleaned, nil
+	}
+	return "", fmt.Errorf("Aborting commit due to empty commit message.")
+}
+
+func hookMessage(message string, runHook func(file string) error) (string, error) {
+	// Hand `message` to a hook through COMMIT_EDITMSG and read back what it leaves
+	// there.
+	file := gitFile("COMMIT_EDITMSG")
+	if err := os.WriteFile(file, []byte(message), 0644); err != nil {
+		return "", err
+	}
+	if err := runHook(file); err != nil {
+		return "", err
+	}
+	changed, err := os.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	return string(changed), nil
+}
+
+func prepareMessage(message, source string) (string, error) {
+	// Let the prepare-commit-msg hook change the message of a commit about to be
+	// made, before the user gets to edit it.
+	if !hooks.Exists("prepare-commit-msg") {
+		return message, nil
+	}
+	return hookMessage(message, func(file string) error {
+		return hooks.PrepareCommitMsg(file, source, "")
+	})
+}
+
+func verifyMessage(message string) (string, error) {
+	// Let the commit-msg hook check, and possibly change, the final message of a
+	// commit. An empty message is an error.
+	if hooks.Exists("commit-msg") {
+		var err error
+		if message, err = hookMessage(message, hooks.CommitMsg); err != nil {
+			return "", err
+		}
+	}
+	if strings.TrimSpace(message) == "" {
+		return "", fmt.Errorf("Aborting commit due to empty commit message.")
+	}
+	return message, nil
+}
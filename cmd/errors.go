@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/tsoud/GoTGit.git/config"
+	"github.com/tsoud/GoTGit.git/gitobj"
+	"github.com/tsoud/GoTGit.git/hooks"
+)
+
+// Git exits with status 128 after a fatal error, such as a missing, corrupt or
+// ambiguous object, one crafted for a SHA-1 collision, or a bad config file.
+const fatalExitCode = 128
+
+func ExitCode(err error) int {
+	// Return the status to exit with after a command fails with `err`. A hook
+	// that refused the operation passes on its own status.
+	var objErr *gitobj.ObjectError
+	var configErr *config.ParseError
+	var hookErr *hooks.ExitError
+	switch {
+	case err == nil:
+		return 0
+	case errors.As(err, &hookErr):
+		return hookErr.Status
+	case errors.As(err, &objErr),
+		errors.As(err, &configErr),
+		errors.Is(err, gitobj.ErrObjectNotFound),
+		errors.Is(err, gitobj.ErrCorruptObject),
+		errors.Is(err, gitobj.ErrInvalidHeader),
+		errors.Is(err, gitobj.ErrAmbiguousObject),
+		errors.Is(err, gitobj.ErrHashCollision):
+		return fatalExitCode
+	default:
+		return 1
+	}
+}
+
+func Fatal(err error) {
+	// Report the error a command failed with, the way git does, as
+	// "fatal: <message>", and exit. A hook that refused the operation has
+	// already said why.
+	var hookErr *hooks.ExitError
+	if !errors.As(err, &hookErr) || err != error(hookErr) {
+		fmt.Fprintf(os.Stderr, "fatal: %s\n", err)
+	}
+	os.Exit(ExitCode(err))
+}
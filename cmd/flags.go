@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// optionalValue is a flag that may be given alone (`-M`, `--merged`) or with a
+// value (`-M=50%`, `--merged=main`).
+type optionalValue struct {
+	set   bool
+	value string
+}
+
+func (f *optionalValue) String() string   { return f.value }
+func (f *optionalValue) IsBoolFlag() bool { return true }
+
+func (f *optionalValue) Set(value string) error {
+	f.set = value != "false"
+	if value != "true" && value != "false" {
+		f.value = value
+	}
+	return nil
+}
+
+// counter is a flag that counts how many times it is given, as in `-v -v`.
+type counter int
+
+func (c *counter) String() string   { return fmt.Sprint(int(*c)) }
+func (c *counter) IsBoolFlag() bool { return true }
+
+func (c *counter) Set(value string) error {
+	if value != "false" {
+		*c++
+	}
+	return nil
+}
+
+// doubleCounter lets a doubled short flag such as `-vv` count twice.
+type doubleCounter struct{ c *counter }
+
+func (d doubleCounter) String() string   { return "" }
+func (d doubleCounter) IsBoolFlag() bool { return true }
+
+func (d doubleCounter) Set(value string) error {
+	if value != "false" {
+		*d.c += 2
+	}
+	return nil
+}
+
+func SplitPathspec(args []string) ([]string, []string, bool) {
+	// Split arguments at the first `--`, which separates options and revisions
+	// from paths.
+	sep := slices.Index(args, "--")
+	if sep == -1 {
+		return args, nil, false
+	}
+	return args[:sep], args[sep+1:], true
+}
+
+// stringList is a flag that may be given several times, as in `-X ours -X no-renames`.
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// countedValue is a flag that may be given several times, each time optionally
+// with a value, as in `-C -C50`.
+type countedValue struct {
+	count int
+	value string
+}
+
+func (f *countedValue) String() string   { return f.value }
+func (f *countedValue) IsBoolFlag() bool { return true }
+
+func (f *countedValue) Set(value string) error {
+	if value == "false" {
+		return nil
+	}
+	f.count++
+	if value != "true" {
+		f.value = value
+	}
+	return nil
+}
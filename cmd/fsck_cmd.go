@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"cmp"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/tsoud/GoTGit.git/fsck"
+)
+
+const FsckUsageMsg = "usage: fsck [--unreachable] [--no-dangling] [--no-reflogs] [--strict]\n" +
+	"            [--connectivity-only] [--lost-found] [<object>...]\n"
+
+type FsckOptions struct {
+	unreachable      bool
+	noDangling       bool
+	noReflogs        bool
+	strict           bool
+	connectivityOnly bool
+	lostFound        bool
+	full             bool
+}
+
+func SetupFsckCmd() (*flag.FlagSet, *FsckOptions) {
+	fsckCmd := flag.NewFlagSet("fsck", flag.ExitOnError)
+	opts := &FsckOptions{}
+
+	fsckCmd.BoolVar(&opts.unreachable, "unreachable", false, "Show objects that exist but aren't "+
+		"reachable from any ref, reflog or the index.")
+	fsckCmd.BoolVar(&opts.noDangling, "no-dangling", false, "Don't show objects that nothing links to.")
+	fsckCmd.BoolVar(&opts.noReflogs, "no-reflogs", false, "Don't count objects only referred to by "+
+		"reflogs as reachable.")
+	fsckCmd.BoolVar(&opts.strict, "strict", false, "Treat warnings as errors, and refuse "+
+		"group-writable file modes.")
+	fsckCmd.BoolVar(&opts.connectivityOnly, "connectivity-only", false, "Only check that reachable "+
+		"objects exist, without checking their contents.")
+	fsckCmd.BoolVar(&opts.lostFound, "lost-found", false, "Write dangling objects to lost-found/commit "+
+		"or lost-found/other in the git directory. Implies `--no-reflogs`.")
+	fsckCmd.BoolVar(&opts.full, "full", true, "Check packed objects as well as loose ones (always on).")
+
+	return fsckCmd, opts
+}
+
+func FsckCmdHandler(args []string, opts *FsckOptions) (int, error) {
+	// Check the repository, printing problems to stderr and missing, dangling or
+	// unreachable objects to stdout. The result is the exit status, which
+	// combines git's bits for the kinds of errors found.
+	result, err := fsck.Check(&fsck.Options{
+		Strict:           opts.strict,
+		ConnectivityOnly: opts.connectivityOnly,
+		Reflogs:          !opts.noReflogs && !opts.lostFound,
+		Heads:            args,
+	})
+	if err != nil {
+		return 0, err
+	}
+	for _, problem := range result.Problems {
+		fmt.Fprintln(os.Stderr, problem)
+	}
+
+	type line struct {
+		status string
+		object fsck.Object
+	}
+	var lines []line
+	for _, object := range result.Missing {
+		lines = append(lines, line{"missing", object})
+	}
+	switch {
+	case opts.unreachable:
+		for _, object := range result.Unreachable {
+			lines = append(lines, line{"unreachable", object})
+		}
+	case !opts.noDangling:
+		for _, object := range result.Dangling {
+			lines = append(lines, line{"dangling", object})
+		}
+	}
+	slices.SortStableFunc(lines, func(a, b line) int { return cmp.Compare(a.object.Hash, b.object.Hash) })
+	for _, l := range lines {
+		fmt.Printf("%s %s %s\n", l.status, l.object.Type, l.object.Hash)
+	}
+
+	if opts.lostFound {
+		if err := fsck.WriteLostFound(result.Dangling); err != nil {
+			return 0, err
+		}
+	}
+	return result.Status, nil
+}
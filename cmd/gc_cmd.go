@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/tsoud/GoTGit.git/config"
+	"github.com/tsoud/GoTGit.git/gc"
+	"github.com/tsoud/GoTGit.git/gitobj"
+	"github.com/tsoud/GoTGit.git/refs"
+)
+
+const GcUsageMsg = "usage: gc [--aggressive] [--auto] [--quiet] [--prune=<date> | --no-prune]\n"
+
+type GcOptions struct {
+	aggressive bool
+	auto       bool
+	quiet      bool
+	prune      string
+	noPrune    bool
+}
+
+func SetupGcCmd() (*flag.FlagSet, *GcOptions) {
+	gcCmd := flag.NewFlagSet("gc", flag.ExitOnError)
+	opts := &GcOptions{}
+
+	gcCmd.BoolVar(&opts.aggressive, "aggressive", false, "Search harder for deltas, taking "+
+		"longer to make a smaller pack.")
+	gcCmd.BoolVar(&opts.auto, "auto", false, "Only do anything if there are too many loose "+
+		"objects or packs (see `gc.auto` and `gc.autoPackLimit`).")
+	gcCmd.BoolVar(&opts.quiet, "quiet", false, "Don't report progress.")
+	gcCmd.StringVar(&opts.prune, "prune", "", "Remove unreachable loose objects older than "+
+		"this date (default `gc.pruneExpire`, or 2.weeks.ago).")
+	gcCmd.BoolVar(&opts.noPrune, "no-prune", false, "Don't remove any unreachable objects.")
+
+	return gcCmd, opts
+}
+
+func GcCmdHandler(opts *GcOptions) error {
+	// Tidy the repository: pack refs, repack objects into a single pack and
+	// prune old unreachable objects. With `--auto` this only happens when
+	// there are enough loose objects or packs to make it worthwhile, and only
+	// new loose objects are packed unless there are too many packs.
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+
+	pruneExpire := opts.prune
+	if pruneExpire == "" {
+		pruneExpire = gc.DefaultPruneExpire
+		if value, ok := cfg.Get("gc.pruneExpire"); ok {
+			pruneExpire = value
+		}
+	}
+	if opts.noPrune {
+		pruneExpire = "never"
+	}
+	expire, err := gc.ParseExpiry(pruneExpire, now)
+	if err != nil {
+		return err
+	}
+
+	repackOpts := &gc.RepackOptions{
+		Delete:            true,
+		LoosenUnreachable: true,
+		UnpackExpire:      expire,
+		Pack: gitobj.PackOptions{
+			Window:      cfg.GetInt("pack.window", gitobj.DefaultPackWindow),
+			Depth:       cfg.GetInt("pack.depth", gitobj.DefaultPackDepth),
+			ReuseDeltas: true,
+		},
+	}
+	if opts.aggressive {
+		repackOpts.Pack.Window = cfg.GetInt("gc.aggressiveWindow", 250)
+		repackOpts.Pack.Depth = cfg.GetInt("gc.aggressiveDepth", 50)
+		repackOpts.Pack.ReuseDeltas = false
+	}
+	// Objects that would be pruned straight away needn't be made loose first.
+	if !expire.IsZero() && !expire.Before(now) {
+		repackOpts.LoosenUnreachable, repackOpts.All = false, true
+	}
+
+	if opts.auto {
+		tooManyLoose, err := gc.TooManyLooseObjects(cfg.GetInt("gc.auto", gc.DefaultAutoLimit))
+		if err != nil {
+			return err
+		}
+		tooManyPacks, err := gc.TooManyPacks(cfg.GetInt("gc.autoPackLimit", gc.DefaultAutoPackLimit))
+		if err != nil {
+			return err
+		}
+		if !tooManyLoose && !tooManyPacks {
+			return nil
+		}
+		if !tooManyPacks {
+			repackOpts.LoosenUnreachable, repackOpts.All = false, false
+		}
+		if !opts.quiet {
+			fmt.Fprintln(os.Stderr, "Auto packing the repository for optimum performance.")
+			fmt.Fprintln(os.Stderr, "See \"git help gc\" for manual housekeeping.")
+		}
+	}
+
+	if cfg.GetBool("gc.packRefs", true) {
+		if err := refs.PackRefs(true, true); err != nil {
+			return err
+		}
+	}
+	written, err := gc.Repack(repackOpts)
+	if err != nil {
+		return err
+	}
+	if !opts.quiet && written != nil {
+		reportPack(written)
+	}
+	return gc.Prune(&gc.PruneOptions{Expire: expire})
+}
@@ -3,41 +3,48 @@ package cmd
 import (
 	"flag"
 	"fmt"
-	"log"
 
 	"github.com/tsoud/GoTGit.git/gitobj"
 )
 
-func SetupHashObjectCmd() (*flag.FlagSet, *bool, *string) {
-	hashObjCmd := flag.NewFlagSet("hash-object", flag.ExitOnError)
+const HashObjectUsageMsg = "usage: hash-object [-w] [-t <type>] <file>...\n"
+
+type HashObjectOptions struct {
+	write   bool
+	objType string
+}
 
-	var write bool
-	hashObjCmd.BoolVar(&write, "w", false, "Actually write the object into the object database.")
+func SetupHashObjectCmd() (*flag.FlagSet, *HashObjectOptions) {
+	hashObjCmd := flag.NewFlagSet("hash-object", flag.ExitOnError)
+	opts := &HashObjectOptions{}
 
-	var objType string
-	hashObjCmd.StringVar(&objType, "t", "blob",
+	hashObjCmd.BoolVar(&opts.write, "w", false, "Actually write the object into the object database.")
+	hashObjCmd.StringVar(&opts.objType, "t", "blob",
 		"Specify the type of object to be created (default: \"blob\"). "+
 			"Possible values are `commit`, `tree`, `blob`, and `tag`.")
 
-	return hashObjCmd, &write, &objType
+	return hashObjCmd, opts
 }
 
 // TODO: Add functionality for handling non-blob types
-func HashObjectCmdHandler(write *bool, objType *string, file string) {
-	if *objType != "blob" {
-		log.Fatal("`hash-object` command only handles blob objects at this time")
+func HashObjectCmdHandler(files []string, opts *HashObjectOptions) error {
+	if opts.objType != "blob" {
+		return fmt.Errorf("`hash-object` command only handles blob objects at this time")
 	}
 
-	gitObj, err := gitobj.HashBlob(file)
-	if err != nil {
-		log.Fatal(err)
-	}
+	for _, file := range files {
+		gitObj, err := gitobj.HashBlob(file)
+		if err != nil {
+			return err
+		}
 
-	fmt.Println(gitObj.Hash)
+		fmt.Println(gitObj.Hash)
 
-	if *write {
-		if err := gitObj.Write(); err != nil {
-			log.Fatal(err)
+		if opts.write {
+			if err := gitObj.Write(); err != nil {
+				return err
+			}
 		}
 	}
+	return nil
 }
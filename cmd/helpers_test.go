@@ -0,0 +1,129 @@
+package cmd
+
+import (
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/tsoud/GoTGit.git/gitobj"
+	"github.com/tsoud/GoTGit.git/index"
+	"github.com/tsoud/GoTGit.git/internal/testutil"
+	"github.com/tsoud/GoTGit.git/refs"
+	"github.com/tsoud/GoTGit.git/worktree"
+)
+
+func initWorkRepo(t *testing.T) {
+	// Run the test from a scratch repository with a working tree, committing as
+	// "Test <test@example.com>" and with an editor that leaves files as they are.
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("the editor and exec commands run sh")
+	}
+	testutil.InitRepo(t)
+	testutil.IsolateConfig(t)
+	t.Setenv("GIT_DIR", "")
+	gitDir := gitobj.GitDir
+	t.Cleanup(func() { gitobj.SetGitDir(gitDir) })
+	t.Setenv("GIT_EDITOR", ":")
+	t.Setenv("GIT_SEQUENCE_EDITOR", "")
+	testutil.WriteFiles(t, gitobj.GitDir, map[string]string{
+		"config": "[user]\n\tname = Test\n\temail = test@example.com\n",
+	})
+}
+
+func gotgit(t *testing.T, args ...string) int {
+	// Run a command line, failing the test on an error. Returns the exit status.
+	t.Helper()
+	status, err := Run(args)
+	if err != nil {
+		t.Fatalf("gotgit %s: %v", strings.Join(args, " "), err)
+	}
+	return status
+}
+
+func commitFiles(t *testing.T, message string, files map[string]string, parents ...string) string {
+	// Store a commit whose tree holds exactly `files`.
+	t.Helper()
+	return testutil.WriteCommit(t, testutil.WriteTree(t, files), message, parents...)
+}
+
+func checkoutBranch(t *testing.T, branch, commitHash string) {
+	// Point `branch` at a commit and check it out, discarding any local changes.
+	t.Helper()
+	if err := refs.Update("refs/heads/"+branch, commitHash, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := refs.SetSymbolic(refs.HEAD, "refs/heads/"+branch, ""); err != nil {
+		t.Fatal(err)
+	}
+	gotgit(t, "reset", "-q", "--hard")
+}
+
+func stageFiles(t *testing.T, files map[string]string) {
+	// Write files to the working tree and add them to the index.
+	t.Helper()
+	testutil.WriteFiles(t, ".", files)
+	idx, err := index.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, contents := range files {
+		entry, err := worktree.NewEntry(name, testutil.WriteObject(t, "blob", contents), "100644")
+		if err != nil {
+			t.Fatal(err)
+		}
+		idx.Add(entry)
+	}
+	if err := idx.Write(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func history(t *testing.T, rev string) []string {
+	// List the subjects of the first-parent history of `rev`, newest first.
+	t.Helper()
+	hash, err := refs.ResolveCommit(rev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var subjects []string
+	for hash != "" {
+		commit, err := gitobj.ReadCommit(hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		subjects = append(subjects, commit.Subject())
+		hash = ""
+		if len(commit.Parents) > 0 {
+			hash = commit.Parents[0]
+		}
+	}
+	return subjects
+}
+
+func checkFiles(t *testing.T, files map[string]string) {
+	// Check the contents of files in the working tree; "" means the file is missing.
+	t.Helper()
+	for name, want := range files {
+		contents, err := os.ReadFile(name)
+		if got := string(contents); got != want || want == "" && !os.IsNotExist(err) {
+			t.Errorf("Wanted %s to contain %q, got %q (%v)", name, want, got, err)
+		}
+	}
+}
+
+func showFile(t *testing.T, rev string) string {
+	// Return the contents of the blob a `<rev>:<path>` revision names, or "" if
+	// there is no such file.
+	t.Helper()
+	hash, err := refs.ResolveRevision(rev)
+	if err != nil {
+		return ""
+	}
+	blob, err := gitobj.ReadGitObj(hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(blob.Content)
+}
@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/tsoud/GoTGit.git/gitobj"
+)
+
+const IndexPackUsageMsg = "usage: index-pack [-o <index-file>] <pack-file>\n" +
+	"   or: index-pack --stdin [--fix-thin]\n"
+
+type IndexPackOptions struct {
+	stdin     bool
+	fixThin   bool
+	indexFile string
+}
+
+func SetupIndexPackCmd() (*flag.FlagSet, *IndexPackOptions) {
+	indexPackCmd := flag.NewFlagSet("index-pack", flag.ExitOnError)
+	opts := &IndexPackOptions{}
+
+	indexPackCmd.BoolVar(&opts.stdin, "stdin", false, "Read the pack from standard input and store "+
+		"it in the repository with its index.")
+	indexPackCmd.BoolVar(&opts.fixThin, "fix-thin", false, "With `--stdin`, accept deltas on objects "+
+		"that are only in the repository, adding those objects to the pack.")
+	indexPackCmd.StringVar(&opts.indexFile, "o", "", "Write the index to this file instead of next "+
+		"to the pack.")
+
+	return indexPackCmd, opts
+}
+
+func IndexPackCmdHandler(args []string, opts *IndexPackOptions) error {
+	// Build the index of a pack file, or store a pack read from stdin, and
+	// print the pack's checksum.
+	if opts.fixThin && !opts.stdin {
+		return errors.New("--fix-thin cannot be used without --stdin")
+	}
+	if opts.stdin {
+		if len(args) > 0 || opts.indexFile != "" {
+			return fmt.Errorf("a pack read from stdin is always stored in the repository\n%s", IndexPackUsageMsg)
+		}
+		received, err := gitobj.ReceivePack(os.Stdin, path.Join(gitobj.GitObjectDir, "pack"), opts.fixThin)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("pack\t%s\n", received.Checksum)
+		return nil
+	}
+
+	if len(args) != 1 {
+		return fmt.Errorf("expected one pack file\n%s", IndexPackUsageMsg)
+	}
+	packFile, indexFile := args[0], prefixPath(opts.indexFile)
+	if indexFile == "" {
+		base, isPack := strings.CutSuffix(packFile, ".pack")
+		if !isPack {
+			return fmt.Errorf("packfile name '%s' does not end with '.pack'", packFile)
+		}
+		indexFile = base + ".idx"
+	}
+	sum, err := gitobj.IndexPackFile(packFile, indexFile)
+	if err != nil {
+		return err
+	}
+	fmt.Println(sum)
+	return nil
+}
@@ -1,37 +1,532 @@
 package cmd
 
 import (
+	"errors"
 	"flag"
 	"fmt"
-	"log"
+	"io/fs"
 	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/tsoud/GoTGit.git/config"
+	"github.com/tsoud/GoTGit.git/gitobj"
+	"github.com/tsoud/GoTGit.git/refs"
 )
 
-func SetupInitCommand() (*flag.FlagSet, *bool) {
+const InitUsageMsg = "usage: init [-q | --quiet] [--bare] [--template=<template-directory>]\n" +
+	"            [--separate-git-dir <git-dir>] [--object-format=<format>]\n" +
+	"            [-b <branch-name> | --initial-branch=<branch-name>]\n" +
+	"            [--shared[=<permissions>]] [<directory>]\n"
+
+// defaultTemplate is what a repository starts with when no template directory
+// is given, as with git's default templates minus the sample hooks.
+var defaultTemplate = map[string]string{
+	"description": "Unnamed repository; edit this file 'description' to name the repository.\n",
+	"info/exclude": "# git ls-files --others --exclude-from=.git/info/exclude\n" +
+		"# Lines that start with '#' are comments.\n" +
+		"# For a project mostly in C, the following would be a good set of\n" +
+		"# exclude patterns (uncomment them if you want to use them):\n" +
+		"# *.[oa]\n" +
+		"# *~\n",
+	"hooks/": "",
+}
+
+type InitOptions struct {
+	quiet          bool
+	bare           bool
+	objectFormat   string
+	initialBranch  string
+	template       stringList
+	separateGitDir string
+	shared         optionalValue
+}
+
+func SetupInitCommand() (*flag.FlagSet, *InitOptions) {
 	initCmd := flag.NewFlagSet("init", flag.ExitOnError)
+	opts := &InitOptions{}
 
-	var quiet bool
 	usage := "Only print error and warning messages; all other output will be suppressed."
 	defaultVal := false
-	initCmd.BoolVar(&quiet, "quiet", defaultVal, usage)
-	initCmd.BoolVar(&quiet, "q", defaultVal, "(shorthand ver.) "+usage)
+	initCmd.BoolVar(&opts.quiet, "quiet", defaultVal, usage)
+	initCmd.BoolVar(&opts.quiet, "q", defaultVal, "(shorthand ver.) "+usage)
+	initCmd.BoolVar(&opts.bare, "bare", false, "Create a bare repository, with no working tree: the "+
+		"directory itself is the git directory.")
+	initCmd.StringVar(&opts.objectFormat, "object-format", "", "Specify the hash algorithm objects are "+
+		"named with: `sha1` (the default) or `sha256`.")
+	usage = "Name the initial branch `branch-name` instead of `init.defaultBranch` or \"master\"."
+	initCmd.StringVar(&opts.initialBranch, "initial-branch", "", usage)
+	initCmd.StringVar(&opts.initialBranch, "b", "", "(shorthand ver.) "+usage)
+	initCmd.Var(&opts.template, "template", "Copy the files in `template-directory` into the new "+
+		"git directory, or none if it is empty.")
+	initCmd.StringVar(&opts.separateGitDir, "separate-git-dir", "", "Keep the git directory in `git-dir`, "+
+		"leaving a gitfile pointing to it in the working tree.")
+	initCmd.Var(&opts.shared, "shared", "Share the repository with the group (`group`, the default), "+
+		"everyone (`all`) or with the given octal file mode, e.g. `--shared=0640`.")
+
+	return initCmd, opts
+}
+
+// workTreeTop is the top of the working tree LoadGitDir found the repository
+// in, when that is above the current directory, and pathPrefix is the way
+// from there back down to the current directory, ending in a slash.
+var workTreeTop, pathPrefix string
+
+func LoadGitDir() error {
+	// Find the repository: the one GIT_DIR (or `--git-dir`) names, else search
+	// the current directory and then its parents for a `.git` directory, a
+	// gitfile `init --separate-git-dir` leaves in its place, or a bare
+	// repository.
+	workTreeTop, pathPrefix = "", ""
+	if dir := os.Getenv("GIT_DIR"); dir != "" {
+		gitobj.SetGitDir(dir)
+		return nil
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("could not get the current directory: %w", err)
+	}
+	for dir := wd; ; dir = filepath.Dir(dir) {
+		gitDir, err := findGitDir(dir)
+		if err != nil {
+			return err
+		}
+		if gitDir == "" && isBareRepository(dir) {
+			gitDir = dir
+		}
+		if gitDir == "" && filepath.Dir(dir) != dir {
+			continue
+		}
+		switch {
+		case gitDir == "":
+			gitDir = gitobj.DefaultGitDir
+		case dir == wd:
+			if rel, err := filepath.Rel(wd, gitDir); err == nil {
+				gitDir = rel
+			}
+		case gitDir != dir:
+			// Commands change to the top of the working tree.
+			rel, err := filepath.Rel(dir, wd)
+			if err != nil {
+				return err
+			}
+			workTreeTop, pathPrefix = dir, filepath.ToSlash(rel)+"/"
+		}
+		gitobj.SetGitDir(filepath.ToSlash(gitDir))
+		return nil
+	}
+}
+
+func findGitDir(dir string) (string, error) {
+	// Return the git directory of a working tree whose top is `dir`, following
+	// a gitfile, or "" if there is none.
+	gitDir := filepath.Join(dir, gitobj.DefaultGitDir)
+	info, err := os.Stat(gitDir)
+	switch {
+	case os.IsNotExist(err):
+		return "", nil
+	case err != nil:
+		return "", fmt.Errorf("could not read %s: %w", gitDir, err)
+	case info.IsDir():
+		return gitDir, nil
+	}
+	return readGitFile(gitDir)
+}
+
+func enterWorkTree() error {
+	// Commands run from the top of the working tree, as the index names files
+	// from there.
+	if workTreeTop == "" {
+		return nil
+	}
+	if err := os.Chdir(workTreeTop); err != nil {
+		return fmt.Errorf("cannot change to '%s': %w", workTreeTop, err)
+	}
+	return nil
+}
+
+func prefixPath(file string) string {
+	// Name a path given on the command line, which is relative to the directory
+	// gotgit was started in, from the top of the working tree.
+	if pathPrefix == "" || file == "" || filepath.IsAbs(file) {
+		return file
+	}
+	return filepath.ToSlash(filepath.Clean(pathPrefix + file))
+}
+
+func prefixPaths(files []string) []string {
+	prefixed := make([]string, len(files))
+	for i, file := range files {
+		prefixed[i] = prefixPath(file)
+	}
+	return prefixed
+}
+
+func readGitFile(file string) (string, error) {
+	// Read the git directory a gitfile ("gitdir: <path>") points to.
+	contents, err := os.ReadFile(file)
+	if err != nil {
+		return "", fmt.Errorf("could not read gitfile %s: %w", file, err)
+	}
+	dir, ok := strings.CutPrefix(strings.TrimSpace(string(contents)), "gitdir: ")
+	if !ok || dir == "" {
+		return "", fmt.Errorf("invalid gitfile format: %s", file)
+	}
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(filepath.Dir(file), dir)
+	}
+	return dir, nil
+}
+
+func isBareRepository(dir string) bool {
+	// A bare repository has HEAD, objects and refs at the top, and says so
+	// with `core.bare`.
+	for _, name := range []string{"HEAD", "objects", "refs"} {
+		if _, err := os.Stat(path.Join(dir, name)); err != nil {
+			return false
+		}
+	}
+	cfg, err := config.LoadFile(path.Join(dir, "config"))
+	return err == nil && cfg.GetBool("core.bare", false)
+}
+
+func LoadObjectFormat() error {
+	// Use the hash algorithm the repository config names, if any.
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	if name, ok := cfg.Get("extensions.objectformat"); ok {
+		algo, err := gitobj.LookupHashAlgorithm(name)
+		if err != nil {
+			return err
+		}
+		gitobj.ObjectFormat = algo
+	}
+	return nil
+}
+
+func LoadSharedRepository() error {
+	// Give the files commands create in the git directory the permissions
+	// `core.sharedRepository` asks for.
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	gitobj.SharedRepository = gitobj.SharedPerm{}
+	if value, ok := cfg.Get("core.sharedrepository"); ok {
+		shared, err := gitobj.ParseSharedPerm(value)
+		if err != nil {
+			return err
+		}
+		gitobj.SharedRepository = shared
+	}
+	return nil
+}
+
+func adjustSharedPerms(root string) error {
+	// Give everything under `root` the shared permissions.
+	return filepath.WalkDir(root, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		return gitobj.AdjustSharedPerm(file)
+	})
+}
+
+func copyTemplate(templateDir, gitDir string) error {
+	// Copy the files of a template directory into the git directory, leaving
+	// alone any that already exist.
+	if info, err := os.Stat(templateDir); err != nil || !info.IsDir() {
+		fmt.Fprintf(os.Stderr, "warning: templates not found in %s\n", templateDir)
+		return nil
+	}
+	err := filepath.WalkDir(templateDir, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(templateDir, file)
+		if err != nil {
+			return err
+		}
+		dest := filepath.Join(gitDir, rel)
+		if entry.IsDir() {
+			return os.MkdirAll(dest, 0755)
+		}
+		if _, err := os.Lstat(dest); err == nil {
+			return nil
+		}
+		if entry.Type()&fs.ModeSymlink != 0 {
+			target, err := os.Readlink(file)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(target, dest)
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		contents, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(dest, contents, info.Mode().Perm())
+	})
+	if err != nil {
+		return fmt.Errorf("could not copy template: %w", err)
+	}
+	return nil
+}
+
+func writeDefaultTemplate(gitDir string) error {
+	for name, contents := range defaultTemplate {
+		dest := filepath.Join(gitDir, name)
+		if strings.HasSuffix(name, "/") {
+			if err := os.MkdirAll(dest, 0755); err != nil {
+				return fmt.Errorf("could not copy template: %w", err)
+			}
+			continue
+		}
+		if _, err := os.Lstat(dest); err == nil {
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+			return fmt.Errorf("could not copy template: %w", err)
+		}
+		if err := os.WriteFile(dest, []byte(contents), 0644); err != nil {
+			return fmt.Errorf("could not copy template: %w", err)
+		}
+	}
+	return nil
+}
 
-	return initCmd, &quiet
+func probeFileMode(file string) bool {
+	// Check whether the filesystem keeps the executable bit, which is what
+	// `core.filemode` records.
+	info, err := os.Lstat(file)
+	if err != nil {
+		return false
+	}
+	if err := os.Chmod(file, info.Mode().Perm()^0100); err != nil {
+		return false
+	}
+	changed, err := os.Lstat(file)
+	os.Chmod(file, info.Mode().Perm())
+	return err == nil && changed.Mode() != info.Mode()
 }
 
-func InitCmdHandler(quiet *bool) {
-	for _, dir := range []string{".git", ".git/objects", ".git/refs"} {
-		if err := os.MkdirAll(dir, 0755); err != nil {
-			log.Printf("Error creating directory: %s\n", err)
+func initGitDir(workDir string, opts *InitOptions) (string, error) {
+	// Work out the git directory to initialize. With `--separate-git-dir`, an
+	// existing git directory is moved there.
+	if opts.bare {
+		return workDir, nil
+	}
+	gitDir := filepath.Join(workDir, gitobj.DefaultGitDir)
+	if dir := os.Getenv("GIT_DIR"); dir != "" {
+		gitDir = dir
+	}
+	if info, err := os.Stat(gitDir); err == nil && !info.IsDir() {
+		if gitDir, err = readGitFile(gitDir); err != nil {
+			return "", err
+		}
+	}
+	if opts.separateGitDir == "" {
+		return gitDir, nil
+	}
+
+	separateGitDir, err := filepath.Abs(opts.separateGitDir)
+	if err != nil {
+		return "", err
+	}
+	if existing, err := filepath.Abs(gitDir); err == nil && existing != separateGitDir {
+		if _, err := os.Stat(path.Join(gitDir, "HEAD")); err == nil {
+			if err := os.Rename(gitDir, separateGitDir); err != nil {
+				return "", fmt.Errorf("could not move %s to %s: %w", gitDir, separateGitDir, err)
+			}
+		}
+	}
+	return separateGitDir, nil
+}
+
+func InitCmdHandler(args []string, opts *InitOptions) error {
+	// Create a repository in the directory given, or the current one, or
+	// re-initialize an existing one without losing anything in it. The git
+	// directory gets the files of the template, HEAD pointing to the initial
+	// branch, and a config describing the repository; with `--bare` it is the
+	// directory itself, and with `--separate-git-dir` it is kept elsewhere,
+	// pointed to by a gitfile.
+	if len(args) > 1 {
+		return fmt.Errorf("too many arguments\n%s", InitUsageMsg)
+	}
+	if opts.bare && opts.separateGitDir != "" {
+		return errors.New("options '--separate-git-dir' and '--bare' cannot be used together")
+	}
+	userCfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	branch := opts.initialBranch
+	if branch == "" {
+		branch, _ = userCfg.Get("init.defaultBranch")
+	}
+	if branch == "" {
+		branch = "master"
+	}
+	if refs.ValidateName("refs/heads/"+branch) != nil {
+		return fmt.Errorf("invalid initial branch name: '%s'", branch)
+	}
+	var shared gitobj.SharedPerm
+	if opts.shared.set {
+		if shared, err = gitobj.ParseSharedPerm(opts.shared.value); err != nil {
+			return err
+		}
+	}
+
+	workDir := "."
+	if len(args) == 1 {
+		workDir = args[0]
+	}
+	if err := os.MkdirAll(workDir, 0755); err != nil {
+		return fmt.Errorf("could not create directory %s: %w", workDir, err)
+	}
+	gitDir, err := initGitDir(workDir, opts)
+	if err != nil {
+		return err
+	}
+	_, err = os.Stat(filepath.Join(gitDir, "HEAD"))
+	reinit := err == nil
+
+	// An existing repository keeps its object format.
+	repoCfg, err := config.LoadFile(filepath.Join(gitDir, "config"))
+	if err != nil {
+		return err
+	}
+	algo := gitobj.SHA1
+	if name, ok := repoCfg.Get("extensions.objectformat"); ok && reinit {
+		if algo, err = gitobj.LookupHashAlgorithm(name); err != nil {
+			return err
+		}
+	}
+	format := opts.objectFormat
+	if format == "" && !reinit {
+		format = os.Getenv("GIT_DEFAULT_HASH")
+	}
+	if format != "" {
+		requested, err := gitobj.LookupHashAlgorithm(format)
+		if err != nil {
+			return err
+		}
+		if reinit && requested != algo {
+			return fmt.Errorf("attempt to reinitialize repository with different hash")
+		}
+		algo = requested
+	}
+	if !opts.shared.set && reinit {
+		if value, ok := repoCfg.Get("core.sharedrepository"); ok {
+			if shared, err = gitobj.ParseSharedPerm(value); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := os.MkdirAll(gitDir, 0755); err != nil {
+		return fmt.Errorf("could not create directory %s: %w", gitDir, err)
+	}
+	template, hasTemplate := "", false
+	if len(opts.template) > 0 {
+		template, hasTemplate = opts.template[len(opts.template)-1], true
+	} else if dir, ok := os.LookupEnv("GIT_TEMPLATE_DIR"); ok {
+		template, hasTemplate = dir, true
+	} else if dir, ok := userCfg.Get("init.templateDir"); ok {
+		if template, err = config.ExpandPath(dir); err != nil {
+			return err
+		}
+		hasTemplate = true
+	}
+	switch {
+	case !hasTemplate:
+		err = writeDefaultTemplate(gitDir)
+	case template != "":
+		err = copyTemplate(template, gitDir)
+	}
+	if err != nil {
+		return err
+	}
+	for _, dir := range []string{"refs/heads", "refs/tags", "objects/info", "objects/pack"} {
+		if err := os.MkdirAll(filepath.Join(gitDir, dir), 0755); err != nil {
+			return fmt.Errorf("could not create directory %s: %w", dir, err)
 		}
 	}
 
-	headFileContents := []byte("ref: refs/heads/master\n")
-	if err := os.WriteFile(".git/HEAD", headFileContents, 0644); err != nil {
-		log.Printf("Error writing file: %s\n", err)
+	if !reinit {
+		contents := []byte("ref: refs/heads/" + branch + "\n")
+		if err := os.WriteFile(filepath.Join(gitDir, "HEAD"), contents, 0644); err != nil {
+			return fmt.Errorf("could not write HEAD: %w", err)
+		}
+	} else if opts.initialBranch != "" {
+		fmt.Fprintf(os.Stderr, "warning: re-init: ignored --initial-branch=%s\n", opts.initialBranch)
 	}
 
-	if !*quiet {
-		fmt.Println("Initialized git directory")
+	// Extensions are only honored by repository format version 1.
+	version := "0"
+	if algo != gitobj.SHA1 {
+		version = "1"
+	}
+	if err := repoCfg.Set("core.repositoryformatversion", version); err != nil {
+		return err
+	}
+	if err := repoCfg.Set("core.filemode", strconv.FormatBool(probeFileMode(repoCfg.Path))); err != nil {
+		return err
+	}
+	if err := repoCfg.Set("core.bare", strconv.FormatBool(opts.bare)); err != nil {
+		return err
+	}
+	if _, ok := repoCfg.Get("core.logallrefupdates"); !ok && !opts.bare {
+		if err := repoCfg.Set("core.logallrefupdates", "true"); err != nil {
+			return err
+		}
+	}
+	if algo != gitobj.SHA1 {
+		if err := repoCfg.Set("extensions.objectformat", algo.Name); err != nil {
+			return err
+		}
+	}
+	if opts.shared.set && shared.Mode != 0 {
+		if err := repoCfg.Set("core.sharedrepository", shared.String()); err != nil {
+			return err
+		}
+		if err := repoCfg.Set("receive.denyNonFastforwards", "true"); err != nil {
+			return err
+		}
+	}
+	gitobj.SharedRepository = shared
+	if err := adjustSharedPerms(gitDir); err != nil {
+		return err
+	}
+
+	if opts.separateGitDir != "" {
+		gitFile := filepath.Join(workDir, gitobj.DefaultGitDir)
+		if err := os.WriteFile(gitFile, []byte("gitdir: "+filepath.ToSlash(gitDir)+"\n"), 0644); err != nil {
+			return fmt.Errorf("could not write gitfile: %w", err)
+		}
+	}
+
+	if !opts.quiet {
+		absGitDir, err := filepath.Abs(gitDir)
+		if err != nil {
+			return err
+		}
+		initialized, kind := "Initialized empty", ""
+		if reinit {
+			initialized = "Reinitialized existing"
+		}
+		if shared.Mode != 0 {
+			kind = "shared "
+		}
+		fmt.Printf("%s %sGit repository in %s/\n", initialized, kind, filepath.ToSlash(absGitDir))
 	}
+	return nil
 }
@@ -0,0 +1,316 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/tsoud/GoTGit.git/config"
+	"github.com/tsoud/GoTGit.git/gitobj"
+	"github.com/tsoud/GoTGit.git/internal/testutil"
+)
+
+func TestLoadGitDir(t *testing.T) {
+	testutil.ChdirTemp(t)
+	top, _ := os.Getwd()
+	gitDir := gitobj.GitDir
+	t.Cleanup(func() { gitobj.SetGitDir(gitDir) })
+	t.Setenv("GIT_DIR", "")
+	testutil.WriteFiles(t, top, map[string]string{
+		"work/.git/HEAD":              "ref: refs/heads/main\n",
+		"work/sub/dir/file":           "",
+		"linked/.git":                 "gitdir: ../elsewhere\n",
+		"linked/sub/file":             "",
+		"elsewhere/HEAD":              "ref: refs/heads/main\n",
+		"bare.git/HEAD":               "ref: refs/heads/main\n",
+		"bare.git/config":             "[core]\n\tbare = true\n",
+		"bare.git/objects/info/packs": "",
+		"bare.git/refs/heads/main":    "",
+		"plain/file":                  "",
+	})
+
+	tests := []struct {
+		dir, gitDir, top, prefix string
+	}{
+		{dir: "work", gitDir: ".git"},
+		{dir: "work/sub/dir", gitDir: top + "/work/.git", top: top + "/work", prefix: "sub/dir/"},
+		{dir: "linked", gitDir: "../elsewhere"},
+		{dir: "linked/sub", gitDir: top + "/elsewhere", top: top + "/linked", prefix: "sub/"},
+		{dir: "bare.git", gitDir: "."},
+		{dir: "bare.git/refs/heads", gitDir: top + "/bare.git"},
+		{dir: "plain", gitDir: ".git"},
+	}
+	for _, test := range tests {
+		t.Run(test.dir, func(t *testing.T) {
+			if err := os.Chdir(filepath.Join(top, test.dir)); err != nil {
+				t.Fatal(err)
+			}
+			if err := LoadGitDir(); err != nil {
+				t.Fatal(err)
+			}
+			if gitobj.GitDir != filepath.ToSlash(test.gitDir) || workTreeTop != test.top || pathPrefix != test.prefix {
+				t.Errorf("Wanted the git dir %q, top %q and prefix %q, got %q, %q and %q",
+					test.gitDir, test.top, test.prefix, gitobj.GitDir, workTreeTop, pathPrefix)
+			}
+		})
+	}
+
+	// GIT_DIR is used as it is.
+	t.Setenv("GIT_DIR", "../bare.git")
+	if err := LoadGitDir(); err != nil || gitobj.GitDir != "../bare.git" || workTreeTop != "" {
+		t.Errorf("Wanted GIT_DIR used, got %q (%v)", gitobj.GitDir, err)
+	}
+}
+
+func TestSubdirectory(t *testing.T) {
+	// Commands started in a subdirectory use the repository above it, and
+	// take paths relative to where they were started.
+	testutil.ChdirTemp(t)
+	top, _ := os.Getwd()
+	testutil.IsolateConfig(t)
+	t.Setenv("GIT_DIR", "")
+	gitDir := gitobj.GitDir
+	t.Cleanup(func() { gitobj.SetGitDir(gitDir) })
+	if status := gotgit(t, "init", "-q"); status != 0 {
+		t.Fatalf("Wanted init to succeed, got status %d", status)
+	}
+	if _, err := os.Stat(filepath.Join(top, ".git", "HEAD")); err != nil {
+		t.Fatalf("Wanted init to create .git, got %v", err)
+	}
+
+	testutil.WriteFiles(t, top, map[string]string{"sub/file": "contents\n"})
+	if err := os.Chdir(filepath.Join(top, "sub")); err != nil {
+		t.Fatal(err)
+	}
+	gotgit(t, "hash-object", "-w", "file")
+	blob, err := gitobj.HashObject("blob", []byte("contents\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(top, ".git", "objects", blob.Hash[:2], blob.Hash[2:])); err != nil {
+		t.Errorf("Wanted the object written to the repository above, got %v", err)
+	}
+	if wd, _ := os.Getwd(); filepath.Base(wd) == "sub" {
+		t.Errorf("Wanted the command run from the top of the working tree, got %s", wd)
+	}
+}
+
+// initConfig reads the config of a repository made by init.
+func initConfig(t *testing.T, gitDir string) map[string]string {
+	t.Helper()
+	cfg, err := config.LoadFile(filepath.Join(gitDir, "config"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := make(map[string]string)
+	for _, key := range []string{"core.bare", "core.logallrefupdates", "core.repositoryformatversion",
+		"core.sharedrepository", "extensions.objectformat"} {
+		values[key], _ = cfg.Get(key)
+	}
+	return values
+}
+
+func TestInit(t *testing.T) {
+	tests := []struct {
+		args []string
+		// gitDir is where the repository is made and files are some of the
+		// files it has; "" means the file is missing.
+		gitDir string
+		files  map[string]string
+		config map[string]string
+	}{
+		{args: []string{"init"}, gitDir: ".git",
+			files: map[string]string{"HEAD": "ref: refs/heads/master\n", "description": defaultTemplate["description"],
+				"info/exclude": defaultTemplate["info/exclude"], "hooks/pre-commit": ""},
+			config: map[string]string{"core.bare": "false", "core.logallrefupdates": "true",
+				"core.repositoryformatversion": "0"}},
+		{args: []string{"init", "-b", "main", "work"}, gitDir: "work/.git",
+			files: map[string]string{"HEAD": "ref: refs/heads/main\n"}},
+		{args: []string{"-c", "init.defaultBranch=trunk", "init"}, gitDir: ".git",
+			files: map[string]string{"HEAD": "ref: refs/heads/trunk\n"}},
+		{args: []string{"init", "--bare", "repo.git"}, gitDir: "repo.git",
+			files:  map[string]string{"HEAD": "ref: refs/heads/master\n"},
+			config: map[string]string{"core.bare": "true", "core.logallrefupdates": ""}},
+		{args: []string{"init", "--template=template"}, gitDir: ".git",
+			files: map[string]string{"hooks/pre-commit": "exit 0\n", "description": ""}},
+		{args: []string{"init", "--template="}, gitDir: ".git",
+			files: map[string]string{"HEAD": "ref: refs/heads/master\n", "description": "", "info/exclude": ""}},
+		{args: []string{"init", "--object-format=sha256"}, gitDir: ".git",
+			config: map[string]string{"core.repositoryformatversion": "1", "extensions.objectformat": "sha256"}},
+		{args: []string{"init", "--shared"}, gitDir: ".git",
+			config: map[string]string{"core.sharedrepository": "1"}},
+		{args: []string{"init", "--shared=all"}, gitDir: ".git",
+			config: map[string]string{"core.sharedrepository": "2"}},
+		{args: []string{"init", "--shared=0640"}, gitDir: ".git",
+			config: map[string]string{"core.sharedrepository": "0640"}},
+		{args: []string{"init", "--shared=umask"}, gitDir: ".git",
+			config: map[string]string{"core.sharedrepository": ""}},
+	}
+	for _, test := range tests {
+		t.Run(strings.Join(test.args, " "), func(t *testing.T) {
+			initTestDir(t)
+			testutil.WriteFiles(t, "template", map[string]string{"hooks/pre-commit": "exit 0\n"})
+			gotgit(t, append(test.args, "-q")...)
+			for _, dir := range []string{"objects/info", "objects/pack", "refs/heads", "refs/tags"} {
+				if info, err := os.Stat(filepath.Join(test.gitDir, dir)); err != nil || !info.IsDir() {
+					t.Errorf("Wanted the directory %s, got %v", dir, err)
+				}
+			}
+			for name, want := range test.files {
+				contents, _ := os.ReadFile(filepath.Join(test.gitDir, name))
+				if string(contents) != want {
+					t.Errorf("Wanted %s to be %q, got %q", name, want, contents)
+				}
+			}
+			got := initConfig(t, test.gitDir)
+			for key, want := range test.config {
+				if got[key] != want {
+					t.Errorf("Wanted %s = %q, got %q", key, want, got[key])
+				}
+			}
+		})
+	}
+
+	initTestDir(t)
+	for _, test := range []struct {
+		args []string
+		err  string
+	}{
+		{[]string{"--bare", "--separate-git-dir=sep"}, "options '--separate-git-dir' and '--bare' cannot be used together"},
+		{[]string{"-b", "bad..name"}, "invalid initial branch name: 'bad..name'"},
+		{[]string{"--shared=0200"}, "problem with core.sharedRepository filemode value (0200)"},
+		{[]string{"--shared=nobody"}, "invalid value for --shared: nobody"},
+		{[]string{"--object-format=md5"}, "unknown object format \"md5\""},
+		{[]string{"a", "b"}, "too many arguments"},
+	} {
+		if _, err := Run(append([]string{"init", "-q"}, test.args...)); err == nil || !strings.HasPrefix(err.Error(), test.err) {
+			t.Errorf("Wanted init %q to fail with %q, got %v", test.args, test.err, err)
+		}
+	}
+}
+
+func initTestDir(t *testing.T) {
+	// Run init from an empty scratch directory, with no config but its own.
+	t.Helper()
+	testutil.ChdirTemp(t)
+	testutil.IsolateConfig(t)
+	t.Setenv("GIT_DIR", "")
+	t.Setenv("GIT_TEMPLATE_DIR", "")
+	os.Unsetenv("GIT_TEMPLATE_DIR")
+	t.Setenv("GIT_DEFAULT_HASH", "")
+	gitDir := gitobj.GitDir
+	t.Cleanup(func() {
+		gitobj.SetGitDir(gitDir)
+		gitobj.ObjectFormat = gitobj.SHA1
+		gitobj.SharedRepository = gitobj.SharedPerm{}
+	})
+}
+
+func TestInitSeparateGitDir(t *testing.T) {
+	initTestDir(t)
+	top, _ := os.Getwd()
+	gotgit(t, "init", "-q", "--separate-git-dir=sep", "work")
+	if got := testutil.ReadFile(t, "work/.git"); got != "gitdir: "+filepath.ToSlash(top)+"/sep\n" {
+		t.Errorf("Wanted a gitfile pointing to the separate git dir, got %q", got)
+	}
+	if got := testutil.ReadFile(t, "sep/HEAD"); got != "ref: refs/heads/master\n" {
+		t.Errorf("Wanted HEAD in the separate git dir, got %q", got)
+	}
+
+	// Re-initializing with another separate git dir moves the repository.
+	gotgit(t, "-C", "work", "init", "-q", "--separate-git-dir=../moved")
+	if _, err := os.Stat(filepath.Join(top, "sep")); !os.IsNotExist(err) {
+		t.Errorf("Wanted the git dir moved away, got %v", err)
+	}
+	if got := testutil.ReadFile(t, filepath.Join(top, "moved/HEAD")); got != "ref: refs/heads/master\n" {
+		t.Errorf("Wanted HEAD in the moved git dir, got %q", got)
+	}
+	if got := testutil.ReadFile(t, filepath.Join(top, "work/.git")); got != "gitdir: "+filepath.ToSlash(top)+"/moved\n" {
+		t.Errorf("Wanted the gitfile updated, got %q", got)
+	}
+}
+
+func TestReinit(t *testing.T) {
+	initTestDir(t)
+	gotgit(t, "init", "-q", "-b", "main", "--shared=group")
+	testutil.WriteFiles(t, ".git", map[string]string{"description": "mine\n", "refs/heads/main": "x\n"})
+
+	// Re-initializing keeps HEAD, refs, files and settings.
+	gotgit(t, "init", "-q", "-b", "other")
+	for name, want := range map[string]string{"HEAD": "ref: refs/heads/main\n", "description": "mine\n",
+		"refs/heads/main": "x\n"} {
+		if got := testutil.ReadFile(t, filepath.Join(".git", name)); got != want {
+			t.Errorf("Wanted %s kept as %q, got %q", name, want, got)
+		}
+	}
+	if got := initConfig(t, ".git")["core.sharedrepository"]; got != "1" {
+		t.Errorf("Wanted the shared setting kept, got %q", got)
+	}
+	if _, err := Run([]string{"init", "-q", "--object-format=sha256"}); err == nil ||
+		err.Error() != "attempt to reinitialize repository with different hash" {
+		t.Errorf("Wanted re-initializing with another hash to fail, got %v", err)
+	}
+}
+
+func TestSharedRepository(t *testing.T) {
+	// Files made after init get the shared permissions too.
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes are not kept on Windows")
+	}
+	tests := []struct {
+		shared string
+		// file and dir are the permission bits files and directories must
+		// have, and exact whether they must have only those.
+		file, dir os.FileMode
+		exact     bool
+	}{
+		{shared: "group", file: 0060, dir: 0070 | os.ModeSetgid},
+		{shared: "all", file: 0064, dir: 0075 | os.ModeSetgid},
+		{shared: "0640", file: 0640, dir: 0750 | os.ModeSetgid, exact: true},
+	}
+	for _, test := range tests {
+		t.Run(test.shared, func(t *testing.T) {
+			initTestDir(t)
+			gotgit(t, "init", "-q", "--shared="+test.shared)
+			testutil.WriteFiles(t, ".", map[string]string{"file": "contents\n"})
+			gotgit(t, "hash-object", "-w", "file")
+			blob, _ := gitobj.HashObject("blob", []byte("contents\n"))
+			commit := testutil.WriteCommit(t, testutil.WriteTree(t, map[string]string{"file": "contents\n"}), "first")
+			gotgit(t, "branch", "topic/one", commit)
+			gotgit(t, "read-tree", commit)
+			gotgit(t, "repack", "-a", "-q")
+
+			files := []string{".git/objects/" + blob.Hash[:2] + "/" + blob.Hash[2:], ".git/refs/heads/topic/one",
+				".git/logs/refs/heads/topic/one", ".git/index"}
+			packs, _ := filepath.Glob(".git/objects/pack/pack-*")
+			if len(packs) != 2 {
+				t.Fatalf("Wanted a pack and its index, got %q", packs)
+			}
+			for _, file := range append(files, packs...) {
+				info, err := os.Stat(file)
+				if err != nil {
+					t.Fatal(err)
+				}
+				want := test.file
+				if info.Mode()&0200 == 0 {
+					want &^= 0222
+				}
+				if got := info.Mode().Perm(); test.exact && got != want || !test.exact && got&want != want {
+					t.Errorf("Wanted %s to have the permissions %v, got %v", file, want, got)
+				}
+			}
+			for _, dir := range []string{".git/objects/" + blob.Hash[:2], ".git/refs/heads/topic", ".git/logs/refs/heads/topic"} {
+				info, err := os.Stat(dir)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := info.Mode() & (os.ModePerm | os.ModeSetgid); test.exact && got&^0007 != test.dir ||
+					!test.exact && got&test.dir != test.dir {
+					t.Errorf("Wanted %s to have the permissions %v, got %v", dir, test.dir, got)
+				}
+			}
+		})
+	}
+}
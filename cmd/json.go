@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+	"unicode/utf8"
+
+	"github.com/tsoud/GoTGit.git/gitobj"
+)
+
+// Commands given `--json` print one JSON document followed by a newline.
+
+type jsonSignature struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+	Date  string `json:"date"`
+}
+
+func writeJSON(w io.Writer, value any) error {
+	return json.NewEncoder(w).Encode(value)
+}
+
+func signatureJSON(sig gitobj.Signature) jsonSignature {
+	return jsonSignature{Name: sig.Name, Email: sig.Email, Date: sig.When.Format(time.RFC3339)}
+}
+
+func objectJSON(obj *gitobj.GitObject) (map[string]any, error) {
+	// Describe an object and its parsed contents: the entries of a tree, the
+	// headers and message of a commit or tag, or the contents of a blob, which
+	// are base64-encoded when they are not valid UTF-8.
+	fields := map[string]any{"hash": obj.Hash, "type": obj.Type, "size": obj.Size}
+
+	switch obj.Type {
+	case "tree":
+		entries, err := obj.TreeEntries()
+		if err != nil {
+			return nil, err
+		}
+		fields["entries"] = append([]gitobj.TreeEntry{}, entries...)
+	case "commit":
+		commit, err := gitobj.ParseCommit(obj.Hash, obj.Content)
+		if err != nil {
+			return nil, err
+		}
+		fields["tree"] = commit.Tree
+		fields["parents"] = append([]string{}, commit.Parents...)
+		fields["author"] = signatureJSON(commit.Author)
+		fields["committer"] = signatureJSON(commit.Committer)
+		fields["message"] = commit.Message
+	case "tag":
+		tag, err := gitobj.ParseTag(obj.Hash, obj.Content)
+		if err != nil {
+			return nil, err
+		}
+		fields["object"] = tag.Object
+		fields["object_type"] = tag.Type
+		fields["tag"] = tag.Name
+		if tag.HasTagger {
+			fields["tagger"] = signatureJSON(tag.Tagger)
+		}
+		fields["message"] = tag.Message
+	default:
+		if utf8.Valid(obj.Content) {
+			fields["content"] = string(obj.Content)
+		} else {
+			fields["content_base64"] = obj.Content
+		}
+	}
+
+	return fields, nil
+}
@@ -1,74 +1,313 @@
 package cmd
 
 import (
+	"bufio"
 	"flag"
 	"fmt"
-	"log"
+	"io"
 	"os"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
 
 	"github.com/tsoud/GoTGit.git/gitobj"
+	"github.com/tsoud/GoTGit.git/refs"
 )
 
-const LSTreeUsageMsg = "usage: ls-tree [--long | -l] | [--name-only] <tree-ish>\n"
+const LSTreeUsageMsg = "usage: ls-tree [-r] [-t] [-d] [-z] [--long | -l | --name-only | --object-only |\n" +
+	"               --format=<format> | --json] [--abbrev[=<n>]] [--full-name] <tree-ish> [<path>...]\n"
 
-func validLSTreeFlags() []string {
-	return []string{"name-only", "long", "l"}
+const (
+	lsTreeDefaultFormat = "%(objectmode) %(objecttype) %(objectname)%x09%(path)"
+	lsTreeLongFormat    = "%(objectmode) %(objecttype) %(objectname) %(objectsize:padded)%x09%(path)"
+)
+
+type LSTreeOptions struct {
+	recursive  bool
+	showTrees  bool
+	dirsOnly   bool
+	nulTerm    bool
+	long       bool
+	nameOnly   bool
+	objectOnly bool
+	abbrev     optionalValue
+	fullName   bool
+	format     string
+	json       bool
+}
+
+// lsTreeJSONEntry is an entry of `ls-tree --json` output. `Name` is the full
+// path, and `Size` is only set for blobs when listing with `--long`.
+type lsTreeJSONEntry struct {
+	gitobj.TreeEntry
+	Size *int `json:"size,omitempty"`
 }
 
-func SetupLSTreeCmd() *flag.FlagSet {
-	lsTreeCmd := flag.NewFlagSet("cat-file", flag.ExitOnError)
+func SetupLSTreeCmd() (*flag.FlagSet, *LSTreeOptions) {
+	lsTreeCmd := flag.NewFlagSet("ls-tree", flag.ExitOnError)
+	opts := &LSTreeOptions{}
 
-	var long bool
-	lsTreeCmd.BoolVar(&long, "long", false, "List object size of blob (file) entries.")
-	lsTreeCmd.BoolVar(&long, "l", false, "(shorthand ver.) List object size of blob (file) entries.")
-	var nameOnly bool
-	lsTreeCmd.BoolVar(&nameOnly, "name-only", false, "List only filenames "+
+	lsTreeCmd.BoolVar(&opts.recursive, "r", false, "Recurse into sub-trees.")
+	lsTreeCmd.BoolVar(&opts.showTrees, "t", false, "Show tree entries even when recursing into them.")
+	lsTreeCmd.BoolVar(&opts.dirsOnly, "d", false, "Show only tree entries, without recursing "+
+		"unless `-r` is given.")
+	lsTreeCmd.BoolVar(&opts.nulTerm, "z", false, "End each entry with a NUL byte instead of a newline.")
+	lsTreeCmd.BoolVar(&opts.long, "long", false, "List object size of blob (file) entries.")
+	lsTreeCmd.BoolVar(&opts.long, "l", false, "Same as `--long`.")
+	lsTreeCmd.BoolVar(&opts.nameOnly, "name-only", false, "List only filenames "+
 		"(instead of the \"long\" output), one per line.")
+	lsTreeCmd.BoolVar(&opts.nameOnly, "name-status", false, "Same as `--name-only`.")
+	lsTreeCmd.BoolVar(&opts.objectOnly, "object-only", false, "List only the object names, one per line.")
+	lsTreeCmd.Var(&opts.abbrev, "abbrev", "Abbreviate object names to <n> hex digits (default 7).")
+	lsTreeCmd.BoolVar(&opts.fullName, "full-name", false, "Show paths relative to the top of the working "+
+		"tree. As commands always run from the top, this is the default.")
+	lsTreeCmd.StringVar(&opts.format, "format", "", "Print each entry with a format of %(objectmode), "+
+		"%(objecttype), %(objectname), %(objectsize), %(objectsize:padded), %(path) and %xNN placeholders.")
+	lsTreeCmd.BoolVar(&opts.json, "json", false, "Print the entries as a JSON array, with sizes if "+
+		"`--long` is given.")
 
-	return lsTreeCmd
+	return lsTreeCmd, opts
 }
 
-func validateLSTreeFlags(fs *flag.FlagSet) error {
-	if fs.NFlag() > 1 {
-		return fmt.Errorf(
-			"`ls-tree` takes only one flag: `--name-only`, `--long`, or `-l`.\n%s", LSTreeUsageMsg)
+// lsTreeAtom matches the placeholders of an `ls-tree --format` string.
+var lsTreeAtom = regexp.MustCompile(`%(\([^)]*\)|x[0-9a-fA-F]{2}|%)`)
+
+var lsTreeAtoms = []string{"objectmode", "objecttype", "objectname", "objectsize", "objectsize:padded", "path"}
+
+func (opts *LSTreeOptions) entryFormat() (string, error) {
+	// Pick the format entries are printed in, making sure only one of the
+	// format-altering options was given.
+	formats := 0
+	for _, set := range []bool{opts.long, opts.nameOnly, opts.objectOnly} {
+		if set {
+			formats++
+		}
+	}
+	if opts.format != "" && formats > 0 {
+		return "", fmt.Errorf("--format can't be combined with other format-altering options\n%s", LSTreeUsageMsg)
+	}
+	if opts.json && (opts.format != "" || opts.nameOnly || opts.objectOnly || opts.nulTerm) {
+		return "", fmt.Errorf("--json can't be combined with --format, --name-only, --object-only or -z\n%s",
+			LSTreeUsageMsg)
+	}
+	if formats > 1 {
+		return "", fmt.Errorf("only one of --long, --name-only and --object-only may be given\n%s",
+			LSTreeUsageMsg)
 	}
 
-	return nil
+	switch {
+	case opts.format != "":
+		for _, atom := range lsTreeAtom.FindAllStringSubmatch(opts.format, -1) {
+			name, isAtom := strings.CutPrefix(atom[1], "(")
+			if isAtom && !slices.Contains(lsTreeAtoms, strings.TrimSuffix(name, ")")) {
+				return "", fmt.Errorf("bad ls-tree format: %s", atom[0])
+			}
+		}
+		return opts.format, nil
+	case opts.long:
+		return lsTreeLongFormat, nil
+	case opts.nameOnly:
+		return "%(path)", nil
+	case opts.objectOnly:
+		return "%(objectname)", nil
+	default:
+		return lsTreeDefaultFormat, nil
+	}
 }
 
-func lsTreeOption(fs *flag.FlagSet) (string, error) {
-	if err := validateLSTreeFlags(fs); err != nil {
-		return "", err
-	}
+// treeLister walks a tree the way `ls-tree` does. Paths name entries by exact
+// path or leading directory; a trailing slash lists a directory's contents.
+type treeLister struct {
+	opts      *LSTreeOptions
+	paths     []string
+	format    string
+	abbrevLen int
+	// quote quotes paths, unless entries are NUL-terminated.
+	quote   func(string) string
+	out     *bufio.Writer
+	entries []lsTreeJSONEntry
+}
+
+func LSTreeCmdHandler(args []string, opts *LSTreeOptions) error {
+	// List the contents of a tree object, optionally limited to some paths.
+	return listTree(os.Stdout, args, opts)
+}
 
-	if fs.NFlag() == 0 {
-		return "default", nil
+func listTree(out io.Writer, args []string, opts *LSTreeOptions) error {
+	if len(args) < 1 {
+		return fmt.Errorf("No tree-ish given! %s", LSTreeUsageMsg)
+	}
+	format, err := opts.entryFormat()
+	if err != nil {
+		return err
+	}
+	treeHash, err := refs.ResolveTree(args[0])
+	if err != nil {
+		return err
 	}
 
-	for _, flag := range validLSTreeFlags() {
-		if fs.Lookup(flag).Value.String() == "true" {
-			return flag, nil
+	lister := &treeLister{opts: opts, format: format, abbrevLen: gitobj.ObjectFormat.HexSize(), out: bufio.NewWriter(out)}
+	lister.quote = pathQuoter()
+	if opts.nulTerm {
+		lister.quote = func(name string) string { return name }
+	}
+	if opts.abbrev.set {
+		lister.abbrevLen = 7
+		if opts.abbrev.value != "" {
+			n, err := strconv.Atoi(opts.abbrev.value)
+			if err != nil {
+				return fmt.Errorf("invalid --abbrev value: %s", opts.abbrev.value)
+			}
+			lister.abbrevLen = min(max(n, 4), gitobj.ObjectFormat.HexSize())
+		}
+	}
+	for _, arg := range args[1:] {
+		cleaned := path.Clean(arg)
+		if strings.HasSuffix(arg, "/") && cleaned != "." {
+			cleaned += "/"
+		}
+		if cleaned == "." {
+			cleaned = ""
 		}
+		lister.paths = append(lister.paths, cleaned)
+	}
+	// With `-d`, recursing shows the trees it passes through.
+	if opts.dirsOnly && opts.recursive {
+		opts.showTrees = true
 	}
 
-	return "", fmt.Errorf("invalid option - %s", LSTreeUsageMsg)
+	defer lister.out.Flush()
+	if err := lister.walk(treeHash, ""); err != nil {
+		return err
+	}
+	if opts.json {
+		return writeJSON(lister.out, append([]lsTreeJSONEntry{}, lister.entries...))
+	}
+	return nil
 }
 
-func LSTreeCmdHandler(objHash string, fs *flag.FlagSet) {
-	fs.Parse(os.Args[2:])
+func (lister *treeLister) interesting(fullPath string, isTree bool) bool {
+	// Report whether an entry is named by a path, lies under one, or is a tree
+	// leading to one.
+	if len(lister.paths) == 0 {
+		return true
+	}
+	for _, spec := range lister.paths {
+		dir := strings.TrimSuffix(spec, "/")
+		if dir == "" || fullPath == dir || strings.HasPrefix(fullPath, dir+"/") {
+			return true
+		}
+		if isTree && strings.HasPrefix(spec, fullPath+"/") {
+			return true
+		}
+	}
+	return false
+}
 
-	outputType, err := lsTreeOption(fs)
-	if err != nil {
-		log.Fatal(err)
+func (lister *treeLister) descends(fullPath string) bool {
+	// Report whether to list the contents of a tree: always with `-r`, and
+	// otherwise when a path lies inside it.
+	if lister.opts.recursive {
+		return true
 	}
+	for _, spec := range lister.paths {
+		if strings.HasPrefix(spec, fullPath+"/") {
+			return true
+		}
+	}
+	return false
+}
 
-	treeObj, err := gitobj.ReadGitObj(objHash)
+func (lister *treeLister) walk(treeHash, prefix string) error {
+	entries, err := gitobj.ReadTree(treeHash)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
-	if err := gitobj.PrintTree(treeObj, outputType); err != nil {
-		log.Fatal(err)
+	for _, entry := range entries {
+		fullPath := prefix + entry.Name
+		isTree := entry.Type == "tree"
+		if !lister.interesting(fullPath, isTree) {
+			continue
+		}
+
+		descend := isTree && lister.descends(fullPath)
+		show := (isTree || !lister.opts.dirsOnly) && (!descend || lister.opts.showTrees)
+		if show {
+			if err := lister.print(entry, fullPath); err != nil {
+				return err
+			}
+		}
+		if descend {
+			if err := lister.walk(entry.Hash, fullPath+"/"); err != nil {
+				return err
+			}
+		}
 	}
+	return nil
+}
+
+func (lister *treeLister) print(entry gitobj.TreeEntry, fullPath string) error {
+	// Print one entry. The object is only read when its size is asked for, so
+	// listing works even when objects the tree refers to are missing.
+	if lister.opts.json {
+		return lister.addJSONEntry(entry, fullPath)
+	}
+	var sizeErr error
+	line := lsTreeAtom.ReplaceAllStringFunc(lister.format, func(match string) string {
+		switch match {
+		case "%%":
+			return "%"
+		case "%(objectmode)":
+			return entry.Mode
+		case "%(objecttype)":
+			return entry.Type
+		case "%(objectname)":
+			return entry.Hash[:lister.abbrevLen]
+		case "%(path)":
+			return lister.quote(fullPath)
+		case "%(objectsize)", "%(objectsize:padded)":
+			size := "-"
+			if entry.Type == "blob" {
+				obj, err := gitobj.ReadGitObj(entry.Hash)
+				if err != nil {
+					sizeErr = err
+					return ""
+				}
+				size = strconv.Itoa(obj.Size)
+			}
+			if match == "%(objectsize:padded)" {
+				return fmt.Sprintf("%7s", size)
+			}
+			return size
+		default:
+			value, _ := strconv.ParseUint(match[2:], 16, 8)
+			return string([]byte{byte(value)})
+		}
+	})
+	if sizeErr != nil {
+		return sizeErr
+	}
+
+	lister.out.WriteString(line)
+	if lister.opts.nulTerm {
+		return lister.out.WriteByte(0)
+	}
+	return lister.out.WriteByte('\n')
+}
+
+func (lister *treeLister) addJSONEntry(entry gitobj.TreeEntry, fullPath string) error {
+	jsonEntry := lsTreeJSONEntry{TreeEntry: entry}
+	jsonEntry.Name, jsonEntry.Hash = fullPath, entry.Hash[:lister.abbrevLen]
+	if lister.opts.long && entry.Type == "blob" {
+		obj, err := gitobj.ReadGitObj(entry.Hash)
+		if err != nil {
+			return err
+		}
+		jsonEntry.Size = &obj.Size
+	}
+	lister.entries = append(lister.entries, jsonEntry)
+	return nil
 }
@@ -0,0 +1,158 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/tsoud/GoTGit.git/gitobj"
+	"github.com/tsoud/GoTGit.git/internal/testutil"
+	"github.com/tsoud/GoTGit.git/refs"
+)
+
+func TestLSTree(t *testing.T) {
+	testutil.InitRepo(t)
+	tree := testutil.WriteTree(t, map[string]string{
+		"README":            "readme\n",
+		"docs/guide.md":     "guide\n",
+		"docs/api/index.md": "api\n",
+		"src/main.go":       "package main\n",
+		"src/lib/lib.go":    "package lib\n",
+	})
+	readme := testutil.WriteObject(t, "blob", "readme\n")
+	docs, err := refs.ResolveRevision(tree + ":docs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	api, err := refs.ResolveRevision(tree + ":docs/api")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		args []string
+		want string
+		err  string
+	}{
+		// Output formats.
+		{args: []string{"README", "docs"}, want: "100644 blob " + readme + "\tREADME\n040000 tree " + docs + "\tdocs\n"},
+		{args: []string{"-l", "README", "docs"}, want: "100644 blob " + readme + "       7\tREADME\n" +
+			"040000 tree " + docs + "       -\tdocs\n"},
+		{args: []string{"--name-only"}, want: "README\ndocs\nsrc\n"},
+		{args: []string{"--object-only", "README"}, want: readme + "\n"},
+		{args: []string{"-z", "--name-only"}, want: "README\x00docs\x00src\x00"},
+		{args: []string{"--format=%(objecttype) %(objectsize) %(objectsize:padded)|%(path)", "README", "src"},
+			want: "blob 7       7|README\ntree -       -|src\n"},
+		{args: []string{"--format=%(objectmode)%x09%(path)%x2C 100%%", "README"}, want: "100644\tREADME, 100%\n"},
+		{args: []string{"--format=%(objectname)", "--abbrev", "README"}, want: readme[:7] + "\n"},
+		{args: []string{"--format=%(objectname)", "--abbrev=10", "README"}, want: readme[:10] + "\n"},
+		{args: []string{"--format=%(objectname)", "--abbrev=2", "README"}, want: readme[:4] + "\n"},
+		{args: []string{"--object-only", "--abbrev=99", "README"}, want: readme + "\n"},
+		{args: []string{"--abbrev=5", "README"}, want: "100644 blob " + readme[:5] + "\tREADME\n"},
+		{args: []string{"--format=%(name)"}, err: "bad ls-tree format: %(name)"},
+		{args: []string{"--format=%(path)", "--long"}, err: "--format can't be combined"},
+		{args: []string{"--name-only", "--object-only"}, err: "only one of --long, --name-only and --object-only"},
+		{args: []string{"--abbrev=x"}, err: "invalid --abbrev value: x"},
+
+		// JSON output.
+		{args: []string{"--json", "README", "docs"},
+			want: `[{"mode":"100644","type":"blob","hash":"` + readme + `","name":"README"},` +
+				`{"mode":"040000","type":"tree","hash":"` + docs + `","name":"docs"}]` + "\n"},
+		{args: []string{"--json", "-l", "README", "docs"},
+			want: `[{"mode":"100644","type":"blob","hash":"` + readme + `","name":"README","size":7},` +
+				`{"mode":"040000","type":"tree","hash":"` + docs + `","name":"docs"}]` + "\n"},
+		{args: []string{"--json", "--abbrev", "-d", "docs/"},
+			want: `[{"mode":"040000","type":"tree","hash":"` + api[:7] + `","name":"docs/api"}]` + "\n"},
+		{args: []string{"--json", "nothing"}, want: "[]\n"},
+		{args: []string{"--json", "--name-only"}, err: "--json can't be combined"},
+		{args: []string{"--json", "-z"}, err: "--json can't be combined"},
+
+		// Recursion and tree entries.
+		{args: []string{"-t", "--name-only"}, want: "README\ndocs\nsrc\n"},
+		{args: []string{"-r", "--name-only"}, want: "README\ndocs/api/index.md\ndocs/guide.md\nsrc/lib/lib.go\nsrc/main.go\n"},
+		{args: []string{"-r", "-t", "--name-only"},
+			want: "README\ndocs\ndocs/api\ndocs/api/index.md\ndocs/guide.md\nsrc\nsrc/lib\nsrc/lib/lib.go\nsrc/main.go\n"},
+		{args: []string{"-d", "--name-only"}, want: "docs\nsrc\n"},
+		{args: []string{"-d", "-r", "--name-only"}, want: "docs\ndocs/api\nsrc\nsrc/lib\n"},
+		{args: []string{"-d", "-t", "--name-only"}, want: "docs\nsrc\n"},
+
+		// Paths.
+		{args: []string{"--name-only", "docs"}, want: "docs\n"},
+		{args: []string{"--name-only", "docs/"}, want: "docs/api\ndocs/guide.md\n"},
+		{args: []string{"--name-only", "docs/api/index.md"}, want: "docs/api/index.md\n"},
+		{args: []string{"--name-only", "docs/api/index.md", "README", "src/main.go"},
+			want: "README\ndocs/api/index.md\nsrc/main.go\n"},
+		{args: []string{"--name-only", "docs/../src/./lib"}, want: "src/lib\n"},
+		{args: []string{"--name-only", "."}, want: "README\ndocs\nsrc\n"},
+		{args: []string{"--name-only", "./"}, want: "README\ndocs\nsrc\n"},
+		{args: []string{"--name-only", "doc", "src/lib/lib.go/x", "nothing"}, want: ""},
+		{args: []string{"-t", "--name-only", "src/lib/lib.go"}, want: "src\nsrc/lib\nsrc/lib/lib.go\n"},
+		{args: []string{"-r", "--name-only", "src"}, want: "src/lib/lib.go\nsrc/main.go\n"},
+		{args: []string{"-r", "-t", "--name-only", "src/lib"}, want: "src\nsrc/lib\nsrc/lib/lib.go\n"},
+		{args: []string{"-d", "--name-only", "docs/"}, want: "docs/api\n"},
+		{args: []string{"-d", "--name-only", "docs/guide.md"}, want: ""},
+		{args: []string{"-d", "-r", "--name-only", "docs/api/index.md"}, want: "docs\ndocs/api\n"},
+	}
+	for _, test := range tests {
+		t.Run(strings.Join(test.args, " "), func(t *testing.T) {
+			fs, opts := SetupLSTreeCmd()
+			parsed, err := parseFlags(fs, test.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var out strings.Builder
+			err = listTree(&out, append([]string{tree}, parsed.args...), opts)
+			if test.err != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), test.err) {
+					t.Errorf("Wanted the error %q, got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != test.want {
+				t.Errorf("Wanted\n%q\ngot\n%q", test.want, out.String())
+			}
+		})
+	}
+}
+
+func TestLSTreeQuoting(t *testing.T) {
+	testutil.InitRepo(t)
+	testutil.IsolateConfig(t)
+	tree := testutil.WriteTree(t, map[string]string{
+		"é.txt":     "accent\n",
+		"tab\there": "tab\n",
+		`q"uote`:    "quote\n",
+		"plain":     "plain\n",
+	})
+
+	tests := []struct {
+		args   []string
+		config string
+		want   string
+	}{
+		{args: []string{"--name-only"}, want: "plain\n" + `"q\"uote"` + "\n" + `"tab\there"` + "\n" + `"\303\251.txt"` + "\n"},
+		{args: []string{"--format=%(path)|", "é.txt"}, want: `"\303\251.txt"|` + "\n"},
+		{args: []string{"--name-only", "-z"}, want: "plain\x00q\"uote\x00tab\there\x00é.txt\x00"},
+		{args: []string{"--name-only"}, config: "[core]\n\tquotePath = false\n",
+			want: "plain\n" + `"q\"uote"` + "\n" + `"tab\there"` + "\né.txt\n"},
+	}
+	for _, test := range tests {
+		t.Run(strings.Join(test.args, " ")+test.config, func(t *testing.T) {
+			testutil.WriteFiles(t, gitobj.GitDir, map[string]string{"config": test.config})
+			fs, opts := SetupLSTreeCmd()
+			parsed, err := parseFlags(fs, test.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var out strings.Builder
+			if err := listTree(&out, append([]string{tree}, parsed.args...), opts); err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != test.want {
+				t.Errorf("Wanted\n%q\ngot\n%q", test.want, out.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/tsoud/GoTGit.git/gitobj"
+	"github.com/tsoud/GoTGit.git/merge"
+	"github.com/tsoud/GoTGit.git/refs"
+)
+
+const MergeBaseUsageMsg = "usage: merge-base [-a | --all] <commit> <commit>...\n" +
+	"   or: merge-base [-a | --all] --octopus <commit>...\n" +
+	"   or: merge-base --independent <commit>...\n" +
+	"   or: merge-base --is-ancestor <commit> <commit>\n"
+
+type MergeBaseOptions struct {
+	all         bool
+	octopus     bool
+	independent bool
+	isAncestor  bool
+}
+
+func SetupMergeBaseCmd() (*flag.FlagSet, *MergeBaseOptions) {
+	mergeBaseCmd := flag.NewFlagSet("merge-base", flag.ExitOnError)
+	opts := &MergeBaseOptions{}
+
+	mergeBaseCmd.BoolVar(&opts.all, "a", false, "Output all merge bases instead of just one.")
+	mergeBaseCmd.BoolVar(&opts.all, "all", false, "Same as `-a`.")
+	mergeBaseCmd.BoolVar(&opts.octopus, "octopus", false, "Compute the best common ancestors "+
+		"of all commits, for an n-way merge.")
+	mergeBaseCmd.BoolVar(&opts.independent, "independent", false, "List the commits that cannot "+
+		"be reached from any other one given.")
+	mergeBaseCmd.BoolVar(&opts.isAncestor, "is-ancestor", false, "Exit with status 0 if the first "+
+		"commit is an ancestor of the second, and 1 otherwise.")
+
+	return mergeBaseCmd, opts
+}
+
+func MergeBaseCmdHandler(args []string, opts *MergeBaseOptions) (bool, error) {
+	// Print merge bases. The boolean result is false when `--is-ancestor` fails
+	// or no merge base exists, which the caller reports with exit status 1.
+	modes := 0
+	for _, set := range []bool{opts.octopus, opts.independent, opts.isAncestor} {
+		if set {
+			modes++
+		}
+	}
+	switch {
+	case modes > 1:
+		return false, fmt.Errorf("--octopus, --independent and --is-ancestor cannot be used together")
+	case opts.isAncestor && len(args) != 2:
+		return false, fmt.Errorf("--is-ancestor takes exactly two commits\n%s", MergeBaseUsageMsg)
+	case !opts.octopus && !opts.independent && len(args) < 2:
+		return false, fmt.Errorf("at least two commits are required\n%s", MergeBaseUsageMsg)
+	case len(args) == 0:
+		return false, fmt.Errorf("no commit given\n%s", MergeBaseUsageMsg)
+	}
+
+	var commits []string
+	for _, arg := range args {
+		hash, err := refs.ResolveCommit(arg)
+		if err != nil {
+			return false, fmt.Errorf("Not a valid object name %s", arg)
+		}
+		commits = append(commits, hash)
+	}
+
+	if opts.isAncestor {
+		return gitobj.IsAncestor(commits[0], commits[1])
+	}
+
+	var bases []string
+	var err error
+	switch {
+	case opts.independent:
+		bases, err = merge.Independent(commits...)
+	case opts.octopus:
+		bases, err = merge.OctopusBases(commits...)
+	default:
+		bases, err = merge.MergeBases(commits[0], commits[1:]...)
+	}
+	if err != nil {
+		return false, err
+	}
+	if len(bases) == 0 {
+		return false, nil
+	}
+
+	if !opts.all && !opts.independent {
+		bases = bases[:1]
+	}
+	for _, base := range bases {
+		fmt.Println(base)
+	}
+	return true, nil
+}
@@ -0,0 +1,674 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/tsoud/GoTGit.git/config"
+	"github.com/tsoud/GoTGit.git/diff"
+	"github.com/tsoud/GoTGit.git/gitobj"
+	"github.com/tsoud/GoTGit.git/hooks"
+	"github.com/tsoud/GoTGit.git/index"
+	"github.com/tsoud/GoTGit.git/merge"
+	"github.com/tsoud/GoTGit.git/refs"
+	"github.com/tsoud/GoTGit.git/worktree"
+)
+
+const MergeUsageMsg = "usage: merge [<options>] [<commit>]\n" +
+	"   or: merge --abort\n" +
+	"   or: merge --continue\n"
+
+type MergeOptions struct {
+	ff             bool
+	noFF           bool
+	ffOnly         bool
+	noCommit       bool
+	squash         bool
+	message        string
+	strategyOpts   stringList
+	allowUnrelated bool
+	noStat         bool
+	abort          bool
+	cont           bool
+	quiet          bool
+	noVerify       bool
+}
+
+func SetupMergeCmd() (*flag.FlagSet, *MergeOptions) {
+	mergeCmd := flag.NewFlagSet("merge", flag.ExitOnError)
+	opts := &MergeOptions{}
+
+	mergeCmd.BoolVar(&opts.ff, "ff", false, "Fast-forward when possible, otherwise create a merge commit "+
+		"(the default).")
+	mergeCmd.BoolVar(&opts.noFF, "no-ff", false, "Create a merge commit even when a fast-forward is possible.")
+	mergeCmd.BoolVar(&opts.ffOnly, "ff-only", false, "Refuse to merge unless HEAD can be fast-forwarded.")
+	mergeCmd.BoolVar(&opts.noCommit, "no-commit", false, "Stop before creating the merge commit.")
+	mergeCmd.BoolVar(&opts.squash, "squash", false, "Update the index and working tree as if merging, "+
+		"but don't create a merge commit or move HEAD.")
+	mergeCmd.StringVar(&opts.message, "m", "", "Use <msg> as the message of the merge commit.")
+	mergeCmd.StringVar(&opts.message, "message", "", "Same as `-m`.")
+	mergeCmd.Var(&opts.strategyOpts, "X", "Pass an option to the merge strategy: "+
+		"ours, theirs, union, no-renames, find-renames[=<n>] or rename-threshold=<n>.")
+	mergeCmd.Var(&opts.strategyOpts, "strategy-option", "Same as `-X`.")
+	mergeCmd.BoolVar(&opts.allowUnrelated, "allow-unrelated-histories", false,
+		"Merge histories that have no common ancestor.")
+	mergeCmd.BoolVar(&opts.noStat, "n", false, "Don't show a diffstat at the end of the merge.")
+	mergeCmd.BoolVar(&opts.noStat, "no-stat", false, "Same as `-n`.")
+	mergeCmd.BoolVar(&opts.abort, "abort", false, "Abort the current conflicted merge and restore "+
+		"the state before it.")
+	mergeCmd.BoolVar(&opts.cont, "continue", false, "Create the merge commit once conflicts are resolved.")
+	mergeCmd.BoolVar(&opts.quiet, "q", false, "Suppress feedback messages.")
+	mergeCmd.BoolVar(&opts.quiet, "quiet", false, "Same as `-q`.")
+	mergeCmd.BoolVar(&opts.noVerify, "no-verify", false, "Bypass the pre-merge-commit and commit-msg hooks.")
+
+	return mergeCmd, opts
+}
+
+func gitFile(name string) string {
+	return path.Join(gitobj.GitDir, name)
+}
+
+func createCommit(treeHash string, parents []string, message string, author *gitobj.Signature) (string, error) {
+	// Store a commit of `treeHash` with the configured identity, keeping `author`
+	// if given (e.g. when replaying someone else's commit).
+	cfg, err := config.Load()
+	if err != nil {
+		return "", err
+	}
+	commit := &gitobj.Commit{
+		Tree:      treeHash,
+		Parents:   parents,
+		Author:    cfg.Signature("author"),
+		Committer: cfg.Signature("committer"),
+		Message:   message,
+	}
+	if author != nil {
+		commit.Author = *author
+	}
+	commitObj, err := gitobj.HashCommit(commit)
+	if err != nil {
+		return "", err
+	}
+	if err := commitObj.Write(); err != nil {
+		return "", err
+	}
+	return commit.Hash, nil
+}
+
+func printDiffStat(oldTree, newTree string) error {
+	// Show a diffstat and summary of created, deleted and renamed files, as
+	// printed after a merge.
+	changes, err := diff.TreeDiff(oldTree, newTree, &diff.Options{Recursive: true, DetectRenames: true})
+	if err != nil {
+		return err
+	}
+	stats, err := diff.Stat(changes)
+	if err != nil {
+		return err
+	}
+	if len(stats) == 0 {
+		return nil
+	}
+	if err := diff.WriteStat(os.Stdout, stats); err != nil {
+		return err
+	}
+	for _, change := range changes {
+		switch change.Status {
+		case diff.Added:
+			fmt.Printf(" create mode %s %s\n", change.NewMode, change.NewPath)
+		case diff.Deleted:
+			fmt.Printf(" delete mode %s %s\n", change.OldMode, change.OldPath)
+		case diff.Renamed:
+			fmt.Printf(" rename %s (%d%%)\n", diff.RenameName(change.OldPath, change.NewPath), change.Similarity())
+		}
+	}
+	return nil
+}
+
+func indexMatchesTree(idx *index.Index, treeHash string) (bool, error) {
+	// Report whether the index has no staged changes relative to `treeHash`.
+	entries, err := index.EntriesFromTree(treeHash)
+	if err != nil {
+		return false, err
+	}
+	if len(entries) != len(idx.Entries) {
+		return false, nil
+	}
+	for i, entry := range entries {
+		current := idx.Entries[i]
+		if current.Stage != 0 || current.Path != entry.Path || current.Hash != entry.Hash ||
+			current.Mode != entry.Mode {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func applyMergeResult(idx *index.Index, result *merge.Result) error {
+	// Update the index and working tree with a merge result. Conflicted paths are
+	// recorded as stages 1-3 in the index, while their working tree file holds the
+	// merged version with conflict markers.
+	before := slices.Clone(idx.Entries)
+	stages := result.Stages()
+	conflicted := make(map[string]bool)
+	for _, stage := range stages {
+		conflicted[stage.Path] = true
+	}
+
+	var entries []*index.Entry
+	merged := make(map[string]gitobj.TreeEntry)
+	for _, file := range result.Files {
+		if conflicted[file.Name] {
+			merged[file.Name] = file
+			continue
+		}
+		entries = append(entries, &index.Entry{Path: file.Name, Mode: index.ParseMode(file.Mode), Hash: file.Hash})
+	}
+	for _, stage := range stages {
+		entries = append(entries, &index.Entry{
+			Path: stage.Path, Mode: index.ParseMode(stage.Mode), Hash: stage.Hash, Stage: stage.Stage,
+		})
+	}
+
+	// Conflicted files are not checked by ApplyIndex, so make sure that writing
+	// them loses nothing before touching the working tree.
+	tracked := make(map[string]*index.Entry)
+	for _, entry := range before {
+		tracked[entry.Path] = entry
+	}
+	for filePath := range merged {
+		entry := tracked[filePath]
+		if entry == nil && worktree.Exists(filePath) {
+			return fmt.Errorf("Untracked working tree file '%s' would be overwritten by merge.", filePath)
+		}
+		if entry != nil {
+			if modified, err := worktree.IsModified(entry); err != nil || modified {
+				return fmt.Errorf("Entry '%s' not uptodate. Cannot merge.", filePath)
+			}
+		}
+	}
+
+	idx.Entries = entries
+	idx.Sort()
+	if err := worktree.ApplyIndex(before, idx, false); err != nil {
+		return err
+	}
+	for filePath, file := range merged {
+		if err := worktree.WriteFile(filePath, file.Hash, file.Mode); err != nil {
+			return err
+		}
+	}
+	return idx.Write()
+}
+
+func mergeMessage(name, hash string) string {
+	// Describe what is merged the way Git does, e.g. "Merge branch 'topic'".
+	fullName, ok := refs.Expand(name)
+	switch {
+	case !ok:
+		return fmt.Sprintf("Merge commit '%s'", name)
+	case strings.HasPrefix(fullName, "refs/heads/"):
+		return fmt.Sprintf("Merge branch '%s'", refs.ShortName(fullName))
+	case strings.HasPrefix(fullName, "refs/remotes/"):
+		return fmt.Sprintf("Merge remote-tracking branch '%s'", refs.ShortName(fullName))
+	case strings.HasPrefix(fullName, "refs/tags/"):
+		return fmt.Sprintf("Merge tag '%s'", refs.ShortName(fullName))
+	}
+	return fmt.Sprintf("Merge commit '%s'", hash)
+}
+
+func cleanupMergeState() {
+	for _, name := range []string{"MERGE_HEAD", "MERGE_MSG", "MERGE_MODE"} {
+		os.Remove(gitFile(name))
+	}
+}
+
+func readMergeMessage() (string, error) {
+	// Read MERGE_MSG, dropping comment lines.
+	contents, err := os.ReadFile(gitFile("MERGE_MSG"))
+	if err != nil {
+		return "", err
+	}
+	return cleanupMessage(string(contents)), nil
+}
+
+func MergeCmdHandler(args []string, opts *MergeOptions) (bool, error) {
+	// Join another line of history into the current branch. The boolean result is
+	// false when the merge stopped with conflicts.
+	switch {
+	case opts.abort && opts.cont:
+		return false, fmt.Errorf("--abort and --continue cannot be used together")
+	case (opts.abort || opts.cont) && len(args) > 0:
+		return false, fmt.Errorf("--abort and --continue expect no arguments\n%s", MergeUsageMsg)
+	case opts.abort:
+		return true, abortMerge()
+	case opts.cont:
+		return true, continueMerge(opts.noVerify)
+	case opts.noFF && opts.ffOnly:
+		return false, fmt.Errorf("--no-ff and --ff-only cannot be used together")
+	case opts.squash && opts.noFF:
+		return false, fmt.Errorf("--squash and --no-ff cannot be used together")
+	case len(args) > 1:
+		return false, fmt.Errorf("merging more than one commit (octopus merge) is not supported")
+	}
+
+	if refs.Exists("MERGE_HEAD") {
+		return false, fmt.Errorf("You have not concluded your merge (MERGE_HEAD exists).\n" +
+			"Please, commit your changes before you merge.")
+	}
+	cfg, err := config.Load()
+	if err != nil {
+		return false, err
+	}
+	if !opts.ff && !opts.noFF && !opts.ffOnly {
+		if ff, ok := cfg.Get("merge.ff"); ok {
+			opts.noFF = ff == "false"
+			opts.ffOnly = ff == "only"
+		}
+	}
+
+	if len(args) == 0 {
+		branch, err := currentBranchName()
+		if err != nil {
+			return false, err
+		}
+		upstream := upstreamRef(cfg, branch)
+		if branch == "" || upstream == "" {
+			return false, fmt.Errorf("No remote for the current branch.")
+		}
+		args = []string{refs.ShortName(upstream)}
+	}
+	theirs, err := refs.ResolveCommit(args[0])
+	if err != nil {
+		return false, fmt.Errorf("%s - not something we can merge", args[0])
+	}
+
+	idx, err := index.Read()
+	if err != nil {
+		return false, err
+	}
+	if len(idx.Unmerged()) > 0 {
+		return false, fmt.Errorf("Merging is not possible because you have unmerged files.")
+	}
+
+	head, err := refs.Resolve(refs.HEAD)
+	if err == refs.ErrNotFound {
+		return true, mergeIntoUnborn(idx, theirs, opts)
+	} else if err != nil {
+		return false, err
+	}
+	headTree, err := commitTree(head)
+	if err != nil {
+		return false, err
+	}
+	theirsTree, err := commitTree(theirs)
+	if err != nil {
+		return false, err
+	}
+
+	if upToDate, err := gitobj.IsAncestor(theirs, head); err != nil {
+		return false, err
+	} else if upToDate {
+		fmt.Println("Already up to date.")
+		return true, nil
+	}
+
+	canFastForward, err := gitobj.IsAncestor(head, theirs)
+	if err != nil {
+		return false, err
+	}
+	if canFastForward && !opts.noFF {
+		return true, fastForward(idx, head, headTree, theirs, theirsTree, args[0], opts)
+	}
+	if opts.ffOnly {
+		return false, fmt.Errorf("Not possible to fast-forward, aborting.")
+	}
+
+	if matches, err := indexMatchesTree(idx, headTree); err != nil {
+		return false, err
+	} else if !matches {
+		return false, fmt.Errorf("Your local changes to the index would be overwritten by merge.\n" +
+			"Please commit your changes or stash them before you merge.")
+	}
+
+	bases, err := merge.MergeBases(head, theirs)
+	if err != nil {
+		return false, err
+	}
+	if len(bases) == 0 && !opts.allowUnrelated {
+		return false, fmt.Errorf("refusing to merge unrelated histories")
+	}
+
+	mergeOpts, err := strategyOptions(opts.strategyOpts)
+	if err != nil {
+		return false, err
+	}
+	mergeOpts.OursLabel, mergeOpts.TheirsLabel = "HEAD", args[0]
+	result, err := merge.MergeCommits(head, theirs, mergeOpts)
+	if err != nil {
+		return false, err
+	}
+	if err := applyMergeResult(idx, result); err != nil {
+		return false, err
+	}
+	if !opts.quiet {
+		for _, message := range result.Messages {
+			fmt.Println(message)
+		}
+	}
+
+	message := opts.message
+	if message == "" {
+		message = mergeMessage(args[0], theirs)
+		if branch, _ := currentBranchName(); branch != "" && branch != "main" && branch != "master" {
+			message += " into " + branch
+		}
+	}
+	message = strings.TrimRight(message, "\n") + "\n"
+
+	if opts.squash {
+		if err := writeSquashMessage(head, theirs); err != nil {
+			return false, err
+		}
+		if !result.Clean() {
+			fmt.Println("Squash commit -- not updating HEAD")
+			fmt.Println("Automatic merge failed; fix conflicts and then commit the result.")
+			return false, nil
+		}
+		fmt.Println("Squash commit -- not updating HEAD")
+		fmt.Println("Automatic merge went well; stopped before committing as requested")
+		hooks.PostMerge(true)
+		return true, nil
+	}
+
+	var hookErr error
+	if result.Clean() && !opts.noCommit {
+		if verified, err := verifyMergeCommit(message, opts.noVerify); err != nil {
+			hookErr = err
+		} else {
+			message = verified
+		}
+	}
+	if !result.Clean() || opts.noCommit || hookErr != nil {
+		if err := refs.Update("ORIG_HEAD", head, ""); err != nil {
+			return false, err
+		}
+		if err := refs.Update("MERGE_HEAD", theirs, ""); err != nil {
+			return false, err
+		}
+		mergeMode := ""
+		if opts.noFF {
+			mergeMode = "no-ff"
+		}
+		if err := os.WriteFile(gitFile("MERGE_MODE"), []byte(mergeMode), 0644); err != nil {
+			return false, err
+		}
+		if !result.Clean() {
+			message += "\n# Conflicts:\n"
+			for _, filePath := range idx.Unmerged() {
+				message += "#\t" + filePath + "\n"
+			}
+		}
+		if err := os.WriteFile(gitFile("MERGE_MSG"), []byte(message), 0644); err != nil {
+			return false, err
+		}
+		if hookErr != nil {
+			return false, fmt.Errorf("%w\nNot committing merge; use 'gotgit merge --continue' to complete the merge.",
+				hookErr)
+		}
+		if !result.Clean() {
+			fmt.Println("Automatic merge failed; fix conflicts and then commit the result.")
+			return false, nil
+		}
+		fmt.Println("Automatic merge went well; stopped before committing as requested")
+		return true, nil
+	}
+
+	commitHash, err := createCommit(result.Tree, []string{head, theirs}, message, nil)
+	if err != nil {
+		return false, err
+	}
+	if err := refs.Update("ORIG_HEAD", head, ""); err != nil {
+		return false, err
+	}
+	reflogMsg := fmt.Sprintf("merge %s: Merge made by the 'ort' strategy.", args[0])
+	if err := refs.UpdateHead(commitHash, reflogMsg); err != nil {
+		return false, err
+	}
+	if !opts.quiet {
+		fmt.Println("Merge made by the 'ort' strategy.")
+		if !opts.noStat {
+			if err := printDiffStat(headTree, result.Tree); err != nil {
+				return false, err
+			}
+		}
+	}
+	hooks.PostMerge(false)
+	return true, nil
+}
+
+func verifyMergeCommit(message string, noVerify bool) (string, error) {
+	// Run the hooks `git merge` runs before it creates a merge commit, unless
+	// --no-verify bypasses the ones that may refuse it.
+	if !noVerify {
+		if err := hooks.PreMergeCommit(); err != nil {
+			return "", err
+		}
+	}
+	message, err := prepareMessage(message, "merge")
+	if err != nil || noVerify {
+		return message, err
+	}
+	return verifyMessage(message)
+}
+
+func fastForward(idx *index.Index, head, headTree, theirs, theirsTree, name string, opts *MergeOptions) error {
+	// Move HEAD forward to `theirs`, updating the index and working tree. With
+	// --squash, only the index and working tree move.
+	if !opts.quiet {
+		fmt.Printf("Updating %s..%s\n", head[:7], theirs[:7])
+	}
+	if _, err := worktree.Checkout(idx, headTree, theirsTree, &worktree.CheckoutOptions{}); err != nil {
+		return err
+	}
+	if err := idx.Write(); err != nil {
+		return err
+	}
+
+	if opts.squash {
+		if err := writeSquashMessage(head, theirs); err != nil {
+			return err
+		}
+		if !opts.quiet {
+			fmt.Println("Fast-forward")
+			fmt.Println("Squash commit -- not updating HEAD")
+		}
+	} else {
+		if err := refs.Update("ORIG_HEAD", head, ""); err != nil {
+			return err
+		}
+		if err := refs.UpdateHead(theirs, fmt.Sprintf("merge %s: Fast-forward", name)); err != nil {
+			return err
+		}
+		if !opts.quiet {
+			fmt.Println("Fast-forward")
+		}
+	}
+	if !opts.quiet && !opts.noStat {
+		if err := printDiffStat(headTree, theirsTree); err != nil {
+			return err
+		}
+	}
+	hooks.PostMerge(opts.squash)
+	return nil
+}
+
+func mergeIntoUnborn(idx *index.Index, theirs string, opts *MergeOptions) error {
+	// Merging into a branch with no commits yet simply points it at `theirs`.
+	switch {
+	case opts.squash:
+		return fmt.Errorf("Squash commit into empty head not supported yet")
+	case opts.noFF:
+		return fmt.Errorf("Non-fast-forward commit does not make sense into an empty head")
+	}
+	theirsTree, err := commitTree(theirs)
+	if err != nil {
+		return err
+	}
+	if _, err := worktree.Checkout(idx, "", theirsTree, &worktree.CheckoutOptions{}); err != nil {
+		return err
+	}
+	if err := idx.Write(); err != nil {
+		return err
+	}
+	return refs.UpdateHead(theirs, "initial pull")
+}
+
+func writeSquashMessage(head, theirs string) error {
+	// Write SQUASH_MSG listing the commits that a squash merge brings in.
+	reachable, err := gitobj.Ancestors(head)
+	if err != nil {
+		return err
+	}
+	var message strings.Builder
+	message.WriteString("Squashed commit of the following:\n")
+
+	seen := make(map[string]bool)
+	queue := []string{theirs}
+	var commits []*gitobj.Commit
+	for len(queue) > 0 {
+		hash := queue[0]
+		queue = queue[1:]
+		if seen[hash] || reachable[hash] {
+			continue
+		}
+		seen[hash] = true
+		commit, err := gitobj.ReadCommit(hash)
+		if err != nil {
+			return err
+		}
+		commits = append(commits, commit)
+		queue = append(queue, commit.Parents...)
+	}
+	slices.SortStableFunc(commits, func(x, y *gitobj.Commit) int {
+		return y.Committer.When.Compare(x.Committer.When)
+	})
+
+	for _, commit := range commits {
+		fmt.Fprintf(&message, "\ncommit %s\n", commit.Hash)
+		fmt.Fprintf(&message, "Author: %s <%s>\n", commit.Author.Name, commit.Author.Email)
+		fmt.Fprintf(&message, "Date:   %s\n\n", commit.Author.When.Format("Mon Jan 2 15:04:05 2006 -0700"))
+		for _, line := range strings.Split(strings.TrimRight(commit.Message, "\n"), "\n") {
+			if line == "" {
+				message.WriteString("\n")
+			} else {
+				fmt.Fprintf(&message, "    %s\n", line)
+			}
+		}
+	}
+	return os.WriteFile(gitFile("SQUASH_MSG"), []byte(message.String()), 0644)
+}
+
+func abortMerge() error {
+	// Reset the index and working tree to HEAD, keeping local changes that the
+	// merge did not touch.
+	if !refs.Exists("MERGE_HEAD") {
+		return fmt.Errorf("There is no merge to abort (MERGE_HEAD missing).")
+	}
+	head, err := refs.Resolve(refs.HEAD)
+	if err != nil {
+		return err
+	}
+	headTree, err := commitTree(head)
+	if err != nil {
+		return err
+	}
+
+	idx, err := index.Read()
+	if err != nil {
+		return err
+	}
+	before := slices.Clone(idx.Entries)
+	if err := idx.OneWayMerge(headTree); err != nil {
+		return err
+	}
+	if err := worktree.ApplyIndex(before, idx, false); err != nil {
+		return err
+	}
+	if err := idx.Write(); err != nil {
+		return err
+	}
+	cleanupMergeState()
+	return nil
+}
+
+func continueMerge(noVerify bool) error {
+	// Conclude a merge that stopped for conflicts (or --no-commit) by committing
+	// the index, running the hooks `git commit` would.
+	if !refs.Exists("MERGE_HEAD") {
+		return fmt.Errorf("There is no merge in progress (MERGE_HEAD missing).")
+	}
+	idx, err := index.Read()
+	if err != nil {
+		return err
+	}
+	if unmerged := idx.Unmerged(); len(unmerged) > 0 {
+		return fmt.Errorf("Committing is not possible because you have unmerged files:\n\t%s",
+			strings.Join(unmerged, "\n\t"))
+	}
+
+	head, err := refs.Resolve(refs.HEAD)
+	if err != nil {
+		return err
+	}
+	theirs, err := refs.Resolve("MERGE_HEAD")
+	if err != nil {
+		return err
+	}
+	if !noVerify {
+		if err := hooks.PreCommit(); err != nil {
+			return err
+		}
+	}
+	message, err := readMergeMessage()
+	if err != nil {
+		return err
+	}
+	if message, err = prepareMessage(message, "merge"); err != nil {
+		return err
+	}
+	if !noVerify {
+		if message, err = verifyMessage(message); err != nil {
+			return err
+		}
+	}
+	treeHash, err := idx.WriteTree()
+	if err != nil {
+		return err
+	}
+
+	commitHash, err := createCommit(treeHash, []string{head, theirs}, message, nil)
+	if err != nil {
+		return err
+	}
+	commit, err := gitobj.ReadCommit(commitHash)
+	if err != nil {
+		return err
+	}
+	if err := refs.UpdateHead(commitHash, "commit (merge): "+commit.Subject()); err != nil {
+		return err
+	}
+	cleanupMergeState()
+
+	branch, _ := currentBranchName()
+	if branch == "" {
+		branch = "detached HEAD"
+	}
+	fmt.Printf("[%s %s] %s\n", branch, commitHash[:7], commit.Subject())
+	hooks.PostCommit()
+	return nil
+}
@@ -0,0 +1,156 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/tsoud/GoTGit.git/config"
+	"github.com/tsoud/GoTGit.git/diff"
+	"github.com/tsoud/GoTGit.git/merge"
+	"github.com/tsoud/GoTGit.git/refs"
+)
+
+const MergeTreeUsageMsg = "usage: merge-tree [--write-tree] [<options>] <branch1> <branch2>\n"
+
+type MergeTreeOptions struct {
+	writeTree      bool
+	nameOnly       bool
+	noMessages     bool
+	nullTerminated bool
+	mergeBase      string
+	strategyOpts   stringList
+}
+
+func SetupMergeTreeCmd() (*flag.FlagSet, *MergeTreeOptions) {
+	mergeTreeCmd := flag.NewFlagSet("merge-tree", flag.ExitOnError)
+	opts := &MergeTreeOptions{}
+
+	mergeTreeCmd.BoolVar(&opts.writeTree, "write-tree", false, "Write the merged tree and print "+
+		"its hash (the default, and the only supported mode).")
+	mergeTreeCmd.BoolVar(&opts.nameOnly, "name-only", false,
+		"List only the names of conflicted files, without modes, hashes and stages.")
+	mergeTreeCmd.BoolVar(&opts.noMessages, "no-messages", false,
+		"Don't print the informational messages after the conflicted files.")
+	mergeTreeCmd.BoolVar(&opts.nullTerminated, "z", false, "Terminate output lines with NUL.")
+	mergeTreeCmd.StringVar(&opts.mergeBase, "merge-base", "",
+		"Use <commit> as the merge base instead of computing it.")
+	mergeTreeCmd.Var(&opts.strategyOpts, "X", "Pass an option to the merge strategy: "+
+		"ours, theirs, union, no-renames, find-renames[=<n>] or rename-threshold=<n>.")
+	mergeTreeCmd.Var(&opts.strategyOpts, "strategy-option", "Same as `-X`.")
+
+	return mergeTreeCmd, opts
+}
+
+func strategyOptions(values []string) (*merge.Options, error) {
+	// Build merge options from the `-X` values, starting from the configuration.
+	opts := &merge.Options{DetectRenames: true, Style: merge.StyleMerge}
+	if cfg, err := config.Load(); err == nil {
+		if style, ok := cfg.Get("merge.conflictStyle"); ok {
+			if !merge.ValidStyle(style) {
+				return nil, fmt.Errorf("unknown style '%s' given for 'merge.conflictstyle'", style)
+			}
+			opts.Style = style
+		}
+		opts.DetectRenames = cfg.GetBool("merge.renames", cfg.GetBool("diff.renames", true))
+	}
+
+	for _, value := range values {
+		name, score, _ := strings.Cut(value, "=")
+		switch name {
+		case "ours":
+			opts.Favor = merge.FavorOurs
+		case "theirs":
+			opts.Favor = merge.FavorTheirs
+		case "union":
+			opts.Favor = merge.FavorUnion
+		case "no-renames":
+			opts.DetectRenames = false
+		case "find-renames", "rename-threshold":
+			opts.DetectRenames = true
+			if score != "" {
+				opts.RenameScore = diff.ParseScore(score)
+			}
+		default:
+			return nil, fmt.Errorf("unknown strategy option: -X%s", value)
+		}
+	}
+	return opts, nil
+}
+
+func MergeTreeCmdHandler(args []string, opts *MergeTreeOptions) (bool, error) {
+	// Merge two commits without touching the index or working tree and describe
+	// the result. The boolean result is false when the merge has conflicts.
+	if len(args) != 2 {
+		if len(args) == 3 && !opts.writeTree {
+			return false, fmt.Errorf("the deprecated trivial merge mode is not supported; " +
+				"use --write-tree with two commits")
+		}
+		return false, fmt.Errorf("two commits are required\n%s", MergeTreeUsageMsg)
+	}
+
+	mergeOpts, err := strategyOptions(opts.strategyOpts)
+	if err != nil {
+		return false, err
+	}
+	mergeOpts.OursLabel, mergeOpts.TheirsLabel = args[0], args[1]
+
+	var commits []string
+	for _, arg := range args {
+		hash, err := refs.ResolveCommit(arg)
+		if err != nil {
+			return false, fmt.Errorf("could not resolve commit %s", arg)
+		}
+		commits = append(commits, hash)
+	}
+
+	var result *merge.Result
+	if opts.mergeBase != "" {
+		baseTree, err := refs.ResolveTree(opts.mergeBase)
+		if err != nil {
+			return false, fmt.Errorf("could not resolve merge base %s", opts.mergeBase)
+		}
+		oursTree, err := commitTree(commits[0])
+		if err != nil {
+			return false, err
+		}
+		theirsTree, err := commitTree(commits[1])
+		if err != nil {
+			return false, err
+		}
+		mergeOpts.BaseLabel = opts.mergeBase
+		result, err = merge.MergeTrees(baseTree, oursTree, theirsTree, mergeOpts)
+		if err != nil {
+			return false, err
+		}
+	} else if result, err = merge.MergeCommits(commits[0], commits[1], mergeOpts); err != nil {
+		return false, err
+	}
+
+	end := "\n"
+	if opts.nullTerminated {
+		end = "\x00"
+	}
+	fmt.Print(result.Tree + end)
+	if result.Clean() {
+		return true, nil
+	}
+
+	printed := make(map[string]bool)
+	for _, stage := range result.Stages() {
+		switch {
+		case !opts.nameOnly:
+			fmt.Printf("%s %s %d\t%s%s", stage.Mode, stage.Hash, stage.Stage, stage.Path, end)
+		case !printed[stage.Path]:
+			fmt.Print(stage.Path + end)
+			printed[stage.Path] = true
+		}
+	}
+	if !opts.noMessages {
+		fmt.Print(end)
+		for _, message := range result.Messages {
+			fmt.Print(message + end)
+		}
+	}
+	return false, nil
+}
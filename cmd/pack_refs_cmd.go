@@ -0,0 +1,30 @@
+package cmd
+
+import (
+	"flag"
+
+	"github.com/tsoud/GoTGit.git/refs"
+)
+
+const PackRefsUsageMsg = "usage: pack-refs [--all] [--no-prune]\n"
+
+type PackRefsOptions struct {
+	all     bool
+	noPrune bool
+}
+
+func SetupPackRefsCmd() (*flag.FlagSet, *PackRefsOptions) {
+	packRefsCmd := flag.NewFlagSet("pack-refs", flag.ExitOnError)
+	opts := &PackRefsOptions{}
+
+	packRefsCmd.BoolVar(&opts.all, "all", false, "Pack all refs, not just tags and refs that "+
+		"are already packed.")
+	packRefsCmd.BoolVar(&opts.noPrune, "no-prune", false, "Keep the loose ref files after "+
+		"packing them.")
+
+	return packRefsCmd, opts
+}
+
+func PackRefsCmdHandler(opts *PackRefsOptions) error {
+	return refs.PackRefs(opts.all, !opts.noPrune)
+}
@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/tsoud/GoTGit.git/gc"
+)
+
+const PruneUsageMsg = "usage: prune [-n] [-v] [--expire <time>]\n"
+
+type PruneOptions struct {
+	dryRun  bool
+	verbose bool
+	expire  string
+}
+
+func SetupPruneCmd() (*flag.FlagSet, *PruneOptions) {
+	pruneCmd := flag.NewFlagSet("prune", flag.ExitOnError)
+	opts := &PruneOptions{}
+
+	pruneCmd.BoolVar(&opts.dryRun, "n", false, "Show what would be removed without removing it.")
+	pruneCmd.BoolVar(&opts.verbose, "v", false, "Show each object as it is removed.")
+	pruneCmd.StringVar(&opts.expire, "expire", "now", "Only remove unreachable objects older "+
+		"than this, e.g. `2.weeks.ago`.")
+
+	return pruneCmd, opts
+}
+
+func PruneCmdHandler(opts *PruneOptions) error {
+	// Remove unreachable loose objects, listing them with `-n` or `-v`.
+	expire, err := gc.ParseExpiry(opts.expire, time.Now())
+	if err != nil {
+		return err
+	}
+	pruneOpts := &gc.PruneOptions{Expire: expire, DryRun: opts.dryRun}
+	if opts.dryRun || opts.verbose {
+		pruneOpts.Pruned = func(hash, objType string) {
+			fmt.Println(hash, objType)
+		}
+	}
+	return gc.Prune(pruneOpts)
+}
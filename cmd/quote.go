@@ -0,0 +1,16 @@
+package cmd
+
+import (
+	"github.com/tsoud/GoTGit.git/config"
+	"github.com/tsoud/GoTGit.git/gitobj"
+)
+
+func pathQuoter() func(string) string {
+	// Return a function quoting paths for output, which quotes bytes above
+	// 0x7f unless `core.quotePath` is turned off.
+	nonASCII := true
+	if cfg, err := config.Load(); err == nil {
+		nonASCII = cfg.GetBool("core.quotepath", true)
+	}
+	return func(name string) string { return gitobj.QuotePath(name, nonASCII) }
+}
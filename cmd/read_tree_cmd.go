@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"slices"
+
+	"github.com/tsoud/GoTGit.git/index"
+	"github.com/tsoud/GoTGit.git/refs"
+	"github.com/tsoud/GoTGit.git/worktree"
+)
+
+const ReadTreeUsageMsg = "usage: read-tree [(-m [-u]) | --reset | --prefix=<prefix>] [--empty]\n" +
+	"                 <tree-ish1> [<tree-ish2> [<tree-ish3>]]\n"
+
+type ReadTreeOptions struct {
+	merge  bool
+	reset  bool
+	update bool
+	prefix string
+	empty  bool
+}
+
+func SetupReadTreeCmd() (*flag.FlagSet, *ReadTreeOptions) {
+	readTreeCmd := flag.NewFlagSet("read-tree", flag.ExitOnError)
+	opts := &ReadTreeOptions{}
+
+	readTreeCmd.BoolVar(&opts.merge, "m", false, "Perform a merge, not just a read. "+
+		"With two trees, move the index from the first to the second; "+
+		"with three, merge the third into the second using the first as their base.")
+	readTreeCmd.BoolVar(&opts.reset, "reset", false, "Same as `-m`, except that unmerged entries "+
+		"are discarded instead of failing, and local changes are overwritten with `-u`.")
+	readTreeCmd.BoolVar(&opts.update, "u", false, "After a successful merge, update the files "+
+		"in the working tree with the result.")
+	readTreeCmd.StringVar(&opts.prefix, "prefix", "", "Read the tree into the index under <prefix>/, "+
+		"keeping the rest of the index.")
+	readTreeCmd.BoolVar(&opts.empty, "empty", false, "Empty the index instead of reading a tree into it.")
+
+	return readTreeCmd, opts
+}
+
+func ReadTreeCmdHandler(treeishes []string, opts *ReadTreeOptions) error {
+	merge := opts.merge || opts.reset
+	switch {
+	case opts.empty && len(treeishes) > 0:
+		return fmt.Errorf("passing trees as arguments contradicts --empty")
+	case !opts.empty && len(treeishes) == 0:
+		return fmt.Errorf("no tree given\n%s", ReadTreeUsageMsg)
+	case len(treeishes) > 3:
+		return fmt.Errorf("just how do you expect me to merge %d trees?", len(treeishes))
+	case opts.update && !merge && opts.prefix == "":
+		return fmt.Errorf("-u is meaningless without -m, --reset, or --prefix")
+	case opts.prefix != "" && len(treeishes) != 1:
+		return fmt.Errorf("--prefix reads exactly one tree")
+	case opts.merge && opts.reset:
+		return fmt.Errorf("-m and --reset cannot be used together")
+	}
+
+	var trees []string
+	for _, treeish := range treeishes {
+		treeHash, err := refs.ResolveTree(treeish)
+		if err != nil {
+			return fmt.Errorf("failed to unpack tree object %s", treeish)
+		}
+		trees = append(trees, treeHash)
+	}
+
+	idx, err := index.Read()
+	if err != nil {
+		return err
+	}
+	before := slices.Clone(idx.Entries)
+	if merge && !opts.reset && opts.prefix == "" && len(idx.Unmerged()) > 0 {
+		return fmt.Errorf("You need to resolve your current index first")
+	}
+
+	switch {
+	case opts.empty:
+		idx.Entries = nil
+	case opts.prefix != "":
+		err = idx.ReadTree(trees[0], opts.prefix)
+	case !merge:
+		// Without -m, later trees are read on top of earlier ones.
+		err = idx.ReadTree(trees[0], "")
+		for _, treeHash := range trees[1:] {
+			if err != nil {
+				break
+			}
+			var entries []*index.Entry
+			if entries, err = index.EntriesFromTree(treeHash); err == nil {
+				for _, entry := range entries {
+					idx.Add(entry)
+				}
+			}
+		}
+	case len(trees) == 1:
+		err = idx.OneWayMerge(trees[0])
+	case len(trees) == 2:
+		err = idx.TwoWayMerge(trees[0], trees[1], opts.reset)
+	default:
+		err = idx.ThreeWayMerge(trees[0], trees[1], trees[2])
+	}
+	if err != nil {
+		return err
+	}
+
+	if opts.update {
+		if err := worktree.ApplyIndex(before, idx, opts.reset); err != nil {
+			return err
+		}
+	}
+	return idx.Write()
+}
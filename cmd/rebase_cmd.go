@@ -0,0 +1,977 @@
+package cmd
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/tsoud/GoTGit.git/config"
+	"github.com/tsoud/GoTGit.git/gitobj"
+	"github.com/tsoud/GoTGit.git/hooks"
+	"github.com/tsoud/GoTGit.git/index"
+	"github.com/tsoud/GoTGit.git/merge"
+	"github.com/tsoud/GoTGit.git/refs"
+	"github.com/tsoud/GoTGit.git/worktree"
+)
+
+const RebaseUsageMsg = "usage: rebase [-i] [--onto <newbase>] [--[no-]autosquash] [-x <cmd>]\n" +
+	"              [-X <option>] [<upstream> [<branch>]]\n" +
+	"   or: rebase --continue | --abort | --skip\n"
+
+type RebaseOptions struct {
+	interactive  bool
+	onto         string
+	autosquash   bool
+	noAutosquash bool
+	exec         stringList
+	strategyOpts stringList
+	cont         bool
+	abort        bool
+	skip         bool
+	quiet        bool
+	noVerify     bool
+}
+
+func SetupRebaseCmd() (*flag.FlagSet, *RebaseOptions) {
+	rebaseCmd := flag.NewFlagSet("rebase", flag.ExitOnError)
+	opts := &RebaseOptions{}
+
+	rebaseCmd.BoolVar(&opts.interactive, "i", false, "Edit the list of commits to replay before rebasing.")
+	rebaseCmd.BoolVar(&opts.interactive, "interactive", false, "Same as `-i`.")
+	rebaseCmd.StringVar(&opts.onto, "onto", "", "Replay the commits onto <newbase> instead of <upstream>.")
+	rebaseCmd.BoolVar(&opts.autosquash, "autosquash", false, "Move commits whose subject starts with "+
+		"\"fixup! \" or \"squash! \" after the commit they refer to, and mark them as fixup or squash.")
+	rebaseCmd.BoolVar(&opts.noAutosquash, "no-autosquash", false, "Don't reorder fixup and squash commits, "+
+		"overriding `rebase.autoSquash`.")
+	rebaseCmd.Var(&opts.exec, "x", "Run <cmd> with the shell after each replayed commit; "+
+		"the rebase stops if it fails.")
+	rebaseCmd.Var(&opts.exec, "exec", "Same as `-x`.")
+	rebaseCmd.Var(&opts.strategyOpts, "X", "Pass an option to the merge strategy "+
+		"(see `merge -X`). Note that \"ours\" is the branch being rebased onto.")
+	rebaseCmd.Var(&opts.strategyOpts, "strategy-option", "Same as `-X`.")
+	rebaseCmd.BoolVar(&opts.cont, "continue", false, "Resume the rebase after resolving a conflict "+
+		"or stopping at a commit.")
+	rebaseCmd.BoolVar(&opts.abort, "abort", false, "Abort the rebase and restore the original branch.")
+	rebaseCmd.BoolVar(&opts.skip, "skip", false, "Skip the commit that stopped the rebase.")
+	rebaseCmd.BoolVar(&opts.quiet, "q", false, "Suppress feedback messages.")
+	rebaseCmd.BoolVar(&opts.quiet, "quiet", false, "Same as `-q`.")
+	rebaseCmd.BoolVar(&opts.noVerify, "no-verify", false, "Bypass the pre-rebase hook.")
+
+	return rebaseCmd, opts
+}
+
+func rebaseFile(name string) string {
+	return path.Join(gitobj.GitDir, "rebase-merge", name)
+}
+
+func readRebaseFile(name string) string {
+	// Read a rebase state file without its trailing newline; missing files are empty.
+	contents, _ := os.ReadFile(rebaseFile(name))
+	return strings.TrimSuffix(string(contents), "\n")
+}
+
+func writeRebaseFile(name, contents string) error {
+	return os.WriteFile(rebaseFile(name), []byte(contents), 0644)
+}
+
+func rebaseInProgress() bool {
+	_, err := os.Stat(rebaseFile(""))
+	return err == nil
+}
+
+// todoItem is one line of a rebase todo list.
+type todoItem struct {
+	command string
+	// commit is the full hash of the commit to use, for commands that take one.
+	commit string
+	// arg is the rest of the line: the commit subject, or the shell command for exec.
+	arg string
+}
+
+var todoCommands = map[string]string{
+	"p": "pick", "r": "reword", "e": "edit", "s": "squash", "f": "fixup", "x": "exec", "b": "break", "d": "drop",
+}
+
+func (item todoItem) String() string {
+	switch {
+	case item.command == "break":
+		return item.command
+	case item.commit == "":
+		return item.command + " " + item.arg
+	}
+	return strings.TrimSpace(fmt.Sprintf("%s %s %s", item.command, item.commit[:7], item.arg))
+}
+
+func (item todoItem) squashes() bool {
+	return item.command == "squash" || item.command == "fixup"
+}
+
+func parseTodo(contents string) ([]todoItem, error) {
+	// Parse a todo list, skipping blank lines and comments.
+	var items []todoItem
+	for i, line := range strings.Split(contents, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		word, rest, _ := strings.Cut(line, " ")
+		command := word
+		if long, ok := todoCommands[word]; ok {
+			command = long
+		}
+		item := todoItem{command: command, arg: strings.TrimSpace(rest)}
+
+		switch command {
+		case "break":
+		case "exec":
+			if item.arg == "" {
+				return nil, fmt.Errorf("missing command in line %d: %s", i+1, line)
+			}
+		case "pick", "reword", "edit", "squash", "fixup", "drop", "revert":
+			rev, subject, _ := strings.Cut(item.arg, " ")
+			hash, err := refs.ResolveCommit(rev)
+			if err != nil {
+				return nil, fmt.Errorf("could not parse '%s' in line %d: %s", rev, i+1, line)
+			}
+			item.commit, item.arg = hash, strings.TrimSpace(subject)
+		default:
+			return nil, fmt.Errorf("invalid command '%s' in line %d: %s", word, i+1, line)
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func formatTodo(items []todoItem) string {
+	var todo strings.Builder
+	for _, item := range items {
+		todo.WriteString(item.String() + "\n")
+	}
+	return todo.String()
+}
+
+const todoHelp = `
+# Rebase %s onto %s (%d commands)
+#
+# Commands:
+# p, pick <commit> = use commit
+# r, reword <commit> = use commit, but edit the commit message
+# e, edit <commit> = use commit, but stop for amending
+# s, squash <commit> = use commit, but meld into previous commit
+# f, fixup <commit> = like "squash" but keep only the previous
+#                    commit's log message
+# x, exec <command> = run command (the rest of the line) using shell
+# b, break = stop here (continue rebase later with 'gotgit rebase --continue')
+# d, drop <commit> = remove commit
+#
+# These lines can be re-ordered; they are executed from top to bottom.
+#
+# If you remove a line here THAT COMMIT WILL BE LOST.
+#
+# However, if you remove everything, the rebase will be aborted.
+#
+`
+
+func listCommits(upstream, head string, merges bool) ([]*gitobj.Commit, error) {
+	// List the commits reachable from `head` but not from `upstream`, parents
+	// before children. Merge commits are left out unless `merges` is set.
+	excluded := make(map[string]bool)
+	if upstream != "" {
+		var err error
+		if excluded, err = gitobj.Ancestors(upstream); err != nil {
+			return nil, err
+		}
+	}
+
+	var commits []*gitobj.Commit
+	var visit func(hash string) error
+	visit = func(hash string) error {
+		if excluded[hash] {
+			return nil
+		}
+		excluded[hash] = true
+		commit, err := gitobj.ReadCommit(hash)
+		if err != nil {
+			return err
+		}
+		for _, parent := range commit.Parents {
+			if err := visit(parent); err != nil {
+				return err
+			}
+		}
+		if merges || len(commit.Parents) <= 1 {
+			commits = append(commits, commit)
+		}
+		return nil
+	}
+	if err := visit(head); err != nil {
+		return nil, err
+	}
+	return commits, nil
+}
+
+func autosquash(items []todoItem) []todoItem {
+	// Move commits whose subject starts with "fixup! ", "squash! " or "amend! "
+	// right after the commit they refer to (by subject or hash prefix).
+	followers := make(map[int][]todoItem)
+	targetOf := make(map[int]int)
+	for i, item := range items {
+		command, subject := "", item.arg
+		for {
+			if rest, ok := strings.CutPrefix(subject, "squash! "); ok {
+				command = cmpOr(command, "squash")
+				subject = rest
+			} else if rest, ok := strings.CutPrefix(subject, "fixup! "); ok {
+				command = cmpOr(command, "fixup")
+				subject = rest
+			} else if rest, ok := strings.CutPrefix(subject, "amend! "); ok {
+				command = cmpOr(command, "fixup")
+				subject = rest
+			} else {
+				break
+			}
+		}
+		if command == "" {
+			continue
+		}
+
+		for j := 0; j < i; j++ {
+			target := items[j]
+			if target.arg != subject && (len(subject) < 4 || !strings.HasPrefix(target.commit, subject)) {
+				continue
+			}
+			root := j
+			if moved, ok := targetOf[j]; ok {
+				root = moved
+			}
+			item.command = command
+			followers[root] = append(followers[root], item)
+			targetOf[i] = root
+			break
+		}
+	}
+
+	var sorted []todoItem
+	for i, item := range items {
+		if _, moved := targetOf[i]; moved {
+			continue
+		}
+		sorted = append(sorted, item)
+		sorted = append(sorted, followers[i]...)
+	}
+	return sorted
+}
+
+func cmpOr(value, fallback string) string {
+	if value != "" {
+		return value
+	}
+	return fallback
+}
+
+func writeAuthorScript(author gitobj.Signature) error {
+	// Save the author of the commit being replayed, in the format Git uses.
+	quote := func(value string) string { return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'" }
+	script := fmt.Sprintf("GIT_AUTHOR_NAME=%s\nGIT_AUTHOR_EMAIL=%s\nGIT_AUTHOR_DATE=%s\n",
+		quote(author.Name), quote(author.Email),
+		quote(fmt.Sprintf("@%d %s", author.When.Unix(), author.When.Format("-0700"))))
+	return writeRebaseFile("author-script", script)
+}
+
+func readAuthorScript() (*gitobj.Signature, error) {
+	values := make(map[string]string)
+	for _, line := range strings.Split(readRebaseFile("author-script"), "\n") {
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		value = strings.ReplaceAll(value, `'\''`, "'")
+		values[key] = strings.TrimSuffix(strings.TrimPrefix(value, "'"), "'")
+	}
+	author, err := gitobj.ParseSignature(fmt.Sprintf("%s <%s> %s", values["GIT_AUTHOR_NAME"],
+		values["GIT_AUTHOR_EMAIL"], strings.TrimPrefix(values["GIT_AUTHOR_DATE"], "@")))
+	if err != nil {
+		return nil, fmt.Errorf("invalid author script: %w", err)
+	}
+	return &author, nil
+}
+
+func resetHard(idx *index.Index, treeHash string) error {
+	// Make the index and tracked files match `treeHash`, discarding local changes
+	// and conflicts.
+	before := slices.Clone(idx.Entries)
+	if err := idx.OneWayMerge(treeHash); err != nil {
+		return err
+	}
+	if err := worktree.ApplyIndex(before, idx, true); err != nil {
+		return err
+	}
+	return idx.Write()
+}
+
+func RebaseCmdHandler(args []string, opts *RebaseOptions) (bool, error) {
+	// Replay commits on top of another base. The boolean result is false when
+	// the rebase stopped because of a conflict or a failed exec command.
+	actions := 0
+	for _, set := range []bool{opts.cont, opts.abort, opts.skip} {
+		if set {
+			actions++
+		}
+	}
+	switch {
+	case actions > 1:
+		return false, fmt.Errorf("--continue, --abort and --skip cannot be used together")
+	case actions == 1 && len(args) > 0:
+		return false, fmt.Errorf("--continue, --abort and --skip expect no arguments\n%s", RebaseUsageMsg)
+	case actions == 1 && !rebaseInProgress():
+		return false, fmt.Errorf("No rebase in progress?")
+	case opts.abort:
+		return true, abortRebase()
+	case opts.skip:
+		return skipRebase()
+	case opts.cont:
+		return continueRebase()
+	case rebaseInProgress():
+		return false, fmt.Errorf("It seems that there is already a rebase-merge directory.\n" +
+			"Use \"gotgit rebase --continue\", \"--skip\" or \"--abort\" to finish it first.")
+	case len(args) > 2:
+		return false, fmt.Errorf("too many arguments\n%s", RebaseUsageMsg)
+	}
+	return startRebase(args, opts)
+}
+
+func startRebase(args []string, opts *RebaseOptions) (bool, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return false, err
+	}
+	if _, err := strategyOptions(opts.strategyOpts); err != nil {
+		return false, err
+	}
+
+	if len(args) == 0 {
+		branch, err := currentBranchName()
+		if err != nil {
+			return false, err
+		}
+		upstream := upstreamRef(cfg, branch)
+		if branch == "" || upstream == "" {
+			return false, fmt.Errorf("There is no tracking information for the current branch.\n" +
+				"Please specify which branch you want to rebase against.")
+		}
+		args = []string{refs.ShortName(upstream)}
+	}
+	upstream, err := refs.ResolveCommit(args[0])
+	if err != nil {
+		return false, fmt.Errorf("invalid upstream '%s'", args[0])
+	}
+	ontoName := args[0]
+	onto := upstream
+	if opts.onto != "" {
+		ontoName = opts.onto
+		if onto, err = refs.ResolveCommit(opts.onto); err != nil {
+			return false, fmt.Errorf("Does not point to a valid commit '%s'", opts.onto)
+		}
+	}
+
+	if len(args) == 2 {
+		req, err := branchRequest(args[1], false)
+		if err != nil {
+			return false, err
+		}
+		if req == nil {
+			// Rebasing a commit rather than a branch leaves HEAD detached.
+			commitHash, err := refs.ResolveCommit(args[1])
+			if err != nil {
+				return false, fmt.Errorf("no such branch/commit '%s'", args[1])
+			}
+			req = &switchRequest{target: args[1], commit: commitHash}
+		}
+		req.quiet = true
+		if err := switchHead(req); err != nil {
+			return false, err
+		}
+	}
+
+	head, err := refs.Resolve(refs.HEAD)
+	if err != nil {
+		return false, fmt.Errorf("cannot rebase: HEAD does not point to a commit")
+	}
+	headName, err := refs.CurrentBranch()
+	if err != nil {
+		return false, err
+	}
+	headTree, err := commitTree(head)
+	if err != nil {
+		return false, err
+	}
+
+	idx, err := index.Read()
+	if err != nil {
+		return false, err
+	}
+	changes, err := worktree.LocalChanges(idx, headTree)
+	if err != nil {
+		return false, err
+	}
+	if len(changes) > 0 {
+		return false, fmt.Errorf("cannot rebase: You have unstaged changes.\nPlease commit or stash them.")
+	}
+
+	commits, err := listCommits(upstream, head, false)
+	if err != nil {
+		return false, err
+	}
+	bases, err := merge.MergeBases(upstream, head)
+	if err != nil {
+		return false, err
+	}
+	if !opts.interactive && len(opts.exec) == 0 && len(bases) == 1 && bases[0] == onto {
+		name := "HEAD"
+		if headName != "" {
+			name = refs.ShortName(headName)
+		}
+		fmt.Printf("Current branch %s is up to date.\n", name)
+		return true, nil
+	}
+	if !opts.noVerify {
+		branch := ""
+		if len(args) == 2 {
+			branch = args[1]
+		}
+		var exitErr *hooks.ExitError
+		if err := hooks.PreRebase(args[0], branch); errors.As(err, &exitErr) {
+			return false, fmt.Errorf("The pre-rebase hook refused to rebase.")
+		} else if err != nil {
+			return false, err
+		}
+	}
+
+	var items []todoItem
+	for _, commit := range commits {
+		items = append(items, todoItem{command: "pick", commit: commit.Hash, arg: commit.Subject()})
+	}
+	if opts.autosquash || cfg.GetBool("rebase.autoSquash", false) && !opts.noAutosquash {
+		items = autosquash(items)
+	}
+	if len(opts.exec) > 0 {
+		var withExec []todoItem
+		for i, item := range items {
+			withExec = append(withExec, item)
+			if i+1 < len(items) && items[i+1].squashes() {
+				continue
+			}
+			for _, command := range opts.exec {
+				withExec = append(withExec, todoItem{command: "exec", arg: command})
+			}
+		}
+		items = withExec
+	}
+
+	if err := os.MkdirAll(rebaseFile(""), 0755); err != nil {
+		return false, err
+	}
+	if headName == "" {
+		headName = "detached HEAD"
+	}
+	state := map[string]string{
+		"head-name":     headName + "\n",
+		"onto":          onto + "\n",
+		"orig-head":     head + "\n",
+		"strategy_opts": strings.Join(opts.strategyOpts, "\n"),
+		"done":          "",
+	}
+	if opts.interactive {
+		state["interactive"] = ""
+	}
+	if opts.quiet {
+		state["quiet"] = ""
+	}
+	for name, contents := range state {
+		if err := writeRebaseFile(name, contents); err != nil {
+			return false, err
+		}
+	}
+
+	todo := formatTodo(items)
+	if opts.interactive {
+		todo += fmt.Sprintf(todoHelp, fmt.Sprintf("%s..%s", upstream[:7], head[:7]), onto[:7], len(items))
+	}
+	if err := writeRebaseFile("git-rebase-todo", todo); err != nil {
+		return false, err
+	}
+	if opts.interactive {
+		if err := launchEditor(rebaseFile("git-rebase-todo"), true); err != nil {
+			os.RemoveAll(rebaseFile(""))
+			return false, err
+		}
+		edited, err := parseTodo(readRebaseFile("git-rebase-todo"))
+		if err == nil && len(edited) == 0 {
+			err = fmt.Errorf("Nothing to do")
+		}
+		if err != nil {
+			os.RemoveAll(rebaseFile(""))
+			return false, err
+		}
+	}
+
+	// Start from `onto` with a detached HEAD; the branch only moves at the end.
+	if err := refs.Update("ORIG_HEAD", head, ""); err != nil {
+		return false, err
+	}
+	ontoTree, err := commitTree(onto)
+	if err != nil {
+		return false, err
+	}
+	if _, err := worktree.Checkout(idx, headTree, ontoTree, &worktree.CheckoutOptions{}); err != nil {
+		os.RemoveAll(rebaseFile(""))
+		return false, err
+	}
+	if err := idx.Write(); err != nil {
+		return false, err
+	}
+	if err := refs.Update(refs.HEAD, onto, "rebase (start): checkout "+ontoName); err != nil {
+		return false, err
+	}
+	hooks.PostCheckout(head, onto, true)
+	return runRebaseTodo()
+}
+
+func runRebaseTodo() (bool, error) {
+	// Work through the todo list until it is empty or a command stops the rebase.
+	for {
+		items, err := parseTodo(readRebaseFile("git-rebase-todo"))
+		if err != nil {
+			return false, err
+		}
+		if len(items) == 0 {
+			return true, finishRebase()
+		}
+
+		item := items[0]
+		if err := writeRebaseFile("git-rebase-todo", formatTodo(items[1:])); err != nil {
+			return false, err
+		}
+		done := readRebaseFile("done")
+		if done != "" {
+			done += "\n"
+		}
+		if err := writeRebaseFile("done", done+item.String()+"\n"); err != nil {
+			return false, err
+		}
+
+		next := ""
+		if len(items) > 1 {
+			next = items[1].command
+		}
+		stopped, ok, err := runTodoItem(item, next)
+		if err != nil {
+			return false, err
+		}
+		if stopped {
+			return ok, nil
+		}
+	}
+}
+
+func runTodoItem(item todoItem, next string) (bool, bool, error) {
+	// Run one todo command. Returns whether the rebase stopped, and if so whether
+	// it stopped as requested (edit, break) rather than for a problem.
+	switch item.command {
+	case "drop":
+		return false, true, nil
+
+	case "break":
+		fmt.Fprintf(os.Stderr, "Stopped at %s\n", headLine(mustResolveHead()))
+		return true, true, nil
+
+	case "exec":
+		fmt.Fprintf(os.Stderr, "Executing: %s\n", item.arg)
+		execCmd := exec.Command("sh", "-c", item.arg)
+		execCmd.Stdin, execCmd.Stdout, execCmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+		if err := execCmd.Run(); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: execution failed: %s\n"+
+				"You can fix the problem, and then run\n\n  gotgit rebase --continue\n\n", item.arg)
+			return true, false, nil
+		}
+		return false, true, nil
+	}
+
+	if item.command == "revert" {
+		return false, false, fmt.Errorf("revert is not supported in a rebase todo list")
+	}
+	commit, err := gitobj.ReadCommit(item.commit)
+	if err != nil {
+		return false, false, err
+	}
+	if len(commit.Parents) > 1 {
+		return false, false, fmt.Errorf("commit %s is a merge, which rebase cannot replay", item.commit[:7])
+	}
+	head, err := refs.Resolve(refs.HEAD)
+	if err != nil {
+		return false, false, err
+	}
+	idx, err := index.Read()
+	if err != nil {
+		return false, false, err
+	}
+	headTree, err := commitTree(head)
+	if err != nil {
+		return false, false, err
+	}
+	parent := ""
+	if len(commit.Parents) == 1 {
+		parent = commit.Parents[0]
+	}
+
+	// Commits already on top of HEAD are reused as they are.
+	if parent == head && (item.command == "pick" || item.command == "edit") {
+		if _, err := worktree.Checkout(idx, headTree, commit.Tree, &worktree.CheckoutOptions{}); err != nil {
+			return false, false, err
+		}
+		if err := idx.Write(); err != nil {
+			return false, false, err
+		}
+		if err := refs.Update(refs.HEAD, commit.Hash, "rebase: fast-forward"); err != nil {
+			return false, false, err
+		}
+		return stopForEdit(item, commit)
+	}
+
+	parentTree, err := commitTree(parent)
+	if err != nil {
+		return false, false, err
+	}
+	mergeOpts, err := strategyOptions(strings.Fields(readRebaseFile("strategy_opts")))
+	if err != nil {
+		return false, false, err
+	}
+	label := fmt.Sprintf("%s (%s)", commit.Hash[:7], commit.Subject())
+	mergeOpts.OursLabel, mergeOpts.TheirsLabel, mergeOpts.BaseLabel = "HEAD", label, "parent of "+label
+	result, err := merge.MergeTrees(parentTree, headTree, commit.Tree, mergeOpts)
+	if err != nil {
+		return false, false, err
+	}
+	if err := applyMergeResult(idx, result); err != nil {
+		return false, false, err
+	}
+	if !rebaseQuiet() || !result.Clean() {
+		for _, message := range result.Messages {
+			fmt.Println(message)
+		}
+	}
+
+	if err := writeRebaseFile("message", commit.Message); err != nil {
+		return false, false, err
+	}
+	if err := writeAuthorScript(commit.Author); err != nil {
+		return false, false, err
+	}
+	if err := writeRebaseFile("stopped-sha", commit.Hash+"\n"); err != nil {
+		return false, false, err
+	}
+	if !result.Clean() {
+		fmt.Fprintf(os.Stderr, "error: could not apply %s... %s\n"+
+			"hint: Resolve all conflicts manually, mark them as resolved in the index,\n"+
+			"hint: then run \"gotgit rebase --continue\".\n"+
+			"hint: You can instead skip this commit: run \"gotgit rebase --skip\".\n"+
+			"hint: To abort and get back to the state before \"gotgit rebase\", run \"gotgit rebase --abort\".\n",
+			commit.Hash[:7], commit.Subject())
+		return true, false, nil
+	}
+
+	if err := commitPicked(item, commit, result.Tree, next); err != nil {
+		return false, false, err
+	}
+	return stopForEdit(item, commit)
+}
+
+func mustResolveHead() string {
+	head, _ := refs.Resolve(refs.HEAD)
+	return head
+}
+
+func rebaseQuiet() bool {
+	_, err := os.Stat(rebaseFile("quiet"))
+	return err == nil
+}
+
+func stopForEdit(item todoItem, commit *gitobj.Commit) (bool, bool, error) {
+	// After an `edit` command, stop so the user can amend the commit.
+	if item.command != "edit" {
+		return false, true, nil
+	}
+	head := mustResolveHead()
+	if err := writeRebaseFile("amend", head+"\n"); err != nil {
+		return false, false, err
+	}
+	if err := writeRebaseFile("stopped-sha", commit.Hash+"\n"); err != nil {
+		return false, false, err
+	}
+	fmt.Fprintf(os.Stderr, "Stopped at %s...  %s\n"+
+		"You can amend the commit now, then run\n\n  gotgit rebase --continue\n\n"+
+		"Changes staged in the index when continuing are amended into the commit.\n",
+		commit.Hash[:7], commit.Subject())
+	return true, true, nil
+}
+
+func ordinal(n int) string {
+	switch {
+	case n%100 >= 11 && n%100 <= 13:
+		return fmt.Sprintf("%dth", n)
+	case n%10 == 1:
+		return fmt.Sprintf("%dst", n)
+	case n%10 == 2:
+		return fmt.Sprintf("%dnd", n)
+	case n%10 == 3:
+		return fmt.Sprintf("%drd", n)
+	}
+	return fmt.Sprintf("%dth", n)
+}
+
+func squashMessage(head *gitobj.Commit, commit *gitobj.Commit, command string) (string, error) {
+	// Add `commit` to the combined message of a squash/fixup chain, in Git's
+	// format: squashed messages are kept, fixup messages are commented out.
+	fixups := readRebaseFile("current-fixups")
+	count := strings.Count(fixups, "\n") + 2
+	message := readRebaseFile("message-squash")
+	if fixups == "" {
+		message = fmt.Sprintf("# This is a combination of 2 commits.\n# This is the 1st commit message:\n\n%s",
+			head.Message)
+	} else {
+		_, rest, _ := strings.Cut(message, "\n")
+		message = fmt.Sprintf("# This is a combination of %d commits.\n%s", count, rest)
+	}
+
+	if command == "squash" {
+		message += fmt.Sprintf("\n# This is the commit message #%d:\n\n%s", count, commit.Message)
+	} else {
+		message += fmt.Sprintf("\n# The commit message #%d will be skipped:\n\n", count)
+		for _, line := range strings.Split(strings.TrimRight(commit.Message, "\n"), "\n") {
+			message += "# " + line + "\n"
+		}
+	}
+	if err := writeRebaseFile("message-squash", message); err != nil {
+		return "", err
+	}
+	return message, writeRebaseFile("current-fixups", fixups+command+" "+commit.Hash+"\n")
+}
+
+func commitPicked(item todoItem, commit *gitobj.Commit, treeHash, next string) error {
+	// Record the result of replaying `commit` as a new commit on HEAD, or fold it
+	// into HEAD for squash and fixup.
+	headHash := mustResolveHead()
+	head, err := gitobj.ReadCommit(headHash)
+	if err != nil {
+		return err
+	}
+	author, err := readAuthorScript()
+	if err != nil {
+		return err
+	}
+	message := readRebaseFile("message") + "\n"
+	if message == "\n" {
+		message = commit.Message
+	}
+	parents := []string{headHash}
+	reflogMsg := fmt.Sprintf("rebase (%s): %s", item.command, commit.Subject())
+
+	// The message goes through prepare-commit-msg before the user edits it, and
+	// through commit-msg if they did.
+	editFile := ""
+	switch item.command {
+	case "reword":
+		editFile = rebaseFile("message")
+	case "squash", "fixup":
+		// The combined commit replaces HEAD, keeping its author.
+		parents, author = head.Parents, &head.Author
+		combined, err := squashMessage(head, commit, item.command)
+		if err != nil {
+			return err
+		}
+		message = cleanupMessage(combined)
+		if next != "squash" && next != "fixup" && strings.Contains(readRebaseFile("current-fixups"), "squash ") {
+			message, editFile = combined, rebaseFile("message-squash")
+		}
+	}
+	if message, err = prepareMessage(message, "message"); err != nil {
+		return err
+	}
+	if editFile != "" {
+		if message, err = editMessage(editFile, message); err != nil {
+			return err
+		}
+		if message, err = verifyMessage(message); err != nil {
+			return err
+		}
+	}
+	if item.squashes() && next != "squash" && next != "fixup" {
+		os.Remove(rebaseFile("message-squash"))
+		os.Remove(rebaseFile("current-fixups"))
+	}
+
+	newHash, err := createCommit(treeHash, parents, message, author)
+	if err != nil {
+		return err
+	}
+	if item.squashes() {
+		reflogMsg = fmt.Sprintf("rebase (%s): %s", item.command, strings.SplitN(message, "\n", 2)[0])
+	}
+	if err := refs.Update(refs.HEAD, newHash, reflogMsg); err != nil {
+		return err
+	}
+	for _, name := range []string{"message", "author-script", "stopped-sha"} {
+		os.Remove(rebaseFile(name))
+	}
+	hooks.PostCommit()
+	return nil
+}
+
+func lastDone() todoItem {
+	lines := strings.Split(readRebaseFile("done"), "\n")
+	items, _ := parseTodo(lines[len(lines)-1])
+	if len(items) == 0 {
+		return todoItem{}
+	}
+	return items[0]
+}
+
+func continueRebase() (bool, error) {
+	// Commit the resolution of a conflict (or changes staged at an `edit` stop)
+	// and carry on with the todo list.
+	idx, err := index.Read()
+	if err != nil {
+		return false, err
+	}
+	if unmerged := idx.Unmerged(); len(unmerged) > 0 {
+		return false, fmt.Errorf("You must edit all merge conflicts and then mark them as resolved "+
+			"in the index:\n\t%s", strings.Join(unmerged, "\n\t"))
+	}
+	headHash := mustResolveHead()
+	headTree, err := commitTree(headHash)
+	if err != nil {
+		return false, err
+	}
+	treeHash, err := idx.WriteTree()
+	if err != nil {
+		return false, err
+	}
+
+	switch amend := readRebaseFile("amend"); {
+	case amend != "":
+		if amend != headHash {
+			// The commit was already amended by other means.
+		} else if treeHash != headTree {
+			head, err := gitobj.ReadCommit(headHash)
+			if err != nil {
+				return false, err
+			}
+			newHash, err := createCommit(treeHash, head.Parents, head.Message, &head.Author)
+			if err != nil {
+				return false, err
+			}
+			if err := refs.Update(refs.HEAD, newHash, "rebase (amend): "+head.Subject()); err != nil {
+				return false, err
+			}
+		}
+		os.Remove(rebaseFile("amend"))
+		os.Remove(rebaseFile("stopped-sha"))
+
+	case readRebaseFile("stopped-sha") != "":
+		item := lastDone()
+		commit, err := gitobj.ReadCommit(strings.TrimSpace(readRebaseFile("stopped-sha")))
+		if err != nil {
+			return false, err
+		}
+		if treeHash == headTree && !item.squashes() {
+			// The resolution left nothing to commit: the commit is dropped.
+			for _, name := range []string{"message", "author-script", "stopped-sha"} {
+				os.Remove(rebaseFile(name))
+			}
+		} else {
+			next := ""
+			if items, _ := parseTodo(readRebaseFile("git-rebase-todo")); len(items) > 0 {
+				next = items[0].command
+			}
+			if err := commitPicked(item, commit, treeHash, next); err != nil {
+				return false, err
+			}
+		}
+	}
+	return runRebaseTodo()
+}
+
+func skipRebase() (bool, error) {
+	// Drop the commit that stopped the rebase and carry on.
+	idx, err := index.Read()
+	if err != nil {
+		return false, err
+	}
+	headTree, err := commitTree(mustResolveHead())
+	if err != nil {
+		return false, err
+	}
+	if err := resetHard(idx, headTree); err != nil {
+		return false, err
+	}
+	for _, name := range []string{"message", "author-script", "stopped-sha", "amend"} {
+		os.Remove(rebaseFile(name))
+	}
+	return runRebaseTodo()
+}
+
+func abortRebase() error {
+	// Go back to the original branch and commit, discarding the rebase.
+	origHead := readRebaseFile("orig-head")
+	headName := readRebaseFile("head-name")
+	origTree, err := commitTree(origHead)
+	if err != nil {
+		return err
+	}
+	idx, err := index.Read()
+	if err != nil {
+		return err
+	}
+	if err := resetHard(idx, origTree); err != nil {
+		return err
+	}
+
+	if strings.HasPrefix(headName, "refs/") {
+		err = refs.SetSymbolic(refs.HEAD, headName, "rebase (abort): returning to "+headName)
+	} else {
+		err = refs.Update(refs.HEAD, origHead, "rebase (abort): returning to "+origHead)
+	}
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(rebaseFile(""))
+}
+
+func finishRebase() error {
+	// Point the rebased branch at the new commits and check it out again.
+	head := mustResolveHead()
+	headName := readRebaseFile("head-name")
+	onto := readRebaseFile("onto")
+	quiet := rebaseQuiet()
+
+	if strings.HasPrefix(headName, "refs/") {
+		if err := refs.Update(headName, head, fmt.Sprintf("rebase (finish): %s onto %s", headName, onto)); err != nil {
+			return err
+		}
+		if err := refs.SetSymbolic(refs.HEAD, headName, "rebase (finish): returning to "+headName); err != nil {
+			return err
+		}
+	}
+	if err := os.RemoveAll(rebaseFile("")); err != nil {
+		return err
+	}
+	if !quiet {
+		fmt.Fprintf(os.Stderr, "Successfully rebased and updated %s.\n", headName)
+	}
+	return nil
+}
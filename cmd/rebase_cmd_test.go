@@ -0,0 +1,309 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/tsoud/GoTGit.git/gitobj"
+	"github.com/tsoud/GoTGit.git/internal/testutil"
+	"github.com/tsoud/GoTGit.git/refs"
+)
+
+func TestParseTodo(t *testing.T) {
+	initWorkRepo(t)
+	first := commitFiles(t, "first", map[string]string{"a": "a\n"})
+	second := commitFiles(t, "second", map[string]string{"a": "b\n"}, first)
+	checkoutBranch(t, "main", second)
+
+	tests := []struct {
+		line string
+		want todoItem
+		err  string
+	}{
+		{line: "pick " + first + " first", want: todoItem{command: "pick", commit: first, arg: "first"}},
+		{line: "p " + first[:7], want: todoItem{command: "pick", commit: first}},
+		{line: "  reword main  the subject ", want: todoItem{command: "reword", commit: second, arg: "the subject"}},
+		{line: "r main", want: todoItem{command: "reword", commit: second}},
+		{line: "edit main~1 x", want: todoItem{command: "edit", commit: first, arg: "x"}},
+		{line: "e main", want: todoItem{command: "edit", commit: second}},
+		{line: "squash main", want: todoItem{command: "squash", commit: second}},
+		{line: "s main", want: todoItem{command: "squash", commit: second}},
+		{line: "fixup main", want: todoItem{command: "fixup", commit: second}},
+		{line: "f main", want: todoItem{command: "fixup", commit: second}},
+		{line: "drop main", want: todoItem{command: "drop", commit: second}},
+		{line: "d main", want: todoItem{command: "drop", commit: second}},
+		{line: "exec make test > out", want: todoItem{command: "exec", arg: "make test > out"}},
+		{line: "x true", want: todoItem{command: "exec", arg: "true"}},
+		{line: "break", want: todoItem{command: "break"}},
+		{line: "b", want: todoItem{command: "break"}},
+		{line: "exec", err: "missing command in line 1: exec"},
+		{line: "pick nothing", err: "could not parse 'nothing' in line 1: pick nothing"},
+		{line: "pick", err: "could not parse '' in line 1: pick"},
+		{line: "frob main", err: "invalid command 'frob' in line 1: frob main"},
+	}
+	for _, test := range tests {
+		items, err := parseTodo(test.line)
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("Wanted the error %q for %q, got %v", test.err, test.line, err)
+			}
+			continue
+		}
+		if err != nil || len(items) != 1 || items[0] != test.want {
+			t.Errorf("Wanted %q to parse as %+v, got %+v (%v)", test.line, test.want, items, err)
+		}
+	}
+
+	// Comments and blank lines are skipped, errors give the line number and the
+	// list reads back as it was written.
+	todo := "# Rebase\n\npick " + first + " first\n  # indented comment\nx echo hi\nbreak\n" +
+		fmt.Sprintf(todoHelp, "a..b", "c", 3)
+	items, err := parseTodo(todo)
+	want := []todoItem{{command: "pick", commit: first, arg: "first"}, {command: "exec", arg: "echo hi"},
+		{command: "break"}}
+	if err != nil || !reflect.DeepEqual(items, want) {
+		t.Fatalf("Wanted the todo list %+v, got %+v (%v)", want, items, err)
+	}
+	if formatted := formatTodo(items); formatted != "pick "+first[:7]+" first\nexec echo hi\nbreak\n" {
+		t.Errorf("Wanted the todo list formatted with short hashes, got %q", formatted)
+	}
+	if reparsed, err := parseTodo(formatTodo(items)); err != nil || !reflect.DeepEqual(reparsed, items) {
+		t.Errorf("Wanted the formatted todo list to parse the same, got %+v (%v)", reparsed, err)
+	}
+	if _, err := parseTodo("pick main\n\nfrob"); err == nil || !strings.Contains(err.Error(), "line 3") {
+		t.Errorf("Wanted an error on line 3, got %v", err)
+	}
+}
+
+func TestAutosquash(t *testing.T) {
+	pick := func(commit, subject string) todoItem {
+		return todoItem{command: "pick", commit: strings.Repeat(commit, 10), arg: subject}
+	}
+	items := []todoItem{
+		pick("a", "add a"),
+		pick("b", "add b"),
+		pick("c", "fixup! add a"),
+		pick("d", "squash! add b"),
+		pick("e", "amend! add a"),
+		pick("f", "fixup! bbbb"),
+		pick("g", "squash! fixup! add a"),
+		pick("h", "fixup! cccccccc"),
+		pick("i", "fixup! add nothing"),
+		pick("j", "fixup! abc"),
+	}
+	want := []string{
+		"pick aaaaaaa add a",
+		"fixup ccccccc fixup! add a",
+		"fixup eeeeeee amend! add a",
+		"squash ggggggg squash! fixup! add a",
+		"fixup hhhhhhh fixup! cccccccc",
+		"pick bbbbbbb add b",
+		"squash ddddddd squash! add b",
+		"fixup fffffff fixup! bbbb",
+		"pick iiiiiii fixup! add nothing",
+		"pick jjjjjjj fixup! abc",
+	}
+	var got []string
+	for _, item := range autosquash(items) {
+		got = append(got, item.String())
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Wanted the todo list\n%s\ngot\n%s", strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+}
+
+// rebaseHistory is the history TestRebase works with: "main" added a file
+// since "topic" branched off, and topic has a fixup for its first commit.
+type rebaseHistory struct {
+	base, upstream, changeA, changeB, fixupA, debug string
+}
+
+func setupRebase(t *testing.T) rebaseHistory {
+	t.Helper()
+	initWorkRepo(t)
+	var h rebaseHistory
+	h.base = commitFiles(t, "base", map[string]string{"a": "a\n", "b": "b\n"})
+	h.upstream = commitFiles(t, "upstream", map[string]string{"a": "a\n", "b": "b\n", "c": "c\n"}, h.base)
+	h.changeA = commitFiles(t, "change a", map[string]string{"a": "a2\n", "b": "b\n"}, h.base)
+	h.changeB = commitFiles(t, "change b", map[string]string{"a": "a2\n", "b": "b2\n"}, h.changeA)
+	h.fixupA = commitFiles(t, "fixup! change a", map[string]string{"a": "a3\n", "b": "b2\n"}, h.changeB)
+	h.debug = commitFiles(t, "debug", map[string]string{"a": "a3\n", "b": "b2\n", "e": "e\n"}, h.fixupA)
+	if err := refs.Update("refs/heads/main", h.upstream, ""); err != nil {
+		t.Fatal(err)
+	}
+	checkoutBranch(t, "topic", h.fixupA)
+	return h
+}
+
+func TestRebase(t *testing.T) {
+	h := setupRebase(t)
+
+	if status := gotgit(t, "rebase", "-q", "--autosquash", "main"); status != 0 {
+		t.Fatalf("Wanted the rebase to succeed, got status %d", status)
+	}
+	if got, want := history(t, "HEAD"), []string{"change b", "change a", "upstream", "base"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Wanted the fixup squashed into its commit, got the history %q", got)
+	}
+	if branch, _ := refs.CurrentBranch(); branch != "refs/heads/topic" {
+		t.Errorf("Wanted topic checked out again, got %q", branch)
+	}
+	if origHead, _ := refs.Resolve("ORIG_HEAD"); origHead != h.fixupA {
+		t.Errorf("Wanted ORIG_HEAD at the old tip, got %s", origHead)
+	}
+	if showFile(t, "HEAD~1:a") != "a3\n" {
+		t.Errorf("Wanted \"change a\" to include the fixup, got %q", showFile(t, "HEAD~1:a"))
+	}
+	checkFiles(t, map[string]string{"a": "a3\n", "b": "b2\n", "c": "c\n"})
+	if rebaseInProgress() {
+		t.Error("Wanted the rebase state removed")
+	}
+
+	// --no-autosquash overrides rebase.autoSquash.
+	checkoutBranch(t, "topic", h.fixupA)
+	gotgit(t, "-c", "rebase.autoSquash=true", "rebase", "-q", "--no-autosquash", "main")
+	if got := history(t, "HEAD"); len(got) != 5 || got[0] != "fixup! change a" {
+		t.Errorf("Wanted the commits replayed in order, got the history %q", got)
+	}
+	checkoutBranch(t, "topic", h.fixupA)
+	gotgit(t, "-c", "rebase.autoSquash=true", "rebase", "-q", "main")
+	if got := history(t, "HEAD"); len(got) != 4 {
+		t.Errorf("Wanted rebase.autoSquash to squash the fixup, got the history %q", got)
+	}
+}
+
+func TestRebaseInteractive(t *testing.T) {
+	h := setupRebase(t)
+	checkoutBranch(t, "topic", h.debug)
+	dir, _ := filepath.Abs(".")
+
+	// The edited todo list reorders the commits, stops to amend one, rewords
+	// one, folds in the fixup, runs a command and drops the last commit.
+	testutil.WriteFiles(t, dir, map[string]string{"todo": "edit " + h.changeB[:7] + " change b\n" +
+		"r " + h.changeA + "\n" +
+		"# a comment\n" +
+		"fixup " + h.fixupA + "\n" +
+		"exec echo ran > exec-out\n" +
+		"drop " + h.debug + " debug\n"})
+	t.Setenv("GIT_SEQUENCE_EDITOR", "cp "+filepath.Join(dir, "todo"))
+	t.Setenv("GIT_EDITOR", "f() { echo reworded > \"$1\"; }; f")
+
+	if status := gotgit(t, "rebase", "-q", "-i", "main"); status != 0 {
+		t.Fatalf("Wanted the rebase to stop at the edit, got status %d", status)
+	}
+	state := map[string]string{
+		"head-name": "refs/heads/topic",
+		"onto":      h.upstream,
+		"orig-head": h.debug,
+		"done":      "edit " + h.changeB[:7] + " change b",
+		"amend":     mustResolveHead(),
+	}
+	for name, want := range state {
+		if got := readRebaseFile(name); got != want {
+			t.Errorf("Wanted the rebase file %s to be %q, got %q", name, want, got)
+		}
+	}
+	remaining, err := parseTodo(readRebaseFile("git-rebase-todo"))
+	if err != nil || len(remaining) != 4 || remaining[0].command != "reword" || remaining[3].command != "drop" {
+		t.Errorf("Wanted the rest of the todo list saved, got %+v (%v)", remaining, err)
+	}
+	if _, err := Run([]string{"rebase", "main"}); err == nil || !strings.Contains(err.Error(), "already a rebase-merge") {
+		t.Errorf("Wanted a rebase in progress to stop another one, got %v", err)
+	}
+
+	// Changes staged at the stop are amended into the commit.
+	stageFiles(t, map[string]string{"d": "d\n"})
+	if status := gotgit(t, "rebase", "--continue"); status != 0 {
+		t.Fatalf("Wanted the rebase to finish, got status %d", status)
+	}
+	if got, want := history(t, "topic"), []string{"reworded", "change b", "upstream", "base"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Wanted the history %q, got %q", want, got)
+	}
+	if showFile(t, "topic~1:d") != "d\n" || showFile(t, "topic:a") != "a3\n" || showFile(t, "topic:e") != "" {
+		t.Error("Wanted the amended, fixed up commits without the dropped one")
+	}
+	checkFiles(t, map[string]string{"exec-out": "ran\n", "d": "d\n", "e": ""})
+	if rebaseInProgress() {
+		t.Error("Wanted the rebase state removed")
+	}
+
+	// Emptying the todo list aborts the rebase.
+	testutil.WriteFiles(t, dir, map[string]string{"todo": "# nothing\n"})
+	if _, err := Run([]string{"rebase", "-i", "main~1"}); err == nil || err.Error() != "Nothing to do" {
+		t.Errorf("Wanted an empty todo list to abort, got %v", err)
+	}
+	if rebaseInProgress() {
+		t.Error("Wanted the rebase state removed")
+	}
+}
+
+func TestRebaseConflict(t *testing.T) {
+	initWorkRepo(t)
+	base := commitFiles(t, "base", map[string]string{"a": "a\n", "b": "b\n"})
+	upstream := commitFiles(t, "upstream", map[string]string{"a": "up\n", "b": "b\n"}, base)
+	changeA := commitFiles(t, "change a", map[string]string{"a": "a2\n", "b": "b\n"}, base)
+	changeB := commitFiles(t, "change b", map[string]string{"a": "a2\n", "b": "b2\n"}, changeA)
+	if err := refs.Update("refs/heads/main", upstream, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, action := range []string{"--abort", "--skip", "--continue"} {
+		t.Run(action, func(t *testing.T) {
+			checkoutBranch(t, "topic", changeB)
+			if _, err := Run([]string{"rebase", action}); err == nil || err.Error() != "No rebase in progress?" {
+				t.Errorf("Wanted no rebase in progress, got %v", err)
+			}
+			if status := gotgit(t, "rebase", "-q", "main"); status != 1 {
+				t.Fatalf("Wanted the rebase to stop at the conflict, got status %d", status)
+			}
+			if readRebaseFile("stopped-sha") != changeA || !strings.Contains(testutil.ReadFile(t, "a"), "<<<<<<< HEAD") {
+				t.Fatal("Wanted the rebase stopped at the conflicted commit")
+			}
+			if _, err := Run([]string{"rebase", "--continue"}); err == nil ||
+				!strings.HasPrefix(err.Error(), "You must edit all merge conflicts") {
+				t.Errorf("Wanted --continue to refuse unresolved conflicts, got %v", err)
+			}
+
+			switch action {
+			case "--abort":
+				gotgit(t, "rebase", "--abort")
+				if head := mustResolveHead(); head != changeB {
+					t.Errorf("Wanted HEAD back at the old tip, got %s", head)
+				}
+				if branch, _ := refs.CurrentBranch(); branch != "refs/heads/topic" {
+					t.Errorf("Wanted topic checked out again, got %q", branch)
+				}
+				checkFiles(t, map[string]string{"a": "a2\n", "b": "b2\n"})
+
+			case "--skip":
+				gotgit(t, "rebase", "--skip")
+				if got, want := history(t, "topic"), []string{"change b", "upstream", "base"}; !reflect.DeepEqual(got, want) {
+					t.Errorf("Wanted the history %q, got %q", want, got)
+				}
+				checkFiles(t, map[string]string{"a": "up\n", "b": "b2\n"})
+
+			case "--continue":
+				stageFiles(t, map[string]string{"a": "resolved\n"})
+				gotgit(t, "rebase", "--continue")
+				if got, want := history(t, "topic"), []string{"change b", "change a", "upstream", "base"}; !reflect.DeepEqual(got, want) {
+					t.Errorf("Wanted the history %q, got %q", want, got)
+				}
+				hash, _ := refs.ResolveCommit("topic~1")
+				resolved, err := gitobj.ReadCommit(hash)
+				original, _ := gitobj.ReadCommit(changeA)
+				if err != nil || !resolved.Author.When.Equal(original.Author.When) {
+					t.Errorf("Wanted the resolved commit to keep its author date, got %v", err)
+				}
+				if showFile(t, "topic~1:a") != "resolved\n" {
+					t.Errorf("Wanted the resolution committed, got %q", showFile(t, "topic~1:a"))
+				}
+				checkFiles(t, map[string]string{"a": "resolved\n", "b": "b2\n"})
+			}
+			if rebaseInProgress() {
+				t.Error("Wanted the rebase state removed")
+			}
+		})
+	}
+}
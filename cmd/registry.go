@@ -0,0 +1,568 @@
+package cmd
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/tsoud/GoTGit.git/completion"
+	"github.com/tsoud/GoTGit.git/config"
+)
+
+const MainUsageMsg = "usage: gotgit [-C <path>] [-c <name>=<value>] [--git-dir=<path>] [-h | --help]\n" +
+	"              <command> [<args>]\n"
+
+const HelpUsageMsg = "usage: help [<command>]\n"
+
+// usageExitCode is the status Git exits with after a usage error, or after
+// showing the usage of a command with `-h`.
+const usageExitCode = 129
+
+// commandArgs are the arguments left once a command's options are parsed,
+// split at `--` for commands that take paths.
+type commandArgs struct {
+	args      []string
+	paths     []string
+	separator bool
+}
+
+func (a commandArgs) all() []string {
+	return append(slices.Clip(a.args), a.paths...)
+}
+
+// runFunc runs a command with its parsed arguments, returning the status to
+// exit with.
+type runFunc func(args commandArgs) (int, error)
+
+// Command is a built-in command: how `help` describes it and how to set up
+// its options and run it.
+type Command struct {
+	Name    string
+	Summary string
+	Usage   string
+	// Hidden commands are left out of `help` and completion.
+	Hidden bool
+	// NoWorkTree commands, such as init, run in the directory they are started
+	// in rather than from the top of the working tree.
+	NoWorkTree bool
+	// MinArgs and MaxArgs bound the number of arguments left after the
+	// options, with anyArgs for no upper bound.
+	MinArgs int
+	MaxArgs int
+	// Subcommands are the words that may come first, as in `stash pop`; the
+	// first one is used when none is given. Setup is called with the one given.
+	Subcommands []string
+	Setup       func(subcommand string) (*flag.FlagSet, runFunc)
+}
+
+const anyArgs = -1
+
+func LookupCommand(name string) *Command {
+	for _, command := range commands {
+		if command.Name == name {
+			return command
+		}
+	}
+	return nil
+}
+
+func (command *Command) subcommand(args []string) (string, []string) {
+	// Split off the subcommand, if the command has any.
+	if len(command.Subcommands) == 0 {
+		return "", args
+	}
+	if len(args) > 0 && slices.Contains(command.Subcommands, args[0]) {
+		return args[0], args[1:]
+	}
+	return command.Subcommands[0], args
+}
+
+func (command *Command) Run(args []string) (int, error) {
+	// Parse the options of the command, which may be interspersed with its
+	// arguments, and run it. `-h` shows its usage instead.
+	subcommand, args := command.subcommand(args)
+	fs, run := command.Setup(subcommand)
+	fs.Init(fs.Name(), flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+
+	parsed, err := parseFlags(fs, args)
+	if errors.Is(err, flag.ErrHelp) {
+		fmt.Print(command.Help(fs))
+		return usageExitCode, nil
+	}
+	switch n := len(parsed.all()); {
+	case err != nil:
+	case n < command.MinArgs:
+		err = fmt.Errorf("missing arguments")
+	case n > command.MaxArgs && command.MaxArgs != anyArgs:
+		err = fmt.Errorf("too many arguments")
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n%s", err, command.Help(fs))
+		return usageExitCode, nil
+	}
+	return run(parsed)
+}
+
+// takesValue reports whether a flag needs a value, as opposed to one that
+// is given alone (a switch) or may have one attached (`--abbrev[=<n>]`).
+func takesValue(f *flag.Flag) bool {
+	boolFlag, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return !ok || !boolFlag.IsBoolFlag()
+}
+
+func optionalValueFlag(f *flag.Flag) bool {
+	switch f.Value.(type) {
+	case *optionalValue, *countedValue:
+		return true
+	}
+	return false
+}
+
+func lookupLongFlag(fs *flag.FlagSet, name string) (*flag.Flag, string, error) {
+	// Find the flag a long option names: exactly, as the negation of a switch
+	// (`--no-quiet`), or by an unambiguous prefix. The second result is the
+	// value a negation implies.
+	if f := fs.Lookup(name); f != nil {
+		return f, "", nil
+	}
+	if negated, ok := strings.CutPrefix(name, "no-"); ok {
+		if f := fs.Lookup(negated); f != nil && !takesValue(f) {
+			return f, "false", nil
+		}
+	}
+	var matches []*flag.Flag
+	fs.VisitAll(func(f *flag.Flag) {
+		if len(f.Name) > 1 && strings.HasPrefix(f.Name, name) {
+			matches = append(matches, f)
+		}
+	})
+	switch len(matches) {
+	case 0:
+		return nil, "", fmt.Errorf("unknown option `%s'", name)
+	case 1:
+		return matches[0], "", nil
+	}
+	return nil, "", fmt.Errorf("ambiguous option: %s (could be --%s or --%s)", name, matches[0].Name,
+		matches[1].Name)
+}
+
+func parseFlags(fs *flag.FlagSet, args []string) (commandArgs, error) {
+	// Parse GNU-style options: `--long[=value]`, `--long value`, abbreviated and
+	// negated long options, clustered short options (`-qb main`, `-bmain`) and
+	// options after arguments, up to `--`. The options are rewritten into the
+	// `-name=value` form the flag package understands.
+	var parsed commandArgs
+	var flags []string
+	value := func(f *flag.Flag, i *int, attached string, hasAttached bool) (string, error) {
+		if hasAttached {
+			return attached, nil
+		}
+		if *i+1 >= len(args) {
+			return "", fmt.Errorf("option `%s' requires a value", f.Name)
+		}
+		*i++
+		return args[*i], nil
+	}
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--":
+			parsed.paths, parsed.separator = args[i+1:], true
+			return parsed, fs.Parse(flags)
+
+		case arg == "-" || !strings.HasPrefix(arg, "-"):
+			parsed.args = append(parsed.args, arg)
+
+		case arg == "--help" || arg == "-h" && fs.Lookup("h") == nil:
+			return parsed, flag.ErrHelp
+
+		case strings.HasPrefix(arg, "--") || len(arg) > 2 && fs.Lookup(strings.SplitN(arg[1:], "=", 2)[0]) != nil:
+			// A long option, or a multi-letter one given with a single dash.
+			name, attached, hasAttached := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+			f, implied, err := lookupLongFlag(fs, name)
+			if err != nil {
+				return parsed, err
+			}
+			switch {
+			case implied != "":
+				if hasAttached {
+					return parsed, fmt.Errorf("option `no-%s' takes no value", f.Name)
+				}
+				flags = append(flags, "-"+f.Name+"="+implied)
+			case takesValue(f):
+				v, err := value(f, &i, attached, hasAttached)
+				if err != nil {
+					return parsed, err
+				}
+				flags = append(flags, "-"+f.Name+"="+v)
+			case hasAttached:
+				flags = append(flags, "-"+f.Name+"="+attached)
+			default:
+				flags = append(flags, "-"+f.Name)
+			}
+
+		default:
+			// A cluster of short options, the last of which may take a value.
+			for j := 1; j < len(arg); j++ {
+				f := fs.Lookup(arg[j : j+1])
+				if f == nil {
+					return parsed, fmt.Errorf("unknown switch `%c'", arg[j])
+				}
+				rest := strings.TrimPrefix(arg[j+1:], "=")
+				if takesValue(f) {
+					v, err := value(f, &i, rest, rest != "")
+					if err != nil {
+						return parsed, err
+					}
+					flags = append(flags, "-"+f.Name+"="+v)
+					break
+				}
+				if optionalValueFlag(f) && rest != "" {
+					flags = append(flags, "-"+f.Name+"="+rest)
+					break
+				}
+				flags = append(flags, "-"+f.Name)
+			}
+		}
+	}
+	return parsed, fs.Parse(flags)
+}
+
+// sameAs matches the description of a flag that is another name for one
+// described elsewhere, such as "Same as `-q`."
+var sameAs = regexp.MustCompile("^Same as `-+[^`]+`\\.$")
+
+// helpFlag is a line of a command's option list: a flag and its other names.
+type helpFlag struct {
+	names []string
+	usage string
+	flag  *flag.Flag
+}
+
+func helpFlags(fs *flag.FlagSet) []*helpFlag {
+	// Group the names of a command's flags that set the same value, described
+	// by the one that isn't merely "Same as" another.
+	var list []*helpFlag
+	byValue := make(map[flag.Value]*helpFlag)
+	fs.VisitAll(func(f *flag.Flag) {
+		entry, ok := byValue[f.Value]
+		if !ok {
+			entry = &helpFlag{flag: f}
+			byValue[f.Value] = entry
+			list = append(list, entry)
+		}
+		entry.names = append(entry.names, f.Name)
+		if entry.usage == "" || sameAs.MatchString(entry.usage) {
+			entry.usage = strings.TrimPrefix(f.Usage, "(shorthand ver.) ")
+		}
+	})
+	for _, entry := range list {
+		// Short names come first, as in "-q, --quiet".
+		slices.SortStableFunc(entry.names, func(x, y string) int {
+			return min(len(x), 2) - min(len(y), 2)
+		})
+	}
+	slices.SortStableFunc(list, func(x, y *helpFlag) int {
+		return strings.Compare(strings.ToLower(x.names[len(x.names)-1]), strings.ToLower(y.names[len(y.names)-1]))
+	})
+	return list
+}
+
+func (entry *helpFlag) options() []string {
+	// Return the names of the flag as they are typed, such as "-q" and "--quiet".
+	var options []string
+	_, doubled := entry.flag.Value.(doubleCounter)
+	for _, name := range entry.names {
+		if len(name) == 1 || doubled {
+			options = append(options, "-"+name)
+		} else {
+			options = append(options, "--"+name)
+		}
+	}
+	return options
+}
+
+func (entry *helpFlag) spec() string {
+	spec := strings.Join(entry.options(), ", ")
+	switch {
+	case optionalValueFlag(entry.flag):
+		spec += "[=<value>]"
+	case takesValue(entry.flag):
+		spec += " <value>"
+	}
+	return spec
+}
+
+func wrapText(text string, indent, width int) string {
+	// Wrap `text` into lines of at most `width` columns, indenting all but the first.
+	var lines []string
+	line := ""
+	for _, word := range strings.Fields(text) {
+		if line != "" && indent+len(line)+1+len(word) > width {
+			lines = append(lines, line)
+			line = ""
+		}
+		if line != "" {
+			line += " "
+		}
+		line += word
+	}
+	lines = append(lines, line)
+	return strings.Join(lines, "\n"+strings.Repeat(" ", indent))
+}
+
+func (command *Command) Help(fs *flag.FlagSet) string {
+	// Describe the command the way `-h` does in Git: its usage, then its options.
+	const column = 26
+	var help strings.Builder
+	help.WriteString(command.Usage)
+	flags := helpFlags(fs)
+	if len(flags) > 0 {
+		help.WriteString("\n")
+	}
+	for _, entry := range flags {
+		spec := "    " + entry.spec()
+		if len(spec) > column-2 {
+			fmt.Fprintf(&help, "%s\n%s", spec, strings.Repeat(" ", column))
+		} else {
+			fmt.Fprintf(&help, "%-*s", column, spec)
+		}
+		help.WriteString(wrapText(entry.usage, column, 100) + "\n")
+	}
+	return help.String()
+}
+
+func mainHelp() string {
+	var help strings.Builder
+	help.WriteString(MainUsageMsg + "\nThese are the gotgit commands:\n\n")
+	for _, command := range commands {
+		if !command.Hidden {
+			fmt.Fprintf(&help, "   %-16s %s\n", command.Name, command.Summary)
+		}
+	}
+	help.WriteString("\nSee 'gotgit help <command>' to read about a specific command.\n")
+	return help.String()
+}
+
+func HelpCmdHandler(args []string) (int, error) {
+	// Show the commands, the usage and options of one, or what an alias stands for.
+	if len(args) == 0 {
+		fmt.Print(mainHelp())
+		return 0, nil
+	}
+	if command := LookupCommand(args[0]); command != nil {
+		subcommand, _ := command.subcommand(args[1:])
+		fs, _ := command.Setup(subcommand)
+		fmt.Print(command.Help(fs))
+		return 0, nil
+	}
+	if alias, ok := lookupAlias(args[0]); ok {
+		fmt.Printf("'%s' is aliased to '%s'\n", args[0], alias)
+		return 0, nil
+	}
+	return 0, fmt.Errorf("no help for '%s': it is not a gotgit command", args[0])
+}
+
+func lookupAlias(name string) (string, bool) {
+	cfg, err := config.Load()
+	if err != nil {
+		return "", false
+	}
+	return cfg.Get("alias." + name)
+}
+
+func splitCommandLine(line string) ([]string, error) {
+	// Split an alias into words the way Git does: on whitespace, with single
+	// and double quotes and backslash escapes.
+	var words []string
+	var word strings.Builder
+	inWord := false
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote == 0 && (c == ' ' || c == '\t' || c == '\n'):
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+			continue
+		case c == '\\' && quote != '\'':
+			i++
+			if i == len(line) {
+				return nil, fmt.Errorf("unclosed quote")
+			}
+			c = line[i]
+		case c == '"' || c == '\'':
+			if quote == 0 {
+				quote, inWord = c, true
+				continue
+			}
+			if quote == c {
+				quote = 0
+				continue
+			}
+		}
+		word.WriteByte(c)
+		inWord = true
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unclosed quote")
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+func runExternal(name string, args []string) (int, error) {
+	// Run a program with the terminal, passing on its exit status.
+	externalCmd := exec.Command(name, args...)
+	externalCmd.Stdin, externalCmd.Stdout, externalCmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	err := externalCmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode(), nil
+	}
+	return 0, err
+}
+
+// usageError is a command line gotgit can't make sense of.
+type usageError string
+
+func (err usageError) Error() string {
+	return string(err) + "\n" + MainUsageMsg
+}
+
+// globalFlags describe the options globalOptions accepts, for shell completion.
+var globalFlags = []completion.Flag{
+	{Names: []string{"-C"}, Description: "Run as if gotgit was started in <path>.", TakesValue: true},
+	{Names: []string{"-c"}, Description: "Set a config value for this command only.", TakesValue: true},
+	{Names: []string{"--git-dir"}, Description: "Use the repository at <path>.", TakesValue: true},
+	{Names: []string{"-h", "--help"}, Description: "List the commands."},
+}
+
+func globalOptions(args []string) ([]string, error) {
+	// Apply the options that come before the command: `-C <path>` to run from
+	// another directory, `-c <name>=<value>` to set config for this command
+	// only and `--git-dir=<path>` to use another repository.
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") {
+		option := args[0]
+		if gitDir, ok := strings.CutPrefix(option, "--git-dir="); ok {
+			os.Setenv("GIT_DIR", gitDir)
+			args = args[1:]
+			continue
+		}
+		switch option {
+		case "-h", "--help":
+			return append([]string{"help"}, args[1:]...), nil
+		case "-C", "-c", "--git-dir":
+		default:
+			return nil, usageError("unknown option: " + option)
+		}
+		if len(args) < 2 {
+			if option == "-c" {
+				return nil, usageError("-c expects a configuration string")
+			}
+			return nil, usageError("no directory given for " + option)
+		}
+		value := args[1]
+		args = args[2:]
+
+		switch option {
+		case "-C":
+			if value == "" {
+				continue
+			}
+			if err := os.Chdir(value); err != nil {
+				return nil, fmt.Errorf("cannot change to '%s': %w", value, err)
+			}
+		case "-c":
+			// Command-line config reaches the config package, and any gotgit
+			// run by hooks or aliases, through GIT_CONFIG_PARAMETERS.
+			quoted := "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+			if params := os.Getenv("GIT_CONFIG_PARAMETERS"); params != "" {
+				quoted = params + " " + quoted
+			}
+			os.Setenv("GIT_CONFIG_PARAMETERS", quoted)
+		case "--git-dir":
+			os.Setenv("GIT_DIR", value)
+		}
+	}
+	return args, nil
+}
+
+func Run(args []string) (int, error) {
+	// Run the command line `gotgit <args>`: a built-in command, an alias from
+	// the config or an external `gotgit-<name>` program on the PATH.
+	args, err := globalOptions(args)
+	var usage usageError
+	if errors.As(err, &usage) {
+		fmt.Fprint(os.Stderr, usage.Error())
+		return usageExitCode, nil
+	} else if err != nil {
+		return 0, err
+	}
+	if len(args) == 0 {
+		fmt.Print(mainHelp())
+		return 1, nil
+	}
+	if err := LoadGitDir(); err != nil {
+		return 0, err
+	}
+	if err := LoadObjectFormat(); err != nil {
+		return 0, err
+	}
+	if err := LoadSharedRepository(); err != nil {
+		return 0, err
+	}
+
+	expanded := make(map[string]bool)
+	for {
+		name := args[0]
+		if command := LookupCommand(name); command != nil {
+			if !command.NoWorkTree {
+				if err := enterWorkTree(); err != nil {
+					return 0, err
+				}
+			}
+			return command.Run(args[1:])
+		}
+
+		alias, ok := lookupAlias(name)
+		if !ok {
+			break
+		}
+		if shellCommand, ok := strings.CutPrefix(alias, "!"); ok {
+			// Shell aliases get the rest of the command line as arguments.
+			return runExternal("sh", append([]string{"-c", shellCommand + ` "$@"`, shellCommand}, args[1:]...))
+		}
+		if expanded[name] {
+			return 0, fmt.Errorf("alias loop detected: expansion of '%s' does not terminate", name)
+		}
+		expanded[name] = true
+		words, err := splitCommandLine(alias)
+		if err != nil {
+			return 0, fmt.Errorf("bad alias.%s string: %w", name, err)
+		}
+		if len(words) == 0 {
+			return 0, fmt.Errorf("empty alias for %s", name)
+		}
+		args = append(words, args[1:]...)
+	}
+
+	if external, err := exec.LookPath("gotgit-" + args[0]); err == nil {
+		return runExternal(external, args[1:])
+	}
+	fmt.Fprintf(os.Stderr, "gotgit: '%s' is not a gotgit command. See 'gotgit --help'.\n", args[0])
+	return 1, nil
+}
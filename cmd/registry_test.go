@@ -0,0 +1,272 @@
+package cmd
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/tsoud/GoTGit.git/gitobj"
+	"github.com/tsoud/GoTGit.git/internal/testutil"
+)
+
+// testFlags are the values of the options testFlagSet defines.
+type testFlags struct {
+	all, branch, cached, quiet bool
+	lines                      int
+	message, query             string
+	abbrev                     optionalValue
+}
+
+func testFlagSet() (*flag.FlagSet, *testFlags) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(new(strings.Builder))
+	opts := &testFlags{}
+	fs.BoolVar(&opts.all, "a", false, "")
+	fs.BoolVar(&opts.branch, "b", false, "")
+	fs.BoolVar(&opts.cached, "c", false, "")
+	fs.BoolVar(&opts.quiet, "q", false, "")
+	fs.BoolVar(&opts.quiet, "quiet", false, "")
+	fs.IntVar(&opts.lines, "n", 0, "")
+	fs.StringVar(&opts.message, "m", "", "")
+	fs.StringVar(&opts.message, "message", "", "")
+	fs.StringVar(&opts.query, "query", "", "")
+	fs.Var(&opts.abbrev, "abbrev", "")
+	return fs, opts
+}
+
+func TestParseFlags(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want testFlags
+		// parsed are the arguments and paths left over, with the paths after "|".
+		parsed string
+		err    string
+	}{
+		{name: "cluster", args: []string{"-abc", "x"}, want: testFlags{all: true, branch: true, cached: true}, parsed: "x"},
+		{name: "attached value", args: []string{"-n5"}, want: testFlags{lines: 5}},
+		{name: "value after =", args: []string{"-n=5"}, want: testFlags{lines: 5}},
+		{name: "separate value", args: []string{"-n", "5", "x"}, want: testFlags{lines: 5}, parsed: "x"},
+		{name: "value ends a cluster", args: []string{"-qmfix it"}, want: testFlags{quiet: true, message: "fix it"}},
+		{name: "value after a cluster", args: []string{"-qm", "-a"}, want: testFlags{quiet: true, message: "-a"}},
+		{name: "long option", args: []string{"--message=m", "--quiet"}, want: testFlags{quiet: true, message: "m"}},
+		{name: "long option value", args: []string{"--message", "m"}, want: testFlags{message: "m"}},
+		{name: "abbreviated", args: []string{"--mess", "m", "--qui"}, want: testFlags{quiet: true, message: "m"}},
+		{name: "ambiguous", args: []string{"--qu"}, err: "ambiguous option: qu (could be --query or --quiet)"},
+		{name: "negated", args: []string{"-q", "--no-quiet"}, want: testFlags{}},
+		{name: "negated with a value", args: []string{"--no-quiet=1"}, err: "option `no-quiet' takes no value"},
+		{name: "negated value option", args: []string{"--no-message"}, err: "unknown option `no-message'"},
+		{name: "optional value", args: []string{"--abbrev"}, want: testFlags{abbrev: optionalValue{set: true}}},
+		{name: "optional value given", args: []string{"--abbrev=8"}, want: testFlags{abbrev: optionalValue{set: true, value: "8"}}},
+		{name: "single dash long option", args: []string{"-quiet"}, want: testFlags{quiet: true}},
+		{name: "options after arguments", args: []string{"x", "-a", "y"}, want: testFlags{all: true}, parsed: "x y"},
+		{name: "dash is an argument", args: []string{"-", "-a"}, want: testFlags{all: true}, parsed: "-"},
+		{name: "end of options", args: []string{"-a", "x", "--", "-b", "--quiet"}, want: testFlags{all: true}, parsed: "x | -b --quiet"},
+		{name: "nothing after --", args: []string{"--"}, parsed: "|"},
+		{name: "unknown switch", args: []string{"-az"}, err: "unknown switch `z'"},
+		{name: "unknown option", args: []string{"--zap"}, err: "unknown option `zap'"},
+		{name: "missing value", args: []string{"-an"}, err: "option `n' requires a value"},
+		{name: "missing long value", args: []string{"--message"}, err: "option `message' requires a value"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fs, opts := testFlagSet()
+			parsed, err := parseFlags(fs, test.args)
+			if test.err != "" {
+				if err == nil || err.Error() != test.err {
+					t.Fatalf("Wanted the error %q, got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *opts != test.want {
+				t.Errorf("Wanted the options %+v, got %+v", test.want, *opts)
+			}
+			got := strings.Join(parsed.args, " ")
+			if parsed.separator {
+				got = strings.TrimSpace(got + " | " + strings.Join(parsed.paths, " "))
+			}
+			if got != test.parsed {
+				t.Errorf("Wanted the arguments %q, got %q", test.parsed, got)
+			}
+		})
+	}
+
+	fs, _ := testFlagSet()
+	if _, err := parseFlags(fs, []string{"-a", "--help"}); err != flag.ErrHelp {
+		t.Errorf("Wanted --help to ask for help, got %v", err)
+	}
+}
+
+func TestGlobalOptions(t *testing.T) {
+	dir := testutil.ChdirTemp(t)
+	testutil.WriteFiles(t, dir, map[string]string{"a/b/file": ""})
+	dir, _ = filepath.EvalSymlinks(dir)
+
+	tests := []struct {
+		name                string
+		args                []string
+		want                []string
+		gitDir, params, cwd string
+		err                 string
+	}{
+		{name: "no options", args: []string{"status", "-C", "a"}, want: []string{"status", "-C", "a"}},
+		{name: "directories add up", args: []string{"-C", "a", "-C", "b", "ls-tree"}, want: []string{"ls-tree"}, cwd: "a/b"},
+		{name: "empty directory", args: []string{"-C", "", "-C", "a", "x"}, want: []string{"x"}, cwd: "a"},
+		{name: "git dir", args: []string{"--git-dir=repo.git", "x"}, want: []string{"x"}, gitDir: "repo.git"},
+		{name: "git dir value", args: []string{"--git-dir", "repo.git", "-C", "a", "x"}, want: []string{"x"},
+			gitDir: "repo.git", cwd: "a"},
+		{name: "last git dir wins", args: []string{"--git-dir=one", "--git-dir", "two", "x"}, want: []string{"x"},
+			gitDir: "two"},
+		{name: "config", args: []string{"-c", "user.name=A B", "-C", "a", "-c", "alias.x=!echo 'hi'", "x"},
+			want: []string{"x"}, params: `'user.name=A B' 'alias.x=!echo '\''hi'\'''`, cwd: "a"},
+		{name: "help", args: []string{"-C", "a", "--help", "merge"}, want: []string{"help", "merge"}, cwd: "a"},
+		{name: "no config value", args: []string{"-c"}, err: "-c expects a configuration string"},
+		{name: "no directory", args: []string{"-C", "a", "-C"}, err: "no directory given for -C"},
+		{name: "no git dir", args: []string{"--git-dir"}, err: "no directory given for --git-dir"},
+		{name: "unknown option", args: []string{"--bare", "x"}, err: "unknown option: --bare"},
+		{name: "missing directory", args: []string{"-C", "missing", "x"}, err: "cannot change to 'missing'"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("GIT_DIR", "")
+			t.Setenv("GIT_CONFIG_PARAMETERS", "")
+			t.Cleanup(func() { os.Chdir(dir) })
+
+			args, err := globalOptions(test.args)
+			if test.err != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), test.err) {
+					t.Fatalf("Wanted the error %q, got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(args, test.want) {
+				t.Errorf("Wanted the command line %q, got %q", test.want, args)
+			}
+			if got := os.Getenv("GIT_DIR"); got != test.gitDir {
+				t.Errorf("Wanted GIT_DIR %q, got %q", test.gitDir, got)
+			}
+			if got := os.Getenv("GIT_CONFIG_PARAMETERS"); got != test.params {
+				t.Errorf("Wanted GIT_CONFIG_PARAMETERS %q, got %q", test.params, got)
+			}
+			cwd, _ := os.Getwd()
+			if want := filepath.Join(dir, test.cwd); cwd != want {
+				t.Errorf("Wanted to run in %s, got %s", want, cwd)
+			}
+		})
+	}
+
+	// `-c` adds to the config a parent gotgit passed on.
+	t.Setenv("GIT_CONFIG_PARAMETERS", "'core.bare=false'")
+	if _, err := globalOptions([]string{"-c", "a.b=c", "x"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := os.Getenv("GIT_CONFIG_PARAMETERS"); got != "'core.bare=false' 'a.b=c'" {
+		t.Errorf("Wanted -c to be appended to GIT_CONFIG_PARAMETERS, got %q", got)
+	}
+}
+
+func TestSplitCommandLine(t *testing.T) {
+	tests := []struct {
+		line string
+		want []string
+		err  bool
+	}{
+		{line: "", want: nil},
+		{line: "  log  --oneline\t-n 3 ", want: []string{"log", "--oneline", "-n", "3"}},
+		{line: `commit -m "two words"`, want: []string{"commit", "-m", "two words"}},
+		{line: `commit -m 'it''s'`, want: []string{"commit", "-m", "its"}},
+		{line: `x "it's" 'say "hi"'`, want: []string{"x", "it's", `say "hi"`}},
+		{line: `x a\ b \"c\"`, want: []string{"x", "a b", `"c"`}},
+		{line: `x 'a\b' "a\"b"`, want: []string{"x", `a\b`, `a"b`}},
+		{line: `x "" ''`, want: []string{"x", "", ""}},
+		{line: `x pre"fix"ed`, want: []string{"x", "prefixed"}},
+		{line: `x "unclosed`, err: true},
+		{line: `x 'unclosed`, err: true},
+		{line: `x trailing\`, err: true},
+	}
+	for _, test := range tests {
+		words, err := splitCommandLine(test.line)
+		if test.err {
+			if err == nil {
+				t.Errorf("Wanted an error splitting %q, got %q", test.line, words)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(words, test.want) {
+			t.Errorf("Wanted %q split into %q, got %q (%v)", test.line, test.want, words, err)
+		}
+	}
+}
+
+func TestAliases(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("shell aliases run sh")
+	}
+	testutil.InitRepo(t)
+	testutil.IsolateConfig(t)
+	t.Setenv("GIT_DIR", "")
+	gitDir := gitobj.GitDir
+	t.Cleanup(func() { gitobj.SetGitDir(gitDir) })
+	testutil.WriteFiles(t, ".", map[string]string{"a b.txt": "spaced\n", "other.txt": "other\n"})
+	testutil.WriteFiles(t, gitobj.GitDir, map[string]string{"config": "[alias]\n" +
+		"\thw = hash-object -w 'a b.txt'\n" +
+		"\thash = hw\n" +
+		"\tloop = again\n" +
+		"\tagain = loop\n" +
+		"\tself = self -v\n" +
+		"\tempty = \"\"\n" +
+		"\tunclosed = hash-object 'a b.txt\n" +
+		"\tsh = \"!f() { printf '%s|' \\\"$@\\\" > out; }; f\"\n" +
+		"\tviash = sh 'from alias'\n"})
+
+	// Aliases expand to other aliases, with their quoted words kept whole and
+	// the rest of the command line after them.
+	if status, err := Run([]string{"hash", "other.txt"}); status != 0 || err != nil {
+		t.Fatalf("Wanted the alias to run, got %d (%v)", status, err)
+	}
+	for _, contents := range []string{"spaced\n", "other\n"} {
+		object, _ := gitobj.HashObject("blob", []byte(contents))
+		if _, err := gitobj.ReadGitObj(object.Hash); err != nil {
+			t.Errorf("Wanted the alias to write %q: %v", contents, err)
+		}
+	}
+
+	for _, test := range []struct{ alias, err string }{
+		{"loop", "alias loop detected: expansion of 'loop' does not terminate"},
+		{"self", "alias loop detected: expansion of 'self' does not terminate"},
+		{"empty", "empty alias for empty"},
+		{"unclosed", "bad alias.unclosed string: unclosed quote"},
+	} {
+		if _, err := Run([]string{test.alias}); err == nil || err.Error() != test.err {
+			t.Errorf("Wanted the error %q for alias.%s, got %v", test.err, test.alias, err)
+		}
+	}
+
+	// Shell aliases get each argument as it was given, and so do aliases set
+	// with `-c`.
+	for _, test := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"sh", "a b", "it's", `"q"`}, `a b|it's|"q"|`},
+		{[]string{"viash", "$HOME"}, "from alias|$HOME|"},
+		{[]string{"-c", `alias.cl=!f() { printf '%s|' "$@" > out; }; f "it's"`, "cl", "x y"}, "it's|x y|"},
+	} {
+		if status, err := Run(test.args); status != 0 || err != nil {
+			t.Fatalf("Wanted %q to run, got %d (%v)", test.args, status, err)
+		}
+		if got := testutil.ReadFile(t, "out"); got != test.want {
+			t.Errorf("Wanted %q to get the arguments %q, got %q", test.args, test.want, got)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/tsoud/GoTGit.git/gc"
+	"github.com/tsoud/GoTGit.git/gitobj"
+)
+
+const RepackUsageMsg = "usage: repack [-a] [-A] [-d] [-f] [-q] [--window=<n>] [--depth=<n>]\n" +
+	"              [--unpack-unreachable=<when>]\n"
+
+type RepackOptions struct {
+	all               bool
+	loosenUnreachable bool
+	delete            bool
+	noReuseDelta      bool
+	quiet             bool
+	window            int
+	depth             int
+	unpackUnreachable string
+}
+
+func SetupRepackCmd() (*flag.FlagSet, *RepackOptions) {
+	repackCmd := flag.NewFlagSet("repack", flag.ExitOnError)
+	opts := &RepackOptions{}
+
+	repackCmd.BoolVar(&opts.all, "a", false, "Pack everything reachable into a single pack, "+
+		"including objects already in packs.")
+	repackCmd.BoolVar(&opts.loosenUnreachable, "A", false, "Like `-a`, but with `-d` unreachable "+
+		"objects in the old packs are made loose instead of being dropped.")
+	repackCmd.BoolVar(&opts.delete, "d", false, "Remove packs and loose objects made redundant "+
+		"by the new pack.")
+	repackCmd.BoolVar(&opts.noReuseDelta, "f", false, "Search for deltas again instead of "+
+		"reusing those in existing packs.")
+	repackCmd.BoolVar(&opts.quiet, "q", false, "Don't report what was packed.")
+	repackCmd.IntVar(&opts.window, "window", gitobj.DefaultPackWindow, "The number of objects "+
+		"to compare each object with when looking for deltas.")
+	repackCmd.IntVar(&opts.depth, "depth", gitobj.DefaultPackDepth, "The longest chain of deltas "+
+		"allowed.")
+	repackCmd.StringVar(&opts.unpackUnreachable, "unpack-unreachable", "never", "With `-A -d`, "+
+		"drop unreachable objects from packs older than this instead of making them loose.")
+
+	return repackCmd, opts
+}
+
+func RepackCmdHandler(opts *RepackOptions) error {
+	// Pack the repository's objects, reporting the new pack unless quiet.
+	unpackExpire, err := gc.ParseExpiry(opts.unpackUnreachable, time.Now())
+	if err != nil {
+		return err
+	}
+	written, err := gc.Repack(&gc.RepackOptions{
+		All:               opts.all,
+		LoosenUnreachable: opts.loosenUnreachable,
+		UnpackExpire:      unpackExpire,
+		Delete:            opts.delete,
+		Pack: gitobj.PackOptions{
+			Window:      opts.window,
+			Depth:       opts.depth,
+			ReuseDeltas: !opts.noReuseDelta,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if !opts.quiet {
+		reportPack(written)
+	}
+	return nil
+}
+
+func reportPack(written *gitobj.WrittenPack) {
+	if written == nil {
+		fmt.Println("Nothing new to pack.")
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Total %d (delta %d), reused %d (delta %d)\n",
+		written.Objects, written.Deltas, written.ReusedDeltas, written.ReusedDeltas)
+}
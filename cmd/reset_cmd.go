@@ -0,0 +1,242 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/tsoud/GoTGit.git/gitobj"
+	"github.com/tsoud/GoTGit.git/index"
+	"github.com/tsoud/GoTGit.git/refs"
+	"github.com/tsoud/GoTGit.git/worktree"
+)
+
+const ResetUsageMsg = "usage: reset [--mixed | --soft | --hard | --merge | --keep] [-q] [<commit>]\n" +
+	"   or: reset [-q] [<tree-ish>] [--] <pathspec>...\n"
+
+type ResetOptions struct {
+	soft  bool
+	mixed bool
+	hard  bool
+	merge bool
+	keep  bool
+	quiet bool
+}
+
+func SetupResetCmd() (*flag.FlagSet, *ResetOptions) {
+	resetCmd := flag.NewFlagSet("reset", flag.ExitOnError)
+	opts := &ResetOptions{}
+
+	resetCmd.BoolVar(&opts.soft, "soft", false, "Only move HEAD, leaving the index and working tree alone.")
+	resetCmd.BoolVar(&opts.mixed, "mixed", false, "Move HEAD and reset the index, but not the working tree "+
+		"(the default).")
+	resetCmd.BoolVar(&opts.hard, "hard", false, "Move HEAD and reset the index and working tree, "+
+		"discarding all changes to tracked files.")
+	resetCmd.BoolVar(&opts.merge, "merge", false, "Reset the index and update the files that differ "+
+		"from <commit>, keeping unstaged changes to other files.")
+	resetCmd.BoolVar(&opts.keep, "keep", false, "Move HEAD and update the files that differ between HEAD "+
+		"and <commit>, aborting if they have local changes.")
+	resetCmd.BoolVar(&opts.quiet, "q", false, "Only report errors.")
+	resetCmd.BoolVar(&opts.quiet, "quiet", false, "Same as `-q`.")
+
+	return resetCmd, opts
+}
+
+func cleanupBranchState() {
+	// Forget about a merge, cherry-pick or revert in progress, as a reset does.
+	cleanupMergeState()
+	cleanupSequencerState()
+	os.Remove(gitFile("SQUASH_MSG"))
+}
+
+func printUnstagedChanges(idx *index.Index) error {
+	// List the working tree files that differ from the index.
+	var lines []string
+	for _, entry := range idx.Entries {
+		if entry.Stage > 0 {
+			if len(lines) == 0 || lines[len(lines)-1] != "U\t"+entry.Path {
+				lines = append(lines, "U\t"+entry.Path)
+			}
+			continue
+		}
+		modified, err := worktree.IsModified(entry)
+		if err != nil {
+			return err
+		}
+		switch {
+		case !worktree.Exists(entry.Path):
+			lines = append(lines, "D\t"+entry.Path)
+		case modified:
+			lines = append(lines, "M\t"+entry.Path)
+		}
+	}
+	if len(lines) > 0 {
+		fmt.Println("Unstaged changes after reset:")
+		for _, line := range lines {
+			fmt.Println(line)
+		}
+	}
+	return nil
+}
+
+func ResetCmdHandler(args, pathspecs []string, hasSeparator bool, opts *ResetOptions) error {
+	// Without `--`, the first argument is a revision if it resolves to one and
+	// the remaining arguments are paths.
+	if !hasSeparator && len(args) > 0 {
+		if _, err := refs.ResolveRevision(args[0]); err != nil {
+			args, pathspecs = nil, args
+		} else if len(args) > 1 {
+			args, pathspecs = args[:1], args[1:]
+		}
+		for _, pathspec := range pathspecs {
+			if !worktree.Exists(prefixPath(pathspec)) {
+				return fmt.Errorf("ambiguous argument '%s': unknown revision or path not in the working tree.\n"+
+					"Use '--' to separate paths from revisions", pathspec)
+			}
+		}
+	}
+	if len(args) > 1 {
+		return fmt.Errorf("too many arguments\n%s", ResetUsageMsg)
+	}
+	pathspecs = prefixPaths(pathspecs)
+
+	mode, modes := "mixed", 0
+	for name, set := range map[string]bool{
+		"soft": opts.soft, "mixed": opts.mixed, "hard": opts.hard, "merge": opts.merge, "keep": opts.keep,
+	} {
+		if set {
+			mode = name
+			modes++
+		}
+	}
+	if modes > 1 {
+		return fmt.Errorf("--soft, --mixed, --hard, --merge and --keep cannot be used together")
+	}
+
+	rev := "HEAD"
+	if len(args) == 1 {
+		rev = args[0]
+	}
+	if len(pathspecs) > 0 {
+		if mode != "mixed" {
+			return fmt.Errorf("Cannot do %s reset with paths.", mode)
+		}
+		return resetPaths(rev, pathspecs, opts)
+	}
+	return resetHead(rev, mode, opts)
+}
+
+func resetPaths(treeish string, pathspecs []string, opts *ResetOptions) error {
+	// Copy the index entries of the matching paths from `treeish`, leaving HEAD
+	// and the working tree alone.
+	files := make(map[string]gitobj.TreeEntry)
+	if _, err := refs.Resolve(refs.HEAD); err == nil || treeish != "HEAD" {
+		// On an unborn branch, resetting paths simply unstages them.
+		if files, err = sourceFiles(treeish); err != nil {
+			return err
+		}
+	}
+	idx, err := index.Read()
+	if err != nil {
+		return err
+	}
+	var candidates []string
+	for filePath := range files {
+		candidates = append(candidates, filePath)
+	}
+	for _, entry := range idx.Entries {
+		candidates = append(candidates, entry.Path)
+	}
+	paths, _ := matchPaths(candidates, pathspecs)
+	resetIndexPaths(idx, files, paths)
+	if err := idx.Write(); err != nil {
+		return err
+	}
+	if opts.quiet {
+		return nil
+	}
+	return printUnstagedChanges(idx)
+}
+
+func resetHead(rev, mode string, opts *ResetOptions) error {
+	// Point the current branch (or a detached HEAD) at `rev` and update the
+	// index and working tree according to `mode`.
+	head, headErr := refs.Resolve(refs.HEAD)
+	if headErr != nil && headErr != refs.ErrNotFound {
+		return headErr
+	}
+	unborn := headErr == refs.ErrNotFound
+
+	target := ""
+	if !unborn || rev != "HEAD" {
+		var err error
+		if target, err = refs.ResolveCommit(rev); err != nil {
+			return fmt.Errorf("Failed to resolve '%s' as a valid revision.", rev)
+		}
+	}
+	targetTree, err := commitTree(target)
+	if err != nil {
+		return err
+	}
+	headTree, err := commitTree(head)
+	if err != nil {
+		return err
+	}
+	if mode == "soft" && (refs.Exists("MERGE_HEAD") || stoppedCommand() != "") {
+		return fmt.Errorf("Cannot do a soft reset in the middle of a merge.")
+	}
+
+	idx, err := index.Read()
+	if err != nil {
+		return err
+	}
+	switch mode {
+	case "mixed":
+		err = idx.OneWayMerge(targetTree)
+	case "hard":
+		err = resetHard(idx, targetTree)
+	case "merge":
+		// Only files that differ from the target are written; they must not have
+		// unstaged changes.
+		before := slices.Clone(idx.Entries)
+		if err = idx.OneWayMerge(targetTree); err == nil {
+			err = worktree.ApplyIndex(before, idx, false)
+		}
+	case "keep":
+		if len(idx.Unmerged()) > 0 {
+			err = fmt.Errorf("you need to resolve your current index first")
+		} else {
+			_, err = worktree.Checkout(idx, headTree, targetTree, &worktree.CheckoutOptions{})
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("%s\nCould not reset index file to revision '%s'.", err, rev)
+	}
+	if mode != "soft" {
+		if err := idx.Write(); err != nil {
+			return err
+		}
+	}
+
+	if target != "" {
+		if !unborn {
+			if err := refs.Update("ORIG_HEAD", head, ""); err != nil {
+				return err
+			}
+		}
+		if err := refs.UpdateHead(target, "reset: moving to "+rev); err != nil {
+			return err
+		}
+	}
+	cleanupBranchState()
+
+	switch {
+	case opts.quiet:
+	case mode == "hard" && target != "":
+		fmt.Printf("HEAD is now at %s\n", headLine(target))
+	case mode == "mixed":
+		return printUnstagedChanges(idx)
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/tsoud/GoTGit.git/internal/testutil"
+	"github.com/tsoud/GoTGit.git/refs"
+)
+
+// setupReset checks out "main" with two commits: the second changes "a" and
+// adds "c", and neither touches "b". Returns the commits, oldest first.
+func setupReset(t *testing.T) (string, string) {
+	t.Helper()
+	initWorkRepo(t)
+	first := commitFiles(t, "first", map[string]string{"a": "a1\n", "b": "b1\n"})
+	second := commitFiles(t, "second", map[string]string{"a": "a2\n", "b": "b1\n", "c": "c2\n"}, first)
+	checkoutBranch(t, "main", second)
+	return first, second
+}
+
+func TestResetModes(t *testing.T) {
+	tests := []struct {
+		mode string
+		// local are changes made to the working tree before the reset.
+		local map[string]string
+		// index and files are the contents of the index and working tree
+		// afterwards; "" means the file is missing.
+		index, files map[string]string
+		err          string
+	}{
+		{mode: "--soft",
+			index: map[string]string{"a": "a2\n", "c": "c2\n"},
+			files: map[string]string{"a": "a2\n", "c": "c2\n"}},
+		{mode: "--mixed",
+			index: map[string]string{"a": "a1\n", "c": ""},
+			files: map[string]string{"a": "a2\n", "c": "c2\n"}},
+		{mode: "--hard", local: map[string]string{"b": "local change\n"},
+			index: map[string]string{"a": "a1\n", "b": "b1\n", "c": ""},
+			files: map[string]string{"a": "a1\n", "b": "b1\n", "c": ""}},
+
+		// --keep and --merge keep local changes to files that are the same in
+		// both commits, and refuse to overwrite the others.
+		{mode: "--keep", local: map[string]string{"b": "local change\n"},
+			index: map[string]string{"a": "a1\n", "b": "b1\n", "c": ""},
+			files: map[string]string{"a": "a1\n", "b": "local change\n", "c": ""}},
+		{mode: "--keep", local: map[string]string{"a": "local change\n"},
+			err: "Your local changes to the following files would be overwritten"},
+		{mode: "--keep", local: map[string]string{"c": "local change\n"},
+			err: "Your local changes to the following files would be overwritten"},
+		{mode: "--merge", local: map[string]string{"b": "local change\n"},
+			index: map[string]string{"a": "a1\n", "b": "b1\n", "c": ""},
+			files: map[string]string{"a": "a1\n", "b": "local change\n", "c": ""}},
+		{mode: "--merge", local: map[string]string{"a": "local change\n"},
+			err: "Entry 'a' not uptodate. Cannot merge."},
+	}
+	for _, test := range tests {
+		t.Run(strings.TrimPrefix(test.mode, "--"), func(t *testing.T) {
+			first, second := setupReset(t)
+			testutil.WriteFiles(t, ".", test.local)
+
+			_, err := Run([]string{"reset", "-q", test.mode, "HEAD~1"})
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("Wanted the error %q, got %v", test.err, err)
+				}
+				if head := mustResolveHead(); head != second {
+					t.Errorf("Wanted HEAD left alone, got %s", head)
+				}
+				checkFiles(t, test.local)
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if head := mustResolveHead(); head != first {
+				t.Errorf("Wanted HEAD at the first commit, got %s", head)
+			}
+			if origHead, _ := refs.Resolve("ORIG_HEAD"); origHead != second {
+				t.Errorf("Wanted ORIG_HEAD at the old HEAD, got %s", origHead)
+			}
+			for name, want := range test.index {
+				if got := showFile(t, ":"+name); got != want {
+					t.Errorf("Wanted %s staged as %q, got %q", name, want, got)
+				}
+			}
+			checkFiles(t, test.files)
+		})
+	}
+}
+
+func TestResetMergeDiscardsStagedChanges(t *testing.T) {
+	// --merge resets staged changes, as after a merge with conflicts, while
+	// keeping unstaged ones.
+	setupReset(t)
+	stageFiles(t, map[string]string{"a": "staged change\n"})
+	testutil.WriteFiles(t, ".", map[string]string{"b": "local change\n"})
+	gotgit(t, "reset", "--merge")
+	if got := showFile(t, ":a"); got != "a2\n" {
+		t.Errorf("Wanted the staged change reset, got %q", got)
+	}
+	checkFiles(t, map[string]string{"a": "a2\n", "b": "local change\n"})
+
+	// A file with both staged and unstaged changes can't be reset.
+	stageFiles(t, map[string]string{"a": "staged change\n"})
+	testutil.WriteFiles(t, ".", map[string]string{"a": "unstaged change\n"})
+	if _, err := Run([]string{"reset", "--merge"}); err == nil {
+		t.Error("Wanted --merge to refuse to lose unstaged changes")
+	}
+	checkFiles(t, map[string]string{"a": "unstaged change\n"})
+}
+
+func TestResetPaths(t *testing.T) {
+	first, second := setupReset(t)
+	stageFiles(t, map[string]string{"a": "staged a\n", "b": "staged b\n"})
+
+	// Paths are reset in the index only, from HEAD or the commit given.
+	gotgit(t, "reset", "-q", "a")
+	if got := showFile(t, ":a"); got != "a2\n" {
+		t.Errorf("Wanted a unstaged, got %q", got)
+	}
+	if got := showFile(t, ":b"); got != "staged b\n" {
+		t.Errorf("Wanted b left staged, got %q", got)
+	}
+	gotgit(t, "reset", "-q", first, "a", "b")
+	if showFile(t, ":a") != "a1\n" || showFile(t, ":b") != "b1\n" {
+		t.Errorf("Wanted a and b staged as in the first commit, got %q and %q", showFile(t, ":a"), showFile(t, ":b"))
+	}
+	gotgit(t, "reset", "-q", "HEAD~1", "--", "c")
+	if got := showFile(t, ":c"); got != "" {
+		t.Errorf("Wanted c, which isn't in the first commit, removed from the index, got %q", got)
+	}
+	if head := mustResolveHead(); head != second {
+		t.Errorf("Wanted HEAD left alone, got %s", head)
+	}
+	checkFiles(t, map[string]string{"a": "staged a\n", "b": "staged b\n", "c": "c2\n"})
+
+	for _, test := range []struct {
+		args []string
+		err  string
+	}{
+		{[]string{"--hard", "--", "a"}, "Cannot do hard reset with paths."},
+		{[]string{"--soft", "HEAD", "a"}, "Cannot do soft reset with paths."},
+		{[]string{"nothing"}, "ambiguous argument 'nothing'"},
+		{[]string{"HEAD", "HEAD~1"}, "ambiguous argument 'HEAD~1'"},
+		{[]string{"--soft", "--hard"}, "cannot be used together"},
+	} {
+		if _, err := Run(append([]string{"reset"}, test.args...)); err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("Wanted reset %q to fail with %q, got %v", test.args, test.err, err)
+		}
+	}
+}
@@ -0,0 +1,244 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"slices"
+
+	"github.com/tsoud/GoTGit.git/gitobj"
+	"github.com/tsoud/GoTGit.git/index"
+	"github.com/tsoud/GoTGit.git/refs"
+	"github.com/tsoud/GoTGit.git/worktree"
+)
+
+const RestoreUsageMsg = "usage: restore [--source=<tree-ish>] [--staged] [--worktree] " +
+	"[--ours | --theirs | -m] [--] <pathspec>...\n"
+
+type RestoreOptions struct {
+	source         string
+	staged         bool
+	worktree       bool
+	ours           bool
+	theirs         bool
+	merge          bool
+	ignoreUnmerged bool
+	quiet          bool
+}
+
+func SetupRestoreCmd() (*flag.FlagSet, *RestoreOptions) {
+	restoreCmd := flag.NewFlagSet("restore", flag.ExitOnError)
+	opts := &RestoreOptions{}
+
+	restoreCmd.StringVar(&opts.source, "s", "", "Restore from <tree-ish> instead of the index "+
+		"(or HEAD with --staged).")
+	restoreCmd.StringVar(&opts.source, "source", "", "Same as `-s`.")
+	restoreCmd.BoolVar(&opts.staged, "S", false, "Restore the index.")
+	restoreCmd.BoolVar(&opts.staged, "staged", false, "Same as `-S`.")
+	restoreCmd.BoolVar(&opts.worktree, "W", false, "Restore the working tree (the default without --staged).")
+	restoreCmd.BoolVar(&opts.worktree, "worktree", false, "Same as `-W`.")
+	restoreCmd.BoolVar(&opts.ours, "ours", false, "Restore stage #2 (ours) of unmerged paths.")
+	restoreCmd.BoolVar(&opts.theirs, "theirs", false, "Restore stage #3 (theirs) of unmerged paths.")
+	restoreCmd.BoolVar(&opts.merge, "m", false, "Recreate the conflicted merge of unmerged paths.")
+	restoreCmd.BoolVar(&opts.merge, "merge", false, "Same as `-m`.")
+	restoreCmd.BoolVar(&opts.ignoreUnmerged, "ignore-unmerged", false,
+		"Skip unmerged paths instead of failing.")
+	restoreCmd.BoolVar(&opts.quiet, "q", false, "Suppress feedback messages.")
+	restoreCmd.BoolVar(&opts.quiet, "quiet", false, "Same as `-q`.")
+
+	return restoreCmd, opts
+}
+
+func sourceFiles(treeish string) (map[string]gitobj.TreeEntry, error) {
+	// Read the files of `treeish` by path.
+	hash, err := refs.ResolveRevision(treeish)
+	if err != nil {
+		return nil, fmt.Errorf("could not resolve %s", treeish)
+	}
+	treeHash, err := refs.Peel(hash, "tree")
+	if err != nil {
+		return nil, err
+	}
+	files, err := gitobj.ReadTreeRecursive(treeHash)
+	if err != nil {
+		return nil, err
+	}
+	byPath := make(map[string]gitobj.TreeEntry, len(files))
+	for _, file := range files {
+		byPath[file.Name] = file
+	}
+	return byPath, nil
+}
+
+func matchPaths(candidates []string, pathspecs []string) ([]string, map[string]bool) {
+	// Select the sorted, unique candidates matching `pathspecs`, and record which
+	// pathspecs matched something.
+	matched := make(map[string]bool)
+	var paths []string
+	for _, filePath := range candidates {
+		if !worktree.MatchPathspec(filePath, pathspecs) {
+			continue
+		}
+		for _, spec := range pathspecs {
+			if worktree.MatchPathspec(filePath, []string{spec}) {
+				matched[spec] = true
+			}
+		}
+		paths = append(paths, filePath)
+	}
+	slices.Sort(paths)
+	return slices.Compact(paths), matched
+}
+
+func resetIndexPaths(idx *index.Index, files map[string]gitobj.TreeEntry, paths []string) {
+	// Make the index entries of `paths` match `files`, dropping paths that are
+	// not there. Entries already matching keep their stat information.
+	for _, filePath := range paths {
+		file, ok := files[filePath]
+		if !ok {
+			idx.Remove(filePath)
+			continue
+		}
+		if current := idx.Find(filePath, 0); current != nil && current.Hash == file.Hash &&
+			current.ModeString() == file.Mode {
+			continue
+		}
+		idx.Add(&index.Entry{Path: filePath, Mode: index.ParseMode(file.Mode), Hash: file.Hash})
+	}
+}
+
+func RestoreCmdHandler(pathspecs []string, opts *RestoreOptions) error {
+	// Restore files in the working tree and/or the index from the index or from
+	// a tree-ish. Like Git, files matching the pathspecs that are missing from
+	// the source are removed.
+	if len(pathspecs) == 0 {
+		return fmt.Errorf("you must specify path(s) to restore")
+	}
+	toWorktree := opts.worktree || !opts.staged
+	source := opts.source
+	if source == "" && opts.staged {
+		source = "HEAD"
+	}
+	switch {
+	case opts.ours && opts.theirs:
+		return fmt.Errorf("--ours and --theirs cannot be used together")
+	case (opts.ours || opts.theirs || opts.merge) && (source != "" || opts.staged):
+		return fmt.Errorf("--ours, --theirs and --merge cannot be used with --source or --staged")
+	}
+
+	idx, err := index.Read()
+	if err != nil {
+		return err
+	}
+	if source == "" {
+		return restoreFromIndex(idx, pathspecs, opts)
+	}
+
+	files, err := sourceFiles(source)
+	if err != nil {
+		return err
+	}
+	var candidates []string
+	for filePath := range files {
+		candidates = append(candidates, filePath)
+	}
+	tracked := make(map[string]bool)
+	for _, entry := range idx.Entries {
+		candidates = append(candidates, entry.Path)
+		tracked[entry.Path] = true
+	}
+	paths, matched := matchPaths(candidates, pathspecs)
+	if err := checkPathspecsMatched(pathspecs, matched); err != nil {
+		return err
+	}
+
+	if toWorktree {
+		for _, filePath := range paths {
+			file, ok := files[filePath]
+			switch {
+			case ok:
+				if err := worktree.WriteFile(filePath, file.Hash, file.Mode); err != nil {
+					return err
+				}
+			case tracked[filePath]:
+				if err := worktree.RemoveFile(filePath); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if opts.staged {
+		resetIndexPaths(idx, files, paths)
+	}
+	if toWorktree {
+		// Refresh the stat information of entries that now match their file.
+		for _, filePath := range paths {
+			entry := idx.Find(filePath, 0)
+			if file, ok := files[filePath]; ok && entry != nil && entry.Hash == file.Hash {
+				updated, err := worktree.NewEntry(filePath, file.Hash, file.Mode)
+				if err != nil {
+					return err
+				}
+				idx.Add(updated)
+			}
+		}
+	}
+	return idx.Write()
+}
+
+func restoreFromIndex(idx *index.Index, pathspecs []string, opts *RestoreOptions) error {
+	// Restore working tree files from the index. Unmerged paths need --ours,
+	// --theirs or --merge to pick what to write.
+	var candidates []string
+	for _, entry := range idx.Entries {
+		candidates = append(candidates, entry.Path)
+	}
+	paths, matched := matchPaths(candidates, pathspecs)
+	if err := checkPathspecsMatched(pathspecs, matched); err != nil {
+		return err
+	}
+
+	var unmerged []string
+	for _, filePath := range paths {
+		if idx.Find(filePath, 0) == nil && !opts.ours && !opts.theirs && !opts.merge && !opts.ignoreUnmerged {
+			unmerged = append(unmerged, filePath)
+		}
+	}
+	if len(unmerged) > 0 {
+		return fmt.Errorf("path '%s' is unmerged", unmerged[0])
+	}
+
+	for _, filePath := range paths {
+		if entry := idx.Find(filePath, 0); entry != nil {
+			if err := worktree.WriteFile(filePath, entry.Hash, entry.ModeString()); err != nil {
+				return err
+			}
+			updated, err := worktree.NewEntry(filePath, entry.Hash, entry.ModeString())
+			if err != nil {
+				return err
+			}
+			idx.Add(updated)
+			continue
+		}
+
+		switch {
+		case opts.ours || opts.theirs:
+			stage := 2
+			if opts.theirs {
+				stage = 3
+			}
+			entry := idx.Find(filePath, stage)
+			if entry == nil {
+				return fmt.Errorf("path '%s' does not have %s version", filePath,
+					map[int]string{2: "our", 3: "their"}[stage])
+			}
+			if err := worktree.WriteFile(filePath, entry.Hash, entry.ModeString()); err != nil {
+				return err
+			}
+		case opts.merge:
+			if err := recreateConflict(idx, filePath); err != nil {
+				return err
+			}
+		}
+	}
+	return idx.Write()
+}
@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/tsoud/GoTGit.git/index"
+	"github.com/tsoud/GoTGit.git/internal/testutil"
+)
+
+func TestRestore(t *testing.T) {
+	tests := []struct {
+		args []string
+		// index and files are the contents of the index and working tree
+		// afterwards; "" means the file is missing.
+		index, files map[string]string
+	}{
+		{args: []string{"a", "b"},
+			index: map[string]string{"a": "staged a\n", "b": "b1\n"},
+			files: map[string]string{"a": "staged a\n", "b": "b1\n"}},
+		{args: []string{"--staged", "a"},
+			index: map[string]string{"a": "a2\n", "b": "b1\n"},
+			files: map[string]string{"a": "local a\n", "b": "local b\n"}},
+		{args: []string{"-S", "-W", "."},
+			index: map[string]string{"a": "a2\n", "b": "b1\n"},
+			files: map[string]string{"a": "a2\n", "b": "b1\n"}},
+		{args: []string{"--source=HEAD~1", "a", "b"},
+			index: map[string]string{"a": "staged a\n", "b": "b1\n"},
+			files: map[string]string{"a": "a1\n", "b": "b1\n"}},
+		{args: []string{"--source", "HEAD~1", "--staged", "a", "c"},
+			index: map[string]string{"a": "a1\n", "c": ""},
+			files: map[string]string{"a": "local a\n", "c": "c2\n"}},
+		{args: []string{"-s", "HEAD~1", "--staged", "--worktree", "c"},
+			index: map[string]string{"c": ""},
+			files: map[string]string{"c": ""}},
+		{args: []string{"--source=HEAD~1", "c"},
+			index: map[string]string{"c": "c2\n"},
+			files: map[string]string{"c": ""}},
+		{args: []string{"--source=HEAD~1", "*"},
+			index: map[string]string{"a": "staged a\n", "c": "c2\n"},
+			files: map[string]string{"a": "a1\n", "b": "b1\n", "c": ""}},
+	}
+	for _, test := range tests {
+		t.Run(strings.Join(test.args, " "), func(t *testing.T) {
+			setupReset(t)
+			stageFiles(t, map[string]string{"a": "staged a\n"})
+			testutil.WriteFiles(t, ".", map[string]string{"a": "local a\n", "b": "local b\n"})
+
+			gotgit(t, append([]string{"restore"}, test.args...)...)
+			for name, want := range test.index {
+				if got := showFile(t, ":"+name); got != want {
+					t.Errorf("Wanted %s staged as %q, got %q", name, want, got)
+				}
+			}
+			checkFiles(t, test.files)
+		})
+	}
+
+	setupReset(t)
+	for _, test := range []struct {
+		args []string
+		err  string
+	}{
+		{nil, "you must specify path(s) to restore"},
+		{[]string{"nothing"}, "pathspec 'nothing' did not match any file(s) known to gotgit"},
+		{[]string{"--source=HEAD~1", "a", "nothing"}, "pathspec 'nothing' did not match"},
+		{[]string{"--source=missing", "a"}, "could not resolve missing"},
+		{[]string{"--ours", "--staged", "a"}, "cannot be used with --source or --staged"},
+		{[]string{"--ours", "--theirs", "a"}, "--ours and --theirs cannot be used together"},
+	} {
+		if _, err := Run(append([]string{"restore"}, test.args...)); err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("Wanted restore %q to fail with %q, got %v", test.args, test.err, err)
+		}
+	}
+}
+
+func TestRestoreUnmerged(t *testing.T) {
+	setupReset(t)
+	idx, err := index.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for stage, contents := range map[int]string{1: "base\n", 2: "ours\n", 3: "theirs\n"} {
+		hash := testutil.WriteObject(t, "blob", contents)
+		idx.Add(&index.Entry{Path: "a", Mode: index.ParseMode("100644"), Hash: hash, Stage: stage})
+	}
+	if err := idx.Write(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Run([]string{"restore", "a"}); err == nil || err.Error() != "path 'a' is unmerged" {
+		t.Errorf("Wanted an unmerged path to need --ours, --theirs or --merge, got %v", err)
+	}
+	gotgit(t, "restore", "--theirs", "a")
+	checkFiles(t, map[string]string{"a": "theirs\n"})
+	gotgit(t, "restore", "--ours", "a")
+	checkFiles(t, map[string]string{"a": "ours\n"})
+	gotgit(t, "restore", "-m", "a")
+	checkFiles(t, map[string]string{"a": "<<<<<<< ours\nours\n=======\ntheirs\n>>>>>>> theirs\n"})
+
+	// The conflict stays in the index.
+	if idx, _ := index.Read(); len(idx.Unmerged()) != 1 {
+		t.Errorf("Wanted a left unmerged, got %q", idx.Unmerged())
+	}
+	testutil.WriteFiles(t, ".", map[string]string{"b": "local b\n"})
+	gotgit(t, "restore", "--ignore-unmerged", ".")
+	checkFiles(t, map[string]string{"a": "<<<<<<< ours\nours\n=======\ntheirs\n>>>>>>> theirs\n", "b": "b1\n"})
+}
@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+const RevertUsageMsg = "usage: revert [-n] [-e | --no-edit] [-m <parent>] [-X <option>] <commit>...\n" +
+	"   or: revert (--continue | --skip | --abort | --quit)\n"
+
+type RevertOptions struct {
+	noCommit     bool
+	edit         bool
+	noEdit       bool
+	mainline     int
+	strategyOpts stringList
+	cont         bool
+	skip         bool
+	abort        bool
+	quit         bool
+}
+
+func SetupRevertCmd() (*flag.FlagSet, *RevertOptions) {
+	revertCmd := flag.NewFlagSet("revert", flag.ExitOnError)
+	opts := &RevertOptions{}
+
+	revertCmd.BoolVar(&opts.noCommit, "n", false, "Undo the changes in the index and working tree "+
+		"without committing.")
+	revertCmd.BoolVar(&opts.noCommit, "no-commit", false, "Same as `-n`.")
+	revertCmd.BoolVar(&opts.edit, "e", false, "Edit the commit message before committing "+
+		"(the default when run from a terminal).")
+	revertCmd.BoolVar(&opts.edit, "edit", false, "Same as `-e`.")
+	revertCmd.BoolVar(&opts.noEdit, "no-edit", false, "Don't start the editor.")
+	revertCmd.IntVar(&opts.mainline, "m", 0, "Revert a merge commit relative to its <parent> "+
+		"(starting from 1).")
+	revertCmd.IntVar(&opts.mainline, "mainline", 0, "Same as `-m`.")
+	revertCmd.Var(&opts.strategyOpts, "X", "Pass an option to the merge strategy (see `merge -X`).")
+	revertCmd.Var(&opts.strategyOpts, "strategy-option", "Same as `-X`.")
+	revertCmd.BoolVar(&opts.cont, "continue", false, "Resume after resolving conflicts.")
+	revertCmd.BoolVar(&opts.skip, "skip", false, "Skip the commit that stopped the operation.")
+	revertCmd.BoolVar(&opts.abort, "abort", false, "Cancel the operation and return to the "+
+		"state before it.")
+	revertCmd.BoolVar(&opts.quit, "quit", false, "Forget about the operation in progress, "+
+		"keeping the commits made so far.")
+
+	return revertCmd, opts
+}
+
+func stdinIsTerminal() bool {
+	info, err := os.Stdin.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+func RevertCmdHandler(args []string, opts *RevertOptions) (bool, error) {
+	// Record new commits undoing the changes of existing ones. The boolean
+	// result is false when a revert did not apply cleanly.
+	if handled, ok, err := sequencerControl(args, opts.cont, opts.skip, opts.abort, opts.quit,
+		RevertUsageMsg); handled {
+		return ok, err
+	}
+	switch {
+	case len(args) == 0:
+		return false, fmt.Errorf("no commits given\n%s", RevertUsageMsg)
+	case opts.mainline < 0:
+		return false, fmt.Errorf("mainline must be a positive parent number")
+	case opts.edit && opts.noEdit:
+		return false, fmt.Errorf("--edit and --no-edit cannot be used together")
+	}
+	return sequencerCmdHandler("revert", args, &sequencerOptions{
+		noCommit:     opts.noCommit,
+		edit:         opts.edit || !opts.noEdit && !opts.noCommit && stdinIsTerminal(),
+		mainline:     opts.mainline,
+		strategyOpts: opts.strategyOpts,
+	})
+}
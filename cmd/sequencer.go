@@ -0,0 +1,665 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/tsoud/GoTGit.git/gitobj"
+	"github.com/tsoud/GoTGit.git/hooks"
+	"github.com/tsoud/GoTGit.git/index"
+	"github.com/tsoud/GoTGit.git/merge"
+	"github.com/tsoud/GoTGit.git/refs"
+	"github.com/tsoud/GoTGit.git/worktree"
+)
+
+// sequencerOptions are the settings of a cherry-pick or revert. They are saved
+// in the sequencer directory so that a stopped operation can be resumed.
+type sequencerOptions struct {
+	noCommit      bool
+	edit          bool
+	recordOrigin  bool
+	allowFF       bool
+	allowEmpty    bool
+	keepRedundant bool
+	mainline      int
+	strategyOpts  []string
+}
+
+// sequencerActions maps todo commands to the command that runs them.
+var sequencerActions = map[string]string{"pick": "cherry-pick", "revert": "revert"}
+
+// sequencerHeads holds the commit being picked or reverted while stopped.
+var sequencerHeads = map[string]string{"pick": "CHERRY_PICK_HEAD", "revert": "REVERT_HEAD"}
+
+func sequencerFile(name string) string {
+	return path.Join(gitobj.GitDir, "sequencer", name)
+}
+
+func readSequencerFile(name string) string {
+	contents, _ := os.ReadFile(sequencerFile(name))
+	return strings.TrimSuffix(string(contents), "\n")
+}
+
+func writeSequencerFile(name, contents string) error {
+	return os.WriteFile(sequencerFile(name), []byte(contents), 0644)
+}
+
+func sequencerInProgress() bool {
+	_, err := os.Stat(sequencerFile(""))
+	return err == nil
+}
+
+func stoppedCommand() string {
+	// Return the todo command ("pick" or "revert") that stopped for conflicts, if any.
+	for command, name := range sequencerHeads {
+		if refs.Exists(name) {
+			return command
+		}
+	}
+	return ""
+}
+
+func cleanupSequencerState() {
+	for _, name := range sequencerHeads {
+		os.Remove(gitFile(name))
+	}
+	os.Remove(gitFile("MERGE_MSG"))
+}
+
+func (opts *sequencerOptions) save() error {
+	// Write the options the way Git does, as a config file with an [options] section.
+	var contents strings.Builder
+	contents.WriteString("[options]\n")
+	for _, option := range []struct {
+		key string
+		set bool
+	}{
+		{"no-commit", opts.noCommit}, {"edit", opts.edit}, {"record-origin", opts.recordOrigin},
+		{"allow-ff", opts.allowFF}, {"allow-empty", opts.allowEmpty},
+		{"keep-redundant-commits", opts.keepRedundant},
+	} {
+		if option.set {
+			fmt.Fprintf(&contents, "\t%s = true\n", option.key)
+		}
+	}
+	if opts.mainline > 0 {
+		fmt.Fprintf(&contents, "\tmainline = %d\n", opts.mainline)
+	}
+	for _, value := range opts.strategyOpts {
+		fmt.Fprintf(&contents, "\tstrategy-option = %s\n", value)
+	}
+	return writeSequencerFile("opts", contents.String())
+}
+
+func loadSequencerOptions() (*sequencerOptions, error) {
+	opts := &sequencerOptions{}
+	for _, line := range strings.Split(readSequencerFile("opts"), "\n") {
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		switch key {
+		case "no-commit":
+			opts.noCommit = value == "true"
+		case "edit":
+			opts.edit = value == "true"
+		case "record-origin":
+			opts.recordOrigin = value == "true"
+		case "allow-ff":
+			opts.allowFF = value == "true"
+		case "allow-empty":
+			opts.allowEmpty = value == "true"
+		case "keep-redundant-commits":
+			opts.keepRedundant = value == "true"
+		case "mainline":
+			mainline, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid value for mainline: %s", value)
+			}
+			opts.mainline = mainline
+		case "strategy-option":
+			opts.strategyOpts = append(opts.strategyOpts, value)
+		}
+	}
+	return opts, nil
+}
+
+func sequencerCommits(args []string, revert bool) ([]*gitobj.Commit, error) {
+	// Resolve the commits named on the command line. Commits given one by one
+	// are used in that order, while ranges (`A..B`, `^A B`) are walked oldest
+	// first, or newest first for revert.
+	var include, exclude []string
+	walk := false
+	for _, arg := range args {
+		if from, to, ok := strings.Cut(arg, ".."); ok {
+			walk = true
+			exclude = append(exclude, cmpOr(from, "HEAD"))
+			include = append(include, cmpOr(to, "HEAD"))
+		} else if rev, ok := strings.CutPrefix(arg, "^"); ok {
+			walk = true
+			exclude = append(exclude, rev)
+		} else {
+			include = append(include, arg)
+		}
+	}
+
+	resolve := func(revs []string) ([]string, error) {
+		var hashes []string
+		for _, rev := range revs {
+			hash, err := refs.ResolveCommit(rev)
+			if err != nil {
+				return nil, fmt.Errorf("bad revision '%s'", rev)
+			}
+			hashes = append(hashes, hash)
+		}
+		return hashes, nil
+	}
+	includeHashes, err := resolve(include)
+	if err != nil {
+		return nil, err
+	}
+	excludeHashes, err := resolve(exclude)
+	if err != nil {
+		return nil, err
+	}
+
+	var commits []*gitobj.Commit
+	if !walk {
+		for _, hash := range includeHashes {
+			commit, err := gitobj.ReadCommit(hash)
+			if err != nil {
+				return nil, err
+			}
+			commits = append(commits, commit)
+		}
+		return commits, nil
+	}
+
+	excluded := make(map[string]bool)
+	for _, hash := range excludeHashes {
+		ancestors, err := gitobj.Ancestors(hash)
+		if err != nil {
+			return nil, err
+		}
+		for ancestor := range ancestors {
+			excluded[ancestor] = true
+		}
+	}
+	for _, hash := range includeHashes {
+		listed, err := listCommits("", hash, true)
+		if err != nil {
+			return nil, err
+		}
+		for _, commit := range listed {
+			if !excluded[commit.Hash] {
+				excluded[commit.Hash] = true
+				commits = append(commits, commit)
+			}
+		}
+	}
+	if revert {
+		for i, j := 0, len(commits)-1; i < j; i, j = i+1, j-1 {
+			commits[i], commits[j] = commits[j], commits[i]
+		}
+	}
+	return commits, nil
+}
+
+func sequencerCmdHandler(command string, args []string, opts *sequencerOptions) (bool, error) {
+	// Start cherry-picking or reverting `args`, which must not already be in progress.
+	action := sequencerActions[command]
+	if sequencerInProgress() || stoppedCommand() != "" {
+		return false, fmt.Errorf("a cherry-pick or revert is already in progress\n"+
+			"hint: try \"gotgit %s (--continue | --skip | --abort | --quit)\"", action)
+	}
+	if refs.Exists("MERGE_HEAD") {
+		return false, fmt.Errorf("You have not concluded your merge (MERGE_HEAD exists).")
+	}
+	if len(args) == 0 {
+		return false, fmt.Errorf("no commits given")
+	}
+	if _, err := strategyOptions(opts.strategyOpts); err != nil {
+		return false, err
+	}
+
+	commits, err := sequencerCommits(args, command == "revert")
+	if err != nil {
+		return false, err
+	}
+	if len(commits) == 0 {
+		return false, fmt.Errorf("empty commit set passed")
+	}
+	head, err := refs.Resolve(refs.HEAD)
+	if err != nil {
+		return false, fmt.Errorf("cannot %s: HEAD does not point to a commit", action)
+	}
+
+	var items []todoItem
+	for _, commit := range commits {
+		items = append(items, todoItem{command: command, commit: commit.Hash, arg: commit.Subject()})
+	}
+	if err := os.MkdirAll(sequencerFile(""), 0755); err != nil {
+		return false, err
+	}
+	state := map[string]string{
+		"head":         head + "\n",
+		"abort-safety": head + "\n",
+		"todo":         formatTodo(items),
+	}
+	for name, contents := range state {
+		if err := writeSequencerFile(name, contents); err != nil {
+			return false, err
+		}
+	}
+	if err := opts.save(); err != nil {
+		return false, err
+	}
+	ok, err := runSequencer()
+	if err != nil && mustResolveHead() == head && stoppedCommand() == "" {
+		// Nothing was done, so there is nothing to resume either.
+		os.RemoveAll(sequencerFile(""))
+	}
+	return ok, err
+}
+
+func runSequencer() (bool, error) {
+	// Work through the todo list until it is empty or a commit does not apply
+	// cleanly. The sequencer directory is removed once everything is done.
+	opts, err := loadSequencerOptions()
+	if err != nil {
+		return false, err
+	}
+	for {
+		items, err := parseTodo(readSequencerFile("todo"))
+		if err != nil {
+			return false, err
+		}
+		if len(items) == 0 {
+			return true, os.RemoveAll(sequencerFile(""))
+		}
+
+		// The commit stays in the todo list if it can't be applied at all.
+		ok, err := pickCommit(items[0], opts)
+		if err != nil {
+			return false, err
+		}
+		if err := writeSequencerFile("todo", formatTodo(items[1:])); err != nil {
+			return false, err
+		}
+		if err := writeSequencerFile("abort-safety", mustResolveHead()+"\n"); err != nil {
+			return false, err
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+}
+
+var trailerPattern = regexp.MustCompile(`^([A-Za-z0-9-]+: |\(cherry picked from commit )`)
+
+func sequencerMessage(command string, commit *gitobj.Commit, parent string, opts *sequencerOptions) string {
+	// Return the message of the commit created by picking or reverting `commit`.
+	if command == "revert" {
+		subject := commit.Subject()
+		title := fmt.Sprintf("Revert \"%s\"", subject)
+		if inner, ok := strings.CutPrefix(subject, "Revert \""); ok && strings.HasSuffix(inner, "\"") {
+			title = fmt.Sprintf("Reapply \"%s\"", strings.TrimSuffix(inner, "\""))
+		}
+		message := fmt.Sprintf("%s\n\nThis reverts commit %s", title, commit.Hash)
+		if len(commit.Parents) > 1 {
+			message += fmt.Sprintf(", reversing\nchanges made to %s", parent)
+		}
+		return message + ".\n"
+	}
+
+	message := strings.TrimRight(commit.Message, "\n") + "\n"
+	if !opts.recordOrigin {
+		return message
+	}
+	// The origin joins the trailers of the last paragraph, if it has any.
+	paragraphs := strings.Split(strings.TrimSuffix(message, "\n"), "\n\n")
+	trailers := len(paragraphs) > 1
+	for _, line := range strings.Split(paragraphs[len(paragraphs)-1], "\n") {
+		trailers = trailers && trailerPattern.MatchString(line)
+	}
+	if !trailers {
+		message += "\n"
+	}
+	return message + fmt.Sprintf("(cherry picked from commit %s)\n", commit.Hash)
+}
+
+func pickParent(commit *gitobj.Commit, mainline int) (string, error) {
+	// Choose the parent that `commit` is compared with, "" for a root commit.
+	switch {
+	case len(commit.Parents) > 1 && mainline == 0:
+		return "", fmt.Errorf("commit %s is a merge but no -m option was given.", commit.Hash)
+	case len(commit.Parents) <= 1 && mainline > 1:
+		return "", fmt.Errorf("commit %s does not have parent %d", commit.Hash, mainline)
+	case mainline > len(commit.Parents):
+		return "", fmt.Errorf("commit %s does not have parent %d", commit.Hash, mainline)
+	case mainline > 0:
+		return commit.Parents[mainline-1], nil
+	case len(commit.Parents) == 1:
+		return commit.Parents[0], nil
+	}
+	return "", nil
+}
+
+func pickCommit(item todoItem, opts *sequencerOptions) (bool, error) {
+	// Apply (or for revert, undo) the changes of one commit on top of HEAD and
+	// commit the result. The boolean result is false when it stopped for
+	// conflicts, leaving CHERRY_PICK_HEAD or REVERT_HEAD behind.
+	action := sequencerActions[item.command]
+	if action == "" {
+		return false, fmt.Errorf("invalid command '%s' in the sequencer todo list", item.command)
+	}
+	commit, err := gitobj.ReadCommit(item.commit)
+	if err != nil {
+		return false, err
+	}
+	parent, err := pickParent(commit, opts.mainline)
+	if err != nil {
+		return false, err
+	}
+	head, err := refs.Resolve(refs.HEAD)
+	if err != nil {
+		return false, err
+	}
+	headTree, err := commitTree(head)
+	if err != nil {
+		return false, err
+	}
+	idx, err := index.Read()
+	if err != nil {
+		return false, err
+	}
+
+	// With --no-commit, changes picked earlier stay in the index and build up.
+	oursTree := headTree
+	if opts.noCommit {
+		if oursTree, err = idx.WriteTree(); err != nil {
+			return false, err
+		}
+	} else if matches, err := indexMatchesTree(idx, headTree); err != nil {
+		return false, err
+	} else if !matches {
+		return false, fmt.Errorf("your local changes would be overwritten by %s.\n"+
+			"hint: commit your changes or stash them to proceed.", action)
+	}
+
+	if item.command == "pick" && opts.allowFF && !opts.noCommit && parent == head {
+		if _, err := worktree.Checkout(idx, headTree, commit.Tree, &worktree.CheckoutOptions{}); err != nil {
+			return false, err
+		}
+		if err := idx.Write(); err != nil {
+			return false, err
+		}
+		return true, refs.UpdateHead(commit.Hash, "cherry-pick: fast-forward")
+	}
+
+	parentTree, err := commitTree(parent)
+	if err != nil {
+		return false, err
+	}
+	mergeOpts, err := strategyOptions(opts.strategyOpts)
+	if err != nil {
+		return false, err
+	}
+	label := fmt.Sprintf("%s (%s)", commit.Hash[:7], commit.Subject())
+	baseTree, theirsTree := parentTree, commit.Tree
+	mergeOpts.OursLabel, mergeOpts.TheirsLabel, mergeOpts.BaseLabel = "HEAD", label, "parent of "+label
+	if item.command == "revert" {
+		baseTree, theirsTree = commit.Tree, parentTree
+		mergeOpts.TheirsLabel, mergeOpts.BaseLabel = "parent of "+label, label
+	}
+	result, err := merge.MergeTrees(baseTree, oursTree, theirsTree, mergeOpts)
+	if err != nil {
+		return false, err
+	}
+	if err := applyMergeResult(idx, result); err != nil {
+		return false, err
+	}
+	for _, message := range result.Messages {
+		fmt.Println(message)
+	}
+
+	message := sequencerMessage(item.command, commit, parent, opts)
+	if !result.Clean() || opts.noCommit {
+		mergeMsg := message
+		if !result.Clean() {
+			mergeMsg += "\n# Conflicts:\n"
+			for _, filePath := range idx.Unmerged() {
+				mergeMsg += "#\t" + filePath + "\n"
+			}
+		}
+		if err := os.WriteFile(gitFile("MERGE_MSG"), []byte(mergeMsg), 0644); err != nil {
+			return false, err
+		}
+	}
+	if !result.Clean() {
+		if !opts.noCommit {
+			if err := refs.Update(sequencerHeads[item.command], commit.Hash, ""); err != nil {
+				return false, err
+			}
+		}
+		verb := "apply"
+		if item.command == "revert" {
+			verb = "revert"
+		}
+		fmt.Fprintf(os.Stderr, "error: could not %s %s... %s\n"+
+			"hint: After resolving the conflicts, mark them as resolved in the index,\n"+
+			"hint: then run \"gotgit %[4]s --continue\".\n"+
+			"hint: You can instead skip this commit with \"gotgit %[4]s --skip\".\n"+
+			"hint: To abort and get back to the state before \"gotgit %[4]s\",\n"+
+			"hint: run \"gotgit %[4]s --abort\".\n",
+			verb, commit.Hash[:7], commit.Subject(), action)
+		return false, nil
+	}
+	if opts.noCommit {
+		return true, nil
+	}
+
+	// A commit that changes nothing stops the operation, unless --allow-empty
+	// keeps it because it was empty to begin with, or --keep-redundant-commits
+	// because its changes are already in HEAD.
+	keepEmpty := opts.keepRedundant || opts.allowEmpty && parentTree == commit.Tree
+	if result.Tree == headTree && !keepEmpty {
+		if err := refs.Update(sequencerHeads[item.command], commit.Hash, ""); err != nil {
+			return false, err
+		}
+		if err := os.WriteFile(gitFile("MERGE_MSG"), []byte(message), 0644); err != nil {
+			return false, err
+		}
+		fmt.Fprintf(os.Stderr, "The previous %s is now empty, possibly due to conflict resolution.\n"+
+			"Use \"gotgit %[1]s --skip\" to drop it and carry on.\n", action)
+		return false, nil
+	}
+	return true, commitSequencerPick(item.command, commit, result.Tree, message, opts, false)
+}
+
+func commitSequencerPick(command string, commit *gitobj.Commit, treeHash, message string,
+	opts *sequencerOptions, resolved bool) error {
+	// Commit `treeHash` on top of HEAD as the result of picking or reverting
+	// `commit`. A cherry-pick keeps the original author. Committing a conflict
+	// resolution runs the pre-commit and commit-msg hooks, as `git commit` would;
+	// otherwise only a message the user edited is checked by commit-msg.
+	if resolved {
+		if err := hooks.PreCommit(); err != nil {
+			return err
+		}
+	}
+	message, err := prepareMessage(message, "message")
+	if err != nil {
+		return err
+	}
+	if opts.edit {
+		if message, err = editMessage(gitFile("MERGE_MSG"), message); err != nil {
+			return err
+		}
+	}
+	if resolved || opts.edit {
+		if message, err = verifyMessage(message); err != nil {
+			return err
+		}
+	}
+	var author *gitobj.Signature
+	if command == "pick" {
+		author = &commit.Author
+	}
+	head, err := refs.Resolve(refs.HEAD)
+	if err != nil {
+		return err
+	}
+	newHash, err := createCommit(treeHash, []string{head}, message, author)
+	if err != nil {
+		return err
+	}
+	subject := strings.SplitN(message, "\n", 2)[0]
+	if err := refs.UpdateHead(newHash, sequencerActions[command]+": "+subject); err != nil {
+		return err
+	}
+	cleanupSequencerState()
+
+	branch, _ := currentBranchName()
+	if branch == "" {
+		branch = "detached HEAD"
+	}
+	fmt.Printf("[%s %s] %s\n", branch, newHash[:7], subject)
+	hooks.PostCommit()
+	return nil
+}
+
+func continueSequencer() (bool, error) {
+	// Commit the resolution of the conflicts that stopped the operation and carry
+	// on with the remaining commits.
+	command := stoppedCommand()
+	if command == "" && !sequencerInProgress() {
+		return false, fmt.Errorf("no cherry-pick or revert in progress")
+	}
+	idx, err := index.Read()
+	if err != nil {
+		return false, err
+	}
+	if unmerged := idx.Unmerged(); len(unmerged) > 0 {
+		return false, fmt.Errorf("Committing is not possible because you have unmerged files:\n\t%s",
+			strings.Join(unmerged, "\n\t"))
+	}
+
+	if command != "" {
+		opts, err := loadSequencerOptions()
+		if err != nil {
+			return false, err
+		}
+		picked, err := refs.Resolve(sequencerHeads[command])
+		if err != nil {
+			return false, err
+		}
+		commit, err := gitobj.ReadCommit(picked)
+		if err != nil {
+			return false, err
+		}
+		headTree, err := commitTree(mustResolveHead())
+		if err != nil {
+			return false, err
+		}
+		treeHash, err := idx.WriteTree()
+		if err != nil {
+			return false, err
+		}
+		if treeHash == headTree && !opts.keepRedundant {
+			// The resolution left nothing to commit: the commit is dropped.
+			cleanupSequencerState()
+		} else {
+			message, err := readMergeMessage()
+			if err != nil {
+				return false, err
+			}
+			if message == "" {
+				return false, fmt.Errorf("Aborting commit due to empty commit message.")
+			}
+			if err := commitSequencerPick(command, commit, treeHash, message, opts, true); err != nil {
+				return false, err
+			}
+		}
+	}
+	if !sequencerInProgress() {
+		return true, nil
+	}
+	if err := writeSequencerFile("abort-safety", mustResolveHead()+"\n"); err != nil {
+		return false, err
+	}
+	return runSequencer()
+}
+
+func skipSequencer() (bool, error) {
+	// Drop the commit that stopped the operation and carry on with the rest.
+	if stoppedCommand() == "" && !sequencerInProgress() {
+		return false, fmt.Errorf("no cherry-pick or revert in progress")
+	}
+	idx, err := index.Read()
+	if err != nil {
+		return false, err
+	}
+	headTree, err := commitTree(mustResolveHead())
+	if err != nil {
+		return false, err
+	}
+	if err := resetHard(idx, headTree); err != nil {
+		return false, err
+	}
+	cleanupSequencerState()
+	if !sequencerInProgress() {
+		return true, nil
+	}
+	return runSequencer()
+}
+
+func abortSequencer() error {
+	// Go back to the commit HEAD was at before the operation started, unless
+	// HEAD was moved by something else in the meantime.
+	if !sequencerInProgress() {
+		if stoppedCommand() == "" {
+			return fmt.Errorf("no cherry-pick or revert in progress")
+		}
+		_, err := skipSequencer()
+		return err
+	}
+	origHead := readSequencerFile("head")
+	if head := mustResolveHead(); head != readSequencerFile("abort-safety") {
+		fmt.Fprintln(os.Stderr, "warning: You seem to have moved HEAD. Not rewinding, check your HEAD!")
+	} else {
+		origTree, err := commitTree(origHead)
+		if err != nil {
+			return err
+		}
+		idx, err := index.Read()
+		if err != nil {
+			return err
+		}
+		if err := resetHard(idx, origTree); err != nil {
+			return err
+		}
+		if head != origHead {
+			if err := refs.UpdateHead(origHead, "reset: moving to "+origHead); err != nil {
+				return err
+			}
+		}
+	}
+	cleanupSequencerState()
+	return os.RemoveAll(sequencerFile(""))
+}
+
+func quitSequencer() error {
+	// Forget about the operation in progress, leaving HEAD, the index and the
+	// working tree as they are.
+	if stoppedCommand() == "" && !sequencerInProgress() {
+		return fmt.Errorf("no cherry-pick or revert in progress")
+	}
+	cleanupSequencerState()
+	return os.RemoveAll(sequencerFile(""))
+}
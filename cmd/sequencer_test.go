@@ -0,0 +1,231 @@
+package cmd
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/tsoud/GoTGit.git/gitobj"
+	"github.com/tsoud/GoTGit.git/refs"
+)
+
+// pickHistory is the history TestCherryPick works with: "side" branched off
+// "main" and added three commits, the second of which conflicts with main.
+type pickHistory struct {
+	base, main, addC, changeA, addD string
+}
+
+func setupCherryPick(t *testing.T) pickHistory {
+	t.Helper()
+	initWorkRepo(t)
+	var h pickHistory
+	h.base = commitFiles(t, "base", map[string]string{"a": "a\n"})
+	h.main = commitFiles(t, "add b", map[string]string{"a": "main\n", "b": "b\n"}, h.base)
+	h.addC = commitFiles(t, "add c", map[string]string{"a": "a\n", "c": "c\n"}, h.base)
+	h.changeA = commitFiles(t, "change a", map[string]string{"a": "a2\n", "c": "c\n"}, h.addC)
+	h.addD = commitFiles(t, "add d", map[string]string{"a": "a2\n", "c": "c\n", "d": "d\n"}, h.changeA)
+	if err := refs.Update("refs/heads/side", h.addD, ""); err != nil {
+		t.Fatal(err)
+	}
+	checkoutBranch(t, "main", h.main)
+	return h
+}
+
+func TestCherryPickRange(t *testing.T) {
+	h := setupCherryPick(t)
+	checkoutBranch(t, "main", h.base)
+
+	// A range is picked oldest first, keeping the authors.
+	if status := gotgit(t, "cherry-pick", "-x", "main..side"); status != 0 {
+		t.Fatalf("Wanted the commits picked, got status %d", status)
+	}
+	if got, want := history(t, "HEAD"), []string{"add d", "change a", "add c", "base"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Wanted the history %q, got %q", want, got)
+	}
+	picked, _ := gitobj.ReadCommit(mustResolveHead())
+	original, _ := gitobj.ReadCommit(h.addD)
+	if !picked.Author.When.Equal(original.Author.When) {
+		t.Errorf("Wanted the picked commit to keep its author date, got %v", picked.Author.When)
+	}
+	if want := "add d\n\n(cherry picked from commit " + h.addD + ")\n"; picked.Message != want {
+		t.Errorf("Wanted the message %q, got %q", want, picked.Message)
+	}
+	checkFiles(t, map[string]string{"a": "a2\n", "c": "c\n", "d": "d\n"})
+	if sequencerInProgress() {
+		t.Error("Wanted the sequencer state removed")
+	}
+
+	// A range is reverted newest first, and so is `^A B`.
+	gotgit(t, "revert", "--no-edit", "HEAD~2..HEAD")
+	if got := history(t, "HEAD")[:2]; !reflect.DeepEqual(got, []string{`Revert "change a"`, `Revert "add d"`}) {
+		t.Errorf("Wanted the reverts newest first, got %q", got)
+	}
+	checkFiles(t, map[string]string{"a": "a\n", "c": "c\n", "d": ""})
+	gotgit(t, "revert", "--no-edit", "^HEAD~1", "HEAD")
+	if got := history(t, "HEAD")[0]; got != `Reapply "change a"` {
+		t.Errorf("Wanted a revert of a revert to reapply, got %q", got)
+	}
+
+	// Commits named one by one are picked in the order given.
+	checkoutBranch(t, "main", h.base)
+	gotgit(t, "cherry-pick", h.addC, "side")
+	if got, want := history(t, "HEAD"), []string{"add d", "add c", "base"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Wanted the history %q, got %q", want, got)
+	}
+	if _, err := Run([]string{"cherry-pick", "side..side"}); err == nil || err.Error() != "empty commit set passed" {
+		t.Errorf("Wanted an empty range to fail, got %v", err)
+	}
+}
+
+func TestCherryPickConflict(t *testing.T) {
+	h := setupCherryPick(t)
+
+	for _, action := range []string{"--abort", "--skip", "--continue"} {
+		t.Run(action, func(t *testing.T) {
+			checkoutBranch(t, "main", h.main)
+			if status := gotgit(t, "cherry-pick", "main..side"); status != 1 {
+				t.Fatalf("Wanted the cherry-pick to stop at the conflict, got status %d", status)
+			}
+			if stopped, _ := refs.Resolve("CHERRY_PICK_HEAD"); stopped != h.changeA {
+				t.Fatalf("Wanted CHERRY_PICK_HEAD at the conflicting commit, got %q", stopped)
+			}
+			if got := history(t, "HEAD")[0]; got != "add c" {
+				t.Errorf("Wanted the commit before the conflict picked, got %q", got)
+			}
+			remaining, err := parseTodo(readSequencerFile("todo"))
+			if err != nil || len(remaining) != 1 || remaining[0].commit != h.addD {
+				t.Errorf("Wanted the commit after the conflict left to do, got %+v (%v)", remaining, err)
+			}
+			if _, err := Run([]string{"cherry-pick", "side"}); err == nil ||
+				!strings.HasPrefix(err.Error(), "a cherry-pick or revert is already in progress") {
+				t.Errorf("Wanted a cherry-pick in progress to stop another one, got %v", err)
+			}
+			if _, err := Run([]string{"cherry-pick", "--continue"}); err == nil ||
+				!strings.HasPrefix(err.Error(), "Committing is not possible because you have unmerged files") {
+				t.Errorf("Wanted --continue to refuse unresolved conflicts, got %v", err)
+			}
+
+			switch action {
+			case "--abort":
+				gotgit(t, "cherry-pick", "--abort")
+				if head := mustResolveHead(); head != h.main {
+					t.Errorf("Wanted HEAD back where it started, got %s", head)
+				}
+				checkFiles(t, map[string]string{"a": "main\n", "b": "b\n", "c": ""})
+
+			case "--skip":
+				gotgit(t, "cherry-pick", "--skip")
+				if got, want := history(t, "HEAD"), []string{"add d", "add c", "add b", "base"}; !reflect.DeepEqual(got, want) {
+					t.Errorf("Wanted the history %q, got %q", want, got)
+				}
+				checkFiles(t, map[string]string{"a": "main\n", "c": "c\n", "d": "d\n"})
+
+			case "--continue":
+				stageFiles(t, map[string]string{"a": "resolved\n"})
+				gotgit(t, "cherry-pick", "--continue")
+				want := []string{"add d", "change a", "add c", "add b", "base"}
+				if got := history(t, "HEAD"); !reflect.DeepEqual(got, want) {
+					t.Errorf("Wanted the history %q, got %q", want, got)
+				}
+				resolvedHash, _ := refs.ResolveCommit("HEAD~1")
+				resolved, _ := gitobj.ReadCommit(resolvedHash)
+				if resolved.Message != "change a\n" {
+					t.Errorf("Wanted the message without the conflict comments, got %q", resolved.Message)
+				}
+				checkFiles(t, map[string]string{"a": "resolved\n", "d": "d\n"})
+			}
+			if sequencerInProgress() || stoppedCommand() != "" {
+				t.Error("Wanted the sequencer state removed")
+			}
+		})
+	}
+}
+
+func TestCherryPickEmpty(t *testing.T) {
+	h := setupCherryPick(t)
+	empty := commitFiles(t, "empty", map[string]string{"a": "a\n"}, h.base)
+	redundant := commitFiles(t, "add b again", map[string]string{"a": "a\n", "b": "b\n"}, h.base)
+
+	tests := []struct {
+		args []string
+		// kept is whether the empty commit is kept rather than stopping the pick.
+		kept bool
+	}{
+		{args: []string{empty}},
+		{args: []string{"--allow-empty", empty}, kept: true},
+		{args: []string{"--keep-redundant-commits", empty}, kept: true},
+		{args: []string{redundant}},
+		{args: []string{"--allow-empty", redundant}},
+		{args: []string{"--keep-redundant-commits", redundant}, kept: true},
+	}
+	for _, test := range tests {
+		checkoutBranch(t, "main", h.main)
+		status := gotgit(t, append([]string{"cherry-pick"}, test.args...)...)
+		subject := history(t, "HEAD")[0]
+		if test.kept {
+			if status != 0 || subject == "add b" {
+				t.Errorf("Wanted cherry-pick %q to make an empty commit, got status %d", test.args, status)
+			}
+			continue
+		}
+		if status != 1 || subject != "add b" || !refs.Exists("CHERRY_PICK_HEAD") {
+			t.Errorf("Wanted cherry-pick %q to stop at the empty commit, got status %d", test.args, status)
+		}
+		gotgit(t, "cherry-pick", "--skip")
+	}
+
+	// The options are kept for the commits after a conflict.
+	checkoutBranch(t, "main", h.main)
+	if status := gotgit(t, "cherry-pick", "--keep-redundant-commits", h.changeA, redundant); status != 1 {
+		t.Fatalf("Wanted the cherry-pick to stop at the conflict, got status %d", status)
+	}
+	stageFiles(t, map[string]string{"a": "resolved\n"})
+	gotgit(t, "cherry-pick", "--continue")
+	if got, want := history(t, "HEAD")[:3], []string{"add b again", "change a", "add b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Wanted the history %q, got %q", want, got)
+	}
+}
+
+func TestCherryPickMerge(t *testing.T) {
+	h := setupCherryPick(t)
+	addE := commitFiles(t, "add e", map[string]string{"a": "a\n", "e": "e\n"}, h.base)
+	merged := commitFiles(t, "merge", map[string]string{"a": "a\n", "c": "c\n", "e": "e\n"}, h.addC, addE)
+
+	if _, err := Run([]string{"cherry-pick", merged}); err == nil || !strings.Contains(err.Error(), "no -m option was given") {
+		t.Errorf("Wanted a merge to need -m, got %v", err)
+	}
+	if _, err := Run([]string{"cherry-pick", "-m", "3", merged}); err == nil ||
+		!strings.Contains(err.Error(), "does not have parent 3") {
+		t.Errorf("Wanted -m 3 to fail, got %v", err)
+	}
+	if _, err := Run([]string{"cherry-pick", "-m", "2", h.addC}); err == nil ||
+		!strings.Contains(err.Error(), "does not have parent 2") {
+		t.Errorf("Wanted -m 2 to fail for a commit with one parent, got %v", err)
+	}
+	if sequencerInProgress() || mustResolveHead() != h.main {
+		t.Error("Wanted a cherry-pick that failed to start to leave nothing behind")
+	}
+
+	// -m picks the changes relative to the parent it names.
+	for mainline, want := range map[string]map[string]string{
+		"1": {"b": "b\n", "c": "", "e": "e\n"},
+		"2": {"b": "b\n", "c": "c\n", "e": ""},
+	} {
+		checkoutBranch(t, "main", h.main)
+		gotgit(t, "cherry-pick", "-m", mainline, merged)
+		checkFiles(t, want)
+		if commit, _ := gitobj.ReadCommit(mustResolveHead()); len(commit.Parents) != 1 {
+			t.Errorf("Wanted -m %s to make an ordinary commit, got %d parents", mainline, len(commit.Parents))
+		}
+	}
+
+	// Reverting a merge undoes the changes it brought in from the other parents.
+	checkoutBranch(t, "side", merged)
+	gotgit(t, "revert", "--no-edit", "-m", "1", "HEAD")
+	checkFiles(t, map[string]string{"c": "c\n", "e": ""})
+	reverted, _ := gitobj.ReadCommit(mustResolveHead())
+	want := "Revert \"merge\"\n\nThis reverts commit " + merged + ", reversing\nchanges made to " + h.addC + ".\n"
+	if reverted.Message != want {
+		t.Errorf("Wanted the message %q, got %q", want, reverted.Message)
+	}
+}
@@ -0,0 +1,409 @@
+package cmd
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tsoud/GoTGit.git/diff"
+	"github.com/tsoud/GoTGit.git/gitobj"
+	"github.com/tsoud/GoTGit.git/refs"
+)
+
+const ShowUsageMsg = "usage: show [--format=<format> | --pretty[=<format>] | --oneline] [--abbrev-commit]\n" +
+	"            [-s | -p] [--stat] [--name-only | --name-status] [<object>...]\n"
+
+const showDateFormat = "Mon Jan 2 15:04:05 2006 -0700"
+
+var prettyFormats = []string{"oneline", "short", "medium", "full", "fuller", "raw"}
+
+type ShowOptions struct {
+	format       string
+	pretty       optionalValue
+	oneline      bool
+	abbrevCommit bool
+	noPatch      bool
+	patch        bool
+	stat         bool
+	nameOnly     bool
+	nameStatus   bool
+}
+
+// prettyFormat describes how a commit header is printed: one of Git's named
+// formats, or a `format` template of `%` placeholders. With `terminator` set,
+// every commit ends with a newline; otherwise newlines only separate commits.
+type prettyFormat struct {
+	name       string
+	template   string
+	terminator bool
+	abbrev     bool
+}
+
+// objectShower prints objects one after another, keeping track of whether a
+// separator is needed before the next one.
+type objectShower struct {
+	out      *bufio.Writer
+	format   *prettyFormat
+	opts     *ShowOptions
+	shownOne bool
+}
+
+func SetupShowCmd() (*flag.FlagSet, *ShowOptions) {
+	showCmd := flag.NewFlagSet("show", flag.ExitOnError)
+	opts := &ShowOptions{}
+
+	showCmd.StringVar(&opts.format, "format", "", "Print commits in the given format: oneline, short, "+
+		"medium, full, fuller, raw, or a `format:` or `tformat:` template of placeholders such as %H or %s.")
+	showCmd.Var(&opts.pretty, "pretty", "Same as `--format`, defaulting to medium.")
+	showCmd.BoolVar(&opts.oneline, "oneline", false, "Same as `--pretty=oneline --abbrev-commit`.")
+	showCmd.BoolVar(&opts.abbrevCommit, "abbrev-commit", false, "Abbreviate commit hashes in the header.")
+	showCmd.BoolVar(&opts.noPatch, "s", false, "Suppress the diff output of commits.")
+	showCmd.BoolVar(&opts.noPatch, "no-patch", false, "Same as `-s`.")
+	showCmd.BoolVar(&opts.patch, "p", false, "Show the patch of commits, even with --stat.")
+	showCmd.BoolVar(&opts.patch, "patch", false, "Same as `-p`.")
+	showCmd.BoolVar(&opts.stat, "stat", false, "Show a diffstat of the changes in commits.")
+	showCmd.BoolVar(&opts.nameOnly, "name-only", false, "Show only the names of files changed by commits.")
+	showCmd.BoolVar(&opts.nameStatus, "name-status", false,
+		"Show only the names and status of files changed by commits.")
+
+	return showCmd, opts
+}
+
+func (opts *ShowOptions) prettyFormat() (*prettyFormat, error) {
+	// Work out the commit format from `--format`, `--pretty` and `--oneline`.
+	spec := "medium"
+	switch {
+	case opts.format != "":
+		spec = opts.format
+	case opts.pretty.value != "":
+		spec = opts.pretty.value
+	case opts.oneline:
+		spec = "oneline"
+	}
+
+	format := &prettyFormat{name: spec, abbrev: opts.abbrevCommit || opts.oneline}
+	if slices.Contains(prettyFormats, spec) {
+		format.terminator = spec == "oneline"
+		return format, nil
+	}
+	format.name = "format"
+	if template, found := strings.CutPrefix(spec, "format:"); found {
+		format.template = template
+	} else if template, found := strings.CutPrefix(spec, "tformat:"); found {
+		format.template, format.terminator = template, true
+	} else if strings.Contains(spec, "%") {
+		format.template, format.terminator = spec, true
+	} else {
+		return nil, fmt.Errorf("invalid --pretty format: %s", spec)
+	}
+	return format, nil
+}
+
+func ShowCmdHandler(args []string, opts *ShowOptions) error {
+	// Show each object: commits with their changes, annotated tags followed by
+	// what they point to, trees as a listing and blobs as their contents.
+	format, err := opts.prettyFormat()
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		args = []string{refs.HEAD}
+	}
+
+	hashes := make([]string, len(args))
+	for i, arg := range args {
+		if hashes[i], err = refs.ResolveRevision(arg); err != nil {
+			return err
+		}
+	}
+
+	shower := &objectShower{out: bufio.NewWriter(os.Stdout), format: format, opts: opts}
+	defer shower.out.Flush()
+	for i, hash := range hashes {
+		if err := shower.show(hash, args[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (shower *objectShower) show(hash, name string) error {
+	obj, err := gitobj.ReadGitObj(hash)
+	if err != nil {
+		return err
+	}
+
+	switch obj.Type {
+	case "blob":
+		_, err = shower.out.Write(obj.Content)
+		return err
+	case "tree":
+		return shower.showTree(hash, name)
+	case "tag":
+		tag, err := gitobj.ParseTag(hash, obj.Content)
+		if err != nil {
+			return err
+		}
+		shower.showTag(tag)
+		return shower.show(tag.Object, name)
+	default:
+		commit, err := gitobj.ParseCommit(hash, obj.Content)
+		if err != nil {
+			return err
+		}
+		return shower.showCommit(commit)
+	}
+}
+
+func (shower *objectShower) separate(always bool) {
+	// Separate an object from the ones shown before it with a blank line. Commits
+	// in formats that end every entry with a newline need no separator.
+	if shower.shownOne && (always || !shower.format.terminator) {
+		shower.out.WriteString("\n")
+	}
+	shower.shownOne = true
+}
+
+func (shower *objectShower) showTree(hash, name string) error {
+	entries, err := gitobj.ReadTree(hash)
+	if err != nil {
+		return err
+	}
+	shower.separate(true)
+	fmt.Fprintf(shower.out, "tree %s\n\n", name)
+	for _, entry := range entries {
+		if entry.Type == "tree" {
+			fmt.Fprintf(shower.out, "%s/\n", entry.Name)
+		} else {
+			fmt.Fprintf(shower.out, "%s\n", entry.Name)
+		}
+	}
+	return nil
+}
+
+func (shower *objectShower) showTag(tag *gitobj.Tag) {
+	shower.separate(true)
+	var header strings.Builder
+	fmt.Fprintf(&header, "tag %s\n", tag.Name)
+	if tag.HasTagger {
+		writeIdent(&header, shower.format.name, "Tagger", tag.Tagger)
+	}
+	shower.out.WriteString(header.String() + "\n" + tag.Message)
+}
+
+func (shower *objectShower) showCommit(commit *gitobj.Commit) error {
+	shower.separate(false)
+	shower.out.WriteString(shower.format.formatCommit(commit))
+	if shower.opts.noPatch {
+		return nil
+	}
+
+	var parent string
+	if len(commit.Parents) > 0 {
+		parent = commit.Parents[0]
+	}
+	parentTree, err := commitTree(parent)
+	if err != nil {
+		return err
+	}
+	changes, err := diff.TreeDiff(parentTree, commit.Tree, &diff.Options{Recursive: true, DetectRenames: true})
+	if err != nil {
+		return fmt.Errorf("error comparing trees: %w", err)
+	}
+	merge := len(commit.Parents) > 1
+	if len(changes) == 0 && !merge {
+		return nil
+	}
+
+	// Listing names replaces any other diff output.
+	names := shower.opts.nameOnly || shower.opts.nameStatus
+	stat := shower.opts.stat && !names
+	patch := (shower.opts.patch || !stat) && !names
+	if shower.format.name != "oneline" && !(shower.format.name == "format" && shower.format.template == "") {
+		if stat && patch {
+			shower.out.WriteString("---")
+		}
+		shower.out.WriteString("\n")
+	}
+
+	// Merges that resolved cleanly have no changes against all of their parents,
+	// so only their diffstat against the first parent is shown.
+	if merge {
+		names, patch = false, false
+	}
+	if names {
+		for _, change := range changes {
+			switch {
+			case shower.opts.nameOnly:
+				fmt.Fprintln(shower.out, change.Path())
+			case change.Status == diff.Renamed || change.Status == diff.Copied:
+				fmt.Fprintf(shower.out, "%s\t%s\t%s\n", change.StatusString(), change.OldPath, change.NewPath)
+			default:
+				fmt.Fprintf(shower.out, "%s\t%s\n", change.StatusString(), change.Path())
+			}
+		}
+		return nil
+	}
+	if stat {
+		stats, err := diff.Stat(changes)
+		if err != nil {
+			return err
+		}
+		if len(stats) > 0 {
+			if err := diff.WriteStat(shower.out, stats); err != nil {
+				return err
+			}
+		}
+	}
+	if !patch {
+		return nil
+	}
+	if stat {
+		shower.out.WriteString("\n")
+	}
+	return diff.WritePatch(shower.out, changes)
+}
+
+func writeIdent(out *strings.Builder, formatName, role string, sig gitobj.Signature) {
+	// Write the author, committer or tagger lines of a header in the given format.
+	switch formatName {
+	case "oneline":
+	case "medium":
+		fmt.Fprintf(out, "%s: %s <%s>\nDate:   %s\n", role, sig.Name, sig.Email, sig.When.Format(showDateFormat))
+	case "fuller":
+		fmt.Fprintf(out, "%s:     %s <%s>\n%sDate: %s\n",
+			role, sig.Name, sig.Email, role, sig.When.Format(showDateFormat))
+	default:
+		fmt.Fprintf(out, "%s: %s <%s>\n", role, sig.Name, sig.Email)
+	}
+}
+
+func (format *prettyFormat) formatCommit(commit *gitobj.Commit) string {
+	var out strings.Builder
+	hash := commit.Hash
+	if format.abbrev {
+		hash = hash[:7]
+	}
+
+	switch format.name {
+	case "format":
+		out.WriteString(expandPlaceholders(format.template, commit))
+		if format.terminator {
+			out.WriteString("\n")
+		}
+		return out.String()
+	case "oneline":
+		return fmt.Sprintf("%s %s\n", hash, commit.Subject())
+	}
+
+	fmt.Fprintf(&out, "commit %s\n", hash)
+	if format.name == "raw" {
+		headers, _, _ := strings.Cut(string(commit.Body()), "\n\n")
+		out.WriteString(headers + "\n")
+	} else {
+		if len(commit.Parents) > 1 {
+			out.WriteString("Merge:")
+			for _, parent := range commit.Parents {
+				out.WriteString(" " + parent[:7])
+			}
+			out.WriteString("\n")
+		}
+		writeIdent(&out, format.name, "Author", commit.Author)
+		if format.name == "full" || format.name == "fuller" {
+			writeIdent(&out, format.name, "Commit", commit.Committer)
+		}
+	}
+	out.WriteString("\n")
+
+	message := strings.Trim(commit.Message, "\n")
+	if format.name == "short" {
+		message = commit.Subject()
+	}
+	if message != "" {
+		for _, line := range strings.Split(message, "\n") {
+			fmt.Fprintf(&out, "    %s\n", line)
+		}
+	}
+	return out.String()
+}
+
+// A placeholder is `%` followed by a hash or message code, a person and date
+// code for the author (`a`) or committer (`c`), or `x` and a hex byte value.
+var placeholder = regexp.MustCompile(`%(x[0-9a-fA-F]{2}|[ac][nedtiID]|[HhTtPpsbBn%])`)
+
+func formatDate(when time.Time, code byte) string {
+	switch code {
+	case 't':
+		return strconv.FormatInt(when.Unix(), 10)
+	case 'i':
+		return when.Format("2006-01-02 15:04:05 -0700")
+	case 'I':
+		return when.Format("2006-01-02T15:04:05-07:00")
+	case 'D':
+		return when.Format("Mon, 2 Jan 2006 15:04:05 -0700")
+	default:
+		return when.Format(showDateFormat)
+	}
+}
+
+func expandPlaceholders(template string, commit *gitobj.Commit) string {
+	// Fill in the `%` placeholders of a `--format` template. Unknown placeholders
+	// are left as they are.
+	return placeholder.ReplaceAllStringFunc(template, func(match string) string {
+		code := match[1:]
+		switch code[0] {
+		case 'x':
+			value, _ := strconv.ParseUint(code[1:], 16, 8)
+			return string([]byte{byte(value)})
+		case 'a', 'c':
+			sig := commit.Author
+			if code[0] == 'c' {
+				sig = commit.Committer
+			}
+			switch code[1] {
+			case 'n':
+				return sig.Name
+			case 'e':
+				return sig.Email
+			default:
+				return formatDate(sig.When, code[1])
+			}
+		}
+
+		switch code {
+		case "H":
+			return commit.Hash
+		case "h":
+			return commit.Hash[:7]
+		case "T":
+			return commit.Tree
+		case "t":
+			return commit.Tree[:7]
+		case "P":
+			return strings.Join(commit.Parents, " ")
+		case "p":
+			abbrevs := make([]string, len(commit.Parents))
+			for i, parent := range commit.Parents {
+				abbrevs[i] = parent[:7]
+			}
+			return strings.Join(abbrevs, " ")
+		case "s":
+			return commit.Subject()
+		case "b":
+			_, body, _ := strings.Cut(strings.TrimLeft(commit.Message, "\n"), "\n\n")
+			return strings.TrimLeft(body, "\n")
+		case "B":
+			return commit.Message
+		case "n":
+			return "\n"
+		default:
+			return "%"
+		}
+	})
+}
@@ -0,0 +1,583 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/tsoud/GoTGit.git/diff"
+	"github.com/tsoud/GoTGit.git/gitobj"
+	"github.com/tsoud/GoTGit.git/index"
+	"github.com/tsoud/GoTGit.git/merge"
+	"github.com/tsoud/GoTGit.git/refs"
+	"github.com/tsoud/GoTGit.git/worktree"
+)
+
+const StashUsageMsg = "usage: stash list\n" +
+	"   or: stash show [-p | --name-only | --name-status] [<stash>]\n" +
+	"   or: stash drop [-q] [<stash>]\n" +
+	"   or: stash pop [--index] [-q] [<stash>]\n" +
+	"   or: stash apply [--index] [-q] [<stash>]\n" +
+	"   or: stash branch <branchname> [<stash>]\n" +
+	"   or: stash clear\n" +
+	"   or: stash [push [-k] [-u | -a] [-q] [-m <message>] [--] [<pathspec>...]]\n"
+
+const stashRef = "refs/stash"
+
+var stashSubcommands = []string{"push", "list", "show", "apply", "pop", "drop", "clear", "branch"}
+
+type StashOptions struct {
+	keepIndex        bool
+	includeUntracked bool
+	all              bool
+	message          string
+	restoreIndex     bool
+	patch            bool
+	nameOnly         bool
+	nameStatus       bool
+	quiet            bool
+}
+
+func StashSubcommand(args []string) (string, []string) {
+	// Split off the subcommand. Without one, `stash` means `stash push`.
+	if len(args) > 0 && slices.Contains(stashSubcommands, args[0]) {
+		return args[0], args[1:]
+	}
+	return "push", args
+}
+
+func SetupStashCmd(subcommand string) (*flag.FlagSet, *StashOptions) {
+	stashCmd := flag.NewFlagSet("stash "+subcommand, flag.ExitOnError)
+	opts := &StashOptions{}
+
+	switch subcommand {
+	case "push":
+		stashCmd.BoolVar(&opts.keepIndex, "k", false, "Leave the changes added to the index in place.")
+		stashCmd.BoolVar(&opts.keepIndex, "keep-index", false, "Same as `-k`.")
+		stashCmd.BoolVar(&opts.includeUntracked, "u", false, "Also stash untracked files and remove them.")
+		stashCmd.BoolVar(&opts.includeUntracked, "include-untracked", false, "Same as `-u`.")
+		stashCmd.BoolVar(&opts.all, "a", false, "Also stash untracked and ignored files and remove them.")
+		stashCmd.BoolVar(&opts.all, "all", false, "Same as `-a`.")
+		stashCmd.StringVar(&opts.message, "m", "", "Describe the stash with <message>.")
+		stashCmd.StringVar(&opts.message, "message", "", "Same as `-m`.")
+	case "show":
+		stashCmd.BoolVar(&opts.patch, "p", false, "Show the changes as a patch instead of a diffstat.")
+		stashCmd.BoolVar(&opts.patch, "patch", false, "Same as `-p`.")
+		stashCmd.BoolVar(&opts.nameOnly, "name-only", false, "Show only the names of changed files.")
+		stashCmd.BoolVar(&opts.nameStatus, "name-status", false,
+			"Show only the names and status of changed files.")
+	case "apply", "pop":
+		stashCmd.BoolVar(&opts.restoreIndex, "index", false, "Also restore the changes that were "+
+			"added to the index.")
+	}
+	if slices.Contains([]string{"push", "apply", "pop", "drop"}, subcommand) {
+		stashCmd.BoolVar(&opts.quiet, "q", false, "Suppress feedback messages.")
+		stashCmd.BoolVar(&opts.quiet, "quiet", false, "Same as `-q`.")
+	}
+
+	return stashCmd, opts
+}
+
+func StashCmdHandler(subcommand string, args, pathspecs []string, opts *StashOptions) (bool, error) {
+	// Save local changes away and bring them back later. The boolean result is
+	// false when applying a stash stopped with conflicts.
+	if subcommand != "push" && len(pathspecs) > 0 {
+		return false, fmt.Errorf("only `stash push` takes pathspecs\n%s", StashUsageMsg)
+	}
+	maxArgs := map[string]int{"list": 0, "clear": 0, "branch": 2, "show": 1, "apply": 1, "pop": 1, "drop": 1}
+	if limit, ok := maxArgs[subcommand]; ok && len(args) > limit {
+		return false, fmt.Errorf("too many arguments\n%s", StashUsageMsg)
+	}
+
+	switch subcommand {
+	case "push":
+		return true, pushStash(prefixPaths(append(args, pathspecs...)), opts)
+	case "list":
+		return true, listStashes()
+	case "clear":
+		return true, refs.Delete(stashRef)
+	case "branch":
+		if len(args) == 0 {
+			return false, fmt.Errorf("No branch name specified")
+		}
+		return stashBranch(args[0], args[1:])
+	}
+
+	rev, n, err := resolveStash(args, subcommand != "show" && subcommand != "apply")
+	if err != nil {
+		return false, err
+	}
+	switch subcommand {
+	case "show":
+		return true, showStash(rev, opts)
+	case "drop":
+		return true, dropStash(rev, n, opts.quiet)
+	case "apply":
+		return applyStash(rev, opts.restoreIndex, opts.quiet)
+	}
+
+	ok, err := applyStash(rev, opts.restoreIndex, opts.quiet)
+	if err != nil || !ok {
+		if !ok && err == nil {
+			fmt.Fprintln(os.Stderr, "The stash entry is kept in case you need it again.")
+		}
+		return ok, err
+	}
+	return true, dropStash(rev, n, opts.quiet)
+}
+
+func resolveStash(args []string, entryOnly bool) (string, int, error) {
+	// Turn a stash argument (`stash@{<n>}`, `<n>` or, unless `entryOnly`, any
+	// stash-like commit) into a revision and its reflog position (-1 for other
+	// commits). No argument means the latest stash.
+	rev := "stash@{0}"
+	if len(args) > 0 {
+		rev = args[0]
+		if _, err := strconv.Atoi(rev); err == nil {
+			rev = "stash@{" + rev + "}"
+		}
+	}
+	if !refs.Exists(stashRef) && len(args) == 0 {
+		return "", 0, fmt.Errorf("No stash entries found.")
+	}
+	if _, err := refs.ResolveCommit(rev); err != nil {
+		return "", 0, fmt.Errorf("%s is not a valid reference", rev)
+	}
+
+	selector, ok := strings.CutPrefix(rev, "stash@{")
+	if !ok && rev == "stash" {
+		selector, ok = "0}", true
+	}
+	n, err := strconv.Atoi(strings.TrimSuffix(selector, "}"))
+	if !ok || err != nil {
+		if entryOnly {
+			return "", 0, fmt.Errorf("'%s' is not a stash reference", rev)
+		}
+		n = -1
+	}
+	return rev, n, nil
+}
+
+func buildStashTree(files map[string]gitobj.TreeEntry) (string, error) {
+	entries := make([]gitobj.TreeEntry, 0, len(files))
+	for _, file := range files {
+		entries = append(entries, file)
+	}
+	treeObj, err := gitobj.BuildTree(entries, true)
+	if err != nil {
+		return "", err
+	}
+	return treeObj.Hash, nil
+}
+
+func pushStash(pathspecs []string, opts *StashOptions) error {
+	// Record the index and working tree (and optionally untracked files) the way
+	// Git does: a commit of the working tree whose parents are HEAD, a commit of
+	// the index and a root commit of the untracked files. The changes are then
+	// removed from the working tree.
+	head, err := refs.Resolve(refs.HEAD)
+	if err != nil {
+		return fmt.Errorf("You do not have the initial commit yet")
+	}
+	headCommit, err := gitobj.ReadCommit(head)
+	if err != nil {
+		return err
+	}
+	idx, err := index.Read()
+	if err != nil {
+		return err
+	}
+	if unmerged := idx.Unmerged(); len(unmerged) > 0 {
+		return fmt.Errorf("%s: needs merge\nCannot save the current index state", unmerged[0])
+	}
+	headFiles, err := sourceFiles(headCommit.Tree)
+	if err != nil {
+		return err
+	}
+
+	// The index and working tree states keep HEAD's version of paths outside
+	// the pathspecs.
+	matched := make(map[string]bool)
+	matches := func(filePath string) bool {
+		if !worktree.MatchPathspec(filePath, pathspecs) {
+			return false
+		}
+		for _, spec := range pathspecs {
+			if worktree.MatchPathspec(filePath, []string{spec}) {
+				matched[spec] = true
+			}
+		}
+		return true
+	}
+	indexFiles := make(map[string]gitobj.TreeEntry)
+	for filePath, file := range headFiles {
+		if !worktree.MatchPathspec(filePath, pathspecs) {
+			indexFiles[filePath] = file
+		}
+	}
+	var paths []string
+	for _, entry := range idx.Entries {
+		if matches(entry.Path) {
+			indexFiles[entry.Path] = gitobj.TreeEntry{Name: entry.Path, Mode: entry.ModeString(), Hash: entry.Hash}
+			paths = append(paths, entry.Path)
+		}
+	}
+	for filePath := range headFiles {
+		if matches(filePath) && idx.Find(filePath, 0) == nil {
+			paths = append(paths, filePath)
+		}
+	}
+
+	worktreeFiles := make(map[string]gitobj.TreeEntry, len(indexFiles))
+	for filePath, file := range indexFiles {
+		worktreeFiles[filePath] = file
+	}
+	for _, entry := range idx.Entries {
+		if !worktree.MatchPathspec(entry.Path, pathspecs) {
+			continue
+		}
+		if !worktree.Exists(entry.Path) {
+			delete(worktreeFiles, entry.Path)
+			continue
+		}
+		if modified, err := worktree.IsModified(entry); err != nil {
+			return err
+		} else if modified {
+			added, err := worktree.AddFile(entry.Path)
+			if err != nil {
+				return err
+			}
+			worktreeFiles[entry.Path] = gitobj.TreeEntry{Name: entry.Path, Mode: added.ModeString(), Hash: added.Hash}
+		}
+	}
+
+	var untracked []string
+	untrackedFiles := make(map[string]gitobj.TreeEntry)
+	if opts.includeUntracked || opts.all {
+		candidates, err := worktree.Untracked(idx, opts.all)
+		if err != nil {
+			return err
+		}
+		for _, filePath := range candidates {
+			if !matches(filePath) {
+				continue
+			}
+			added, err := worktree.AddFile(filePath)
+			if err != nil {
+				return err
+			}
+			untracked = append(untracked, filePath)
+			untrackedFiles[filePath] = gitobj.TreeEntry{Name: filePath, Mode: added.ModeString(), Hash: added.Hash}
+		}
+	}
+	if len(pathspecs) > 0 {
+		if err := checkPathspecsMatched(pathspecs, matched); err != nil {
+			return fmt.Errorf("%w\nDid you forget to 'gotgit add'?", err)
+		}
+	}
+
+	indexTree, err := buildStashTree(indexFiles)
+	if err != nil {
+		return err
+	}
+	worktreeTree, err := buildStashTree(worktreeFiles)
+	if err != nil {
+		return err
+	}
+	if indexTree == headCommit.Tree && worktreeTree == headCommit.Tree && len(untracked) == 0 {
+		if !opts.quiet {
+			fmt.Println("No local changes to save")
+		}
+		return nil
+	}
+
+	branch, err := currentBranchName()
+	if err != nil {
+		return err
+	}
+	if branch == "" {
+		branch = "(no branch)"
+	}
+	description := fmt.Sprintf("%s: %s %s", branch, head[:7], headCommit.Subject())
+	indexCommit, err := createCommit(indexTree, []string{head}, "index on "+description+"\n", nil)
+	if err != nil {
+		return err
+	}
+	parents := []string{head, indexCommit}
+	if len(untracked) > 0 {
+		untrackedTree, err := buildStashTree(untrackedFiles)
+		if err != nil {
+			return err
+		}
+		untrackedCommit, err := createCommit(untrackedTree, nil, "untracked files on "+description+"\n", nil)
+		if err != nil {
+			return err
+		}
+		parents = append(parents, untrackedCommit)
+	}
+	message := "WIP on " + description
+	if opts.message != "" {
+		message = fmt.Sprintf("On %s: %s", branch, opts.message)
+	}
+	stashCommit, err := createCommit(worktreeTree, parents, message+"\n", nil)
+	if err != nil {
+		return err
+	}
+	if err := refs.Update(stashRef, stashCommit, message); err != nil {
+		return err
+	}
+	if !opts.quiet {
+		fmt.Printf("Saved working directory and index state %s\n", message)
+	}
+
+	// Go back to HEAD (or the index with --keep-index) for the stashed paths.
+	target, targetFiles := headCommit.Tree, headFiles
+	if opts.keepIndex {
+		target, targetFiles = indexTree, indexFiles
+	}
+	if len(pathspecs) == 0 {
+		if err := resetHard(idx, target); err != nil {
+			return err
+		}
+	} else {
+		slices.Sort(paths)
+		paths = slices.Compact(paths)
+		resetIndexPaths(idx, targetFiles, paths)
+		for _, filePath := range paths {
+			if file, ok := targetFiles[filePath]; ok {
+				err = worktree.WriteFile(filePath, file.Hash, file.Mode)
+			} else {
+				err = worktree.RemoveFile(filePath)
+			}
+			if err != nil {
+				return err
+			}
+			if entry := idx.Find(filePath, 0); entry != nil {
+				if updated, err := worktree.NewEntry(filePath, entry.Hash, entry.ModeString()); err == nil {
+					idx.Add(updated)
+				}
+			}
+		}
+		if err := idx.Write(); err != nil {
+			return err
+		}
+	}
+	for _, filePath := range untracked {
+		if err := worktree.RemoveFile(filePath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func listStashes() error {
+	entries, err := refs.ReadReflog(stashRef)
+	if err != nil {
+		return err
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		fmt.Printf("stash@{%d}: %s\n", len(entries)-1-i, entries[i].Message)
+	}
+	return nil
+}
+
+func readStash(rev string) (*gitobj.Commit, error) {
+	hash, err := refs.ResolveCommit(rev)
+	if err != nil {
+		return nil, err
+	}
+	commit, err := gitobj.ReadCommit(hash)
+	if err != nil {
+		return nil, err
+	}
+	if len(commit.Parents) < 2 || len(commit.Parents) > 3 {
+		return nil, fmt.Errorf("'%s' is not a stash-like commit", rev)
+	}
+	return commit, nil
+}
+
+func showStash(rev string, opts *StashOptions) error {
+	// Show the changes recorded in a stash relative to the commit it was made on.
+	stash, err := readStash(rev)
+	if err != nil {
+		return err
+	}
+	baseTree, err := commitTree(stash.Parents[0])
+	if err != nil {
+		return err
+	}
+	changes, err := diff.TreeDiff(baseTree, stash.Tree, &diff.Options{Recursive: true, DetectRenames: true})
+	if err != nil {
+		return err
+	}
+	if opts.nameOnly || opts.nameStatus {
+		for _, change := range changes {
+			if opts.nameOnly {
+				fmt.Println(change.Path())
+			} else {
+				fmt.Printf("%s\t%s\n", change.StatusString(), change.Path())
+			}
+		}
+		return nil
+	}
+	if opts.patch {
+		return diff.WritePatch(os.Stdout, changes)
+	}
+	stats, err := diff.Stat(changes)
+	if err != nil {
+		return err
+	}
+	return diff.WriteStat(os.Stdout, stats)
+}
+
+func dropStash(rev string, n int, quiet bool) error {
+	hash, err := refs.ResolveCommit(rev)
+	if err != nil {
+		return err
+	}
+	if err := refs.DropReflogEntry(stashRef, n); err != nil {
+		return err
+	}
+	if !quiet {
+		fmt.Printf("Dropped %s (%s)\n", rev, hash)
+	}
+	return nil
+}
+
+func applyStash(rev string, restoreIndex, quiet bool) (bool, error) {
+	// Merge the stashed changes into the working tree, using the commit the
+	// stash was made on as the base. Changes that were staged are only staged
+	// again with `restoreIndex`; files the stash added are always staged.
+	stash, err := readStash(rev)
+	if err != nil {
+		return false, err
+	}
+	idx, err := index.Read()
+	if err != nil {
+		return false, err
+	}
+	if len(idx.Unmerged()) > 0 {
+		return false, fmt.Errorf("Cannot apply a stash in the middle of a merge")
+	}
+	currentTree, err := idx.WriteTree()
+	if err != nil {
+		return false, err
+	}
+	baseTree, err := commitTree(stash.Parents[0])
+	if err != nil {
+		return false, err
+	}
+	stashedIndexTree, err := commitTree(stash.Parents[1])
+	if err != nil {
+		return false, err
+	}
+
+	mergeOpts, err := strategyOptions(nil)
+	if err != nil {
+		return false, err
+	}
+	mergeOpts.OursLabel, mergeOpts.TheirsLabel, mergeOpts.BaseLabel = "Updated upstream", "Stashed changes", "Stash base"
+
+	indexTree := ""
+	if restoreIndex && stashedIndexTree != baseTree {
+		indexResult, err := merge.MergeTrees(baseTree, currentTree, stashedIndexTree, mergeOpts)
+		if err != nil {
+			return false, err
+		}
+		if !indexResult.Clean() {
+			return false, fmt.Errorf("Conflicts in index. Try without --index.")
+		}
+		indexTree = indexResult.Tree
+	}
+
+	var untracked []gitobj.TreeEntry
+	if len(stash.Parents) == 3 {
+		untrackedTree, err := commitTree(stash.Parents[2])
+		if err != nil {
+			return false, err
+		}
+		if untracked, err = gitobj.ReadTreeRecursive(untrackedTree); err != nil {
+			return false, err
+		}
+		for _, file := range untracked {
+			if worktree.Exists(file.Name) {
+				return false, fmt.Errorf("%s already exists, no checkout\n"+
+					"could not restore untracked files from stash", file.Name)
+			}
+		}
+	}
+
+	result, err := merge.MergeTrees(baseTree, currentTree, stash.Tree, mergeOpts)
+	if err != nil {
+		return false, err
+	}
+	if err := applyMergeResult(idx, result); err != nil {
+		return false, err
+	}
+	for _, file := range untracked {
+		if err := worktree.WriteFile(file.Name, file.Hash, file.Mode); err != nil {
+			return false, err
+		}
+	}
+	if !quiet || !result.Clean() {
+		for _, message := range result.Messages {
+			fmt.Println(message)
+		}
+	}
+	if !result.Clean() {
+		return false, nil
+	}
+
+	if indexTree != "" {
+		err = idx.OneWayMerge(indexTree)
+	} else {
+		// Unstage the changes again, except for files the stash adds.
+		current, err := sourceFiles(currentTree)
+		if err != nil {
+			return false, err
+		}
+		var added []*index.Entry
+		for _, entry := range idx.Entries {
+			if _, ok := current[entry.Path]; !ok {
+				added = append(added, entry)
+			}
+		}
+		if err = idx.OneWayMerge(currentTree); err == nil {
+			for _, entry := range added {
+				idx.Add(entry)
+			}
+		}
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, idx.Write()
+}
+
+func stashBranch(name string, args []string) (bool, error) {
+	// Create a branch at the commit a stash was made on, check it out and apply
+	// the stash there, dropping it if that went well.
+	rev, n, err := resolveStash(args, false)
+	if err != nil {
+		return false, err
+	}
+	stash, err := readStash(rev)
+	if err != nil {
+		return false, err
+	}
+	req, err := newBranchRequest(name, stash.Parents[0], false)
+	if err != nil {
+		return false, err
+	}
+	if err := switchHead(req); err != nil {
+		return false, err
+	}
+	ok, err := applyStash(rev, true, false)
+	if err != nil || !ok || n < 0 {
+		return ok, err
+	}
+	return true, dropStash(rev, n, false)
+}
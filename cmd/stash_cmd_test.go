@@ -0,0 +1,251 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/tsoud/GoTGit.git/gitobj"
+	"github.com/tsoud/GoTGit.git/internal/testutil"
+	"github.com/tsoud/GoTGit.git/refs"
+)
+
+func setupStash(t *testing.T) string {
+	// Start from setupReset's second commit with "a" staged, "a" and "b"
+	// changed in the working tree and an untracked file "new". Returns HEAD.
+	t.Helper()
+	_, head := setupReset(t)
+	stageFiles(t, map[string]string{"a": "staged a\n"})
+	testutil.WriteFiles(t, ".", map[string]string{"a": "local a\n", "b": "local b\n", "new": "new\n"})
+	return head
+}
+
+func readCommit(t *testing.T, rev string) *gitobj.Commit {
+	t.Helper()
+	hash, err := refs.ResolveCommit(rev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit, err := gitobj.ReadCommit(hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return commit
+}
+
+func checkTree(t *testing.T, rev string, files map[string]string) {
+	// Check the contents of files in the tree of `rev`; "" means the file is missing.
+	t.Helper()
+	for name, want := range files {
+		if got := showFile(t, rev+":"+name); got != want {
+			t.Errorf("Wanted %s:%s to contain %q, got %q", rev, name, want, got)
+		}
+	}
+}
+
+func TestStashPush(t *testing.T) {
+	tests := []struct {
+		args []string
+		// stash, stashIndex and untracked are the contents of the stash commit
+		// and its index and untracked parents; a nil untracked means there is
+		// no untracked parent.
+		stash, stashIndex, untracked map[string]string
+		// index and files are the contents of the index and working tree
+		// afterwards; "" means the file is missing.
+		index, files map[string]string
+	}{
+		{args: nil,
+			stash:      map[string]string{"a": "local a\n", "b": "local b\n", "c": "c2\n", "new": ""},
+			stashIndex: map[string]string{"a": "staged a\n", "b": "b1\n", "c": "c2\n"},
+			index:      map[string]string{"a": "a2\n", "b": "b1\n"},
+			files:      map[string]string{"a": "a2\n", "b": "b1\n", "c": "c2\n", "new": "new\n"}},
+		{args: []string{"--keep-index"},
+			stash:      map[string]string{"a": "local a\n", "b": "local b\n"},
+			stashIndex: map[string]string{"a": "staged a\n", "b": "b1\n"},
+			index:      map[string]string{"a": "staged a\n", "b": "b1\n"},
+			files:      map[string]string{"a": "staged a\n", "b": "b1\n", "new": "new\n"}},
+		{args: []string{"-u", "-m", "with new"},
+			stash:      map[string]string{"a": "local a\n", "b": "local b\n", "new": ""},
+			stashIndex: map[string]string{"a": "staged a\n", "new": ""},
+			untracked:  map[string]string{"new": "new\n", "a": "", "c": ""},
+			index:      map[string]string{"a": "a2\n", "new": ""},
+			files:      map[string]string{"a": "a2\n", "b": "b1\n", "new": ""}},
+		{args: []string{"--", "b"},
+			stash:      map[string]string{"a": "a2\n", "b": "local b\n"},
+			stashIndex: map[string]string{"a": "a2\n", "b": "b1\n"},
+			index:      map[string]string{"a": "staged a\n", "b": "b1\n"},
+			files:      map[string]string{"a": "local a\n", "b": "b1\n", "new": "new\n"}},
+		{args: []string{"-u", "new"},
+			stash:      map[string]string{"a": "a2\n", "b": "b1\n", "new": ""},
+			stashIndex: map[string]string{"a": "a2\n"},
+			untracked:  map[string]string{"new": "new\n"},
+			index:      map[string]string{"a": "staged a\n"},
+			files:      map[string]string{"a": "local a\n", "b": "local b\n", "new": ""}},
+	}
+	for _, test := range tests {
+		t.Run(strings.Join(test.args, " "), func(t *testing.T) {
+			head := setupStash(t)
+			gotgit(t, append([]string{"stash", "push", "-q"}, test.args...)...)
+
+			// The stash is a commit of the working tree whose parents are HEAD,
+			// a commit of the index on HEAD and, with untracked files, a root
+			// commit of those.
+			stash := readCommit(t, "stash@{0}")
+			wantParents := 2
+			if test.untracked != nil {
+				wantParents = 3
+			}
+			if len(stash.Parents) != wantParents || stash.Parents[0] != head {
+				t.Fatalf("Wanted %d parents starting with HEAD %s, got %q", wantParents, head, stash.Parents)
+			}
+			indexCommit := readCommit(t, "stash^2")
+			if len(indexCommit.Parents) != 1 || indexCommit.Parents[0] != head ||
+				!strings.HasPrefix(indexCommit.Subject(), "index on main: "+head[:7]) {
+				t.Errorf("Wanted the index commit on HEAD, got %q with parents %q",
+					indexCommit.Subject(), indexCommit.Parents)
+			}
+			checkTree(t, "stash", test.stash)
+			checkTree(t, "stash^2", test.stashIndex)
+			if test.untracked != nil {
+				untrackedCommit := readCommit(t, "stash^3")
+				if len(untrackedCommit.Parents) != 0 ||
+					!strings.HasPrefix(untrackedCommit.Subject(), "untracked files on main: "+head[:7]) {
+					t.Errorf("Wanted a root commit of the untracked files, got %q with parents %q",
+						untrackedCommit.Subject(), untrackedCommit.Parents)
+				}
+				checkTree(t, "stash^3", test.untracked)
+			}
+
+			for name, want := range test.index {
+				if got := showFile(t, ":"+name); got != want {
+					t.Errorf("Wanted %s staged as %q, got %q", name, want, got)
+				}
+			}
+			checkFiles(t, test.files)
+		})
+	}
+
+	setupStash(t)
+	gotgit(t, "stash", "-q", "-m", "fix it")
+	if got := readCommit(t, "stash").Subject(); got != "On main: fix it" {
+		t.Errorf("Wanted the stash message %q, got %q", "On main: fix it", got)
+	}
+	stash, _ := refs.ResolveCommit("stash")
+	gotgit(t, "stash", "push", "-q")
+	if hash, _ := refs.ResolveCommit("stash"); hash != stash {
+		t.Error("Wanted no stash made without local changes")
+	}
+	for _, test := range []struct {
+		args []string
+		err  string
+	}{
+		{[]string{"push", "--", "nothing"}, "pathspec 'nothing' did not match any file(s) known to gotgit"},
+		{[]string{"list", "--", "a"}, "only `stash push` takes pathspecs"},
+		{[]string{"drop", "stash@{5}"}, "stash@{5} is not a valid reference"},
+		{[]string{"apply", "main"}, "'main' is not a stash-like commit"},
+		{[]string{"pop", "main"}, "'main' is not a stash reference"},
+		{[]string{"branch"}, "No branch name specified"},
+	} {
+		if _, err := Run(append([]string{"stash"}, test.args...)); err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("Wanted stash %q to fail with %q, got %v", test.args, test.err, err)
+		}
+	}
+}
+
+func TestStashApply(t *testing.T) {
+	tests := []struct {
+		args []string
+		// index and files are the contents of the index and working tree
+		// afterwards; "" means the file is missing.
+		index, files map[string]string
+		// kept is whether the stash entry is still there afterwards.
+		kept bool
+	}{
+		{args: []string{"apply"},
+			index: map[string]string{"a": "a2\n", "b": "b1\n", "new": "new\n"},
+			files: map[string]string{"a": "local a\n", "b": "local b\n", "new": "new\n"},
+			kept:  true},
+		{args: []string{"pop"},
+			index: map[string]string{"a": "a2\n", "b": "b1\n", "new": "new\n"},
+			files: map[string]string{"a": "local a\n", "b": "local b\n", "new": "new\n"}},
+		{args: []string{"pop", "--index"},
+			index: map[string]string{"a": "staged a\n", "b": "b1\n", "new": "new\n"},
+			files: map[string]string{"a": "local a\n", "b": "local b\n", "new": "new\n"}},
+		{args: []string{"apply", "--index", "stash@{0}"},
+			index: map[string]string{"a": "staged a\n", "b": "b1\n", "new": "new\n"},
+			files: map[string]string{"a": "local a\n", "b": "local b\n", "new": "new\n"},
+			kept:  true},
+	}
+	for _, test := range tests {
+		t.Run(strings.Join(test.args, " "), func(t *testing.T) {
+			setupStash(t)
+			stageFiles(t, map[string]string{"new": "new\n"})
+			gotgit(t, "stash", "push", "-q")
+			checkFiles(t, map[string]string{"a": "a2\n", "b": "b1\n", "new": ""})
+
+			gotgit(t, append([]string{"stash"}, append(test.args, "-q")...)...)
+			for name, want := range test.index {
+				if got := showFile(t, ":"+name); got != want {
+					t.Errorf("Wanted %s staged as %q, got %q", name, want, got)
+				}
+			}
+			checkFiles(t, test.files)
+			if refs.Exists(stashRef) != test.kept {
+				t.Errorf("Wanted the stash entry kept: %v", test.kept)
+			}
+		})
+	}
+
+	// Untracked files come back untracked, and a stash that conflicts with the
+	// working tree is kept.
+	_, head := setupReset(t)
+	testutil.WriteFiles(t, ".", map[string]string{"a": "local a\n", "new": "new\n"})
+	gotgit(t, "stash", "-q", "-u")
+	gotgit(t, "stash", "pop", "-q")
+	checkFiles(t, map[string]string{"a": "local a\n", "new": "new\n"})
+	if got := showFile(t, ":new"); got != "" {
+		t.Errorf("Wanted the untracked file left untracked, got it staged as %q", got)
+	}
+
+	gotgit(t, "stash", "-q")
+	checkoutBranch(t, "main", commitFiles(t, "third", map[string]string{"a": "a3\n", "b": "b1\n", "c": "c2\n"}, head))
+	if status := gotgit(t, "stash", "pop", "-q"); status != 1 {
+		t.Errorf("Wanted a conflicting pop to exit with status 1, got %d", status)
+	}
+	if !refs.Exists(stashRef) {
+		t.Error("Wanted the stash entry kept after a conflict")
+	}
+	if got := testutil.ReadFile(t, "a"); !strings.Contains(got, "<<<<<<< Updated upstream\na3\n") ||
+		!strings.Contains(got, "local a\n>>>>>>> Stashed changes\n") {
+		t.Errorf("Wanted conflict markers in a, got %q", got)
+	}
+}
+
+func TestStashBranch(t *testing.T) {
+	head := setupStash(t)
+	gotgit(t, "stash", "-q", "-m", "first")
+	testutil.WriteFiles(t, ".", map[string]string{"c": "local c\n"})
+	gotgit(t, "stash", "-q", "-m", "second")
+	checkoutBranch(t, "main", commitFiles(t, "third", map[string]string{"a": "a3\n"}, head))
+
+	// The branch starts at the commit the stash was made on, with the stash
+	// applied, its index included, and the entry dropped.
+	gotgit(t, "stash", "branch", "fix", "stash@{1}")
+	if branch, _ := currentBranchName(); branch != "fix" {
+		t.Errorf("Wanted to be on branch fix, got %q", branch)
+	}
+	if hash, _ := refs.ResolveCommit("HEAD"); hash != head {
+		t.Errorf("Wanted fix to start at %s, got %s", head, hash)
+	}
+	for name, want := range map[string]string{"a": "staged a\n", "b": "b1\n"} {
+		if got := showFile(t, ":"+name); got != want {
+			t.Errorf("Wanted %s staged as %q, got %q", name, want, got)
+		}
+	}
+	checkFiles(t, map[string]string{"a": "local a\n", "b": "local b\n", "c": "c2\n"})
+	if got := readCommit(t, "stash@{0}").Subject(); got != "On main: second" {
+		t.Errorf("Wanted only the second stash left, got %q", got)
+	}
+	if _, err := refs.ResolveCommit("stash@{1}"); err == nil {
+		t.Error("Wanted the applied stash dropped")
+	}
+}
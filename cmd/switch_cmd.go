@@ -0,0 +1,412 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/tsoud/GoTGit.git/config"
+	"github.com/tsoud/GoTGit.git/gitobj"
+	"github.com/tsoud/GoTGit.git/hooks"
+	"github.com/tsoud/GoTGit.git/index"
+	"github.com/tsoud/GoTGit.git/refs"
+	"github.com/tsoud/GoTGit.git/worktree"
+)
+
+const SwitchUsageMsg = "usage: switch [<options>] [--no-guess] <branch>\n" +
+	"   or: switch [<options>] --detach [<start-point>]\n" +
+	"   or: switch [<options>] (-c|-C) <new-branch> [<start-point>]\n" +
+	"   or: switch [<options>] --orphan <new-branch>\n"
+
+type SwitchOptions struct {
+	create      string
+	forceCreate string
+	detach      bool
+	force       bool
+	merge       bool
+	orphan      string
+	noGuess     bool
+	quiet       bool
+}
+
+func SetupSwitchCmd() (*flag.FlagSet, *SwitchOptions) {
+	switchCmd := flag.NewFlagSet("switch", flag.ExitOnError)
+	opts := &SwitchOptions{}
+
+	switchCmd.StringVar(&opts.create, "c", "", "Create a new branch <new-branch> at <start-point> and switch to it.")
+	switchCmd.StringVar(&opts.create, "create", "", "Same as `-c`.")
+	switchCmd.StringVar(&opts.forceCreate, "C", "", "Like `-c`, but reset <new-branch> if it already exists.")
+	switchCmd.StringVar(&opts.forceCreate, "force-create", "", "Same as `-C`.")
+	switchCmd.BoolVar(&opts.detach, "d", false, "Switch to a commit for inspection, detaching HEAD.")
+	switchCmd.BoolVar(&opts.detach, "detach", false, "Same as `-d`.")
+	switchCmd.BoolVar(&opts.force, "f", false, "Throw away local changes.")
+	switchCmd.BoolVar(&opts.force, "force", false, "Same as `-f`.")
+	switchCmd.BoolVar(&opts.force, "discard-changes", false, "Same as `-f`.")
+	switchCmd.BoolVar(&opts.merge, "m", false, "Carry local changes over with a three-way merge.")
+	switchCmd.BoolVar(&opts.merge, "merge", false, "Same as `-m`.")
+	switchCmd.StringVar(&opts.orphan, "orphan", "", "Create a new unborn branch and remove all tracked files.")
+	switchCmd.BoolVar(&opts.noGuess, "no-guess", false,
+		"Don't create a branch from a matching remote-tracking branch.")
+	switchCmd.BoolVar(&opts.quiet, "q", false, "Suppress feedback messages.")
+	switchCmd.BoolVar(&opts.quiet, "quiet", false, "Same as `-q`.")
+
+	return switchCmd, opts
+}
+
+// switchRequest describes how HEAD, the index and the working tree should move.
+// It is shared by `switch` and the branch mode of `checkout`.
+type switchRequest struct {
+	// target is the revision as the user gave it, used in the reflog.
+	target string
+	// branch is the full name of the branch to check out, or "" to detach HEAD.
+	branch string
+	// commit is the commit to check out, or "" for an unborn branch.
+	commit string
+	// create makes `branch` point at `commit` first; reset says it already existed.
+	create, reset bool
+	// upstream is a remote-tracking branch the new branch should track.
+	upstream string
+	orphan   bool
+	// keepTree leaves the index and working tree alone (`checkout --orphan`).
+	keepTree     bool
+	detachAdvice bool
+	force        bool
+	merge        bool
+	quiet        bool
+}
+
+func commitTree(commitHash string) (string, error) {
+	// Return the tree of a commit; no commit (an unborn branch) has the empty tree.
+	if commitHash == "" {
+		return "", nil
+	}
+	commit, err := gitobj.ReadCommit(commitHash)
+	if err != nil {
+		return "", err
+	}
+	return commit.Tree, nil
+}
+
+func printLocalChanges(idx *index.Index, commitHash string) error {
+	// List the changes carried over to the new HEAD, like `git status --short`.
+	treeHash, err := commitTree(commitHash)
+	if err != nil {
+		return err
+	}
+	changes, err := worktree.LocalChanges(idx, treeHash)
+	if err != nil {
+		return err
+	}
+	for _, change := range changes {
+		fmt.Printf("%c\t%s\n", change.Status, change.Path())
+	}
+	return nil
+}
+
+func headLine(commitHash string) string {
+	// Describe a commit as "<abbreviated hash> <subject>".
+	commit, err := gitobj.ReadCommit(commitHash)
+	if err != nil {
+		return commitHash[:7]
+	}
+	return commitHash[:7] + " " + commit.Subject()
+}
+
+const detachAdviceMsg = "Note: switching to '%s'.\n\n" +
+	"You are in 'detached HEAD' state. You can look around, make experimental\n" +
+	"changes and commit them, and you can discard any commits you make in this\n" +
+	"state without impacting any branches by switching back to a branch.\n\n" +
+	"If you want to create a new branch to retain commits you create, you may\n" +
+	"do so (now or later) by using -c with the switch command. Example:\n\n" +
+	"  gotgit switch -c <new-branch-name>\n\n" +
+	"Or undo this operation with:\n\n" +
+	"  gotgit switch -\n\n" +
+	"Turn off this advice by setting config variable advice.detachedHead to false\n\n"
+
+func switchHead(req *switchRequest) error {
+	// Move HEAD as requested, then run the post-checkout hook.
+	oldHash := mustResolveHead()
+	if err := moveHead(req); err != nil {
+		return err
+	}
+	hooks.PostCheckout(oldHash, req.commit, true)
+	return nil
+}
+
+func moveHead(req *switchRequest) error {
+	current, err := refs.CurrentBranch()
+	if err != nil {
+		return err
+	}
+	oldHash, err := refs.Resolve(refs.HEAD)
+	if err != nil && err != refs.ErrNotFound {
+		return err
+	}
+
+	idx, err := index.Read()
+	if err != nil {
+		return err
+	}
+	if !req.keepTree {
+		oldTree, err := commitTree(oldHash)
+		if err != nil {
+			return err
+		}
+		newTree, err := commitTree(req.commit)
+		if err != nil {
+			return err
+		}
+
+		label := req.target
+		if req.branch != "" {
+			label = refs.ShortName(req.branch)
+		}
+		conflicts, err := worktree.Checkout(idx, oldTree, newTree, &worktree.CheckoutOptions{
+			Force: req.force, Merge: req.merge, NewLabel: label,
+		})
+		if err != nil {
+			return err
+		}
+		if err := idx.Write(); err != nil {
+			return err
+		}
+		for _, path := range conflicts {
+			fmt.Fprintf(os.Stderr, "warning: conflicts in %s\n", path)
+		}
+	}
+
+	from := oldHash
+	if current != "" {
+		from = refs.ShortName(current)
+	}
+	to := req.target
+	if req.branch != "" {
+		to = refs.ShortName(req.branch)
+	}
+	message := fmt.Sprintf("checkout: moving from %s to %s", from, to)
+
+	if req.create && !req.orphan {
+		createMsg := "branch: Created from " + req.target
+		if req.reset {
+			createMsg = "branch: Reset to " + req.target
+		}
+		if err := refs.Update(req.branch, req.commit, createMsg); err != nil {
+			return err
+		}
+		if req.upstream != "" {
+			if err := trackUpstream(refs.ShortName(req.branch), req.upstream, req.quiet); err != nil {
+				return err
+			}
+		}
+	}
+	if req.branch != "" {
+		err = refs.SetSymbolic(refs.HEAD, req.branch, message)
+	} else {
+		err = refs.Update(refs.HEAD, req.commit, message)
+	}
+	if err != nil {
+		return err
+	}
+
+	if req.quiet {
+		return nil
+	}
+	if !req.keepTree && req.commit != "" {
+		if err := printLocalChanges(idx, req.commit); err != nil {
+			return err
+		}
+	}
+	switch {
+	case req.branch == "":
+		if current != "" && req.detachAdvice {
+			cfg, err := config.Load()
+			if err != nil {
+				return err
+			}
+			if cfg.GetBool("advice.detachedHead", true) {
+				fmt.Fprintf(os.Stderr, detachAdviceMsg, req.target)
+			}
+		}
+		if current == "" && oldHash != "" && oldHash != req.commit {
+			fmt.Fprintf(os.Stderr, "Previous HEAD position was %s\n", headLine(oldHash))
+		}
+		fmt.Fprintf(os.Stderr, "HEAD is now at %s\n", headLine(req.commit))
+	case req.branch == current && !req.create:
+		fmt.Fprintf(os.Stderr, "Already on '%s'\n", to)
+	case req.reset:
+		fmt.Fprintf(os.Stderr, "Switched to and reset branch '%s'\n", to)
+	case req.create || req.orphan:
+		fmt.Fprintf(os.Stderr, "Switched to a new branch '%s'\n", to)
+	default:
+		if current == "" && oldHash != "" {
+			fmt.Fprintf(os.Stderr, "Previous HEAD position was %s\n", headLine(oldHash))
+		}
+		fmt.Fprintf(os.Stderr, "Switched to branch '%s'\n", to)
+	}
+
+	return nil
+}
+
+func newBranchRequest(name, startPoint string, reset bool) (*switchRequest, error) {
+	// Prepare a request that creates (or with `reset`, resets) branch `name` at
+	// `startPoint` and checks it out.
+	fullName := "refs/heads/" + name
+	if err := refs.ValidateName(fullName); err != nil {
+		return nil, fmt.Errorf("'%s' is not a valid branch name", name)
+	}
+	exists := refs.Exists(fullName)
+	if exists && !reset {
+		return nil, fmt.Errorf("a branch named '%s' already exists", name)
+	}
+
+	if startPoint == "" {
+		startPoint = "HEAD"
+	}
+	commitHash, err := refs.ResolveCommit(startPoint)
+	if err != nil {
+		return nil, fmt.Errorf("'%s' is not a commit and a branch '%s' cannot be created from it",
+			startPoint, name)
+	}
+
+	req := &switchRequest{target: startPoint, branch: fullName, commit: commitHash, create: true, reset: exists}
+	if upstream, ok := refs.Expand(startPoint); ok && strings.HasPrefix(upstream, "refs/remotes/") {
+		req.upstream = upstream
+	}
+	return req, nil
+}
+
+func guessRemoteBranch(name string) (string, error) {
+	// Find the only remote-tracking branch called `name`, if there is exactly one.
+	remoteBranches, err := refs.List("refs/remotes/")
+	if err != nil {
+		return "", err
+	}
+	var found []string
+	for _, ref := range remoteBranches {
+		_, branch, _ := strings.Cut(strings.TrimPrefix(ref.Name, "refs/remotes/"), "/")
+		if branch == name {
+			found = append(found, ref.Name)
+		}
+	}
+	if len(found) != 1 {
+		return "", nil
+	}
+	return found[0], nil
+}
+
+func branchRequest(target string, guess bool) (*switchRequest, error) {
+	// Prepare a request that checks out an existing local branch, or creates one
+	// from a remote-tracking branch of the same name if `guess` is set. Returns
+	// nil if `target` is not a branch.
+	if target == "-" {
+		target = "@{-1}"
+	}
+	name := target
+	if strings.HasPrefix(target, "@{-") {
+		previous, err := refs.PreviousBranch(1)
+		if err != nil {
+			return nil, err
+		}
+		name = previous
+	}
+
+	fullName := "refs/heads/" + name
+	if refs.Exists(fullName) {
+		commitHash, err := refs.ResolveCommit(fullName)
+		if err != nil {
+			return nil, err
+		}
+		return &switchRequest{target: name, branch: fullName, commit: commitHash}, nil
+	}
+	if current, _ := refs.CurrentBranch(); current == fullName {
+		// The current branch has no commits yet.
+		return &switchRequest{target: name, branch: fullName}, nil
+	}
+
+	if guess {
+		upstream, err := guessRemoteBranch(name)
+		if err != nil {
+			return nil, err
+		}
+		if upstream != "" {
+			req, err := newBranchRequest(name, refs.ShortName(upstream), false)
+			if err != nil {
+				return nil, err
+			}
+			req.upstream = upstream
+			return req, nil
+		}
+	}
+	return nil, nil
+}
+
+func SwitchCmdHandler(args []string, opts *SwitchOptions) error {
+	var req *switchRequest
+	var err error
+	switch {
+	case opts.orphan != "":
+		if len(args) > 0 {
+			return fmt.Errorf("'--orphan' cannot take <start-point>")
+		}
+		fullName := "refs/heads/" + opts.orphan
+		if err := refs.ValidateName(fullName); err != nil {
+			return fmt.Errorf("'%s' is not a valid branch name", opts.orphan)
+		}
+		if refs.Exists(fullName) {
+			return fmt.Errorf("a branch named '%s' already exists", opts.orphan)
+		}
+		req = &switchRequest{target: opts.orphan, branch: fullName, create: true, orphan: true}
+
+	case opts.create != "" || opts.forceCreate != "":
+		if len(args) > 1 {
+			return fmt.Errorf("too many arguments\n%s", SwitchUsageMsg)
+		}
+		name, reset := opts.create, false
+		if opts.forceCreate != "" {
+			name, reset = opts.forceCreate, true
+		}
+		startPoint := ""
+		if len(args) == 1 {
+			startPoint = args[0]
+		}
+		if req, err = newBranchRequest(name, startPoint, reset); err != nil {
+			return err
+		}
+
+	case opts.detach:
+		if len(args) > 1 {
+			return fmt.Errorf("too many arguments\n%s", SwitchUsageMsg)
+		}
+		target := "HEAD"
+		if len(args) == 1 {
+			target = args[0]
+		}
+		commitHash, err := refs.ResolveCommit(target)
+		if err != nil {
+			return fmt.Errorf("invalid reference: %s", target)
+		}
+		req = &switchRequest{target: target, commit: commitHash}
+
+	default:
+		if len(args) != 1 {
+			return fmt.Errorf("missing branch or commit argument\n%s", SwitchUsageMsg)
+		}
+		if req, err = branchRequest(args[0], !opts.noGuess); err != nil {
+			return err
+		}
+		if req == nil {
+			if fullName, ok := refs.Expand(args[0]); ok && strings.HasPrefix(fullName, "refs/remotes/") {
+				return fmt.Errorf("a branch is expected, got remote branch '%s'", args[0])
+			}
+			if _, err := refs.ResolveCommit(args[0]); err == nil {
+				return fmt.Errorf("a branch is expected, got commit '%s'\n"+
+					"hint: If you want to detach HEAD at the commit, try again with the --detach option.", args[0])
+			}
+			return fmt.Errorf("invalid reference: %s", args[0])
+		}
+	}
+
+	req.force, req.merge, req.quiet = opts.force, opts.merge, opts.quiet
+	return switchHead(req)
+}
@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/tsoud/GoTGit.git/gitobj"
+)
+
+const UnpackObjectsUsageMsg = "usage: unpack-objects [-n] [-q] < <pack-file>\n"
+
+type UnpackObjectsOptions struct {
+	dryRun bool
+	quiet  bool
+}
+
+func SetupUnpackObjectsCmd() (*flag.FlagSet, *UnpackObjectsOptions) {
+	unpackObjectsCmd := flag.NewFlagSet("unpack-objects", flag.ExitOnError)
+	opts := &UnpackObjectsOptions{}
+
+	unpackObjectsCmd.BoolVar(&opts.dryRun, "n", false, "Check the pack without writing any objects.")
+	unpackObjectsCmd.BoolVar(&opts.quiet, "q", false, "Don't report how many objects were unpacked.")
+
+	return unpackObjectsCmd, opts
+}
+
+func UnpackObjectsCmdHandler(opts *UnpackObjectsOptions) error {
+	// Write the objects of a pack read from stdin as loose objects.
+	count, err := gitobj.UnpackObjects(os.Stdin, opts.dryRun)
+	if err != nil {
+		return err
+	}
+	if !opts.quiet {
+		fmt.Fprintf(os.Stderr, "Unpacking objects: 100%% (%d/%d), done.\n", count, count)
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/tsoud/GoTGit.git/gitobj"
+)
+
+const VerifyPackUsageMsg = "usage: verify-pack [-v | -s] <pack>.idx...\n"
+
+type VerifyPackOptions struct {
+	verbose  bool
+	statOnly bool
+}
+
+func SetupVerifyPackCmd() (*flag.FlagSet, *VerifyPackOptions) {
+	verifyPackCmd := flag.NewFlagSet("verify-pack", flag.ExitOnError)
+	opts := &VerifyPackOptions{}
+
+	verifyPackCmd.BoolVar(&opts.verbose, "v", false, "List each object with its type, size, "+
+		"size in the pack, offset and, for deltas, chain depth and base, then a histogram "+
+		"of delta chain lengths.")
+	verifyPackCmd.BoolVar(&opts.statOnly, "s", false, "Only show the histogram of delta chain lengths.")
+
+	return verifyPackCmd, opts
+}
+
+func VerifyPackCmdHandler(packs []string, opts *VerifyPackOptions) (bool, error) {
+	// Check each pack against its index, which may be named by either file.
+	// Returns false if any pack is corrupt.
+	if len(packs) == 0 {
+		return false, fmt.Errorf("no pack given\n%s", VerifyPackUsageMsg)
+	}
+	allOK := true
+	for _, pack := range packs {
+		packPath := strings.TrimSuffix(strings.TrimSuffix(pack, ".idx"), ".pack") + ".pack"
+		err := gitobj.VerifyPack(packPath)
+		if err == nil && (opts.verbose || opts.statOnly) {
+			err = showPackEntries(packPath, !opts.statOnly)
+		}
+		if err != nil {
+			allOK = false
+			fmt.Fprintln(os.Stderr, "error:", err)
+		}
+		if !opts.verbose && !opts.statOnly {
+			continue
+		}
+		if err != nil {
+			fmt.Printf("%s: bad\n", packPath)
+		} else if !opts.statOnly {
+			fmt.Printf("%s: ok\n", packPath)
+		}
+	}
+	return allOK, nil
+}
+
+func showPackEntries(packPath string, listObjects bool) error {
+	// Print the objects of a pack in the order they are stored, then how many
+	// deltas have chains of each length.
+	entries, err := gitobj.ReadPackEntries(packPath)
+	if err != nil {
+		return err
+	}
+	nonDelta := 0
+	var chains []int
+	for _, entry := range entries {
+		if listObjects {
+			fmt.Printf("%s %-6s %d %d %d", entry.Hash, entry.Type, entry.Size, entry.PackedSize, entry.Offset)
+			if entry.Depth > 0 {
+				fmt.Printf(" %d %s", entry.Depth, entry.Base)
+			}
+			fmt.Println()
+		}
+		if entry.Depth == 0 {
+			nonDelta++
+			continue
+		}
+		for len(chains) < entry.Depth {
+			chains = append(chains, 0)
+		}
+		chains[entry.Depth-1]++
+	}
+
+	objects := func(count int) string {
+		if count == 1 {
+			return "1 object"
+		}
+		return fmt.Sprintf("%d objects", count)
+	}
+	if nonDelta > 0 {
+		fmt.Printf("non delta: %s\n", objects(nonDelta))
+	}
+	for i, count := range chains {
+		if count > 0 {
+			fmt.Printf("chain length = %d: %s\n", i+1, objects(count))
+		}
+	}
+	return nil
+}
@@ -9,29 +9,33 @@ import (
 	"github.com/tsoud/GoTGit.git/gitobj"
 )
 
-func SetupWriteTreeCmd() (*flag.FlagSet, *bool, *string) {
-	writeTreeCmd := flag.NewFlagSet("write-tree", flag.ExitOnError)
+const WriteTreeUsageMsg = "usage: write-tree [--ignore] [--prefix=<prefix>/] [--json]\n"
 
-	writeTreeCmd.Usage = func() {
-		fmt.Fprintf(os.Stderr, "gotgit write-tree [--ignore][--prefix=<prefix>/]\n\nusage:\n")
+type WriteTreeOptions struct {
+	ignore bool
+	prefix string
+	json   bool
+}
 
-		writeTreeCmd.PrintDefaults()
-	}
+func SetupWriteTreeCmd() (*flag.FlagSet, *WriteTreeOptions) {
+	writeTreeCmd := flag.NewFlagSet("write-tree", flag.ExitOnError)
+	opts := &WriteTreeOptions{}
 
-	var ignore bool
-	writeTreeCmd.BoolVar(&ignore, "ignore", false,
+	writeTreeCmd.BoolVar(&opts.ignore, "ignore", false,
 		"Ignore files or folders with patterns specified in `.gotgitignore`. This file should "+
 			"be located in the root directory where `write-tree` is being called.",
 	)
-	var prefix string
-	writeTreeCmd.StringVar(&prefix, "prefix", "",
+	writeTreeCmd.StringVar(&opts.prefix, "prefix", "",
 		"Write a tree object for a subdirectory <prefix> in the project.",
 	)
+	writeTreeCmd.BoolVar(&opts.json, "json", false,
+		"Print the hash of the new tree as a JSON object.",
+	)
 
-	return writeTreeCmd, &ignore, &prefix
+	return writeTreeCmd, opts
 }
 
-func WriteTreeCmdHandler(ignore *bool, prefix *string, flags *flag.FlagSet) error {
+func WriteTreeCmdHandler(opts *WriteTreeOptions) error {
 	rootDir, err := os.Getwd()
 
 	if err != nil {
@@ -39,31 +43,34 @@ func WriteTreeCmdHandler(ignore *bool, prefix *string, flags *flag.FlagSet) erro
 	}
 
 	ignoreFile := ""
-	if *ignore {
+	if opts.ignore {
 		ignoreFile = path.Join(rootDir, ".gotgitignore")
 		if _, err := os.Stat(ignoreFile); err != nil {
 			if os.IsNotExist(err) {
 				return fmt.Errorf("no valid `.gotgitignore` file found in %s", rootDir)
 			}
-			return fmt.Errorf("error reading `.gotgitignore`: %s", err)
+			return fmt.Errorf("error reading `.gotgitignore`: %w", err)
 		}
 	}
 
-	if *prefix != "" {
-		rootDir = path.Join(rootDir, *prefix)
+	if opts.prefix != "" {
+		rootDir = path.Join(rootDir, opts.prefix)
 		if _, err := os.Stat(rootDir); err != nil {
 			if os.IsNotExist(err) {
 				return fmt.Errorf("subdirectory: %s does not exist", rootDir)
 			}
-			return fmt.Errorf("error processing %s: %s", rootDir, err)
+			return fmt.Errorf("error processing %s: %w", rootDir, err)
 		}
 	}
 
 	treeObj, err := gitobj.WriteTree(rootDir, ignoreFile, true)
 	if err != nil {
-		return fmt.Errorf("error writing tree: %s", err)
+		return fmt.Errorf("error writing tree: %w", err)
 	}
 
+	if opts.json {
+		return writeJSON(os.Stdout, map[string]any{"hash": treeObj.Hash})
+	}
 	fmt.Println(treeObj.Hash)
 
 	return nil
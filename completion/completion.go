@@ -0,0 +1,181 @@
+package completion
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/tsoud/GoTGit.git/gitobj"
+	"github.com/tsoud/GoTGit.git/refs"
+)
+
+// Flag is an option of a command under all its names, as they are typed
+// (e.g. "-q" and "--quiet").
+type Flag struct {
+	Names       []string
+	Description string
+	TakesValue  bool
+}
+
+// Command is a command the shell completes, with its options. Arguments are
+// completed as revisions and files, unless the command only accepts `Words`.
+// A command with `Subcommands` has its options set per subcommand, the first
+// of which is used when none is given.
+type Command struct {
+	Name        string
+	Description string
+	Flags       []Flag
+	Words       []string
+	Subcommands []Command
+}
+
+// Spec is everything the completion scripts of a program know statically:
+// its global options and commands. Ref names, paths in trees and object ids
+// are looked up when completing, by running `<Program> __complete`.
+type Spec struct {
+	Program  string
+	Options  []Flag
+	Commands []Command
+}
+
+// Shells are the shells completion scripts can be generated for.
+var Shells = []string{"bash", "zsh", "fish"}
+
+func (spec *Spec) Write(w io.Writer, shell string) error {
+	// Write the completion script for `shell`.
+	var script string
+	switch shell {
+	case "bash":
+		script = spec.bash()
+	case "zsh":
+		script = spec.zsh()
+	case "fish":
+		script = spec.fish()
+	default:
+		return fmt.Errorf("unknown shell '%s' (expected one of %s)", shell, strings.Join(Shells, ", "))
+	}
+	_, err := io.WriteString(w, script)
+	return err
+}
+
+// Kinds are the kinds of words `__complete` looks up.
+var Kinds = []string{"refs", "objects", "paths", "revisions"}
+
+func Candidates(kind, word string) ([]string, error) {
+	// Return the completions of `word` as one of Kinds.
+	switch kind {
+	case "refs":
+		return Refs(word)
+	case "objects":
+		return Objects(word)
+	case "paths":
+		return TreePaths(word)
+	case "revisions":
+		return Revisions(word)
+	}
+	return nil, fmt.Errorf("unknown completion kind '%s'", kind)
+}
+
+// pseudoRefs are the refs in the git directory itself that are offered when
+// they exist.
+var pseudoRefs = []string{
+	refs.HEAD, "ORIG_HEAD", "FETCH_HEAD", "MERGE_HEAD", "CHERRY_PICK_HEAD", "REVERT_HEAD", "REBASE_HEAD",
+}
+
+func Refs(prefix string) ([]string, error) {
+	// Return the names of the refs starting with `prefix`, shortened the way
+	// they are usually written ("main" for refs/heads/main), sorted by name.
+	var names []string
+	for _, name := range pseudoRefs {
+		if strings.HasPrefix(name, prefix) && refs.Exists(name) {
+			names = append(names, name)
+		}
+	}
+	list, err := refs.List("refs/")
+	if err != nil {
+		return nil, err
+	}
+	var short []string
+	for _, ref := range list {
+		for _, name := range []string{refs.ShortName(ref.Name), ref.Name} {
+			if strings.HasPrefix(name, prefix) {
+				short = append(short, name)
+				break
+			}
+		}
+	}
+	// A branch and a tag may have the same short name.
+	slices.Sort(short)
+	return append(names, slices.Compact(short)...), nil
+}
+
+// minObjectPrefix is how much of a hash has to be typed before object ids are
+// completed, the shortest abbreviation a hash can be given as.
+const minObjectPrefix = 4
+
+func Objects(prefix string) ([]string, error) {
+	// Return the ids of the objects starting with `prefix`, sorted.
+	if len(prefix) < minObjectPrefix {
+		return nil, nil
+	}
+	hashes, err := gitobj.MatchHashes(prefix)
+	if err != nil {
+		return nil, err
+	}
+	slices.Sort(hashes)
+	return hashes, nil
+}
+
+func TreePaths(word string) ([]string, error) {
+	// Complete the path in a `<tree-ish>:<path>` revision from the entries of
+	// the tree it names. Directories end in a slash, so completion can carry
+	// on inside them.
+	treeish, filePath, found := strings.Cut(word, ":")
+	if !found || treeish == "" {
+		return nil, nil
+	}
+	dir, name := path.Split(filePath)
+	rev := treeish
+	if dir != "" {
+		rev += ":" + strings.TrimSuffix(dir, "/")
+	}
+	treeHash, err := refs.ResolveTree(rev)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := gitobj.ReadTree(treeHash)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.Name, name) {
+			continue
+		}
+		candidate := treeish + ":" + dir + entry.Name
+		if entry.Type == "tree" {
+			candidate += "/"
+		}
+		paths = append(paths, candidate)
+	}
+	return paths, nil
+}
+
+func Revisions(word string) ([]string, error) {
+	// Complete a revision: a path in a tree after a colon, otherwise a ref
+	// name or an object id.
+	if strings.Contains(word, ":") {
+		return TreePaths(word)
+	}
+	names, err := Refs(word)
+	if err != nil {
+		return nil, err
+	}
+	hashes, err := Objects(word)
+	if err != nil {
+		return nil, err
+	}
+	return append(names, hashes...), nil
+}
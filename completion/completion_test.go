@@ -0,0 +1,100 @@
+package completion
+
+import (
+	"bytes"
+	"os/exec"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/tsoud/GoTGit.git/internal/testutil"
+	"github.com/tsoud/GoTGit.git/refs"
+)
+
+func TestCandidates(t *testing.T) {
+	testutil.InitRepo(t)
+	tree := testutil.WriteTree(t, map[string]string{"README": "readme\n", "src/main.go": "package main\n"})
+	commit := testutil.WriteCommit(t, tree, "Initial")
+	for _, name := range []string{"refs/heads/main", "refs/heads/maint", "refs/tags/main", "refs/tags/v1.0"} {
+		if err := refs.Update(name, commit, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		kind, word string
+		want       []string
+	}{
+		{"refs", "", []string{"HEAD", "main", "maint", "v1.0"}},
+		{"refs", "mai", []string{"main", "maint"}},
+		{"refs", "refs/t", []string{"refs/tags/main", "refs/tags/v1.0"}},
+		{"objects", commit[:3], nil},
+		{"objects", strings.ToUpper(commit[:8]), []string{commit}},
+		{"paths", "main:", []string{"main:README", "main:src/"}},
+		{"paths", "main:s", []string{"main:src/"}},
+		{"paths", "HEAD:src/", []string{"HEAD:src/main.go"}},
+		{"revisions", "v", []string{"v1.0"}},
+		{"revisions", commit[:6], []string{commit}},
+		{"revisions", "v1.0:R", []string{"v1.0:README"}},
+	}
+	for _, test := range tests {
+		got, err := Candidates(test.kind, test.word)
+		if err != nil {
+			t.Errorf("Candidates(%q, %q): %v", test.kind, test.word, err)
+			continue
+		}
+		if !slices.Equal(got, test.want) {
+			t.Errorf("Candidates(%q, %q) = %q, want %q", test.kind, test.word, got, test.want)
+		}
+	}
+
+	if _, err := Candidates("paths", "missing:src/"); err == nil {
+		t.Error("expected an error completing a path in an unknown revision")
+	}
+	if _, err := Candidates("branches", ""); err == nil {
+		t.Error("expected an error for an unknown kind")
+	}
+}
+
+func TestWrite(t *testing.T) {
+	spec := &Spec{
+		Program: "gotgit",
+		Options: []Flag{{Names: []string{"-C"}, Description: "Run in <path>.", TakesValue: true}},
+		Commands: []Command{
+			{Name: "switch", Description: "Switch branches", Flags: []Flag{
+				{Names: []string{"-c", "--create"}, Description: "Create [and switch to] a new branch.", TakesValue: true},
+				{Names: []string{"-q", "--quiet"}, Description: "Don't say: what's happening."},
+			}},
+			{Name: "stash", Subcommands: []Command{{Name: "push"}, {Name: "pop"}}},
+			{Name: "completion", Words: Shells},
+		},
+	}
+	for _, shell := range Shells {
+		var script bytes.Buffer
+		if err := spec.Write(&script, shell); err != nil {
+			t.Fatal(err)
+		}
+		if unexpanded := regexp.MustCompile("@[A-Z_]+@").FindString(script.String()); unexpanded != "" {
+			t.Errorf("%s script has %s left in it", shell, unexpanded)
+		}
+		for _, want := range []string{"switch", "create", "pop", "__complete revisions"} {
+			if !strings.Contains(script.String(), want) {
+				t.Errorf("%s script is missing %q", shell, want)
+			}
+		}
+		// Check the syntax of the script with the shell itself, if it's installed.
+		if _, err := exec.LookPath(shell); err != nil {
+			continue
+		}
+		check := exec.Command(shell, "-n")
+		check.Stdin = &script
+		if output, err := check.CombinedOutput(); err != nil {
+			t.Errorf("%s script: %v\n%s", shell, err, output)
+		}
+	}
+
+	if err := spec.Write(&bytes.Buffer{}, "csh"); err == nil {
+		t.Error("expected an error for an unknown shell")
+	}
+}
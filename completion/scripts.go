@@ -0,0 +1,475 @@
+package completion
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The scripts are templates in which @PROGRAM@ is the program completed,
+// @FUNC@ the prefix of the shell functions they define, and the other @NAME@s
+// are filled in from the Spec.
+
+const bashScript = `# bash completion for @PROGRAM@
+# Generated by "@PROGRAM@ completion bash". Load it with:
+#     source <(@PROGRAM@ completion bash)
+
+@FUNC@_options() {
+    # Set the options of a command, and which of them take a value.
+    case $1 in
+@OPTIONS@    esac
+}
+
+@FUNC@_revisions() {
+    # Complete ref names, paths in trees and object ids, as well as files.
+    local IFS=$'\n'
+    COMPREPLY=($(compgen -W "$(@PROGRAM@ "${globals[@]}" __complete revisions -- "$cur" 2>/dev/null)" -- "$cur")
+        $(compgen -f -- "$cur"))
+    if [[ ${#COMPREPLY[@]} -eq 1 && ${COMPREPLY[0]} == */ ]]; then
+        compopt -o nospace
+    fi
+    if declare -F __ltrim_colon_completions >/dev/null; then
+        __ltrim_colon_completions "$cur"
+    fi
+}
+
+@FUNC@() {
+    local cur prev words cword
+    if declare -F _get_comp_words_by_ref >/dev/null; then
+        _get_comp_words_by_ref -n =: cur prev words cword
+    else
+        cur=${COMP_WORDS[COMP_CWORD]} prev=${COMP_WORDS[COMP_CWORD-1]}
+        words=("${COMP_WORDS[@]}") cword=$COMP_CWORD
+    fi
+    COMPREPLY=()
+
+    # The global options come before the command.
+    local i=1
+    while ((i < cword)); do
+        case ${words[i]} in
+        @GLOBAL_VALUES@) ((i += 2)) ;;
+        -*) ((i++)) ;;
+        *) break ;;
+        esac
+    done
+    if ((i >= cword)); then
+        case $prev in
+        @GLOBAL_VALUES@) COMPREPLY=($(compgen -f -- "$cur")) ;;
+        *)
+            if [[ $cur == -* ]]; then
+                COMPREPLY=($(compgen -W "@GLOBAL_OPTIONS@" -- "$cur"))
+            else
+                COMPREPLY=($(compgen -W "@COMMANDS@" -- "$cur"))
+            fi
+            ;;
+        esac
+        return
+    fi
+    local globals=("${words[@]:1:i-1}")
+
+    # Only files come after "--".
+    local j
+    for ((j = i + 1; j < cword; j++)); do
+        if [[ ${words[j]} == -- ]]; then
+            COMPREPLY=($(compgen -f -- "$cur"))
+            return
+        fi
+    done
+
+    local command=${words[i]} key=${words[i]} args= subcommands=
+    case $command in
+@WORDS@    esac
+    if [[ -n $subcommands ]]; then
+        if ((cword == i + 1)) && [[ $cur != -* ]]; then
+            COMPREPLY=($(compgen -W "$subcommands" -- "$cur"))
+            return
+        fi
+        key="$command ${subcommands%% *}"
+        if [[ " $subcommands " == *" ${words[i+1]} "* ]]; then
+            key="$command ${words[i+1]}"
+        fi
+    fi
+
+    local opts= values=
+    @FUNC@_options "$key"
+    if [[ " $values " == *" $prev "* ]]; then
+        @FUNC@_revisions
+    elif [[ $cur == -* ]]; then
+        COMPREPLY=($(compgen -W "$opts" -- "$cur"))
+    elif [[ -n $args ]]; then
+        COMPREPLY=($(compgen -W "$args" -- "$cur"))
+    else
+        @FUNC@_revisions
+    fi
+}
+
+complete -o bashdefault -o default -F @FUNC@ @PROGRAM@
+`
+
+const zshScript = `#compdef @PROGRAM@
+# zsh completion for @PROGRAM@
+# Generated by "@PROGRAM@ completion zsh". Load it with:
+#     source <(@PROGRAM@ completion zsh)
+# or save it as _@PROGRAM@ in a directory on $fpath.
+
+@FUNC@_revisions() {
+    # Complete ref names, paths in trees and object ids, as well as files.
+    local -a revisions
+    local ret=1
+    revisions=(${(f)"$(@PROGRAM@ "${@FUNC@_globals[@]}" __complete revisions -- "$PREFIX" 2>/dev/null)"})
+    compadd -S '' -- ${(M)revisions:#*/} && ret=0
+    compadd -- ${revisions:#*/} && ret=0
+    _files && ret=0
+    return ret
+}
+
+@FUNC@_arguments() {
+    # Complete the options and arguments of the command in $words[1].
+    local key=$words[1]
+    case $key in
+@SUBCOMMANDS@    esac
+    case $key in
+@ARGUMENTS@    esac
+}
+
+@FUNC@() {
+    local curcontext=$curcontext state line ret=1
+    local -a @FUNC@_globals
+    local i=2
+    while ((i < CURRENT)); do
+        case $words[i] in
+        (@GLOBAL_VALUES@) ((i += 2)) ;;
+        (-*) ((i++)) ;;
+        (*) break ;;
+        esac
+    done
+    @FUNC@_globals=(${words[2,i-1]})
+
+    _arguments -C \
+@GLOBAL_OPTIONS@        '(-): :->command' \
+        '(-)*:: :->argument' && ret=0
+
+    case $state in
+    command)
+        local -a commands=(
+@COMMANDS@        )
+        _describe -t commands '@PROGRAM@ command' commands && ret=0
+        ;;
+    argument)
+        curcontext=${curcontext%:*:*}:@PROGRAM@-$words[1]:
+        @FUNC@_arguments && ret=0
+        ;;
+    esac
+    return ret
+}
+
+if [[ $funcstack[1] == @FUNC@ ]]; then
+    @FUNC@ "$@"
+else
+    compdef @FUNC@ @PROGRAM@
+fi
+`
+
+const fishScript = `# fish completion for @PROGRAM@
+# Generated by "@PROGRAM@ completion fish". Load it with:
+#     @PROGRAM@ completion fish | source
+# or save it as ~/.config/fish/completions/@PROGRAM@.fish.
+
+function @FUNC@_command_index
+    # Print where the command is among the words typed so far, after the
+    # global options.
+    set -l words (commandline -opc)
+    set -l i 2
+    while test $i -le (count $words)
+        switch $words[$i]
+            case @GLOBAL_VALUES@
+                set i (math $i + 2)
+            case '-*'
+                set i (math $i + 1)
+            case '*'
+                echo $i
+                return 0
+        end
+    end
+    return 1
+end
+
+function @FUNC@_needs_command
+    not @FUNC@_command_index >/dev/null
+end
+
+function @FUNC@_subcommand -a command
+    # Print the subcommand given to $command, or the one it defaults to.
+    set -l subcommands
+    switch $command
+@SUBCOMMANDS@    end
+    set -l i (@FUNC@_command_index)
+    set -l words (commandline -opc)
+    set -l next $words[(math $i + 1)]
+    if contains -- "$next" $subcommands
+        echo $next
+    else
+        echo $subcommands[1]
+    end
+end
+
+function @FUNC@_needs_subcommand -a command
+    set -l i (@FUNC@_command_index); or return 1
+    set -l words (commandline -opc)
+    test "$words[$i]" = "$command"; and test (count $words) -eq $i
+end
+
+function @FUNC@_using -a command subcommand
+    # Succeed if $command, with $subcommand if one is given, is being completed.
+    set -l i (@FUNC@_command_index); or return 1
+    set -l words (commandline -opc)
+    test "$words[$i]" = "$command"; or return 1
+    test -z "$subcommand"; or test (@FUNC@_subcommand $command) = "$subcommand"
+end
+
+function @FUNC@_revisions
+    # Complete ref names, paths in trees and object ids.
+    set -l words (commandline -opc)
+    set -l globals
+    set -l i (@FUNC@_command_index)
+    if set -q i[1]; and test $i -gt 2
+        set globals $words[2..(math $i - 1)]
+    end
+    @PROGRAM@ $globals __complete revisions -- (commandline -ct) 2>/dev/null
+end
+
+complete -c @PROGRAM@ -f
+@COMPLETIONS@`
+
+func (spec *Spec) expand(script string, values map[string]string) string {
+	// Fill in a script template.
+	oldnew := []string{"@PROGRAM@", spec.Program, "@FUNC@", "_" + strings.ReplaceAll(spec.Program, "-", "_")}
+	for name, value := range values {
+		oldnew = append(oldnew, "@"+name+"@", value)
+	}
+	return strings.NewReplacer(oldnew...).Replace(script)
+}
+
+func (spec *Spec) globalValueOptions(separator string) string {
+	// Join the names of the global options that take a value, which are
+	// followed by it on the command line, into a case pattern.
+	var names []string
+	for _, option := range spec.Options {
+		if option.TakesValue {
+			names = append(names, option.Names...)
+		}
+	}
+	if len(names) == 0 {
+		return "''"
+	}
+	return strings.Join(names, separator)
+}
+
+func commandKeys(command Command) []Command {
+	// Return the commands whose options are completed separately: the
+	// command itself, or one per subcommand named "<command> <subcommand>".
+	if len(command.Subcommands) == 0 {
+		return []Command{command}
+	}
+	var keys []Command
+	for _, subcommand := range command.Subcommands {
+		subcommand.Name = command.Name + " " + subcommand.Name
+		keys = append(keys, subcommand)
+	}
+	return keys
+}
+
+func subcommandNames(command Command) []string {
+	var names []string
+	for _, subcommand := range command.Subcommands {
+		names = append(names, subcommand.Name)
+	}
+	return names
+}
+
+func (spec *Spec) bash() string {
+	var options, words strings.Builder
+	var commandNames, globalOptions []string
+	for _, option := range spec.Options {
+		globalOptions = append(globalOptions, option.Names...)
+	}
+	for _, command := range spec.Commands {
+		commandNames = append(commandNames, command.Name)
+		for _, key := range commandKeys(command) {
+			var opts, values []string
+			for _, f := range key.Flags {
+				opts = append(opts, f.Names...)
+				if f.TakesValue {
+					values = append(values, f.Names...)
+				}
+			}
+			fmt.Fprintf(&options, "    %q)\n        opts=%q\n        values=%q\n        ;;\n", key.Name,
+				strings.Join(opts, " "), strings.Join(values, " "))
+		}
+		switch {
+		case len(command.Words) > 0:
+			fmt.Fprintf(&words, "    %s) args=%q ;;\n", command.Name, strings.Join(command.Words, " "))
+		case len(command.Subcommands) > 0:
+			fmt.Fprintf(&words, "    %s) subcommands=%q ;;\n", command.Name,
+				strings.Join(subcommandNames(command), " "))
+		}
+	}
+	return spec.expand(bashScript, map[string]string{
+		"OPTIONS":        options.String(),
+		"WORDS":          words.String(),
+		"GLOBAL_VALUES":  spec.globalValueOptions(" | "),
+		"GLOBAL_OPTIONS": strings.Join(globalOptions, " "),
+		"COMMANDS":       strings.Join(commandNames, " "),
+	})
+}
+
+func zshQuote(s string) string {
+	// Quote `s` for a single-quoted zsh word.
+	return strings.ReplaceAll(s, "'", `'\''`)
+}
+
+func zshSpec(f Flag, action string) []string {
+	// Describe a flag to _arguments, with one spec per name. Brackets and
+	// colons in the description would end it early.
+	description := strings.NewReplacer(`\`, `\\`, "[", `\[`, "]", `\]`, ":", `\:`).Replace(f.Description)
+	var specs []string
+	for _, name := range f.Names {
+		spec := name
+		if f.TakesValue {
+			if len(name) == 2 {
+				spec += "+"
+			} else {
+				spec += "="
+			}
+		}
+		spec += "[" + description + "]"
+		if f.TakesValue {
+			spec += ":value:" + action
+		}
+		specs = append(specs, "'"+zshQuote(spec)+"'")
+	}
+	return specs
+}
+
+func (spec *Spec) zsh() string {
+	revisions := spec.expand("@FUNC@_revisions", nil)
+	var subcommands, arguments, commands, globalOptions strings.Builder
+	for _, option := range spec.Options {
+		for _, s := range zshSpec(option, "_files") {
+			fmt.Fprintf(&globalOptions, "        %s \\\n", s)
+		}
+	}
+	for _, command := range spec.Commands {
+		description := strings.ReplaceAll(command.Description, ":", `\:`)
+		fmt.Fprintf(&commands, "            '%s'\n", zshQuote(command.Name+":"+description))
+
+		if names := subcommandNames(command); len(names) > 0 {
+			fmt.Fprintf(&subcommands, `    %[1]s)
+        local -a subcommands=(%[2]s)
+        if ((CURRENT == 2)) && [[ $PREFIX != -* ]]; then
+            compadd -- $subcommands
+            return
+        fi
+        if ((${subcommands[(Ie)$words[2]]})); then
+            key="%[1]s $words[2]"
+            shift words
+            ((CURRENT--))
+        else
+            key="%[1]s %[3]s"
+        fi
+        ;;
+`, command.Name, strings.Join(names, " "), names[0])
+		}
+
+		argument := "'*:argument:" + revisions + "'"
+		if len(command.Words) > 0 {
+			argument = "'*:argument:(" + strings.Join(command.Words, " ") + ")'"
+		}
+		for _, key := range commandKeys(command) {
+			fmt.Fprintf(&arguments, "    '%s')\n        _arguments -s -S \\\n", key.Name)
+			for _, f := range key.Flags {
+				for _, s := range zshSpec(f, revisions) {
+					fmt.Fprintf(&arguments, "            %s \\\n", s)
+				}
+			}
+			fmt.Fprintf(&arguments, "            %s\n        ;;\n", argument)
+		}
+	}
+	return spec.expand(zshScript, map[string]string{
+		"SUBCOMMANDS":    subcommands.String(),
+		"ARGUMENTS":      arguments.String(),
+		"COMMANDS":       commands.String(),
+		"GLOBAL_OPTIONS": globalOptions.String(),
+		"GLOBAL_VALUES":  spec.globalValueOptions("|"),
+	})
+}
+
+func fishQuote(s string) string {
+	// Quote `s` as a single-quoted fish word.
+	return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(s) + "'"
+}
+
+func fishFlag(f Flag) string {
+	// Give the names of a flag as options of `complete`: -s for one letter,
+	// -l for long options and -o for long options with a single dash.
+	var names []string
+	for _, name := range f.Names {
+		switch {
+		case strings.HasPrefix(name, "--"):
+			names = append(names, "-l "+name[2:])
+		case len(name) == 2:
+			names = append(names, "-s "+name[1:])
+		default:
+			names = append(names, "-o "+name[1:])
+		}
+	}
+	return strings.Join(names, " ")
+}
+
+func (spec *Spec) fish() string {
+	var subcommands, completions strings.Builder
+	complete := func(condition, args, description string) {
+		fmt.Fprintf(&completions, "complete -c %s -n %s %s", spec.Program, fishQuote(condition), args)
+		if description != "" {
+			fmt.Fprintf(&completions, " -d %s", fishQuote(description))
+		}
+		completions.WriteString("\n")
+	}
+	needsCommand := spec.expand("@FUNC@_needs_command", nil)
+	revisions := fishQuote(spec.expand("(@FUNC@_revisions)", nil))
+
+	for _, option := range spec.Options {
+		args := fishFlag(option)
+		if option.TakesValue {
+			args += " -r -F"
+		}
+		complete(needsCommand, args, option.Description)
+	}
+	for _, command := range spec.Commands {
+		complete(needsCommand, "-a "+command.Name, command.Description)
+		if names := subcommandNames(command); len(names) > 0 {
+			fmt.Fprintf(&subcommands, "        case %s\n            set subcommands %s\n", command.Name,
+				strings.Join(names, " "))
+			complete(spec.expand("@FUNC@_needs_subcommand ", nil)+command.Name, "-a "+fishQuote(strings.Join(names, " ")), "")
+		}
+		for _, key := range commandKeys(command) {
+			using := spec.expand("@FUNC@_using ", nil) + key.Name
+			if len(command.Words) > 0 {
+				complete(using, "-a "+fishQuote(strings.Join(command.Words, " ")), "")
+			} else {
+				complete(using, "-F -a "+revisions, "")
+			}
+			for _, f := range key.Flags {
+				args := fishFlag(f)
+				if f.TakesValue {
+					args += " -r -F -a " + revisions
+				}
+				complete(using, args, f.Description)
+			}
+		}
+	}
+	return spec.expand(fishScript, map[string]string{
+		"SUBCOMMANDS":   subcommands.String(),
+		"COMPLETIONS":   completions.String(),
+		"GLOBAL_VALUES": spec.globalValueOptions(" "),
+	})
+}
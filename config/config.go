@@ -0,0 +1,581 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tsoud/GoTGit.git/gitobj"
+)
+
+// Scope is where a config entry comes from. Scopes are read from the system
+// config to the command line, so the later ones take precedence.
+type Scope int
+
+const (
+	ScopeSystem Scope = iota + 1
+	ScopeGlobal
+	ScopeLocal
+	ScopeWorktree
+	ScopeCommand
+)
+
+func (scope Scope) String() string {
+	switch scope {
+	case ScopeSystem:
+		return "system"
+	case ScopeGlobal:
+		return "global"
+	case ScopeLocal:
+		return "local"
+	case ScopeWorktree:
+		return "worktree"
+	case ScopeCommand:
+		return "command"
+	}
+	return "unknown"
+}
+
+// Entry is a single key set in a config file or on the command line. Keys
+// are canonical: the section and name are lowercase but a subsection keeps
+// its case, as in "branch.Topic.remote". A key written without "=" has
+// NoValue set, which reads as true for booleans.
+type Entry struct {
+	Key     string
+	Value   string
+	NoValue bool
+	// File is the file the entry was read from, or empty if it was given on
+	// the command line.
+	File  string
+	Scope Scope
+}
+
+func (e Entry) Origin() string {
+	// Describe where the entry was set, as `git config --show-origin` does.
+	if e.File == "" {
+		return "command line:"
+	}
+	return "file:" + e.File
+}
+
+var (
+	// ErrKeyNotFound is returned when unsetting a key that isn't set.
+	ErrKeyNotFound = errors.New("key not found")
+	// ErrNoSection is returned when renaming or removing a missing section.
+	ErrNoSection = errors.New("no such section")
+)
+
+// MultipleValuesError is returned when a change meant for a single value of
+// a key would affect several.
+type MultipleValuesError struct {
+	Key string
+}
+
+func (err *MultipleValuesError) Error() string {
+	return fmt.Sprintf("%s has multiple values", err.Key)
+}
+
+type Config struct {
+	// Path is the file changed by Set, Unset and the other edits: the
+	// repository's own config unless the config was loaded from another scope
+	// or file.
+	Path    string
+	entries []Entry
+	load    func() ([]Entry, error)
+}
+
+func gitDirPath() string {
+	return gitobj.GitDir
+}
+
+func LocalPath() string {
+	return path.Join(gitDirPath(), "config")
+}
+
+func WorktreePath() string {
+	return path.Join(gitDirPath(), "config.worktree")
+}
+
+func SystemPath() string {
+	// Return the system-wide config file, or "" if GIT_CONFIG_NOSYSTEM says to
+	// skip it.
+	if noSystem, err := ParseBool(os.Getenv("GIT_CONFIG_NOSYSTEM")); err == nil && noSystem {
+		return ""
+	}
+	if file, ok := os.LookupEnv("GIT_CONFIG_SYSTEM"); ok {
+		return file
+	}
+	return "/etc/gitconfig"
+}
+
+func GlobalPath() string {
+	// Return the user's config file: GIT_CONFIG_GLOBAL if set, otherwise
+	// ~/.gitconfig, unless only the XDG file ($XDG_CONFIG_HOME/git/config)
+	// exists.
+	if file, ok := os.LookupEnv("GIT_CONFIG_GLOBAL"); ok {
+		return file
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	file := path.Join(home, ".gitconfig")
+	if _, err := os.Stat(file); err != nil {
+		if xdg := xdgPath(); xdg != "" {
+			if _, err := os.Stat(xdg); err == nil {
+				return xdg
+			}
+		}
+	}
+	return file
+}
+
+func xdgPath() string {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return path.Join(dir, "git", "config")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return path.Join(home, ".config", "git", "config")
+}
+
+func globalPaths() []string {
+	// Both global files are read, the XDG one first.
+	if file, ok := os.LookupEnv("GIT_CONFIG_GLOBAL"); ok {
+		return []string{file}
+	}
+	var files []string
+	if xdg := xdgPath(); xdg != "" {
+		files = append(files, xdg)
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		files = append(files, path.Join(home, ".gitconfig"))
+	}
+	return files
+}
+
+func Load() (*Config, error) {
+	// Read the config of every scope, from the system config to the command
+	// line, so that the more specific settings take precedence.
+	cfg := &Config{Path: LocalPath()}
+	cfg.load = func() ([]Entry, error) {
+		var entries []Entry
+		for _, scope := range []Scope{ScopeSystem, ScopeGlobal, ScopeLocal, ScopeWorktree, ScopeCommand} {
+			scoped, err := loadScope(scope)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, scoped...)
+		}
+		return entries, nil
+	}
+	return cfg, cfg.reload()
+}
+
+func LoadScope(scope Scope) (*Config, error) {
+	// Read the config of a single scope. Its Path is the file of that scope;
+	// the worktree scope falls back to the local config unless
+	// `extensions.worktreeConfig` is enabled. Of the global files, only the
+	// one changes go to is read.
+	cfg := &Config{load: func() ([]Entry, error) { return loadScope(scope) }}
+	switch scope {
+	case ScopeSystem:
+		cfg.Path = SystemPath()
+	case ScopeGlobal:
+		cfg.Path = GlobalPath()
+		cfg.load = func() ([]Entry, error) { return loadFile(cfg.Path, scope, 0) }
+	case ScopeLocal:
+		cfg.Path = LocalPath()
+	case ScopeWorktree:
+		cfg.Path = LocalPath()
+		if enabled, err := worktreeConfigEnabled(); err != nil {
+			return nil, err
+		} else if enabled {
+			cfg.Path = WorktreePath()
+		}
+	}
+	return cfg, cfg.reload()
+}
+
+func LoadFile(file string) (*Config, error) {
+	// Read a single config file, as with `git config --file`.
+	cfg := &Config{Path: file}
+	cfg.load = func() ([]Entry, error) { return loadFile(file, ScopeCommand, 0) }
+	return cfg, cfg.reload()
+}
+
+func (cfg *Config) reload() error {
+	entries, err := cfg.load()
+	if err != nil {
+		return err
+	}
+	cfg.entries = entries
+	return nil
+}
+
+func loadScope(scope Scope) ([]Entry, error) {
+	var files []string
+	switch scope {
+	case ScopeSystem:
+		if file := SystemPath(); file != "" {
+			files = append(files, file)
+		}
+	case ScopeGlobal:
+		files = globalPaths()
+	case ScopeLocal:
+		files = append(files, LocalPath())
+	case ScopeWorktree:
+		enabled, err := worktreeConfigEnabled()
+		if err != nil {
+			return nil, err
+		}
+		if enabled {
+			files = append(files, WorktreePath())
+		}
+	case ScopeCommand:
+		return commandEntries()
+	}
+
+	var entries []Entry
+	for _, file := range files {
+		fileEntries, err := loadFile(file, scope, 0)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, fileEntries...)
+	}
+	return entries, nil
+}
+
+func worktreeConfigEnabled() (bool, error) {
+	entries, err := loadFile(LocalPath(), ScopeLocal, 0)
+	if err != nil {
+		return false, err
+	}
+	enabled := false
+	for _, e := range entries {
+		if e.Key == "extensions.worktreeconfig" {
+			enabled = e.NoValue
+			if value, err := ParseBool(e.Value); err == nil && !e.NoValue {
+				enabled = value
+			}
+		}
+	}
+	return enabled, nil
+}
+
+func commandEntries() ([]Entry, error) {
+	// Read the entries given in the environment: those of `-c` options passed
+	// down in GIT_CONFIG_PARAMETERS, then GIT_CONFIG_KEY_<n>/GIT_CONFIG_VALUE_<n>
+	// for each n below GIT_CONFIG_COUNT.
+	entries, err := parseParameters(os.Getenv("GIT_CONFIG_PARAMETERS"))
+	if err != nil {
+		return nil, err
+	}
+	countVar := os.Getenv("GIT_CONFIG_COUNT")
+	if countVar == "" {
+		return entries, nil
+	}
+	count, err := strconv.Atoi(countVar)
+	if err != nil || count < 0 {
+		return nil, &ParseError{Reason: "bogus count in GIT_CONFIG_COUNT"}
+	}
+	for i := 0; i < count; i++ {
+		key, ok := os.LookupEnv(fmt.Sprintf("GIT_CONFIG_KEY_%d", i))
+		if !ok || key == "" {
+			return nil, &ParseError{Reason: fmt.Sprintf("missing config key GIT_CONFIG_KEY_%d", i)}
+		}
+		value, ok := os.LookupEnv(fmt.Sprintf("GIT_CONFIG_VALUE_%d", i))
+		if !ok {
+			return nil, &ParseError{Reason: fmt.Sprintf("missing config value GIT_CONFIG_VALUE_%d", i)}
+		}
+		if key, err = CanonicalKey(key); err != nil {
+			return nil, &ParseError{Reason: err.Error()}
+		}
+		entries = append(entries, Entry{Key: key, Value: value, Scope: ScopeCommand})
+	}
+	return entries, nil
+}
+
+func parseParameters(params string) ([]Entry, error) {
+	// Parse GIT_CONFIG_PARAMETERS, a list of shell-quoted "'key'='value'" or
+	// "'key=value'" words; a key without a value has NoValue set.
+	var entries []Entry
+	for i := 0; i < len(params); {
+		if params[i] == ' ' {
+			i++
+			continue
+		}
+		var key, value strings.Builder
+		current, hasValue := &key, false
+		for ; i < len(params) && params[i] != ' '; i++ {
+			switch params[i] {
+			case '\'':
+				end := strings.IndexByte(params[i+1:], '\'')
+				if end == -1 {
+					return nil, &ParseError{Reason: "bogus format in GIT_CONFIG_PARAMETERS"}
+				}
+				current.WriteString(params[i+1 : i+1+end])
+				i += end + 1
+			case '\\':
+				if i+1 < len(params) {
+					i++
+					current.WriteByte(params[i])
+				}
+			case '=':
+				if hasValue {
+					current.WriteByte('=')
+				}
+				current, hasValue = &value, true
+			default:
+				current.WriteByte(params[i])
+			}
+		}
+		name, val := key.String(), value.String()
+		if !hasValue {
+			name, val, hasValue = strings.Cut(name, "=")
+		}
+		canonical, err := CanonicalKey(name)
+		if err != nil {
+			return nil, &ParseError{Reason: err.Error()}
+		}
+		entries = append(entries, Entry{Key: canonical, Value: val, NoValue: !hasValue, Scope: ScopeCommand})
+	}
+	return entries, nil
+}
+
+func CanonicalKey(key string) (string, error) {
+	// Check that `key` is a valid "section[.subsection].name" and return it
+	// with the section and name lowercased.
+	first, last := strings.IndexByte(key, '.'), strings.LastIndexByte(key, '.')
+	if first <= 0 || last == len(key)-1 {
+		return "", fmt.Errorf("key does not contain a section: %s", key)
+	}
+	section, name := key[:first], key[last+1:]
+	valid := name[0] >= 'a' && name[0] <= 'z' || name[0] >= 'A' && name[0] <= 'Z'
+	for i := 0; i < len(section); i++ {
+		valid = valid && isNameChar(section[i])
+	}
+	for i := 0; i < len(name); i++ {
+		valid = valid && isNameChar(name[i])
+	}
+	if !valid || strings.ContainsRune(key[first:last+1], '\n') {
+		return "", fmt.Errorf("invalid key: %s", key)
+	}
+	return strings.ToLower(section) + key[first:last+1] + strings.ToLower(name), nil
+}
+
+func splitKey(key string) (section, name string, err error) {
+	// Split "section.sub.name" into "section.sub" and "name", normalizing case.
+	key, err = CanonicalKey(key)
+	if err != nil {
+		return "", "", err
+	}
+	dot := strings.LastIndexByte(key, '.')
+	return key[:dot], key[dot+1:], nil
+}
+
+func normalizeSection(section string) string {
+	name, sub, hasSub := strings.Cut(section, ".")
+	if hasSub {
+		return strings.ToLower(name) + "." + sub
+	}
+	return strings.ToLower(section)
+}
+
+func normalizeKey(key string) string {
+	canonical, err := CanonicalKey(key)
+	if err != nil {
+		return key
+	}
+	return canonical
+}
+
+func ParseBool(value string) (bool, error) {
+	// Parse a boolean as git does: true/yes/on and false/no/off in any case,
+	// the empty string as false, or an integer that is true if it isn't zero.
+	switch strings.ToLower(value) {
+	case "true", "yes", "on":
+		return true, nil
+	case "false", "no", "off", "":
+		return false, nil
+	}
+	n, err := ParseInt(value)
+	if err != nil {
+		return false, errors.New("invalid boolean")
+	}
+	return n != 0, nil
+}
+
+func ParseInt(value string) (int64, error) {
+	// Parse an integer that may have a "k", "m" or "g" suffix, scaling it by
+	// 1024 each.
+	digits := strings.TrimRight(value, "kKmMgG")
+	scale := int64(1)
+	switch strings.ToLower(value[len(digits):]) {
+	case "":
+	case "k":
+		scale = 1 << 10
+	case "m":
+		scale = 1 << 20
+	case "g":
+		scale = 1 << 30
+	default:
+		return 0, errors.New("invalid unit")
+	}
+	n, err := strconv.ParseInt(digits, 0, 64)
+	if err != nil {
+		if errors.Is(err, strconv.ErrRange) {
+			return 0, errors.New("out of range")
+		}
+		return 0, errors.New("invalid unit")
+	}
+	if n > 0 && n > (1<<63-1)/scale || n < 0 && n < -(1<<63)/scale {
+		return 0, errors.New("out of range")
+	}
+	return n * scale, nil
+}
+
+func ExpandPath(value string) (string, error) {
+	// Expand a leading "~/" to the user's home directory, or "~user/" to that
+	// user's.
+	if !strings.HasPrefix(value, "~") {
+		return value, nil
+	}
+	name, rest, _ := strings.Cut(value[1:], "/")
+	var home string
+	if name == "" {
+		dir, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("could not expand %s: %w", value, err)
+		}
+		home = dir
+	} else {
+		u, err := user.Lookup(name)
+		if err != nil {
+			return "", fmt.Errorf("could not expand user dir in: '%s'", value)
+		}
+		home = u.HomeDir
+	}
+	if rest == "" && !strings.HasSuffix(value, "/") {
+		return home, nil
+	}
+	return filepath.ToSlash(home) + "/" + rest, nil
+}
+
+func (cfg *Config) Entries() []Entry {
+	// Return every entry in the order read, from the least specific scope.
+	return cfg.entries
+}
+
+func (cfg *Config) Get(key string) (string, bool) {
+	// Return the last value set for `key`.
+	key = normalizeKey(key)
+	for i := len(cfg.entries) - 1; i >= 0; i-- {
+		if cfg.entries[i].Key == key {
+			return cfg.entries[i].Value, true
+		}
+	}
+	return "", false
+}
+
+func (cfg *Config) GetAll(key string) []string {
+	// Return every value set for a multi-valued key such as `remote.origin.fetch`.
+	key = normalizeKey(key)
+	var values []string
+	for _, e := range cfg.entries {
+		if e.Key == key {
+			values = append(values, e.Value)
+		}
+	}
+	return values
+}
+
+func (cfg *Config) GetBool(key string, defaultVal bool) bool {
+	key = normalizeKey(key)
+	for i := len(cfg.entries) - 1; i >= 0; i-- {
+		if e := cfg.entries[i]; e.Key == key {
+			if e.NoValue {
+				return true
+			}
+			value, err := ParseBool(e.Value)
+			if err != nil {
+				return defaultVal
+			}
+			return value
+		}
+	}
+	return defaultVal
+}
+
+func (cfg *Config) GetInt(key string, defaultVal int) int {
+	// Values may have a "k", "m" or "g" suffix, scaling them by 1024 each.
+	value, ok := cfg.Get(key)
+	if !ok {
+		return defaultVal
+	}
+	n, err := ParseInt(value)
+	if err != nil {
+		return defaultVal
+	}
+	return int(n)
+}
+
+func (cfg *Config) Sections(prefix string) []string {
+	// List the distinct sections (e.g. "branch.main") whose names start with `prefix`.
+	seen := make(map[string]bool)
+	var sections []string
+	for _, e := range cfg.entries {
+		section := e.Key[:strings.LastIndexByte(e.Key, '.')]
+		if strings.HasPrefix(section, prefix) && !seen[section] {
+			seen[section] = true
+			sections = append(sections, section)
+		}
+	}
+	return sections
+}
+
+func (cfg *Config) Identity(role string) (string, string) {
+	// Look up the name and email for "author" or "committer", preferring the
+	// GIT_AUTHOR_*/GIT_COMMITTER_* environment variables over `user.name`/`user.email`.
+	role = strings.ToUpper(role)
+	name, email := os.Getenv("GIT_"+role+"_NAME"), os.Getenv("GIT_"+role+"_EMAIL")
+	if name == "" {
+		name, _ = cfg.Get("user.name")
+	}
+	if email == "" {
+		email, _ = cfg.Get("user.email")
+	}
+	if name == "" || email == "" {
+		user := os.Getenv("USER")
+		host, _ := os.Hostname()
+		if name == "" {
+			name = user
+		}
+		if email == "" {
+			email = user + "@" + host
+		}
+	}
+	return name, email
+}
+
+func (cfg *Config) Signature(role string) gitobj.Signature {
+	// Build the signature for "author" or "committer" at the current time, or at
+	// GIT_AUTHOR_DATE/GIT_COMMITTER_DATE if set (as "<unix time> <+hhmm>").
+	sig := gitobj.Signature{When: time.Now()}
+	sig.Name, sig.Email = cfg.Identity(role)
+	if date := os.Getenv("GIT_" + strings.ToUpper(role) + "_DATE"); date != "" {
+		if parsed, err := gitobj.ParseSignature("<> " + strings.TrimPrefix(date, "@")); err == nil {
+			sig.When = parsed.When
+		}
+	}
+	return sig
+}
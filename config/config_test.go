@@ -0,0 +1,261 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/tsoud/GoTGit.git/gitobj"
+	"github.com/tsoud/GoTGit.git/internal/testutil"
+)
+
+func initRepo(t *testing.T, local string) {
+	// Run the test from a scratch repository whose config is `local`, with no
+	// system or global config.
+	t.Helper()
+	testutil.InitRepo(t)
+	testutil.IsolateConfig(t)
+	writeTestFile(t, LocalPath(), local)
+}
+
+func writeTestFile(t *testing.T, file, contents string) {
+	t.Helper()
+	if err := os.WriteFile(file, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParse(t *testing.T) {
+	initRepo(t, "[core]\n"+
+		"\tbare = false\n"+
+		"[Sec]\n"+
+		"\tv = one\n"+
+		"\tV = two ; comment\n"+
+		"\tflag\n"+
+		"\tq = \"quoted # x\"  # comment\n"+
+		"\tesc = a\\tb\\\\c\\\"d\n"+
+		"\tcont = one \\\n"+
+		" two\n"+
+		"[sec \"Sub\"] k = inline\n"+
+		"[a.B]\n"+
+		"\tk = old\n")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]string{
+		"core.bare":   "false",
+		"sec.v":       "two",
+		"SEC.V":       "two",
+		"sec.q":       "quoted # x",
+		"sec.esc":     "a\tb\\c\"d",
+		"sec.cont":    "one  two",
+		"sec.Sub.k":   "inline",
+		"a.b.k":       "old",
+		"sec.flag":    "",
+		"sec.missing": "",
+	} {
+		if got, _ := cfg.Get(key); got != want {
+			t.Errorf("Wanted %s = %q, got %q", key, want, got)
+		}
+	}
+	if _, ok := cfg.Get("sec.sub.k"); ok {
+		t.Error("Subsections should be case-sensitive")
+	}
+	if got := cfg.GetAll("sec.v"); !reflect.DeepEqual(got, []string{"one", "two"}) {
+		t.Errorf("Wanted both values of sec.v, got %q", got)
+	}
+	if !cfg.GetBool("sec.flag", false) {
+		t.Error("A key without a value should be true")
+	}
+
+	for bad, line := range map[string]int{
+		"key = outside\n":       1,
+		"[sec\n":                1,
+		"[sec]\n\tk = \"open\n": 2,
+		"[sec]\n\t1k = v\n":     2,
+		"[sec]\n\tk = bad\\q\n": 2,
+	} {
+		writeTestFile(t, LocalPath(), bad)
+		var parseErr *ParseError
+		if _, err := Load(); !errors.As(err, &parseErr) || parseErr.Line != line {
+			t.Errorf("Wanted a parse error on line %d of %q, got %v", line, bad, err)
+		}
+	}
+}
+
+func TestScopes(t *testing.T) {
+	initRepo(t, "[user]\n\tname = Local\n[include]\n\tpath = ../included\n"+
+		"[includeIf \"onbranch:ma*\"]\n\tpath = ../branch\n[includeIf \"onbranch:other\"]\n\tpath = ../other\n")
+	writeTestFile(t, os.Getenv("GIT_CONFIG_GLOBAL"), "[user]\n\tname = Global\n\temail = g@example.com\n")
+	writeTestFile(t, "included", "[inc]\n\tk = included\n")
+	writeTestFile(t, "branch", "[inc]\n\tbranch = yes\n")
+	writeTestFile(t, "other", "[inc]\n\tother = yes\n")
+	t.Setenv("GIT_CONFIG_COUNT", "1")
+	t.Setenv("GIT_CONFIG_KEY_0", "Core.Editor")
+	t.Setenv("GIT_CONFIG_VALUE_0", "vi")
+	t.Setenv("GIT_CONFIG_PARAMETERS", "'a.b'='it'\\''s' 'c.d'")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, e := range cfg.Entries() {
+		got = append(got, e.Scope.String()+" "+e.Origin()+" "+e.Key+"="+e.Value)
+	}
+	global := os.Getenv("GIT_CONFIG_GLOBAL")
+	want := []string{
+		"global file:" + global + " user.name=Global",
+		"global file:" + global + " user.email=g@example.com",
+		"local file:" + LocalPath() + " user.name=Local",
+		"local file:" + LocalPath() + " include.path=../included",
+		"local file:" + gitobj.GitDir + "/../included inc.k=included",
+		"local file:" + LocalPath() + " includeif.onbranch:ma*.path=../branch",
+		"local file:" + gitobj.GitDir + "/../branch inc.branch=yes",
+		"local file:" + LocalPath() + " includeif.onbranch:other.path=../other",
+		"command command line: a.b=it's",
+		"command command line: c.d=",
+		"command command line: core.editor=vi",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Wanted entries\n%q\ngot\n%q", want, got)
+	}
+	if name, email := cfg.Identity("author"); name != "Local" || email != "g@example.com" {
+		t.Errorf("Wanted the local name and global email, got %s <%s>", name, email)
+	}
+
+	globalCfg, err := LoadScope(ScopeGlobal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if globalCfg.Path != global || len(globalCfg.Entries()) != 2 {
+		t.Errorf("Wanted only the global config, got %+v", globalCfg.Entries())
+	}
+
+	t.Setenv("GIT_CONFIG_COUNT", "2")
+	var parseErr *ParseError
+	if _, err := Load(); !errors.As(err, &parseErr) {
+		t.Errorf("Wanted an error for a missing GIT_CONFIG_KEY_1, got %v", err)
+	}
+}
+
+func TestEdit(t *testing.T) {
+	initRepo(t, "[core]\n"+
+		"\tbare = false\n"+
+		"# keep this\n"+
+		"[sec]\n"+
+		"\tv = one\n"+
+		"\tv = two\n"+
+		"[sec \"Sub\"] k = inline\n"+
+		"[gone]\n"+
+		"\tk = v\n")
+	cfg, err := LoadScope(ScopeLocal)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var multiple *MultipleValuesError
+	if err := cfg.Set("sec.v", "x"); !errors.As(err, &multiple) {
+		t.Errorf("Wanted an error setting a multi-valued key, got %v", err)
+	}
+	if err := cfg.Replace("sec.v", "three", func(v string) bool { return v == "two" }, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.Add("sec.v", "with # hash"); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.Set("sec.Sub.k", "replaced"); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.Set("New.Sub.someKey", " padded\n"); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.Unset("gone.k"); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.UnsetMatching("sec.v", nil, false); !errors.As(err, &multiple) {
+		t.Errorf("Wanted an error unsetting a multi-valued key, got %v", err)
+	}
+	if err := cfg.UnsetMatching("sec.none", nil, false); err != ErrKeyNotFound {
+		t.Errorf("Wanted ErrKeyNotFound, got %v", err)
+	}
+	if err := cfg.RenameSection("sec.Sub", "renamed.sub"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "[core]\n" +
+		"\tbare = false\n" +
+		"# keep this\n" +
+		"[sec]\n" +
+		"\tv = one\n" +
+		"\tv = three\n" +
+		"\tv = \"with # hash\"\n" +
+		"[renamed \"sub\"]\n" +
+		"\tk = replaced\n" +
+		"[New \"Sub\"]\n" +
+		"\tsomeKey = \" padded\\n\"\n"
+	if got := testutil.ReadFile(t, LocalPath()); got != want {
+		t.Errorf("Wanted config\n%s\ngot\n%s", want, got)
+	}
+	if got := cfg.GetAll("sec.v"); !reflect.DeepEqual(got, []string{"one", "three", "with # hash"}) {
+		t.Errorf("The config wasn't re-read after editing it, got %q", got)
+	}
+	if value, _ := cfg.Get("new.Sub.somekey"); value != " padded\n" {
+		t.Errorf("Wanted the value to survive quoting, got %q", value)
+	}
+
+	if err := cfg.UnsetMatching("sec.v", nil, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.RemoveSection("renamed.sub"); err != nil {
+		t.Fatal(err)
+	}
+	want = "[core]\n\tbare = false\n# keep this\n[New \"Sub\"]\n\tsomeKey = \" padded\\n\"\n"
+	if got := testutil.ReadFile(t, LocalPath()); got != want {
+		t.Errorf("Wanted config\n%s\ngot\n%s", want, got)
+	}
+
+	writeTestFile(t, LocalPath()+".lock", "")
+	if err := cfg.Set("core.bare", "true"); err == nil {
+		t.Error("Wanted an error while the config is locked")
+	}
+}
+
+func TestParseTypes(t *testing.T) {
+	for value, want := range map[string]int64{"10": 10, "1k": 1024, "2M": 2 << 20, "1g": 1 << 30, "-3": -3} {
+		if got, err := ParseInt(value); err != nil || got != want {
+			t.Errorf("Wanted %s to be %d, got %d (%v)", value, want, got, err)
+		}
+	}
+	for _, value := range []string{"abc", "1x", "", "1kk"} {
+		if _, err := ParseInt(value); err == nil {
+			t.Errorf("Wanted an error for %q", value)
+		}
+	}
+	for value, want := range map[string]bool{"yes": true, "On": true, "1": true, "false": false, "": false, "0": false} {
+		if got, err := ParseBool(value); err != nil || got != want {
+			t.Errorf("Wanted %q to be %t, got %t (%v)", value, want, got, err)
+		}
+	}
+	if _, err := ParseBool("maybe"); err == nil {
+		t.Error("Wanted an error for a bad boolean")
+	}
+
+	home, _ := os.UserHomeDir()
+	if got, _ := ExpandPath("~/x"); got != home+"/x" {
+		t.Errorf("Wanted ~/x to expand to %s/x, got %s", home, got)
+	}
+	for key, want := range map[string]string{"Core.Bare": "core.bare", "Branch.Topic.Remote": "branch.Topic.remote"} {
+		if got, err := CanonicalKey(key); err != nil || got != want {
+			t.Errorf("Wanted %s to be %s, got %s (%v)", key, want, got, err)
+		}
+	}
+	for _, key := range []string{"bare", "a.1b", "a_b.c", "a.b."} {
+		if _, err := CanonicalKey(key); err == nil {
+			t.Errorf("Wanted %s to be invalid", key)
+		}
+	}
+}
@@ -0,0 +1,342 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/tsoud/GoTGit.git/gitobj"
+)
+
+// configFile is the parsed contents of the file a Config edits.
+type configFile struct {
+	lines []string
+	*parsedFile
+}
+
+func (cfg *Config) readFile() (*configFile, error) {
+	// Read the file edits apply to, without following its includes.
+	lines, err := readLines(cfg.Path)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := parseLines(lines, cfg.Path, ScopeLocal)
+	if err != nil {
+		return nil, err
+	}
+	return &configFile{lines: lines, parsedFile: parsed}, nil
+}
+
+func (cfg *Config) save(lines []string) error {
+	// Write the new contents through a lock file, so concurrent writers can't
+	// interleave, and re-read the config.
+	contents := strings.Join(lines, "\n")
+	if len(lines) > 0 {
+		contents += "\n"
+	}
+	if dir := filepath.Dir(cfg.Path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("could not write config file %s: %w", cfg.Path, err)
+		}
+	}
+	lockPath := cfg.Path + ".lock"
+	lock, err := os.OpenFile(lockPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		if os.IsExist(err) {
+			return fmt.Errorf("could not lock config file %s: File exists", cfg.Path)
+		}
+		return fmt.Errorf("could not lock config file %s: %w", cfg.Path, err)
+	}
+	_, err = lock.WriteString(contents)
+	if closeErr := lock.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && cfg.Path == LocalPath() {
+		err = gitobj.AdjustSharedPerm(lockPath)
+	}
+	if err == nil {
+		err = os.Rename(lockPath, cfg.Path)
+	}
+	if err != nil {
+		os.Remove(lockPath)
+		return fmt.Errorf("could not write config file %s: %w", cfg.Path, err)
+	}
+	return cfg.reload()
+}
+
+func formatSectionHeader(section string) string {
+	name, sub, hasSub := strings.Cut(section, ".")
+	if !hasSub {
+		return fmt.Sprintf("[%s]", name)
+	}
+	sub = strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(sub)
+	return fmt.Sprintf("[%s \"%s\"]", name, sub)
+}
+
+func formatValue(value string) string {
+	escaped := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\t", `\t`, "\b", `\b`).Replace(value)
+	if value != strings.TrimSpace(value) || strings.ContainsAny(value, "#;") {
+		return `"` + escaped + `"`
+	}
+	return escaped
+}
+
+func formatEntry(key, value string) (string, string) {
+	// Format the line setting a valid key, and the section it goes in should
+	// it need adding, keeping the spelling of the key as given.
+	dot := strings.LastIndexByte(key, '.')
+	return key[:dot], fmt.Sprintf("\t%s = %s", key[dot+1:], formatValue(value))
+}
+
+func (file *configFile) matching(key string, match func(string) bool) []fileEntry {
+	var matches []fileEntry
+	for _, e := range file.entries {
+		if e.Key == key && (match == nil || match(e.Value)) {
+			matches = append(matches, e)
+		}
+	}
+	return matches
+}
+
+func (file *configFile) insert(section, header, line string) []string {
+	// Add a line at the end of the last occurrence of `section`, or in a new
+	// section at the end of the file with the given header.
+	at := -1
+	for i, header := range file.headers {
+		if header.section == section {
+			at = header.line + 1
+			for _, e := range file.entries {
+				if e.header == i {
+					at = e.endLine + 1
+				}
+			}
+		}
+	}
+	lines := append([]string{}, file.lines...)
+	if at == -1 {
+		return append(lines, formatSectionHeader(header), line)
+	}
+	return append(lines[:at], append([]string{line}, file.lines[at:]...)...)
+}
+
+func (file *configFile) rewrite(removed []fileEntry, replaced *fileEntry, newLine string) []string {
+	// Remove entries, along with the headers of the sections they leave empty,
+	// and put `newLine` in place of the `replaced` entry if there is one.
+	deleted := make([]bool, len(file.lines))
+	emptied := make(map[int]bool)
+	lines := append([]string{}, file.lines...)
+	after := make(map[int]string)
+	drop := func(e fileEntry) {
+		first := e.line
+		if e.inline {
+			lines[e.line] = file.lines[e.line][:file.headers[e.header].end]
+			first++
+		}
+		for i := first; i <= e.endLine; i++ {
+			deleted[i] = true
+		}
+	}
+	for _, e := range removed {
+		drop(e)
+		emptied[e.header] = true
+	}
+	if replaced != nil {
+		drop(*replaced)
+		if replaced.inline {
+			after[replaced.line] = newLine
+		} else {
+			lines[replaced.line], deleted[replaced.line] = newLine, false
+		}
+	}
+
+	for i, header := range file.headers {
+		end := len(lines)
+		if i+1 < len(file.headers) {
+			end = file.headers[i+1].line
+		}
+		empty := emptied[i] && strings.TrimSpace(lines[header.line][header.end:]) == ""
+		for j := header.line + 1; j < end && empty; j++ {
+			empty = deleted[j] || strings.TrimSpace(lines[j]) == ""
+		}
+		if empty {
+			for j := header.line; j < end; j++ {
+				deleted[j] = true
+			}
+		}
+	}
+
+	var kept []string
+	for i, line := range lines {
+		if !deleted[i] {
+			kept = append(kept, line)
+		}
+		if extra, ok := after[i]; ok {
+			kept = append(kept, extra)
+		}
+	}
+	return kept
+}
+
+func (cfg *Config) Replace(key, value string, match func(string) bool, all bool) error {
+	// Set `key` to `value`, replacing the values for which `match` holds (all
+	// of them if it is nil). Unless `all` is set, it is an error for more than
+	// one value to match.
+	section, name, err := splitKey(key)
+	if err != nil {
+		return err
+	}
+	file, err := cfg.readFile()
+	if err != nil {
+		return err
+	}
+	header, newLine := formatEntry(key, value)
+	matches := file.matching(section+"."+name, match)
+	if len(matches) == 0 {
+		return cfg.save(file.insert(section, header, newLine))
+	}
+	if len(matches) > 1 && !all {
+		return &MultipleValuesError{Key: section + "." + name}
+	}
+	// The new value takes the place of the last one replaced.
+	last := matches[len(matches)-1]
+	return cfg.save(file.rewrite(matches[:len(matches)-1], &last, newLine))
+}
+
+func (cfg *Config) Set(key, value string) error {
+	// Set `key` in the config file, replacing an existing value.
+	return cfg.Replace(key, value, nil, false)
+}
+
+func (cfg *Config) Add(key, value string) error {
+	// Add a value for `key`, keeping the ones it already has.
+	section, _, err := splitKey(key)
+	if err != nil {
+		return err
+	}
+	file, err := cfg.readFile()
+	if err != nil {
+		return err
+	}
+	header, line := formatEntry(key, value)
+	return cfg.save(file.insert(section, header, line))
+}
+
+func (cfg *Config) UnsetMatching(key string, match func(string) bool, all bool) error {
+	// Remove the values of `key` for which `match` holds (all of them if it is
+	// nil), dropping sections that become empty. Unless `all` is set, it is an
+	// error for more than one value to match.
+	section, name, err := splitKey(key)
+	if err != nil {
+		return err
+	}
+	file, err := cfg.readFile()
+	if err != nil {
+		return err
+	}
+	matches := file.matching(section+"."+name, match)
+	if len(matches) == 0 {
+		return ErrKeyNotFound
+	}
+	if len(matches) > 1 && !all {
+		return &MultipleValuesError{Key: section + "." + name}
+	}
+	return cfg.save(file.rewrite(matches, nil, ""))
+}
+
+func (cfg *Config) Unset(key string) error {
+	// Remove `key` from the config file, dropping its section if it becomes
+	// empty. Unsetting a key that isn't set does nothing.
+	if err := cfg.UnsetMatching(key, nil, true); err != ErrKeyNotFound {
+		return err
+	}
+	return nil
+}
+
+func (cfg *Config) renameSection(oldSection, newSection string) error {
+	// Rename every occurrence of a section, or remove it if `newSection` is
+	// empty. Returns ErrNoSection if it doesn't occur in the file.
+	oldSection = normalizeSection(oldSection)
+	file, err := cfg.readFile()
+	if err != nil {
+		return err
+	}
+	found := false
+	lines := append([]string{}, file.lines...)
+	deleted := make([]bool, len(lines))
+	for i, header := range file.headers {
+		if header.section != oldSection {
+			continue
+		}
+		found = true
+		if newSection != "" {
+			lines[header.line] = formatSectionHeader(newSection) + file.lines[header.line][header.end:]
+			continue
+		}
+		end := len(lines)
+		if i+1 < len(file.headers) {
+			end = file.headers[i+1].line
+		}
+		for j := header.line; j < end; j++ {
+			deleted[j] = true
+		}
+	}
+	if !found {
+		return ErrNoSection
+	}
+	var kept []string
+	for i, line := range lines {
+		if !deleted[i] {
+			kept = append(kept, line)
+		}
+	}
+	return cfg.save(kept)
+}
+
+func ValidSection(section string) bool {
+	// Check a section name such as "branch.topic" given to RenameSection.
+	name, _, _ := strings.Cut(section, ".")
+	if name == "" {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		if !isNameChar(name[i]) {
+			return false
+		}
+	}
+	return !strings.ContainsRune(section, '\n')
+}
+
+func (cfg *Config) RenameSection(oldSection, newSection string) error {
+	// Rename a section such as `branch.old` in the config file.
+	if !ValidSection(newSection) {
+		return fmt.Errorf("invalid section name: %s", newSection)
+	}
+	if err := cfg.renameSection(oldSection, newSection); err != ErrNoSection {
+		return err
+	}
+	return nil
+}
+
+func (cfg *Config) RemoveSection(section string) error {
+	// Delete a section such as `branch.topic` and all its keys from the config file.
+	if err := cfg.renameSection(section, ""); err != ErrNoSection {
+		return err
+	}
+	return nil
+}
+
+func (cfg *Config) HasSection(section string) (bool, error) {
+	// Check whether a section appears in the config file, even with no keys.
+	file, err := cfg.readFile()
+	if err != nil {
+		return false, err
+	}
+	section = normalizeSection(section)
+	for _, header := range file.headers {
+		if header.section == section {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,332 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/tsoud/GoTGit.git/internal/pathglob"
+)
+
+// maxIncludeDepth bounds nested includes, so files including each other
+// can't loop forever.
+const maxIncludeDepth = 10
+
+// ParseError reports a line of a config file that couldn't be parsed, or if
+// File is empty, config given on the command line that couldn't be.
+type ParseError struct {
+	File   string
+	Line   int
+	Reason string
+}
+
+func (err *ParseError) Error() string {
+	if err.File == "" {
+		return "unable to parse command-line config: " + err.Reason
+	}
+	return fmt.Sprintf("bad config line %d in file %s", err.Line, err.File)
+}
+
+// fileEntry is an entry along with where it is in its file: it spans lines
+// `line` to `endLine`, and `header` indexes the header of its section. An
+// entry written on the header line itself has `inline` set.
+type fileEntry struct {
+	Entry
+	line, endLine int
+	header        int
+	inline        bool
+}
+
+// sectionHeader is a section header on line `line`, ending at byte `end`.
+type sectionHeader struct {
+	section string
+	line    int
+	end     int
+}
+
+type parsedFile struct {
+	entries []fileEntry
+	headers []sectionHeader
+}
+
+func isNameChar(ch byte) bool {
+	return ch == '-' || ch >= '0' && ch <= '9' || ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z'
+}
+
+func parseSectionHeader(line string) (string, int, bool) {
+	// Parse a header such as `[section "sub"]` or the older `[section.sub]`,
+	// returning the key prefix ("section.sub") and where the header ends.
+	indent := len(line) - len(strings.TrimLeft(line, " \t"))
+	line = line[indent:]
+	if !strings.HasPrefix(line, "[") {
+		return "", 0, false
+	}
+	i := 1
+	for i < len(line) && (isNameChar(line[i]) || line[i] == '.') {
+		i++
+	}
+	name := strings.ToLower(line[1:i])
+	if name == "" || name[0] == '.' || name[len(name)-1] == '.' {
+		return "", 0, false
+	}
+	if i < len(line) && line[i] == ']' {
+		return name, indent + i + 1, true
+	}
+	if strings.Contains(name, ".") || i >= len(line) || (line[i] != ' ' && line[i] != '\t') {
+		return "", 0, false
+	}
+
+	for i < len(line) && (line[i] == ' ' || line[i] == '\t') {
+		i++
+	}
+	if i >= len(line) || line[i] != '"' {
+		return "", 0, false
+	}
+	var sub strings.Builder
+	for i++; i < len(line) && line[i] != '"'; i++ {
+		if line[i] == '\\' && i+1 < len(line) {
+			i++
+		}
+		sub.WriteByte(line[i])
+	}
+	if i+1 >= len(line) || line[i+1] != ']' {
+		return "", 0, false
+	}
+	return name + "." + sub.String(), indent + i + 2, true
+}
+
+func parseValue(lines []string, i int, raw string) (string, int, bool) {
+	// Parse a value starting at `raw` on line `i`: strip comments and quotes,
+	// resolve escapes and join lines ending in a backslash. Whitespace outside
+	// quotes is kept only between words, each character as one space. Returns
+	// the value and the last line it takes up.
+	var value strings.Builder
+	inQuote := false
+	spaces := 0
+	for j := 0; j < len(raw); j++ {
+		ch := raw[j]
+		switch {
+		case ch == '\\' && j+1 == len(raw):
+			if i+1 >= len(lines) {
+				return "", i, false
+			}
+			i++
+			raw, j = lines[i], -1
+			continue
+		case ch == '\\':
+			j++
+			switch raw[j] {
+			case 'n':
+				ch = '\n'
+			case 't':
+				ch = '\t'
+			case 'b':
+				ch = '\b'
+			case '\\', '"':
+				ch = raw[j]
+			default:
+				return "", i, false
+			}
+		case ch == '"':
+			inQuote = !inQuote
+			continue
+		case (ch == ' ' || ch == '\t' || ch == '\r') && !inQuote:
+			if value.Len() > 0 {
+				spaces++
+			}
+			continue
+		case (ch == '#' || ch == ';') && !inQuote:
+			j = len(raw)
+			continue
+		}
+		for ; spaces > 0; spaces-- {
+			value.WriteByte(' ')
+		}
+		value.WriteByte(ch)
+	}
+	if inQuote {
+		return "", i, false
+	}
+	return value.String(), i, true
+}
+
+func parseLines(lines []string, file string, scope Scope) (*parsedFile, error) {
+	// Parse the lines of a config file into its entries and section headers,
+	// in order.
+	parsed := &parsedFile{}
+	section := ""
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimLeft(lines[i], " \t")
+		inline := false
+		if strings.HasPrefix(line, "[") {
+			header, end, ok := parseSectionHeader(lines[i])
+			if !ok {
+				return nil, &ParseError{File: file, Line: i + 1}
+			}
+			section = header
+			parsed.headers = append(parsed.headers, sectionHeader{section: header, line: i, end: end})
+			line = strings.TrimLeft(lines[i][end:], " \t")
+			inline = true
+		}
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if section == "" {
+			return nil, &ParseError{File: file, Line: i + 1}
+		}
+
+		n := 0
+		for n < len(line) && isNameChar(line[n]) {
+			n++
+		}
+		name, rest := line[:n], strings.TrimLeft(line[n:], " \t")
+		if name == "" || !(name[0] >= 'a' && name[0] <= 'z' || name[0] >= 'A' && name[0] <= 'Z') {
+			return nil, &ParseError{File: file, Line: i + 1}
+		}
+		entry := fileEntry{
+			Entry:  Entry{Key: section + "." + strings.ToLower(name), File: file, Scope: scope},
+			line:   i,
+			header: len(parsed.headers) - 1,
+			inline: inline,
+		}
+		switch {
+		case rest == "" || rest[0] == '#' || rest[0] == ';':
+			entry.NoValue = true
+		case rest[0] == '=':
+			value, end, ok := parseValue(lines, i, rest[1:])
+			if !ok {
+				return nil, &ParseError{File: file, Line: end + 1}
+			}
+			entry.Value, i = value, end
+		default:
+			return nil, &ParseError{File: file, Line: i + 1}
+		}
+		entry.endLine = i
+		parsed.entries = append(parsed.entries, entry)
+	}
+	return parsed, nil
+}
+
+func readLines(file string) ([]string, error) {
+	// Read a config file; a missing file is simply empty.
+	contents, err := os.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("could not read config file %s: %w", file, err)
+	}
+	text := strings.TrimSuffix(strings.ReplaceAll(string(contents), "\r\n", "\n"), "\n")
+	if text == "" {
+		return nil, nil
+	}
+	return strings.Split(text, "\n"), nil
+}
+
+func loadFile(file string, scope Scope, depth int) ([]Entry, error) {
+	// Read the entries of a config file, followed where they appear by those of
+	// the files it includes with `include.path`, or `includeIf.<cond>.path`
+	// when the condition holds.
+	if depth > maxIncludeDepth {
+		return nil, fmt.Errorf("exceeded maximum include depth (%d) while including %s", maxIncludeDepth, file)
+	}
+	lines, err := readLines(file)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := parseLines(lines, file, scope)
+	if err != nil {
+		return nil, err
+	}
+	var entries []Entry
+	for _, entry := range parsed.entries {
+		entries = append(entries, entry.Entry)
+		include, ok := includePath(entry.Entry)
+		if !ok {
+			continue
+		}
+		if include, err = ExpandPath(include); err != nil {
+			return nil, err
+		}
+		if !filepath.IsAbs(include) {
+			include = path.Dir(file) + "/" + include
+		}
+		included, err := loadFile(include, scope, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, included...)
+	}
+	return entries, nil
+}
+
+func includePath(entry Entry) (string, bool) {
+	// Return the file an `include.path` or `includeIf.<cond>.path` entry names,
+	// if it applies.
+	if entry.NoValue || entry.Value == "" {
+		return "", false
+	}
+	if entry.Key == "include.path" {
+		return entry.Value, true
+	}
+	condition, isInclude := strings.CutPrefix(entry.Key, "includeif.")
+	condition, isPath := strings.CutSuffix(condition, ".path")
+	if !isInclude || !isPath {
+		return "", false
+	}
+	return entry.Value, includeConditionHolds(condition, entry.File)
+}
+
+func includeConditionHolds(condition, file string) bool {
+	// Check a condition of `includeIf`: "gitdir:<pattern>" (or "gitdir/i:" to
+	// ignore case) matches the repository directory, and "onbranch:<pattern>"
+	// the current branch. Patterns are globs where "**" matches any number of
+	// directories; a pattern ending in "/" matches everything under it.
+	kind, pattern, _ := strings.Cut(condition, ":")
+	switch kind {
+	case "gitdir", "gitdir/i":
+		if expanded, err := ExpandPath(pattern); err == nil {
+			pattern = expanded
+		}
+		if rest, ok := strings.CutPrefix(pattern, "./"); ok {
+			pattern = path.Dir(file) + "/" + rest
+		}
+		if !filepath.IsAbs(pattern) {
+			pattern = "**/" + pattern
+		}
+		gitDir, err := filepath.Abs(gitDirPath())
+		if err != nil {
+			return false
+		}
+		dirs := []string{gitDir}
+		if real, err := filepath.EvalSymlinks(gitDir); err == nil && real != gitDir {
+			dirs = append(dirs, real)
+		}
+		for _, dir := range dirs {
+			dir, pattern := filepath.ToSlash(dir), filepath.ToSlash(pattern)
+			if kind == "gitdir/i" {
+				dir, pattern = strings.ToLower(dir), strings.ToLower(pattern)
+			}
+			if globMatch(pattern, dir) {
+				return true
+			}
+		}
+	case "onbranch":
+		head, err := os.ReadFile(path.Join(gitDirPath(), "HEAD"))
+		if err != nil {
+			return false
+		}
+		branch, ok := strings.CutPrefix(strings.TrimSpace(string(head)), "ref: refs/heads/")
+		return ok && globMatch(pattern, branch)
+	}
+	return false
+}
+
+func globMatch(pattern, name string) bool {
+	if strings.HasSuffix(pattern, "/") {
+		pattern += "**"
+	}
+	return pathglob.Match(pattern, name)
+}
@@ -0,0 +1,142 @@
+package diff
+
+import "bytes"
+
+type Op int
+
+const (
+	Equal Op = iota
+	Delete
+	Insert
+)
+
+type Edit struct {
+	Op      Op
+	OldLine int
+	NewLine int
+}
+
+func SplitLines(content []byte) []string {
+	// Split content into lines, keeping the trailing newline of each line.
+	var lines []string
+	for len(content) > 0 {
+		end := bytes.IndexByte(content, '\n')
+		if end == -1 {
+			end = len(content) - 1
+		}
+		lines = append(lines, string(content[:end+1]))
+		content = content[end+1:]
+	}
+	return lines
+}
+
+func IsBinary(content []byte) bool {
+	// Treat content as binary if a NUL byte shows up near the start, like Git does.
+	return bytes.IndexByte(content[:min(len(content), 8000)], 0) != -1
+}
+
+func Lines(oldLines, newLines []string) []Edit {
+	// Compute a minimal line-based edit script turning `oldLines` into `newLines`
+	// using Myers' algorithm. Line numbers in the script are 0-based.
+	prefix := 0
+	for prefix < len(oldLines) && prefix < len(newLines) && oldLines[prefix] == newLines[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(oldLines)-prefix && suffix < len(newLines)-prefix &&
+		oldLines[len(oldLines)-1-suffix] == newLines[len(newLines)-1-suffix] {
+		suffix++
+	}
+
+	var edits []Edit
+	for i := 0; i < prefix; i++ {
+		edits = append(edits, Edit{Equal, i, i})
+	}
+	a := oldLines[prefix : len(oldLines)-suffix]
+	b := newLines[prefix : len(newLines)-suffix]
+	for _, edit := range myers(a, b) {
+		edit.OldLine += prefix
+		edit.NewLine += prefix
+		edits = append(edits, edit)
+	}
+	for i := 0; i < suffix; i++ {
+		edits = append(edits, Edit{Equal, len(oldLines) - suffix + i, len(newLines) - suffix + i})
+	}
+
+	return edits
+}
+
+func myers(a, b []string) []Edit {
+	n, m := len(a), len(b)
+	maxD := n + m
+	offset := maxD + 1
+	v := make([]int, 2*maxD+3)
+	var trace [][]int
+
+	for d := 0; d <= maxD; d++ {
+		snapshot := make([]int, len(v))
+		copy(snapshot, v)
+		trace = append(trace, snapshot)
+
+		done := false
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				done = true
+				break
+			}
+		}
+		if done {
+			break
+		}
+	}
+
+	// Walk back through the saved frontiers to recover the path.
+	var reversed []Edit
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0 && (x > 0 || y > 0); d-- {
+		frontier := trace[d]
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && frontier[offset+k-1] < frontier[offset+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := frontier[offset+prevK]
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			x--
+			y--
+			reversed = append(reversed, Edit{Equal, x, y})
+		}
+		if d == 0 {
+			break
+		}
+		if x == prevX {
+			y--
+			reversed = append(reversed, Edit{Insert, x, y})
+		} else {
+			x--
+			reversed = append(reversed, Edit{Delete, x, y})
+		}
+	}
+
+	edits := make([]Edit, len(reversed))
+	for i, edit := range reversed {
+		edits[len(reversed)-1-i] = edit
+	}
+	return edits
+}
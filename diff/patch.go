@@ -0,0 +1,213 @@
+package diff
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/tsoud/GoTGit.git/gitobj"
+)
+
+const (
+	contextLines  = 3
+	funcNameWidth = 80
+	abbrevLength  = 7
+)
+
+type hunk struct {
+	first int
+	last  int
+}
+
+func abbrev(hash string) string {
+	if hash == "" {
+		hash = gitobj.ObjectFormat.NullHash()
+	}
+	return hash[:abbrevLength]
+}
+
+func blobContent(cache blobCache, hash, mode string) ([]byte, error) {
+	// Return what a patch shows for one side of a change: the blob contents, or
+	// the commit a submodule points to.
+	switch {
+	case hash == "":
+		return nil, nil
+	case mode == "160000":
+		return []byte("Subproject commit " + hash + "\n"), nil
+	default:
+		return cache.read(hash)
+	}
+}
+
+func splitTypeChanges(changes []*Change) []*Change {
+	// Show a change of file type as a deletion followed by an addition, like Git.
+	var split []*Change
+	for _, change := range changes {
+		if change.Status != TypeChanged {
+			split = append(split, change)
+			continue
+		}
+		deleted, added := *change, *change
+		deleted.Status, deleted.NewMode, deleted.NewHash = Deleted, "", ""
+		added.Status, added.OldMode, added.OldHash = Added, "", ""
+		split = append(split, &deleted, &added)
+	}
+	return split
+}
+
+func WritePatch(w io.Writer, changes []*Change) error {
+	// Write changes as a unified diff in the format of `git diff`.
+	cache := make(blobCache)
+	var out strings.Builder
+
+	for _, change := range splitTypeChanges(changes) {
+		oldContent, err := blobContent(cache, change.OldHash, change.OldMode)
+		if err != nil {
+			return err
+		}
+		newContent, err := blobContent(cache, change.NewHash, change.NewMode)
+		if err != nil {
+			return err
+		}
+		writeFilePatch(&out, change, oldContent, newContent)
+	}
+
+	_, err := io.WriteString(w, out.String())
+	return err
+}
+
+func writeFilePatch(out *strings.Builder, change *Change, oldContent, newContent []byte) {
+	oldPath, newPath := change.OldPath, change.NewPath
+	if oldPath == "" {
+		oldPath = newPath
+	}
+	if newPath == "" {
+		newPath = oldPath
+	}
+	fmt.Fprintf(out, "diff --git a/%s b/%s\n", oldPath, newPath)
+
+	switch {
+	case change.OldHash == "":
+		fmt.Fprintf(out, "new file mode %s\n", change.NewMode)
+	case change.NewHash == "":
+		fmt.Fprintf(out, "deleted file mode %s\n", change.OldMode)
+	case change.OldMode != change.NewMode:
+		fmt.Fprintf(out, "old mode %s\nnew mode %s\n", change.OldMode, change.NewMode)
+	}
+	if change.Status == Renamed || change.Status == Copied {
+		kind := "rename"
+		if change.Status == Copied {
+			kind = "copy"
+		}
+		fmt.Fprintf(out, "similarity index %d%%\n%s from %s\n%s to %s\n",
+			change.Similarity(), kind, oldPath, kind, newPath)
+	}
+	if change.OldHash == change.NewHash {
+		return
+	}
+
+	fmt.Fprintf(out, "index %s..%s", abbrev(change.OldHash), abbrev(change.NewHash))
+	if change.OldMode == change.NewMode {
+		fmt.Fprintf(out, " %s", change.OldMode)
+	}
+	out.WriteString("\n")
+
+	oldName, newName := "a/"+oldPath, "b/"+newPath
+	if change.OldHash == "" {
+		oldName = "/dev/null"
+	}
+	if change.NewHash == "" {
+		newName = "/dev/null"
+	}
+	if IsBinary(oldContent) || IsBinary(newContent) {
+		fmt.Fprintf(out, "Binary files %s and %s differ\n", oldName, newName)
+		return
+	}
+	if len(oldContent) == 0 && len(newContent) == 0 {
+		return
+	}
+
+	fmt.Fprintf(out, "--- %s\n+++ %s\n", oldName, newName)
+	oldLines, newLines := SplitLines(oldContent), SplitLines(newContent)
+	edits := Lines(oldLines, newLines)
+	for _, h := range hunks(edits) {
+		writeHunk(out, edits[h.first:h.last], oldLines, newLines)
+	}
+}
+
+func hunks(edits []Edit) []hunk {
+	// Group the changed lines into hunks with up to `contextLines` unchanged lines
+	// around them, merging hunks whose context would touch or overlap.
+	var groups []hunk
+	for i, edit := range edits {
+		if edit.Op == Equal {
+			continue
+		}
+		first, last := max(i-contextLines, 0), min(i+contextLines+1, len(edits))
+		if len(groups) > 0 && first <= groups[len(groups)-1].last {
+			groups[len(groups)-1].last = last
+		} else {
+			groups = append(groups, hunk{first, last})
+		}
+	}
+	return groups
+}
+
+func hunkRange(start, count int) string {
+	// Format one side of a hunk header. Git omits a count of one, and an empty
+	// side starts at the line before it.
+	if count == 0 {
+		start--
+	}
+	if count == 1 {
+		return fmt.Sprint(start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
+
+func funcName(oldLines []string, before int) string {
+	// Find the nearest line above the hunk that looks like the start of a
+	// function, meaning it starts with a letter, `_` or `$`, as Git does by default.
+	for i := before - 1; i >= 0; i-- {
+		line := oldLines[i]
+		if c := line[0]; c == '_' || c == '$' || (c|0x20 >= 'a' && c|0x20 <= 'z') {
+			line = line[:min(len(line), funcNameWidth)]
+			return strings.TrimRight(line, " \t\r\n\f\v")
+		}
+	}
+	return ""
+}
+
+func writeHunk(out *strings.Builder, edits []Edit, oldLines, newLines []string) {
+	oldCount, newCount := 0, 0
+	for _, edit := range edits {
+		if edit.Op != Insert {
+			oldCount++
+		}
+		if edit.Op != Delete {
+			newCount++
+		}
+	}
+	oldStart, newStart := edits[0].OldLine, edits[0].NewLine
+	fmt.Fprintf(out, "@@ -%s +%s @@", hunkRange(oldStart+1, oldCount), hunkRange(newStart+1, newCount))
+	if name := funcName(oldLines, oldStart); name != "" {
+		fmt.Fprintf(out, " %s", name)
+	}
+	out.WriteString("\n")
+
+	for _, edit := range edits {
+		var prefix, line string
+		switch edit.Op {
+		case Equal:
+			prefix, line = " ", oldLines[edit.OldLine]
+		case Delete:
+			prefix, line = "-", oldLines[edit.OldLine]
+		case Insert:
+			prefix, line = "+", newLines[edit.NewLine]
+		}
+		out.WriteString(prefix + line)
+		if !strings.HasSuffix(line, "\n") {
+			out.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+}
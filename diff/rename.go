@@ -0,0 +1,273 @@
+package diff
+
+import (
+	"cmp"
+	"fmt"
+	"hash/fnv"
+	"slices"
+
+	"github.com/tsoud/GoTGit.git/gitobj"
+)
+
+// Similarity scores follow Git's scale, where MaxScore means identical content.
+const (
+	MaxScore           = 60000
+	DefaultRenameScore = 30000
+	DefaultRenameLimit = 1000
+	maxChunkLength     = 64
+)
+
+func ParseScore(score string) int {
+	// Parse a similarity threshold given to `-M` or `-C`. Digits are read as a
+	// fraction (`-M5` is 50%, `-M05` is 5%) unless followed by `%` (`-M50%`).
+	num, scale, dot := 0, 1, false
+scan:
+	for _, ch := range score {
+		switch {
+		case ch == '.' && !dot:
+			scale, dot = 1, true
+		case ch == '%':
+			if dot {
+				scale *= 100
+			} else {
+				scale = 100
+			}
+			break scan
+		case ch >= '0' && ch <= '9':
+			if scale < 100000 {
+				scale *= 10
+				num = num*10 + int(ch-'0')
+			}
+		default:
+			break scan
+		}
+	}
+
+	if num >= scale {
+		return MaxScore
+	}
+	return MaxScore * num / scale
+}
+
+func isFile(mode string) bool {
+	return mode == "120000" || (len(mode) == 6 && mode[:3] == "100")
+}
+
+type renameSource struct {
+	change  *Change
+	deleted bool
+	uses    int
+}
+
+type renameMatch struct {
+	src   int
+	dst   int
+	score int
+}
+
+type blobCache map[string][]byte
+
+func (cache blobCache) read(hash string) ([]byte, error) {
+	if content, ok := cache[hash]; ok {
+		return content, nil
+	}
+	obj, err := gitobj.ReadGitObj(hash)
+	if err != nil {
+		return nil, err
+	}
+	cache[hash] = obj.Content
+	return obj.Content, nil
+}
+
+func chunkCounts(content []byte) map[uint64]int {
+	// Split content into lines (capped at `maxChunkLength` bytes) and count how many
+	// bytes each distinct chunk contributes.
+	counts := make(map[uint64]int)
+	start := 0
+	for i, b := range content {
+		if b == '\n' || i-start+1 == maxChunkLength || i == len(content)-1 {
+			hasher := fnv.New64a()
+			hasher.Write(content[start : i+1])
+			counts[hasher.Sum64()] += i - start + 1
+			start = i + 1
+		}
+	}
+	return counts
+}
+
+func similarity(src, dst []byte, minScore int) int {
+	// Estimate how much of `dst` was copied from `src`, on a scale up to MaxScore.
+	maxSize, minSize := len(src), len(dst)
+	if maxSize < minSize {
+		maxSize, minSize = minSize, maxSize
+	}
+	if maxSize == 0 {
+		return 0
+	}
+	// Skip the expensive comparison when the size difference alone rules out a match.
+	if maxSize*(MaxScore-minScore) < (maxSize-minSize)*MaxScore {
+		return 0
+	}
+
+	srcCounts := chunkCounts(src)
+	copied := 0
+	for chunk, dstCount := range chunkCounts(dst) {
+		copied += min(srcCounts[chunk], dstCount)
+	}
+
+	return copied * MaxScore / maxSize
+}
+
+func detectRenames(changes, unchanged []*Change, opts *Options) ([]*Change, error) {
+	// Pair deleted (and, for copies, modified or unchanged) files with added files:
+	// first by identical content, then by estimated similarity.
+	minScore := opts.RenameScore
+	if minScore == 0 {
+		minScore = DefaultRenameScore
+	}
+	limit := opts.RenameLimit
+	if limit == 0 {
+		limit = DefaultRenameLimit
+	}
+
+	var sources []*renameSource
+	var dsts []*Change
+	for _, change := range changes {
+		switch change.Status {
+		case Deleted:
+			sources = append(sources, &renameSource{change: change, deleted: true})
+		case Added:
+			dsts = append(dsts, change)
+		case Modified:
+			if opts.DetectCopies {
+				sources = append(sources, &renameSource{change: change})
+			}
+		}
+	}
+	if opts.DetectCopies && opts.FindCopiesHarder {
+		for _, change := range unchanged {
+			sources = append(sources, &renameSource{change: change})
+		}
+	}
+	if len(sources) == 0 || len(dsts) == 0 {
+		return changes, nil
+	}
+
+	matched := make([]int, len(dsts))
+	scores := make([]int, len(dsts))
+	for i := range matched {
+		matched[i] = -1
+	}
+	// Without copy detection, each deleted file can be the source of one rename only.
+	available := func(src *renameSource) bool {
+		return opts.DetectCopies || (src.deleted && src.uses == 0)
+	}
+	compatible := func(src *renameSource, dst *Change) bool {
+		return isFile(src.change.OldMode) && isFile(dst.NewMode) &&
+			(src.change.OldMode == "120000") == (dst.NewMode == "120000")
+	}
+
+	// Exact renames: the content hash is unchanged. Unused deleted sources are preferred.
+	for dstIdx, dst := range dsts {
+		best := -1
+		for srcIdx, src := range sources {
+			if src.change.OldHash != dst.NewHash || !available(src) || !compatible(src, dst) {
+				continue
+			}
+			if best == -1 || (src.deleted && src.uses == 0 && !sources[best].deleted) {
+				best = srcIdx
+			}
+		}
+		if best != -1 {
+			matched[dstIdx], scores[dstIdx] = best, MaxScore
+			sources[best].uses++
+		}
+	}
+
+	// Inexact renames, unless there are too many candidates to compare.
+	var remaining []int
+	for dstIdx := range dsts {
+		if matched[dstIdx] == -1 {
+			remaining = append(remaining, dstIdx)
+		}
+	}
+	if len(remaining)*len(sources) > limit*limit {
+		if opts.Warnings != nil {
+			fmt.Fprintf(opts.Warnings, "warning: inexact rename detection was skipped due to too many files.\n"+
+				"warning: you may want to raise the rename limit to at least %d\n", max(len(remaining), len(sources)))
+		}
+	} else if len(remaining) > 0 {
+		cache := make(blobCache)
+		var candidates []renameMatch
+		for _, dstIdx := range remaining {
+			dst := dsts[dstIdx]
+			for srcIdx, src := range sources {
+				if !compatible(src, dst) || (!opts.DetectCopies && !src.deleted) {
+					continue
+				}
+				srcContent, err := cache.read(src.change.OldHash)
+				if err != nil {
+					return nil, err
+				}
+				dstContent, err := cache.read(dst.NewHash)
+				if err != nil {
+					return nil, err
+				}
+				if score := similarity(srcContent, dstContent, minScore); score >= minScore {
+					candidates = append(candidates, renameMatch{srcIdx, dstIdx, score})
+				}
+			}
+		}
+
+		slices.SortStableFunc(candidates, func(x, y renameMatch) int {
+			return cmp.Compare(y.score, x.score)
+		})
+		for _, candidate := range candidates {
+			src := sources[candidate.src]
+			if matched[candidate.dst] != -1 || !available(src) {
+				continue
+			}
+			matched[candidate.dst], scores[candidate.dst] = candidate.src, candidate.score
+			src.uses++
+		}
+	}
+
+	// Rewrite matched additions as renames or copies. The last destination (in path
+	// order) that uses a deleted source is the rename; any others are copies.
+	paired := make(map[*Change]*Change)
+	for dstIdx := len(dsts) - 1; dstIdx >= 0; dstIdx-- {
+		if matched[dstIdx] == -1 {
+			continue
+		}
+		src, dst := sources[matched[dstIdx]], dsts[dstIdx]
+		status := byte(Copied)
+		if src.deleted && src.uses > 0 {
+			status = Renamed
+			src.uses = -1
+		}
+		paired[dst] = &Change{
+			Status:  status,
+			Score:   scores[dstIdx],
+			OldPath: src.change.OldPath, OldMode: src.change.OldMode, OldHash: src.change.OldHash,
+			NewPath: dst.NewPath, NewMode: dst.NewMode, NewHash: dst.NewHash,
+		}
+	}
+
+	renamed := make(map[*Change]bool)
+	for _, src := range sources {
+		if src.deleted && src.uses == -1 {
+			renamed[src.change] = true
+		}
+	}
+
+	var result []*Change
+	for _, change := range changes {
+		if pair, ok := paired[change]; ok {
+			result = append(result, pair)
+		} else if !renamed[change] {
+			result = append(result, change)
+		}
+	}
+
+	return result, nil
+}
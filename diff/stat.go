@@ -0,0 +1,179 @@
+package diff
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+const statWidth = 80
+
+type FileStat struct {
+	Name    string
+	Added   int
+	Deleted int
+	Binary  bool
+	OldSize int
+	NewSize int
+}
+
+func RenameName(oldPath, newPath string) string {
+	// Show a rename compactly by factoring out the common leading and trailing
+	// directories, e.g. `dir/{old => new}/file.txt`.
+	if oldPath == newPath {
+		return oldPath
+	}
+
+	pfxLength := 0
+	for i := 0; i < len(oldPath) && i < len(newPath) && oldPath[i] == newPath[i]; i++ {
+		if oldPath[i] == '/' {
+			pfxLength = i + 1
+		}
+	}
+
+	// A common prefix ends with a slash, which the suffix scan may overlap by one.
+	adjust := 0
+	if pfxLength > 0 {
+		adjust = 1
+	}
+	sfxLength := 0
+	oldIdx, newIdx := len(oldPath)-1, len(newPath)-1
+	for oldIdx >= pfxLength-adjust && newIdx >= pfxLength-adjust && oldPath[oldIdx] == newPath[newIdx] {
+		if oldPath[oldIdx] == '/' {
+			sfxLength = len(oldPath) - oldIdx
+		}
+		oldIdx--
+		newIdx--
+	}
+
+	oldMid := max(len(oldPath)-pfxLength-sfxLength, 0)
+	newMid := max(len(newPath)-pfxLength-sfxLength, 0)
+	middle := oldPath[pfxLength:pfxLength+oldMid] + " => " + newPath[pfxLength:pfxLength+newMid]
+	if pfxLength+sfxLength == 0 {
+		return middle
+	}
+	return oldPath[:pfxLength] + "{" + middle + "}" + oldPath[len(oldPath)-sfxLength:]
+}
+
+func countLines(oldContent, newContent []byte) (added, deleted int) {
+	for _, edit := range Lines(SplitLines(oldContent), SplitLines(newContent)) {
+		switch edit.Op {
+		case Insert:
+			added++
+		case Delete:
+			deleted++
+		}
+	}
+	return added, deleted
+}
+
+func Stat(changes []*Change) ([]FileStat, error) {
+	// Count the lines added and deleted by each change.
+	cache := make(blobCache)
+	var stats []FileStat
+
+	for _, change := range changes {
+		stat := FileStat{Name: RenameName(change.OldPath, change.NewPath)}
+		if change.OldPath == "" || change.NewPath == "" {
+			stat.Name = change.Path()
+		}
+
+		var oldContent, newContent []byte
+		var err error
+		if change.OldHash != "" && isFile(change.OldMode) {
+			if oldContent, err = cache.read(change.OldHash); err != nil {
+				return nil, err
+			}
+		}
+		if change.NewHash != "" && isFile(change.NewMode) {
+			if newContent, err = cache.read(change.NewHash); err != nil {
+				return nil, err
+			}
+		}
+
+		if IsBinary(oldContent) || IsBinary(newContent) {
+			stat.Binary = true
+			stat.OldSize, stat.NewSize = len(oldContent), len(newContent)
+		} else if change.OldHash != change.NewHash {
+			stat.Added, stat.Deleted = countLines(oldContent, newContent)
+		}
+		stats = append(stats, stat)
+	}
+
+	return stats, nil
+}
+
+func plural(count int, singular, pluralForm string) string {
+	if count == 1 {
+		return singular
+	}
+	return pluralForm
+}
+
+func WriteStat(w io.Writer, stats []FileStat) error {
+	// Write a `--stat` style summary: one line per file with a graph of the
+	// changes, then the totals.
+	nameWidth, maxChange, totalAdded, totalDeleted := 0, 0, 0, 0
+	for _, stat := range stats {
+		nameWidth = max(nameWidth, len(stat.Name))
+		maxChange = max(maxChange, stat.Added+stat.Deleted)
+		totalAdded += stat.Added
+		totalDeleted += stat.Deleted
+	}
+	countWidth := max(len(fmt.Sprint(maxChange)), 3)
+	if !hasBinary(stats) {
+		countWidth = len(fmt.Sprint(maxChange))
+	}
+	nameWidth = min(nameWidth, statWidth/2+10)
+	graphWidth := max(statWidth-nameWidth-countWidth-5, 6)
+
+	var out strings.Builder
+	for _, stat := range stats {
+		name := stat.Name
+		if len(name) > nameWidth {
+			name = "..." + name[len(name)-nameWidth+3:]
+		}
+
+		if stat.Binary {
+			fmt.Fprintf(&out, " %-*s | %*s %d -> %d bytes\n",
+				nameWidth, name, countWidth, "Bin", stat.OldSize, stat.NewSize)
+			continue
+		}
+
+		added, deleted := stat.Added, stat.Deleted
+		if maxChange > graphWidth {
+			added, deleted = scaleChange(added, graphWidth, maxChange), scaleChange(deleted, graphWidth, maxChange)
+		}
+		graph := strings.Repeat("+", added) + strings.Repeat("-", deleted)
+		line := fmt.Sprintf(" %-*s | %*d %s", nameWidth, name, countWidth, stat.Added+stat.Deleted, graph)
+		out.WriteString(strings.TrimRight(line, " ") + "\n")
+	}
+
+	fmt.Fprintf(&out, " %d %s changed", len(stats), plural(len(stats), "file", "files"))
+	if totalAdded > 0 || totalDeleted == 0 {
+		fmt.Fprintf(&out, ", %d %s(+)", totalAdded, plural(totalAdded, "insertion", "insertions"))
+	}
+	if totalDeleted > 0 || totalAdded == 0 {
+		fmt.Fprintf(&out, ", %d %s(-)", totalDeleted, plural(totalDeleted, "deletion", "deletions"))
+	}
+	out.WriteString("\n")
+
+	_, err := io.WriteString(w, out.String())
+	return err
+}
+
+func hasBinary(stats []FileStat) bool {
+	for _, stat := range stats {
+		if stat.Binary {
+			return true
+		}
+	}
+	return false
+}
+
+func scaleChange(count, width, maxChange int) int {
+	if count == 0 {
+		return 0
+	}
+	return 1 + count*(width-1)/maxChange
+}
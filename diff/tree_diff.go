@@ -0,0 +1,263 @@
+package diff
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"path"
+	"slices"
+
+	"github.com/tsoud/GoTGit.git/gitobj"
+)
+
+const (
+	Added       = 'A'
+	Deleted     = 'D'
+	Modified    = 'M'
+	TypeChanged = 'T'
+	Renamed     = 'R'
+	Copied      = 'C'
+	Unmerged    = 'U'
+)
+
+type Change struct {
+	Status  byte
+	Score   int
+	OldPath string
+	NewPath string
+	OldMode string
+	NewMode string
+	OldHash string
+	NewHash string
+}
+
+type Options struct {
+	Recursive        bool
+	DetectRenames    bool
+	DetectCopies     bool
+	FindCopiesHarder bool
+	RenameScore      int
+	RenameLimit      int
+	// Warnings receives warnings such as inexact rename detection being
+	// skipped for exceeding RenameLimit. If nil, they are dropped.
+	Warnings io.Writer
+}
+
+func (change *Change) Path() string {
+	// Return the path used to order and display a change.
+	if change.NewPath != "" {
+		return change.NewPath
+	}
+	return change.OldPath
+}
+
+func (change *Change) Similarity() int {
+	// Return the similarity score of a rename or copy as a percentage.
+	return change.Score * 100 / MaxScore
+}
+
+func (change *Change) StatusString() string {
+	// Format the status letter, including the similarity score for renames and copies.
+	if change.Status == Renamed || change.Status == Copied {
+		return fmt.Sprintf("%c%03d", change.Status, change.Similarity())
+	}
+	return string(change.Status)
+}
+
+func (change *Change) Raw(quote func(string) string) string {
+	// Format a change in the raw `diff-tree` output format, with its paths
+	// passed through `quote`.
+	oldMode, newMode := change.OldMode, change.NewMode
+	if oldMode == "" {
+		oldMode = "000000"
+	}
+	if newMode == "" {
+		newMode = "000000"
+	}
+	oldHash, newHash := change.OldHash, change.NewHash
+	if oldHash == "" {
+		oldHash = gitobj.ObjectFormat.NullHash()
+	}
+	if newHash == "" {
+		newHash = gitobj.ObjectFormat.NullHash()
+	}
+
+	paths := quote(change.Path())
+	if change.Status == Renamed || change.Status == Copied {
+		paths = quote(change.OldPath) + "\t" + quote(change.NewPath)
+	}
+
+	return fmt.Sprintf(":%s %s %s %s %s\t%s",
+		oldMode, newMode, oldHash, newHash, change.StatusString(), paths)
+}
+
+func readEntries(treeHash string) (map[string]gitobj.TreeEntry, error) {
+	// Map the entries of a tree by name. An empty hash stands for the empty tree.
+	entries := make(map[string]gitobj.TreeEntry)
+	if treeHash == "" {
+		return entries, nil
+	}
+
+	treeEntries, err := gitobj.ReadTree(treeHash)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range treeEntries {
+		entries[entry.Name] = entry
+	}
+
+	return entries, nil
+}
+
+func sameKind(oldMode, newMode string) bool {
+	// Regular files only differ by their executable bit; anything else is a type change.
+	if oldMode == newMode {
+		return true
+	}
+	return oldMode[:3] == "100" && newMode[:3] == "100"
+}
+
+type treeWalker struct {
+	opts      *Options
+	changes   []*Change
+	unchanged []*Change
+}
+
+func (walker *treeWalker) addSide(entry gitobj.TreeEntry, fullPath string, status byte) error {
+	// Record an entry that only exists on one side, expanding trees when recursing.
+	if entry.Type == "tree" && walker.opts.Recursive {
+		if status == Added {
+			return walker.walk("", entry.Hash, fullPath)
+		}
+		return walker.walk(entry.Hash, "", fullPath)
+	}
+
+	change := &Change{Status: status}
+	if status == Added {
+		change.NewPath, change.NewMode, change.NewHash = fullPath, entry.Mode, entry.Hash
+	} else {
+		change.OldPath, change.OldMode, change.OldHash = fullPath, entry.Mode, entry.Hash
+	}
+	walker.changes = append(walker.changes, change)
+
+	return nil
+}
+
+func (walker *treeWalker) addUnchanged(entry gitobj.TreeEntry, fullPath string) error {
+	// Keep track of unmodified files, which are copy sources for `--find-copies-harder`.
+	if !walker.opts.FindCopiesHarder {
+		return nil
+	}
+	if entry.Type == "tree" {
+		subEntries, err := gitobj.ReadTree(entry.Hash)
+		if err != nil {
+			return err
+		}
+		for _, subEntry := range subEntries {
+			if err := walker.addUnchanged(subEntry, path.Join(fullPath, subEntry.Name)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	walker.unchanged = append(walker.unchanged, &Change{
+		OldPath: fullPath, OldMode: entry.Mode, OldHash: entry.Hash,
+		NewPath: fullPath, NewMode: entry.Mode, NewHash: entry.Hash,
+	})
+	return nil
+}
+
+func (walker *treeWalker) walk(oldTree, newTree, prefix string) error {
+	// Compare two trees entry by entry, descending into sub-trees that differ.
+	oldEntries, err := readEntries(oldTree)
+	if err != nil {
+		return fmt.Errorf("error reading tree %s: %w", oldTree, err)
+	}
+	newEntries, err := readEntries(newTree)
+	if err != nil {
+		return fmt.Errorf("error reading tree %s: %w", newTree, err)
+	}
+
+	var names []string
+	for name := range oldEntries {
+		names = append(names, name)
+	}
+	for name := range newEntries {
+		if _, ok := oldEntries[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		fullPath := path.Join(prefix, name)
+		oldEntry, inOld := oldEntries[name]
+		newEntry, inNew := newEntries[name]
+
+		switch {
+		case !inOld:
+			err = walker.addSide(newEntry, fullPath, Added)
+		case !inNew:
+			err = walker.addSide(oldEntry, fullPath, Deleted)
+		case oldEntry.Hash == newEntry.Hash && oldEntry.Mode == newEntry.Mode:
+			err = walker.addUnchanged(oldEntry, fullPath)
+		case oldEntry.Type == "tree" && newEntry.Type == "tree" && walker.opts.Recursive:
+			err = walker.walk(oldEntry.Hash, newEntry.Hash, fullPath)
+		case (oldEntry.Type == "tree") != (newEntry.Type == "tree"):
+			// A file replaced by a directory (or vice versa) is a deletion and an addition.
+			if err = walker.addSide(oldEntry, fullPath, Deleted); err == nil {
+				err = walker.addSide(newEntry, fullPath, Added)
+			}
+		default:
+			status := byte(Modified)
+			if !sameKind(oldEntry.Mode, newEntry.Mode) {
+				status = TypeChanged
+			}
+			walker.changes = append(walker.changes, &Change{
+				Status:  status,
+				OldPath: fullPath, OldMode: oldEntry.Mode, OldHash: oldEntry.Hash,
+				NewPath: fullPath, NewMode: newEntry.Mode, NewHash: newEntry.Hash,
+			})
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func SortChanges(changes []*Change) {
+	// Order changes by path, keeping a deletion ahead of an addition at the same path.
+	slices.SortStableFunc(changes, func(x, y *Change) int {
+		if c := cmp.Compare(x.Path(), y.Path()); c != 0 {
+			return c
+		}
+		return cmp.Compare(x.NewPath, y.NewPath)
+	})
+}
+
+func TreeDiff(oldTree, newTree string, opts *Options) ([]*Change, error) {
+	// Compare two trees (an empty hash is the empty tree) and return the changes
+	// between them, pairing up renames and copies if requested in `opts`.
+	if opts == nil {
+		opts = &Options{}
+	}
+	walker := &treeWalker{opts: opts}
+	if err := walker.walk(oldTree, newTree, ""); err != nil {
+		return nil, err
+	}
+
+	changes := walker.changes
+	if opts.DetectRenames || opts.DetectCopies {
+		var err error
+		changes, err = detectRenames(changes, walker.unchanged, opts)
+		if err != nil {
+			return nil, err
+		}
+	}
+	SortChanges(changes)
+
+	return changes, nil
+}
@@ -0,0 +1,209 @@
+package diff
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/tsoud/GoTGit.git/gitobj"
+	"github.com/tsoud/GoTGit.git/internal/testutil"
+)
+
+func numberedLines(from, to int, replace map[int]string) string {
+	var lines strings.Builder
+	for i := from; i <= to; i++ {
+		if line, ok := replace[i]; ok {
+			lines.WriteString(line + "\n")
+			continue
+		}
+		lines.WriteString(strings.Repeat("line ", 3) + string(rune('a'+i%26)) + "\n")
+	}
+	return lines.String()
+}
+
+func TestTreeDiffRenames(t *testing.T) {
+	testutil.ChdirTemp(t)
+
+	long := numberedLines(1, 40, nil)
+	edited := numberedLines(1, 40, map[int]string{7: "changed"})
+	oldTree := testutil.WriteTree(t, map[string]string{
+		"dir/moved.txt": long,
+		"edited.txt":    long + "tail\n",
+		"kept.txt":      "kept\n",
+		"gone.txt":      "nothing alike\n",
+	})
+	newTree := testutil.WriteTree(t, map[string]string{
+		"newdir/moved.txt": long,
+		"renamed.txt":      edited + "tail\n",
+		"kept.txt":         "kept\n",
+		"copy.txt":         "kept\n",
+	})
+
+	tests := []struct {
+		testName string
+		opts     *Options
+		want     []string
+		warning  string
+	}{
+		{
+			"no_detection",
+			&Options{Recursive: true},
+			[]string{"A copy.txt", "D dir/moved.txt", "D edited.txt", "D gone.txt",
+				"A newdir/moved.txt", "A renamed.txt"},
+			"",
+		},
+		{
+			"renames",
+			&Options{Recursive: true, DetectRenames: true},
+			[]string{"A copy.txt", "D gone.txt", "R100 dir/moved.txt newdir/moved.txt",
+				"R097 edited.txt renamed.txt"},
+			"",
+		},
+		{
+			"strict_threshold",
+			&Options{Recursive: true, DetectRenames: true, RenameScore: ParseScore("99%")},
+			[]string{"A copy.txt", "D edited.txt", "D gone.txt",
+				"R100 dir/moved.txt newdir/moved.txt", "A renamed.txt"},
+			"",
+		},
+		{
+			"copies_harder",
+			&Options{Recursive: true, DetectRenames: true, DetectCopies: true, FindCopiesHarder: true},
+			[]string{"C100 kept.txt copy.txt", "D gone.txt",
+				"R100 dir/moved.txt newdir/moved.txt", "R097 edited.txt renamed.txt"},
+			"",
+		},
+		{
+			"over_rename_limit",
+			&Options{Recursive: true, DetectRenames: true, RenameLimit: 1},
+			[]string{"A copy.txt", "D edited.txt", "D gone.txt",
+				"R100 dir/moved.txt newdir/moved.txt", "A renamed.txt"},
+			"warning: inexact rename detection was skipped due to too many files.\n" +
+				"warning: you may want to raise the rename limit to at least 3\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.testName, func(t *testing.T) {
+			var warnings bytes.Buffer
+			test.opts.Warnings = &warnings
+			changes, err := TreeDiff(oldTree, newTree, test.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, change := range changes {
+				if change.Status == Renamed || change.Status == Copied {
+					got = append(got, change.StatusString()+" "+change.OldPath+" "+change.NewPath)
+				} else {
+					got = append(got, change.StatusString()+" "+change.Path())
+				}
+			}
+			if strings.Join(got, "\n") != strings.Join(test.want, "\n") {
+				t.Errorf("\nWanted:\n%s\nGot:\n%s\n---\n",
+					strings.Join(test.want, "\n"), strings.Join(got, "\n"))
+			}
+			if warnings.String() != test.warning {
+				t.Errorf("Wanted the warning %q, got %q", test.warning, warnings.String())
+			}
+		})
+	}
+}
+
+func TestRaw(t *testing.T) {
+	quote := func(name string) string { return gitobj.QuotePath(name, true) }
+	hash := strings.Repeat("1", 40)
+	tests := []struct {
+		change *Change
+		want   string
+	}{
+		{&Change{Status: Added, NewPath: "é.txt", NewMode: "100644", NewHash: hash},
+			":000000 100644 " + gitobj.ObjectFormat.NullHash() + " " + hash + " A\t\"\\303\\251.txt\""},
+		{&Change{Status: Renamed, Score: MaxScore, OldPath: "tab\there", NewPath: "plain",
+			OldMode: "100644", NewMode: "100644", OldHash: hash, NewHash: hash},
+			":100644 100644 " + hash + " " + hash + " R100\t\"tab\\there\"\tplain"},
+	}
+	for _, test := range tests {
+		if got := test.change.Raw(quote); got != test.want {
+			t.Errorf("Wanted %q, got %q", test.want, got)
+		}
+	}
+}
+
+func TestParseScore(t *testing.T) {
+	for score, want := range map[string]int{
+		"":     0,
+		"5":    MaxScore / 2,
+		"05":   MaxScore / 20,
+		"50%":  MaxScore / 2,
+		"90%":  MaxScore * 9 / 10,
+		"100%": MaxScore,
+		"0.75": MaxScore * 3 / 4,
+	} {
+		if got := ParseScore(score); got != want {
+			t.Errorf("ParseScore(%q): wanted %d, got %d", score, want, got)
+		}
+	}
+}
+
+func TestRenameName(t *testing.T) {
+	for _, test := range [][3]string{
+		{"a.txt", "b.txt", "a.txt => b.txt"},
+		{"dir/a.txt", "dir/b.txt", "dir/{a.txt => b.txt}"},
+		{"old/sub/f.go", "new/sub/f.go", "{old => new}/sub/f.go"},
+		{"src/f.go", "src/pkg/f.go", "src/{ => pkg}/f.go"},
+	} {
+		if got := RenameName(test[0], test[1]); got != test[2] {
+			t.Errorf("RenameName(%q, %q): wanted %q, got %q", test[0], test[1], test[2], got)
+		}
+	}
+}
+
+func TestLines(t *testing.T) {
+	oldLines := SplitLines([]byte("a\nb\nc\nd\n"))
+	newLines := SplitLines([]byte("a\nc\nx\nd"))
+
+	var script strings.Builder
+	for _, edit := range Lines(oldLines, newLines) {
+		script.WriteString([]string{" ", "-", "+"}[edit.Op])
+	}
+	if got := script.String(); got != " - -++" {
+		t.Errorf("Wanted edit script %q, got %q", " - -++", got)
+	}
+}
+
+func TestWritePatch(t *testing.T) {
+	testutil.ChdirTemp(t)
+	oldTree := testutil.WriteTree(t, map[string]string{"f": "one\ntwo\nthree\n", "gone": "bye\n"})
+	newTree := testutil.WriteTree(t, map[string]string{"f": "one\n2\nthree\nfour", "new": ""})
+	changes, err := TreeDiff(oldTree, newTree, &Options{Recursive: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hashes := make(map[string]string)
+	for name, content := range map[string]string{"old": "one\ntwo\nthree\n", "new": "one\n2\nthree\nfour",
+		"gone": "bye\n"} {
+		obj, err := gitobj.HashObject("blob", []byte(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		hashes[name] = obj.Hash[:7]
+	}
+	want := "diff --git a/f b/f\n" +
+		"index " + hashes["old"] + ".." + hashes["new"] + " 100644\n" +
+		"--- a/f\n+++ b/f\n" +
+		"@@ -1,3 +1,4 @@\n one\n-two\n+2\n three\n+four\n\\ No newline at end of file\n" +
+		"diff --git a/gone b/gone\ndeleted file mode 100644\n" +
+		"index " + hashes["gone"] + "..0000000\n" +
+		"--- a/gone\n+++ /dev/null\n@@ -1 +0,0 @@\n-bye\n" +
+		"diff --git a/new b/new\nnew file mode 100644\nindex 0000000..e69de29\n"
+
+	var got strings.Builder
+	if err := WritePatch(&got, changes); err != nil {
+		t.Fatal(err)
+	}
+	if got.String() != want {
+		t.Errorf("wanted patch:\n%s\ngot:\n%s", want, got.String())
+	}
+}
@@ -0,0 +1,451 @@
+package fsck
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/tsoud/GoTGit.git/gitobj"
+	"github.com/tsoud/GoTGit.git/index"
+	"github.com/tsoud/GoTGit.git/refs"
+)
+
+// Bits of the exit status of `git fsck`, combined for the kinds of errors found.
+const (
+	ErrorObject    = 1
+	ErrorReachable = 2
+	ErrorPack      = 4
+	ErrorRefs      = 8
+)
+
+type Severity int
+
+// Info problems are shown as warnings, but not made errors by `--strict`.
+const (
+	Notice Severity = iota
+	Info
+	Warning
+	Error
+)
+
+// Problem is something wrong with an object, pack or ref.
+type Problem struct {
+	Severity Severity
+	// Type and Hash name the object a check failed for, and ID the check, as
+	// in Git's `fsck.<msg-id>` settings, e.g. "treeNotSorted".
+	Type    string
+	Hash    string
+	ID      string
+	Message string
+}
+
+func (problem Problem) String() string {
+	// Format the problem the way `git fsck` prints it.
+	level := "error"
+	switch problem.Severity {
+	case Notice:
+		level = "notice"
+	case Info, Warning:
+		level = "warning"
+	}
+	switch {
+	case problem.Hash == "":
+		return fmt.Sprintf("%s: %s", level, problem.Message)
+	case problem.ID == "":
+		return fmt.Sprintf("%s in %s %s: %s", level, problem.Type, problem.Hash, problem.Message)
+	default:
+		return fmt.Sprintf("%s in %s %s: %s: %s", level, problem.Type, problem.Hash, problem.ID, problem.Message)
+	}
+}
+
+type Options struct {
+	// Strict makes warnings errors, and refuses group-writable file modes.
+	Strict bool
+	// ConnectivityOnly only reads the objects needed to find what they link to,
+	// without checking hashes or contents.
+	ConnectivityOnly bool
+	// Reflogs counts the objects in reflogs as reachable.
+	Reflogs bool
+	// Heads, if given, are the objects connectivity is checked from, instead of
+	// refs, reflogs and the index.
+	Heads []string
+}
+
+type Object struct {
+	Hash string
+	Type string
+}
+
+type Result struct {
+	// Status combines the Error* bits for the errors found; 0 means none were.
+	Status   int
+	Problems []Problem
+	// Missing objects are reachable, but not in the store. Unreachable objects
+	// can't be reached from any head, and Dangling ones, a subset, aren't linked
+	// to by any other object either. All are sorted by hash.
+	Missing     []Object
+	Unreachable []Object
+	Dangling    []Object
+}
+
+// link is a reference from one object to another of the given type.
+type link struct {
+	hash    string
+	objType string
+}
+
+type object struct {
+	objType   string
+	links     []link
+	reachable bool
+	used      bool
+}
+
+type checker struct {
+	opts    *Options
+	result  *Result
+	objects map[string]*object
+	missing map[string]string
+}
+
+func Check(opts *Options) (*Result, error) {
+	// Check every object in the store, then which ones can be reached from the
+	// heads.
+	c := &checker{
+		opts:    opts,
+		result:  &Result{},
+		objects: make(map[string]*object),
+		missing: make(map[string]string),
+	}
+	if err := c.scanStore(gitobj.Store); err != nil {
+		return nil, err
+	}
+	c.linkObjects()
+	if err := c.markHeads(); err != nil {
+		return nil, err
+	}
+
+	for hash, objType := range c.missing {
+		c.result.Missing = append(c.result.Missing, Object{hash, objType})
+	}
+	slices.SortFunc(c.result.Missing, func(a, b Object) int { return cmp.Compare(a.Hash, b.Hash) })
+	for _, hash := range sortedKeys(c.objects) {
+		obj := c.objects[hash]
+		if obj.reachable {
+			continue
+		}
+		c.result.Unreachable = append(c.result.Unreachable, Object{hash, obj.objType})
+		if !obj.used {
+			c.result.Dangling = append(c.result.Dangling, Object{hash, obj.objType})
+		}
+	}
+	return c.result, nil
+}
+
+func sortedKeys(objects map[string]*object) []string {
+	hashes := make([]string, 0, len(objects))
+	for hash := range objects {
+		hashes = append(hashes, hash)
+	}
+	slices.Sort(hashes)
+	return hashes
+}
+
+func (c *checker) report(status int, problem Problem) {
+	if problem.Severity == Warning && c.opts.Strict {
+		problem.Severity = Error
+	}
+	if problem.Severity == Error {
+		c.result.Status |= status
+	}
+	c.result.Problems = append(c.result.Problems, problem)
+}
+
+func (c *checker) errorf(status int, format string, args ...any) {
+	c.report(status, Problem{Severity: Error, Message: fmt.Sprintf(format, args...)})
+}
+
+func (c *checker) scanStore(store gitobj.ObjectStore) error {
+	// Check the objects of each layer of the store, so a copy that is hidden by
+	// one in an earlier layer is checked too.
+	switch store := store.(type) {
+	case *gitobj.LayeredStore:
+		for _, layer := range store.Layers {
+			if err := c.scanStore(layer); err != nil {
+				return err
+			}
+		}
+		return nil
+	case *gitobj.PackStore:
+		if c.opts.ConnectivityOnly {
+			break
+		}
+		packs, err := store.Packs()
+		if err != nil {
+			return err
+		}
+		for _, pack := range packs {
+			if err := gitobj.VerifyPackChecksum(pack); err != nil {
+				c.errorf(ErrorPack, "%s", err)
+			}
+		}
+	}
+	return store.Iterate(func(hash string) error {
+		c.checkObject(store, hash)
+		return nil
+	})
+}
+
+func (c *checker) checkObject(store gitobj.ObjectStore, hash string) {
+	// Read an object, check that it hashes to its name and that its contents
+	// are well-formed, and note what it links to. Objects that can't be read
+	// are left out, so they are reported as missing where they are needed.
+	location := ""
+	if loose, ok := store.(*gitobj.LooseStore); ok {
+		location = ": " + loose.ObjectPath(hash)
+	}
+	objType, body, err := c.readObject(store, hash)
+	if err != nil {
+		c.errorf(ErrorObject, "%s", err)
+		c.errorf(ErrorObject, "%s: object corrupt or missing%s", hash, location)
+		return
+	}
+	if !c.opts.ConnectivityOnly {
+		rehashed, err := gitobj.HashObject(objType, body)
+		if err != nil {
+			c.errorf(ErrorObject, "%s", err)
+			return
+		}
+		if rehashed.Hash != hash {
+			c.errorf(ErrorObject, "%s: hash-path mismatch, found at%s", rehashed.Hash, location)
+			return
+		}
+	}
+	if _, seen := c.objects[hash]; seen {
+		return
+	}
+
+	obj := &object{objType: objType}
+	switch objType {
+	case "tree":
+		obj.links = c.checkTree(hash, body)
+	case "commit":
+		obj.links = c.checkCommit(hash, body)
+	case "tag":
+		obj.links = c.checkTag(hash, body)
+	}
+	c.objects[hash] = obj
+}
+
+func (c *checker) readObject(store gitobj.ObjectStore, hash string) (string, []byte, error) {
+	// Blobs link to nothing, so only their type is needed to check connectivity.
+	if !c.opts.ConnectivityOnly {
+		object, err := store.Read(hash)
+		if err != nil {
+			return "", nil, err
+		}
+		return object.Type, object.Body(), nil
+	}
+	reader, err := store.Stream(hash)
+	if err != nil {
+		return "", nil, err
+	}
+	defer reader.Close()
+	if reader.Type == "blob" {
+		return reader.Type, nil, nil
+	}
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		return "", nil, err
+	}
+	return reader.Type, body, nil
+}
+
+func (c *checker) linkObjects() {
+	// Mark the objects linked to by others, including unreachable ones, and
+	// report links to objects of the wrong type. Like Git, only a full check
+	// counts them as errors.
+	status := ErrorObject
+	if c.opts.ConnectivityOnly {
+		status = 0
+	}
+	for _, hash := range sortedKeys(c.objects) {
+		obj := c.objects[hash]
+		broken := false
+		for _, target := range obj.links {
+			linked, ok := c.objects[target.hash]
+			if !ok {
+				continue
+			}
+			linked.used = true
+			if linked.objType != target.objType {
+				c.errorf(status, "object %s is a %s, not a %s", target.hash, linked.objType, target.objType)
+				broken = true
+			}
+		}
+		if broken && !c.opts.ConnectivityOnly {
+			c.report(ErrorObject, Problem{Severity: Error, Type: obj.objType, Hash: hash, Message: "broken links"})
+		}
+	}
+}
+
+func (c *checker) mark(hash, objType string) {
+	// Mark the object and everything it links to as reachable. Objects that
+	// aren't in the store are recorded as missing.
+	pending := []link{{hash, objType}}
+	for len(pending) > 0 {
+		next := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		obj, ok := c.objects[next.hash]
+		if !ok {
+			if _, seen := c.missing[next.hash]; !seen {
+				c.missing[next.hash] = next.objType
+				c.result.Status |= ErrorReachable
+			}
+			continue
+		}
+		if obj.reachable {
+			continue
+		}
+		obj.reachable, obj.used = true, true
+		pending = append(pending, obj.links...)
+	}
+}
+
+func (c *checker) markHead(name, hash string) {
+	obj, ok := c.objects[hash]
+	if !ok {
+		c.errorf(ErrorReachable, "%s: invalid sha1 pointer %s", name, hash)
+		return
+	}
+	if obj.objType != "commit" && strings.HasPrefix(name, "refs/heads/") {
+		c.errorf(ErrorRefs, "%s: not a commit", name)
+	}
+	c.mark(hash, obj.objType)
+}
+
+func (c *checker) markHeads() error {
+	// Mark what is reachable from the heads given, or else from refs, HEAD,
+	// reflogs and the index.
+	if len(c.opts.Heads) > 0 {
+		for _, head := range c.opts.Heads {
+			hash, err := refs.ResolveRevision(head)
+			if err != nil {
+				return err
+			}
+			c.markHead(head, hash)
+		}
+		return nil
+	}
+
+	allRefs, err := refs.List("")
+	if err != nil {
+		return err
+	}
+	for _, ref := range allRefs {
+		c.markHead(ref.Name, ref.Hash)
+	}
+	if err := c.markHEAD(); err != nil {
+		return err
+	}
+	if len(allRefs) == 0 {
+		c.report(0, Problem{Severity: Notice, Message: "No default references"})
+	}
+
+	if c.opts.Reflogs {
+		if err := c.markReflogs(); err != nil {
+			return err
+		}
+	}
+
+	idx, err := index.Read()
+	if err != nil {
+		return err
+	}
+	for _, entry := range idx.Entries {
+		if entry.ModeString() != "160000" {
+			c.mark(entry.Hash, "blob")
+		}
+	}
+	return nil
+}
+
+func (c *checker) markHEAD() error {
+	target, isSymbolic, err := refs.ReadSymbolic(refs.HEAD)
+	if err != nil {
+		return fmt.Errorf("could not read HEAD: %w", err)
+	}
+	if !isSymbolic {
+		c.markHead(refs.HEAD, target)
+		return nil
+	}
+	hash, err := refs.Resolve(target)
+	if errors.Is(err, refs.ErrNotFound) {
+		c.report(0, Problem{Severity: Notice,
+			Message: fmt.Sprintf("HEAD points to an unborn branch (%s)", refs.ShortName(target))})
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	c.markHead(refs.HEAD, hash)
+	return nil
+}
+
+func (c *checker) markReflogs() error {
+	names, err := refs.ListReflogs()
+	if err != nil {
+		return err
+	}
+	nullHash := gitobj.ObjectFormat.NullHash()
+	for _, name := range names {
+		entries, err := refs.ReadReflog(name)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			for _, hash := range []string{entry.OldHash, entry.NewHash} {
+				if hash == nullHash {
+					continue
+				}
+				if obj, ok := c.objects[hash]; ok {
+					c.mark(hash, obj.objType)
+				} else {
+					c.errorf(ErrorReachable, "%s: invalid reflog entry %s", name, hash)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func WriteLostFound(objects []Object) error {
+	// Save dangling objects in `lost-found` in the git directory: commits by hash
+	// under `commit`, and the rest under `other`, with blobs' contents.
+	for _, found := range objects {
+		dir, contents := "other", []byte(found.Hash+"\n")
+		if found.Type == "commit" {
+			dir = "commit"
+		}
+		if found.Type == "blob" {
+			blob, err := gitobj.ReadGitObj(found.Hash)
+			if err != nil {
+				return err
+			}
+			contents = blob.Body()
+		}
+		dir = path.Join(gitobj.GitDir, "lost-found", dir)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("could not create lost-found: %w", err)
+		}
+		if err := os.WriteFile(path.Join(dir, found.Hash), contents, 0644); err != nil {
+			return fmt.Errorf("could not write lost-found: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,223 @@
+package fsck
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/hex"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/tsoud/GoTGit.git/gitobj"
+	"github.com/tsoud/GoTGit.git/internal/testutil"
+	"github.com/tsoud/GoTGit.git/refs"
+)
+
+const testSignature = "Test <test@example.com> 1700000000 +0000"
+
+func treeEntry(mode, name, hash string) string {
+	binHash, _ := hex.DecodeString(hash)
+	return mode + " " + name + "\x00" + string(binHash)
+}
+
+func writeCommit(t *testing.T, message, tree string, parents ...string) string {
+	t.Helper()
+	body := "tree " + tree + "\n"
+	for _, parent := range parents {
+		body += "parent " + parent + "\n"
+	}
+	body += "author " + testSignature + "\ncommitter " + testSignature + "\n\n" + message + "\n"
+	return testutil.WriteObject(t, "commit", body)
+}
+
+func messages(result *Result) []string {
+	var lines []string
+	for _, problem := range result.Problems {
+		lines = append(lines, problem.String())
+	}
+	return lines
+}
+
+func TestConnectivity(t *testing.T) {
+	testutil.InitRepo(t)
+
+	blob := testutil.WriteObject(t, "blob", "contents\n")
+	tree := testutil.WriteObject(t, "tree", treeEntry("100644", "file", blob))
+	first := writeCommit(t, "first", tree)
+	second := writeCommit(t, "second", tree, first)
+	amended := writeCommit(t, "amended", tree, first)
+	dangling := testutil.WriteObject(t, "blob", "lost\n")
+
+	// The amended commit is only in the reflog of main.
+	for _, hash := range []string{second, amended, second} {
+		if err := refs.Update("refs/heads/main", hash, "test"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	result, err := Check(&Options{Reflogs: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Status != 0 || len(result.Problems) > 0 || len(result.Missing) > 0 {
+		t.Errorf("wanted a clean check, got status %d, problems %q, missing %v",
+			result.Status, messages(result), result.Missing)
+	}
+	if want := []Object{{dangling, "blob"}}; !slices.Equal(result.Dangling, want) {
+		t.Errorf("wanted dangling %v, got %v", want, result.Dangling)
+	}
+
+	result, err = Check(&Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Object{{amended, "commit"}, {dangling, "blob"}}
+	slices.SortFunc(want, func(a, b Object) int { return strings.Compare(a.Hash, b.Hash) })
+	if !slices.Equal(result.Dangling, want) || !slices.Equal(result.Unreachable, want) {
+		t.Errorf("without reflogs, wanted dangling and unreachable %v, got %v and %v",
+			want, result.Dangling, result.Unreachable)
+	}
+
+	// A branch whose commit has a missing parent.
+	missing := strings.Repeat("1", 40)
+	broken := writeCommit(t, "broken", tree, missing)
+	if err := refs.Update("refs/heads/broken", broken, "test"); err != nil {
+		t.Fatal(err)
+	}
+	result, err = Check(&Options{Reflogs: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []Object{{missing, "commit"}}; !slices.Equal(result.Missing, want) {
+		t.Errorf("wanted missing %v, got %v", want, result.Missing)
+	}
+	if result.Status != ErrorReachable {
+		t.Errorf("wanted status %d, got %d", ErrorReachable, result.Status)
+	}
+}
+
+func TestObjectChecks(t *testing.T) {
+	testutil.InitRepo(t)
+
+	blob := testutil.WriteObject(t, "blob", "contents\n")
+	tree := testutil.WriteObject(t, "tree", treeEntry("100644", "b", blob)+treeEntry("040000", "a", blob))
+	commit := testutil.WriteObject(t, "commit", "tree "+tree+"\ncommitter "+testSignature+"\n\nmessage\n")
+	tag := testutil.WriteObject(t, "tag", "object "+commit+"\ntype commit\ntag v1\n\nmessage\n")
+	badDate := testutil.WriteObject(t, "commit", "tree "+tree+"\nauthor Test <test@example.com> 01 +0000\n"+
+		"committer "+testSignature+"\n\nmessage\n")
+
+	result, err := Check(&Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"error in commit " + badDate + ": zeroPaddedDate: invalid author/committer line - zero-padded date",
+		"error in commit " + commit + ": missingAuthor: invalid format - expected 'author' line",
+		"warning in tag " + tag + ": missingTaggerEntry: invalid format - expected 'tagger' line",
+		"warning in tree " + tree + ": zeroPaddedFilemode: contains zero-padded file modes",
+		"error in tree " + tree + ": treeNotSorted: not properly sorted",
+		"error: object " + blob + " is a blob, not a tree",
+		"error in tree " + tree + ": broken links",
+		"notice: HEAD points to an unborn branch (main)",
+		"notice: No default references",
+	}
+	// Objects are checked in the order they are stored in.
+	got := messages(result)
+	slices.Sort(want[:5])
+	slices.Sort(got[:min(5, len(got))])
+	if !slices.Equal(got, want) {
+		t.Errorf("wanted problems\n%s\ngot\n%s", strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+	if result.Status != ErrorObject {
+		t.Errorf("wanted status %d, got %d", ErrorObject, result.Status)
+	}
+
+	// Strict checking makes warnings errors, but not info like the missing tagger.
+	result, err = Check(&Options{Strict: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, problem := range result.Problems {
+		switch problem.ID {
+		case "zeroPaddedFilemode":
+			if problem.Severity != Error {
+				t.Errorf("wanted %s to be an error with --strict", problem.ID)
+			}
+		case "missingTaggerEntry":
+			if problem.Severity != Info {
+				t.Errorf("wanted %s to stay info with --strict", problem.ID)
+			}
+		}
+	}
+}
+
+func TestCorruptObjects(t *testing.T) {
+	testutil.InitRepo(t)
+
+	// A blob stored under another blob's name, and a file that isn't zlib data.
+	renamed := testutil.WriteObject(t, "blob", "original\n")
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	zw.Write([]byte("blob 9\x00replaced\n"))
+	zw.Close()
+	loose := gitobj.NewLooseStore(gitobj.GitObjectDir)
+	if err := os.Chmod(loose.ObjectPath(renamed), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(loose.ObjectPath(renamed), buf.Bytes(), 0444); err != nil {
+		t.Fatal(err)
+	}
+	actual, err := gitobj.HashObject("blob", []byte("replaced\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	garbled := strings.Repeat("2", 40)
+	if err := os.MkdirAll(path.Dir(loose.ObjectPath(garbled)), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(loose.ObjectPath(garbled), []byte("not zlib data"), 0444); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := Check(&Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := strings.Join(messages(result), "\n")
+	for _, want := range []string{
+		"error: " + actual.Hash + ": hash-path mismatch, found at: " + loose.ObjectPath(renamed),
+		"error: " + garbled + ": object corrupt or missing: " + loose.ObjectPath(garbled),
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("wanted problem %q, got\n%s", want, got)
+		}
+	}
+	if result.Status != ErrorObject {
+		t.Errorf("wanted status %d, got %d", ErrorObject, result.Status)
+	}
+	if len(result.Dangling) > 0 {
+		t.Errorf("wanted corrupt objects to be left out, got dangling %v", result.Dangling)
+	}
+}
+
+func TestCheckIdent(t *testing.T) {
+	for ident, want := range map[string]string{
+		testSignature:                                        "",
+		"<test@example.com> 1700000000 +0000":                "missingNameBeforeEmail",
+		"Test test@example.com> 1700000000 +0000":            "badName",
+		"Test 1700000000 +0000":                              "missingEmail",
+		"Test<test@example.com> 1700000000 +0000":            "missingSpaceBeforeEmail",
+		"Test <test@example.com 1700000000 +0000":            "badEmail",
+		"Test <test@example.com>1700000000 +0000":            "missingSpaceBeforeDate",
+		"Test <test@example.com> 0170000000 +0000":           "zeroPaddedDate",
+		"Test <test@example.com> soon +0000":                 "badDate",
+		"Test <test@example.com> 99999999999999999999 +0000": "badDateOverflow",
+		"Test <test@example.com> 1700000000 0000":            "badTimezone",
+	} {
+		if id, _ := checkIdent(ident); id != want {
+			t.Errorf("checkIdent(%q): wanted %q, got %q", ident, want, id)
+		}
+	}
+}
@@ -0,0 +1,323 @@
+package fsck
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/tsoud/GoTGit.git/gitobj"
+	"github.com/tsoud/GoTGit.git/refs"
+)
+
+// File type bits of tree entry modes.
+const (
+	modeTypeMask = 0170000
+	modeDir      = 0040000
+	modeFile     = 0100000
+	modeSymlink  = 0120000
+	modeGitlink  = 0160000
+)
+
+func (c *checker) objectProblem(objType, hash string, severity Severity, id, message string) {
+	c.report(ErrorObject, Problem{Severity: severity, Type: objType, Hash: hash, ID: id, Message: message})
+}
+
+func (c *checker) checkTree(hash string, body []byte) []link {
+	// Check the entries of a tree as Git does, returning what they link to.
+	// Each problem is reported once per tree, in Git's order.
+	var links []link
+	var nullHash, fullPath, emptyName, dot, dotdot, dotgit, zeroPadded, badModes, dups, unsorted bool
+	names := make(map[string]bool)
+	prevKey := ""
+	hashSize := gitobj.ObjectFormat.Size
+
+	for rest := body; len(rest) > 0; {
+		space, nul := bytes.IndexByte(rest, ' '), bytes.IndexByte(rest, 0)
+		mode, err := strconv.ParseUint(string(rest[:max(space, 0)]), 8, 32)
+		if space <= 0 || nul < space || len(rest) < nul+1+hashSize || err != nil {
+			if !c.opts.ConnectivityOnly {
+				c.objectProblem("tree", hash, Error, "badTree", "cannot be parsed as a tree")
+			}
+			return nil
+		}
+		zeroPadded = zeroPadded || rest[0] == '0'
+		name := string(rest[space+1 : nul])
+		entryHash := hex.EncodeToString(rest[nul+1 : nul+1+hashSize])
+		rest = rest[nul+1+hashSize:]
+
+		switch mode & modeTypeMask {
+		case modeDir:
+			links = append(links, link{entryHash, "tree"})
+		case modeFile, modeSymlink:
+			links = append(links, link{entryHash, "blob"})
+		}
+		switch mode {
+		case 0100755, 0100644, modeSymlink, modeDir, modeGitlink:
+		case 0100664:
+			// Old versions of Git wrote group-writable files.
+			badModes = badModes || c.opts.Strict
+		default:
+			badModes = true
+		}
+
+		nullHash = nullHash || entryHash == gitobj.ObjectFormat.NullHash()
+		fullPath = fullPath || strings.Contains(name, "/")
+		emptyName = emptyName || name == ""
+		dot = dot || name == "."
+		dotdot = dotdot || name == ".."
+		dotgit = dotgit || strings.EqualFold(name, ".git") || strings.EqualFold(name, "git~1")
+
+		// Entries are sorted as if directory names ended with a slash.
+		key := name
+		if mode&modeTypeMask == modeDir {
+			key += "/"
+		}
+		if names[name] {
+			dups = true
+		} else if prevKey != "" && key < prevKey {
+			unsorted = true
+		}
+		names[name], prevKey = true, key
+	}
+	if c.opts.ConnectivityOnly {
+		return links
+	}
+
+	for _, check := range []struct {
+		failed   bool
+		severity Severity
+		id       string
+		message  string
+	}{
+		{nullHash, Warning, "nullSha1", "contains entries pointing to null sha1"},
+		{fullPath, Warning, "fullPathname", "contains full pathnames"},
+		{emptyName, Warning, "emptyName", "contains empty pathname"},
+		{dot, Warning, "hasDot", "contains '.'"},
+		{dotdot, Warning, "hasDotdot", "contains '..'"},
+		{dotgit, Warning, "hasDotgit", "contains '.git'"},
+		{zeroPadded, Warning, "zeroPaddedFilemode", "contains zero-padded file modes"},
+		{badModes, Info, "badFilemode", "contains bad file modes"},
+		{dups, Error, "duplicateEntries", "contains duplicate file entries"},
+		{unsorted, Error, "treeNotSorted", "not properly sorted"},
+	} {
+		if check.failed {
+			c.objectProblem("tree", hash, check.severity, check.id, check.message)
+		}
+	}
+	return links
+}
+
+type header struct {
+	key   string
+	value string
+}
+
+func parseHeaders(body []byte) []header {
+	// Split the header lines of a commit or tag, up to the blank line before
+	// the message, into keys and values.
+	var headers []header
+	lines, _, _ := bytes.Cut(body, []byte("\n\n"))
+	for _, line := range strings.Split(string(lines), "\n") {
+		key, value, _ := strings.Cut(line, " ")
+		headers = append(headers, header{key, value})
+	}
+	return headers
+}
+
+func (c *checker) verifyHeaders(objType, hash string, body []byte) bool {
+	// The headers must end with a blank line or the end of the object, and
+	// can't hold NUL bytes.
+	for i, b := range body {
+		if b == 0 {
+			c.objectProblem(objType, hash, Error, "nulInHeader", fmt.Sprintf("unterminated header: NUL at offset %d", i))
+			return false
+		}
+		if b == '\n' && i+1 < len(body) && body[i+1] == '\n' {
+			return true
+		}
+	}
+	if len(body) > 0 && body[len(body)-1] == '\n' {
+		return true
+	}
+	c.objectProblem(objType, hash, Error, "unterminatedHeader", "unterminated header")
+	return false
+}
+
+func (c *checker) checkCommit(hash string, body []byte) []link {
+	// Check the headers of a commit, which must come in the order tree, parents,
+	// author and committer, stopping at the first error. The links are taken
+	// from well-formed tree and parent lines regardless.
+	headers := parseHeaders(body)
+	var links []link
+	for i, h := range headers {
+		key, objType := "parent", "commit"
+		if i == 0 {
+			key, objType = "tree", "tree"
+		}
+		if h.key != key || !gitobj.IsHash(h.value) {
+			break
+		}
+		links = append(links, link{h.value, objType})
+	}
+	if c.opts.ConnectivityOnly || !c.verifyHeaders("commit", hash, body) {
+		return links
+	}
+
+	fail := func(id, message string) []link {
+		c.objectProblem("commit", hash, Error, id, message)
+		return links
+	}
+	next := 0
+	nextHeader := func(key string) (string, bool) {
+		if next < len(headers) && headers[next].key == key {
+			next++
+			return headers[next-1].value, true
+		}
+		return "", false
+	}
+
+	tree, ok := nextHeader("tree")
+	if !ok {
+		return fail("missingTree", "invalid format - expected 'tree' line")
+	}
+	if !gitobj.IsHash(tree) {
+		return fail("badTreeSha1", "invalid 'tree' line format - bad sha1")
+	}
+	for parent, ok := nextHeader("parent"); ok; parent, ok = nextHeader("parent") {
+		if !gitobj.IsHash(parent) {
+			return fail("badParentSha1", "invalid 'parent' line format - bad sha1")
+		}
+	}
+	authors := 0
+	for author, ok := nextHeader("author"); ok; author, ok = nextHeader("author") {
+		authors++
+		if id, message := checkIdent(author); id != "" {
+			return fail(id, message)
+		}
+	}
+	switch {
+	case authors == 0:
+		return fail("missingAuthor", "invalid format - expected 'author' line")
+	case authors > 1:
+		return fail("multipleAuthors", "invalid format - multiple 'author' lines")
+	}
+	committer, ok := nextHeader("committer")
+	if !ok {
+		return fail("missingCommitter", "invalid format - expected 'committer' line")
+	}
+	if id, message := checkIdent(committer); id != "" {
+		return fail(id, message)
+	}
+	if bytes.IndexByte(body, 0) >= 0 {
+		c.objectProblem("commit", hash, Warning, "nulInCommit", "NUL byte in the commit object body")
+	}
+	return links
+}
+
+func (c *checker) checkTag(hash string, body []byte) []link {
+	// Check the headers of an annotated tag: object, type, tag and tagger, in
+	// that order.
+	headers := parseHeaders(body)
+	var links []link
+	if len(headers) > 1 && headers[0].key == "object" && headers[1].key == "type" &&
+		gitobj.IsHash(headers[0].value) {
+		links = append(links, link{headers[0].value, headers[1].value})
+	}
+	if c.opts.ConnectivityOnly || !c.verifyHeaders("tag", hash, body) {
+		return links
+	}
+
+	fail := func(severity Severity, id, message string) []link {
+		c.objectProblem("tag", hash, severity, id, message)
+		return links
+	}
+	field := func(i int, key string) (string, bool) {
+		if i < len(headers) && headers[i].key == key {
+			return headers[i].value, true
+		}
+		return "", false
+	}
+
+	object, ok := field(0, "object")
+	if !ok {
+		return fail(Error, "missingObject", "invalid format - expected 'object' line")
+	}
+	if !gitobj.IsHash(object) {
+		return fail(Error, "badObjectSha1", "invalid 'object' line format - bad sha1")
+	}
+	objType, ok := field(1, "type")
+	if !ok {
+		return fail(Error, "missingTypeEntry", "invalid format - expected 'type' line")
+	}
+	switch objType {
+	case "blob", "tree", "commit", "tag":
+	default:
+		return fail(Error, "badType", "invalid 'type' value")
+	}
+	name, ok := field(2, "tag")
+	if !ok {
+		return fail(Error, "missingTagEntry", "invalid format - expected 'tag' line")
+	}
+	if refs.ValidateName("refs/tags/"+name) != nil {
+		c.objectProblem("tag", hash, Info, "badTagName", fmt.Sprintf("invalid 'tag' name: %s", name))
+	}
+	tagger, ok := field(3, "tagger")
+	if !ok {
+		return fail(Info, "missingTaggerEntry", "invalid format - expected 'tagger' line")
+	}
+	if id, message := checkIdent(tagger); id != "" {
+		return fail(Error, id, message)
+	}
+	return links
+}
+
+func checkIdent(ident string) (string, string) {
+	// Check an author, committer or tagger line, "Name <email> seconds +hhmm",
+	// returning the ID and message of the first problem found, if any.
+	if strings.HasPrefix(ident, "<") {
+		return "missingNameBeforeEmail", "invalid author/committer line - missing space before email"
+	}
+	i := strings.IndexAny(ident, "<>")
+	switch {
+	case i >= 0 && ident[i] == '>':
+		return "badName", "invalid author/committer line - bad name"
+	case i < 0:
+		return "missingEmail", "invalid author/committer line - missing email"
+	case ident[i-1] != ' ':
+		return "missingSpaceBeforeEmail", "invalid author/committer line - missing space before email"
+	}
+	rest := ident[i+1:]
+	i = strings.IndexAny(rest, "<>")
+	if i < 0 || rest[i] != '>' {
+		return "badEmail", "invalid author/committer line - bad email"
+	}
+	rest, ok := strings.CutPrefix(rest[i+1:], " ")
+	if !ok {
+		return "missingSpaceBeforeDate", "invalid author/committer line - missing space before date"
+	}
+	date, zone, ok := strings.Cut(rest, " ")
+	switch {
+	case len(date) > 1 && date[0] == '0':
+		return "zeroPaddedDate", "invalid author/committer line - zero-padded date"
+	case !ok || !isDigits(date):
+		return "badDate", "invalid author/committer line - bad date"
+	}
+	if _, err := strconv.ParseUint(date, 10, 64); err != nil {
+		return "badDateOverflow", "invalid author/committer line - date causes integer overflow"
+	}
+	if len(zone) != 5 || (zone[0] != '+' && zone[0] != '-') || !isDigits(zone[1:]) {
+		return "badTimezone", "invalid author/committer line - bad time zone"
+	}
+	return "", ""
+}
+
+func isDigits(s string) bool {
+	for _, ch := range s {
+		if ch < '0' || ch > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
@@ -0,0 +1,139 @@
+package gc
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/tsoud/GoTGit.git/gitobj"
+)
+
+// ObjectCounts describes how the objects of a repository are stored, as
+// `git count-objects -v` reports it. Sizes are in bytes.
+type ObjectCounts struct {
+	Count         int
+	Size          int64
+	InPack        int
+	Packs         int
+	SizePack      int64
+	PrunePackable int
+	Garbage       int
+	SizeGarbage   int64
+}
+
+// Files that belong to a pack, grouped by their name without the extension.
+// Only a `.pack` and `.idx` together make a usable pack.
+var packFileExtensions = []string{".pack", ".idx", ".keep", ".bitmap", ".promisor", ".rev", ".mtimes"}
+
+func CountObjects(garbage func(file, reason string)) (*ObjectCounts, error) {
+	// Count loose and packed objects and the space they use. Files in the
+	// object directory that aren't objects or parts of a pack are counted as
+	// garbage and, if `garbage` is set, passed to it with the reason.
+	counts := &ObjectCounts{}
+	addGarbage := func(file string, info os.FileInfo, reason string) {
+		counts.Garbage++
+		counts.SizeGarbage += info.Size()
+		if garbage != nil {
+			garbage(file, reason)
+		}
+	}
+
+	packs := gitobj.NewPackStore(packDir())
+	dirs, err := os.ReadDir(gitobj.GitObjectDir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("could not read object directory: %w", err)
+	}
+	for _, dir := range dirs {
+		if !dir.IsDir() || len(dir.Name()) != 2 || !isHex(dir.Name()) {
+			continue
+		}
+		files, err := os.ReadDir(path.Join(gitobj.GitObjectDir, dir.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("could not read object directory: %w", err)
+		}
+		for _, file := range files {
+			info, err := file.Info()
+			if err != nil {
+				continue
+			}
+			hash := dir.Name() + file.Name()
+			if !gitobj.IsHash(hash) {
+				addGarbage(path.Join(gitobj.GitObjectDir, dir.Name(), file.Name()), info, "garbage found")
+				continue
+			}
+			counts.Count++
+			counts.Size += diskUsage(info)
+			if packs.Has(hash) {
+				counts.PrunePackable++
+			}
+		}
+	}
+
+	files, err := os.ReadDir(packDir())
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("could not read pack directory: %w", err)
+	}
+	type packFiles struct {
+		names           []string
+		hasPack, hasIdx bool
+	}
+	groups := make(map[string]*packFiles)
+	var groupNames []string
+	for _, file := range files {
+		name := file.Name()
+		info, err := file.Info()
+		if err != nil || file.IsDir() || name == "multi-pack-index" {
+			continue
+		}
+		ext := path.Ext(name)
+		if !strings.HasPrefix(name, "pack-") || !slices.Contains(packFileExtensions, ext) {
+			addGarbage(path.Join(packDir(), name), info, "garbage found")
+			continue
+		}
+		base := strings.TrimSuffix(name, ext)
+		group, ok := groups[base]
+		if !ok {
+			group = &packFiles{}
+			groups[base] = group
+			groupNames = append(groupNames, base)
+		}
+		group.names = append(group.names, name)
+		group.hasPack = group.hasPack || ext == ".pack"
+		group.hasIdx = group.hasIdx || ext == ".idx"
+	}
+	for _, base := range groupNames {
+		group := groups[base]
+		if group.hasPack && group.hasIdx {
+			objects, err := gitobj.PackObjectCount(path.Join(packDir(), base+".pack"))
+			if err != nil {
+				return nil, err
+			}
+			counts.Packs++
+			counts.InPack += objects
+			for _, ext := range []string{".pack", ".idx"} {
+				if info, err := os.Stat(path.Join(packDir(), base+ext)); err == nil {
+					counts.SizePack += info.Size()
+				}
+			}
+			continue
+		}
+		reason := "no corresponding .idx or .pack"
+		if group.hasPack {
+			reason = "no corresponding .idx"
+		} else if group.hasIdx {
+			reason = "no corresponding .pack"
+		}
+		for _, name := range group.names {
+			if info, err := os.Stat(path.Join(packDir(), name)); err == nil {
+				addGarbage(path.Join(packDir(), name), info, reason)
+			}
+		}
+	}
+	return counts, nil
+}
+
+func isHex(s string) bool {
+	return strings.Trim(s, "0123456789abcdef") == ""
+}
@@ -0,0 +1,15 @@
+package gc
+
+import (
+	"os"
+	"syscall"
+)
+
+func diskUsage(info os.FileInfo) int64 {
+	// Return the space a file takes up on disk, which Git reports for loose
+	// objects rather than their length.
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return stat.Blocks * 512
+	}
+	return info.Size()
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package gc
+
+import "os"
+
+func diskUsage(info os.FileInfo) int64 {
+	// Return the space a file takes up on disk, which Git reports for loose
+	// objects rather than their length.
+	return info.Size()
+}
@@ -0,0 +1,191 @@
+package gc
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tsoud/GoTGit.git/fsck"
+	"github.com/tsoud/GoTGit.git/gitobj"
+)
+
+// Git's defaults for `gc.auto`, `gc.autoPackLimit` and `gc.pruneExpire`.
+const (
+	DefaultAutoLimit     = 6700
+	DefaultAutoPackLimit = 50
+	DefaultPruneExpire   = "2.weeks.ago"
+)
+
+func packDir() string {
+	return path.Join(gitobj.GitObjectDir, "pack")
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+func unreachableObjects() (map[string]string, error) {
+	// Return the type of each object that can't be reached from refs, reflogs
+	// or the index. Objects are only ever deleted once the check finds that
+	// nothing reachable is missing.
+	result, err := fsck.Check(&fsck.Options{ConnectivityOnly: true, Reflogs: true})
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Missing) > 0 {
+		missing := result.Missing[0]
+		return nil, fmt.Errorf("reachable %s %s is missing; run fsck before collecting garbage",
+			missing.Type, missing.Hash)
+	}
+	unreachable := make(map[string]string, len(result.Unreachable))
+	for _, object := range result.Unreachable {
+		unreachable[object.Hash] = object.Type
+	}
+	return unreachable, nil
+}
+
+func PrunePacked(dryRun bool, removed func(hash string)) error {
+	// Remove loose objects that are also in a pack, as `git prune-packed` does.
+	loose := gitobj.NewLooseStore(gitobj.GitObjectDir)
+	packs := gitobj.NewPackStore(packDir())
+	var packed []string
+	err := loose.Iterate(func(hash string) error {
+		if packs.Has(hash) {
+			packed = append(packed, hash)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, hash := range packed {
+		if removed != nil {
+			removed(hash)
+		}
+		if dryRun {
+			continue
+		}
+		if err := removeLoose(loose, hash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func removeLoose(loose *gitobj.LooseStore, hash string) error {
+	// Delete a loose object, and its fan-out directory if that is left empty.
+	file := loose.ObjectPath(hash)
+	if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("could not remove object %s: %w", hash, err)
+	}
+	os.Remove(path.Dir(file))
+	return nil
+}
+
+func TooManyLooseObjects(limit int) (bool, error) {
+	// Estimate whether there are more than `limit` loose objects the way Git
+	// does, from the number in one fan-out directory. A limit of 0 or less
+	// turns the check off.
+	if limit <= 0 {
+		return false, nil
+	}
+	entries, err := os.ReadDir(path.Join(gitobj.GitObjectDir, "17"))
+	if err != nil && !os.IsNotExist(err) {
+		return false, fmt.Errorf("could not count loose objects: %w", err)
+	}
+	count := 0
+	for _, entry := range entries {
+		if len(entry.Name()) == gitobj.ObjectFormat.HexSize()-2 {
+			count++
+		}
+	}
+	return count > (limit+255)/256, nil
+}
+
+func TooManyPacks(limit int) (bool, error) {
+	// Report whether there are more than `limit` packs without a `.keep` file.
+	// A limit of 0 or less turns the check off.
+	if limit <= 0 {
+		return false, nil
+	}
+	packs, err := gitobj.NewPackStore(packDir()).Packs()
+	if err != nil {
+		return false, err
+	}
+	count := 0
+	for _, pack := range packs {
+		if !isKept(pack) {
+			count++
+		}
+	}
+	return count > limit, nil
+}
+
+func isKept(pack string) bool {
+	// Packs with a `.keep` file are never repacked or deleted.
+	_, err := os.Stat(strings.TrimSuffix(pack, ".pack") + ".keep")
+	return err == nil
+}
+
+// Lengths of the units in relative dates. Months and years are approximate,
+// as in Git.
+var dateUnits = map[string]time.Duration{
+	"second": time.Second,
+	"minute": time.Minute,
+	"hour":   time.Hour,
+	"day":    24 * time.Hour,
+	"week":   7 * 24 * time.Hour,
+	"month":  30 * 24 * time.Hour,
+	"year":   365 * 24 * time.Hour,
+}
+
+func ParseExpiry(value string, now time.Time) (time.Time, error) {
+	// Parse an expiry date such as "2.weeks.ago", "now", "never" or
+	// "2024-01-31". Objects older than the result may be removed; "never"
+	// gives the zero time, which nothing is older than.
+	value = strings.TrimSpace(value)
+	switch strings.ToLower(value) {
+	case "never", "false":
+		return time.Time{}, nil
+	case "now", "all":
+		return now, nil
+	}
+	if seconds, found := strings.CutPrefix(value, "@"); found {
+		if n, err := strconv.ParseInt(seconds, 10, 64); err == nil {
+			return time.Unix(n, 0), nil
+		}
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02"} {
+		if date, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return date, nil
+		}
+	}
+
+	// Relative dates are pairs of counts and units, e.g. "1.day.12.hours.ago".
+	fields := strings.FieldsFunc(strings.ToLower(value), func(r rune) bool { return r == '.' || r == ' ' })
+	if len(fields) > 0 && fields[len(fields)-1] == "ago" {
+		fields = fields[:len(fields)-1]
+	}
+	if len(fields) == 0 || len(fields)%2 != 0 {
+		return time.Time{}, fmt.Errorf("invalid expiry date '%s'", value)
+	}
+	date := now
+	for i := 0; i < len(fields); i += 2 {
+		n, err := strconv.Atoi(fields[i])
+		unit, ok := dateUnits[strings.TrimSuffix(fields[i+1], "s")]
+		if err != nil || !ok {
+			return time.Time{}, fmt.Errorf("invalid expiry date '%s'", value)
+		}
+		date = date.Add(-time.Duration(n) * unit)
+	}
+	return date, nil
+}
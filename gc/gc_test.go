@@ -0,0 +1,233 @@
+package gc
+
+import (
+	"encoding/hex"
+	"os"
+	"path"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/tsoud/GoTGit.git/gitobj"
+	"github.com/tsoud/GoTGit.git/internal/testutil"
+	"github.com/tsoud/GoTGit.git/refs"
+)
+
+const testSignature = "Test <test@example.com> 1700000000 +0000"
+
+func writeObject(t *testing.T, objType, body string, modTime time.Time) string {
+	// Store an object whose loose file was last modified at `modTime`.
+	t.Helper()
+	hash := testutil.WriteObject(t, objType, body)
+	file := gitobj.NewLooseStore(gitobj.GitObjectDir).ObjectPath(hash)
+	if err := os.Chtimes(file, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+	return hash
+}
+
+func writeCommit(t *testing.T, message, blob string, modTime time.Time) string {
+	// Write a commit of a tree holding one file.
+	t.Helper()
+	binHash, _ := hex.DecodeString(blob)
+	tree := writeObject(t, "tree", "100644 file\x00"+string(binHash), modTime)
+	body := "tree " + tree + "\nauthor " + testSignature + "\ncommitter " + testSignature +
+		"\n\n" + message + "\n"
+	return writeObject(t, "commit", body, modTime)
+}
+
+func looseObjects(t *testing.T) []string {
+	t.Helper()
+	var hashes []string
+	err := gitobj.NewLooseStore(gitobj.GitObjectDir).Iterate(func(hash string) error {
+		hashes = append(hashes, hash)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(hashes)
+	return hashes
+}
+
+func TestPrune(t *testing.T) {
+	testutil.InitRepo(t)
+	old := time.Now().Add(-30 * 24 * time.Hour)
+
+	kept := writeCommit(t, "kept", writeObject(t, "blob", "kept\n", old), old)
+	if err := refs.Update("refs/heads/main", kept, "test"); err != nil {
+		t.Fatal(err)
+	}
+	oldBlob := writeObject(t, "blob", "old\n", old)
+	// A recent commit protects its old blob.
+	sharedBlob := writeObject(t, "blob", "shared\n", old)
+	recent := writeCommit(t, "recent", sharedBlob, time.Now())
+
+	var pruned []string
+	expire, err := ParseExpiry("2.weeks.ago", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := looseObjects(t)
+	err = Prune(&PruneOptions{Expire: expire, DryRun: true, Pruned: func(hash, objType string) {
+		pruned = append(pruned, hash+" "+objType)
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{oldBlob + " blob"}; !slices.Equal(pruned, want) {
+		t.Errorf("wanted %v to be pruned, got %v", want, pruned)
+	}
+	if after := looseObjects(t); !slices.Equal(after, before) {
+		t.Errorf("wanted a dry run to keep every object, got %v", after)
+	}
+
+	if err := Prune(&PruneOptions{Expire: expire}); err != nil {
+		t.Fatal(err)
+	}
+	if gitobj.ObjectExists(oldBlob) {
+		t.Errorf("wanted %s to be pruned", oldBlob)
+	}
+	for _, hash := range []string{kept, recent, sharedBlob} {
+		if !gitobj.ObjectExists(hash) {
+			t.Errorf("wanted %s to be kept", hash)
+		}
+	}
+
+	// Nothing is pruned when objects never expire.
+	if err := Prune(&PruneOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if !gitobj.ObjectExists(recent) {
+		t.Errorf("wanted %s to be kept", recent)
+	}
+}
+
+func TestRepack(t *testing.T) {
+	testutil.InitRepo(t)
+	now := time.Now()
+
+	first := writeCommit(t, "first", writeObject(t, "blob", "first\n", now), now)
+	if err := refs.Update("refs/heads/main", first, "test"); err != nil {
+		t.Fatal(err)
+	}
+	lost := writeObject(t, "blob", "lost\n", now)
+
+	written, err := Repack(&RepackOptions{All: true, Delete: true,
+		Pack: gitobj.PackOptions{Window: gitobj.DefaultPackWindow, Depth: gitobj.DefaultPackDepth}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if written == nil || written.Objects != 3 {
+		t.Fatalf("wanted a pack of 3 objects, got %+v", written)
+	}
+	if err := gitobj.VerifyPack(written.Path); err != nil {
+		t.Error(err)
+	}
+	if want := []string{lost}; !slices.Equal(looseObjects(t), want) {
+		t.Errorf("wanted only %v to stay loose, got %v", want, looseObjects(t))
+	}
+	if _, err := gitobj.ReadCommit(first); err != nil {
+		t.Errorf("could not read packed commit: %v", err)
+	}
+
+	// Nothing new to pack.
+	written, err = Repack(&RepackOptions{Delete: true})
+	if err != nil || written != nil {
+		t.Errorf("wanted no new pack, got %+v (%v)", written, err)
+	}
+
+	// Moving the branch leaves the first commit only in the reflog; once the
+	// reflog is gone, `-A` makes its objects loose again.
+	second := writeCommit(t, "second", writeObject(t, "blob", "second\n", now), now)
+	if err := refs.Update("refs/heads/main", second, "test"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.RemoveAll(gitobj.GitDir + "/logs"); err != nil {
+		t.Fatal(err)
+	}
+	written, err = Repack(&RepackOptions{LoosenUnreachable: true, Delete: true,
+		Pack: gitobj.PackOptions{Window: gitobj.DefaultPackWindow, Depth: gitobj.DefaultPackDepth}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if written == nil || written.Objects != 3 {
+		t.Fatalf("wanted a pack of 3 objects, got %+v", written)
+	}
+	packs, err := gitobj.NewPackStore(packDir()).Packs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{written.Path}; !slices.Equal(packs, want) {
+		t.Errorf("wanted packs %v, got %v", want, packs)
+	}
+	if loose := looseObjects(t); len(loose) != 4 || !slices.Contains(loose, first) {
+		t.Errorf("wanted the first commit, its tree, its blob and the lost blob loose, got %v", loose)
+	}
+}
+
+func TestParseExpiry(t *testing.T) {
+	now := time.Date(2024, 3, 15, 12, 0, 0, 0, time.Local)
+	for value, want := range map[string]time.Time{
+		"never":                {},
+		"now":                  now,
+		"2.weeks.ago":          now.Add(-14 * 24 * time.Hour),
+		"1.day.12.hours.ago":   now.Add(-36 * time.Hour),
+		"3 months ago":         now.Add(-90 * 24 * time.Hour),
+		"2024-01-31":           time.Date(2024, 1, 31, 0, 0, 0, 0, time.Local),
+		"2024-01-31 08:30:00":  time.Date(2024, 1, 31, 8, 30, 0, 0, time.Local),
+		"@1700000000":          time.Unix(1700000000, 0),
+		"2024-01-31T08:30:00Z": time.Date(2024, 1, 31, 8, 30, 0, 0, time.UTC),
+	} {
+		got, err := ParseExpiry(value, now)
+		if err != nil || !got.Equal(want) {
+			t.Errorf("ParseExpiry(%q): wanted %v, got %v (%v)", value, want, got, err)
+		}
+	}
+	for _, value := range []string{"", "soon", "2.fortnights.ago", "weeks.ago"} {
+		if _, err := ParseExpiry(value, now); err == nil {
+			t.Errorf("ParseExpiry(%q): wanted an error", value)
+		}
+	}
+}
+
+func TestCountObjects(t *testing.T) {
+	testutil.InitRepo(t)
+	now := time.Now()
+
+	commit := writeCommit(t, "first", writeObject(t, "blob", "first\n", now), now)
+	if err := refs.Update("refs/heads/main", commit, "test"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Repack(&RepackOptions{All: true,
+		Pack: gitobj.PackOptions{Window: gitobj.DefaultPackWindow, Depth: gitobj.DefaultPackDepth}}); err != nil {
+		t.Fatal(err)
+	}
+	writeObject(t, "blob", "loose\n", now)
+	for _, file := range []string{"pack/junk", "pack/pack-1234.keep", "ab/tmp_obj_1"} {
+		os.MkdirAll(path.Dir(path.Join(gitobj.GitObjectDir, file)), 0755)
+		if err := os.WriteFile(path.Join(gitobj.GitObjectDir, file), []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var garbage []string
+	counts, err := CountObjects(func(file, reason string) {
+		garbage = append(garbage, reason+": "+path.Base(file))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counts.Count != 4 || counts.InPack != 3 || counts.Packs != 1 || counts.PrunePackable != 3 {
+		t.Errorf("wanted 4 loose objects, 3 of them packed in 1 pack, got %+v", counts)
+	}
+	if counts.Size == 0 || counts.SizePack == 0 || counts.SizeGarbage != 3 {
+		t.Errorf("wanted sizes for loose objects, packs and 3 bytes of garbage, got %+v", counts)
+	}
+	slices.Sort(garbage)
+	want := []string{"garbage found: junk", "garbage found: tmp_obj_1",
+		"no corresponding .idx or .pack: pack-1234.keep"}
+	if !slices.Equal(garbage, want) {
+		t.Errorf("wanted garbage %q, got %q", want, garbage)
+	}
+}
@@ -0,0 +1,160 @@
+package gc
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/tsoud/GoTGit.git/gitobj"
+)
+
+type PruneOptions struct {
+	// Only unreachable objects last modified no later than Expire are removed.
+	// The zero time removes nothing.
+	Expire time.Time
+	DryRun bool
+	// Pruned, if set, is called with each object as it is removed.
+	Pruned func(hash, objType string)
+}
+
+func Prune(opts *PruneOptions) error {
+	// Remove loose objects that can't be reached from refs, reflogs or the
+	// index, as `git prune` does. Unreachable objects newer than the expiry
+	// date are kept, along with everything they refer to, so objects being
+	// written by another command aren't lost.
+	unreachable, err := unreachableObjects()
+	if err != nil {
+		return err
+	}
+	loose := gitobj.NewLooseStore(gitobj.GitObjectDir)
+	expired := make(map[string]bool)
+	var recent []string
+	err = loose.Iterate(func(hash string) error {
+		if _, ok := unreachable[hash]; !ok {
+			return nil
+		}
+		info, err := os.Stat(loose.ObjectPath(hash))
+		if err != nil {
+			return fmt.Errorf("could not read object %s: %w", hash, err)
+		}
+		if isExpired(info.ModTime(), opts.Expire) {
+			expired[hash] = true
+		} else {
+			recent = append(recent, hash)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Keep whatever the recent objects link to.
+	for len(recent) > 0 {
+		hash := recent[len(recent)-1]
+		recent = recent[:len(recent)-1]
+		linked, err := links(hash, unreachable[hash])
+		if err != nil {
+			return err
+		}
+		for _, link := range linked {
+			if expired[link] {
+				delete(expired, link)
+				recent = append(recent, link)
+			}
+		}
+	}
+
+	for _, hash := range sortedKeys(expired) {
+		if opts.Pruned != nil {
+			opts.Pruned(hash, unreachable[hash])
+		}
+		if opts.DryRun {
+			continue
+		}
+		if err := removeLoose(loose, hash); err != nil {
+			return err
+		}
+	}
+	if opts.DryRun {
+		return nil
+	}
+	if err := removeTempFiles(opts.Expire); err != nil {
+		return err
+	}
+	return PrunePacked(false, nil)
+}
+
+func isExpired(modTime, expire time.Time) bool {
+	return !expire.IsZero() && !modTime.After(expire)
+}
+
+func links(hash, objType string) ([]string, error) {
+	// Return the hashes of the objects a tree, commit or tag refers to. Tree
+	// entries for submodule commits are left out, since those objects belong
+	// to another repository.
+	if objType == "blob" {
+		return nil, nil
+	}
+	object, err := gitobj.Store.Read(hash)
+	if err != nil {
+		return nil, err
+	}
+	var linked []string
+	switch objType {
+	case "tree":
+		entries, err := gitobj.ParseTree(object.Body())
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if entry.Type != "commit" {
+				linked = append(linked, entry.Hash)
+			}
+		}
+	case "commit":
+		commit, err := gitobj.ParseCommit(hash, object.Body())
+		if err != nil {
+			return nil, err
+		}
+		linked = append(linked, commit.Tree)
+		linked = append(linked, commit.Parents...)
+	case "tag":
+		tag, err := gitobj.ParseTag(hash, object.Body())
+		if err != nil {
+			return nil, err
+		}
+		linked = append(linked, tag.Object)
+	}
+	return linked, nil
+}
+
+func removeTempFiles(expire time.Time) error {
+	// Remove temporary files left in the object directory by interrupted
+	// writes once they are older than the expiry date.
+	err := filepath.WalkDir(gitobj.GitObjectDir, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if entry.IsDir() || !strings.HasPrefix(entry.Name(), "tmp_") {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil
+		}
+		if isExpired(info.ModTime(), expire) {
+			return os.Remove(file)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("could not remove temporary files: %w", err)
+	}
+	return nil
+}
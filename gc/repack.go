@@ -0,0 +1,146 @@
+package gc
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/tsoud/GoTGit.git/gitobj"
+)
+
+type RepackOptions struct {
+	// All packs reachable objects from existing packs too, not just loose
+	// ones, as with `-a`.
+	All bool
+	// LoosenUnreachable is `-A`: like All, but with Delete, unreachable objects
+	// in the old packs are written out as loose objects so Prune can expire
+	// them. Those in packs older than UnpackExpire are dropped instead.
+	LoosenUnreachable bool
+	UnpackExpire      time.Time
+	// Delete removes the packs and loose objects made redundant by the new
+	// pack, as with `-d`.
+	Delete bool
+	Pack   gitobj.PackOptions
+}
+
+func Repack(opts *RepackOptions) (*gitobj.WrittenPack, error) {
+	// Pack the reachable objects of the repository into a new pack, as
+	// `git repack` does. If there is nothing to pack, no pack is written and
+	// the result is nil.
+	unreachable, err := unreachableObjects()
+	if err != nil {
+		return nil, err
+	}
+	packs := gitobj.NewPackStore(packDir())
+	oldPacks, err := packs.Packs()
+	if err != nil {
+		return nil, err
+	}
+	all := opts.All || opts.LoosenUnreachable
+
+	var hashes []string
+	add := func(hash string) error {
+		if _, ok := unreachable[hash]; !ok {
+			hashes = append(hashes, hash)
+		}
+		return nil
+	}
+	// Loose objects that are already packed are left for prune-packed.
+	err = gitobj.NewLooseStore(gitobj.GitObjectDir).Iterate(func(hash string) error {
+		if packs.Has(hash) {
+			return nil
+		}
+		return add(hash)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if all {
+		err = packs.Iterate(func(hash string) error {
+			if pack, ok := packs.PackOf(hash); ok && isKept(pack) {
+				return nil
+			}
+			return add(hash)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(hashes) == 0 {
+		return nil, nil
+	}
+
+	written, err := gitobj.WritePack(packDir(), hashes, &opts.Pack)
+	if err != nil {
+		return nil, err
+	}
+	if !opts.Delete {
+		return written, nil
+	}
+	if all {
+		var redundant []string
+		for _, pack := range oldPacks {
+			if pack != written.Path && !isKept(pack) {
+				redundant = append(redundant, pack)
+			}
+		}
+		if opts.LoosenUnreachable {
+			if err := loosenUnreachable(packs, redundant, unreachable, opts.UnpackExpire); err != nil {
+				return nil, err
+			}
+		}
+		for _, pack := range redundant {
+			if err := removePack(pack); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return written, PrunePacked(false, nil)
+}
+
+func loosenUnreachable(packs *gitobj.PackStore, redundant []string, unreachable map[string]string, expire time.Time) error {
+	// Write the unreachable objects of packs about to be removed as loose
+	// objects, dated like their pack so they expire when it would have.
+	loose := gitobj.NewLooseStore(gitobj.GitObjectDir)
+	modTimes := make(map[string]time.Time, len(redundant))
+	for _, pack := range redundant {
+		info, err := os.Stat(pack)
+		if err != nil {
+			return fmt.Errorf("could not read pack %s: %w", pack, err)
+		}
+		modTimes[pack] = info.ModTime()
+	}
+	for _, hash := range sortedKeys(unreachable) {
+		pack, ok := packs.PackOf(hash)
+		if !ok {
+			continue
+		}
+		modTime, ok := modTimes[pack]
+		if !ok || isExpired(modTime, expire) || loose.Has(hash) {
+			continue
+		}
+		object, err := packs.Read(hash)
+		if err != nil {
+			return err
+		}
+		if err := loose.Write(object); err != nil {
+			return err
+		}
+		if err := os.Chtimes(loose.ObjectPath(hash), modTime, modTime); err != nil {
+			return fmt.Errorf("could not set time of object %s: %w", hash, err)
+		}
+	}
+	return nil
+}
+
+func removePack(pack string) error {
+	// Remove a pack along with its index.
+	base := strings.TrimSuffix(pack, ".pack")
+	for _, file := range []string{base + ".idx", pack} {
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("could not remove pack: %w", err)
+		}
+	}
+	return nil
+}
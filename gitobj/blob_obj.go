@@ -1,10 +1,8 @@
 package gitobj
 
 import (
-	"crypto/sha1"
 	"fmt"
 	"io"
-	"log"
 	"os"
 	"strings"
 )
@@ -14,14 +12,14 @@ func HashBlob(file string) (*GitObject, error) {
 	blobObj := &GitObject{}
 	f, err := os.Open(file)
 	if err != nil {
-		log.Fatalf("Could not open file: %s\n", err)
+		return nil, fmt.Errorf("could not open file: %w", err)
 	}
 	defer f.Close()
 
 	// Read the file size and create the header.
 	info, err := f.Stat()
 	if err != nil {
-		return nil, fmt.Errorf("could not create header - error getting file information: %s", err)
+		return nil, fmt.Errorf("could not create header - error getting file information: %w", err)
 	}
 
 	// Process blob information:
@@ -35,10 +33,13 @@ func HashBlob(file string) (*GitObject, error) {
 	store := io.MultiReader(strings.NewReader(header), f)
 	blobObj.Content, err = io.ReadAll(store)
 	if err != nil {
-		return nil, fmt.Errorf("error reading contents of %s: %s", file, err)
+		return nil, fmt.Errorf("error reading contents of %s: %w", file, err)
 	}
 
-	blobObj.Hash = fmt.Sprintf("%x", sha1.Sum(blobObj.Content))
+	blobObj.Hash, err = ObjectFormat.Sum(blobObj.Content)
+	if err != nil {
+		return nil, fmt.Errorf("error hashing %s: %w", file, err)
+	}
 
 	return blobObj, nil
 }
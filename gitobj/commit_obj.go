@@ -0,0 +1,179 @@
+package gitobj
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Signature struct {
+	Name  string
+	Email string
+	When  time.Time
+}
+
+type Commit struct {
+	Hash      string
+	Tree      string
+	Parents   []string
+	Author    Signature
+	Committer Signature
+	// Headers Git may add that are kept as-is, e.g. `encoding` or `gpgsig`.
+	ExtraHeaders []string
+	Message      string
+}
+
+func (sig Signature) String() string {
+	// Format a signature the way it appears in commit and tag headers.
+	return fmt.Sprintf("%s <%s> %d %s", sig.Name, sig.Email, sig.When.Unix(), sig.When.Format("-0700"))
+}
+
+func ParseSignature(line string) (Signature, error) {
+	// Parse a "Name <email> <unix time> <+hhmm>" signature.
+	emailStart := strings.IndexByte(line, '<')
+	emailEnd := strings.LastIndexByte(line, '>')
+	if emailStart == -1 || emailEnd < emailStart {
+		return Signature{}, fmt.Errorf("malformed signature: \"%s\"", line)
+	}
+	sig := Signature{
+		Name:  strings.TrimSpace(line[:emailStart]),
+		Email: line[emailStart+1 : emailEnd],
+	}
+
+	fields := strings.Fields(line[emailEnd+1:])
+	if len(fields) < 2 {
+		return Signature{}, fmt.Errorf("missing timestamp in signature: \"%s\"", line)
+	}
+	seconds, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return Signature{}, fmt.Errorf("invalid timestamp in signature: \"%s\"", line)
+	}
+	zone, err := time.Parse("-0700", fields[1])
+	if err != nil {
+		return Signature{}, fmt.Errorf("invalid time zone in signature: \"%s\"", line)
+	}
+	sig.When = time.Unix(seconds, 0).In(zone.Location())
+
+	return sig, nil
+}
+
+func ParseCommit(hash string, body []byte) (*Commit, error) {
+	// Parse the body of a commit object into its headers and message.
+	commit := &Commit{Hash: hash}
+	headers, message, _ := bytes.Cut(body, []byte("\n\n"))
+	commit.Message = string(message)
+
+	lines := strings.Split(string(headers), "\n")
+	for i := 0; i < len(lines); i++ {
+		key, value, _ := strings.Cut(lines[i], " ")
+		var err error
+		switch key {
+		case "tree":
+			commit.Tree = value
+		case "parent":
+			commit.Parents = append(commit.Parents, value)
+		case "author":
+			commit.Author, err = ParseSignature(value)
+		case "committer":
+			commit.Committer, err = ParseSignature(value)
+		default:
+			// Multi-line headers continue on lines starting with a space.
+			header := lines[i]
+			for i+1 < len(lines) && strings.HasPrefix(lines[i+1], " ") {
+				i++
+				header += "\n" + lines[i]
+			}
+			commit.ExtraHeaders = append(commit.ExtraHeaders, header)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("commit %s: %w", hash, err)
+		}
+	}
+
+	if commit.Tree == "" {
+		return nil, fmt.Errorf("commit %s has no tree", hash)
+	}
+	return commit, nil
+}
+
+func ReadCommit(commitHash string) (*Commit, error) {
+	// Read and parse the commit object identified by `commitHash`.
+	obj, err := ReadGitObj(commitHash)
+	if err != nil {
+		return nil, err
+	}
+	if obj.Type != "commit" {
+		return nil, fmt.Errorf("%s is a %s, not a commit", commitHash, obj.Type)
+	}
+
+	return ParseCommit(commitHash, obj.Content)
+}
+
+func (commit *Commit) Subject() string {
+	// Return the first paragraph of the commit message joined into one line.
+	paragraph, _, _ := strings.Cut(strings.TrimLeft(commit.Message, "\n"), "\n\n")
+	return strings.Join(strings.Fields(paragraph), " ")
+}
+
+func (commit *Commit) Body() []byte {
+	// Serialize the commit into the body of a commit object.
+	var body strings.Builder
+	fmt.Fprintf(&body, "tree %s\n", commit.Tree)
+	for _, parent := range commit.Parents {
+		fmt.Fprintf(&body, "parent %s\n", parent)
+	}
+	fmt.Fprintf(&body, "author %s\n", commit.Author)
+	fmt.Fprintf(&body, "committer %s\n", commit.Committer)
+	for _, header := range commit.ExtraHeaders {
+		fmt.Fprintf(&body, "%s\n", header)
+	}
+	fmt.Fprintf(&body, "\n%s", commit.Message)
+
+	return []byte(body.String())
+}
+
+func HashCommit(commit *Commit) (*GitObject, error) {
+	// Create a commit object and record its hash on `commit`.
+	commitObj, err := HashObject("commit", commit.Body())
+	if err != nil {
+		return nil, err
+	}
+	commit.Hash = commitObj.Hash
+
+	return commitObj, nil
+}
+
+func Ancestors(commitHash string) (map[string]bool, error) {
+	// Collect every commit reachable from `commitHash`, including itself.
+	seen := make(map[string]bool)
+	queue := []string{commitHash}
+	for len(queue) > 0 {
+		hash := queue[0]
+		queue = queue[1:]
+		if seen[hash] {
+			continue
+		}
+		seen[hash] = true
+
+		commit, err := ReadCommit(hash)
+		if err != nil {
+			return nil, err
+		}
+		queue = append(queue, commit.Parents...)
+	}
+	return seen, nil
+}
+
+func IsAncestor(ancestor, descendant string) (bool, error) {
+	// Report whether `ancestor` is reachable from `descendant` (or is the same commit).
+	if ancestor == descendant {
+		return true, nil
+	}
+	reachable, err := Ancestors(descendant)
+	if err != nil {
+		return false, err
+	}
+	return reachable[ancestor], nil
+}
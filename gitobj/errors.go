@@ -0,0 +1,35 @@
+package gitobj
+
+import "errors"
+
+var (
+	ErrObjectNotFound  = errors.New("object not found")
+	ErrCorruptObject   = errors.New("corrupt object")
+	ErrInvalidHeader   = errors.New("invalid object header")
+	ErrAmbiguousObject = errors.New("ambiguous object name")
+	ErrHashCollision   = errors.New("SHA-1 collision attack detected")
+)
+
+// ObjectError reports a problem finding or reading the object called `Name`, a
+// full or abbreviated hash. It matches its `Kind`, one of the errors above, and
+// the underlying error `Err` (if any) with errors.Is.
+type ObjectError struct {
+	Name    string
+	Kind    error
+	Message string
+	Err     error
+}
+
+func (e *ObjectError) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *ObjectError) Unwrap() []error {
+	if e.Err != nil {
+		return []error{e.Kind, e.Err}
+	}
+	return []error{e.Kind}
+}
@@ -1,19 +1,21 @@
 package gitobj
 
 import (
-	"bufio"
-	"bytes"
-	"compress/zlib"
-	"encoding/hex"
 	"fmt"
 	"io"
-	"os"
-	"path"
 	"strconv"
 	"strings"
 )
 
-const GitObjectDir = ".gotgit_test/objects"
+// DefaultGitDir is the name of the git directory at the top of a working tree.
+const DefaultGitDir = ".git"
+
+// GitDir is the repository's git directory and GitObjectDir its object
+// database. Use SetGitDir to point them somewhere else.
+var (
+	GitDir       = DefaultGitDir
+	GitObjectDir = GitDir + "/objects"
+)
 
 type GitObject struct {
 	Hash    string
@@ -47,152 +49,138 @@ func typeIsValid(objType string) bool {
 	return false
 }
 
-func ReadGitObj(objectHash string) (*GitObject, error) {
-	// Read the object type and contents from a given hash.
-	fullPath := path.Join(GitObjectDir, objectHash[:2], objectHash[2:])
-
-	src, err := os.Open(fullPath)
-	if err != nil {
-		return nil, fmt.Errorf("could not open object %s: %s", objectHash, err)
+func HashObject(objType string, body []byte) (*GitObject, error) {
+	// Create an object of any valid type from its body (the content after the header).
+	if !typeIsValid(objType) {
+		return nil, fmt.Errorf("invalid object type \"%s\"", objType)
 	}
-	defer src.Close()
 
-	contents, err := zlib.NewReader(src)
+	header := fmt.Sprintf("%s %d\u0000", objType, len(body))
+	content := append([]byte(header), body...)
+	hash, err := ObjectFormat.Sum(content)
 	if err != nil {
-		src.Close()
-		return nil, fmt.Errorf("error decompressing %s: %s", objectHash, err)
+		return nil, err
 	}
-	defer contents.Close()
 
-	contentBuffer := bufio.NewReader(contents)
+	return &GitObject{
+		Hash:    hash,
+		Type:    objType,
+		Size:    len(body),
+		Content: content,
+	}, nil
+}
 
-	// Read the object header. Note that properly formatted objects must contain
-	// a null byte between the header and body.
-	headerBytes, err := contentBuffer.ReadBytes(0)
-	if err != nil && err != io.EOF {
-		return nil, fmt.Errorf("error reading header of %s: %s", objectHash, err)
-	}
-	// Drop the null byte at the end of the header.
-	header := string(headerBytes[:len(headerBytes)-1])
-	// Object headers should have the format "<object type> <size>".
-	headerParts := strings.Split(header, " ")
-	if len(headerParts) < 2 {
-		return nil, fmt.Errorf("malformed header: \"%s\"", header)
+func ObjectExists(objectHash string) bool {
+	return Store.Has(objectHash)
+}
+
+func isHex(s string) bool {
+	for _, c := range s {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+			return false
+		}
 	}
-	if !typeIsValid(headerParts[0]) {
-		return nil, fmt.Errorf("invalid type \"%s\" found for object %s", headerParts[0], objectHash)
+	return true
+}
+
+func ExpandHash(prefix string) (string, error) {
+	// Find the single object whose hash starts with an abbreviated `prefix`.
+	prefix = strings.ToLower(prefix)
+	if len(prefix) < 4 || len(prefix) > ObjectFormat.HexSize() {
+		return "", notFoundError(prefix)
 	}
-	objType := headerParts[0]
-	objSize, err := strconv.Atoi(headerParts[1])
-	if err != nil {
-		return nil, fmt.Errorf("could not convert object size %v: %s", headerParts[1], err)
+	if !isHex(prefix) {
+		return "", notFoundError(prefix)
 	}
 
-	// Read the object contents after validating header.
-	objContent, err := io.ReadAll(contentBuffer)
+	matches, err := matchPrefix(Store, prefix)
 	if err != nil {
-		return nil, fmt.Errorf("could not read contents of %s: %s", objectHash, err)
+		return "", err
 	}
 
-	return &GitObject{
-		Hash:    objectHash,
-		Type:    objType,
-		Size:    objSize,
-		Content: objContent,
-	}, nil
+	switch len(matches) {
+	case 0:
+		return "", notFoundError(prefix)
+	case 1:
+		return matches[0], nil
+	default:
+		return "", &ObjectError{Name: prefix, Kind: ErrAmbiguousObject,
+			Message: fmt.Sprintf("short object ID %s is ambiguous", prefix)}
+	}
 }
 
-func PrintBlob(gitobj *GitObject) error {
-	contentReader := bytes.NewReader(gitobj.Content)
+func MatchHashes(prefix string) ([]string, error) {
+	// Return the hashes of all the objects in Store starting with `prefix`, in
+	// no particular order.
+	prefix = strings.ToLower(prefix)
+	if !isHex(prefix) {
+		return nil, nil
+	}
+	return matchPrefix(Store, prefix)
+}
 
-	io.Copy(os.Stdout, contentReader)
-	return nil
+func notFoundError(name string) error {
+	return &ObjectError{Name: name, Kind: ErrObjectNotFound,
+		Message: fmt.Sprintf("not a valid object name %s", name)}
 }
 
-func PrintTree(gitobj *GitObject, outputType string) error {
-	if gitobj.Type != "tree" {
-		return fmt.Errorf("%s is not a tree object", gitobj.Hash)
-	}
+func corruptError(objectHash, action string, err error) error {
+	return &ObjectError{Name: objectHash, Kind: ErrCorruptObject,
+		Message: fmt.Sprintf("%s %s", action, objectHash), Err: err}
+}
 
-	contentReader := bytes.NewReader(gitobj.Content)
-	treeBuf := new(bytes.Buffer)
-	if _, err := io.Copy(treeBuf, contentReader); err != nil {
-		return fmt.Errorf("could not read tree contents: %s", err)
-	}
+func headerError(objectHash, format string, args ...any) error {
+	return &ObjectError{Name: objectHash, Kind: ErrInvalidHeader, Message: fmt.Sprintf(format, args...)}
+}
 
-	var output strings.Builder
+func ReadGitObj(objectHash string) (*GitObject, error) {
+	// Read the object type and contents from a given hash.
+	return Store.Read(objectHash)
+}
 
-	for treeBuf.Len() > 0 {
-		mode, err := treeBuf.ReadString(' ')
-		if err != nil && err != io.EOF {
-			return fmt.Errorf("unable to extract mode: %s", err)
-		}
-		// Pad mode string if leading zero is omitted by Git.
-		mode = fmt.Sprintf("%06s", mode[:len(mode)-1])
+func PrintBlob(w io.Writer, gitobj *GitObject) error {
+	// Write the contents of an object as they are stored.
+	_, err := w.Write(gitobj.Content)
+	return err
+}
 
-		objName, err := treeBuf.ReadBytes(0)
-		if err != nil {
-			return fmt.Errorf("unable to read object name: %s", err)
-		}
-		objName = objName[:len(objName)-1]
-		if outputType == "name-only" {
-			output.WriteString(fmt.Sprintf("%s\n", string(objName)))
-		}
+func PrintTree(w io.Writer, gitobj *GitObject, outputType string) error {
+	// Write the entries of a tree. Entry types come from their modes, so only the
+	// "long" format, which shows sizes, reads the objects the tree refers to.
+	entries, err := gitobj.TreeEntries()
+	if err != nil {
+		return err
+	}
 
-		sha1Hash := make([]byte, 20)
-		if _, err := treeBuf.Read(sha1Hash); err != nil {
-			return fmt.Errorf("unable to read SHA1 hash: %s", err)
-		}
+	var output strings.Builder
 
-		objHash := hex.EncodeToString(sha1Hash)
-		objInfo, err := ReadGitObj(objHash)
-		if err != nil {
-			return fmt.Errorf("%s", err)
-		}
-		if outputType == "default" {
+	for _, entry := range entries {
+		switch outputType {
+		case "name-only":
+			output.WriteString(fmt.Sprintf("%s\n", entry.Name))
+		case "default":
 			output.WriteString(fmt.Sprintf(
-				"%s %s %s\t%s\n", mode, objInfo.Type, objInfo.Hash, objName,
+				"%s %s %s\t%s\n", entry.Mode, entry.Type, entry.Hash, entry.Name,
 			))
-		}
-
-		size := strconv.Itoa(objInfo.Size)
-		if objInfo.Type == "tree" {
-			size = "-"
-		}
-		// Add extra padding for larger sizes if needed.
-		width := 7
-		if width < len(size) {
-			width = len(size)
-		}
-		if outputType == "long" || outputType == "l" {
+		case "long", "l":
+			size := "-"
+			if entry.Type == "blob" {
+				objInfo, err := ReadGitObj(entry.Hash)
+				if err != nil {
+					return err
+				}
+				size = strconv.Itoa(objInfo.Size)
+			}
 			output.WriteString(fmt.Sprintf(
-				"%s %s %s %*s\t%s\n", mode, objInfo.Type, objInfo.Hash, width, size, objName,
+				"%s %s %s %7s\t%s\n", entry.Mode, entry.Type, entry.Hash, size, entry.Name,
 			))
 		}
 	}
 
-	fmt.Print(output.String())
-	return nil
+	_, err = io.WriteString(w, output.String())
+	return err
 }
 
 func (object *GitObject) Write() error {
-	dstDirPath := path.Join(GitObjectDir, object.Hash[:2])
-	if err := os.MkdirAll(dstDirPath, 0755); err != nil {
-		return fmt.Errorf("error creating object subdirectory in .git: %s", err)
-	}
-	dstFilePath := path.Join(dstDirPath, object.Hash[2:])
-	dst, err := os.Create(dstFilePath)
-	if err != nil {
-		return fmt.Errorf("could not create object file: %s", err)
-	}
-	defer dst.Close()
-
-	compressed := zlib.NewWriter(dst)
-	defer compressed.Close()
-
-	if _, err := compressed.Write(object.Content); err != nil {
-		return fmt.Errorf("could not compress object: %s", err)
-	}
-
-	return nil
+	return Store.Write(object)
 }
@@ -2,7 +2,6 @@ package gitobj
 
 import (
 	"bytes"
-	"io"
 	"log"
 	"os"
 	"path"
@@ -19,6 +18,7 @@ type headerTestUnit struct {
 
 func TestMain(m *testing.M) {
 	os.Chdir("/home/tamer/go_projects/GoTGit")
+	SetGitDir(".gotgit_test")
 	os.Exit(m.Run())
 }
 
@@ -115,22 +115,10 @@ func TestPrintBlob(t *testing.T) {
 			t.Fatal(err)
 		}
 
-		// Capture text from stdout
-		clear := os.Stdout
-		r, w, err := os.Pipe()
-		if err != nil {
-			t.Fatal(err)
-		}
-		os.Stdout = w
-		err = PrintBlob(bObj) //bObj.PrintContent()
-		if err != nil {
+		var buf bytes.Buffer
+		if err := PrintBlob(&buf, bObj); err != nil {
 			t.Fatal(err)
 		}
-		w.Close()
-		os.Stdout = clear
-
-		var buf bytes.Buffer
-		io.Copy(&buf, r)
 		if res := buf.String(); res != blob[1] {
 			t.Errorf("Wanted:\n%q\n\nGot:\n%q", blob[1], res)
 		}
@@ -153,22 +141,10 @@ func TestPrintTreeContent(t *testing.T) {
 				t.Fatal(err)
 			}
 
-			// Capture text from stdout
-			clear := os.Stdout
-			r, w, err := os.Pipe()
-			if err != nil {
-				t.Fatal(err)
-			}
-			os.Stdout = w
-			err = PrintTree(tObj, outType)
-			if err != nil {
+			var buf bytes.Buffer
+			if err := PrintTree(&buf, tObj, outType); err != nil {
 				t.Fatal(err)
 			}
-			w.Close()
-			os.Stdout = clear
-
-			var buf bytes.Buffer
-			io.Copy(&buf, r)
 			if res := buf.String(); res != tree[1] {
 				t.Errorf("\nWanted:\n%q\nGot:\n%q\n---\n", tree[1], res)
 			}
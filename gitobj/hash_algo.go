@@ -0,0 +1,84 @@
+package gitobj
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"strings"
+
+	"github.com/pjbgf/sha1cd"
+)
+
+// HashAlgorithm names objects by hashing their header and body. A repository
+// uses one algorithm for all its objects, given by `extensions.objectFormat`.
+type HashAlgorithm struct {
+	// Name is the value of `extensions.objectFormat`, e.g. "sha256".
+	Name string
+	// Size is the length of a hash in bytes.
+	Size int
+	new  func() hash.Hash
+}
+
+// SHA1 detects inputs crafted for collision attacks, such as SHAttered, the
+// way Git's sha1dc does, so they can be refused.
+var (
+	SHA1   = &HashAlgorithm{Name: "sha1", Size: sha1cd.Size, new: sha1cd.New}
+	SHA256 = &HashAlgorithm{Name: "sha256", Size: sha256.Size, new: sha256.New}
+)
+
+// ObjectFormat is the hash algorithm of the current repository. Repositories
+// use SHA-1 unless their config says otherwise.
+var ObjectFormat = SHA1
+
+func LookupHashAlgorithm(name string) (*HashAlgorithm, error) {
+	for _, algo := range []*HashAlgorithm{SHA1, SHA256} {
+		if strings.EqualFold(name, algo.Name) {
+			return algo, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown object format \"%s\"", name)
+}
+
+func (algo *HashAlgorithm) New() hash.Hash {
+	return algo.new()
+}
+
+func (algo *HashAlgorithm) Sum(data []byte) (string, error) {
+	// Return the hash of `data` as a hex string.
+	h := algo.new()
+	h.Write(data)
+	return Checksum(h)
+}
+
+func Checksum(h hash.Hash) (string, error) {
+	// Return the hash of the data written to `h`, made by New, as a hex string.
+	// Data showing signs of a collision attack is refused with an error matching
+	// ErrHashCollision.
+	detector, ok := h.(sha1cd.CollisionResistantHash)
+	if !ok {
+		return hex.EncodeToString(h.Sum(nil)), nil
+	}
+	sum, collision := detector.CollisionResistantSum(nil)
+	hexSum := hex.EncodeToString(sum)
+	if collision {
+		return "", &ObjectError{Name: hexSum, Kind: ErrHashCollision,
+			Message: fmt.Sprintf("SHA-1 appears to be part of a collision attack: %s", hexSum)}
+	}
+	return hexSum, nil
+}
+
+func (algo *HashAlgorithm) HexSize() int {
+	return algo.Size * 2
+}
+
+func (algo *HashAlgorithm) NullHash() string {
+	// Return the all-zero hash, which stands for a missing object, e.g. the old
+	// value of a newly created ref.
+	return strings.Repeat("0", algo.HexSize())
+}
+
+func IsHash(s string) bool {
+	// Report whether `s` is a full, lower-case hash in the repository's format.
+	return len(s) == ObjectFormat.HexSize() && isHex(s)
+}
@@ -0,0 +1,72 @@
+package gitobj
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testdataDir is found before TestMain changes the working directory.
+var testdataDir, _ = filepath.Abs("testdata")
+
+func TestObjectFormat(t *testing.T) {
+	ObjectFormat = SHA256
+	t.Cleanup(func() { ObjectFormat = SHA1 })
+
+	// Hashes as given by `git hash-object` in a SHA-256 repository.
+	blob, err := HashObject("blob", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "473a0f4c3be8a93681a267e3b1e9a7dcda1185436fe141f7749120a303721813"; blob.Hash != want {
+		t.Errorf("Wanted empty blob %s, got %s", want, blob.Hash)
+	}
+	blob.Name, blob.Mode = "empty", "100644"
+	tree, err := HashTree("root", []*GitObject{blob})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "385836050393216259097506b92f0f0a246688879a5932159a604a26e5665bdf"; tree.Hash != want {
+		t.Errorf("Wanted tree %s, got %s", want, tree.Hash)
+	}
+
+	entries, err := ParseTree(tree.Body())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Hash != blob.Hash || entries[0].Name != "empty" {
+		t.Errorf("Wanted the blob entry back from the tree, got %+v", entries)
+	}
+	if !IsHash(blob.Hash) || IsHash(blob.Hash[:40]) {
+		t.Error("IsHash: wanted only 64-digit hashes to be full hashes")
+	}
+
+	// Objects are stored and found again under their 64-digit names.
+	store := NewLooseStore(t.TempDir())
+	if err := store.Write(tree); err != nil {
+		t.Fatal(err)
+	}
+	read, err := store.Read(tree.Hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read.Type != "tree" || !bytes.Equal(read.Content, tree.Body()) {
+		t.Errorf("Wanted the tree back from the store, got %s %q", read.Type, read.Content)
+	}
+}
+
+func TestCollisionDetection(t *testing.T) {
+	// One of the two colliding messages published as SHA-mbles.
+	data, err := os.ReadFile(filepath.Join(testdataDir, "sha-mbles-1.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := SHA1.Sum(data); !errors.Is(err, ErrHashCollision) {
+		t.Errorf("Wanted ErrHashCollision, got %v", err)
+	}
+	if _, err := SHA1.Sum(data[:320]); err != nil {
+		t.Errorf("Wanted no collision in half of the message, got %v", err)
+	}
+}
@@ -0,0 +1,221 @@
+package gitobj
+
+import (
+	"bufio"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// LooseStore keeps each object zlib-compressed in its own file, named by its
+// hash under a directory for the first two hex digits of the hash.
+type LooseStore struct {
+	Dir string
+}
+
+func NewLooseStore(dir string) *LooseStore {
+	return &LooseStore{Dir: dir}
+}
+
+func (store *LooseStore) ObjectPath(hash string) string {
+	return path.Join(store.Dir, hash[:2], hash[2:])
+}
+
+func (store *LooseStore) Has(hash string) bool {
+	if !IsHash(hash) {
+		return false
+	}
+	_, err := os.Stat(store.ObjectPath(hash))
+	return err == nil
+}
+
+func (store *LooseStore) Stream(hash string) (*ObjectReader, error) {
+	// Open an object file and read its header, leaving the body to be read.
+	if !IsHash(hash) {
+		return nil, notFoundError(hash)
+	}
+	src, err := os.Open(store.ObjectPath(hash))
+	if os.IsNotExist(err) {
+		return nil, notFoundError(hash)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not open object %s: %w", hash, err)
+	}
+
+	contents, err := zlib.NewReader(src)
+	if err != nil {
+		src.Close()
+		return nil, corruptError(hash, "error decompressing", err)
+	}
+	buffered := &looseObjectReader{bufio.NewReader(contents), contents, src}
+
+	objType, size, err := readHeader(hash, buffered.Reader)
+	if err != nil {
+		buffered.Close()
+		return nil, err
+	}
+	return &ObjectReader{ReadCloser: buffered, Type: objType, Size: size}, nil
+}
+
+// looseObjectReader reads the decompressed contents of an object file, closing
+// the file along with the decompressor.
+type looseObjectReader struct {
+	*bufio.Reader
+	contents io.Closer
+	file     io.Closer
+}
+
+func (reader *looseObjectReader) Close() error {
+	reader.contents.Close()
+	return reader.file.Close()
+}
+
+func readHeader(hash string, contents *bufio.Reader) (string, int, error) {
+	// Read the object header. Note that properly formatted objects must contain
+	// a null byte between the header and body.
+	headerBytes, err := contents.ReadBytes(0)
+	if err == io.EOF {
+		return "", 0, headerError(hash, "missing null byte after header of %s", hash)
+	}
+	if err != nil {
+		return "", 0, corruptError(hash, "error reading header of", err)
+	}
+	// Drop the null byte at the end of the header.
+	header := string(headerBytes[:len(headerBytes)-1])
+	// Object headers should have the format "<object type> <size>".
+	headerParts := strings.Split(header, " ")
+	if len(headerParts) != 2 {
+		return "", 0, headerError(hash, "malformed header \"%s\" in object %s", header, hash)
+	}
+	if !typeIsValid(headerParts[0]) {
+		return "", 0, headerError(hash, "invalid type \"%s\" found for object %s", headerParts[0], hash)
+	}
+	size, err := strconv.Atoi(headerParts[1])
+	if err != nil || size < 0 {
+		return "", 0, headerError(hash, "invalid size \"%s\" found for object %s", headerParts[1], hash)
+	}
+	return headerParts[0], size, nil
+}
+
+func (store *LooseStore) Read(hash string) (*GitObject, error) {
+	reader, err := store.Stream(hash)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	// Read the object contents after validating header.
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, corruptError(hash, "could not read contents of", err)
+	}
+	if len(body) != reader.Size {
+		return nil, &ObjectError{Name: hash, Kind: ErrCorruptObject, Message: fmt.Sprintf(
+			"object %s has %d bytes, but its header gives %d", hash, len(body), reader.Size)}
+	}
+
+	return &GitObject{Hash: hash, Type: reader.Type, Size: reader.Size, Content: body}, nil
+}
+
+func (store *LooseStore) Write(object *GitObject) error {
+	// Objects are written to a temporary file first, so a failed write never
+	// leaves a truncated object behind.
+	if !IsHash(object.Hash) {
+		return fmt.Errorf("invalid object hash \"%s\"", object.Hash)
+	}
+	if store.Has(object.Hash) {
+		return nil
+	}
+	dstDirPath := path.Join(store.Dir, object.Hash[:2])
+	if err := MkdirAllShared(dstDirPath); err != nil {
+		return fmt.Errorf("error creating object subdirectory in .git: %w", err)
+	}
+	dst, err := os.CreateTemp(dstDirPath, "tmp_obj_")
+	if err != nil {
+		return fmt.Errorf("could not create object file: %w", err)
+	}
+	defer os.Remove(dst.Name())
+
+	compressed := zlib.NewWriter(dst)
+	_, err = compressed.Write(object.encode())
+	if err == nil {
+		err = compressed.Close()
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("could not compress object: %w", err)
+	}
+	// Objects never change once written, so they are read-only, as in git.
+	if err := os.Chmod(dst.Name(), 0444); err != nil {
+		return fmt.Errorf("could not set permissions of object file: %w", err)
+	}
+	if err := AdjustSharedPerm(dst.Name()); err != nil {
+		return err
+	}
+
+	if err := os.Rename(dst.Name(), store.ObjectPath(object.Hash)); err != nil {
+		return fmt.Errorf("could not create object file: %w", err)
+	}
+	return nil
+}
+
+func (store *LooseStore) Iterate(fn func(hash string) error) error {
+	dirs, err := os.ReadDir(store.Dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("could not read object directory: %w", err)
+	}
+	for _, dir := range dirs {
+		if !dir.IsDir() || len(dir.Name()) != 2 || !isHex(dir.Name()) {
+			continue
+		}
+		hashes, err := store.hashesIn(dir.Name())
+		if err != nil {
+			return err
+		}
+		for _, hash := range hashes {
+			if err := fn(hash); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (store *LooseStore) hashesIn(dirName string) ([]string, error) {
+	// List the objects in one of the two-digit directories.
+	files, err := os.ReadDir(path.Join(store.Dir, dirName))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("could not read object directory: %w", err)
+	}
+	var hashes []string
+	for _, file := range files {
+		if hash := dirName + file.Name(); IsHash(hash) {
+			hashes = append(hashes, hash)
+		}
+	}
+	return hashes, nil
+}
+
+func (store *LooseStore) matchPrefix(prefix string) ([]string, error) {
+	hashes, err := store.hashesIn(prefix[:2])
+	if err != nil {
+		return nil, err
+	}
+	var matches []string
+	for _, hash := range hashes {
+		if strings.HasPrefix(hash, prefix) {
+			matches = append(matches, hash)
+		}
+	}
+	return matches, nil
+}
@@ -0,0 +1,76 @@
+package gitobj
+
+import (
+	"bytes"
+	"io"
+	"slices"
+	"sync"
+)
+
+// MemoryStore keeps objects in memory, for tests and programs that don't
+// want a repository on disk. It is safe for concurrent use.
+type MemoryStore struct {
+	mu      sync.RWMutex
+	objects map[string]*GitObject
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{objects: make(map[string]*GitObject)}
+}
+
+func (store *MemoryStore) Has(hash string) bool {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	_, ok := store.objects[hash]
+	return ok
+}
+
+func (store *MemoryStore) Read(hash string) (*GitObject, error) {
+	// Return a copy, so callers can't change the stored object.
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	object, ok := store.objects[hash]
+	if !ok {
+		return nil, notFoundError(hash)
+	}
+	return &GitObject{Hash: hash, Type: object.Type, Size: object.Size, Content: slices.Clone(object.Content)}, nil
+}
+
+func (store *MemoryStore) Stream(hash string) (*ObjectReader, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	object, ok := store.objects[hash]
+	if !ok {
+		return nil, notFoundError(hash)
+	}
+	return &ObjectReader{ReadCloser: io.NopCloser(bytes.NewReader(object.Content)),
+		Type: object.Type, Size: object.Size}, nil
+}
+
+func (store *MemoryStore) Write(object *GitObject) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if _, ok := store.objects[object.Hash]; !ok {
+		body := slices.Clone(object.Body())
+		store.objects[object.Hash] = &GitObject{Type: object.Type, Size: len(body), Content: body}
+	}
+	return nil
+}
+
+func (store *MemoryStore) Iterate(fn func(hash string) error) error {
+	// Objects are given in hash order. Those written by `fn` may not be seen.
+	store.mu.RLock()
+	hashes := make([]string, 0, len(store.objects))
+	for hash := range store.objects {
+		hashes = append(hashes, hash)
+	}
+	store.mu.RUnlock()
+
+	slices.Sort(hashes)
+	for _, hash := range hashes {
+		if err := fn(hash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
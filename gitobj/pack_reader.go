@@ -0,0 +1,398 @@
+package gitobj
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"os"
+	"path"
+	"slices"
+)
+
+// ReceivedPack is a pack read from a stream and stored with its index.
+type ReceivedPack struct {
+	// Path is the new `.pack` file, named by its checksum.
+	Path     string
+	Checksum string
+	Objects  int
+	// ThinBases counts the delta bases that were missing from the pack and
+	// were added to its end from the repository.
+	ThinBases int
+}
+
+// streamEntry is an object as it is read from a pack. Deltas hold the delta
+// in `data` until they are resolved, when `object` is set.
+type streamEntry struct {
+	offset     uint64
+	crc        uint32
+	packType   int
+	data       []byte
+	baseOffset uint64
+	baseHash   string
+	object     *GitObject
+}
+
+// packStream reads a pack sequentially, keeping the checksum of what it has
+// read, the CRC of the current entry and the offset, and copying everything
+// to `copyTo` if set.
+type packStream struct {
+	src    *bufio.Reader
+	copyTo io.Writer
+	offset uint64
+	sum    hash.Hash
+	crc    hash.Hash32
+}
+
+func (stream *packStream) consumed(p []byte) error {
+	stream.offset += uint64(len(p))
+	stream.sum.Write(p)
+	stream.crc.Write(p)
+	if stream.copyTo != nil {
+		if _, err := stream.copyTo.Write(p); err != nil {
+			return fmt.Errorf("could not write pack: %w", err)
+		}
+	}
+	return nil
+}
+
+func (stream *packStream) Read(p []byte) (int, error) {
+	n, err := stream.src.Read(p)
+	if copyErr := stream.consumed(p[:n]); copyErr != nil {
+		return n, copyErr
+	}
+	return n, err
+}
+
+func (stream *packStream) ReadByte() (byte, error) {
+	c, err := stream.src.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	return c, stream.consumed([]byte{c})
+}
+
+func readPackStream(src io.Reader, copyTo io.Writer, name string) ([]*streamEntry, string, error) {
+	// Read every entry of a pack, checking the checksum at its end. Returns the
+	// entries in the order they are stored and the checksum.
+	stream := &packStream{src: bufio.NewReader(src), copyTo: copyTo, sum: ObjectFormat.New(), crc: crc32.NewIEEE()}
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(stream, header); err != nil {
+		return nil, "", packCorruptError(name, "truncated header")
+	}
+	if string(header[:4]) != "PACK" {
+		return nil, "", packCorruptError(name, "bad signature")
+	}
+	if version := binary.BigEndian.Uint32(header[4:]); version != 2 && version != 3 {
+		return nil, "", packCorruptError(name, "unsupported version %d", version)
+	}
+
+	count := binary.BigEndian.Uint32(header[8:])
+	entries := make([]*streamEntry, 0, min(count, 1<<16))
+	for i := uint32(0); i < count; i++ {
+		entry := &streamEntry{offset: stream.offset}
+		stream.crc.Reset()
+		packType, size, err := readEntryHeader(stream)
+		if err != nil {
+			return nil, "", packCorruptError(name, "truncated entry at %d", entry.offset)
+		}
+		entry.packType = packType
+		switch packType {
+		case packCommit, packTree, packBlob, packTag:
+		case packOfsDelta:
+			distance, err := readOffsetDistance(stream)
+			if err != nil || distance == 0 || distance > entry.offset {
+				return nil, "", packCorruptError(name, "delta base offset out of range at %d", entry.offset)
+			}
+			entry.baseOffset = entry.offset - distance
+		case packRefDelta:
+			baseHash := make([]byte, ObjectFormat.Size)
+			if _, err := io.ReadFull(stream, baseHash); err != nil {
+				return nil, "", packCorruptError(name, "truncated entry at %d", entry.offset)
+			}
+			entry.baseHash = hex.EncodeToString(baseHash)
+		default:
+			return nil, "", packCorruptError(name, "unknown object type %d at %d", packType, entry.offset)
+		}
+		if entry.data, err = inflate(stream, size); err != nil {
+			return nil, "", packCorruptError(name, "could not inflate entry at %d: %s", entry.offset, err)
+		}
+		entry.crc = stream.crc.Sum32()
+		entries = append(entries, entry)
+	}
+
+	sum, err := Checksum(stream.sum)
+	if err != nil {
+		return nil, "", err
+	}
+	trailer := make([]byte, ObjectFormat.Size)
+	if _, err := io.ReadFull(stream.src, trailer); err != nil {
+		return nil, "", packCorruptError(name, "truncated checksum")
+	}
+	if hex.EncodeToString(trailer) != sum {
+		return nil, "", packCorruptError(name, "checksum mismatch")
+	}
+	if _, err := stream.src.Peek(1); err != io.EOF {
+		return nil, "", packCorruptError(name, "pack has junk at the end")
+	}
+	if copyTo != nil {
+		if _, err := copyTo.Write(trailer); err != nil {
+			return nil, "", fmt.Errorf("could not write pack: %w", err)
+		}
+	}
+	return entries, sum, nil
+}
+
+func resolveEntries(entries []*streamEntry, external func(hash string) (*GitObject, error), name string) ([]*GitObject, error) {
+	// Work out the type, contents and hash of every entry by applying deltas
+	// to their bases. Bases that aren't in the pack are looked up with
+	// `external`, if set, and returned; otherwise such deltas are an error.
+	type base struct {
+		object *GitObject
+		entry  *streamEntry
+	}
+	var queue []base
+	ofsChildren := make(map[uint64][]*streamEntry)
+	refChildren := make(map[string][]*streamEntry)
+	for _, entry := range entries {
+		switch entry.packType {
+		case packOfsDelta:
+			ofsChildren[entry.baseOffset] = append(ofsChildren[entry.baseOffset], entry)
+		case packRefDelta:
+			refChildren[entry.baseHash] = append(refChildren[entry.baseHash], entry)
+		default:
+			object, err := HashObject(packTypeNames[entry.packType], entry.data)
+			if err != nil {
+				return nil, err
+			}
+			entry.object = object
+			queue = append(queue, base{object, entry})
+		}
+	}
+
+	// Apply the deltas on each known object, then those on the results.
+	resolveQueue := func() error {
+		for len(queue) > 0 {
+			next := queue[len(queue)-1]
+			queue = queue[:len(queue)-1]
+			children := refChildren[next.object.Hash]
+			delete(refChildren, next.object.Hash)
+			if next.entry != nil {
+				children = append(children, ofsChildren[next.entry.offset]...)
+			}
+			for _, child := range children {
+				body, err := applyDelta(next.object.Body(), child.data)
+				if err != nil {
+					return packCorruptError(name, "could not apply delta at %d: %s", child.offset, err)
+				}
+				if child.object, err = HashObject(next.object.Type, body); err != nil {
+					return err
+				}
+				queue = append(queue, base{child.object, child})
+			}
+		}
+		return nil
+	}
+	if err := resolveQueue(); err != nil {
+		return nil, err
+	}
+
+	// Deltas left over may refer to objects outside the pack, or to objects in
+	// the pack that are deltas on those.
+	var externalBases []*GitObject
+	if external != nil {
+		missing := make([]string, 0, len(refChildren))
+		for baseHash := range refChildren {
+			missing = append(missing, baseHash)
+		}
+		slices.Sort(missing)
+		for _, baseHash := range missing {
+			if _, ok := refChildren[baseHash]; !ok {
+				continue
+			}
+			object, err := external(baseHash)
+			if errors.Is(err, ErrObjectNotFound) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			externalBases = append(externalBases, object)
+			queue = append(queue, base{object, nil})
+			if err := resolveQueue(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	unresolved := 0
+	for _, entry := range entries {
+		if entry.object == nil {
+			unresolved++
+		}
+	}
+	switch {
+	case unresolved == 1:
+		return nil, packCorruptError(name, "pack has 1 unresolved delta")
+	case unresolved > 1:
+		return nil, packCorruptError(name, "pack has %d unresolved deltas", unresolved)
+	}
+	return externalBases, nil
+}
+
+func indexedObjects(entries []*streamEntry) []*packObject {
+	objects := make([]*packObject, len(entries))
+	for i, entry := range entries {
+		objects[i] = &packObject{hash: entry.object.Hash, offset: entry.offset, crc: entry.crc}
+	}
+	return objects
+}
+
+func IndexPackFile(packPath, indexPath string) (string, error) {
+	// Read a pack, resolving its deltas, and write an index for it to
+	// `indexPath`. The pack must not be thin. Returns the pack's checksum.
+	pack, err := os.Open(packPath)
+	if err != nil {
+		return "", fmt.Errorf("could not open pack %s: %w", packPath, err)
+	}
+	defer pack.Close()
+	entries, sum, err := readPackStream(pack, nil, packPath)
+	if err != nil {
+		return "", err
+	}
+	if _, err := resolveEntries(entries, nil, packPath); err != nil {
+		return "", err
+	}
+	if err := writePackIndex(indexPath, sum, indexedObjects(entries)); err != nil {
+		return "", err
+	}
+	return sum, nil
+}
+
+func ReceivePack(src io.Reader, dir string, fixThin bool) (*ReceivedPack, error) {
+	// Store a pack read from `src` in `dir` with an index, named by its
+	// checksum. With `fixThin`, deltas may refer to objects that are only in
+	// the repository; those objects are added to the end of the pack, so it
+	// stands on its own, and its checksum is updated.
+	if err := MkdirAllShared(dir); err != nil {
+		return nil, fmt.Errorf("could not create pack directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(dir, "tmp_pack_")
+	if err != nil {
+		return nil, fmt.Errorf("could not create pack: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	out := bufio.NewWriter(tmp)
+	entries, sum, err := readPackStream(src, out, tmp.Name())
+	if err != nil {
+		return nil, err
+	}
+	if err := out.Flush(); err != nil {
+		return nil, fmt.Errorf("could not write pack: %w", err)
+	}
+	var external func(hash string) (*GitObject, error)
+	if fixThin {
+		external = Store.Read
+	}
+	bases, err := resolveEntries(entries, external, tmp.Name())
+	if err != nil {
+		return nil, err
+	}
+	if len(bases) > 0 {
+		added, newSum, err := appendBases(tmp, bases, len(entries))
+		if err != nil {
+			return nil, err
+		}
+		entries, sum = append(entries, added...), newSum
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, fmt.Errorf("could not write pack: %w", err)
+	}
+	if err := AdjustSharedPerm(tmp.Name()); err != nil {
+		return nil, err
+	}
+
+	received := &ReceivedPack{
+		Path:      path.Join(dir, "pack-"+sum+".pack"),
+		Checksum:  sum,
+		Objects:   len(entries),
+		ThinBases: len(bases),
+	}
+	if err := os.Rename(tmp.Name(), received.Path); err != nil {
+		return nil, fmt.Errorf("could not write pack: %w", err)
+	}
+	if err := writePackIndex(path.Join(dir, "pack-"+sum+".idx"), sum, indexedObjects(entries)); err != nil {
+		return nil, err
+	}
+	return received, nil
+}
+
+func appendBases(pack *os.File, bases []*GitObject, count int) ([]*streamEntry, string, error) {
+	// Add whole objects in place of the checksum at the end of a pack, update
+	// the object count in its header and write the new checksum. Returns the
+	// entries for the added objects and the checksum.
+	info, err := pack.Stat()
+	if err != nil {
+		return nil, "", fmt.Errorf("could not read pack: %w", err)
+	}
+	offset := uint64(info.Size()) - uint64(ObjectFormat.Size)
+	var added []*streamEntry
+	var data []byte
+	for _, base := range bases {
+		entry, err := encodePackEntry(&packObject{objType: base.Type, body: base.Body()}, offset)
+		if err != nil {
+			return nil, "", err
+		}
+		added = append(added, &streamEntry{offset: offset, crc: crc32.ChecksumIEEE(entry), object: base})
+		data = append(data, entry...)
+		offset += uint64(len(entry))
+	}
+	if _, err := pack.WriteAt(data, info.Size()-int64(ObjectFormat.Size)); err != nil {
+		return nil, "", fmt.Errorf("could not write pack: %w", err)
+	}
+	if _, err := pack.WriteAt(binary.BigEndian.AppendUint32(nil, uint32(count+len(bases))), 8); err != nil {
+		return nil, "", fmt.Errorf("could not write pack: %w", err)
+	}
+
+	checksum := ObjectFormat.New()
+	if _, err := io.Copy(checksum, io.NewSectionReader(pack, 0, int64(offset))); err != nil {
+		return nil, "", fmt.Errorf("could not read pack: %w", err)
+	}
+	sum, err := Checksum(checksum)
+	if err != nil {
+		return nil, "", err
+	}
+	trailer, _ := hex.DecodeString(sum)
+	if _, err := pack.WriteAt(trailer, int64(offset)); err != nil {
+		return nil, "", fmt.Errorf("could not write pack: %w", err)
+	}
+	return added, sum, nil
+}
+
+func UnpackObjects(src io.Reader, dryRun bool) (int, error) {
+	// Read a pack from `src` and write each of its objects as a loose object,
+	// unless it is already stored. Deltas may refer to objects in the
+	// repository. With `dryRun`, the pack is only checked. Returns the number
+	// of objects in the pack.
+	entries, _, err := readPackStream(src, nil, "from stdin")
+	if err != nil {
+		return 0, err
+	}
+	if _, err := resolveEntries(entries, Store.Read, "from stdin"); err != nil {
+		return 0, err
+	}
+	if dryRun {
+		return len(entries), nil
+	}
+	for _, entry := range entries {
+		if err := entry.object.Write(); err != nil {
+			return 0, err
+		}
+	}
+	return len(entries), nil
+}
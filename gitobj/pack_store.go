@@ -0,0 +1,774 @@
+package gitobj
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Object types as they are numbered in pack files. Deltas hold the changes
+// from a base object, found either at an earlier offset in the same pack or
+// by hash.
+const (
+	packCommit   = 1
+	packTree     = 2
+	packBlob     = 3
+	packTag      = 4
+	packOfsDelta = 6
+	packRefDelta = 7
+)
+
+var packTypeNames = map[int]string{packCommit: "commit", packTree: "tree", packBlob: "blob", packTag: "tag"}
+
+// maxDeltaDepth bounds delta chains, so a corrupt pack can't loop forever.
+const maxDeltaDepth = 1000
+
+// PackStore reads the packs in a directory, each a `pack-<hash>.pack` file of
+// objects with a `.idx` file mapping hashes to their offsets. Packs can't be
+// written to. The directory is checked for new or removed packs as they are
+// used.
+type PackStore struct {
+	Dir string
+
+	mu    sync.Mutex
+	packs map[string]*packIndex
+}
+
+func NewPackStore(dir string) *PackStore {
+	return &PackStore{Dir: dir}
+}
+
+// packIndex holds the contents of an `.idx` file. `hashes` are the sorted
+// binary hashes of the objects, `hashSize` bytes each, and `offsets` their
+// positions in the pack file.
+type packIndex struct {
+	packPath string
+	hashSize int
+	hashes   []byte
+	offsets  []uint64
+
+	byOffsetOnce sync.Once
+	byOffset     map[uint64]int
+}
+
+func (store *PackStore) loadPacks() ([]*packIndex, error) {
+	// Return the indexes of the packs in the directory, reading those that were
+	// added since the last call.
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	files, err := os.ReadDir(store.Dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("could not read pack directory: %w", err)
+	}
+	found := make(map[string]*packIndex)
+	var packs []*packIndex
+	for _, file := range files {
+		name, isIndex := strings.CutSuffix(file.Name(), ".idx")
+		if !isIndex || !strings.HasPrefix(name, "pack-") {
+			continue
+		}
+		packPath := path.Join(store.Dir, name+".pack")
+		index, ok := store.packs[packPath]
+		if !ok {
+			if _, err := os.Stat(packPath); err != nil {
+				continue
+			}
+			if index, err = readPackIndex(path.Join(store.Dir, file.Name()), packPath); err != nil {
+				return nil, err
+			}
+		}
+		found[packPath] = index
+		packs = append(packs, index)
+	}
+	store.packs = found
+	return packs, nil
+}
+
+func readPackIndex(indexPath, packPath string) (*packIndex, error) {
+	// Read an index file, which is either version 2 (starting with a magic
+	// number) or the original version 1. Both start the object table with a
+	// 256-entry fan-out of cumulative counts by first hash byte. Hashes are in
+	// the repository's object format.
+	data, err := os.ReadFile(indexPath)
+	if err != nil {
+		return nil, fmt.Errorf("could not read pack index: %w", err)
+	}
+	corrupt := func() error {
+		return &ObjectError{Name: indexPath, Kind: ErrCorruptObject,
+			Message: fmt.Sprintf("pack index %s is corrupt", indexPath)}
+	}
+
+	version, table := 1, data
+	if bytes.HasPrefix(data, []byte("\377tOc")) {
+		if len(data) < 8 || binary.BigEndian.Uint32(data[4:]) != 2 {
+			return nil, corrupt()
+		}
+		version, table = 2, data[8:]
+	}
+	if len(table) < 256*4 {
+		return nil, corrupt()
+	}
+	count := int(binary.BigEndian.Uint32(table[255*4:]))
+	table = table[256*4:]
+	hashSize := ObjectFormat.Size
+	index := &packIndex{packPath: packPath, hashSize: hashSize, offsets: make([]uint64, count)}
+
+	if version == 1 {
+		// Entries are a 4-byte offset followed by the hash.
+		entrySize := 4 + hashSize
+		if len(table) < count*entrySize {
+			return nil, corrupt()
+		}
+		index.hashes = make([]byte, 0, count*hashSize)
+		for i := 0; i < count; i++ {
+			entry := table[i*entrySize : (i+1)*entrySize]
+			index.offsets[i] = uint64(binary.BigEndian.Uint32(entry))
+			index.hashes = append(index.hashes, entry[4:]...)
+		}
+		return index, nil
+	}
+
+	// Hashes, CRCs and 4-byte offsets come in separate tables. Offsets with the
+	// high bit set point into a table of 8-byte offsets for large packs.
+	hashesEnd := count * hashSize
+	if len(table) < hashesEnd+count*8 {
+		return nil, corrupt()
+	}
+	index.hashes = table[:hashesEnd]
+	offsets := table[hashesEnd+count*4 : hashesEnd+count*8]
+	largeOffsets := table[hashesEnd+count*8:]
+	for i := range index.offsets {
+		offset := binary.BigEndian.Uint32(offsets[i*4:])
+		if offset&0x80000000 == 0 {
+			index.offsets[i] = uint64(offset)
+			continue
+		}
+		large := int(offset&0x7fffffff) * 8
+		if large+8 > len(largeOffsets) {
+			return nil, corrupt()
+		}
+		index.offsets[i] = binary.BigEndian.Uint64(largeOffsets[large:])
+	}
+	return index, nil
+}
+
+func (index *packIndex) count() int {
+	return len(index.offsets)
+}
+
+func (index *packIndex) hashAt(i int) []byte {
+	return index.hashes[i*index.hashSize : (i+1)*index.hashSize]
+}
+
+func (index *packIndex) hash(i int) string {
+	return hex.EncodeToString(index.hashAt(i))
+}
+
+func (index *packIndex) search(prefix []byte) int {
+	// Return the position of the first object whose hash is not before
+	// `prefix`.
+	return sort.Search(index.count(), func(i int) bool {
+		return bytes.Compare(index.hashAt(i)[:len(prefix)], prefix) >= 0
+	})
+}
+
+func (index *packIndex) find(hash string) (uint64, bool) {
+	binHash, err := hex.DecodeString(hash)
+	if err != nil || len(binHash) != index.hashSize {
+		return 0, false
+	}
+	i := index.search(binHash)
+	if i < index.count() && bytes.Equal(index.hashAt(i), binHash) {
+		return index.offsets[i], true
+	}
+	return 0, false
+}
+
+func (index *packIndex) hashAtOffset(offset uint64) (string, bool) {
+	// Return the hash of the object at `offset`, to find the base of an offset
+	// delta by name.
+	index.byOffsetOnce.Do(func() {
+		index.byOffset = make(map[uint64]int, index.count())
+		for i, offset := range index.offsets {
+			index.byOffset[offset] = i
+		}
+	})
+	i, ok := index.byOffset[offset]
+	if !ok {
+		return "", false
+	}
+	return index.hash(i), true
+}
+
+func (store *PackStore) locate(hash string) (*packIndex, uint64, error) {
+	packs, err := store.loadPacks()
+	if err != nil {
+		return nil, 0, err
+	}
+	for _, index := range packs {
+		if offset, ok := index.find(hash); ok {
+			return index, offset, nil
+		}
+	}
+	return nil, 0, notFoundError(hash)
+}
+
+func (store *PackStore) PackOf(hash string) (string, bool) {
+	// Return the path of the first pack holding an object.
+	index, _, err := store.locate(hash)
+	if err != nil {
+		return "", false
+	}
+	return index.packPath, true
+}
+
+func (store *PackStore) Has(hash string) bool {
+	_, _, err := store.locate(hash)
+	return err == nil
+}
+
+func (store *PackStore) Read(hash string) (*GitObject, error) {
+	index, offset, err := store.locate(hash)
+	if err != nil {
+		return nil, err
+	}
+	objType, body, err := store.readObject(index, offset, 0)
+	if err != nil {
+		return nil, &ObjectError{Name: hash, Kind: ErrCorruptObject,
+			Message: fmt.Sprintf("could not read %s from %s", hash, index.packPath), Err: err}
+	}
+	return &GitObject{Hash: hash, Type: objType, Size: len(body), Content: body}, nil
+}
+
+func (store *PackStore) readObject(index *packIndex, offset uint64, depth int) (string, []byte, error) {
+	pack, err := os.Open(index.packPath)
+	if err != nil {
+		return "", nil, err
+	}
+	defer pack.Close()
+	return store.readPacked(pack, offset, depth)
+}
+
+func (store *PackStore) delta(hash string) (string, []byte, bool) {
+	// Return the base and the delta an object is stored as, if it is a delta,
+	// so a new pack can reuse it.
+	index, offset, err := store.locate(hash)
+	if err != nil {
+		return "", nil, false
+	}
+	pack, err := os.Open(index.packPath)
+	if err != nil {
+		return "", nil, false
+	}
+	defer pack.Close()
+	src := bufio.NewReader(io.NewSectionReader(pack, int64(offset), 1<<62))
+	objType, size, err := readEntryHeader(src)
+	if err != nil {
+		return "", nil, false
+	}
+
+	var base string
+	switch objType {
+	case packOfsDelta:
+		distance, err := readOffsetDistance(src)
+		if err != nil || distance == 0 || distance > offset {
+			return "", nil, false
+		}
+		var ok bool
+		if base, ok = index.hashAtOffset(offset - distance); !ok {
+			return "", nil, false
+		}
+	case packRefDelta:
+		baseHash := make([]byte, index.hashSize)
+		if _, err := io.ReadFull(src, baseHash); err != nil {
+			return "", nil, false
+		}
+		base = hex.EncodeToString(baseHash)
+	default:
+		return "", nil, false
+	}
+	delta, err := inflate(src, size)
+	if err != nil {
+		return "", nil, false
+	}
+	return base, delta, true
+}
+
+func (store *PackStore) Stream(hash string) (*ObjectReader, error) {
+	// Packed objects are mostly deltas, so they are read whole.
+	object, err := store.Read(hash)
+	if err != nil {
+		return nil, err
+	}
+	return &ObjectReader{ReadCloser: io.NopCloser(bytes.NewReader(object.Content)),
+		Type: object.Type, Size: object.Size}, nil
+}
+
+func (store *PackStore) Write(object *GitObject) error {
+	return ErrReadOnlyStore
+}
+
+func (store *PackStore) Iterate(fn func(hash string) error) error {
+	packs, err := store.loadPacks()
+	if err != nil {
+		return err
+	}
+	for _, index := range packs {
+		for i := 0; i < index.count(); i++ {
+			if err := fn(index.hash(i)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (store *PackStore) Packs() ([]string, error) {
+	// Return the paths of the pack files in the directory that have an index.
+	packs, err := store.loadPacks()
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, index := range packs {
+		paths = append(paths, index.packPath)
+	}
+	return paths, nil
+}
+
+func (store *PackStore) matchPrefix(prefix string) ([]string, error) {
+	packs, err := store.loadPacks()
+	if err != nil {
+		return nil, err
+	}
+	// Search by the whole bytes of the prefix, then check an odd last digit.
+	binPrefix, err := hex.DecodeString(prefix[:len(prefix)/2*2])
+	if err != nil {
+		return nil, nil
+	}
+	var matches []string
+	for _, index := range packs {
+		for i := index.search(binPrefix); i < index.count(); i++ {
+			hash := index.hash(i)
+			if !strings.HasPrefix(hash, prefix[:len(binPrefix)*2]) {
+				break
+			}
+			if strings.HasPrefix(hash, prefix) {
+				matches = append(matches, hash)
+			}
+		}
+	}
+	return matches, nil
+}
+
+func (store *PackStore) readPacked(pack *os.File, offset uint64, depth int) (string, []byte, error) {
+	// Read the object at `offset` in a pack, applying deltas to their bases.
+	if depth > maxDeltaDepth {
+		return "", nil, errors.New("delta chain is too long")
+	}
+	src := bufio.NewReader(io.NewSectionReader(pack, int64(offset), 1<<62))
+	objType, size, err := readEntryHeader(src)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var baseType string
+	var base []byte
+	switch objType {
+	case packCommit, packTree, packBlob, packTag:
+		body, err := inflate(src, size)
+		return packTypeNames[objType], body, err
+	case packOfsDelta:
+		distance, err := readOffsetDistance(src)
+		if err != nil {
+			return "", nil, err
+		}
+		if distance == 0 || distance > offset {
+			return "", nil, fmt.Errorf("delta base offset out of range at %d", offset)
+		}
+		baseType, base, err = store.readPacked(pack, offset-distance, depth+1)
+		if err != nil {
+			return "", nil, err
+		}
+	case packRefDelta:
+		baseHash := make([]byte, ObjectFormat.Size)
+		if _, err := io.ReadFull(src, baseHash); err != nil {
+			return "", nil, err
+		}
+		// The base may be in another pack.
+		baseIndex, baseOffset, err := store.locate(hex.EncodeToString(baseHash))
+		if err != nil {
+			return "", nil, err
+		}
+		if baseIndex.packPath == pack.Name() {
+			baseType, base, err = store.readPacked(pack, baseOffset, depth+1)
+		} else {
+			baseType, base, err = store.readObject(baseIndex, baseOffset, depth+1)
+		}
+		if err != nil {
+			return "", nil, err
+		}
+	default:
+		return "", nil, fmt.Errorf("unknown object type %d at %d", objType, offset)
+	}
+
+	delta, err := inflate(src, size)
+	if err != nil {
+		return "", nil, err
+	}
+	body, err := applyDelta(base, delta)
+	return baseType, body, err
+}
+
+func VerifyPack(packPath string) error {
+	// Check a pack against its index: the checksum at the end of the pack must
+	// match its contents and the one the index records, and every object must
+	// hash to its name. Hashing refuses data crafted for SHA-1 collisions.
+	if err := VerifyPackChecksum(packPath); err != nil {
+		return err
+	}
+	index, err := readPackIndex(strings.TrimSuffix(packPath, ".pack")+".idx", packPath)
+	if err != nil {
+		return err
+	}
+	pack, err := os.Open(packPath)
+	if err != nil {
+		return fmt.Errorf("could not open pack %s: %w", packPath, err)
+	}
+	defer pack.Close()
+
+	store := &PackStore{Dir: path.Dir(packPath)}
+	for i := 0; i < index.count(); i++ {
+		objType, body, err := store.readPacked(pack, index.offsets[i], 0)
+		if err != nil {
+			return packCorruptError(packPath, "could not read %s: %s", index.hash(i), err)
+		}
+		object, err := HashObject(objType, body)
+		if err != nil {
+			return err
+		}
+		if object.Hash != index.hash(i) {
+			return packCorruptError(packPath, "object %s hashes to %s", index.hash(i), object.Hash)
+		}
+	}
+	return nil
+}
+
+func packCorruptError(packPath, format string, args ...any) error {
+	return &ObjectError{Name: packPath, Kind: ErrCorruptObject,
+		Message: fmt.Sprintf("pack %s is corrupt: ", packPath) + fmt.Sprintf(format, args...)}
+}
+
+func VerifyPackChecksum(packPath string) error {
+	// Check the header of a pack and the checksum at its end, which must match
+	// its contents and the one its index records, without reading the objects.
+	indexPath := strings.TrimSuffix(packPath, ".pack") + ".idx"
+	index, err := readPackIndex(indexPath, packPath)
+	if err != nil {
+		return err
+	}
+	indexData, err := os.ReadFile(indexPath)
+	if err != nil {
+		return fmt.Errorf("could not read pack index: %w", err)
+	}
+	pack, err := os.Open(packPath)
+	if err != nil {
+		return fmt.Errorf("could not open pack %s: %w", packPath, err)
+	}
+	defer pack.Close()
+
+	info, err := pack.Stat()
+	if err != nil {
+		return fmt.Errorf("could not read pack %s: %w", packPath, err)
+	}
+	hashSize := int64(index.hashSize)
+	if info.Size() < 12+hashSize || int64(len(indexData)) < 2*hashSize {
+		return packCorruptError(packPath, "truncated file")
+	}
+	header := make([]byte, 12)
+	if _, err := pack.ReadAt(header, 0); err != nil {
+		return fmt.Errorf("could not read pack %s: %w", packPath, err)
+	}
+	if string(header[:4]) != "PACK" {
+		return packCorruptError(packPath, "bad signature")
+	}
+	if version := binary.BigEndian.Uint32(header[4:]); version != 2 && version != 3 {
+		return packCorruptError(packPath, "unsupported version %d", version)
+	}
+	if count := binary.BigEndian.Uint32(header[8:]); int(count) != index.count() {
+		return packCorruptError(packPath, "holds %d objects, but its index has %d", count, index.count())
+	}
+
+	checksum := ObjectFormat.New()
+	if _, err := io.Copy(checksum, io.NewSectionReader(pack, 0, info.Size()-hashSize)); err != nil {
+		return fmt.Errorf("could not read pack %s: %w", packPath, err)
+	}
+	sum, err := Checksum(checksum)
+	if err != nil {
+		return err
+	}
+	trailer := make([]byte, hashSize)
+	if _, err := pack.ReadAt(trailer, info.Size()-hashSize); err != nil {
+		return fmt.Errorf("could not read pack %s: %w", packPath, err)
+	}
+	recorded := indexData[int64(len(indexData))-2*hashSize : int64(len(indexData))-hashSize]
+	if sum != hex.EncodeToString(trailer) || !bytes.Equal(trailer, recorded) {
+		return packCorruptError(packPath, "checksum mismatch")
+	}
+	return nil
+}
+
+// PackEntry describes how an object is stored in a pack. `Size` is the size of
+// the stored data, which for a delta is the delta rather than the object, and
+// `PackedSize` the number of bytes the entry takes up. Deltas have the `Depth`
+// of their chain and the hash of their `Base`.
+type PackEntry struct {
+	Hash       string
+	Type       string
+	Size       uint64
+	PackedSize uint64
+	Offset     uint64
+	Depth      int
+	Base       string
+}
+
+func PackObjectCount(packPath string) (int, error) {
+	// Return the number of objects in a pack, according to its index.
+	index, err := readPackIndex(strings.TrimSuffix(packPath, ".pack")+".idx", packPath)
+	if err != nil {
+		return 0, err
+	}
+	return index.count(), nil
+}
+
+func ReadPackEntries(packPath string) ([]PackEntry, error) {
+	// List the entries of a pack in the order they are stored, reading only
+	// their headers. Deltas get the type of the object at the end of their
+	// chain.
+	index, err := readPackIndex(strings.TrimSuffix(packPath, ".pack")+".idx", packPath)
+	if err != nil {
+		return nil, err
+	}
+	pack, err := os.Open(packPath)
+	if err != nil {
+		return nil, fmt.Errorf("could not open pack %s: %w", packPath, err)
+	}
+	defer pack.Close()
+	info, err := pack.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("could not read pack %s: %w", packPath, err)
+	}
+	end := uint64(info.Size() - int64(index.hashSize))
+
+	order := make([]int, index.count())
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(a, b int) bool { return index.offsets[order[a]] < index.offsets[order[b]] })
+
+	entries := make([]PackEntry, len(order))
+	types := make([]int, len(order))
+	bases := make([]int, len(order))
+	byHash := make(map[string]int, len(order))
+	byOffset := make(map[uint64]int, len(order))
+	for i, n := range order {
+		entries[i].Hash, entries[i].Offset = index.hash(n), index.offsets[n]
+		byHash[entries[i].Hash], byOffset[entries[i].Offset] = i, i
+	}
+	for i := range entries {
+		entry := &entries[i]
+		next := end
+		if i+1 < len(entries) {
+			next = entries[i+1].Offset
+		}
+		if next <= entry.Offset {
+			return nil, packCorruptError(packPath, "entry %s overlaps the next one", entry.Hash)
+		}
+		entry.PackedSize = next - entry.Offset
+
+		src := bufio.NewReader(io.NewSectionReader(pack, int64(entry.Offset), int64(entry.PackedSize)))
+		if types[i], entry.Size, err = readEntryHeader(src); err != nil {
+			return nil, packCorruptError(packPath, "could not read %s: %s", entry.Hash, err)
+		}
+		bases[i] = -1
+		switch types[i] {
+		case packCommit, packTree, packBlob, packTag:
+			continue
+		case packOfsDelta:
+			distance, err := readOffsetDistance(src)
+			if err != nil {
+				return nil, packCorruptError(packPath, "could not read %s: %s", entry.Hash, err)
+			}
+			base, ok := byOffset[entry.Offset-distance]
+			if distance == 0 || distance > entry.Offset || !ok {
+				return nil, packCorruptError(packPath, "delta base offset out of range at %d", entry.Offset)
+			}
+			bases[i] = base
+		case packRefDelta:
+			baseHash := make([]byte, index.hashSize)
+			if _, err := io.ReadFull(src, baseHash); err != nil {
+				return nil, packCorruptError(packPath, "could not read %s: %s", entry.Hash, err)
+			}
+			base, ok := byHash[hex.EncodeToString(baseHash)]
+			if !ok {
+				return nil, packCorruptError(packPath, "delta base %x of %s is not in the pack", baseHash, entry.Hash)
+			}
+			bases[i] = base
+		default:
+			return nil, packCorruptError(packPath, "unknown object type %d at %d", types[i], entry.Offset)
+		}
+		entry.Base = entries[bases[i]].Hash
+	}
+
+	// Follow each delta chain to the object it starts from.
+	for i := range entries {
+		base := i
+		for bases[base] >= 0 {
+			base = bases[base]
+			if entries[i].Depth++; entries[i].Depth > maxDeltaDepth {
+				return nil, packCorruptError(packPath, "delta chain of %s is too long", entries[i].Hash)
+			}
+		}
+		entries[i].Type = packTypeNames[types[base]]
+	}
+	return entries, nil
+}
+
+func readEntryHeader(src io.ByteReader) (int, uint64, error) {
+	// Read the header of a pack entry, which holds the type in bits 4-6 of the
+	// first byte and the size in the rest, seven bits per byte while the high
+	// bit is set.
+	c, err := src.ReadByte()
+	if err != nil {
+		return 0, 0, err
+	}
+	objType, size, shift := int(c>>4)&7, uint64(c&0x0f), 4
+	for c&0x80 != 0 {
+		if c, err = src.ReadByte(); err != nil {
+			return 0, 0, err
+		}
+		size |= uint64(c&0x7f) << shift
+		shift += 7
+	}
+	return objType, size, nil
+}
+
+func readOffsetDistance(src io.ByteReader) (uint64, error) {
+	// Read how far back the base of an offset delta is. Each byte after the
+	// first adds one before shifting, so no distance has two encodings.
+	c, err := src.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	distance := uint64(c & 0x7f)
+	for c&0x80 != 0 {
+		if c, err = src.ReadByte(); err != nil {
+			return 0, err
+		}
+		distance = (distance+1)<<7 | uint64(c&0x7f)
+	}
+	return distance, nil
+}
+
+func inflate(src io.Reader, size uint64) ([]byte, error) {
+	contents, err := zlib.NewReader(src)
+	if err != nil {
+		return nil, err
+	}
+	defer contents.Close()
+	data, err := io.ReadAll(io.LimitReader(contents, int64(min(size, 1<<62))+1))
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(data)) != size {
+		return nil, fmt.Errorf("object has %d bytes, but its header gives %d", len(data), size)
+	}
+	return data, nil
+}
+
+func readDeltaSize(delta []byte) (uint64, []byte, error) {
+	// Read a size at the start of a delta, seven bits per byte, least
+	// significant first.
+	var size uint64
+	for shift := 0; len(delta) > 0; shift += 7 {
+		c := delta[0]
+		delta = delta[1:]
+		size |= uint64(c&0x7f) << shift
+		if c&0x80 == 0 {
+			return size, delta, nil
+		}
+	}
+	return 0, nil, errors.New("truncated delta")
+}
+
+func applyDelta(base, delta []byte) ([]byte, error) {
+	// Rebuild an object from its base and a delta, which gives the sizes of
+	// both and then a series of instructions. Instructions with the high bit
+	// set copy a range of the base, with bits 0-3 and 4-6 telling which bytes
+	// of the offset and size follow; others insert the next few delta bytes.
+	baseSize, delta, err := readDeltaSize(delta)
+	if err != nil {
+		return nil, err
+	}
+	if baseSize != uint64(len(base)) {
+		return nil, fmt.Errorf("delta expects a base of %d bytes, not %d", baseSize, len(base))
+	}
+	resultSize, delta, err := readDeltaSize(delta)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]byte, 0, resultSize)
+	for len(delta) > 0 {
+		op := delta[0]
+		delta = delta[1:]
+		switch {
+		case op&0x80 != 0:
+			var offset, size uint64
+			for i := 0; i < 7; i++ {
+				if op&(1<<i) == 0 {
+					continue
+				}
+				if len(delta) == 0 {
+					return nil, errors.New("truncated delta")
+				}
+				if i < 4 {
+					offset |= uint64(delta[0]) << (8 * i)
+				} else {
+					size |= uint64(delta[0]) << (8 * (i - 4))
+				}
+				delta = delta[1:]
+			}
+			if size == 0 {
+				size = 0x10000
+			}
+			if offset+size > uint64(len(base)) {
+				return nil, errors.New("delta copies beyond its base")
+			}
+			result = append(result, base[offset:offset+size]...)
+		case op != 0:
+			if int(op) > len(delta) {
+				return nil, errors.New("truncated delta")
+			}
+			result = append(result, delta[:op]...)
+			delta = delta[op:]
+		default:
+			return nil, errors.New("invalid delta instruction")
+		}
+	}
+	if uint64(len(result)) != resultSize {
+		return nil, fmt.Errorf("delta gives %d bytes, not %d", len(result), resultSize)
+	}
+	return result, nil
+}
@@ -0,0 +1,464 @@
+package gitobj
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path"
+	"slices"
+)
+
+// Git's default delta search settings: each object is compared with up to
+// `DefaultPackWindow` objects before it, and delta chains are at most
+// `DefaultPackDepth` long.
+const (
+	DefaultPackWindow = 10
+	DefaultPackDepth  = 50
+)
+
+// Objects smaller than this aren't worth storing as deltas.
+const minDeltaSize = 50
+
+// deltaBlockSize is the length of the runs of bytes matched between a delta's
+// base and target.
+const deltaBlockSize = 16
+
+type PackOptions struct {
+	// Window and Depth bound the delta search, as with `--window` and `--depth`.
+	Window int
+	Depth  int
+	// ReuseDeltas keeps deltas from existing packs whose base is packed too,
+	// instead of searching again.
+	ReuseDeltas bool
+}
+
+type WrittenPack struct {
+	// Path is the new `.pack` file, with its `.idx` file next to it.
+	Path         string
+	Objects      int
+	Deltas       int
+	ReusedDeltas int
+}
+
+type packObject struct {
+	hash    string
+	objType string
+	body    []byte
+	base    *packObject
+	delta   []byte
+	reused  bool
+	offset  uint64
+	crc     uint32
+	written bool
+}
+
+func (object *packObject) chainDepth(limit int) int {
+	// Return how many deltas must be applied to rebuild the object, or -1 if
+	// the chain is longer than `limit` or loops.
+	depth := 0
+	for base := object.base; base != nil; base = base.base {
+		if depth++; depth > limit || base == object {
+			return -1
+		}
+	}
+	return depth
+}
+
+func (object *packObject) dependsOn(other *packObject, limit int) bool {
+	for base := object; base != nil && limit >= 0; base, limit = base.base, limit-1 {
+		if base == other {
+			return true
+		}
+	}
+	return false
+}
+
+func WritePack(dir string, hashes []string, opts *PackOptions) (*WrittenPack, error) {
+	// Write the objects to a new pack in `dir`, storing those similar to others
+	// as deltas, and an index for it. The pack is named by its checksum.
+	objects := make([]*packObject, 0, len(hashes))
+	byHash := make(map[string]*packObject, len(hashes))
+	for _, hash := range hashes {
+		if _, ok := byHash[hash]; ok {
+			continue
+		}
+		object, err := Store.Read(hash)
+		if err != nil {
+			return nil, err
+		}
+		packed := &packObject{hash: hash, objType: object.Type, body: object.Body()}
+		objects = append(objects, packed)
+		byHash[hash] = packed
+	}
+
+	written := &WrittenPack{Objects: len(objects)}
+	if opts.ReuseDeltas {
+		reuseDeltas(objects, byHash)
+	}
+	findDeltas(objects, opts.Window, opts.Depth)
+	for _, object := range objects {
+		// A reused delta's base may have become a delta itself.
+		if object.base != nil && object.chainDepth(opts.Depth) < 0 {
+			object.base, object.delta, object.reused = nil, nil, false
+		}
+		if object.base != nil {
+			written.Deltas++
+			if object.reused {
+				written.ReusedDeltas++
+			}
+		}
+	}
+
+	if err := MkdirAllShared(dir); err != nil {
+		return nil, fmt.Errorf("could not create pack directory: %w", err)
+	}
+	packSum, err := writePackFile(dir, objects)
+	if err != nil {
+		return nil, err
+	}
+	written.Path = path.Join(dir, "pack-"+packSum+".pack")
+	if err := writePackIndex(path.Join(dir, "pack-"+packSum+".idx"), packSum, objects); err != nil {
+		return nil, err
+	}
+	return written, nil
+}
+
+func packStores(store ObjectStore) []*PackStore {
+	switch store := store.(type) {
+	case *PackStore:
+		return []*PackStore{store}
+	case *LayeredStore:
+		var stores []*PackStore
+		for _, layer := range store.Layers {
+			stores = append(stores, packStores(layer)...)
+		}
+		return stores
+	}
+	return nil
+}
+
+func reuseDeltas(objects []*packObject, byHash map[string]*packObject) {
+	// Keep the deltas objects are already stored as, when their base is in the
+	// new pack too.
+	stores := packStores(Store)
+	for _, object := range objects {
+		for _, store := range stores {
+			baseHash, delta, ok := store.delta(object.hash)
+			if !ok {
+				continue
+			}
+			if base, ok := byHash[baseHash]; ok && base.objType == object.objType {
+				object.base, object.delta, object.reused = base, delta, true
+			}
+			break
+		}
+	}
+}
+
+func findDeltas(objects []*packObject, window, depth int) {
+	// Compare each object with the ones before it in a window over the objects
+	// sorted by type and then size, largest first, since an object is often a
+	// newer version of a similar-sized one. The smallest delta wins, if it saves
+	// at least half the object's size.
+	if window <= 0 || depth <= 0 {
+		return
+	}
+	sorted := slices.Clone(objects)
+	slices.SortStableFunc(sorted, func(a, b *packObject) int {
+		if a.objType != b.objType {
+			return cmp.Compare(a.objType, b.objType)
+		}
+		return cmp.Compare(len(b.body), len(a.body))
+	})
+
+	for i, object := range sorted {
+		if object.base != nil || len(object.body) < minDeltaSize {
+			continue
+		}
+		maxSize := len(object.body)/2 - 20
+		for j := i - 1; j >= 0 && j >= i-window; j-- {
+			base := sorted[j]
+			if base.objType != object.objType {
+				break
+			}
+			baseDepth := base.chainDepth(depth)
+			if baseDepth < 0 || baseDepth+1 > depth || base.dependsOn(object, depth) {
+				continue
+			}
+			if delta := createDelta(base.body, object.body, maxSize); delta != nil {
+				object.base, object.delta = base, delta
+				maxSize = len(delta) - 1
+			}
+		}
+	}
+}
+
+func createDelta(base, target []byte, maxSize int) []byte {
+	// Encode `target` as copies from `base` and inserted bytes, in the format
+	// applyDelta reads. Runs of `deltaBlockSize` bytes of the target are looked up
+	// among those at aligned offsets of the base and extended both ways. Returns
+	// nil if the delta would be bigger than `maxSize`.
+	blocks := make(map[string]int)
+	for offset := 0; offset+deltaBlockSize <= len(base); offset += deltaBlockSize {
+		key := string(base[offset : offset+deltaBlockSize])
+		if _, ok := blocks[key]; !ok {
+			blocks[key] = offset
+		}
+	}
+
+	delta := appendDeltaSize(nil, uint64(len(base)))
+	delta = appendDeltaSize(delta, uint64(len(target)))
+	var insert []byte
+	flush := func() {
+		for len(insert) > 0 {
+			n := min(len(insert), 0x7f)
+			delta = append(append(delta, byte(n)), insert[:n]...)
+			insert = insert[n:]
+		}
+	}
+
+	for pos := 0; pos < len(target); {
+		if len(delta)+len(insert) > maxSize {
+			return nil
+		}
+		offset, ok := -1, false
+		if pos+deltaBlockSize <= len(target) {
+			offset, ok = blocks[string(target[pos:pos+deltaBlockSize])]
+		}
+		if !ok {
+			insert = append(insert, target[pos])
+			pos++
+			continue
+		}
+
+		size := deltaBlockSize
+		for offset+size < len(base) && pos+size < len(target) && base[offset+size] == target[pos+size] {
+			size++
+		}
+		for len(insert) > 0 && offset > 0 && base[offset-1] == target[pos-1] {
+			offset, pos, size = offset-1, pos-1, size+1
+			insert = insert[:len(insert)-1]
+		}
+		flush()
+		pos += size
+		for size > 0 {
+			n := min(size, 0x10000)
+			delta = appendCopy(delta, offset, n)
+			offset, size = offset+n, size-n
+		}
+	}
+	flush()
+	if len(delta) > maxSize {
+		return nil
+	}
+	return delta
+}
+
+func appendDeltaSize(delta []byte, size uint64) []byte {
+	for size >= 0x80 {
+		delta = append(delta, byte(size)|0x80)
+		size >>= 7
+	}
+	return append(delta, byte(size))
+}
+
+func appendCopy(delta []byte, offset, size int) []byte {
+	// A copy instruction sets a bit for each non-zero byte of the offset and
+	// size that follows it. A size of 0x10000 is written as none.
+	op := byte(0x80)
+	var args []byte
+	for i := 0; i < 4; i++ {
+		if b := byte(offset >> (8 * i)); b != 0 {
+			op |= 1 << i
+			args = append(args, b)
+		}
+	}
+	if size != 0x10000 {
+		for i := 0; i < 3; i++ {
+			if b := byte(size >> (8 * i)); b != 0 {
+				op |= 1 << (4 + i)
+				args = append(args, b)
+			}
+		}
+	}
+	return append(append(delta, op), args...)
+}
+
+func writePackFile(dir string, objects []*packObject) (string, error) {
+	// Write the pack to a temporary file, each delta after its base, and name
+	// it by its checksum. Returns the checksum.
+	tmp, err := os.CreateTemp(dir, "tmp_pack_")
+	if err != nil {
+		return "", fmt.Errorf("could not create pack: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	checksum := ObjectFormat.New()
+	out := bufio.NewWriter(io.MultiWriter(tmp, checksum))
+	header := []byte("PACK")
+	header = binary.BigEndian.AppendUint32(header, 2)
+	header = binary.BigEndian.AppendUint32(header, uint32(len(objects)))
+	out.Write(header)
+	offset := uint64(len(header))
+
+	var write func(object *packObject) error
+	write = func(object *packObject) error {
+		if object.written {
+			return nil
+		}
+		if object.base != nil {
+			if err := write(object.base); err != nil {
+				return err
+			}
+		}
+		entry, err := encodePackEntry(object, offset)
+		if err != nil {
+			return err
+		}
+		if _, err := out.Write(entry); err != nil {
+			return fmt.Errorf("could not write pack: %w", err)
+		}
+		object.offset, object.crc, object.written = offset, crc32.ChecksumIEEE(entry), true
+		offset += uint64(len(entry))
+		return nil
+	}
+	for _, object := range objects {
+		if err := write(object); err != nil {
+			return "", err
+		}
+	}
+	if err := out.Flush(); err != nil {
+		return "", fmt.Errorf("could not write pack: %w", err)
+	}
+
+	sum, err := Checksum(checksum)
+	if err != nil {
+		return "", err
+	}
+	trailer, _ := hex.DecodeString(sum)
+	if _, err := tmp.Write(trailer); err != nil {
+		return "", fmt.Errorf("could not write pack: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", fmt.Errorf("could not write pack: %w", err)
+	}
+	if err := AdjustSharedPerm(tmp.Name()); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), path.Join(dir, "pack-"+sum+".pack")); err != nil {
+		return "", fmt.Errorf("could not write pack: %w", err)
+	}
+	return sum, nil
+}
+
+func encodePackEntry(object *packObject, offset uint64) ([]byte, error) {
+	// Encode an object, or its delta as an offset delta, with its header.
+	objType, data := 0, object.body
+	for t, name := range packTypeNames {
+		if name == object.objType {
+			objType = t
+		}
+	}
+	var extra []byte
+	if object.base != nil {
+		objType, data = packOfsDelta, object.delta
+		distance := offset - object.base.offset
+		extra = []byte{byte(distance & 0x7f)}
+		for distance >>= 7; distance > 0; distance >>= 7 {
+			distance--
+			extra = append([]byte{byte(0x80 | distance&0x7f)}, extra...)
+		}
+	}
+
+	size := uint64(len(data))
+	entry := []byte{byte(objType<<4) | byte(size&0x0f)}
+	for size >>= 4; size > 0; size >>= 7 {
+		entry[len(entry)-1] |= 0x80
+		entry = append(entry, byte(size&0x7f))
+	}
+	entry = append(entry, extra...)
+
+	var compressed bytes.Buffer
+	zw := zlib.NewWriter(&compressed)
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return append(entry, compressed.Bytes()...), nil
+}
+
+func writePackIndex(indexPath, packSum string, objects []*packObject) error {
+	// Write a version 2 index: a fan-out table of counts by first hash byte,
+	// then the sorted hashes, the CRCs of their entries and their offsets,
+	// with offsets past 2 GiB in a table of their own.
+	sorted := slices.Clone(objects)
+	slices.SortFunc(sorted, func(a, b *packObject) int { return cmp.Compare(a.hash, b.hash) })
+
+	index := []byte("\377tOc")
+	index = binary.BigEndian.AppendUint32(index, 2)
+	var fanout [256]uint32
+	for _, object := range sorted {
+		first, _ := hex.DecodeString(object.hash[:2])
+		for b := int(first[0]); b < 256; b++ {
+			fanout[b]++
+		}
+	}
+	for _, count := range fanout {
+		index = binary.BigEndian.AppendUint32(index, count)
+	}
+	for _, object := range sorted {
+		binHash, _ := hex.DecodeString(object.hash)
+		index = append(index, binHash...)
+	}
+	for _, object := range sorted {
+		index = binary.BigEndian.AppendUint32(index, object.crc)
+	}
+	var largeOffsets []byte
+	for _, object := range sorted {
+		if object.offset < 0x80000000 {
+			index = binary.BigEndian.AppendUint32(index, uint32(object.offset))
+			continue
+		}
+		index = binary.BigEndian.AppendUint32(index, 0x80000000|uint32(len(largeOffsets)/8))
+		largeOffsets = binary.BigEndian.AppendUint64(largeOffsets, object.offset)
+	}
+	index = append(index, largeOffsets...)
+	trailer, _ := hex.DecodeString(packSum)
+	index = append(index, trailer...)
+	indexSum, err := ObjectFormat.Sum(index)
+	if err != nil {
+		return err
+	}
+	binSum, _ := hex.DecodeString(indexSum)
+	index = append(index, binSum...)
+
+	tmp, err := os.CreateTemp(path.Dir(indexPath), "tmp_idx_")
+	if err != nil {
+		return fmt.Errorf("could not create pack index: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(index); err != nil {
+		tmp.Close()
+		return fmt.Errorf("could not write pack index: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("could not write pack index: %w", err)
+	}
+	if err := AdjustSharedPerm(tmp.Name()); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), indexPath); err != nil {
+		return fmt.Errorf("could not write pack index: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package gitobj
+
+import (
+	"fmt"
+	"strings"
+)
+
+// quoteEscapes are the characters written as C escapes in a quoted path.
+var quoteEscapes = map[byte]string{
+	'\a': `\a`, '\b': `\b`, '\t': `\t`, '\n': `\n`, '\v': `\v`, '\f': `\f`, '\r': `\r`,
+	'"': `\"`, '\\': `\\`,
+}
+
+func needsQuote(c byte, nonASCII bool) bool {
+	return c < 0x20 || c == '"' || c == '\\' || c == 0x7f || nonASCII && c >= 0x80
+}
+
+func QuotePath(name string, nonASCII bool) string {
+	// Quote a path for output the way Git does, in double quotes with C escapes,
+	// if it has a double quote, backslash or control character, or with
+	// `nonASCII` (`core.quotePath`, on by default) any byte above 0x7f. Bytes
+	// without an escape of their own are written in octal, e.g. "\303\251".
+	quote := false
+	for i := 0; i < len(name) && !quote; i++ {
+		quote = needsQuote(name[i], nonASCII)
+	}
+	if !quote {
+		return name
+	}
+
+	var quoted strings.Builder
+	quoted.WriteByte('"')
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if escape, ok := quoteEscapes[c]; ok {
+			quoted.WriteString(escape)
+		} else if needsQuote(c, nonASCII) {
+			fmt.Fprintf(&quoted, `\%03o`, c)
+		} else {
+			quoted.WriteByte(c)
+		}
+	}
+	quoted.WriteByte('"')
+	return quoted.String()
+}
@@ -0,0 +1,26 @@
+package gitobj
+
+import "testing"
+
+func TestQuotePath(t *testing.T) {
+	tests := []struct {
+		name     string
+		nonASCII bool
+		want     string
+	}{
+		{"plain/file.txt", true, "plain/file.txt"},
+		{"with space.txt", true, "with space.txt"},
+		{"é.txt", true, `"\303\251.txt"`},
+		{"é.txt", false, "é.txt"},
+		{"tab\there", false, `"tab\there"`},
+		{"new\nline", true, `"new\nline"`},
+		{`say "hi"`, true, `"say \"hi\""`},
+		{`back\slash`, true, `"back\\slash"`},
+		{"bell\a\x01\x7f", true, `"bell\a\001\177"`},
+	}
+	for _, test := range tests {
+		if got := QuotePath(test.name, test.nonASCII); got != test.want {
+			t.Errorf("QuotePath(%q, %v): wanted %s, got %s", test.name, test.nonASCII, test.want, got)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package gitobj
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// SharedPerm is a `core.sharedRepository` setting: the permissions added for
+// the group (and others) on top of the umask, or with `Exact`, the mode files
+// get. The zero value leaves permissions to the umask.
+type SharedPerm struct {
+	Mode  os.FileMode
+	Exact bool
+}
+
+// SharedRepository is the setting of the current repository, which files and
+// directories created in the git directory are given.
+var SharedRepository SharedPerm
+
+func ParseSharedPerm(value string) (SharedPerm, error) {
+	switch strings.ToLower(value) {
+	case "", "group", "true", "1":
+		return SharedPerm{Mode: 0660}, nil
+	case "all", "world", "everybody", "2":
+		return SharedPerm{Mode: 0664}, nil
+	case "umask", "false", "0":
+		return SharedPerm{}, nil
+	}
+	mode, err := strconv.ParseUint(value, 8, 32)
+	if err != nil || mode > 0777 {
+		return SharedPerm{}, fmt.Errorf("invalid value for --shared: %s", value)
+	}
+	if mode&0600 != 0600 {
+		return SharedPerm{}, fmt.Errorf("problem with core.sharedRepository filemode value (0%.3o).\n"+
+			"The owner of files must always have read and write permissions.", mode)
+	}
+	return SharedPerm{Mode: os.FileMode(mode), Exact: true}, nil
+}
+
+func (perm SharedPerm) String() string {
+	// Format the setting as `core.sharedRepository` records it.
+	switch {
+	case perm.Exact:
+		return fmt.Sprintf("0%.3o", uint32(perm.Mode))
+	case perm.Mode == 0664:
+		return "2"
+	case perm.Mode == 0660:
+		return "1"
+	}
+	return "0"
+}
+
+func (perm SharedPerm) apply(mode os.FileMode, isDir bool) os.FileMode {
+	// Work out the mode a file or directory gets: read (and write, if the
+	// owner can write) for the group or everyone, execute where they can read
+	// and the owner can execute, and setgid directories so new files keep the
+	// group.
+	tweak := perm.Mode
+	if mode&0200 == 0 {
+		tweak &^= 0222
+	}
+	if mode&0100 != 0 {
+		tweak |= (tweak & 0444) >> 2
+	}
+	if perm.Exact {
+		mode = tweak
+	} else {
+		mode |= tweak
+	}
+	if isDir {
+		mode |= (mode&0444)>>2 | os.ModeSetgid
+	}
+	return mode
+}
+
+func AdjustSharedPerm(file string) error {
+	// Give a file or directory just created in the git directory the
+	// permissions of a shared repository, as git's adjust_shared_perm does.
+	if SharedRepository.Mode == 0 {
+		return nil
+	}
+	info, err := os.Lstat(file)
+	if err != nil {
+		return fmt.Errorf("could not set permissions of %s: %w", file, err)
+	}
+	if info.Mode()&fs.ModeSymlink != 0 {
+		return nil
+	}
+	mode := SharedRepository.apply(info.Mode().Perm(), info.IsDir())
+	if mode == info.Mode()&(fs.ModePerm|os.ModeSetgid) {
+		return nil
+	}
+	if err := os.Chmod(file, mode); err != nil {
+		return fmt.Errorf("could not set permissions of %s: %w", file, err)
+	}
+	return nil
+}
+
+func MkdirAllShared(dir string) error {
+	// Create a directory in the git directory, and any parents it needs,
+	// giving those it creates the shared permissions.
+	var missing []string
+	for parent := dir; filepath.Dir(parent) != parent; parent = filepath.Dir(parent) {
+		if _, err := os.Stat(parent); err == nil {
+			break
+		}
+		missing = append(missing, parent)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for i := len(missing) - 1; i >= 0; i-- {
+		if err := AdjustSharedPerm(missing[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+package gitobj
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// ObjectStore is where objects are kept. Hashes are full, lower-case hex
+// strings, and a missing object is reported with an error matching
+// ErrObjectNotFound.
+type ObjectStore interface {
+	// Has reports whether the store holds the object `hash`.
+	Has(hash string) bool
+	// Read returns the object `hash`, whose `Content` is its body.
+	Read(hash string) (*GitObject, error)
+	// Write stores an object made by one of the Hash functions or read from
+	// another store. Writing an object that already exists does nothing.
+	Write(object *GitObject) error
+	// Stream opens the body of the object `hash` for reading. The caller must
+	// close the returned reader.
+	Stream(hash string) (*ObjectReader, error)
+	// Iterate calls `fn` with the hash of every object in the store, stopping
+	// at the first error `fn` returns.
+	Iterate(fn func(hash string) error) error
+}
+
+// ObjectReader reads the body of an object of type `Type` holding `Size`
+// bytes.
+type ObjectReader struct {
+	io.ReadCloser
+	Type string
+	Size int
+}
+
+// ErrReadOnlyStore is returned when writing to a store that can't hold new
+// objects, such as a PackStore.
+var ErrReadOnlyStore = errors.New("object store is read-only")
+
+// Store holds the objects of the repository: loose objects under GitObjectDir,
+// then those in its packs. Programs embedding gotgit, and tests, can replace
+// it with another store, e.g. a MemoryStore.
+var Store ObjectStore = newRepositoryStore()
+
+func newRepositoryStore() ObjectStore {
+	return NewLayeredStore(
+		NewLooseStore(GitObjectDir),
+		NewPackStore(path.Join(GitObjectDir, "pack")),
+	)
+}
+
+func SetGitDir(dir string) {
+	// Use the repository in `dir`, such as the one a gitfile points to or a
+	// bare repository, resetting Store to its objects.
+	GitDir = dir
+	GitObjectDir = path.Join(dir, "objects")
+	Store = newRepositoryStore()
+}
+
+func (object *GitObject) Body() []byte {
+	// Return the body of an object. Objects made by the Hash functions keep
+	// their header at the start of `Content`, while objects read from a store
+	// hold only the body.
+	header := fmt.Sprintf("%s %d\u0000", object.Type, object.Size)
+	if len(object.Content) == len(header)+object.Size && bytes.HasPrefix(object.Content, []byte(header)) {
+		return object.Content[len(header):]
+	}
+	return object.Content
+}
+
+func (object *GitObject) encode() []byte {
+	// Return the header and body of an object, as they are hashed and stored
+	// in loose object files.
+	body := object.Body()
+	return append([]byte(fmt.Sprintf("%s %d\u0000", object.Type, len(body))), body...)
+}
+
+// prefixMatcher is implemented by stores that can find abbreviated hashes
+// without going through all their objects.
+type prefixMatcher interface {
+	matchPrefix(prefix string) ([]string, error)
+}
+
+func matchPrefix(store ObjectStore, prefix string) ([]string, error) {
+	// Return the hashes in `store` starting with `prefix`.
+	if matcher, ok := store.(prefixMatcher); ok {
+		return matcher.matchPrefix(prefix)
+	}
+	var matches []string
+	err := store.Iterate(func(hash string) error {
+		if strings.HasPrefix(hash, prefix) {
+			matches = append(matches, hash)
+		}
+		return nil
+	})
+	return matches, err
+}
+
+// LayeredStore combines several stores. Objects are read from the first layer
+// holding them and written to the first layer that accepts writes.
+type LayeredStore struct {
+	Layers []ObjectStore
+}
+
+func NewLayeredStore(layers ...ObjectStore) *LayeredStore {
+	return &LayeredStore{Layers: layers}
+}
+
+func (store *LayeredStore) Has(hash string) bool {
+	for _, layer := range store.Layers {
+		if layer.Has(hash) {
+			return true
+		}
+	}
+	return false
+}
+
+func (store *LayeredStore) Read(hash string) (*GitObject, error) {
+	for _, layer := range store.Layers {
+		object, err := layer.Read(hash)
+		if !errors.Is(err, ErrObjectNotFound) {
+			return object, err
+		}
+	}
+	return nil, notFoundError(hash)
+}
+
+func (store *LayeredStore) Stream(hash string) (*ObjectReader, error) {
+	for _, layer := range store.Layers {
+		reader, err := layer.Stream(hash)
+		if !errors.Is(err, ErrObjectNotFound) {
+			return reader, err
+		}
+	}
+	return nil, notFoundError(hash)
+}
+
+func (store *LayeredStore) Write(object *GitObject) error {
+	if store.Has(object.Hash) {
+		return nil
+	}
+	for _, layer := range store.Layers {
+		if err := layer.Write(object); !errors.Is(err, ErrReadOnlyStore) {
+			return err
+		}
+	}
+	return ErrReadOnlyStore
+}
+
+func (store *LayeredStore) Iterate(fn func(hash string) error) error {
+	// Objects held by several layers are only given once.
+	seen := make(map[string]bool)
+	for _, layer := range store.Layers {
+		err := layer.Iterate(func(hash string) error {
+			if seen[hash] {
+				return nil
+			}
+			seen[hash] = true
+			return fn(hash)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (store *LayeredStore) matchPrefix(prefix string) ([]string, error) {
+	var matches []string
+	seen := make(map[string]bool)
+	for _, layer := range store.Layers {
+		found, err := matchPrefix(layer, prefix)
+		if err != nil {
+			return nil, err
+		}
+		for _, hash := range found {
+			if !seen[hash] {
+				seen[hash] = true
+				matches = append(matches, hash)
+			}
+		}
+	}
+	return matches, nil
+}
@@ -0,0 +1,402 @@
+package gitobj
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestMemoryStore(t *testing.T) {
+	store := NewMemoryStore()
+	blob, err := HashObject("blob", []byte("hello\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Write(blob); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := store.Read(blob.Hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Type != "blob" || got.Size != 6 || string(got.Content) != "hello\n" {
+		t.Errorf("Read: got %s %d %q", got.Type, got.Size, got.Content)
+	}
+	if _, err := store.Read(blob.Hash[:39] + "0"); !errors.Is(err, ErrObjectNotFound) {
+		t.Errorf("Read of a missing object: wanted ErrObjectNotFound, got %v", err)
+	}
+	if !store.Has(blob.Hash) {
+		t.Error("Has: wanted true after writing")
+	}
+}
+
+func TestLayeredStore(t *testing.T) {
+	readOnly, loose := NewMemoryStore(), NewLooseStore(t.TempDir())
+	store := NewLayeredStore(NewPackStore(t.TempDir()), loose, readOnly)
+
+	shared, _ := HashObject("blob", []byte("shared\n"))
+	readOnly.Write(shared)
+	added, _ := HashObject("blob", []byte("added\n"))
+	if err := store.Write(added); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Write(shared); err != nil {
+		t.Fatal(err)
+	}
+
+	// New objects go to the first writable layer, and existing ones are left
+	// where they are.
+	if !loose.Has(added.Hash) || loose.Has(shared.Hash) {
+		t.Errorf("Write: wanted only %s in the loose store", added.Hash)
+	}
+	if info, err := os.Stat(loose.ObjectPath(added.Hash)); err != nil {
+		t.Error(err)
+	} else if info.Mode().Perm() != 0444 {
+		t.Errorf("Write: wanted a read-only object file, got %v", info.Mode())
+	}
+	got, err := store.Read(added.Hash)
+	if err != nil || string(got.Content) != "added\n" {
+		t.Errorf("Read from the loose store: got %v (%v)", got, err)
+	}
+	reader, err := store.Stream(shared.Hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	if reader.Type != "blob" || reader.Size != 7 {
+		t.Errorf("Stream: got %s %d", reader.Type, reader.Size)
+	}
+
+	var hashes []string
+	store.Iterate(func(hash string) error {
+		hashes = append(hashes, hash)
+		return nil
+	})
+	slices.Sort(hashes)
+	want := []string{added.Hash, shared.Hash}
+	slices.Sort(want)
+	if !slices.Equal(hashes, want) {
+		t.Errorf("Iterate: wanted %v, got %v", want, hashes)
+	}
+}
+
+func writeTestPack(t *testing.T, dir string, entries [][]byte, hashes []string) {
+	// Write a pack of already encoded `entries` and a version 2 index for it.
+	t.Helper()
+	var pack bytes.Buffer
+	pack.WriteString("PACK")
+	binary.Write(&pack, binary.BigEndian, []uint32{2, uint32(len(entries))})
+	offsets := make(map[string]uint32)
+	for i, entry := range entries {
+		offsets[hashes[i]] = uint32(pack.Len())
+		pack.Write(entry)
+	}
+	packSum := sha1.Sum(pack.Bytes())
+	pack.Write(packSum[:])
+
+	sorted := slices.Clone(hashes)
+	slices.Sort(sorted)
+	var index bytes.Buffer
+	index.WriteString("\377tOc")
+	binary.Write(&index, binary.BigEndian, uint32(2))
+	for b := 0; b < 256; b++ {
+		count := 0
+		for _, hash := range sorted {
+			if first, _ := hex.DecodeString(hash[:2]); int(first[0]) <= b {
+				count++
+			}
+		}
+		binary.Write(&index, binary.BigEndian, uint32(count))
+	}
+	for _, hash := range sorted {
+		binHash, _ := hex.DecodeString(hash)
+		index.Write(binHash)
+	}
+	index.Write(make([]byte, 4*len(sorted)))
+	for _, hash := range sorted {
+		binary.Write(&index, binary.BigEndian, offsets[hash])
+	}
+	index.Write(packSum[:])
+	indexSum := sha1.Sum(index.Bytes())
+	index.Write(indexSum[:])
+
+	name := path.Join(dir, "pack-"+hex.EncodeToString(packSum[:]))
+	if err := os.WriteFile(name+".pack", pack.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(name+".idx", index.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func packEntry(objType int, data []byte, extra ...byte) []byte {
+	// Encode a pack entry whose data is shorter than 2048 bytes.
+	entry := []byte{byte(0x80 | objType<<4 | len(data)&0x0f), byte(len(data) >> 4)}
+	entry = append(entry, extra...)
+	var compressed bytes.Buffer
+	zw := zlib.NewWriter(&compressed)
+	zw.Write(data)
+	zw.Close()
+	return append(entry, compressed.Bytes()...)
+}
+
+func TestPackStore(t *testing.T) {
+	dir := t.TempDir()
+	store := NewPackStore(dir)
+	if store.Has(hashString(t, "missing")) {
+		t.Error("Has: wanted false before any packs exist")
+	}
+
+	base := "The quick brown fox\njumps over the lazy dog\n"
+	target := "The quick brown fox\njumps over the sleeping dog\n"
+	baseHash, targetHash := hashString(t, base), hashString(t, target)
+	// Copy "...the ", insert "sleeping", copy " dog\n".
+	delta := []byte{byte(len(base)), byte(len(target)), 0x90, 35, 8}
+	delta = append(delta, "sleeping"...)
+	delta = append(delta, 0x91, 39, 5)
+
+	baseEntry := packEntry(packBlob, []byte(base))
+	writeTestPack(t, dir, [][]byte{baseEntry, packEntry(packOfsDelta, delta, byte(len(baseEntry)))},
+		[]string{baseHash, targetHash})
+
+	got, err := store.Read(targetHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Type != "blob" || string(got.Content) != target {
+		t.Errorf("Read of a delta: got %s %q", got.Type, got.Content)
+	}
+	matches, err := matchPrefix(store, baseHash[:5])
+	if err != nil || !slices.Equal(matches, []string{baseHash}) {
+		t.Errorf("matchPrefix: wanted [%s], got %v (%v)", baseHash, matches, err)
+	}
+	if err := store.Write(got); !errors.Is(err, ErrReadOnlyStore) {
+		t.Errorf("Write: wanted ErrReadOnlyStore, got %v", err)
+	}
+
+	packs, _ := filepath.Glob(path.Join(dir, "*.pack"))
+	if err := VerifyPack(packs[0]); err != nil {
+		t.Errorf("VerifyPack: %v", err)
+	}
+	data, _ := os.ReadFile(packs[0])
+	data[len(data)-30] ^= 0xff
+	os.WriteFile(packs[0], data, 0644)
+	if err := VerifyPack(packs[0]); !errors.Is(err, ErrCorruptObject) {
+		t.Errorf("VerifyPack of a changed pack: wanted ErrCorruptObject, got %v", err)
+	}
+}
+
+func hashString(t *testing.T, contents string) string {
+	t.Helper()
+	blob, err := HashObject("blob", []byte(contents))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return blob.Hash
+}
+
+func TestCreateDelta(t *testing.T) {
+	base := bytes.Repeat([]byte("the quick brown fox jumps over the lazy dog\n"), 2000)
+	target := append([]byte("new first line\n"), base[:30000]...)
+	target = append(append(target, "inserted\n"...), base[30000:]...)
+	delta := createDelta(base, target, len(target))
+	if delta == nil || len(delta) > 200 {
+		t.Fatalf("wanted a small delta, got %d bytes", len(delta))
+	}
+	got, err := applyDelta(base, delta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, target) {
+		t.Error("applying the delta did not rebuild the target")
+	}
+	if createDelta(base, []byte("unrelated contents, unrelated contents"), 20) != nil {
+		t.Error("wanted no delta when it can't be small enough")
+	}
+}
+
+func TestWritePack(t *testing.T) {
+	oldStore := Store
+	t.Cleanup(func() { Store = oldStore })
+	memory := NewMemoryStore()
+	Store = memory
+
+	var hashes []string
+	contents := bytes.Repeat([]byte("line of a file that changes a little\n"), 100)
+	for i := 0; i < 5; i++ {
+		contents = append(contents, []byte("another line\n")...)
+		blob, _ := HashObject("blob", contents)
+		memory.Write(blob)
+		hashes = append(hashes, blob.Hash)
+	}
+	tree, _ := HashObject("tree", []byte("100644 file\x00"+string(bytes.Repeat([]byte{1}, 20))))
+	memory.Write(tree)
+	hashes = append(hashes, tree.Hash)
+
+	dir := t.TempDir()
+	written, err := WritePack(dir, hashes, &PackOptions{Window: DefaultPackWindow, Depth: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if written.Objects != 6 || written.Deltas != 4 {
+		t.Errorf("wanted 6 objects with 4 deltas, got %d with %d", written.Objects, written.Deltas)
+	}
+	if err := VerifyPack(written.Path); err != nil {
+		t.Fatal(err)
+	}
+	packs := NewPackStore(dir)
+	for _, hash := range hashes {
+		object, err := packs.Read(hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, _ := memory.Read(hash)
+		if object.Type != want.Type || !bytes.Equal(object.Content, want.Content) {
+			t.Errorf("Read(%s) from the new pack: got a different %s", hash, object.Type)
+		}
+	}
+
+	entries, err := ReadPackEntries(written.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count, err := PackObjectCount(written.Path); err != nil || count != len(entries) {
+		t.Errorf("wanted %d objects in the pack, got %d (%v)", len(entries), count, err)
+	}
+	types, deltas := make(map[string]int), 0
+	for i, entry := range entries {
+		types[entry.Type]++
+		if i > 0 && entry.Offset != entries[i-1].Offset+entries[i-1].PackedSize {
+			t.Errorf("entry %s at %d doesn't follow the previous one", entry.Hash, entry.Offset)
+		}
+		if entry.Depth > 2 || (entry.Depth > 0) != (entry.Base != "") {
+			t.Errorf("entry %s has depth %d and base %q", entry.Hash, entry.Depth, entry.Base)
+		}
+		if entry.Depth > 0 {
+			deltas++
+		}
+	}
+	if types["blob"] != 5 || types["tree"] != 1 || deltas != 4 {
+		t.Errorf("wanted 5 blobs and a tree with 4 deltas, got %v with %d", types, deltas)
+	}
+
+	// Repacking from the pack reuses its deltas.
+	Store = NewLayeredStore(packs)
+	repacked, err := WritePack(t.TempDir(), hashes, &PackOptions{Depth: 2, ReuseDeltas: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if repacked.ReusedDeltas != 4 {
+		t.Errorf("wanted 4 reused deltas, got %d", repacked.ReusedDeltas)
+	}
+	if err := VerifyPack(repacked.Path); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReceivePack(t *testing.T) {
+	oldStore := Store
+	t.Cleanup(func() { Store = oldStore })
+	memory := NewMemoryStore()
+	Store = memory
+
+	var hashes []string
+	contents := bytes.Repeat([]byte("a line that is repeated\n"), 50)
+	for i := 0; i < 3; i++ {
+		contents = append(contents, "one more line\n"...)
+		blob, _ := HashObject("blob", contents)
+		memory.Write(blob)
+		hashes = append(hashes, blob.Hash)
+	}
+	written, err := WritePack(t.TempDir(), hashes, &PackOptions{Window: DefaultPackWindow, Depth: DefaultPackDepth})
+	if err != nil {
+		t.Fatal(err)
+	}
+	packData, err := os.ReadFile(written.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Indexing a pack gives the index it was written with.
+	indexPath := path.Join(t.TempDir(), "copy.idx")
+	sum, err := IndexPackFile(written.Path, indexPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := os.ReadFile(strings.TrimSuffix(written.Path, ".pack") + ".idx")
+	if got, _ := os.ReadFile(indexPath); !bytes.Equal(got, want) {
+		t.Error("IndexPackFile: wanted the same index as WritePack")
+	}
+	if !strings.HasSuffix(written.Path, "pack-"+sum+".pack") {
+		t.Errorf("IndexPackFile: wanted checksum of %s, got %s", written.Path, sum)
+	}
+	if _, err := IndexPackFile(written.Path, indexPath); err != nil {
+		t.Errorf("IndexPackFile over an existing index: %v", err)
+	}
+	truncated := path.Join(t.TempDir(), "truncated.pack")
+	os.WriteFile(truncated, packData[:len(packData)-5], 0644)
+	if _, err := IndexPackFile(truncated, indexPath); !errors.Is(err, ErrCorruptObject) {
+		t.Errorf("IndexPackFile of a truncated pack: wanted ErrCorruptObject, got %v", err)
+	}
+
+	// A thin pack holds a delta on an object that is only in the repository.
+	base := "The quick brown fox\njumps over the lazy dog\n"
+	target := "The quick brown fox\njumps over the sleeping dog\n"
+	baseObj, _ := HashObject("blob", []byte(base))
+	memory.Write(baseObj)
+	delta := []byte{byte(len(base)), byte(len(target)), 0x90, 35, 8}
+	delta = append(delta, "sleeping"...)
+	delta = append(delta, 0x91, 39, 5)
+	binBase, _ := hex.DecodeString(baseObj.Hash)
+	thinDir := t.TempDir()
+	writeTestPack(t, thinDir, [][]byte{packEntry(packRefDelta, delta, binBase...)},
+		[]string{hashString(t, target)})
+	thinPacks, _ := filepath.Glob(path.Join(thinDir, "*.pack"))
+	thinData, _ := os.ReadFile(thinPacks[0])
+
+	dir := t.TempDir()
+	if _, err := ReceivePack(bytes.NewReader(thinData), dir, false); !errors.Is(err, ErrCorruptObject) {
+		t.Errorf("ReceivePack of a thin pack: wanted ErrCorruptObject, got %v", err)
+	}
+	received, err := ReceivePack(bytes.NewReader(thinData), dir, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if received.Objects != 2 || received.ThinBases != 1 {
+		t.Errorf("ReceivePack with fixThin: wanted 2 objects with 1 added base, got %+v", received)
+	}
+	if err := VerifyPack(received.Path); err != nil {
+		t.Fatal(err)
+	}
+	Store = NewPackStore(dir)
+	if got, err := Store.Read(hashString(t, target)); err != nil || string(got.Content) != target {
+		t.Errorf("Read from the fixed pack: got %v (%v)", got, err)
+	}
+
+	// Unpacking writes loose objects, with bases from the repository.
+	loose := NewLooseStore(t.TempDir())
+	Store = NewLayeredStore(loose, memory)
+	if count, err := UnpackObjects(bytes.NewReader(thinData), true); err != nil || count != 1 ||
+		loose.Has(hashString(t, target)) {
+		t.Errorf("UnpackObjects dry run: got %d objects (%v)", count, err)
+	}
+	Store = loose
+	if _, err := UnpackObjects(bytes.NewReader(packData), false); err != nil {
+		t.Fatal(err)
+	}
+	for _, hash := range hashes {
+		if !loose.Has(hash) {
+			t.Errorf("UnpackObjects: wanted %s to be written", hash)
+		}
+	}
+}
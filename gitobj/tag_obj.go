@@ -0,0 +1,62 @@
+package gitobj
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+type Tag struct {
+	Hash   string
+	Object string
+	Type   string
+	Name   string
+	// Old tags may lack a tagger, in which case `HasTagger` is false.
+	Tagger    Signature
+	HasTagger bool
+	Message   string
+}
+
+func ParseTag(hash string, body []byte) (*Tag, error) {
+	// Parse the body of an annotated tag object into its headers and message.
+	tag := &Tag{Hash: hash}
+	headers, message, _ := bytes.Cut(body, []byte("\n\n"))
+	tag.Message = string(message)
+
+	for _, line := range strings.Split(string(headers), "\n") {
+		key, value, _ := strings.Cut(line, " ")
+		var err error
+		switch key {
+		case "object":
+			tag.Object = value
+		case "type":
+			tag.Type = value
+		case "tag":
+			tag.Name = value
+		case "tagger":
+			tag.Tagger, err = ParseSignature(value)
+			tag.HasTagger = true
+		}
+		if err != nil {
+			return nil, fmt.Errorf("tag %s: %w", hash, err)
+		}
+	}
+
+	if tag.Object == "" {
+		return nil, fmt.Errorf("malformed tag %s: missing object header", hash)
+	}
+	return tag, nil
+}
+
+func ReadTag(tagHash string) (*Tag, error) {
+	// Read and parse the annotated tag object identified by `tagHash`.
+	obj, err := ReadGitObj(tagHash)
+	if err != nil {
+		return nil, err
+	}
+	if obj.Type != "tag" {
+		return nil, fmt.Errorf("%s is a %s, not a tag", tagHash, obj.Type)
+	}
+
+	return ParseTag(tagHash, obj.Content)
+}
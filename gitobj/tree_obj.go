@@ -4,11 +4,9 @@ import (
 	"bufio"
 	"bytes"
 	"cmp"
-	"crypto/sha1"
 	"encoding/hex"
 	"fmt"
 	"io/fs"
-	"log"
 	"os"
 	"path"
 	"slices"
@@ -21,6 +19,109 @@ type Tree struct {
 	Objects []*GitObject
 }
 
+type TreeEntry struct {
+	Mode string `json:"mode"`
+	Type string `json:"type"`
+	Hash string `json:"hash"`
+	Name string `json:"name"`
+}
+
+func ModeType(mode string) string {
+	// Derive the object type of a tree entry from its mode.
+	switch mode {
+	case "040000", "40000":
+		return "tree"
+	case "160000":
+		return "commit"
+	default:
+		return "blob"
+	}
+}
+
+func ParseTree(content []byte) ([]TreeEntry, error) {
+	// Parse the body of a tree object into its entries.
+	var entries []TreeEntry
+	treeBuf := bytes.NewBuffer(content)
+
+	for treeBuf.Len() > 0 {
+		mode, err := treeBuf.ReadString(' ')
+		if err != nil {
+			return nil, fmt.Errorf("unable to extract mode: %w", err)
+		}
+		// Pad mode string if leading zero is omitted by Git.
+		mode = fmt.Sprintf("%06s", mode[:len(mode)-1])
+
+		name, err := treeBuf.ReadBytes(0)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read object name: %w", err)
+		}
+
+		hash := treeBuf.Next(ObjectFormat.Size)
+		if len(hash) < ObjectFormat.Size {
+			return nil, fmt.Errorf("unable to read hash of %s", name[:len(name)-1])
+		}
+
+		entries = append(entries, TreeEntry{
+			Mode: mode,
+			Type: ModeType(mode),
+			Hash: hex.EncodeToString(hash),
+			Name: string(name[:len(name)-1]),
+		})
+	}
+
+	return entries, nil
+}
+
+func (object *GitObject) TreeEntries() ([]TreeEntry, error) {
+	// Parse the entries of a tree object that has already been read.
+	if object.Type != "tree" {
+		return nil, fmt.Errorf("%s is not a tree object", object.Hash)
+	}
+	return ParseTree(object.Content)
+}
+
+func ReadTree(treeHash string) ([]TreeEntry, error) {
+	// Read the entries of the tree object identified by `treeHash`.
+	treeObj, err := ReadGitObj(treeHash)
+	if err != nil {
+		return nil, err
+	}
+	return treeObj.TreeEntries()
+}
+
+func ReadTreeRecursive(treeHash string) ([]TreeEntry, error) {
+	// List every non-tree entry reachable from a tree, with `Name` set to the
+	// entry's full path. Entries are sorted by path.
+	var files []TreeEntry
+	var walk func(hash, prefix string) error
+	walk = func(hash, prefix string) error {
+		entries, err := ReadTree(hash)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			entry.Name = path.Join(prefix, entry.Name)
+			if entry.Type == "tree" {
+				if err := walk(entry.Hash, entry.Name); err != nil {
+					return err
+				}
+				continue
+			}
+			files = append(files, entry)
+		}
+		return nil
+	}
+
+	if treeHash != "" {
+		if err := walk(treeHash, ""); err != nil {
+			return nil, err
+		}
+	}
+	slices.SortFunc(files, func(x, y TreeEntry) int { return cmp.Compare(x.Name, y.Name) })
+
+	return files, nil
+}
+
 func ignore(ignoreFile, rootDir string) (map[string]bool, error) {
 	// Read a file (e.g. .gitignore) with patterns to skip when creating trees.
 	// `ignoreFile` specifies the patterns to skip (an empty string means skip nothing)
@@ -35,7 +136,7 @@ func ignore(ignoreFile, rootDir string) (map[string]bool, error) {
 	f, err := os.Open(ignoreFile)
 
 	if err != nil {
-		return nil, fmt.Errorf("could not access %s: %s", ignoreFile, err)
+		return nil, fmt.Errorf("could not access %s: %w", ignoreFile, err)
 	}
 	defer f.Close()
 
@@ -45,13 +146,13 @@ func ignore(ignoreFile, rootDir string) (map[string]bool, error) {
 	for scanner.Scan() {
 		files, err := fs.Glob(fsys, scanner.Text())
 		if err != nil {
-			return nil, fmt.Errorf("error reading patterns in %s: %s", ignoreFile, err)
+			return nil, fmt.Errorf("error reading patterns in %s: %w", ignoreFile, err)
 		}
 		ignoredFiles = append(ignoredFiles, files...)
 	}
 
 	if err := scanner.Err(); err != nil {
-		return nil, fmt.Errorf("could not read %s contents: %s", ignoreFile, err)
+		return nil, fmt.Errorf("could not read %s contents: %w", ignoreFile, err)
 	}
 
 	for _, f := range ignoredFiles {
@@ -69,12 +170,16 @@ func HashTree(name string, objects []*GitObject) (*GitObject, error) {
 	var content strings.Builder
 	for _, obj := range objects {
 		objHash, err := hex.DecodeString(obj.Hash)
+		if err == nil && len(objHash) != ObjectFormat.Size {
+			err = fmt.Errorf("expected a %s hash", ObjectFormat.Name)
+		}
 		if err != nil {
 			return nil, fmt.Errorf(
-				"error decoding SHA1 hash of %s (%s):\n%s", obj.Name, obj.Name, err)
+				"error decoding hash of %s (%s):\n%w", obj.Name, obj.Hash, err)
 		}
+		// Git writes the directory mode without its leading zero ("40000").
 		content.WriteString(
-			fmt.Sprintf("%s %s\u0000%s", obj.Mode, obj.Name, string(objHash)))
+			fmt.Sprintf("%s %s\u0000%s", strings.TrimPrefix(obj.Mode, "0"), obj.Name, string(objHash)))
 	}
 
 	contentBytes := []byte(content.String())
@@ -83,8 +188,11 @@ func HashTree(name string, objects []*GitObject) (*GitObject, error) {
 	treeObj.Mode = "040000"
 	header := fmt.Sprintf("%s %d\u0000", treeObj.Type, treeObj.Size)
 	treeObj.Content = bytes.Join([][]byte{[]byte(header), contentBytes}, []byte(""))
-	hash := sha1.Sum(treeObj.Content)
-	treeObj.Hash = hex.EncodeToString(hash[:])
+	hash, err := ObjectFormat.Sum(treeObj.Content)
+	if err != nil {
+		return nil, err
+	}
+	treeObj.Hash = hash
 
 	return treeObj, nil
 }
@@ -96,7 +204,7 @@ func makeTree(
 	// and its sub-trees. Returns the root-level tree object.
 	files, err := fs.ReadDir(os.DirFS(rootDir), ".")
 	if err != nil {
-		log.Fatalf("cannot create tree from %s: %s", rootDir, err)
+		return nil, fmt.Errorf("cannot create tree from %s: %w", rootDir, err)
 	}
 
 	var fullPath string
@@ -108,21 +216,21 @@ func makeTree(
 		}
 		if !file.IsDir() {
 			blobObj, err := HashBlob(fullPath)
+			if err != nil {
+				return nil, fmt.Errorf("error hashing %s:\n%w", fullPath, err)
+			}
 			if write {
 				err := blobObj.Write()
 				if err != nil {
-					return nil, fmt.Errorf("error writing %s:\n%s", fullPath, err)
+					return nil, fmt.Errorf("error writing %s:\n%w", fullPath, err)
 				}
 			}
-			if err != nil {
-				return nil, fmt.Errorf("error hashing %s:\n%s", fullPath, err)
-			}
 			rootTree.Objects = append(rootTree.Objects, blobObj)
 		} else {
 			subTree := &Tree{Name: file.Name(), Parent: rootTree}
 			treeObj, err := makeTree(fullPath, subTree, ignoredFiles, write)
 			if err != nil {
-				return nil, fmt.Errorf("error creating tree from %s:\n%s", fullPath, err)
+				return nil, fmt.Errorf("error creating tree from %s:\n%w", fullPath, err)
 			}
 			subTree.Parent.Objects = append(subTree.Parent.Objects, treeObj)
 		}
@@ -134,12 +242,12 @@ func makeTree(
 
 	treeObj, err := HashTree(path.Base(rootDir), rootTree.Objects)
 	if err != nil {
-		return nil, fmt.Errorf("error hashing tree %s:\n%s", rootDir, err)
+		return nil, fmt.Errorf("error hashing tree %s:\n%w", rootDir, err)
 	}
 	if write {
 		err := treeObj.Write()
 		if err != nil {
-			return nil, fmt.Errorf("error writing %s:\n%s", rootDir, err)
+			return nil, fmt.Errorf("error writing %s:\n%w", rootDir, err)
 		}
 	}
 
@@ -152,8 +260,65 @@ func WriteTree(rootDir, ignoreFile string, write bool) (*GitObject, error) {
 	// written to the data store. Returns the root-level tree object.
 	ignored, err := ignore(ignoreFile, rootDir)
 	if err != nil {
-		return nil, fmt.Errorf("cannot read `.ignore` file %s: %s", ignoreFile, err)
+		return nil, fmt.Errorf("cannot read `.ignore` file %s: %w", ignoreFile, err)
 	}
 	baseTree := &Tree{Name: path.Base(rootDir)}
 	return makeTree(rootDir, baseTree, ignored, write)
 }
+
+func treeSortKey(entry TreeEntry) string {
+	// Git orders tree entries as if directory names ended with a slash.
+	if entry.Type == "tree" {
+		return entry.Name + "/"
+	}
+	return entry.Name
+}
+
+func BuildTree(files []TreeEntry, write bool) (*GitObject, error) {
+	// Create the tree (and sub-trees) holding `files`, whose names are full paths
+	// as returned by `ReadTreeRecursive`. If `write` is `true`, the trees are
+	// written to the data store; the blobs must already be there.
+	var entries []TreeEntry
+	subTrees := make(map[string][]TreeEntry)
+	for _, file := range files {
+		dir, rest, nested := strings.Cut(file.Name, "/")
+		if !nested {
+			if file.Type == "" {
+				file.Type = ModeType(file.Mode)
+			}
+			entries = append(entries, file)
+			continue
+		}
+		if _, seen := subTrees[dir]; !seen {
+			entries = append(entries, TreeEntry{Mode: "040000", Type: "tree", Name: dir})
+		}
+		file.Name = rest
+		subTrees[dir] = append(subTrees[dir], file)
+	}
+
+	slices.SortFunc(entries, func(x, y TreeEntry) int {
+		return cmp.Compare(treeSortKey(x), treeSortKey(y))
+	})
+	objects := make([]*GitObject, 0, len(entries))
+	for _, entry := range entries {
+		if entry.Type == "tree" {
+			subTree, err := BuildTree(subTrees[entry.Name], write)
+			if err != nil {
+				return nil, err
+			}
+			entry.Hash = subTree.Hash
+		}
+		objects = append(objects, &GitObject{Hash: entry.Hash, Name: entry.Name, Type: entry.Type, Mode: entry.Mode})
+	}
+
+	treeObj, err := HashTree("", objects)
+	if err != nil {
+		return nil, err
+	}
+	if write && !ObjectExists(treeObj.Hash) {
+		if err := treeObj.Write(); err != nil {
+			return nil, fmt.Errorf("error writing tree: %w", err)
+		}
+	}
+	return treeObj, nil
+}
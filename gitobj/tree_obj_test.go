@@ -0,0 +1,36 @@
+package gitobj
+
+import "testing"
+
+func TestBuildTree(t *testing.T) {
+	// Tree ids as given by `git write-tree` for the same files.
+	blob := func(name, contents string) TreeEntry {
+		object, err := HashObject("blob", []byte(contents))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return TreeEntry{Mode: "100644", Hash: object.Hash, Name: name}
+	}
+	files := []TreeEntry{
+		blob("README", "readme\n"),
+		blob("src.txt", "x"),
+		blob("src/lib/lib.go", "package lib\n"),
+		blob("src/main.go", "package main\n"),
+	}
+	tree, err := BuildTree(files, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "b374e03e8bf2254256dd7618267bb6b53c0796bc"; tree.Hash != want {
+		t.Errorf("Wanted tree %s, got %s", want, tree.Hash)
+	}
+
+	entries, err := ParseTree(tree.Body())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 || entries[2].Name != "src" || entries[2].Mode != "040000" ||
+		entries[2].Hash != "7876f45089937ff6f2f7e751ac58ee91ff4c40ef" {
+		t.Errorf("Wanted README, src.txt and the src tree, got %+v", entries)
+	}
+}
@@ -1,3 +1,5 @@
 module github.com/tsoud/GoTGit.git
 
 go 1.21.1
+
+require github.com/pjbgf/sha1cd v0.3.2
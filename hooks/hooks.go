@@ -0,0 +1,278 @@
+package hooks
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"syscall"
+
+	"github.com/tsoud/GoTGit.git/config"
+	"github.com/tsoud/GoTGit.git/gitobj"
+)
+
+// Options are what a hook is run with besides its name: its arguments, its
+// standard input and extra "KEY=value" variables for its environment.
+type Options struct {
+	Args  []string
+	Stdin io.Reader
+	Env   []string
+}
+
+// ExitError is returned when a hook exits with a non-zero status, which for
+// most hooks means the operation should not go ahead.
+type ExitError struct {
+	Hook   string
+	Status int
+}
+
+func (err *ExitError) Error() string {
+	return fmt.Sprintf("%s hook exited with status %d", err.Hook, err.Status)
+}
+
+// RefUpdate is a ref that a push changes, as the receiving hooks see it.
+// A created ref has a null OldHash and a deleted one a null NewHash.
+type RefUpdate struct {
+	Name    string
+	OldHash string
+	NewHash string
+}
+
+// PushUpdate is a ref that a push sends, as the pre-push hook sees it. A
+// deleted remote ref has LocalRef "(delete)" and a null LocalHash.
+type PushUpdate struct {
+	LocalRef   string
+	LocalHash  string
+	RemoteRef  string
+	RemoteHash string
+}
+
+func Dir() (string, error) {
+	// Return the directory hooks are looked up in: `core.hooksPath` if it is set,
+	// otherwise the hooks directory of the repository. A relative hooksPath is
+	// relative to where hooks run, the top of the working tree.
+	cfg, err := config.Load()
+	if err != nil {
+		return "", err
+	}
+	if hooksPath, ok := cfg.Get("core.hookspath"); ok && hooksPath != "" {
+		return config.ExpandPath(hooksPath)
+	}
+	return path.Join(gitobj.GitDir, "hooks"), nil
+}
+
+func Find(name string) (string, error) {
+	// Return the path of the hook called `name`, or "" if there is none. A hook
+	// that isn't executable is ignored, with a hint unless `advice.ignoredHook`
+	// is turned off.
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+	hookPath := path.Join(dir, name)
+	info, err := os.Stat(hookPath)
+	if err != nil || info.IsDir() {
+		return "", nil
+	}
+	if runtime.GOOS != "windows" && info.Mode()&0111 == 0 {
+		if cfg, err := config.Load(); err == nil && cfg.GetBool("advice.ignoredhook", true) {
+			fmt.Fprintf(os.Stderr, "hint: The '%s' hook was ignored because it's not set as executable.\n"+
+				"hint: You can disable this warning with `gotgit config advice.ignoredHook false`.\n", hookPath)
+		}
+		return "", nil
+	}
+	return hookPath, nil
+}
+
+func Exists(name string) bool {
+	hookPath, _ := Find(name)
+	return hookPath != ""
+}
+
+func Run(name string, opts Options) error {
+	// Run the hook called `name` if there is one, from the top of the working
+	// tree, where commands run, or from the git directory of a bare repository.
+	// Its output goes to stderr so it can't be mistaken for the command's own.
+	// A non-zero exit status is returned as an *ExitError.
+	hookPath, err := Find(name)
+	if err != nil || hookPath == "" {
+		return err
+	}
+	gitDir, err := filepath.Abs(gitobj.GitDir)
+	if err != nil {
+		return err
+	}
+	workDir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	if cfg, err := config.Load(); err == nil && cfg.GetBool("core.bare", false) {
+		workDir = gitDir
+	}
+	hookCmd := exec.Command(hookPath, opts.Args...)
+	hookCmd.Dir = workDir
+	hookCmd.Stdin, hookCmd.Stdout, hookCmd.Stderr = opts.Stdin, os.Stderr, os.Stderr
+	hookCmd.Env = append(os.Environ(), "GIT_DIR="+gitDir)
+	hookCmd.Env = append(hookCmd.Env, opts.Env...)
+
+	err = hookCmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return &ExitError{Hook: name, Status: exitStatus(exitErr)}
+	} else if err != nil {
+		return fmt.Errorf("could not run %s hook: %w", name, err)
+	}
+	return nil
+}
+
+func exitStatus(exitErr *exec.ExitError) int {
+	// A hook killed by a signal has no exit code; report it the way the shell
+	// does, as 128 plus the signal number.
+	if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		return 128 + int(status.Signal())
+	}
+	return exitErr.ExitCode()
+}
+
+func runPost(name string, opts Options) {
+	// The post-* hooks run once the work is done, so they can't change the
+	// outcome: their exit status is ignored, and a hook that can't be run
+	// only gets a warning.
+	var exitErr *ExitError
+	if err := Run(name, opts); err != nil && !errors.As(err, &exitErr) {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", err)
+	}
+}
+
+func indexEnv() []string {
+	// Commit hooks are told which index is being committed.
+	indexFile, err := filepath.Abs(path.Join(gitobj.GitDir, "index"))
+	if err != nil {
+		return nil
+	}
+	return []string{"GIT_INDEX_FILE=" + indexFile}
+}
+
+func flag(set bool) string {
+	if set {
+		return "1"
+	}
+	return "0"
+}
+
+func pushOptionsEnv(pushOptions []string) []string {
+	// Push options given with `push -o` reach the receiving hooks as
+	// GIT_PUSH_OPTION_COUNT and GIT_PUSH_OPTION_<n>.
+	if pushOptions == nil {
+		return nil
+	}
+	env := []string{"GIT_PUSH_OPTION_COUNT=" + strconv.Itoa(len(pushOptions))}
+	for i, option := range pushOptions {
+		env = append(env, fmt.Sprintf("GIT_PUSH_OPTION_%d=%s", i, option))
+	}
+	return env
+}
+
+func refUpdateInput(updates []RefUpdate) io.Reader {
+	var input bytes.Buffer
+	for _, update := range updates {
+		fmt.Fprintf(&input, "%s %s %s\n", update.OldHash, update.NewHash, update.Name)
+	}
+	return &input
+}
+
+func PreCommit() error {
+	// Run before a commit is made; a failure stops it.
+	return Run("pre-commit", Options{Env: indexEnv()})
+}
+
+func PreMergeCommit() error {
+	// Run before a merge commit is made; a failure stops it.
+	return Run("pre-merge-commit", Options{Env: indexEnv()})
+}
+
+func PrepareCommitMsg(msgFile, source, commit string) error {
+	// Run after the default message is written to `msgFile` and before it is
+	// edited. `source` says where the message came from ("message", "template",
+	// "merge", "squash" or "commit"), with the commit it came from for "commit".
+	args := []string{msgFile}
+	if source != "" {
+		args = append(args, source)
+		if commit != "" {
+			args = append(args, commit)
+		}
+	}
+	return Run("prepare-commit-msg", Options{Args: args, Env: indexEnv()})
+}
+
+func CommitMsg(msgFile string) error {
+	// Run on the final message in `msgFile`, which the hook may change; a
+	// failure stops the commit.
+	return Run("commit-msg", Options{Args: []string{msgFile}, Env: indexEnv()})
+}
+
+func PostCommit() {
+	// Run once a commit is made.
+	runPost("post-commit", Options{Env: indexEnv()})
+}
+
+func PreRebase(upstream, branch string) error {
+	// Run before a rebase of `branch` (empty for the current branch) onto
+	// `upstream`; a failure stops it.
+	args := []string{upstream}
+	if branch != "" {
+		args = append(args, branch)
+	}
+	return Run("pre-rebase", Options{Args: args})
+}
+
+func PostCheckout(oldHead, newHead string, branch bool) {
+	// Run after HEAD moves from `oldHead` to `newHead`, or after files are
+	// checked out when `branch` is false. An unborn HEAD is the null hash.
+	if oldHead == "" {
+		oldHead = gitobj.ObjectFormat.NullHash()
+	}
+	if newHead == "" {
+		newHead = gitobj.ObjectFormat.NullHash()
+	}
+	runPost("post-checkout", Options{Args: []string{oldHead, newHead, flag(branch)}})
+}
+
+func PostMerge(squash bool) {
+	// Run after a merge completes.
+	runPost("post-merge", Options{Args: []string{flag(squash)}})
+}
+
+func PrePush(remote, url string, updates []PushUpdate) error {
+	// Run before refs are sent to `remote`, given by name or, failing that, by
+	// `url`. The hook reads the refs being pushed on stdin; a failure stops the
+	// push.
+	var input bytes.Buffer
+	for _, update := range updates {
+		fmt.Fprintf(&input, "%s %s %s %s\n", update.LocalRef, update.LocalHash,
+			update.RemoteRef, update.RemoteHash)
+	}
+	return Run("pre-push", Options{Args: []string{remote, url}, Stdin: &input})
+}
+
+func PreReceive(updates []RefUpdate, pushOptions []string) error {
+	// Run once before a push updates any refs, reading "<old> <new> <ref>" lines
+	// on stdin. A failure rejects the whole push.
+	return Run("pre-receive", Options{Stdin: refUpdateInput(updates), Env: pushOptionsEnv(pushOptions)})
+}
+
+func Update(update RefUpdate) error {
+	// Run before a push updates each ref; a failure rejects that ref only.
+	return Run("update", Options{Args: []string{update.Name, update.OldHash, update.NewHash}})
+}
+
+func PostReceive(updates []RefUpdate, pushOptions []string) {
+	// Run once a push has updated its refs.
+	runPost("post-receive", Options{Stdin: refUpdateInput(updates), Env: pushOptionsEnv(pushOptions)})
+}
@@ -0,0 +1,190 @@
+package hooks
+
+import (
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/tsoud/GoTGit.git/gitobj"
+	"github.com/tsoud/GoTGit.git/internal/testutil"
+)
+
+func initRepo(t *testing.T, config string) {
+	// Run the test from a scratch repository with the given config and no
+	// system or global config.
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("hooks are shell scripts")
+	}
+	testutil.InitRepo(t)
+	testutil.IsolateConfig(t)
+	testutil.WriteFiles(t, gitobj.GitDir, map[string]string{"config": config})
+}
+
+func writeHook(t *testing.T, file, script string, mode os.FileMode) {
+	t.Helper()
+	if err := os.MkdirAll(path.Dir(file), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, []byte("#!/bin/sh\n"+script), mode); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readOutput(t *testing.T) string {
+	t.Helper()
+	output, err := os.ReadFile("out")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(output)
+}
+
+func TestRun(t *testing.T) {
+	initRepo(t, "")
+	hooksDir := path.Join(gitobj.GitDir, "hooks")
+
+	if err := PreCommit(); err != nil {
+		t.Errorf("A missing hook should succeed, got %v", err)
+	}
+
+	writeHook(t, path.Join(hooksDir, "pre-commit"), "echo \"$GIT_DIR $GIT_INDEX_FILE\" > out\nexit 3\n", 0755)
+	var exitErr *ExitError
+	if err := PreCommit(); !errors.As(err, &exitErr) || exitErr.Status != 3 || exitErr.Hook != "pre-commit" {
+		t.Errorf("Wanted the hook's exit status, got %v", err)
+	}
+	gitDir, _ := filepath.Abs(gitobj.GitDir)
+	if want := gitDir + " " + gitDir + "/index\n"; readOutput(t) != want {
+		t.Errorf("Wanted the environment %q, got %q", want, readOutput(t))
+	}
+
+	writeHook(t, path.Join(hooksDir, "pre-commit"), "kill -TERM $$\n", 0755)
+	if err := PreCommit(); !errors.As(err, &exitErr) || exitErr.Status != 128+15 {
+		t.Errorf("Wanted a hook killed by SIGTERM to exit with status 143, got %v", err)
+	}
+
+	writeHook(t, path.Join(hooksDir, "prepare-commit-msg"), "echo \"$@\" > out\n", 0755)
+	if err := PrepareCommitMsg("MSG", "commit", "abc"); err != nil {
+		t.Fatal(err)
+	}
+	if got := readOutput(t); got != "MSG commit abc\n" {
+		t.Errorf("Wanted the arguments of prepare-commit-msg, got %q", got)
+	}
+
+	writeHook(t, path.Join(hooksDir, "post-checkout"), "echo \"$@\" > out\n", 0755)
+	PostCheckout("", "new", true)
+	if want := gitobj.ObjectFormat.NullHash() + " new 1\n"; readOutput(t) != want {
+		t.Errorf("Wanted an unborn HEAD as the null hash, got %q", readOutput(t))
+	}
+}
+
+func TestPushHooks(t *testing.T) {
+	initRepo(t, "")
+	hooksDir := path.Join(gitobj.GitDir, "hooks")
+	updates := []RefUpdate{{"refs/heads/main", "a", "b"}, {"refs/tags/v1", "c", "d"}}
+
+	writeHook(t, path.Join(hooksDir, "pre-push"), "cat > out\necho \"$@\" >> out\nexit 1\n", 0755)
+	var exitErr *ExitError
+	err := PrePush("origin", "/srv/repo", []PushUpdate{{"refs/heads/a", "1", "refs/heads/b", "2"}, {"(delete)", "0", "refs/heads/c", "3"}})
+	if !errors.As(err, &exitErr) {
+		t.Errorf("Wanted a failing pre-push hook to stop the push, got %v", err)
+	}
+	if got := readOutput(t); got != "refs/heads/a 1 refs/heads/b 2\n(delete) 0 refs/heads/c 3\norigin /srv/repo\n" {
+		t.Errorf("Wanted the pushed refs on stdin and the remote as arguments, got %q", got)
+	}
+
+	writeHook(t, path.Join(hooksDir, "pre-receive"), "cat > out\necho \"$GIT_PUSH_OPTION_COUNT $GIT_PUSH_OPTION_0 $GIT_PUSH_OPTION_1\" >> out\n", 0755)
+	if err := PreReceive(updates, []string{"x", "y"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := readOutput(t); got != "a b refs/heads/main\nc d refs/tags/v1\n2 x y\n" {
+		t.Errorf("Wanted the ref updates on stdin and the push options, got %q", got)
+	}
+	if err := PreReceive(updates, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := readOutput(t); got != "a b refs/heads/main\nc d refs/tags/v1\n  \n" {
+		t.Errorf("Wanted no push options when none were given, got %q", got)
+	}
+
+	writeHook(t, path.Join(hooksDir, "update"), "echo \"$@\" > out\nexit 2\n", 0755)
+	if err := Update(updates[0]); !errors.As(err, &exitErr) || exitErr.Status != 2 {
+		t.Errorf("Wanted a failing update hook to reject the ref, got %v", err)
+	}
+	if got := readOutput(t); got != "refs/heads/main a b\n" {
+		t.Errorf("Wanted the ref and its hashes as arguments, got %q", got)
+	}
+
+	writeHook(t, path.Join(hooksDir, "post-receive"), "cat > out\necho \"$GIT_PUSH_OPTION_COUNT\" >> out\nexit 1\n", 0755)
+	PostReceive(updates[1:], []string{})
+	if got := readOutput(t); got != "c d refs/tags/v1\n0\n" {
+		t.Errorf("Wanted the ref updates on stdin, got %q", got)
+	}
+}
+
+func TestRunDir(t *testing.T) {
+	dir := testutil.InitRepo(t)
+	testutil.IsolateConfig(t)
+	if err := os.Mkdir("sub", 0755); err != nil {
+		t.Fatal(err)
+	}
+	out, _ := filepath.Abs("out")
+	hookOpts := Options{Env: []string{"OUT=" + out}}
+
+	// Hooks run from the top of the working tree.
+	writeHook(t, path.Join(gitobj.GitDir, "hooks", "post-commit"), "pwd -P > \"$OUT\"\n", 0755)
+	if err := Run("post-commit", hookOpts); err != nil {
+		t.Fatal(err)
+	}
+	want, _ := filepath.EvalSymlinks(dir)
+	if got := strings.TrimSpace(testutil.ReadFile(t, out)); got != want {
+		t.Errorf("Wanted the hook to run in %s, got %s", want, got)
+	}
+
+	// A bare repository has no working tree, so they run in the git directory.
+	bareDir := path.Join(dir, "bare.git")
+	testutil.WriteFiles(t, bareDir, map[string]string{"HEAD": "ref: refs/heads/main\n", "config": "[core]\n\tbare = true\n"})
+	writeHook(t, path.Join(bareDir, "hooks", "post-commit"), "pwd -P > \"$OUT\"\n", 0755)
+	gitDir := gitobj.GitDir
+	gitobj.SetGitDir(bareDir)
+	t.Cleanup(func() { gitobj.SetGitDir(gitDir) })
+	if err := os.Chdir("sub"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Run("post-commit", hookOpts); err != nil {
+		t.Fatal(err)
+	}
+	want, _ = filepath.EvalSymlinks(bareDir)
+	if got := strings.TrimSpace(testutil.ReadFile(t, out)); got != want {
+		t.Errorf("Wanted the hook to run in %s, got %s", want, got)
+	}
+}
+
+func TestFind(t *testing.T) {
+	initRepo(t, "[core]\n\thooksPath = shared-hooks\n[advice]\n\tignoredHook = false\n")
+
+	writeHook(t, path.Join(gitobj.GitDir, "hooks", "post-merge"), "exit 1\n", 0755)
+	writeHook(t, path.Join("shared-hooks", "post-merge"), "echo \"$@\" > out\n", 0755)
+	PostMerge(true)
+	if got := readOutput(t); got != "1\n" {
+		t.Errorf("Wanted the hook from core.hooksPath to run, got %q", got)
+	}
+
+	writeHook(t, path.Join("shared-hooks", "pre-rebase"), "exit 1\n", 0644)
+	if hookPath, err := Find("pre-rebase"); err != nil || hookPath != "" {
+		t.Errorf("Wanted a hook that isn't executable to be ignored, got %q (%v)", hookPath, err)
+	}
+	if err := PreRebase("main", ""); err != nil {
+		t.Errorf("Wanted a hook that isn't executable not to run, got %v", err)
+	}
+	if !Exists("post-merge") || Exists("post-commit") {
+		t.Error("Exists should report executable hooks only")
+	}
+	if hookPath, _ := Find("post-merge"); !strings.HasSuffix(hookPath, "shared-hooks/post-merge") {
+		t.Errorf("Wanted the hook under core.hooksPath, got %q", hookPath)
+	}
+}
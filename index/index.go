@@ -0,0 +1,296 @@
+package index
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/tsoud/GoTGit.git/gitobj"
+)
+
+const (
+	signature = "DIRC"
+	// Entries start with ten 4-byte stat fields, then the object hash and
+	// 2 bytes of flags.
+	entryStatSize = 40
+	stageMask     = 0x3000
+	stageShift    = 12
+	assumeValid   = 0x8000
+	extendedFlag  = 0x4000
+	nameMask      = 0x0fff
+)
+
+type Entry struct {
+	CTimeSec    uint32
+	CTimeNsec   uint32
+	MTimeSec    uint32
+	MTimeNsec   uint32
+	Dev         uint32
+	Ino         uint32
+	Mode        uint32
+	UID         uint32
+	GID         uint32
+	Size        uint32
+	Hash        string
+	Stage       int
+	AssumeValid bool
+	Path        string
+}
+
+type Index struct {
+	Version uint32
+	Entries []*Entry
+}
+
+func Path() string {
+	return path.Join(gitobj.GitDir, "index")
+}
+
+func ParseMode(mode string) uint32 {
+	// Convert an octal mode string such as "100644" to its numeric value.
+	value, _ := strconv.ParseUint(mode, 8, 32)
+	return uint32(value)
+}
+
+func (entry *Entry) ModeString() string {
+	return fmt.Sprintf("%06o", entry.Mode)
+}
+
+func Read() (*Index, error) {
+	return ReadFile(Path())
+}
+
+func ReadFile(file string) (*Index, error) {
+	// Read an index file. A missing file is an empty index.
+	contents, err := os.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &Index{Version: 2}, nil
+		}
+		return nil, fmt.Errorf("could not read index: %w", err)
+	}
+	return Parse(contents)
+}
+
+func Parse(contents []byte) (*Index, error) {
+	// Parse the binary index format (versions 2 and 3). Hashes, including the
+	// checksum at the end, use the repository's object format.
+	hashSize := gitobj.ObjectFormat.Size
+	if len(contents) < 12+hashSize || string(contents[:4]) != signature {
+		return nil, fmt.Errorf("index file is corrupt: bad signature")
+	}
+	body := contents[:len(contents)-hashSize]
+	checksum := gitobj.ObjectFormat.New()
+	checksum.Write(body)
+	if !bytes.Equal(checksum.Sum(nil), contents[len(body):]) {
+		return nil, fmt.Errorf("index file is corrupt: bad checksum")
+	}
+
+	idx := &Index{Version: binary.BigEndian.Uint32(body[4:8])}
+	if idx.Version != 2 && idx.Version != 3 {
+		return nil, fmt.Errorf("index version %d is not supported", idx.Version)
+	}
+	count := binary.BigEndian.Uint32(body[8:12])
+
+	entryFixedSize := entryStatSize + hashSize + 2
+	offset := 12
+	for i := uint32(0); i < count; i++ {
+		if offset+entryFixedSize > len(body) {
+			return nil, fmt.Errorf("index file is corrupt: truncated entry")
+		}
+		raw := body[offset:]
+		fields := make([]uint32, 10)
+		for j := range fields {
+			fields[j] = binary.BigEndian.Uint32(raw[j*4:])
+		}
+		flags := binary.BigEndian.Uint16(raw[entryFixedSize-2:])
+		nameStart := entryFixedSize
+		if flags&extendedFlag != 0 {
+			nameStart += 2
+		}
+		nameEnd := bytes.IndexByte(raw[nameStart:], 0)
+		if nameEnd == -1 {
+			return nil, fmt.Errorf("index file is corrupt: unterminated path")
+		}
+
+		idx.Entries = append(idx.Entries, &Entry{
+			CTimeSec: fields[0], CTimeNsec: fields[1],
+			MTimeSec: fields[2], MTimeNsec: fields[3],
+			Dev: fields[4], Ino: fields[5], Mode: fields[6],
+			UID: fields[7], GID: fields[8], Size: fields[9],
+			Hash:        hex.EncodeToString(raw[entryStatSize : entryStatSize+hashSize]),
+			Stage:       int(flags&stageMask) >> stageShift,
+			AssumeValid: flags&assumeValid != 0,
+			Path:        string(raw[nameStart : nameStart+nameEnd]),
+		})
+
+		// Entries are padded with NUL bytes to a multiple of eight bytes.
+		entryLen := nameStart + nameEnd + 1
+		offset += (entryLen + 7) / 8 * 8
+	}
+
+	// Extensions (cached trees, resolve-undo, ...) are optional and dropped; they
+	// are rebuilt by Git as needed.
+	for offset+8 <= len(body) {
+		sig := body[offset : offset+4]
+		size := binary.BigEndian.Uint32(body[offset+4 : offset+8])
+		if sig[0] < 'A' || sig[0] > 'Z' {
+			return nil, fmt.Errorf("index uses required extension %s, which is not supported", sig)
+		}
+		offset += 8 + int(size)
+	}
+
+	return idx, nil
+}
+
+func (idx *Index) Sort() {
+	slices.SortStableFunc(idx.Entries, func(x, y *Entry) int {
+		if c := strings.Compare(x.Path, y.Path); c != 0 {
+			return c
+		}
+		return x.Stage - y.Stage
+	})
+}
+
+func (idx *Index) Encode(w io.Writer) error {
+	// Serialize the index in version 2 format, followed by its checksum.
+	idx.Sort()
+	var buf bytes.Buffer
+	buf.WriteString(signature)
+	binary.Write(&buf, binary.BigEndian, uint32(2))
+	binary.Write(&buf, binary.BigEndian, uint32(len(idx.Entries)))
+
+	for _, entry := range idx.Entries {
+		hash, err := hex.DecodeString(entry.Hash)
+		if err != nil || len(hash) != gitobj.ObjectFormat.Size {
+			return fmt.Errorf("invalid object name %s for %s", entry.Hash, entry.Path)
+		}
+		for _, field := range []uint32{
+			entry.CTimeSec, entry.CTimeNsec, entry.MTimeSec, entry.MTimeNsec,
+			entry.Dev, entry.Ino, entry.Mode, entry.UID, entry.GID, entry.Size,
+		} {
+			binary.Write(&buf, binary.BigEndian, field)
+		}
+		buf.Write(hash)
+
+		flags := uint16(min(len(entry.Path), nameMask)) | uint16(entry.Stage<<stageShift)
+		if entry.AssumeValid {
+			flags |= assumeValid
+		}
+		binary.Write(&buf, binary.BigEndian, flags)
+		buf.WriteString(entry.Path)
+
+		entryLen := entryStatSize + len(hash) + 2 + len(entry.Path)
+		buf.Write(make([]byte, (entryLen+8)/8*8-entryLen))
+	}
+
+	checksum := gitobj.ObjectFormat.New()
+	checksum.Write(buf.Bytes())
+	buf.Write(checksum.Sum(nil))
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func (idx *Index) Write() error {
+	return idx.WriteFile(Path())
+}
+
+func (idx *Index) WriteFile(file string) error {
+	// Write the index through a lock file, replacing `file` once complete.
+	lockFile := file + ".lock"
+	lock, err := os.OpenFile(lockFile, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		if os.IsExist(err) {
+			return fmt.Errorf("unable to create '%s': file exists; another process may be running", lockFile)
+		}
+		return fmt.Errorf("could not lock index: %w", err)
+	}
+	if err := idx.Encode(lock); err != nil {
+		lock.Close()
+		os.Remove(lockFile)
+		return fmt.Errorf("could not write index: %w", err)
+	}
+	if err := lock.Close(); err != nil {
+		os.Remove(lockFile)
+		return fmt.Errorf("could not write index: %w", err)
+	}
+	if err := gitobj.AdjustSharedPerm(lockFile); err != nil {
+		os.Remove(lockFile)
+		return err
+	}
+	return os.Rename(lockFile, file)
+}
+
+func (idx *Index) Find(filePath string, stage int) *Entry {
+	for _, entry := range idx.Entries {
+		if entry.Path == filePath && entry.Stage == stage {
+			return entry
+		}
+	}
+	return nil
+}
+
+func (idx *Index) Stages(filePath string) []*Entry {
+	// Return all entries for a path: one at stage 0, or up to three conflict stages.
+	var entries []*Entry
+	for _, entry := range idx.Entries {
+		if entry.Path == filePath {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+func (idx *Index) Remove(filePath string) bool {
+	// Remove every stage of `filePath`, reporting whether anything was removed.
+	before := len(idx.Entries)
+	idx.Entries = slices.DeleteFunc(idx.Entries, func(entry *Entry) bool {
+		return entry.Path == filePath
+	})
+	return len(idx.Entries) != before
+}
+
+func (idx *Index) Add(entry *Entry) {
+	// Add or replace an entry. A stage 0 entry resolves any conflict on its path,
+	// and entries that clash with it as file versus directory are dropped.
+	idx.Entries = slices.DeleteFunc(idx.Entries, func(existing *Entry) bool {
+		if existing.Path == entry.Path {
+			return entry.Stage == 0 || existing.Stage == entry.Stage || existing.Stage == 0
+		}
+		return strings.HasPrefix(existing.Path, entry.Path+"/") ||
+			strings.HasPrefix(entry.Path, existing.Path+"/")
+	})
+	idx.Entries = append(idx.Entries, entry)
+	idx.Sort()
+}
+
+func (idx *Index) Unmerged() []string {
+	// List the paths that have unresolved conflict stages.
+	var paths []string
+	for _, entry := range idx.Entries {
+		if entry.Stage > 0 && (len(paths) == 0 || paths[len(paths)-1] != entry.Path) {
+			paths = append(paths, entry.Path)
+		}
+	}
+	return paths
+}
+
+func EntriesFromTree(treeHash string) ([]*Entry, error) {
+	// Create stage 0 entries (without stat information) for every file in a tree.
+	files, err := gitobj.ReadTreeRecursive(treeHash)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]*Entry, len(files))
+	for i, file := range files {
+		entries[i] = &Entry{Mode: ParseMode(file.Mode), Hash: file.Hash, Path: file.Name}
+	}
+	return entries, nil
+}
@@ -0,0 +1,169 @@
+package index
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/tsoud/GoTGit.git/gitobj"
+	"github.com/tsoud/GoTGit.git/internal/testutil"
+)
+
+var testHash = "e69de29bb2d1d6434b8b29ae4ba8e3b6ca3ac3b1"
+
+func TestEncodeParse(t *testing.T) {
+	idx := &Index{Version: 2}
+	idx.Add(&Entry{Path: "b.txt", Mode: ParseMode("100644"), Hash: testHash, Size: 3, MTimeSec: 1700000000})
+	idx.Add(&Entry{Path: "a/long/path/name.go", Mode: ParseMode("100755"), Hash: testHash})
+	idx.Add(&Entry{Path: "link", Mode: ParseMode("120000"), Hash: testHash})
+
+	var buf bytes.Buffer
+	if err := idx.Encode(&buf); err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := Parse(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(parsed.Entries) != len(idx.Entries) {
+		t.Fatalf("Wanted %d entries, got %d", len(idx.Entries), len(parsed.Entries))
+	}
+	for i, entry := range parsed.Entries {
+		if *entry != *idx.Entries[i] {
+			t.Errorf("Entry %d changed in a round trip:\nWanted: %+v\nGot:    %+v", i, idx.Entries[i], entry)
+		}
+	}
+	if parsed.Entries[0].Path != "a/long/path/name.go" || parsed.Entries[0].ModeString() != "100755" {
+		t.Errorf("Entries are not sorted by path: %+v", parsed.Entries)
+	}
+
+	corrupt := buf.Bytes()
+	corrupt[len(corrupt)-1] ^= 0xff
+	if _, err := Parse(corrupt); err == nil {
+		t.Error("Wanted a checksum error for a corrupt index")
+	}
+}
+
+func TestAddStages(t *testing.T) {
+	idx := &Index{Version: 2}
+	for stage := 1; stage <= 3; stage++ {
+		idx.Add(&Entry{Path: "file", Mode: ParseMode("100644"), Hash: testHash, Stage: stage})
+	}
+	idx.Add(&Entry{Path: "other", Mode: ParseMode("100644"), Hash: testHash})
+
+	if unmerged := idx.Unmerged(); len(unmerged) != 1 || unmerged[0] != "file" {
+		t.Errorf("Wanted file to be unmerged, got %v", unmerged)
+	}
+	if stages := idx.Stages("file"); len(stages) != 3 {
+		t.Errorf("Wanted 3 stages, got %d", len(stages))
+	}
+
+	// Resolving the conflict replaces every stage.
+	idx.Add(&Entry{Path: "file", Mode: ParseMode("100644"), Hash: testHash})
+	if len(idx.Unmerged()) != 0 || idx.Find("file", 0) == nil {
+		t.Errorf("Stage 0 entry did not resolve the conflict: %+v", idx.Entries)
+	}
+
+	// A directory replaces a file of the same name.
+	idx.Add(&Entry{Path: "other/nested", Mode: ParseMode("100644"), Hash: testHash})
+	if idx.Find("other", 0) != nil {
+		t.Error("Wanted the file \"other\" to be replaced by a directory")
+	}
+}
+
+func stageList(idx *Index) string {
+	var stages []string
+	for _, entry := range idx.Entries {
+		stages = append(stages, fmt.Sprintf("%d %s", entry.Stage, entry.Path))
+	}
+	return strings.Join(stages, ", ")
+}
+
+func TestMerges(t *testing.T) {
+	testutil.ChdirTemp(t)
+
+	base := testutil.WriteTree(t, map[string]string{
+		"same": "same\n", "ours": "base\n", "theirs": "base\n", "both": "base\n", "deleted": "base\n",
+	})
+	ours := testutil.WriteTree(t, map[string]string{
+		"same": "same\n", "ours": "changed\n", "theirs": "base\n", "both": "ours\n", "added": "new\n",
+	})
+	theirs := testutil.WriteTree(t, map[string]string{
+		"same": "same\n", "ours": "base\n", "theirs": "changed\n", "both": "theirs\n", "deleted": "base\n",
+	})
+
+	idx := &Index{Version: 2}
+	if err := idx.ReadTree(ours, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := idx.ThreeWayMerge(base, ours, theirs); err != nil {
+		t.Fatal(err)
+	}
+	want := "0 added, 1 both, 2 both, 3 both, 1 deleted, 3 deleted, 0 ours, 0 same, 0 theirs"
+	if got := stageList(idx); got != want {
+		t.Errorf("Three-way merge:\nWanted: %s\nGot:    %s", want, got)
+	}
+	if entry := idx.Find("theirs", 0); entry == nil || entry.Hash == idx.Find("same", 0).Hash {
+		t.Error("Wanted their change to be taken")
+	}
+
+	// A change staged in the index blocks a merge that touches the same path.
+	if err := idx.ReadTree(ours, ""); err != nil {
+		t.Fatal(err)
+	}
+	idx.Find("both", 0).Hash = testHash
+	if err := idx.ThreeWayMerge(base, ours, theirs); err == nil {
+		t.Error("Wanted the staged change to block the merge")
+	}
+
+	// Two-way merges keep staged changes to paths the trees agree on.
+	if err := idx.ReadTree(base, ""); err != nil {
+		t.Fatal(err)
+	}
+	idx.Find("same", 0).Hash = testHash
+	if err := idx.TwoWayMerge(base, ours, false); err != nil {
+		t.Fatal(err)
+	}
+	if got := idx.Find("same", 0).Hash; got != testHash {
+		t.Errorf("Staged change was lost: %s", got)
+	}
+	if idx.Find("deleted", 0) != nil || idx.Find("added", 0) == nil {
+		t.Errorf("Two-way merge did not follow the new tree: %s", stageList(idx))
+	}
+	idx.Find("ours", 0).Hash = testHash
+	if err := idx.TwoWayMerge(ours, theirs, false); err == nil {
+		t.Error("Wanted the staged change to block the two-way merge")
+	}
+	if err := idx.TwoWayMerge(ours, theirs, true); err != nil {
+		t.Errorf("Reset did not override the staged change: %v", err)
+	}
+}
+
+func TestEncodeParseSHA256(t *testing.T) {
+	gitobj.ObjectFormat = gitobj.SHA256
+	t.Cleanup(func() { gitobj.ObjectFormat = gitobj.SHA1 })
+
+	hash := "473a0f4c3be8a93681a267e3b1e9a7dcda1185436fe141f7749120a303721813"
+	idx := &Index{Version: 2}
+	idx.Add(&Entry{Path: "file", Mode: ParseMode("100644"), Hash: hash})
+	idx.Add(&Entry{Path: "name-of-nine", Mode: ParseMode("100644"), Hash: hash})
+
+	var buf bytes.Buffer
+	if err := idx.Encode(&buf); err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := Parse(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parsed.Entries) != 2 || parsed.Entries[1].Path != "name-of-nine" || parsed.Entries[1].Hash != hash {
+		t.Errorf("Entries changed in a round trip: %+v", parsed.Entries)
+	}
+
+	idx.Add(&Entry{Path: "sha1", Mode: ParseMode("100644"), Hash: testHash})
+	if err := idx.Encode(&buf); err == nil {
+		t.Error("Wanted an error encoding a SHA-1 hash in a SHA-256 index")
+	}
+}
@@ -0,0 +1,234 @@
+package index
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/tsoud/GoTGit.git/gitobj"
+)
+
+func same(x, y *Entry) bool {
+	// Compare the content of two entries; two missing entries are the same.
+	if x == nil || y == nil {
+		return x == nil && y == nil
+	}
+	return x.Hash == y.Hash && x.Mode == y.Mode
+}
+
+func treeEntries(treeHash string) (map[string]*Entry, error) {
+	entries, err := EntriesFromTree(treeHash)
+	if err != nil {
+		return nil, err
+	}
+	byPath := make(map[string]*Entry, len(entries))
+	for _, entry := range entries {
+		byPath[entry.Path] = entry
+	}
+	return byPath, nil
+}
+
+func (idx *Index) allPaths(trees ...map[string]*Entry) []string {
+	// Collect the paths found in the index or in any of `trees`, sorted.
+	seen := make(map[string]bool)
+	var paths []string
+	add := func(filePath string) {
+		if !seen[filePath] {
+			seen[filePath] = true
+			paths = append(paths, filePath)
+		}
+	}
+	for _, entry := range idx.Entries {
+		add(entry.Path)
+	}
+	for _, tree := range trees {
+		for filePath := range tree {
+			add(filePath)
+		}
+	}
+	slices.Sort(paths)
+	return paths
+}
+
+func mergedEntry(result, current *Entry) *Entry {
+	// Take `result` as the merged entry, keeping the stat information of the
+	// current entry when the content is unchanged.
+	if current != nil && current.Stage == 0 && same(result, current) {
+		return current
+	}
+	merged := *result
+	merged.Stage = 0
+	return &merged
+}
+
+func stagedEntry(entry *Entry, stage int) *Entry {
+	staged := *entry
+	staged.Stage = stage
+	return &staged
+}
+
+func (idx *Index) ReadTree(treeHash, prefix string) error {
+	// Add the files of a tree to the index, under `prefix` if it is not empty.
+	// Without a prefix the index is replaced.
+	entries, err := EntriesFromTree(treeHash)
+	if err != nil {
+		return err
+	}
+	if prefix == "" {
+		idx.Entries = entries
+		idx.Sort()
+		return nil
+	}
+
+	prefix = strings.TrimSuffix(prefix, "/")
+	for _, existing := range idx.Entries {
+		if existing.Path == prefix || strings.HasPrefix(existing.Path, prefix+"/") {
+			return fmt.Errorf("Entry '%s' overlaps with '%s'. Cannot bind.", existing.Path, prefix)
+		}
+	}
+	for _, entry := range entries {
+		entry.Path = prefix + "/" + entry.Path
+		idx.Add(entry)
+	}
+	return nil
+}
+
+func (idx *Index) OneWayMerge(treeHash string) error {
+	// Replace the index with the tree, keeping stat information for entries whose
+	// content did not change.
+	tree, err := treeEntries(treeHash)
+	if err != nil {
+		return err
+	}
+
+	var entries []*Entry
+	for _, filePath := range idx.allPaths(tree) {
+		if entry := tree[filePath]; entry != nil {
+			entries = append(entries, mergedEntry(entry, idx.Find(filePath, 0)))
+		}
+	}
+	idx.Entries = entries
+	return nil
+}
+
+func (idx *Index) TwoWayMerge(oldTree, newTree string, reset bool) error {
+	// Move the index from `oldTree` to `newTree`, keeping changes staged in the
+	// index for paths that do not differ between the trees. With `reset`, entries
+	// that would block the merge are replaced instead.
+	oldEntries, err := treeEntries(oldTree)
+	if err != nil {
+		return err
+	}
+	newEntries, err := treeEntries(newTree)
+	if err != nil {
+		return err
+	}
+
+	var entries []*Entry
+	for _, filePath := range idx.allPaths(oldEntries, newEntries) {
+		oldEntry, newEntry := oldEntries[filePath], newEntries[filePath]
+		current := idx.Find(filePath, 0)
+		unmerged := current == nil && len(idx.Stages(filePath)) > 0
+
+		var result *Entry
+		switch {
+		case unmerged:
+			if !same(oldEntry, newEntry) && !reset {
+				return fmt.Errorf("Entry '%s' would be overwritten by merge. Cannot merge.", filePath)
+			}
+			result = newEntry
+		case current == nil:
+			if oldEntry != nil && newEntry != nil && !same(oldEntry, newEntry) && !reset {
+				// The deletion is staged, but the path changed in the new tree.
+				return fmt.Errorf("Entry '%s' would be overwritten by merge. Cannot merge.", filePath)
+			}
+			if oldEntry == nil || !same(oldEntry, newEntry) {
+				result = newEntry
+			}
+		case same(oldEntry, newEntry) || same(current, newEntry):
+			result = current
+		case same(current, oldEntry) || reset:
+			result = newEntry
+		default:
+			return fmt.Errorf("Entry '%s' would be overwritten by merge. Cannot merge.", filePath)
+		}
+		if result != nil {
+			entries = append(entries, mergedEntry(result, current))
+		}
+	}
+	idx.Entries = entries
+	return nil
+}
+
+func (idx *Index) ThreeWayMerge(baseTree, oursTree, theirsTree string) error {
+	// Merge `theirsTree` into `oursTree` using `baseTree` as their common ancestor.
+	// Only trivial merges are resolved (a path changed on one side only, or the
+	// same way on both); other paths are left as conflict stages 1 (base),
+	// 2 (ours) and 3 (theirs). The index must match `oursTree`.
+	baseEntries, err := treeEntries(baseTree)
+	if err != nil {
+		return err
+	}
+	oursEntries, err := treeEntries(oursTree)
+	if err != nil {
+		return err
+	}
+	theirsEntries, err := treeEntries(theirsTree)
+	if err != nil {
+		return err
+	}
+
+	var entries []*Entry
+	for _, filePath := range idx.allPaths(baseEntries, oursEntries, theirsEntries) {
+		base, ours, theirs := baseEntries[filePath], oursEntries[filePath], theirsEntries[filePath]
+		current := idx.Find(filePath, 0)
+		if current == nil && len(idx.Stages(filePath)) > 0 {
+			return fmt.Errorf("you need to resolve your current index first")
+		}
+
+		oursMatch := !same(ours, theirs) && same(base, ours)
+		theirsMatch := !same(ours, theirs) && same(base, theirs)
+		switch {
+		case theirs != nil && oursMatch && !theirsMatch:
+			// Only their side changed the path.
+			if current != nil && !same(current, theirs) && !same(current, ours) {
+				return fmt.Errorf("Entry '%s' would be overwritten by merge. Cannot merge.", filePath)
+			}
+			entries = append(entries, mergedEntry(theirs, current))
+			continue
+		case !same(current, ours):
+			return fmt.Errorf("Entry '%s' would be overwritten by merge. Cannot merge.", filePath)
+		case ours != nil && (same(ours, theirs) || theirsMatch && !oursMatch):
+			// Both sides agree, or only our side changed the path.
+			entries = append(entries, mergedEntry(ours, current))
+			continue
+		case base == nil && ours == nil && theirs == nil:
+			continue
+		}
+
+		for stage, entry := range []*Entry{base, ours, theirs} {
+			if entry != nil {
+				entries = append(entries, stagedEntry(entry, stage+1))
+			}
+		}
+	}
+	idx.Entries = entries
+	idx.Sort()
+	return nil
+}
+
+func (idx *Index) WriteTree() (string, error) {
+	// Store the index as a tree object (with its sub-trees) and return its hash.
+	if unmerged := idx.Unmerged(); len(unmerged) > 0 {
+		return "", fmt.Errorf("cannot write a tree with unmerged entries: %s", strings.Join(unmerged, ", "))
+	}
+	files := make([]gitobj.TreeEntry, len(idx.Entries))
+	for i, entry := range idx.Entries {
+		files[i] = gitobj.TreeEntry{Mode: entry.ModeString(), Hash: entry.Hash, Name: entry.Path}
+	}
+	treeObj, err := gitobj.BuildTree(files, true)
+	if err != nil {
+		return "", err
+	}
+	return treeObj.Hash, nil
+}
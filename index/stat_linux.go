@@ -0,0 +1,20 @@
+package index
+
+import (
+	"os"
+	"syscall"
+)
+
+func (entry *Entry) UpdateStat(info os.FileInfo) {
+	// Record the file system metadata used to tell whether a file changed.
+	entry.MTimeSec = uint32(info.ModTime().Unix())
+	entry.MTimeNsec = uint32(info.ModTime().Nanosecond())
+	entry.Size = uint32(info.Size())
+
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		ctime := stat.Ctim
+		entry.CTimeSec, entry.CTimeNsec = uint32(ctime.Sec), uint32(ctime.Nsec)
+		entry.Dev, entry.Ino = uint32(stat.Dev), uint32(stat.Ino)
+		entry.UID, entry.GID = stat.Uid, stat.Gid
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package index
+
+import "os"
+
+func (entry *Entry) UpdateStat(info os.FileInfo) {
+	// Record the file system metadata used to tell whether a file changed.
+	entry.MTimeSec = uint32(info.ModTime().Unix())
+	entry.MTimeNsec = uint32(info.ModTime().Nanosecond())
+	entry.CTimeSec, entry.CTimeNsec = entry.MTimeSec, entry.MTimeNsec
+	entry.Size = uint32(info.Size())
+}
@@ -0,0 +1,31 @@
+package pathglob
+
+import (
+	"path"
+	"strings"
+)
+
+func Match(pattern, name string) bool {
+	// Match a slash-separated path against a pattern whose segments are matched
+	// with path.Match, except for "**", which matches any number of segments.
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pattern, name []string) bool {
+	if len(pattern) == 0 {
+		return len(name) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(name); i++ {
+			if matchSegments(pattern[1:], name[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(name) == 0 {
+		return false
+	}
+	matched, _ := path.Match(pattern[0], name[0])
+	return matched && matchSegments(pattern[1:], name[1:])
+}
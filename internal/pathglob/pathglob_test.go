@@ -0,0 +1,30 @@
+package pathglob
+
+import "testing"
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern, name string
+		want          bool
+	}{
+		{"*.txt", "a.txt", true},
+		{"*.txt", "dir/a.txt", false},
+		{"dir/*.txt", "dir/a.txt", true},
+		{"**/a.txt", "a.txt", true},
+		{"**/a.txt", "x/y/a.txt", true},
+		{"dir/**", "dir", true},
+		{"dir/**", "dir/x/y", true},
+		{"dir/**", "other/x", false},
+		{"a/**/b", "a/b", true},
+		{"a/**/b", "a/x/y/b", true},
+		{"a/**/b", "a/x/y/c", false},
+		{"feature/?", "feature/1", true},
+		{"[ab]/c", "b/c", true},
+		{"a/b", "a", false},
+	}
+	for _, test := range tests {
+		if got := Match(test.pattern, test.name); got != test.want {
+			t.Errorf("Match(%q, %q): wanted %v, got %v", test.pattern, test.name, test.want, got)
+		}
+	}
+}
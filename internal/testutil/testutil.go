@@ -0,0 +1,117 @@
+package testutil
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/tsoud/GoTGit.git/gitobj"
+)
+
+func ChdirTemp(t *testing.T) string {
+	// Run the rest of the test from a scratch directory, so objects and files
+	// are written there. Returns the directory.
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	return dir
+}
+
+func InitRepo(t *testing.T) string {
+	// Like ChdirTemp, with an empty repository whose HEAD is the unborn
+	// branch "main".
+	t.Helper()
+	dir := ChdirTemp(t)
+	if err := os.MkdirAll(gitobj.GitObjectDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	WriteFiles(t, gitobj.GitDir, map[string]string{"HEAD": "ref: refs/heads/main\n"})
+	return dir
+}
+
+func IsolateConfig(t *testing.T) {
+	// Make the config of the repository the only one read: no system config,
+	// an empty global config and none given on the command line.
+	t.Helper()
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	t.Setenv("GIT_CONFIG_GLOBAL", path.Join(t.TempDir(), "global"))
+	t.Setenv("GIT_CONFIG_PARAMETERS", "")
+	t.Setenv("GIT_CONFIG_COUNT", "")
+}
+
+func WriteFiles(t *testing.T, dir string, files map[string]string) {
+	// Write files, named by their paths relative to `dir`, creating the
+	// directories they are in.
+	t.Helper()
+	for name, contents := range files {
+		fullPath := path.Join(dir, name)
+		if err := os.MkdirAll(path.Dir(fullPath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fullPath, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func ReadFile(t *testing.T, file string) string {
+	t.Helper()
+	contents, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(contents)
+}
+
+func WriteObject(t *testing.T, objType, body string) string {
+	// Store an object and return its hash.
+	t.Helper()
+	object, err := gitobj.HashObject(objType, []byte(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := object.Write(); err != nil {
+		t.Fatal(err)
+	}
+	return object.Hash
+}
+
+func WriteTree(t *testing.T, files map[string]string) string {
+	// Write files into a scratch directory and store them as a tree object.
+	t.Helper()
+	rootDir := t.TempDir()
+	WriteFiles(t, rootDir, files)
+	treeObj, err := gitobj.WriteTree(rootDir, "", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return treeObj.Hash
+}
+
+// commitTime is when the last commit made by WriteCommit was made.
+var commitTime = time.Unix(1700000000, 0).UTC()
+
+func WriteCommit(t *testing.T, tree, message string, parents ...string) string {
+	// Store a commit of `tree`, one second later than the previous one so that
+	// commits sort in the order they were made.
+	t.Helper()
+	commitTime = commitTime.Add(time.Second)
+	sig := gitobj.Signature{Name: "Test", Email: "test@example.com", When: commitTime}
+	commit := &gitobj.Commit{Tree: tree, Parents: parents, Author: sig, Committer: sig, Message: message + "\n"}
+	commitObj, err := gitobj.HashCommit(commit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := commitObj.Write(); err != nil {
+		t.Fatal(err)
+	}
+	return commit.Hash
+}
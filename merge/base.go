@@ -0,0 +1,160 @@
+package merge
+
+import (
+	"cmp"
+	"slices"
+
+	"github.com/tsoud/GoTGit.git/gitobj"
+)
+
+type commitGraph struct {
+	commits map[string]*gitobj.Commit
+}
+
+func newCommitGraph() *commitGraph {
+	return &commitGraph{commits: make(map[string]*gitobj.Commit)}
+}
+
+func (graph *commitGraph) commit(hash string) (*gitobj.Commit, error) {
+	// Read a commit, caching it for later walks.
+	if commit, ok := graph.commits[hash]; ok {
+		return commit, nil
+	}
+	commit, err := gitobj.ReadCommit(hash)
+	if err != nil {
+		return nil, err
+	}
+	graph.commits[hash] = commit
+	return commit, nil
+}
+
+func (graph *commitGraph) ancestors(hashes ...string) (map[string]bool, error) {
+	// Collect every commit reachable from any of `hashes`, including themselves.
+	seen := make(map[string]bool)
+	queue := slices.Clone(hashes)
+	for len(queue) > 0 {
+		hash := queue[len(queue)-1]
+		queue = queue[:len(queue)-1]
+		if seen[hash] {
+			continue
+		}
+		seen[hash] = true
+		commit, err := graph.commit(hash)
+		if err != nil {
+			return nil, err
+		}
+		queue = append(queue, commit.Parents...)
+	}
+	return seen, nil
+}
+
+func (graph *commitGraph) bestCommon(one, two map[string]bool) ([]string, error) {
+	// Return the common ancestors of two sets of reachable commits that are not
+	// ancestors of another common ancestor, newest first.
+	var common []string
+	for hash := range one {
+		if two[hash] {
+			common = append(common, hash)
+		}
+	}
+
+	// Everything reachable from a parent of a common ancestor is redundant.
+	redundant := make(map[string]bool)
+	for _, hash := range common {
+		commit, err := graph.commit(hash)
+		if err != nil {
+			return nil, err
+		}
+		queue := slices.Clone(commit.Parents)
+		for len(queue) > 0 {
+			parent := queue[len(queue)-1]
+			queue = queue[:len(queue)-1]
+			if redundant[parent] {
+				continue
+			}
+			redundant[parent] = true
+			parentCommit, err := graph.commit(parent)
+			if err != nil {
+				return nil, err
+			}
+			queue = append(queue, parentCommit.Parents...)
+		}
+	}
+
+	var best []string
+	for _, hash := range common {
+		if !redundant[hash] {
+			best = append(best, hash)
+		}
+	}
+	slices.SortFunc(best, func(x, y string) int {
+		whenX, whenY := graph.commits[x].Committer.When, graph.commits[y].Committer.When
+		if c := whenY.Compare(whenX); c != 0 {
+			return c
+		}
+		return cmp.Compare(x, y)
+	})
+	return best, nil
+}
+
+func MergeBases(one string, others ...string) ([]string, error) {
+	// Find the best common ancestors of `one` and the `others`, newest first.
+	// There can be more than one, e.g. after criss-cross merges. When there are
+	// several `others`, a commit reachable from any of them counts as common.
+	graph := newCommitGraph()
+	oneAncestors, err := graph.ancestors(one)
+	if err != nil {
+		return nil, err
+	}
+	otherAncestors, err := graph.ancestors(others...)
+	if err != nil {
+		return nil, err
+	}
+	return graph.bestCommon(oneAncestors, otherAncestors)
+}
+
+func OctopusBases(commits ...string) ([]string, error) {
+	// Find the best common ancestors of all `commits`, for an octopus merge.
+	if len(commits) == 0 {
+		return nil, nil
+	}
+	bases := []string{commits[0]}
+	for _, commit := range commits[1:] {
+		var next []string
+		for _, base := range bases {
+			found, err := MergeBases(base, commit)
+			if err != nil {
+				return nil, err
+			}
+			for _, hash := range found {
+				if !slices.Contains(next, hash) {
+					next = append(next, hash)
+				}
+			}
+		}
+		bases = next
+	}
+	return Independent(bases...)
+}
+
+func Independent(commits ...string) ([]string, error) {
+	// Drop the commits that can be reached from another one in the list.
+	graph := newCommitGraph()
+	var independent []string
+	for i, commit := range commits {
+		var others []string
+		for j, other := range commits {
+			if j != i && other != commit {
+				others = append(others, other)
+			}
+		}
+		reachable, err := graph.ancestors(others...)
+		if err != nil {
+			return nil, err
+		}
+		if !reachable[commit] && !slices.Contains(independent, commit) {
+			independent = append(independent, commit)
+		}
+	}
+	return independent, nil
+}
@@ -0,0 +1,209 @@
+package merge
+
+import (
+	"strings"
+
+	"github.com/tsoud/GoTGit.git/diff"
+)
+
+const markerSize = 7
+
+// Conflict styles, as accepted by `merge.conflictStyle` and `--conflict`.
+const (
+	StyleMerge  = "merge"
+	StyleDiff3  = "diff3"
+	StyleZdiff3 = "zdiff3"
+)
+
+// Ways to resolve conflicting hunks automatically, as with `-X ours`.
+const (
+	FavorNone = iota
+	FavorOurs
+	FavorTheirs
+	FavorUnion
+)
+
+type ContentOptions struct {
+	OursLabel   string
+	BaseLabel   string
+	TheirsLabel string
+	// Style is one of StyleMerge (the default), StyleDiff3 or StyleZdiff3.
+	Style string
+	Favor int
+}
+
+func ValidStyle(style string) bool {
+	return style == StyleMerge || style == StyleDiff3 || style == StyleZdiff3
+}
+
+type chunk struct {
+	stable bool
+	base   []string
+	ours   []string
+	theirs []string
+}
+
+func matchLines(base, other []string) []int {
+	// For each base line, find the line it corresponds to in `other`, or -1.
+	matches := make([]int, len(base))
+	for i := range matches {
+		matches[i] = -1
+	}
+	for _, edit := range diff.Lines(base, other) {
+		if edit.Op == diff.Equal {
+			matches[edit.OldLine] = edit.NewLine
+		}
+	}
+	return matches
+}
+
+func splitChunks(base, ours, theirs []string) []chunk {
+	// Split three versions into alternating runs of lines that are the same in all
+	// three (stable) and runs where at least one side changed (unstable).
+	oursMatch, theirsMatch := matchLines(base, ours), matchLines(base, theirs)
+	var chunks []chunk
+	i, o, t := 0, 0, 0
+
+	for i < len(base) || o < len(ours) || t < len(theirs) {
+		k := 0
+		for i+k < len(base) && oursMatch[i+k] == o+k && theirsMatch[i+k] == t+k {
+			k++
+		}
+		if k > 0 {
+			chunks = append(chunks, chunk{stable: true, base: base[i : i+k]})
+			i, o, t = i+k, o+k, t+k
+			continue
+		}
+
+		// Find the next base line kept by both sides to synchronize on.
+		next := i
+		for next < len(base) && (oursMatch[next] == -1 || theirsMatch[next] == -1) {
+			next++
+		}
+		nextOurs, nextTheirs := len(ours), len(theirs)
+		if next < len(base) {
+			nextOurs, nextTheirs = oursMatch[next], theirsMatch[next]
+		}
+		chunks = append(chunks, chunk{
+			base:   base[i:next],
+			ours:   ours[o:nextOurs],
+			theirs: theirs[t:nextTheirs],
+		})
+		i, o, t = next, nextOurs, nextTheirs
+	}
+
+	return chunks
+}
+
+func sameLines(x, y []string) bool {
+	if len(x) != len(y) {
+		return false
+	}
+	for i := range x {
+		if x[i] != y[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func writeSection(out *strings.Builder, lines []string) {
+	for _, line := range lines {
+		out.WriteString(line)
+	}
+	// Conflict markers must start on their own line.
+	if len(lines) > 0 && !strings.HasSuffix(lines[len(lines)-1], "\n") {
+		out.WriteString("\n")
+	}
+}
+
+func writeMarker(out *strings.Builder, marker byte, label string) {
+	out.WriteString(strings.Repeat(string(marker), markerSize))
+	if label != "" {
+		out.WriteString(" " + label)
+	}
+	out.WriteString("\n")
+}
+
+func commonPrefix(x, y []string) int {
+	n := 0
+	for n < len(x) && n < len(y) && x[n] == y[n] {
+		n++
+	}
+	return n
+}
+
+func commonSuffix(x, y []string, limit int) int {
+	n := 0
+	for n < len(x)-limit && n < len(y)-limit && x[len(x)-1-n] == y[len(y)-1-n] {
+		n++
+	}
+	return n
+}
+
+func writeConflict(out *strings.Builder, c chunk, opts *ContentOptions) {
+	// Write a conflicting chunk between markers. Except in the diff3 style, lines
+	// both sides added at the start or end of the chunk are moved out of it.
+	ours, theirs := c.ours, c.theirs
+	var prefix, suffix []string
+	if opts.Style != StyleDiff3 {
+		start := commonPrefix(ours, theirs)
+		end := commonSuffix(ours, theirs, start)
+		prefix, suffix = ours[:start], ours[len(ours)-end:]
+		ours, theirs = ours[start:len(ours)-end], theirs[start:len(theirs)-end]
+	}
+
+	writeLines(out, prefix)
+	writeMarker(out, '<', opts.OursLabel)
+	writeSection(out, ours)
+	if opts.Style == StyleDiff3 || opts.Style == StyleZdiff3 {
+		writeMarker(out, '|', opts.BaseLabel)
+		writeSection(out, c.base)
+	}
+	writeMarker(out, '=', "")
+	writeSection(out, theirs)
+	writeMarker(out, '>', opts.TheirsLabel)
+	writeLines(out, suffix)
+}
+
+func MergeContent(base, ours, theirs []byte, opts *ContentOptions) ([]byte, int) {
+	// Merge the changes made in `ours` and `theirs` relative to `base` line by line.
+	// Overlapping changes are written between conflict markers in the style given
+	// by `opts`, unless `opts.Favor` picks a side. The number of conflicts is
+	// returned alongside the merged content.
+	if opts == nil {
+		opts = &ContentOptions{}
+	}
+	chunks := splitChunks(diff.SplitLines(base), diff.SplitLines(ours), diff.SplitLines(theirs))
+
+	var out strings.Builder
+	conflicts := 0
+	for _, c := range chunks {
+		switch {
+		case c.stable:
+			writeLines(&out, c.base)
+		case sameLines(c.ours, c.base):
+			writeLines(&out, c.theirs)
+		case sameLines(c.theirs, c.base), sameLines(c.ours, c.theirs):
+			writeLines(&out, c.ours)
+		case opts.Favor == FavorOurs:
+			writeLines(&out, c.ours)
+		case opts.Favor == FavorTheirs:
+			writeLines(&out, c.theirs)
+		case opts.Favor == FavorUnion:
+			writeSection(&out, c.ours)
+			writeLines(&out, c.theirs)
+		default:
+			conflicts++
+			writeConflict(&out, c, opts)
+		}
+	}
+
+	return []byte(out.String()), conflicts
+}
+
+func writeLines(out *strings.Builder, lines []string) {
+	for _, line := range lines {
+		out.WriteString(line)
+	}
+}
@@ -0,0 +1,212 @@
+package merge
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/tsoud/GoTGit.git/gitobj"
+	"github.com/tsoud/GoTGit.git/internal/testutil"
+)
+
+func TestMergeContent(t *testing.T) {
+	base := []byte("a\nb\nc\nd\ne\n")
+	ours := []byte("a\nB1\nc\nd\nx\ne\n")
+	theirs := []byte("a\nB2\nc\nd\ne\nf\n")
+
+	tests := []struct {
+		name      string
+		opts      ContentOptions
+		want      string
+		conflicts int
+	}{
+		{
+			"merge",
+			ContentOptions{OursLabel: "ours", TheirsLabel: "theirs"},
+			"a\n<<<<<<< ours\nB1\n=======\nB2\n>>>>>>> theirs\nc\nd\nx\ne\nf\n",
+			1,
+		},
+		{
+			"diff3",
+			ContentOptions{OursLabel: "ours", BaseLabel: "base", TheirsLabel: "theirs", Style: StyleDiff3},
+			"a\n<<<<<<< ours\nB1\n||||||| base\nb\n=======\nB2\n>>>>>>> theirs\nc\nd\nx\ne\nf\n",
+			1,
+		},
+		{
+			"favor_ours",
+			ContentOptions{Favor: FavorOurs},
+			"a\nB1\nc\nd\nx\ne\nf\n",
+			0,
+		},
+		{
+			"favor_theirs",
+			ContentOptions{Favor: FavorTheirs},
+			"a\nB2\nc\nd\nx\ne\nf\n",
+			0,
+		},
+		{
+			"union",
+			ContentOptions{Favor: FavorUnion},
+			"a\nB1\nB2\nc\nd\nx\ne\nf\n",
+			0,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			merged, conflicts := MergeContent(base, ours, theirs, &test.opts)
+			if string(merged) != test.want || conflicts != test.conflicts {
+				t.Errorf("Wanted %d conflicts and:\n%s\nGot %d conflicts and:\n%s",
+					test.conflicts, test.want, conflicts, merged)
+			}
+		})
+	}
+
+	// zdiff3 moves lines common to both sides out of the conflict.
+	merged, _ := MergeContent([]byte("a\nb\n"), []byte("a\nx\ny\nz\n"), []byte("a\nx\nw\nz\n"),
+		&ContentOptions{OursLabel: "ours", BaseLabel: "base", TheirsLabel: "theirs", Style: StyleZdiff3})
+	want := "a\nx\n<<<<<<< ours\ny\n||||||| base\nb\n=======\nw\n>>>>>>> theirs\nz\n"
+	if string(merged) != want {
+		t.Errorf("zdiff3:\nWanted:\n%s\nGot:\n%s", want, merged)
+	}
+}
+
+func TestMergeBases(t *testing.T) {
+	testutil.ChdirTemp(t)
+	tree := testutil.WriteTree(t, map[string]string{"file": "content\n"})
+
+	// root - one - criss1 (merges two)
+	//     \- two - criss2 (merges one)
+	root := testutil.WriteCommit(t, tree, "test")
+	one := testutil.WriteCommit(t, tree, "test", root)
+	two := testutil.WriteCommit(t, tree, "test", root)
+	criss1 := testutil.WriteCommit(t, tree, "test", one, two)
+	criss2 := testutil.WriteCommit(t, tree, "test", two, one)
+
+	tests := []struct {
+		name   string
+		got    func() ([]string, error)
+		wanted []string
+	}{
+		{"simple", func() ([]string, error) { return MergeBases(one, two) }, []string{root}},
+		{"ancestor", func() ([]string, error) { return MergeBases(criss1, one) }, []string{one}},
+		{"criss_cross", func() ([]string, error) { return MergeBases(criss1, criss2) }, []string{two, one}},
+		{"independent", func() ([]string, error) { return Independent(one, criss1, two) }, []string{criss1}},
+		{"octopus", func() ([]string, error) { return OctopusBases(criss1, criss2, one) }, []string{one}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := test.got()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, test.wanted) {
+				t.Errorf("Wanted %v, got %v", test.wanted, got)
+			}
+		})
+	}
+
+	unrelated := testutil.WriteCommit(t, tree, "test")
+	if bases, err := MergeBases(one, unrelated); err != nil || len(bases) != 0 {
+		t.Errorf("Wanted no merge base for unrelated histories, got %v (%v)", bases, err)
+	}
+}
+
+func treeContents(t *testing.T, result *Result) map[string]string {
+	t.Helper()
+	contents := make(map[string]string)
+	for _, file := range result.Files {
+		blobObj, err := gitobj.ReadGitObj(file.Hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		contents[file.Name] = string(blobObj.Content)
+	}
+	return contents
+}
+
+func TestMergeTrees(t *testing.T) {
+	testutil.ChdirTemp(t)
+	opts := &Options{OursLabel: "ours", BaseLabel: "base", TheirsLabel: "theirs", DetectRenames: true}
+	lines := "one\ntwo\nthree\nfour\nfive\nsix\n"
+
+	base := testutil.WriteTree(t, map[string]string{
+		"conflict": "base\n", "moved": lines, "deleted": "base\n", "same": "same\n",
+	})
+	ours := testutil.WriteTree(t, map[string]string{
+		"conflict": "ours\n", "moved": lines + "seven\n", "deleted": "changed\n", "file": "ours\n",
+		"same": "same\n",
+	})
+	theirs := testutil.WriteTree(t, map[string]string{
+		"conflict": "theirs\n", "dir/renamed": lines, "file/nested": "dir\n", "same": "same\n",
+		"added": "new\n",
+	})
+
+	result, err := MergeTrees(base, ours, theirs, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantContents := map[string]string{
+		"added":       "new\n",
+		"conflict":    "<<<<<<< ours\nours\n=======\ntheirs\n>>>>>>> theirs\n",
+		"deleted":     "changed\n",
+		"dir/renamed": lines + "seven\n",
+		"file/nested": "dir\n",
+		"file~ours":   "ours\n",
+		"same":        "same\n",
+	}
+	gotContents := treeContents(t, result)
+	for name, want := range wantContents {
+		if gotContents[name] != want {
+			t.Errorf("Wanted %s to contain %q, got %q", name, want, gotContents[name])
+		}
+	}
+	if len(gotContents) != len(wantContents) {
+		t.Errorf("Wanted files %v, got %v", wantContents, gotContents)
+	}
+
+	var kinds []string
+	for _, conflict := range result.Conflicts {
+		kinds = append(kinds, conflict.Kind+" "+conflict.Path)
+	}
+	slices.Sort(kinds)
+	wantKinds := []string{"content conflict", "file/directory file~ours", "modify/delete deleted"}
+	if !slices.Equal(kinds, wantKinds) {
+		t.Errorf("Wanted conflicts %v, got %v", wantKinds, kinds)
+	}
+	if result.Clean() {
+		t.Error("Wanted the merge to be unclean")
+	}
+
+	var stages []string
+	for _, stage := range result.Stages() {
+		stages = append(stages, strings.Join([]string{stage.Path, string(rune('0' + stage.Stage))}, ":"))
+	}
+	wantStages := "conflict:1 conflict:2 conflict:3 deleted:1 deleted:2 file~ours:2"
+	if got := strings.Join(stages, " "); got != wantStages {
+		t.Errorf("Wanted stages %s, got %s", wantStages, got)
+	}
+
+	// Without rename detection, the rename is a deletion of a modified file.
+	opts.DetectRenames = false
+	result, err = MergeTrees(base, ours, theirs, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if contents := treeContents(t, result); contents["moved"] == "" || contents["dir/renamed"] != lines {
+		t.Errorf("Wanted the rename to stay unmerged, got %v", contents)
+	}
+
+	// A file renamed differently on both sides conflicts.
+	renamedOurs := testutil.WriteTree(t, map[string]string{"conflict": "base\n", "ours-name": lines})
+	renamedTheirs := testutil.WriteTree(t, map[string]string{"conflict": "base\n", "theirs-name": lines})
+	opts.DetectRenames = true
+	result, err = MergeTrees(base, renamedOurs, renamedTheirs, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Conflicts) == 0 || result.Conflicts[0].Kind != "rename/rename" {
+		t.Errorf("Wanted a rename/rename conflict, got %v", result.Messages)
+	}
+}
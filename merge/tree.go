@@ -0,0 +1,651 @@
+package merge
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/tsoud/GoTGit.git/diff"
+	"github.com/tsoud/GoTGit.git/gitobj"
+)
+
+type Options struct {
+	OursLabel   string
+	TheirsLabel string
+	// BaseLabel names the merge base in diff3-style conflicts. MergeCommits
+	// fills it in when empty.
+	BaseLabel string
+	Style     string
+	Favor     int
+	// DetectRenames pairs up files renamed on either side, using RenameScore
+	// (see `diff.ParseScore`) as the similarity threshold.
+	DetectRenames bool
+	RenameScore   int
+	// virtual is set when building a virtual merge base from several bases.
+	virtual bool
+}
+
+// Stage is an index entry recorded for a conflicted path.
+type Stage struct {
+	Path  string
+	Stage int
+	Mode  string
+	Hash  string
+}
+
+type Conflict struct {
+	// Kind is the type of conflict, as shown in "CONFLICT (<kind>)" messages.
+	Kind   string
+	Path   string
+	Stages []Stage
+}
+
+type Result struct {
+	// Tree is the merged tree, with conflicts recorded as well as possible
+	// (e.g. with conflict markers).
+	Tree string
+	// Files lists the files of Tree with their full paths.
+	Files     []gitobj.TreeEntry
+	Conflicts []*Conflict
+	Messages  []string
+}
+
+func (result *Result) Clean() bool {
+	return len(result.Conflicts) == 0
+}
+
+func (result *Result) Stages() []Stage {
+	// Return the index stages of all conflicts, sorted by path and stage.
+	var stages []Stage
+	for _, conflict := range result.Conflicts {
+		stages = append(stages, conflict.Stages...)
+	}
+	slices.SortFunc(stages, func(x, y Stage) int {
+		if c := strings.Compare(x.Path, y.Path); c != 0 {
+			return c
+		}
+		return x.Stage - y.Stage
+	})
+	return slices.CompactFunc(stages, func(x, y Stage) bool { return x == y })
+}
+
+const (
+	oursSide   = 2
+	theirsSide = 3
+)
+
+// slot gathers the three versions of one file, which may live at different
+// paths when a side renamed it.
+type slot struct {
+	path                           string
+	base, ours, theirs             *gitobj.TreeEntry
+	basePath, oursPath, theirsPath string
+	// renameDeleted is the side that renamed the file while the other side
+	// deleted it.
+	renameDeleted int
+	// fixed slots already have their result (and conflict) decided.
+	fixed    bool
+	result   *gitobj.TreeEntry
+	origin   int
+	conflict *Conflict
+}
+
+// pathMessage is a message about one path; messages are reported in path order.
+type pathMessage struct {
+	path  string
+	first bool
+	text  string
+}
+
+type merger struct {
+	opts     *Options
+	messages []pathMessage
+	slots    map[string]*slot
+	results  map[string]*gitobj.TreeEntry
+	origins  map[string]int
+	conflict map[string]*Conflict
+	result   *Result
+}
+
+func treeFiles(treeHash string) (map[string]*gitobj.TreeEntry, error) {
+	files, err := gitobj.ReadTreeRecursive(treeHash)
+	if err != nil {
+		return nil, err
+	}
+	byPath := make(map[string]*gitobj.TreeEntry, len(files))
+	for i := range files {
+		byPath[files[i].Name] = &files[i]
+	}
+	return byPath, nil
+}
+
+func sameEntry(x, y *gitobj.TreeEntry) bool {
+	if x == nil || y == nil {
+		return x == nil && y == nil
+	}
+	return x.Hash == y.Hash && x.Mode == y.Mode
+}
+
+func (m *merger) slotAt(filePath string) *slot {
+	s, ok := m.slots[filePath]
+	if !ok {
+		s = &slot{path: filePath, basePath: filePath, oursPath: filePath, theirsPath: filePath}
+		m.slots[filePath] = s
+	}
+	return s
+}
+
+func (m *merger) label(side int) string {
+	if side == oursSide {
+		return m.opts.OursLabel
+	}
+	return m.opts.TheirsLabel
+}
+
+func (m *merger) message(filePath, format string, args ...any) {
+	m.messages = append(m.messages, pathMessage{path: filePath, text: fmt.Sprintf(format, args...)})
+}
+
+func renames(baseTree, sideTree string, opts *Options) (map[string]string, error) {
+	// Map the paths renamed between the base and one side to their new paths.
+	found := make(map[string]string)
+	if !opts.DetectRenames {
+		return found, nil
+	}
+	changes, err := diff.TreeDiff(baseTree, sideTree, &diff.Options{
+		Recursive: true, DetectRenames: true, RenameScore: opts.RenameScore,
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, change := range changes {
+		if change.Status == diff.Renamed {
+			found[change.OldPath] = change.NewPath
+		}
+	}
+	return found, nil
+}
+
+func (m *merger) alignRenames(
+	base, ours, theirs map[string]*gitobj.TreeEntry, oursRenames, theirsRenames map[string]string,
+) {
+	// Move the base (and other side's) version of each renamed file into the slot
+	// of its new path, so that the rename merges with changes made on the other
+	// side. Renames whose target the other side also uses are left alone and end
+	// up as add/add conflicts.
+	var sources []string
+	for oldPath := range oursRenames {
+		sources = append(sources, oldPath)
+	}
+	for oldPath := range theirsRenames {
+		if _, ok := oursRenames[oldPath]; !ok {
+			sources = append(sources, oldPath)
+		}
+	}
+	slices.Sort(sources)
+
+	for _, oldPath := range sources {
+		oursNew, oursRenamed := oursRenames[oldPath]
+		theirsNew, theirsRenamed := theirsRenames[oldPath]
+		old := m.slotAt(oldPath)
+
+		switch {
+		case oursRenamed && theirsRenamed && oursNew == theirsNew:
+			s := m.slotAt(oursNew)
+			s.base, s.basePath = base[oldPath], oldPath
+			old.base = nil
+
+		case oursRenamed && theirsRenamed:
+			conflict := &Conflict{Kind: "rename/rename", Path: oursNew, Stages: []Stage{
+				{Path: oldPath, Stage: 1, Mode: base[oldPath].Mode, Hash: base[oldPath].Hash},
+				{Path: oursNew, Stage: 2, Mode: ours[oursNew].Mode, Hash: ours[oursNew].Hash},
+				{Path: theirsNew, Stage: 3, Mode: theirs[theirsNew].Mode, Hash: theirs[theirsNew].Hash},
+			}}
+			m.message(oldPath, "CONFLICT (rename/rename): %s renamed to %s in %s and to %s in %s.",
+				oldPath, oursNew, m.opts.OursLabel, theirsNew, m.opts.TheirsLabel)
+			oursSlot, theirsSlot := m.slotAt(oursNew), m.slotAt(theirsNew)
+			oursSlot.fixed, oursSlot.result, oursSlot.origin = true, ours[oursNew], oursSide
+			oursSlot.conflict = conflict
+			theirsSlot.fixed, theirsSlot.result, theirsSlot.origin = true, theirs[theirsNew], theirsSide
+			old.base = nil
+
+		case oursRenamed && theirs[oursNew] == nil:
+			s := m.slotAt(oursNew)
+			s.base, s.basePath = base[oldPath], oldPath
+			s.theirs, s.theirsPath = theirs[oldPath], oldPath
+			if theirs[oldPath] == nil {
+				s.renameDeleted = oursSide
+			}
+			old.base, old.theirs = nil, nil
+
+		case theirsRenamed && ours[theirsNew] == nil:
+			s := m.slotAt(theirsNew)
+			s.base, s.basePath = base[oldPath], oldPath
+			s.ours, s.oursPath = ours[oldPath], oldPath
+			if ours[oldPath] == nil {
+				s.renameDeleted = theirsSide
+			}
+			old.base, old.ours = nil, nil
+		}
+	}
+}
+
+func readBlob(entry *gitobj.TreeEntry) ([]byte, error) {
+	if entry == nil {
+		return nil, nil
+	}
+	blobObj, err := gitobj.ReadGitObj(entry.Hash)
+	if err != nil {
+		return nil, err
+	}
+	return blobObj.Content, nil
+}
+
+func writeBlob(content []byte) (string, error) {
+	blobObj, err := gitobj.HashObject("blob", content)
+	if err != nil {
+		return "", err
+	}
+	if !gitobj.ObjectExists(blobObj.Hash) {
+		if err := blobObj.Write(); err != nil {
+			return "", err
+		}
+	}
+	return blobObj.Hash, nil
+}
+
+func stagesOf(s *slot) []Stage {
+	var stages []Stage
+	for stage, entry := range []*gitobj.TreeEntry{s.base, s.ours, s.theirs} {
+		if entry != nil {
+			stages = append(stages, Stage{Path: s.path, Stage: stage + 1, Mode: entry.Mode, Hash: entry.Hash})
+		}
+	}
+	return stages
+}
+
+func (m *merger) contentLabel(label, filePath string, s *slot) string {
+	// Add the path to conflict marker labels when the sides disagree on it.
+	if s.basePath == s.oursPath && s.oursPath == s.theirsPath {
+		return label
+	}
+	return label + ":" + filePath
+}
+
+func (m *merger) mergeContent(s *slot, kind string) (*gitobj.TreeEntry, bool, error) {
+	// Merge two regular files line by line, returning the merged entry and
+	// whether the merge was clean.
+	base, ours, theirs := s.base, s.ours, s.theirs
+
+	mode := ours.Mode
+	clean := true
+	switch {
+	case ours.Mode == theirs.Mode:
+	case base != nil && ours.Mode == base.Mode:
+		mode = theirs.Mode
+	case base == nil || theirs.Mode != base.Mode:
+		clean = false
+	}
+
+	switch {
+	case ours.Hash == theirs.Hash:
+		return &gitobj.TreeEntry{Mode: mode, Type: "blob", Hash: ours.Hash}, clean, nil
+	case base != nil && base.Hash == ours.Hash:
+		return &gitobj.TreeEntry{Mode: mode, Type: "blob", Hash: theirs.Hash}, clean, nil
+	case base != nil && base.Hash == theirs.Hash:
+		return &gitobj.TreeEntry{Mode: mode, Type: "blob", Hash: ours.Hash}, clean, nil
+	}
+
+	m.message(s.path, "Auto-merging %s", s.path)
+	baseContent, err := readBlob(base)
+	if err != nil {
+		return nil, false, err
+	}
+	oursContent, err := readBlob(ours)
+	if err != nil {
+		return nil, false, err
+	}
+	theirsContent, err := readBlob(theirs)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if diff.IsBinary(baseContent) || diff.IsBinary(oursContent) || diff.IsBinary(theirsContent) {
+		m.message(s.path, "warning: Cannot merge binary files: %s (%s vs. %s)", s.path, m.opts.OursLabel, m.opts.TheirsLabel)
+		m.message(s.path, "CONFLICT (%s): Merge conflict in %s", kind, s.path)
+		return &gitobj.TreeEntry{Mode: mode, Type: "blob", Hash: ours.Hash}, false, nil
+	}
+
+	merged, conflicts := MergeContent(baseContent, oursContent, theirsContent, &ContentOptions{
+		OursLabel:   m.contentLabel(m.opts.OursLabel, s.oursPath, s),
+		BaseLabel:   m.contentLabel(m.opts.BaseLabel, s.basePath, s),
+		TheirsLabel: m.contentLabel(m.opts.TheirsLabel, s.theirsPath, s),
+		Style:       m.opts.Style,
+		Favor:       m.opts.Favor,
+	})
+	if conflicts > 0 {
+		clean = false
+		m.message(s.path, "CONFLICT (%s): Merge conflict in %s", kind, s.path)
+	}
+	hash, err := writeBlob(merged)
+	if err != nil {
+		return nil, false, err
+	}
+	return &gitobj.TreeEntry{Mode: mode, Type: "blob", Hash: hash}, clean, nil
+}
+
+func (m *merger) resolve(s *slot) (*gitobj.TreeEntry, int, *Conflict, error) {
+	// Decide the merged version of a slot. Returns the result (nil if the file is
+	// deleted), the side it mostly came from, and a conflict if the merge is not clean.
+	base, ours, theirs := s.base, s.ours, s.theirs
+
+	if s.renameDeleted != 0 {
+		renamer, deleter := s.renameDeleted, theirsSide
+		result := ours
+		if renamer == theirsSide {
+			deleter, result = oursSide, theirs
+		}
+		m.message(s.basePath, "CONFLICT (rename/delete): %s renamed to %s in %s, but deleted in %s.",
+			s.basePath, s.path, m.label(renamer), m.label(deleter))
+		return result, renamer, &Conflict{Kind: "rename/delete", Path: s.path, Stages: stagesOf(s)}, nil
+	}
+
+	switch {
+	case sameEntry(ours, theirs):
+		return ours, oursSide, nil, nil
+	case sameEntry(base, ours):
+		return theirs, theirsSide, nil, nil
+	case sameEntry(base, theirs):
+		return ours, oursSide, nil, nil
+	}
+
+	if ours == nil || theirs == nil {
+		deleter, modifier, result := oursSide, theirsSide, theirs
+		if theirs == nil {
+			deleter, modifier, result = theirsSide, oursSide, ours
+		}
+		if m.opts.virtual {
+			// A virtual merge base keeps the common version instead.
+			result = base
+		}
+		m.message(s.path, "CONFLICT (modify/delete): %s deleted in %s and modified in %s.  Version %s of %s left in tree.",
+			s.path, m.label(deleter), m.label(modifier), m.label(modifier), s.path)
+		return result, modifier, &Conflict{Kind: "modify/delete", Path: s.path, Stages: stagesOf(s)}, nil
+	}
+
+	kind := "content"
+	if base == nil {
+		kind = "add/add"
+	}
+	conflict := &Conflict{Kind: kind, Path: s.path, Stages: stagesOf(s)}
+	oursType, theirsType := ours.Mode[:2], theirs.Mode[:2]
+
+	switch {
+	case oursType != theirsType:
+		m.message(s.path, "CONFLICT (distinct types): %s had different types on each side; "+
+			"keeping the version from %s.", s.path, m.opts.OursLabel)
+		conflict.Kind = "distinct types"
+		return ours, oursSide, conflict, nil
+	case oursType == "16":
+		m.message(s.path, "CONFLICT (submodule): Merge conflict in %s", s.path)
+		conflict.Kind = "submodule"
+		return ours, oursSide, conflict, nil
+	case oursType == "12":
+		// Symbolic links cannot be merged line by line.
+		m.message(s.path, "CONFLICT (%s): Merge conflict in %s", kind, s.path)
+		return ours, oursSide, conflict, nil
+	}
+
+	result, clean, err := m.mergeContent(s, kind)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	if clean {
+		return result, oursSide, nil, nil
+	}
+	return result, oursSide, conflict, nil
+}
+
+func (m *merger) resolveDirectoryConflicts() {
+	// Move files that are in the way of a directory on the other side to
+	// "<path>~<side>".
+	dirs := make(map[string]bool)
+	for filePath := range m.results {
+		for dir := filePath; strings.Contains(dir, "/"); {
+			dir = dir[:strings.LastIndexByte(dir, '/')]
+			dirs[dir] = true
+		}
+	}
+
+	for _, filePath := range sortedKeys(m.results) {
+		if !dirs[filePath] {
+			continue
+		}
+		entry, side := m.results[filePath], m.origins[filePath]
+		newPath := filePath + "~" + strings.ReplaceAll(m.label(side), "/", "_")
+		for i := 1; m.results[newPath] != nil || dirs[newPath]; i++ {
+			newPath = fmt.Sprintf("%s~%s_%d", filePath, strings.ReplaceAll(m.label(side), "/", "_"), i)
+		}
+		m.messages = append(m.messages, pathMessage{path: filePath, first: true, text: fmt.Sprintf(
+			"CONFLICT (file/directory): directory in the way of %s from %s; moving it to %s instead.",
+			filePath, m.label(side), newPath)})
+
+		delete(m.results, filePath)
+		m.results[newPath] = entry
+		conflict := m.conflict[filePath]
+		if conflict == nil {
+			conflict = &Conflict{Kind: "file/directory", Stages: []Stage{
+				{Path: newPath, Stage: side, Mode: entry.Mode, Hash: entry.Hash},
+			}}
+			m.result.Conflicts = append(m.result.Conflicts, conflict)
+		}
+		conflict.Path = newPath
+		for i := range conflict.Stages {
+			if conflict.Stages[i].Path == filePath {
+				conflict.Stages[i].Path = newPath
+			}
+		}
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+func MergeTrees(baseTree, oursTree, theirsTree string, opts *Options) (*Result, error) {
+	// Merge the changes from `baseTree` to `theirsTree` into `oursTree` without
+	// touching the index or working tree. An empty hash stands for the empty tree.
+	// The merged tree is always written; conflicts are described in the result.
+	if opts == nil {
+		opts = &Options{}
+	}
+	m := &merger{
+		opts:     opts,
+		slots:    make(map[string]*slot),
+		results:  make(map[string]*gitobj.TreeEntry),
+		origins:  make(map[string]int),
+		conflict: make(map[string]*Conflict),
+		result:   &Result{},
+	}
+
+	base, err := treeFiles(baseTree)
+	if err != nil {
+		return nil, err
+	}
+	ours, err := treeFiles(oursTree)
+	if err != nil {
+		return nil, err
+	}
+	theirs, err := treeFiles(theirsTree)
+	if err != nil {
+		return nil, err
+	}
+	for filePath, entry := range base {
+		m.slotAt(filePath).base = entry
+	}
+	for filePath, entry := range ours {
+		m.slotAt(filePath).ours = entry
+	}
+	for filePath, entry := range theirs {
+		m.slotAt(filePath).theirs = entry
+	}
+
+	oursRenames, err := renames(baseTree, oursTree, opts)
+	if err != nil {
+		return nil, err
+	}
+	theirsRenames, err := renames(baseTree, theirsTree, opts)
+	if err != nil {
+		return nil, err
+	}
+	m.alignRenames(base, ours, theirs, oursRenames, theirsRenames)
+
+	for _, filePath := range sortedKeys(m.slots) {
+		s := m.slots[filePath]
+		result, origin, conflict := s.result, s.origin, s.conflict
+		if !s.fixed {
+			if result, origin, conflict, err = m.resolve(s); err != nil {
+				return nil, err
+			}
+		}
+		if result != nil {
+			m.results[filePath] = &gitobj.TreeEntry{Mode: result.Mode, Hash: result.Hash, Name: filePath}
+			m.origins[filePath] = origin
+		}
+		if conflict != nil && m.conflict[conflict.Path] == nil {
+			m.conflict[conflict.Path] = conflict
+			m.result.Conflicts = append(m.result.Conflicts, conflict)
+		}
+	}
+	m.resolveDirectoryConflicts()
+
+	slices.SortStableFunc(m.messages, func(x, y pathMessage) int {
+		if c := strings.Compare(x.path, y.path); c != 0 || x.first == y.first {
+			return c
+		}
+		if x.first {
+			return -1
+		}
+		return 1
+	})
+	for _, message := range m.messages {
+		m.result.Messages = append(m.result.Messages, message.text)
+	}
+
+	for _, filePath := range sortedKeys(m.results) {
+		entry := *m.results[filePath]
+		entry.Name = filePath
+		m.result.Files = append(m.result.Files, entry)
+	}
+	treeObj, err := gitobj.BuildTree(m.result.Files, true)
+	if err != nil {
+		return nil, err
+	}
+	m.result.Tree = treeObj.Hash
+
+	return m.result, nil
+}
+
+func commitTree(graph *commitGraph, hash string) (string, error) {
+	commit, err := graph.commit(hash)
+	if err != nil {
+		return "", err
+	}
+	return commit.Tree, nil
+}
+
+func virtualBase(graph *commitGraph, bases []string, opts *Options) (string, error) {
+	// Build the tree to use as the merge base. With several merge bases (after
+	// criss-cross merges), they are merged into a virtual base first, recursively
+	// using their own merge bases.
+	if len(bases) == 0 {
+		return "", nil
+	}
+	tree, err := commitTree(graph, bases[0])
+	if err != nil {
+		return "", err
+	}
+	mergedAncestors, err := graph.ancestors(bases[0])
+	if err != nil {
+		return "", err
+	}
+
+	for _, base := range bases[1:] {
+		baseAncestors, err := graph.ancestors(base)
+		if err != nil {
+			return "", err
+		}
+		innerBases, err := graph.bestCommon(mergedAncestors, baseAncestors)
+		if err != nil {
+			return "", err
+		}
+		innerTree, err := virtualBase(graph, innerBases, opts)
+		if err != nil {
+			return "", err
+		}
+		baseTree, err := commitTree(graph, base)
+		if err != nil {
+			return "", err
+		}
+
+		inner, err := MergeTrees(innerTree, tree, baseTree, &Options{
+			OursLabel:     "Temporary merge branch 1",
+			TheirsLabel:   "Temporary merge branch 2",
+			BaseLabel:     "merged common ancestors",
+			DetectRenames: opts.DetectRenames,
+			RenameScore:   opts.RenameScore,
+			virtual:       true,
+		})
+		if err != nil {
+			return "", err
+		}
+		tree = inner.Tree
+		for hash := range baseAncestors {
+			mergedAncestors[hash] = true
+		}
+	}
+	return tree, nil
+}
+
+func MergeCommits(ours, theirs string, opts *Options) (*Result, error) {
+	// Merge commit `theirs` into commit `ours`, using their merge base (or a
+	// virtual base built from several) as the common ancestor.
+	if opts == nil {
+		opts = &Options{}
+	}
+	bases, err := MergeBases(ours, theirs)
+	if err != nil {
+		return nil, err
+	}
+
+	graph := newCommitGraph()
+	baseTree, err := virtualBase(graph, bases, opts)
+	if err != nil {
+		return nil, err
+	}
+	if opts.BaseLabel == "" {
+		switch len(bases) {
+		case 0:
+			opts.BaseLabel = "empty tree"
+		case 1:
+			opts.BaseLabel = bases[0][:7]
+		default:
+			opts.BaseLabel = "merged common ancestors"
+		}
+	}
+
+	oursTree, err := commitTree(graph, ours)
+	if err != nil {
+		return nil, err
+	}
+	theirsTree, err := commitTree(graph, theirs)
+	if err != nil {
+		return nil, err
+	}
+	return MergeTrees(baseTree, oursTree, theirsTree, opts)
+}
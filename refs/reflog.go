@@ -0,0 +1,197 @@
+package refs
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/tsoud/GoTGit.git/config"
+	"github.com/tsoud/GoTGit.git/gitobj"
+)
+
+type ReflogEntry struct {
+	OldHash   string
+	NewHash   string
+	Committer gitobj.Signature
+	Message   string
+}
+
+func reflogPath(name string) string {
+	return path.Join(gitobj.GitDir, "logs", name)
+}
+
+func shouldLog(name string) bool {
+	// Git keeps reflogs for HEAD, branches, remote-tracking branches and the stash,
+	// plus any ref that already has one.
+	if name == HEAD || name == "refs/stash" {
+		return true
+	}
+	for _, prefix := range []string{"refs/heads/", "refs/remotes/", "refs/notes/"} {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	_, err := os.Stat(reflogPath(name))
+	return err == nil
+}
+
+func committerSignature() gitobj.Signature {
+	cfg, err := config.Load()
+	if err != nil {
+		return gitobj.Signature{When: time.Now()}
+	}
+	return cfg.Signature("committer")
+}
+
+func (entry ReflogEntry) String() string {
+	return fmt.Sprintf("%s %s %s\t%s\n", entry.OldHash, entry.NewHash, entry.Committer, entry.Message)
+}
+
+func appendReflog(name, oldHash, newHash, message string) error {
+	// Add an entry to the reflog of `name`.
+	if !shouldLog(name) {
+		return nil
+	}
+	if oldHash == "" {
+		oldHash = gitobj.ObjectFormat.NullHash()
+	}
+	entry := ReflogEntry{
+		OldHash:   oldHash,
+		NewHash:   newHash,
+		Committer: committerSignature(),
+		Message:   strings.ReplaceAll(message, "\n", " "),
+	}
+
+	logFile := reflogPath(name)
+	if err := gitobj.MkdirAllShared(filepath.Dir(logFile)); err != nil {
+		return fmt.Errorf("could not create reflog directory for %s: %w", name, err)
+	}
+	f, err := os.OpenFile(logFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("could not open reflog for %s: %w", name, err)
+	}
+	defer f.Close()
+	if err := gitobj.AdjustSharedPerm(logFile); err != nil {
+		return err
+	}
+
+	if _, err := f.WriteString(entry.String()); err != nil {
+		return fmt.Errorf("could not write reflog for %s: %w", name, err)
+	}
+	return nil
+}
+
+func ReadReflog(name string) ([]ReflogEntry, error) {
+	// Read the reflog of `name`, oldest entry first.
+	contents, err := os.ReadFile(reflogPath(name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("could not read reflog for %s: %w", name, err)
+	}
+
+	var entries []ReflogEntry
+	for _, line := range strings.Split(strings.TrimSuffix(string(contents), "\n"), "\n") {
+		if line == "" {
+			continue
+		}
+		header, message, _ := strings.Cut(line, "\t")
+		fields := strings.SplitN(header, " ", 3)
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("malformed reflog entry for %s: \"%s\"", name, line)
+		}
+		committer, err := gitobj.ParseSignature(fields[2])
+		if err != nil {
+			return nil, fmt.Errorf("malformed reflog entry for %s: %w", name, err)
+		}
+		entries = append(entries, ReflogEntry{
+			OldHash:   fields[0],
+			NewHash:   fields[1],
+			Committer: committer,
+			Message:   message,
+		})
+	}
+
+	return entries, nil
+}
+
+func ListReflogs() ([]string, error) {
+	// Return the names of all refs with a reflog, including HEAD, sorted.
+	logsDir := path.Join(gitobj.GitDir, "logs")
+	var names []string
+	err := filepath.WalkDir(logsDir, func(file string, entry os.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if entry.Type().IsRegular() {
+			name, _ := filepath.Rel(logsDir, file)
+			names = append(names, filepath.ToSlash(name))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not list reflogs: %w", err)
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+func writeReflog(name string, entries []ReflogEntry) error {
+	// Replace the reflog of `name` with `entries`.
+	if len(entries) == 0 {
+		return nil
+	}
+	var contents strings.Builder
+	for _, entry := range entries {
+		contents.WriteString(entry.String())
+	}
+
+	logFile := reflogPath(name)
+	if err := gitobj.MkdirAllShared(filepath.Dir(logFile)); err != nil {
+		return fmt.Errorf("could not create reflog directory for %s: %w", name, err)
+	}
+	if err := os.WriteFile(logFile, []byte(contents.String()), 0644); err != nil {
+		return fmt.Errorf("could not write reflog for %s: %w", name, err)
+	}
+	return gitobj.AdjustSharedPerm(logFile)
+}
+
+func DropReflogEntry(name string, n int) error {
+	// Delete the entry made `n` updates ago from the reflog of `name`, keeping
+	// the chain of old and new hashes intact. Dropping the newest entry moves
+	// the ref back to its previous value, and dropping the last one deletes it.
+	entries, err := ReadReflog(name)
+	if err != nil {
+		return err
+	}
+	if n < 0 || n >= len(entries) {
+		return fmt.Errorf("log for '%s' only has %d entries", ShortName(name), len(entries))
+	}
+	i := len(entries) - 1 - n
+	if i+1 < len(entries) {
+		entries[i+1].OldHash = entries[i].OldHash
+	}
+	entries = append(entries[:i], entries[i+1:]...)
+	if len(entries) == 0 {
+		return Delete(name)
+	}
+
+	if err := writeReflog(name, entries); err != nil {
+		return err
+	}
+	if n == 0 {
+		newHash := entries[len(entries)-1].NewHash
+		if err := writeFile(refPath(name), []byte(newHash+"\n")); err != nil {
+			return fmt.Errorf("could not update ref %s: %w", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,473 @@
+package refs
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/tsoud/GoTGit.git/gitobj"
+)
+
+const HEAD = "HEAD"
+
+var ErrNotFound = errors.New("reference not found")
+
+type Ref struct {
+	Name string
+	Hash string
+}
+
+func refPath(name string) string {
+	return path.Join(gitobj.GitDir, name)
+}
+
+func packedRefs() (map[string]string, error) {
+	// Read the `packed-refs` file. Peeled lines (starting with `^`) are skipped.
+	packed := make(map[string]string)
+	f, err := os.Open(refPath("packed-refs"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return packed, nil
+		}
+		return nil, fmt.Errorf("could not read packed-refs: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || line[0] == '#' || line[0] == '^' {
+			continue
+		}
+		hash, name, found := strings.Cut(line, " ")
+		if found {
+			packed[name] = hash
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read packed-refs: %w", err)
+	}
+
+	return packed, nil
+}
+
+func readRaw(name string) (string, error) {
+	// Return the raw value of a ref: a hash or "ref: <target>".
+	info, err := os.Stat(refPath(name))
+	switch {
+	case err == nil && !info.IsDir():
+		contents, err := os.ReadFile(refPath(name))
+		if err != nil {
+			return "", fmt.Errorf("could not read ref %s: %w", name, err)
+		}
+		return strings.TrimSpace(string(contents)), nil
+	case err != nil && !os.IsNotExist(err):
+		return "", fmt.Errorf("could not read ref %s: %w", name, err)
+	}
+
+	packed, err := packedRefs()
+	if err != nil {
+		return "", err
+	}
+	if hash, ok := packed[name]; ok {
+		return hash, nil
+	}
+	return "", ErrNotFound
+}
+
+func ReadSymbolic(name string) (string, bool, error) {
+	// Return the target of a symbolic ref such as HEAD, and whether it is symbolic.
+	raw, err := readRaw(name)
+	if err != nil {
+		return "", false, err
+	}
+	target, isSymbolic := strings.CutPrefix(raw, "ref: ")
+	return target, isSymbolic, nil
+}
+
+func Resolve(name string) (string, error) {
+	// Follow symbolic refs until reaching an object hash.
+	for depth := 0; depth < 5; depth++ {
+		raw, err := readRaw(name)
+		if err != nil {
+			return "", err
+		}
+		target, isSymbolic := strings.CutPrefix(raw, "ref: ")
+		if !isSymbolic {
+			return raw, nil
+		}
+		name = target
+	}
+	return "", fmt.Errorf("too many levels of symbolic refs for %s", name)
+}
+
+func Exists(name string) bool {
+	_, err := Resolve(name)
+	return err == nil
+}
+
+func CurrentBranch() (string, error) {
+	// Return the full name of the branch HEAD points to, or "" if HEAD is detached.
+	target, isSymbolic, err := ReadSymbolic(HEAD)
+	if err != nil {
+		return "", fmt.Errorf("could not read HEAD: %w", err)
+	}
+	if !isSymbolic {
+		return "", nil
+	}
+	return target, nil
+}
+
+func ShortName(name string) string {
+	for _, prefix := range []string{"refs/heads/", "refs/tags/", "refs/remotes/", "refs/"} {
+		if short, found := strings.CutPrefix(name, prefix); found {
+			return short
+		}
+	}
+	return name
+}
+
+func Expand(name string) (string, bool) {
+	// Find the full name of an existing ref from a short name, using Git's lookup order.
+	for _, format := range []string{
+		"%s", "refs/%s", "refs/tags/%s", "refs/heads/%s", "refs/remotes/%s", "refs/remotes/%s/HEAD",
+	} {
+		fullName := fmt.Sprintf(format, name)
+		if fullName != HEAD && !strings.HasPrefix(fullName, "refs/") && !isPseudoRef(fullName) {
+			continue
+		}
+		if Exists(fullName) {
+			return fullName, true
+		}
+	}
+	return "", false
+}
+
+func isPseudoRef(name string) bool {
+	// Refs like ORIG_HEAD or MERGE_HEAD live directly in the git directory.
+	return name != "" && strings.ToUpper(name) == name && strings.HasSuffix(name, "HEAD")
+}
+
+func ValidateName(name string) error {
+	// Check a ref name against Git's rules (see `git check-ref-format`).
+	invalid := fmt.Errorf("'%s' is not a valid ref name", name)
+	if name == "" || name == "@" || strings.HasPrefix(name, "-") || strings.HasSuffix(name, "/") ||
+		strings.HasSuffix(name, ".") || strings.HasSuffix(name, ".lock") ||
+		strings.Contains(name, "..") || strings.Contains(name, "@{") || strings.Contains(name, "//") {
+		return invalid
+	}
+	for _, component := range strings.Split(name, "/") {
+		if strings.HasPrefix(component, ".") || strings.HasSuffix(component, ".lock") {
+			return invalid
+		}
+	}
+	for _, ch := range name {
+		if ch < 0x20 || ch == 0x7f || strings.ContainsRune(" ~^:?*[\\", ch) {
+			return invalid
+		}
+	}
+	return nil
+}
+
+func writeFile(file string, contents []byte) error {
+	// Write through a lock file so readers never see a partially written ref.
+	if err := gitobj.MkdirAllShared(filepath.Dir(file)); err != nil {
+		return err
+	}
+	lockFile := file + ".lock"
+	lock, err := os.OpenFile(lockFile, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		if os.IsExist(err) {
+			return fmt.Errorf("unable to create '%s': file exists; another process may be running", lockFile)
+		}
+		return err
+	}
+	if _, err := lock.Write(contents); err != nil {
+		lock.Close()
+		os.Remove(lockFile)
+		return err
+	}
+	if err := lock.Close(); err != nil {
+		os.Remove(lockFile)
+		return err
+	}
+	if err := gitobj.AdjustSharedPerm(lockFile); err != nil {
+		os.Remove(lockFile)
+		return err
+	}
+	return os.Rename(lockFile, file)
+}
+
+func Update(name, newHash, message string) error {
+	// Point `name` directly at `newHash` and record the change in its reflog.
+	// Updating the branch HEAD points to is logged for HEAD as well.
+	oldHash, err := Resolve(name)
+	if err != nil && err != ErrNotFound {
+		return err
+	}
+
+	if err := writeFile(refPath(name), []byte(newHash+"\n")); err != nil {
+		return fmt.Errorf("could not update ref %s: %w", name, err)
+	}
+
+	if err := appendReflog(name, oldHash, newHash, message); err != nil {
+		return err
+	}
+	if current, _ := CurrentBranch(); current == name {
+		return appendReflog(HEAD, oldHash, newHash, message)
+	}
+	return nil
+}
+
+func UpdateHead(newHash, message string) error {
+	// Move the current branch to `newHash`, or HEAD itself when it is detached.
+	branch, err := CurrentBranch()
+	if err != nil {
+		return err
+	}
+	if branch == "" {
+		return Update(HEAD, newHash, message)
+	}
+	return Update(branch, newHash, message)
+}
+
+func SetSymbolic(name, target, message string) error {
+	// Point the symbolic ref `name` (usually HEAD) at the ref `target`.
+	oldHash, _ := Resolve(name)
+	if err := writeFile(refPath(name), []byte("ref: "+target+"\n")); err != nil {
+		return fmt.Errorf("could not update symbolic ref %s: %w", name, err)
+	}
+
+	newHash, err := Resolve(name)
+	if err != nil {
+		// The target is an unborn branch: there is nothing to log yet.
+		return nil
+	}
+	return appendReflog(name, oldHash, newHash, message)
+}
+
+func Delete(name string) error {
+	// Remove a ref, whether loose or packed, along with its reflog.
+	if err := os.Remove(refPath(name)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("could not delete ref %s: %w", name, err)
+	}
+	removeEmptyDirs(path.Dir(refPath(name)), refPath(namespace(name)))
+
+	packed, err := packedRefs()
+	if err != nil {
+		return err
+	}
+	if _, ok := packed[name]; ok {
+		if err := rewritePackedRefs(name); err != nil {
+			return err
+		}
+	}
+
+	if err := os.Remove(reflogPath(name)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("could not delete reflog for %s: %w", name, err)
+	}
+	removeEmptyDirs(path.Dir(reflogPath(name)), reflogPath(namespace(name)))
+	return nil
+}
+
+func rewritePackedRefs(skip string) error {
+	// Rewrite `packed-refs` without the ref `skip` (and its peeled line).
+	contents, err := os.ReadFile(refPath("packed-refs"))
+	if err != nil {
+		return fmt.Errorf("could not read packed-refs: %w", err)
+	}
+
+	var kept []string
+	skipping := false
+	for _, line := range strings.Split(strings.TrimSuffix(string(contents), "\n"), "\n") {
+		if strings.HasPrefix(line, "^") && skipping {
+			continue
+		}
+		_, name, _ := strings.Cut(line, " ")
+		skipping = name == skip && !strings.HasPrefix(line, "#")
+		if !skipping {
+			kept = append(kept, line)
+		}
+	}
+
+	return writeFile(refPath("packed-refs"), []byte(strings.Join(kept, "\n")+"\n"))
+}
+
+func PackRefs(all, prune bool) error {
+	// Move refs into `packed-refs`, as `git pack-refs` does: tags and refs that
+	// are already packed, or every ref with `all`. Symbolic and broken refs stay
+	// loose. Annotated tags are followed by the object they peel to. With
+	// `prune`, the loose files of the packed refs are removed.
+	packed, err := packedRefs()
+	if err != nil {
+		return err
+	}
+	loose := make(map[string]string)
+	refsDir := refPath("refs")
+	err = filepath.WalkDir(refsDir, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if entry.IsDir() || strings.HasSuffix(file, ".lock") {
+			return nil
+		}
+		rel, err := filepath.Rel(gitobj.GitDir, file)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		_, isPacked := packed[name]
+		if !all && !isPacked && !strings.HasPrefix(name, "refs/tags/") {
+			return nil
+		}
+		contents, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		if hash := strings.TrimSpace(string(contents)); gitobj.IsHash(hash) && gitobj.ObjectExists(hash) {
+			loose[name] = hash
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("could not pack refs: %w", err)
+	}
+
+	for name, hash := range loose {
+		packed[name] = hash
+	}
+	names := make([]string, 0, len(packed))
+	for name := range packed {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	var contents strings.Builder
+	contents.WriteString("# pack-refs with: peeled fully-peeled sorted \n")
+	for _, name := range names {
+		fmt.Fprintf(&contents, "%s %s\n", packed[name], name)
+		if peeled, err := Peel(packed[name], ""); err == nil && peeled != packed[name] {
+			fmt.Fprintf(&contents, "^%s\n", peeled)
+		}
+	}
+	if err := writeFile(refPath("packed-refs"), []byte(contents.String())); err != nil {
+		return fmt.Errorf("could not write packed-refs: %w", err)
+	}
+
+	if !prune {
+		return nil
+	}
+	for name, hash := range loose {
+		// Leave refs that were updated while packing.
+		if raw, err := os.ReadFile(refPath(name)); err != nil || strings.TrimSpace(string(raw)) != hash {
+			continue
+		}
+		if err := os.Remove(refPath(name)); err != nil {
+			return fmt.Errorf("could not remove loose ref %s: %w", name, err)
+		}
+		removeEmptyDirs(path.Dir(refPath(name)), refPath(namespace(name)))
+	}
+	return nil
+}
+
+func namespace(name string) string {
+	// Return the top-level ref directory of a ref, e.g. "refs/heads" for "refs/heads/a/b".
+	parts := strings.SplitN(name, "/", 3)
+	if len(parts) < 3 {
+		return path.Dir(name)
+	}
+	return parts[0] + "/" + parts[1]
+}
+
+func removeEmptyDirs(dir, stop string) {
+	// Remove directories left empty by a deletion, up to (but excluding) `stop`.
+	for dir != stop && strings.HasPrefix(dir, stop) {
+		if err := os.Remove(dir); err != nil {
+			return
+		}
+		dir = path.Dir(dir)
+	}
+}
+
+func Rename(oldName, newName, message string) error {
+	// Move a ref and its reflog to a new name.
+	hash, err := Resolve(oldName)
+	if err != nil {
+		return err
+	}
+	if Exists(newName) {
+		return fmt.Errorf("ref %s already exists", newName)
+	}
+
+	entries, err := ReadReflog(oldName)
+	if err != nil {
+		return err
+	}
+	if err := Delete(oldName); err != nil {
+		return err
+	}
+	if err := writeReflog(newName, entries); err != nil {
+		return err
+	}
+	return Update(newName, hash, message)
+}
+
+func List(prefix string) ([]Ref, error) {
+	// List loose and packed refs whose names start with `prefix`, sorted by name.
+	found := make(map[string]string)
+
+	packed, err := packedRefs()
+	if err != nil {
+		return nil, err
+	}
+	for name, hash := range packed {
+		found[name] = hash
+	}
+
+	refsDir := refPath("refs")
+	err = filepath.WalkDir(refsDir, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if entry.IsDir() || strings.HasSuffix(file, ".lock") {
+			return nil
+		}
+		rel, err := filepath.Rel(gitobj.GitDir, file)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		hash, err := Resolve(name)
+		if err != nil {
+			// Dangling symbolic refs are not listed.
+			return nil
+		}
+		found[name] = hash
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not list refs: %w", err)
+	}
+
+	var refs []Ref
+	for name, hash := range found {
+		if strings.HasPrefix(name, prefix) {
+			refs = append(refs, Ref{Name: name, Hash: hash})
+		}
+	}
+	slices.SortFunc(refs, func(x, y Ref) int { return strings.Compare(x.Name, y.Name) })
+
+	return refs, nil
+}
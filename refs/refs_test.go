@@ -0,0 +1,258 @@
+package refs
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/tsoud/GoTGit.git/gitobj"
+	"github.com/tsoud/GoTGit.git/internal/testutil"
+)
+
+func TestUpdateAndReflog(t *testing.T) {
+	testutil.InitRepo(t)
+	tree := testutil.WriteObject(t, "tree", "")
+
+	first := testutil.WriteCommit(t, tree, "first")
+	second := testutil.WriteCommit(t, tree, "second", first)
+	if err := Update("refs/heads/main", first, "commit (initial): first"); err != nil {
+		t.Fatal(err)
+	}
+	if err := UpdateHead(second, "commit: second"); err != nil {
+		t.Fatal(err)
+	}
+
+	if hash, err := Resolve(HEAD); err != nil || hash != second {
+		t.Errorf("Wanted HEAD at %s, got %s (%v)", second, hash, err)
+	}
+	for _, name := range []string{"refs/heads/main", HEAD} {
+		entries, err := ReadReflog(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 2 || entries[1].OldHash != first || entries[1].Message != "commit: second" {
+			t.Errorf("Unexpected reflog for %s: %+v", name, entries)
+		}
+	}
+
+	if err := Rename("refs/heads/main", "refs/heads/trunk", "renamed"); err != nil {
+		t.Fatal(err)
+	}
+	if Exists("refs/heads/main") || !Exists("refs/heads/trunk") {
+		t.Error("Rename did not move the branch")
+	}
+	if entries, _ := ReadReflog("refs/heads/trunk"); len(entries) != 3 {
+		t.Errorf("Wanted the reflog to move with the branch, got %+v", entries)
+	}
+
+	if err := Delete("refs/heads/trunk"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Resolve("refs/heads/trunk"); err != ErrNotFound {
+		t.Errorf("Wanted ErrNotFound after deleting, got %v", err)
+	}
+	if _, err := os.Stat(gitobj.GitDir + "/refs/heads"); err != nil {
+		t.Errorf("Deleting the last branch removed refs/heads: %v", err)
+	}
+}
+
+func TestDropReflogEntry(t *testing.T) {
+	testutil.InitRepo(t)
+	tree := testutil.WriteObject(t, "tree", "")
+
+	var commits []string
+	for _, message := range []string{"first", "second", "third"} {
+		commits = append(commits, testutil.WriteCommit(t, tree, message))
+		if err := Update("refs/stash", commits[len(commits)-1], message); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Dropping an older entry leaves the ref alone but links its neighbours.
+	if err := DropReflogEntry("refs/stash", 1); err != nil {
+		t.Fatal(err)
+	}
+	entries, _ := ReadReflog("refs/stash")
+	if len(entries) != 2 || entries[1].OldHash != commits[0] || entries[1].NewHash != commits[2] {
+		t.Errorf("Unexpected reflog after dropping stash@{1}: %+v", entries)
+	}
+
+	// Dropping the newest entry moves the ref back.
+	if err := DropReflogEntry("refs/stash", 0); err != nil {
+		t.Fatal(err)
+	}
+	if hash, err := Resolve("refs/stash"); err != nil || hash != commits[0] {
+		t.Errorf("Wanted refs/stash at %s, got %s (%v)", commits[0], hash, err)
+	}
+
+	if err := DropReflogEntry("refs/stash", 1); err == nil {
+		t.Error("Wanted an error for a missing entry")
+	}
+	if err := DropReflogEntry("refs/stash", 0); err != nil {
+		t.Fatal(err)
+	}
+	if Exists("refs/stash") {
+		t.Error("Wanted refs/stash to be deleted with its last entry")
+	}
+}
+
+func TestResolveRevision(t *testing.T) {
+	testutil.InitRepo(t)
+	tree := testutil.WriteObject(t, "tree", "")
+
+	first := testutil.WriteCommit(t, tree, "first")
+	second := testutil.WriteCommit(t, tree, "second", first)
+	if err := Update("refs/heads/main", second, "commit"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Update("refs/heads/topic", first, "branch: Created from main~1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetSymbolic(HEAD, "refs/heads/topic", "checkout: moving from main to topic"); err != nil {
+		t.Fatal(err)
+	}
+	commit, _ := gitobj.ReadCommit(second)
+
+	for rev, want := range map[string]string{
+		"HEAD":           first,
+		"@":              first,
+		"main":           second,
+		"heads/main":     second,
+		"main~1":         first,
+		"main^":          first,
+		"main^{tree}":    commit.Tree,
+		"main:":          commit.Tree,
+		"main:missing":   "",
+		"@{-1}":          second,
+		second[:7]:       second,
+		"refs/heads/top": "",
+		"main~2":         "",
+	} {
+		got, err := ResolveRevision(rev)
+		if want == "" {
+			if err == nil {
+				t.Errorf("ResolveRevision(%q): wanted an error, got %s", rev, got)
+			}
+			continue
+		}
+		if err != nil || got != want {
+			t.Errorf("ResolveRevision(%q): wanted %s, got %s (%v)", rev, want, got, err)
+		}
+	}
+
+	if err := ValidateName("refs/heads/bad..name"); err == nil {
+		t.Error("Wanted \"bad..name\" to be rejected")
+	}
+	if got := ShortName("refs/remotes/origin/main"); got != "origin/main" {
+		t.Errorf("ShortName: wanted origin/main, got %s", got)
+	}
+}
+
+func TestObjectErrors(t *testing.T) {
+	testutil.InitRepo(t)
+
+	// Objects sharing the prefix "abcd", one not compressed and one with a bad
+	// header.
+	writeRaw := func(hash string, data []byte) {
+		t.Helper()
+		dir := path.Join(gitobj.GitObjectDir, hash[:2])
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path.Join(dir, hash[2:]), data, 0444); err != nil {
+			t.Fatal(err)
+		}
+	}
+	corrupt := "abcd" + strings.Repeat("0", 36)
+	badHeader := "abcd" + strings.Repeat("1", 36)
+	writeRaw(corrupt, []byte("not zlib data"))
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	zw.Write([]byte("blob x\x00contents"))
+	zw.Close()
+	writeRaw(badHeader, buf.Bytes())
+
+	for rev, want := range map[string]error{
+		"nosuchbranch":          gitobj.ErrObjectNotFound,
+		strings.Repeat("e", 40): gitobj.ErrObjectNotFound,
+		"abcd":                  gitobj.ErrAmbiguousObject,
+	} {
+		_, err := ResolveRevision(rev)
+		if !errors.Is(err, want) {
+			t.Errorf("ResolveRevision(%q): wanted %v, got %v", rev, want, err)
+		}
+	}
+
+	for hash, want := range map[string]error{
+		corrupt:   gitobj.ErrCorruptObject,
+		badHeader: gitobj.ErrInvalidHeader,
+	} {
+		_, err := gitobj.ReadGitObj(hash)
+		var objErr *gitobj.ObjectError
+		if !errors.Is(err, want) || !errors.As(err, &objErr) || objErr.Name != hash {
+			t.Errorf("ReadGitObj(%s): wanted %v, got %v", hash, want, err)
+		}
+	}
+}
+
+func TestPackRefs(t *testing.T) {
+	testutil.InitRepo(t)
+	tree := testutil.WriteObject(t, "tree", "")
+
+	first := testutil.WriteCommit(t, tree, "first")
+	second := testutil.WriteCommit(t, tree, "second", first)
+	tagObj, err := gitobj.HashObject("tag", []byte("object "+first+"\ntype commit\ntag v1\n"+
+		"tagger Test <test@example.com> 1700000000 +0000\n\nversion one\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tagObj.Write(); err != nil {
+		t.Fatal(err)
+	}
+	for name, hash := range map[string]string{
+		"refs/heads/main":         second,
+		"refs/heads/feature/work": first,
+		"refs/tags/v1":            tagObj.Hash,
+	} {
+		if err := Update(name, hash, "test"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Only tags are packed by default.
+	if err := PackRefs(false, true); err != nil {
+		t.Fatal(err)
+	}
+	want := "# pack-refs with: peeled fully-peeled sorted \n" +
+		tagObj.Hash + " refs/tags/v1\n^" + first + "\n"
+	if got, _ := os.ReadFile(path.Join(gitobj.GitDir, "packed-refs")); string(got) != want {
+		t.Errorf("wanted packed-refs\n%s\ngot\n%s", want, got)
+	}
+	if _, err := os.Stat(path.Join(gitobj.GitDir, "refs/tags/v1")); !os.IsNotExist(err) {
+		t.Errorf("wanted the loose tag to be pruned, got %v", err)
+	}
+	if _, err := os.Stat(path.Join(gitobj.GitDir, "refs/heads/main")); err != nil {
+		t.Errorf("wanted the branch to stay loose, got %v", err)
+	}
+
+	if err := PackRefs(true, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path.Join(gitobj.GitDir, "refs/heads/feature")); !os.IsNotExist(err) {
+		t.Errorf("wanted empty ref directories to be removed, got %v", err)
+	}
+	for name, want := range map[string]string{
+		"refs/heads/main":         second,
+		"refs/heads/feature/work": first,
+		"refs/tags/v1":            tagObj.Hash,
+		HEAD:                      second,
+	} {
+		if got, err := Resolve(name); err != nil || got != want {
+			t.Errorf("Resolve(%s): wanted %s, got %s (%v)", name, want, got, err)
+		}
+	}
+}
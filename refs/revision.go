@@ -0,0 +1,281 @@
+package refs
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/tsoud/GoTGit.git/gitobj"
+	"github.com/tsoud/GoTGit.git/index"
+)
+
+func PreviousBranch(n int) (string, error) {
+	// Return the branch (or commit, if HEAD was detached) checked out `n` switches
+	// ago, as recorded by "checkout: moving from <a> to <b>" entries in HEAD's reflog.
+	entries, err := ReadReflog(HEAD)
+	if err != nil {
+		return "", err
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		from, found := strings.CutPrefix(entries[i].Message, "checkout: moving from ")
+		if !found {
+			continue
+		}
+		if n--; n == 0 {
+			from, _, _ = strings.Cut(from, " to ")
+			return from, nil
+		}
+	}
+	return "", fmt.Errorf("no previous branch found")
+}
+
+func resolveReflog(name, selector string) (string, error) {
+	// Resolve `<name>@{<n>}` to the value the ref had `n` updates ago.
+	n, err := strconv.Atoi(selector)
+	if err != nil || n < 0 {
+		return "", fmt.Errorf("unsupported reflog selector @{%s}", selector)
+	}
+
+	if name == "" {
+		if name, err = CurrentBranch(); err != nil {
+			return "", err
+		}
+		if name == "" {
+			name = HEAD
+		}
+	} else if fullName, ok := Expand(name); ok {
+		name = fullName
+	}
+
+	entries, err := ReadReflog(name)
+	if err != nil {
+		return "", err
+	}
+	if n >= len(entries) {
+		return "", fmt.Errorf("log for '%s' only has %d entries", ShortName(name), len(entries))
+	}
+	return entries[len(entries)-1-n].NewHash, nil
+}
+
+func resolveBase(base string) (string, error) {
+	if base == "@" {
+		base = HEAD
+	}
+
+	if name, selector, found := strings.Cut(base, "@{"); found {
+		selector = strings.TrimSuffix(selector, "}")
+		if name == "" && strings.HasPrefix(selector, "-") {
+			n, err := strconv.Atoi(selector[1:])
+			if err != nil || n < 1 {
+				return "", fmt.Errorf("invalid previous branch selector @{%s}", selector)
+			}
+			previous, err := PreviousBranch(n)
+			if err != nil {
+				return "", err
+			}
+			return resolveBase(previous)
+		}
+		return resolveReflog(name, selector)
+	}
+
+	if gitobj.IsHash(base) && gitobj.ObjectExists(base) {
+		return base, nil
+	}
+	if fullName, ok := Expand(base); ok {
+		return Resolve(fullName)
+	}
+	if isAbbrevHash(base) {
+		return gitobj.ExpandHash(base)
+	}
+
+	return "", &gitobj.ObjectError{Name: base, Kind: gitobj.ErrObjectNotFound,
+		Message: fmt.Sprintf("unknown revision '%s'", base)}
+}
+
+func isAbbrevHash(name string) bool {
+	// Report whether `name` could be an abbreviated hash: at least four hex
+	// digits, in either case.
+	return len(name) >= 4 && len(name) <= gitobj.ObjectFormat.HexSize() &&
+		strings.Trim(strings.ToLower(name), "0123456789abcdef") == ""
+}
+
+func Peel(hash, objType string) (string, error) {
+	// Follow tags (and commits, for trees) from `hash` until reaching an object of
+	// type `objType`. An empty type peels tags only.
+	for {
+		obj, err := gitobj.ReadGitObj(hash)
+		if err != nil {
+			return "", err
+		}
+		if obj.Type == objType || (objType == "" && obj.Type != "tag") {
+			return hash, nil
+		}
+
+		switch {
+		case obj.Type == "tag":
+			tag, err := gitobj.ParseTag(hash, obj.Content)
+			if err != nil {
+				return "", err
+			}
+			hash = tag.Object
+		case obj.Type == "commit" && objType == "tree":
+			commit, err := gitobj.ParseCommit(hash, obj.Content)
+			if err != nil {
+				return "", err
+			}
+			return commit.Tree, nil
+		default:
+			return "", fmt.Errorf("%s is a %s, not a %s", hash, obj.Type, objType)
+		}
+	}
+}
+
+func applySuffix(hash, suffix string) (string, string, error) {
+	// Apply the leading navigation operator of `suffix` and return what remains.
+	if typeName, found := strings.CutPrefix(suffix, "^{"); found {
+		end := strings.IndexByte(typeName, '}')
+		if end == -1 {
+			return "", "", fmt.Errorf("missing closing brace in %s", suffix)
+		}
+		peeled, err := Peel(hash, typeName[:end])
+		return peeled, typeName[end+1:], err
+	}
+
+	op := suffix[0]
+	digits := 0
+	for digits+1 < len(suffix) && suffix[digits+1] >= '0' && suffix[digits+1] <= '9' {
+		digits++
+	}
+	n := 1
+	if digits > 0 {
+		n, _ = strconv.Atoi(suffix[1 : digits+1])
+	}
+	rest := suffix[digits+1:]
+
+	commitHash, err := Peel(hash, "commit")
+	if err != nil {
+		return "", "", err
+	}
+	if op == '^' {
+		if n == 0 {
+			return commitHash, rest, nil
+		}
+		commit, err := gitobj.ReadCommit(commitHash)
+		if err != nil {
+			return "", "", err
+		}
+		if n > len(commit.Parents) {
+			return "", "", fmt.Errorf("commit %s has no parent %d", commitHash, n)
+		}
+		return commit.Parents[n-1], rest, nil
+	}
+
+	for ; n > 0; n-- {
+		commit, err := gitobj.ReadCommit(commitHash)
+		if err != nil {
+			return "", "", err
+		}
+		if len(commit.Parents) == 0 {
+			return "", "", fmt.Errorf("commit %s has no parent", commitHash)
+		}
+		commitHash = commit.Parents[0]
+	}
+	return commitHash, rest, nil
+}
+
+func resolveIndexPath(filePath string) (string, error) {
+	// Resolve `:[<stage>:]<path>` to the hash of the blob staged for `path`.
+	stage := 0
+	if len(filePath) > 2 && filePath[1] == ':' && filePath[0] >= '0' && filePath[0] <= '3' {
+		stage = int(filePath[0] - '0')
+		filePath = filePath[2:]
+	}
+
+	idx, err := index.Read()
+	if err != nil {
+		return "", err
+	}
+	entry := idx.Find(filePath, stage)
+	if entry == nil {
+		if stage > 0 && len(idx.Stages(filePath)) > 0 {
+			return "", fmt.Errorf("path '%s' is in the index, but not at stage %d", filePath, stage)
+		}
+		return "", fmt.Errorf("path '%s' does not exist in the index", filePath)
+	}
+	return entry.Hash, nil
+}
+
+func resolvePath(treeish, filePath string) (string, error) {
+	// Resolve `<tree-ish>:<path>` to the hash of the object at `path` in the tree.
+	// An empty path names the tree itself.
+	hash, err := ResolveTree(treeish)
+	if err != nil {
+		return "", err
+	}
+
+	for _, name := range strings.Split(filePath, "/") {
+		if name == "" {
+			continue
+		}
+		entries, err := gitobj.ReadTree(hash)
+		if err != nil {
+			return "", fmt.Errorf("path '%s' does not exist in '%s'", filePath, treeish)
+		}
+		found := false
+		for _, entry := range entries {
+			if entry.Name == name {
+				hash, found = entry.Hash, true
+				break
+			}
+		}
+		if !found {
+			return "", fmt.Errorf("path '%s' does not exist in '%s'", filePath, treeish)
+		}
+	}
+	return hash, nil
+}
+
+func ResolveRevision(rev string) (string, error) {
+	// Resolve a revision such as `main`, `HEAD~2`, `v1.0^{tree}`, `@{-1}`,
+	// `HEAD:dir/file`, `:file` or an abbreviated hash to a full object hash.
+	if treeish, filePath, found := strings.Cut(rev, ":"); found {
+		if treeish == "" {
+			return resolveIndexPath(filePath)
+		}
+		return resolvePath(treeish, filePath)
+	}
+
+	baseEnd := len(rev)
+	if idx := strings.IndexAny(rev, "^~"); idx != -1 {
+		baseEnd = idx
+	}
+	hash, err := resolveBase(rev[:baseEnd])
+	if err != nil {
+		return "", err
+	}
+
+	for suffix := rev[baseEnd:]; suffix != ""; {
+		if hash, suffix, err = applySuffix(hash, suffix); err != nil {
+			return "", fmt.Errorf("could not resolve %s: %w", rev, err)
+		}
+	}
+	return hash, nil
+}
+
+func ResolveCommit(rev string) (string, error) {
+	// Resolve a revision and make sure it names a commit.
+	hash, err := ResolveRevision(rev)
+	if err != nil {
+		return "", err
+	}
+	return Peel(hash, "commit")
+}
+
+func ResolveTree(rev string) (string, error) {
+	// Resolve a tree-ish revision to the hash of its tree.
+	hash, err := ResolveRevision(rev)
+	if err != nil {
+		return "", err
+	}
+	return Peel(hash, "tree")
+}
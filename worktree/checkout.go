@@ -0,0 +1,255 @@
+package worktree
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/tsoud/GoTGit.git/gitobj"
+	"github.com/tsoud/GoTGit.git/index"
+	"github.com/tsoud/GoTGit.git/merge"
+)
+
+type CheckoutOptions struct {
+	// Force discards local changes to files that differ between the two trees.
+	Force bool
+	// Merge carries local changes over with a three-way merge instead of refusing.
+	Merge bool
+	// NewLabel names the target in conflict markers written by a merge.
+	NewLabel string
+}
+
+type checkoutAction int
+
+const (
+	keepPath checkoutAction = iota
+	updatePath
+	mergePath
+)
+
+func treeFiles(treeHash string) (map[string]gitobj.TreeEntry, error) {
+	files, err := gitobj.ReadTreeRecursive(treeHash)
+	if err != nil {
+		return nil, err
+	}
+	byPath := make(map[string]gitobj.TreeEntry, len(files))
+	for _, file := range files {
+		byPath[file.Name] = file
+	}
+	return byPath, nil
+}
+
+func sameEntry(x, y *gitobj.TreeEntry) bool {
+	if x == nil || y == nil {
+		return x == nil && y == nil
+	}
+	return x.Hash == y.Hash && x.Mode == y.Mode
+}
+
+func indexMatches(entry *index.Entry, treeEntry *gitobj.TreeEntry) bool {
+	if entry == nil || treeEntry == nil {
+		return entry == nil && treeEntry == nil
+	}
+	return entry.Hash == treeEntry.Hash && entry.ModeString() == treeEntry.Mode
+}
+
+func isClean(entry *index.Entry, filePath string) (bool, error) {
+	// A path is clean when its working tree file matches the index (or both are absent).
+	if entry == nil {
+		return !Exists(filePath), nil
+	}
+	modified, err := IsModified(entry)
+	return !modified, err
+}
+
+func lookup(files map[string]gitobj.TreeEntry, filePath string) *gitobj.TreeEntry {
+	if entry, ok := files[filePath]; ok {
+		return &entry
+	}
+	return nil
+}
+
+func Checkout(idx *index.Index, oldTree, newTree string, opts *CheckoutOptions) ([]string, error) {
+	// Update the index and working tree from `oldTree` to `newTree` (two-way merge).
+	// Paths unchanged between the trees keep their local modifications. Paths that
+	// change are refused if they have local changes, unless `opts` allows
+	// overwriting or merging them. Returns the paths left with merge conflicts.
+	if opts == nil {
+		opts = &CheckoutOptions{}
+	}
+	if unmerged := idx.Unmerged(); len(unmerged) > 0 && !opts.Force && !opts.Merge {
+		return nil, fmt.Errorf("you need to resolve your current index first:\n\t%s",
+			strings.Join(unmerged, "\n\t"))
+	}
+
+	oldFiles, err := treeFiles(oldTree)
+	if err != nil {
+		return nil, err
+	}
+	newFiles, err := treeFiles(newTree)
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	for filePath := range oldFiles {
+		paths = append(paths, filePath)
+	}
+	for filePath := range newFiles {
+		if _, ok := oldFiles[filePath]; !ok {
+			paths = append(paths, filePath)
+		}
+	}
+	if opts.Force {
+		// Forcing also resets files that are only known to the index.
+		for _, entry := range idx.Entries {
+			_, inOld := oldFiles[entry.Path]
+			_, inNew := newFiles[entry.Path]
+			if !inOld && !inNew && !slices.Contains(paths, entry.Path) {
+				paths = append(paths, entry.Path)
+			}
+		}
+	}
+	slices.Sort(paths)
+
+	actions := make(map[string]checkoutAction)
+	var localChanges, untracked []string
+	for _, filePath := range paths {
+		oldEntry, newEntry := lookup(oldFiles, filePath), lookup(newFiles, filePath)
+		indexEntry := idx.Find(filePath, 0)
+		unmerged := indexEntry == nil && len(idx.Stages(filePath)) > 0
+
+		if opts.Force {
+			actions[filePath] = updatePath
+			continue
+		}
+		if sameEntry(oldEntry, newEntry) && !unmerged {
+			continue
+		}
+
+		clean, err := isClean(indexEntry, filePath)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case indexMatches(indexEntry, newEntry) && clean:
+			// Already in the target state.
+			actions[filePath] = keepPath
+		case indexMatches(indexEntry, oldEntry) && clean && !unmerged:
+			actions[filePath] = updatePath
+		case opts.Merge && oldEntry != nil && newEntry != nil && Exists(filePath):
+			actions[filePath] = mergePath
+		case oldEntry == nil && indexEntry == nil && !unmerged:
+			untracked = append(untracked, filePath)
+		default:
+			localChanges = append(localChanges, filePath)
+		}
+	}
+
+	if len(localChanges) > 0 {
+		return nil, fmt.Errorf("Your local changes to the following files would be overwritten by checkout:\n\t%s\n"+
+			"Please commit your changes or stash them before you switch branches.\nAborting",
+			strings.Join(localChanges, "\n\t"))
+	}
+	if len(untracked) > 0 {
+		return nil, fmt.Errorf("The following untracked working tree files would be overwritten by checkout:\n\t%s\n"+
+			"Please move or remove them before you switch branches.\nAborting",
+			strings.Join(untracked, "\n\t"))
+	}
+
+	// Remove files first so that directories can replace them.
+	for _, filePath := range paths {
+		if actions[filePath] == updatePath && lookup(newFiles, filePath) == nil {
+			idx.Remove(filePath)
+			if err := RemoveFile(filePath); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var conflicts []string
+	for _, filePath := range paths {
+		newEntry := lookup(newFiles, filePath)
+		if newEntry == nil {
+			continue
+		}
+		switch actions[filePath] {
+		case updatePath:
+			if err := WriteFile(filePath, newEntry.Hash, newEntry.Mode); err != nil {
+				return nil, err
+			}
+			entry, err := NewEntry(filePath, newEntry.Hash, newEntry.Mode)
+			if err != nil {
+				return nil, err
+			}
+			idx.Add(entry)
+		case mergePath:
+			conflicted, err := mergeLocalChanges(idx, filePath, lookup(oldFiles, filePath), newEntry, opts)
+			if err != nil {
+				return nil, err
+			}
+			if conflicted {
+				conflicts = append(conflicts, filePath)
+			}
+		}
+	}
+
+	return conflicts, nil
+}
+
+func mergeLocalChanges(
+	idx *index.Index, filePath string, oldEntry, newEntry *gitobj.TreeEntry, opts *CheckoutOptions,
+) (bool, error) {
+	// Merge a locally modified file with the target version, using the old tree's
+	// version as the base. A clean result stages the target version; a conflict
+	// records all three versions as index stages.
+	localObj, _, err := fileObject(filePath)
+	if err != nil {
+		return false, err
+	}
+	if err := localObj.Write(); err != nil {
+		return false, err
+	}
+	localContent, err := os.ReadFile(filePath)
+	if err != nil {
+		return false, err
+	}
+
+	baseObj, err := gitobj.ReadGitObj(oldEntry.Hash)
+	if err != nil {
+		return false, err
+	}
+	newObj, err := gitobj.ReadGitObj(newEntry.Hash)
+	if err != nil {
+		return false, err
+	}
+
+	merged, conflicts := merge.MergeContent(baseObj.Content, newObj.Content, localContent,
+		&merge.ContentOptions{OursLabel: opts.NewLabel, TheirsLabel: "local"})
+	if err := os.WriteFile(filePath, merged, 0644); err != nil {
+		return false, fmt.Errorf("could not write %s: %w", filePath, err)
+	}
+	if err := os.Chmod(filePath, os.FileMode(index.ParseMode(newEntry.Mode)&0777)); err != nil {
+		return false, err
+	}
+
+	if conflicts == 0 {
+		entry, err := NewEntry(filePath, newEntry.Hash, newEntry.Mode)
+		if err != nil {
+			return false, err
+		}
+		// The file still has local changes, so its stat data must not match the index.
+		entry.Size = 0
+		idx.Add(entry)
+		return false, nil
+	}
+
+	idx.Remove(filePath)
+	for stage, hash := range []string{oldEntry.Hash, newEntry.Hash, localObj.Hash} {
+		idx.Add(&index.Entry{
+			Path: filePath, Hash: hash, Stage: stage + 1, Mode: index.ParseMode(newEntry.Mode),
+		})
+	}
+	return true, nil
+}
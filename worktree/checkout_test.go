@@ -0,0 +1,136 @@
+package worktree
+
+import (
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/tsoud/GoTGit.git/gitobj"
+	"github.com/tsoud/GoTGit.git/index"
+	"github.com/tsoud/GoTGit.git/internal/testutil"
+)
+
+func TestCheckout(t *testing.T) {
+	testutil.ChdirTemp(t)
+
+	oldTree := testutil.WriteTree(t, map[string]string{
+		"kept.txt": "kept\n", "changed.txt": "a\nb\nc\n", "dir/gone.txt": "gone\n",
+	})
+	newTree := testutil.WriteTree(t, map[string]string{
+		"kept.txt": "kept\n", "changed.txt": "a\nb\nC\n", "added/file.txt": "new\n",
+	})
+
+	idx := &index.Index{Version: 2}
+	if _, err := Checkout(idx, "", oldTree, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := testutil.ReadFile(t, "dir/gone.txt"); got != "gone\n" || len(idx.Entries) != 3 {
+		t.Fatalf("Initial checkout failed: %q, %d entries", got, len(idx.Entries))
+	}
+
+	// Local changes to a file that differs between the trees block the checkout.
+	if err := os.WriteFile("changed.txt", []byte("A\nb\nc\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile("kept.txt", []byte("local\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := Checkout(idx, oldTree, newTree, nil)
+	if err == nil || !strings.Contains(err.Error(), "changed.txt") || strings.Contains(err.Error(), "kept.txt") {
+		t.Fatalf("Wanted changed.txt to block the checkout, got %v", err)
+	}
+
+	// Merging carries them over.
+	conflicts, err := Checkout(idx, oldTree, newTree, &CheckoutOptions{Merge: true, NewLabel: "new"})
+	if err != nil || len(conflicts) > 0 {
+		t.Fatalf("Wanted a clean merge, got %v, %v", conflicts, err)
+	}
+	if got := testutil.ReadFile(t, "changed.txt"); got != "A\nb\nC\n" {
+		t.Errorf("Wanted merged contents, got %q", got)
+	}
+	if got := testutil.ReadFile(t, "kept.txt"); got != "local\n" {
+		t.Errorf("Unrelated local change was lost: %q", got)
+	}
+	if Exists("dir") || testutil.ReadFile(t, "added/file.txt") != "new\n" {
+		t.Error("Files were not added and removed")
+	}
+
+	// Forcing discards every local change.
+	if _, err := Checkout(idx, newTree, oldTree, &CheckoutOptions{Force: true}); err != nil {
+		t.Fatal(err)
+	}
+	for file, want := range map[string]string{"kept.txt": "kept\n", "changed.txt": "a\nb\nc\n"} {
+		if got := testutil.ReadFile(t, file); got != want {
+			t.Errorf("%s: wanted %q, got %q", file, want, got)
+		}
+	}
+	changes, err := LocalChanges(idx, oldTree)
+	if err != nil || len(changes) != 0 {
+		t.Errorf("Wanted no local changes after a forced checkout, got %v (%v)", changes, err)
+	}
+}
+
+func TestMatchPathspec(t *testing.T) {
+	for _, test := range []struct {
+		path  string
+		specs []string
+		want  bool
+	}{
+		{"a/b.txt", nil, true},
+		{"a/b.txt", []string{"."}, true},
+		{"a/b.txt", []string{"a"}, true},
+		{"a/b.txt", []string{"a/"}, true},
+		{"ab/c.txt", []string{"a"}, false},
+		{"a/b.txt", []string{"a/*.txt"}, true},
+		{"a/b.go", []string{"*.txt", "a/b.go"}, true},
+	} {
+		if got := MatchPathspec(test.path, test.specs); got != test.want {
+			t.Errorf("MatchPathspec(%q, %q): wanted %t, got %t", test.path, test.specs, test.want, got)
+		}
+	}
+}
+
+func TestUntracked(t *testing.T) {
+	testutil.ChdirTemp(t)
+	for name, content := range map[string]string{
+		".gitignore":                 "*.log\n!keep.log\nbuild/\n/top.txt\n",
+		"tracked.txt":                "tracked\n",
+		"new.txt":                    "new\n",
+		"top.txt":                    "ignored at the top only\n",
+		"sub/top.txt":                "not ignored\n",
+		"sub/debug.log":              "ignored\n",
+		"sub/keep.log":               "kept\n",
+		"build/out.bin":              "ignored\n",
+		"docs/.gitignore":            "draft*\n",
+		"docs/draft1.md":             "ignored\n",
+		"draft2.md":                  "not ignored\n",
+		gitobj.GitDir + "/HEAD":      "ref: refs/heads/main\n",
+		gitobj.GitDir + "/info/excl": "\n",
+	} {
+		if err := os.MkdirAll(path.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	idx := &index.Index{Version: 2, Entries: []*index.Entry{{Path: "tracked.txt"}}}
+
+	files, err := Untracked(idx, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ".gitignore docs/.gitignore draft2.md new.txt sub/keep.log sub/top.txt"
+	if got := strings.Join(files, " "); got != want {
+		t.Errorf("Wanted untracked files %s, got %s", want, got)
+	}
+
+	files, err = Untracked(idx, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 10 {
+		t.Errorf("Wanted 10 files including ignored ones, got %v", files)
+	}
+}
@@ -0,0 +1,119 @@
+package worktree
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/tsoud/GoTGit.git/gitobj"
+	"github.com/tsoud/GoTGit.git/index"
+	"github.com/tsoud/GoTGit.git/internal/pathglob"
+)
+
+// ignoreRule is one pattern from a .gitignore file or info/exclude.
+type ignoreRule struct {
+	pattern string
+	// base is the directory holding the .gitignore file, "" for the top level.
+	base     string
+	negate   bool
+	dirOnly  bool
+	anchored bool
+}
+
+type ignoreRules []ignoreRule
+
+func readIgnoreRules(file, base string) ignoreRules {
+	// Parse the patterns of an ignore file; a missing file has none.
+	contents, err := os.ReadFile(file)
+	if err != nil {
+		return nil
+	}
+	var rules ignoreRules
+	for _, line := range strings.Split(string(contents), "\n") {
+		line = strings.TrimRight(line, " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule := ignoreRule{base: base}
+		if rest, ok := strings.CutPrefix(line, "!"); ok {
+			rule.negate, line = true, rest
+		}
+		line = strings.TrimPrefix(line, `\`)
+		if rest, ok := strings.CutSuffix(line, "/"); ok {
+			rule.dirOnly, line = true, rest
+		}
+		// A slash anywhere but at the end ties the pattern to the file's directory.
+		rule.anchored = strings.Contains(line, "/") && !strings.HasPrefix(line, "**/")
+		rule.pattern = strings.TrimPrefix(strings.TrimPrefix(line, "**/"), "/")
+		if rule.pattern != "" {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+func (rule ignoreRule) matches(filePath string, isDir bool) bool {
+	if rule.dirOnly && !isDir {
+		return false
+	}
+	relPath := filePath
+	if rule.base != "" {
+		var ok bool
+		if relPath, ok = strings.CutPrefix(filePath, rule.base+"/"); !ok {
+			return false
+		}
+	}
+	if !rule.anchored {
+		relPath = path.Base(relPath)
+	}
+	return pathglob.Match(rule.pattern, relPath)
+}
+
+func (rules ignoreRules) ignored(filePath string, isDir bool) bool {
+	// The last matching rule decides, so later and deeper files take precedence.
+	ignored := false
+	for _, rule := range rules {
+		if rule.matches(filePath, isDir) {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
+
+func Untracked(idx *index.Index, includeIgnored bool) ([]string, error) {
+	// List the working tree files that are not in the index, skipping the
+	// repository itself and, unless `includeIgnored` is set, files matched by
+	// .gitignore files or info/exclude.
+	tracked := make(map[string]bool)
+	for _, entry := range idx.Entries {
+		tracked[entry.Path] = true
+	}
+	rules := readIgnoreRules(path.Join(gitobj.GitDir, "info", "exclude"), "")
+	rules = append(rules, readIgnoreRules(".gitignore", "")...)
+
+	var files []string
+	err := filepath.WalkDir(".", func(file string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		file = filepath.ToSlash(file)
+		if file == "." {
+			return nil
+		}
+		if entry.IsDir() {
+			if file == gitobj.GitDir || entry.Name() == ".git" || tracked[file] ||
+				!includeIgnored && rules.ignored(file, true) {
+				return filepath.SkipDir
+			}
+			rules = append(rules, readIgnoreRules(path.Join(file, ".gitignore"), file)...)
+			return nil
+		}
+		if !tracked[file] && (includeIgnored || !rules.ignored(file, false)) {
+			files = append(files, file)
+		}
+		return nil
+	})
+	return files, err
+}
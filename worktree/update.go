@@ -0,0 +1,102 @@
+package worktree
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/tsoud/GoTGit.git/index"
+)
+
+func ApplyIndex(before []*index.Entry, idx *index.Index, force bool) error {
+	// Bring the working tree in line with `idx` after it was changed from the
+	// entries in `before`: write files whose stage 0 entry changed and remove
+	// files that left the index. Unless `force` is set, files with local changes
+	// and untracked files in the way abort the update before anything is touched.
+	// Paths left unmerged keep their working tree file.
+	old := make(map[string]*index.Entry)
+	tracked := make(map[string]bool)
+	for _, entry := range before {
+		tracked[entry.Path] = true
+		if entry.Stage == 0 {
+			old[entry.Path] = entry
+		}
+	}
+
+	var writes []*index.Entry
+	var removals []string
+	for _, entry := range idx.Entries {
+		if entry.Stage != 0 {
+			continue
+		}
+		oldEntry := old[entry.Path]
+		if oldEntry != nil && oldEntry.Hash == entry.Hash && oldEntry.Mode == entry.Mode {
+			if !force {
+				continue
+			}
+			// Forcing also restores files that have local changes.
+			if modified, err := IsModified(oldEntry); err != nil || !modified {
+				continue
+			}
+		}
+		writes = append(writes, entry)
+	}
+	for filePath := range tracked {
+		if len(idx.Stages(filePath)) == 0 {
+			removals = append(removals, filePath)
+		}
+	}
+
+	if !force {
+		var notUpToDate, untracked []string
+		check := func(filePath string) error {
+			oldEntry := old[filePath]
+			switch {
+			case oldEntry != nil:
+				modified, err := IsModified(oldEntry)
+				if err != nil {
+					return err
+				}
+				if modified {
+					notUpToDate = append(notUpToDate, filePath)
+				}
+			case !tracked[filePath] && Exists(filePath):
+				untracked = append(untracked, filePath)
+			}
+			return nil
+		}
+		for _, entry := range writes {
+			if err := check(entry.Path); err != nil {
+				return err
+			}
+		}
+		for _, filePath := range removals {
+			if err := check(filePath); err != nil {
+				return err
+			}
+		}
+		if len(notUpToDate) > 0 {
+			return fmt.Errorf("Entry '%s' not uptodate. Cannot merge.", strings.Join(notUpToDate, "', '"))
+		}
+		if len(untracked) > 0 {
+			return fmt.Errorf("Untracked working tree file '%s' would be overwritten by merge.",
+				strings.Join(untracked, "', '"))
+		}
+	}
+
+	for _, filePath := range removals {
+		if err := RemoveFile(filePath); err != nil {
+			return err
+		}
+	}
+	for _, entry := range writes {
+		if err := WriteFile(entry.Path, entry.Hash, entry.ModeString()); err != nil {
+			return err
+		}
+		updated, err := NewEntry(entry.Path, entry.Hash, entry.ModeString())
+		if err != nil {
+			return err
+		}
+		*entry = *updated
+	}
+	return nil
+}
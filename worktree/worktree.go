@@ -0,0 +1,260 @@
+package worktree
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/tsoud/GoTGit.git/diff"
+	"github.com/tsoud/GoTGit.git/gitobj"
+	"github.com/tsoud/GoTGit.git/index"
+)
+
+func fileObject(file string) (*gitobj.GitObject, string, error) {
+	// Create the blob object for a working tree file. Symbolic links are stored as
+	// their target path.
+	info, err := os.Lstat(file)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if info.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(file)
+		if err != nil {
+			return nil, "", fmt.Errorf("could not read link %s: %w", file, err)
+		}
+		linkObj, err := gitobj.HashObject("blob", []byte(target))
+		return linkObj, "120000", err
+	}
+
+	blobObj, err := gitobj.HashBlob(file)
+	if err != nil {
+		return nil, "", err
+	}
+	return blobObj, blobObj.Mode, nil
+}
+
+func HashFile(file string) (string, string, error) {
+	// Return the blob hash and Git mode of a working tree file without storing it.
+	blobObj, mode, err := fileObject(file)
+	if err != nil {
+		return "", "", err
+	}
+	return blobObj.Hash, mode, nil
+}
+
+func AddFile(file string) (*index.Entry, error) {
+	// Store a working tree file as a blob and create its index entry.
+	blobObj, mode, err := fileObject(file)
+	if err != nil {
+		return nil, err
+	}
+	if err := blobObj.Write(); err != nil {
+		return nil, fmt.Errorf("error writing %s: %w", file, err)
+	}
+
+	return NewEntry(file, blobObj.Hash, mode)
+}
+
+func NewEntry(file, hash, mode string) (*index.Entry, error) {
+	// Create a stage 0 index entry for a file that matches the blob `hash`.
+	entry := &index.Entry{Path: filepath.ToSlash(file), Hash: hash, Mode: index.ParseMode(mode)}
+	info, err := os.Lstat(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return entry, nil
+		}
+		return nil, err
+	}
+	entry.UpdateStat(info)
+	return entry, nil
+}
+
+func modeOf(info os.FileInfo) uint32 {
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		return 0120000
+	case info.IsDir():
+		return 0160000
+	case info.Mode()&0111 != 0:
+		return 0100755
+	default:
+		return 0100644
+	}
+}
+
+func IsModified(entry *index.Entry) (bool, error) {
+	// Report whether the working tree copy of an index entry differs from it.
+	// Files whose size and modification time match the index are assumed unchanged.
+	info, err := os.Lstat(entry.Path)
+	if err != nil {
+		if os.IsNotExist(err) || errors.Is(err, syscall.ENOTDIR) {
+			return true, nil
+		}
+		return false, err
+	}
+	if modeOf(info) != entry.Mode {
+		return true, nil
+	}
+	if entry.Mode == 0160000 {
+		return false, nil
+	}
+	if uint32(info.Size()) == entry.Size && uint32(info.ModTime().Unix()) == entry.MTimeSec &&
+		uint32(info.ModTime().Nanosecond()) == entry.MTimeNsec {
+		return false, nil
+	}
+
+	hash, _, err := HashFile(entry.Path)
+	if err != nil {
+		return false, err
+	}
+	return hash != entry.Hash, nil
+}
+
+func Exists(file string) bool {
+	_, err := os.Lstat(file)
+	return err == nil
+}
+
+func WriteFile(file, hash, mode string) error {
+	// Write the blob `hash` to `file` with the permissions given by its Git mode,
+	// replacing whatever is there. Mode 120000 creates a symbolic link.
+	if err := os.RemoveAll(file); err != nil {
+		return fmt.Errorf("could not replace %s: %w", file, err)
+	}
+	if err := makeParentDirs(file); err != nil {
+		return err
+	}
+
+	if mode == "160000" {
+		// Submodules are checked out as empty directories.
+		return os.MkdirAll(file, 0755)
+	}
+
+	blobObj, err := gitobj.ReadGitObj(hash)
+	if err != nil {
+		return err
+	}
+	if blobObj.Type != "blob" {
+		return fmt.Errorf("%s is a %s, not a blob", hash, blobObj.Type)
+	}
+
+	switch mode {
+	case "120000":
+		if err := os.Symlink(string(blobObj.Content), file); err != nil {
+			return fmt.Errorf("could not create symbolic link %s: %w", file, err)
+		}
+	case "100755":
+		if err := os.WriteFile(file, blobObj.Content, 0755); err != nil {
+			return fmt.Errorf("could not write %s: %w", file, err)
+		}
+		return os.Chmod(file, 0755)
+	default:
+		if err := os.WriteFile(file, blobObj.Content, 0644); err != nil {
+			return fmt.Errorf("could not write %s: %w", file, err)
+		}
+	}
+	return nil
+}
+
+func makeParentDirs(file string) error {
+	// Create the directories leading to `file`, removing files that are in the way.
+	dir := filepath.Dir(file)
+	if err := os.MkdirAll(dir, 0755); err == nil {
+		return nil
+	}
+	for parent := dir; parent != "." && parent != "/"; parent = filepath.Dir(parent) {
+		if info, err := os.Lstat(parent); err == nil && !info.IsDir() {
+			if err := os.Remove(parent); err != nil {
+				return fmt.Errorf("could not replace %s: %w", parent, err)
+			}
+			break
+		}
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("could not create directory %s: %w", dir, err)
+	}
+	return nil
+}
+
+func RemoveFile(file string) error {
+	// Delete a file from the working tree along with any directories left empty.
+	if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("could not remove %s: %w", file, err)
+	}
+	for dir := filepath.Dir(file); dir != "." && dir != "/"; dir = filepath.Dir(dir) {
+		if err := os.Remove(dir); err != nil {
+			break
+		}
+	}
+	return nil
+}
+
+func LocalChanges(idx *index.Index, treeHash string) ([]*diff.Change, error) {
+	// List the paths where the index or the working tree differ from `treeHash`.
+	treeFiles, err := gitobj.ReadTreeRecursive(treeHash)
+	if err != nil {
+		return nil, err
+	}
+	inTree := make(map[string]gitobj.TreeEntry)
+	for _, file := range treeFiles {
+		inTree[file.Name] = file
+	}
+
+	var changes []*diff.Change
+	seen := make(map[string]bool)
+	for _, entry := range idx.Entries {
+		if seen[entry.Path] {
+			continue
+		}
+		seen[entry.Path] = true
+
+		treeEntry, tracked := inTree[entry.Path]
+		modified, err := IsModified(entry)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case entry.Stage > 0:
+			changes = append(changes, &diff.Change{Status: diff.Unmerged, NewPath: entry.Path})
+		case !tracked:
+			changes = append(changes, &diff.Change{Status: diff.Added, NewPath: entry.Path})
+		case !Exists(entry.Path):
+			changes = append(changes, &diff.Change{Status: diff.Deleted, OldPath: entry.Path})
+		case modified || treeEntry.Hash != entry.Hash || treeEntry.Mode != entry.ModeString():
+			changes = append(changes, &diff.Change{
+				Status: diff.Modified, OldPath: entry.Path, NewPath: entry.Path,
+			})
+		}
+	}
+	for _, file := range treeFiles {
+		if !seen[file.Name] {
+			changes = append(changes, &diff.Change{Status: diff.Deleted, OldPath: file.Name})
+		}
+	}
+	diff.SortChanges(changes)
+
+	return changes, nil
+}
+
+func MatchPathspec(filePath string, pathspecs []string) bool {
+	// Match a path against pathspecs: an exact path, a leading directory, or a
+	// glob pattern. No pathspecs match everything.
+	if len(pathspecs) == 0 {
+		return true
+	}
+	for _, spec := range pathspecs {
+		spec = strings.TrimSuffix(filepath.ToSlash(filepath.Clean(spec)), "/")
+		if spec == "." || spec == filePath || strings.HasPrefix(filePath, spec+"/") {
+			return true
+		}
+		if matched, _ := path.Match(spec, filePath); matched {
+			return true
+		}
+	}
+	return false
+}